@@ -93,6 +93,15 @@ Defines the service name for the webhook
 {{ .Release.Name }}
 {{- end }}
 
+{{/*
+Arguments that identify the webhook configuration registered by the webhook itself
+*/}}
+{{- define "k8tz.registrationArgs" }}
+          - "--webhook-configuration-name={{ include "k8tz.fullname" . }}"
+          - "--webhook-service-name={{ include "k8tz.serviceName" . }}"
+          - "--webhook-service-port={{ .Values.service.port }}"
+{{- end }}
+
 {{/*
 The default security context fields to be merged with the user defined settings.
 The settings may differ between different versions of Kubernetes.
@@ -0,0 +1,66 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var auditor = audit.NewAuditor()
+
+var auditCmd = &cobra.Command{
+	Use:     "audit [--namespace=<namespace>] [--workers=<n>]",
+	Aliases: []string{"status"},
+	Short:   "List pods in the cluster and whether they have timezone injected",
+	Long: `List pods in the cluster and whether they have timezone injected.
+
+Namespaces are scanned in parallel, use '--workers' to control how many
+namespaces are scanned at the same time. The output is sorted by namespace
+and pod name.
+
+Examples:
+# Audit all the namespaces in the cluster with 8 workers
+k8tz audit --workers=8
+
+# Audit a single namespace as JSON
+k8tz audit -n default -o json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := auditor.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		statuses, err := auditor.Audit(context.Background())
+		if err != nil {
+			return err
+		}
+
+		return auditor.Write(statuses, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringVarP(&auditor.Namespace, "namespace", "n", auditor.Namespace, "Audit only this namespace (default all namespaces)")
+	auditCmd.Flags().IntVarP(&auditor.Workers, "workers", "w", auditor.Workers, "Number of namespaces to scan in parallel")
+	auditCmd.Flags().StringVarP(&auditor.Output, "output", "o", auditor.Output, "Output format (table/json)")
+}
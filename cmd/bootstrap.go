@@ -50,4 +50,6 @@ func init() {
 	bootstrapCmd.Flags().StringVarP(&operation.From, "from", "f", operation.From, "Path to directory where to take the files from")
 	bootstrapCmd.Flags().StringVarP(&operation.To, "to", "t", operation.To, "Path to directory where copy the files to")
 	bootstrapCmd.Flags().BoolVarP(&operation.Overwrite, "overwrite", "o", operation.Overwrite, "If true and file already exists in target directory, it will be overwritten. If false it will be skipped.")
+	bootstrapCmd.Flags().DurationVar(&operation.KeepAlive, "keep-alive", operation.KeepAlive, "If set, keep running after bootstrap and copy the files again in this interval (used by native sidecars)")
+	bootstrapCmd.Flags().BoolVar(&operation.Check, "check", operation.Check, "Only check that all the files from the source directory exist in the target directory")
 }
@@ -0,0 +1,51 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/k8tz/k8tz/pkg/certgen"
+	"github.com/spf13/cobra"
+)
+
+var certGen = certgen.NewCertGen()
+
+var certGenCmd = &cobra.Command{
+	Use:   "certgen",
+	Short: "Provision self-signed certificates for k8tz's webhook",
+	Long: `Provision self-signed certificates for k8tz's webhook.
+
+A self-signed CA and a serving certificate for the webhook service are
+generated and stored in a Kubernetes Secret (tls.crt, tls.key and ca.crt),
+unless the secret already holds a valid certificate. The CA is then set as
+the caBundle of the MutatingWebhookConfiguration. It is meant to run as a
+Job or initContainer on installations without cert-manager.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cobra.CheckErr(certGen.Start(kubeConfigFile))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(certGenCmd)
+
+	certGenCmd.Flags().StringVar(&certGen.SecretName, "secret-name", certGen.SecretName, "Kubernetes secret to store the TLS Certificate, TLS Key and CA in")
+	certGenCmd.Flags().StringVar(&certGen.SecretNamespace, "secret-namespace", certGen.SecretNamespace, "Namespace of the secret and the webhook service")
+	certGenCmd.Flags().StringVar(&certGen.ServiceName, "service-name", certGen.ServiceName, "Name of the webhook service the certificate is issued for")
+	certGenCmd.Flags().StringVar(&certGen.WebhookName, "webhook-name", certGen.WebhookName, "Name of the MutatingWebhookConfiguration to patch the caBundle of")
+	certGenCmd.Flags().DurationVar(&certGen.Validity, "validity", certGen.Validity, "Validity of the generated certificates")
+	certGenCmd.Flags().DurationVar(&certGen.RenewBefore, "renew-before", certGen.RenewBefore, "Regenerate the certificate if it expires within this duration")
+	certGenCmd.Flags().BoolVar(&certGen.Verbose, "verbose", certGen.Verbose, "Print more verbose logs for debugging")
+}
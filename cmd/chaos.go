@@ -0,0 +1,35 @@
+//go:build chaos
+
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/k8tz/k8tz/pkg/admission"
+)
+
+// the failure injection only exists in the binaries built with the chaos tag,
+// the release binaries have neither its settings nor its flags
+func init() {
+	chaos := admission.NewChaos()
+	webhook.Chaos = chaos
+
+	webhookCmd.Flags().Float64Var(&chaos.Rate, "test-only-failure-rate", chaos.Rate, "TEST ONLY: fraction (0-1) of requests to fail on purpose, to test the webhook failurePolicy")
+	webhookCmd.Flags().StringVar((*string)(&chaos.Mode), "test-only-failure-mode", string(chaos.Mode), "TEST ONLY: how injected failures fail (deny/error/slow/malformed/tls)")
+	webhookCmd.Flags().DurationVar(&chaos.Delay, "test-only-failure-delay", chaos.Delay, "TEST ONLY: delay of the responses of the slow failure mode")
+	webhookCmd.Flags().BoolVar(&chaos.Endpoint, "test-only-chaos-endpoint", chaos.Endpoint, "TEST ONLY: serve /chaos on --debug-addr, a POST with the rate, mode and delay query parameters changes the failure injection at runtime")
+}
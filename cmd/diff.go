@@ -0,0 +1,85 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/k8tz/k8tz/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var differ = audit.NewAuditor()
+var diffPolicy = admission.NewRequestsHandler()
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [--namespace=<namespace>] [--output=json]",
+	Short: "Compare the live injection of workloads with the current policy",
+	Long: `Compare the live injection of workloads with the current policy.
+
+For each Deployment, StatefulSet and DaemonSet, the injection that its pods
+should have is computed the same way the admission controller does (using
+the annotations of the pod template and namespace and the policy flags) and
+compared with the injection that its live pods do have.
+
+The command exits with a non-zero code when any workload has drifted, so it
+can be used to gate CI pipelines.
+
+Examples:
+# Compare all the workloads in the cluster with the default policy
+k8tz diff
+
+# Compare the workloads of a namespace as JSON, expecting Europe/Paris
+k8tz diff -n default -t Europe/Paris -o json`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := differ.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		// keep stdout clean for the diff
+		admission.SetInfoOutput(os.Stderr)
+		diffs, err := differ.Diff(context.Background(), &diffPolicy)
+		if err != nil {
+			return err
+		}
+
+		if err := differ.WriteDiff(diffs, os.Stdout); err != nil {
+			return err
+		}
+
+		if drifted := audit.Drifted(diffs); drifted > 0 {
+			return fmt.Errorf("%d workloads drifted from the injection policy", drifted)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVarP(&differ.Namespace, "namespace", "n", differ.Namespace, "Compare only the workloads of this namespace (default all namespaces)")
+	diffCmd.Flags().StringVarP(&differ.Output, "output", "o", differ.Output, "Output format (table/json)")
+	diffCmd.Flags().StringVarP(&diffPolicy.DefaultTimezone, "timezone", "t", diffPolicy.DefaultTimezone, "Default timezone if not specified explicitly")
+	diffCmd.Flags().StringVarP((*string)(&diffPolicy.DefaultInjectionStrategy), "injection-strategy", "s", string(diffPolicy.DefaultInjectionStrategy), "Default injection strategy if not specified explicitly (csi/faketime/hostPath/image/initContainer/sidecar/tzdata/windows)")
+	diffCmd.Flags().BoolVar(&diffPolicy.InjectByDefault, "inject", diffPolicy.InjectByDefault, "Whether injection is enabled by default or should be requested by annotation")
+	diffCmd.Flags().StringVar(&diffPolicy.InstallNamespace, "install-namespace", diffPolicy.InstallNamespace, "Namespace k8tz is installed in, its workloads are expected to be skipped")
+}
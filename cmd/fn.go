@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/spf13/cobra"
+)
+
+var krmFunction = &inject.KRMFunction{PatchGenerator: inject.NewPatchGenerator()}
+
+var fnCmd = &cobra.Command{
+	Use:   "fn",
+	Short: "Run as a KRM function, e.g. a kustomize transformer plugin",
+	Long: `Run as a KRM function, e.g. a kustomize transformer plugin.
+
+A ResourceList is read from standard input, its items are injected and the
+ResourceList is written back to standard output. The settings are read from
+the data of a ConfigMap function config, or from the spec of any other kind
+of function config, and override the flags:
+
+  timezone, strategy, image, imagePullPolicy, timezoneFormat, hostPathPrefix,
+  localTimePath, cronJobTimeZone, cronJobMode, bootstrapSidecar,
+  annotateOffset, objectAnnotations
+
+Examples:
+# kustomization.yaml
+transformers:
+- k8tz.yaml
+
+# k8tz.yaml, k8tz-fn is an executable script that runs 'k8tz fn'
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: k8tz
+  annotations:
+    config.kubernetes.io/function: |
+      exec:
+        path: ./k8tz-fn
+data:
+  timezone: Europe/London
+  strategy: hostPath
+
+# build with exec functions enabled
+kustomize build --enable-alpha-plugins --enable-exec .`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return krmFunction.Run(os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fnCmd)
+
+	generator := &krmFunction.PatchGenerator
+	generator.ObjectAnnotations = true
+	fnCmd.Flags().StringVarP(&generator.Timezone, "timezone", "t", generator.Timezone, "Default timezone if not specified by the function config")
+	fnCmd.Flags().StringVarP(&generator.InitContainerImage, "image", "i", generator.InitContainerImage, "initContainer bootstrap image")
+	fnCmd.Flags().StringVarP((*string)(&generator.Strategy), "strategy", "s", string(generator.Strategy), "Default injection strategy if not specified by the function config (csi/faketime/hostPath/image/initContainer/sidecar/tzdata/windows)")
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var kustomize = admission.NewKustomize()
+
+var kustomizeOutputDir = "."
+
+var generateKustomizeCmd = &cobra.Command{
+	Use:   "generate-kustomize",
+	Short: "Generate a Kustomize base and webhook component of the admission controller",
+	Long: `Generate a Kustomize base and webhook component of the admission controller.
+
+The base (base/) has the namespace, service account, rbac, service and
+deployment of the webhook, which is started with the handler flags given
+to this command. The component (components/webhook/) has the
+MutatingWebhookConfiguration that --register-webhook would register for
+the same flags, annotated with cert-manager.io/inject-ca-from, and the
+cert-manager Certificate of the webhook service whose CA cert-manager
+injects in the caBundle. A kustomization.yaml that includes both is
+written to the output directory, e.g:
+
+  k8tz admission-controller generate-kustomize -o k8tz -t Europe/London
+  kubectl apply -k k8tz`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cobra.CheckErr(kustomize.Write(kustomizeOutputDir))
+	},
+}
+
+// recordedValue records the flags that are set as arguments of the generated
+// webhook deployment
+type recordedValue struct {
+	pflag.Value
+	name string
+	args *[]string
+}
+
+func (v *recordedValue) Set(value string) error {
+	if err := v.Value.Set(value); err != nil {
+		return err
+	}
+
+	*v.args = append(*v.args, "--"+v.name+"="+value)
+	return nil
+}
+
+func init() {
+	webhookCmd.AddCommand(generateKustomizeCmd)
+
+	flags := generateKustomizeCmd.Flags()
+	addHandlerFlags(flags, &kustomize.Server.Handler)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		flag.Value = &recordedValue{Value: flag.Value, name: flag.Name, args: &kustomize.Args}
+	})
+
+	addRegistrationFlags(flags, &kustomize.Server.Registration)
+	flags.StringVarP(&kustomizeOutputDir, "output-dir", "o", kustomizeOutputDir, "Directory the kustomization is written to")
+	flags.StringVar(&kustomize.Image, "image", kustomize.Image, "Image of the webhook deployment")
+	flags.StringVar(&kustomize.Issuer, "cert-manager-issuer", kustomize.Issuer, "cert-manager issuer of the webhook certificate, a self-signed Issuer is generated if empty")
+	flags.StringVar(&kustomize.IssuerKind, "cert-manager-issuer-kind", kustomize.IssuerKind, "Kind of --cert-manager-issuer (Issuer/ClusterIssuer)")
+}
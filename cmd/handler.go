@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/spf13/pflag"
+)
+
+// addHandlerFlags adds the flags of the options of the handler that decide how
+// the admission reviews are handled, they are shared by the webhook and the
+// commands that handle reviews the same way
+func addHandlerFlags(flags *pflag.FlagSet, h *admission.RequestsHandler) {
+	flags.StringVarP(&h.DefaultTimezone, "timezone", "t", h.DefaultTimezone, "Default timezone if not specified explicitly")
+	flags.StringVar(&h.BootstrapImage, "bootstrap-image", h.BootstrapImage, "initContainer bootstrap image")
+	flags.StringVar((*string)(&h.BootstrapImagePullPolicy), "bootstrap-image-pull-policy", string(h.BootstrapImagePullPolicy), "imagePullPolicy of the bootstrap initContainer (Always/IfNotPresent/Never), kubernetes default if empty")
+	flags.StringToStringVar(&h.BootstrapArchImages, "bootstrap-arch-images", h.BootstrapArchImages, "Bootstrap images for pods with the 'kubernetes.io/arch' nodeSelector, e.g. arm64=registry/k8tz:arm64, other pods use --bootstrap-image")
+	flags.Var((*inject.ResourceList)(&h.BootstrapResources.Requests), "bootstrap-requests", "Resource requests of the bootstrap initContainer, e.g. cpu=10m,memory=16Mi")
+	flags.Var((*inject.ResourceList)(&h.BootstrapResources.Limits), "bootstrap-limits", "Resource limits of the bootstrap initContainer, e.g. cpu=100m,memory=32Mi")
+	flags.BoolVar(&h.BootstrapSecurity.RunAsNonRoot, "bootstrap-run-as-non-root", h.BootstrapSecurity.RunAsNonRoot, "Set runAsNonRoot on the securityContext of the bootstrap initContainer, required by the restricted Pod Security Standard")
+	flags.BoolVar(&h.BootstrapSecurity.ReadOnlyRootFilesystem, "bootstrap-read-only-root-filesystem", h.BootstrapSecurity.ReadOnlyRootFilesystem, "Set readOnlyRootFilesystem on the securityContext of the bootstrap initContainer")
+	flags.Var(&h.BootstrapSecurity.SeccompProfile, "bootstrap-seccomp-profile", "Seccomp profile of the bootstrap initContainer (RuntimeDefault/Unconfined/Localhost=<path>), RuntimeDefault if empty")
+	flags.StringSliceVar(&h.BootstrapPullSecrets, "bootstrap-image-pull-secrets", h.BootstrapPullSecrets, "Image pull secrets of the bootstrap image that are added to the injected pods, can be repeated")
+	flags.StringSliceVar(&h.BootstrapRegistries, "bootstrap-registries", h.BootstrapRegistries, "Registries or repository prefixes that the k8tz.io/bootstrap-repository namespace annotation and timezone policies may use for the bootstrap image, any if empty")
+	flags.StringVar(&h.DefaultLocale, "locale", h.DefaultLocale, "Locale injected with the LANG and LC_ALL environment variables if not specified explicitly, e.g. en_US.UTF-8, no locale is injected if empty")
+	flags.StringVar((*string)(&h.TimezoneFormat), "timezone-format", string(h.TimezoneFormat), "Format of the TZ environment variable if not specified explicitly (name/posix)")
+	flags.StringVar(&h.ZoneInfoPath, "zoneinfo-path", h.ZoneInfoPath, "Location of zoneinfo used to derive POSIX TZ rules")
+	flags.Var(&h.ExtraEnv, "extra-env", "Additional environment variable to inject with the given strategy, can be repeated, e.g. initContainer:ZONEINFO=/usr/share/zoneinfo")
+	flags.StringVar(&h.HostPathPrefix, "hostPathPrefix", h.HostPathPrefix, "Location of zoneinfo on host machines")
+	flags.StringVar((*string)(&h.HostPathType), "hostpath-type", string(h.HostPathType), "Type of the hostPath volume (Directory or empty), Directory makes the kubelet check that the zoneinfo directory exists instead of creating an empty one")
+	flags.StringSliceVar(&h.HostPathRoots, "hostpath-roots", h.HostPathRoots, "Directories of the nodes that the k8tz.io/hostpath annotation can mount in addition to --hostPathPrefix, e.g. /opt/zoneinfo")
+	flags.StringVar(&h.HostPathNodeLabel, "hostpath-node-label", h.HostPathNodeLabel, "Use the hostPath strategy only for pods pinned to nodes with the label (key or key=value, e.g. k8tz.io/tzdata=true), other pods get initContainer, requires get, list and watch access to nodes")
+	flags.StringVar(&h.CSIDriver, "csi-driver", h.CSIDriver, "Driver of the CSI ephemeral inline volume of the csi strategy, the driver must provide the TZif files")
+	flags.StringToStringVar(&h.CSIVolumeAttributes, "csi-volume-attributes", h.CSIVolumeAttributes, "Volume attributes passed to the CSI driver of the csi strategy, e.g. image=quay.io/k8tz/tzdata")
+	flags.StringVar(&h.CSIZoneInfoPath, "csi-zoneinfo-path", h.CSIZoneInfoPath, "Zoneinfo directory inside the CSI volume of the csi strategy, relative to its root, the root of the volume if empty")
+	flags.StringVar(&h.FaketimeLibrary, "faketime-library", h.FaketimeLibrary, "Path of libfaketime in the images of the containers of the faketime strategy (experimental)")
+	flags.StringVar(&h.LocalTimePath, "localTimePath", h.LocalTimePath, "Mount path for TZif file on containers")
+	flags.StringVarP((*string)(&h.DefaultInjectionStrategy), "injection-strategy", "s", string(h.DefaultInjectionStrategy), "Default injection strategy if not specified explicitly (csi/faketime/hostPath/image/initContainer/sidecar/tzdata/windows)")
+	flags.StringVar((*string)(&h.HostNamespacesStrategy), "host-namespaces-strategy", string(h.HostNamespacesStrategy), "Injection strategy for pods with hostNetwork, hostPID or hostIPC (csi/hostPath/image/initContainer/sidecar/tzdata/windows), empty to keep the selected strategy")
+	flags.StringVar((*string)(&h.PodSecurityLevel), "pod-security-level", string(h.PodSecurityLevel), "Pod Security Standards level (baseline/restricted) to check injections against when the namespace has no 'pod-security.kubernetes.io/enforce' label")
+	flags.StringVar((*string)(&h.PodSecurityAction), "pod-security-check", string(h.PodSecurityAction), "What to do when the injection would violate the Pod Security Standards level (ignore/adjust/deny)")
+	flags.BoolVar(&h.Reinvocation, "reinvocation", h.Reinvocation, "Inject the containers that other mutating webhooks add to injected pods, for webhooks with reinvocationPolicy IfNeeded")
+	flags.StringVar((*string)(&h.ConflictPolicy), "conflict-policy", string(h.ConflictPolicy), "What to do with pods that already have a TZ variable, a k8tz volume or a k8tz initContainer (skip/merge/replace)")
+	flags.StringVar(&h.InstallNamespace, "install-namespace", h.InstallNamespace, "Namespace k8tz is installed in, detected from POD_NAMESPACE or the service account when running in a pod")
+	flags.BoolVar(&h.ExcludeInstallNamespace, "exclude-install-namespace", h.ExcludeInstallNamespace, "Skip injection of objects in the k8tz install namespace")
+	flags.StringSliceVar(&h.ExcludedNamespaces, "exclude-namespaces", h.ExcludedNamespaces, "Skip injection of objects in these namespaces, names or glob patterns (e.g. team-*)")
+	flags.StringVar(&h.NamespaceSelector, "namespace-selector", h.NamespaceSelector, "Only inject objects of namespaces whose labels match this label selector, e.g. 'env in (dev,prod),!legacy'")
+	flags.StringVar(&h.ObjectSelector, "object-selector", h.ObjectSelector, "Only inject objects whose labels match this label selector")
+	flags.StringVar(&h.ExcludeNames, "exclude-names", h.ExcludeNames, "Skip injection of objects whose name (or generateName) matches this regular expression")
+	flags.BoolVar(&h.NamespaceCache, "namespace-cache", h.NamespaceCache, "Watch namespaces and read their annotations from memory instead of fetching the namespace on every request (requires list and watch permissions on namespaces)")
+	flags.BoolVar(&h.CronJobOwners, "resolve-cronjob-owners", h.CronJobOwners, "Inject the jobs of CronJobs that were admitted before k8tz was installed with the k8tz.io/timezone annotation of the CronJob, the Jobs and CronJobs are watched (requires list and watch permissions on jobs and cronjobs)")
+	flags.BoolVar(&h.InjectByDefault, "inject", h.InjectByDefault, "Whether injection is enabled by default or should be requested by annotation")
+	flags.BoolVar(&h.CronJobTimeZone, "cronJobTimeZone", h.CronJobTimeZone, "Enable CronJob injection. Requires kubernetes >=1.24.0-beta.0 and the 'CronJobTimeZone' feature gate enabled (alpha)")
+	flags.StringVar((*string)(&h.CronJobMode), "cronjob-mode", string(h.CronJobMode), "How CronJobs are injected when --cronJobTimeZone is enabled (auto/native/template), auto sets spec.timeZone on kubernetes >=1.27.0 and injects the pod template of the job template on older clusters")
+	flags.BoolVar(&h.RewriteCronJobSchedules, "cronjob-schedule-rewrite", h.RewriteCronJobSchedules, "Rewrite the schedule of CronJobs injected in the template mode from their timezone to UTC with the offset at admission time, for clusters without spec.timeZone (the schedule drifts after daylight saving time changes)")
+	flags.BoolVar(&h.InjectWorkloads, "inject-workloads", h.InjectWorkloads, "Inject the pod template of Deployments, StatefulSets, DaemonSets, ReplicaSets and Jobs instead of their pods")
+	flags.StringVar(&h.TzdataVersion, "tzdata-version", h.TzdataVersion, "tz database version of the bootstrap image recorded on injected pods (k8tz.io/tzdata-version), detected from --zoneinfo-path if empty")
+	flags.IntVar(&h.TemplatePathMaxDepth, "template-path-max-depth", h.TemplatePathMaxDepth, "Maximum number of fields of a --template-path, set it before the --template-path flags")
+	flags.Var(admission.TemplatePathsFlag{Paths: &h.TemplatePaths, MaxDepth: &h.TemplatePathMaxDepth}, "template-path", "Location of a pod template in a resource without built-in support, can be repeated, e.g. myjobs.example.com=spec.template")
+	flags.BoolVar(&h.AnnotateOffset, "annotate-offset", h.AnnotateOffset, "Annotate injected objects with the UTC offset and abbreviation of the timezone at injection time (snapshot, not updated on DST changes)")
+	flags.StringVar(&h.TimezonePolicyFile, "timezone-policy", h.TimezonePolicyFile, "YAML file with allow/deny lists of timezone patterns, the webhook reloads it on SIGHUP and when its content changes")
+	flags.StringVar((*string)(&h.MissingTimezoneAction), "missing-timezone", string(h.MissingTimezoneAction), "What to do when no default timezone is configured and an object has no timezone annotation (fallback/skip/deny)")
+	flags.StringVar(&h.FallbackTimezone, "fallback-timezone", h.FallbackTimezone, "Timezone injected by the fallback missing timezone action")
+	flags.BoolVar(&h.AutoTimezone, "auto-timezone", h.AutoTimezone, "Resolve the 'auto' timezone annotation from the region label of the node or the region nodeSelector/affinity of the pod, requires get, list and watch access to nodes")
+	flags.StringToStringVar(&h.RegionTimezones, "region-timezones", h.RegionTimezones, "Timezones of regions that are missing from or override the built-in AWS/GCP/Azure table, e.g. on-prem-east=America/New_York")
+	flags.BoolVar(&h.DryRun, "dry-run", h.DryRun, "Evaluate every admission review and log the patches that would be applied, without mutating or rejecting any object")
+	flags.BoolVar(&h.DebugAnnotation, "debug-annotation", h.DebugAnnotation, "Log the handling of the admission reviews of objects annotated with k8tz.io/debug=true (decoded object, generator and patches) regardless of --verbose")
+	flags.BoolVar(&h.AllowOnError, "allow-on-error", h.AllowOnError, "Allow objects without injection when k8tz fails to handle them, can be overridden per object with the k8tz.io/failOpen annotation, --on-error takes precedence")
+	flags.StringVar((*string)(&h.OnError), "on-error", string(h.OnError), "How admission reviews that k8tz fails to decode or handle are answered (allow/deny), if empty --allow-on-error applies and undecodable reviews fail with an HTTP error so the failurePolicy of the webhook applies")
+	flags.Var(&h.OnErrorResources, "on-error-resource", "Override --on-error for a resource, can be repeated, e.g. pods=allow or cronjobs.batch=deny")
+	flags.BoolVar(&h.BootstrapSidecar, "bootstrap-sidecar", h.BootstrapSidecar, "Inject the bootstrap initContainer as a native sidecar when the cluster supports it (kubernetes >=1.29.0), otherwise fallback to a plain initContainer")
+}
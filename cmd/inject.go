@@ -17,16 +17,21 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 
+	"github.com/k8tz/k8tz/pkg/audit"
 	"github.com/k8tz/k8tz/pkg/inject"
 	"github.com/k8tz/k8tz/pkg/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var patchGenerator = inject.NewPatchGenerator()
+var injectSource = audit.NewAuditor()
 
 var injectCmd = &cobra.Command{
 	Use:     "inject <input [...]>",
@@ -34,7 +39,9 @@ var injectCmd = &cobra.Command{
 	Short:   "Inject timezone to yaml kubernetes resources",
 	Long: `Inject timezone to yaml kubernetes resources and print mutated resources back to standard output. 
 
-Input may be '-' for stdin, path to file or http/https url.
+Input may be '-' for stdin, path to file, path to directory of .yaml/.yml/.json
+files, http/https url or a <kind>/<name> reference of an object in the cluster
+(e.g. deployment/foo). Inputs may contain multiple documents and Lists.
 
 Examples:
 # Inject Europe/Amsterdam timezone to all the deployments in the current namespace
@@ -43,16 +50,25 @@ kubectl get deploy | k8tz inject --timezone=Europe/Amsterdam - | kubectl apply -
 # Create pod with UTC timezone with hostPath strategy from a yaml file
 k8tz i -tUTC --strategy=hostPath examples/test-pod.yaml | kubectl create -f -
 
+# Inject a deployment of the cluster, e.g. as a kubectl plugin
+kubectl k8tz inject -n default deployment/foo | kubectl apply -f -
+
+# Bake the timezone into all the manifests of a directory, e.g. in a GitOps pipeline
+k8tz inject -tEurope/London manifests/ > manifests-injected.yaml
+
 # Create pod with New York timezone from URL with custom private registry
 k8tz inject --image=registry.example.com/myrepo/k8tz:` + version.Version() + ` -tAmerica/New_York https://github.com/k8tz/k8tz/.../examples/test-pod.yaml | kubectl apply -f -
 
-Injection is applicable on Pods, Deployments and Lists that contains them.`,
+Injection is applicable on Pods, Deployments, StatefulSets, DaemonSets, ReplicaSets,
+Jobs, CronJobs and Lists that contain them, other objects are written as-is. The
+k8tz.io annotations of the objects are applied like the admission webhook does,
+objects that are already injected or have 'k8tz.io/inject: "false"' are not changed.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			return errors.New("you must specify at least one input")
 		}
 
-		inputs, err := inject.ArgumentsToInputs(args)
+		inputs, err := injectInputs(args)
 		if err != nil {
 			return fmt.Errorf("failed to open inputs from arguments: %w", err)
 		}
@@ -67,13 +83,88 @@ Injection is applicable on Pods, Deployments and Lists that contains them.`,
 	},
 }
 
+// injectInputs returns the inputs of the arguments, object references are
+// fetched from the cluster
+func injectInputs(args []string) (inject.Inputs, error) {
+	inputs := inject.Inputs{}
+	connected := false
+	for i, arg := range args {
+		kind, name, ok := audit.ParseReference(arg)
+		if !ok {
+			argInputs, err := inject.ArgumentsToInputs([]string{arg})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, input := range argInputs {
+				input.ArgNumber = i
+				inputs = append(inputs, input)
+			}
+			continue
+		}
+
+		if !connected {
+			if err := injectSource.InitializeClientset(kubeConfigFile); err != nil {
+				return nil, fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+			}
+			connected = true
+		}
+
+		manifest, err := injectSource.Manifest(context.Background(), kind, name)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, inject.Input{
+			ArgNumber:  i,
+			Identifier: arg,
+			Reader:     bytes.NewReader(manifest),
+		})
+	}
+
+	return inputs, nil
+}
+
 func init() {
 	rootCmd.AddCommand(injectCmd)
 
-	injectCmd.Flags().StringVarP(&patchGenerator.Timezone, "timezone", "t", patchGenerator.Timezone, "Default timezone if not specified explicitly")
-	injectCmd.Flags().StringVarP(&patchGenerator.InitContainerImage, "image", "i", patchGenerator.InitContainerImage, "initContainer bootstrap image")
-	injectCmd.Flags().StringVarP((*string)(&patchGenerator.Strategy), "strategy", "s", string(patchGenerator.Strategy), "Default injection strategy if not specified explicitly (hostPath/initContainer)")
-	injectCmd.Flags().StringVar(&patchGenerator.HostPathPrefix, "hostpath", patchGenerator.HostPathPrefix, "Location of TZif files on host machines")
-	injectCmd.Flags().StringVarP(&patchGenerator.LocalTimePath, "mountpath", "m", patchGenerator.LocalTimePath, "Mount path for TZif file on containers")
-	injectCmd.Flags().BoolVar(&patchGenerator.CronJobTimeZone, "cronJobTimeZone", patchGenerator.CronJobTimeZone, "Enable CronJob injection. Requires kubernetes >=1.24.0-beta.0 and the 'CronJobTimeZone' feature gate enabled (alpha)")
+	injectCmd.Flags().StringVarP(&injectSource.Namespace, "namespace", "n", injectSource.Namespace, "Namespace of the <kind>/<name> references (default the namespace of the kubeconfig context)")
+
+	addPatchGeneratorFlags(injectCmd.Flags(), &patchGenerator)
+}
+
+// addPatchGeneratorFlags adds the flags of the generator options that are
+// shared by the commands that inject manifests
+func addPatchGeneratorFlags(flags *pflag.FlagSet, g *inject.PatchGenerator) {
+	flags.BoolVar(&g.ObjectAnnotations, "object-annotations", true, "Apply the k8tz.io annotations of the objects (inject, timezone, strategy, timezone-format, container-timezones) like the admission webhook does")
+	flags.StringVarP(&g.Timezone, "timezone", "t", g.Timezone, "Default timezone if not specified explicitly")
+	flags.StringVarP(&g.InitContainerImage, "image", "i", g.InitContainerImage, "initContainer bootstrap image")
+	flags.StringVar((*string)(&g.InitContainerImagePullPolicy), "image-pull-policy", string(g.InitContainerImagePullPolicy), "imagePullPolicy of the bootstrap initContainer (Always/IfNotPresent/Never), kubernetes default if empty")
+	flags.StringToStringVar(&g.InitContainerArchImages, "arch-images", g.InitContainerArchImages, "Bootstrap images for pods with the 'kubernetes.io/arch' nodeSelector, e.g. arm64=registry/k8tz:arm64, other pods use --image")
+	flags.Var((*inject.ResourceList)(&g.InitContainerResources.Requests), "bootstrap-requests", "Resource requests of the bootstrap initContainer, e.g. cpu=10m,memory=16Mi")
+	flags.Var((*inject.ResourceList)(&g.InitContainerResources.Limits), "bootstrap-limits", "Resource limits of the bootstrap initContainer, e.g. cpu=100m,memory=32Mi")
+	flags.BoolVar(&g.InitContainerSecurityContext.RunAsNonRoot, "bootstrap-run-as-non-root", g.InitContainerSecurityContext.RunAsNonRoot, "Set runAsNonRoot on the securityContext of the bootstrap initContainer, required by the restricted Pod Security Standard")
+	flags.BoolVar(&g.InitContainerSecurityContext.ReadOnlyRootFilesystem, "bootstrap-read-only-root-filesystem", g.InitContainerSecurityContext.ReadOnlyRootFilesystem, "Set readOnlyRootFilesystem on the securityContext of the bootstrap initContainer")
+	flags.Var(&g.InitContainerSecurityContext.SeccompProfile, "bootstrap-seccomp-profile", "Seccomp profile of the bootstrap initContainer (RuntimeDefault/Unconfined/Localhost=<path>), RuntimeDefault if empty")
+	flags.StringSliceVar(&g.InitContainerImagePullSecrets, "bootstrap-image-pull-secrets", g.InitContainerImagePullSecrets, "Image pull secrets of the bootstrap image that are added to the injected pods, can be repeated")
+	flags.StringVarP((*string)(&g.Strategy), "strategy", "s", string(g.Strategy), "Default injection strategy if not specified explicitly (csi/faketime/hostPath/image/initContainer/sidecar/tzdata/windows)")
+	flags.StringVar(&g.Locale, "locale", g.Locale, "Locale injected with the LANG and LC_ALL environment variables if not specified explicitly, e.g. en_US.UTF-8, no locale is injected if empty")
+	flags.StringVar((*string)(&g.TimezoneFormat), "timezone-format", string(g.TimezoneFormat), "Format of the TZ environment variable if not specified explicitly (name/posix)")
+	flags.StringVar(&g.ZoneInfoPath, "zoneinfo-path", g.ZoneInfoPath, "Location of zoneinfo used to derive POSIX TZ rules")
+	flags.Var(&g.ExtraEnv, "extra-env", "Additional environment variable to inject with the given strategy, can be repeated, e.g. initContainer:ZONEINFO=/usr/share/zoneinfo")
+	flags.StringVar(&g.HostPathPrefix, "hostpath", g.HostPathPrefix, "Location of TZif files on host machines")
+	flags.StringVar((*string)(&g.HostPathType), "hostpath-type", string(g.HostPathType), "Type of the hostPath volume (Directory or empty), Directory makes the kubelet check that the zoneinfo directory exists instead of creating an empty one")
+	flags.StringVar(&g.CSIDriver, "csi-driver", g.CSIDriver, "Driver of the CSI ephemeral inline volume of the csi strategy, the driver must provide the TZif files")
+	flags.StringToStringVar(&g.CSIVolumeAttributes, "csi-volume-attributes", g.CSIVolumeAttributes, "Volume attributes passed to the CSI driver of the csi strategy, e.g. image=quay.io/k8tz/tzdata")
+	flags.StringVar(&g.CSIZoneInfoPath, "csi-zoneinfo-path", g.CSIZoneInfoPath, "Zoneinfo directory inside the CSI volume of the csi strategy, relative to its root, the root of the volume if empty")
+	flags.StringVar(&g.FaketimeLibrary, "faketime-library", g.FaketimeLibrary, "Path of libfaketime in the images of the containers of the faketime strategy (experimental)")
+	flags.StringVarP(&g.LocalTimePath, "mountpath", "m", g.LocalTimePath, "Mount path for TZif file on containers")
+	flags.StringVar((*string)(&g.PodSecurityLevel), "pod-security-level", string(g.PodSecurityLevel), "Pod Security Standards level (baseline/restricted) to check injections against")
+	flags.StringVar((*string)(&g.PodSecurityAction), "pod-security-check", string(g.PodSecurityAction), "What to do when the injection would violate the Pod Security Standards level (ignore/adjust/deny)")
+	flags.StringVar((*string)(&g.ConflictPolicy), "conflict-policy", string(g.ConflictPolicy), "What to do with pods that already have a TZ variable, a k8tz volume or a k8tz initContainer (skip/merge/replace)")
+	flags.BoolVar(&g.AnnotateOffset, "annotate-offset", g.AnnotateOffset, "Annotate injected objects with the UTC offset and abbreviation of the timezone at injection time (snapshot, not updated on DST changes)")
+	flags.BoolVar(&g.BootstrapSidecar, "bootstrap-sidecar", g.BootstrapSidecar, "Inject the bootstrap initContainer as a native sidecar (restartPolicy: Always). Requires kubernetes >=1.29.0 or the 'SidecarContainers' feature gate enabled")
+	flags.BoolVar(&g.CronJobTimeZone, "cronJobTimeZone", g.CronJobTimeZone, "Enable CronJob injection. Requires kubernetes >=1.24.0-beta.0 and the 'CronJobTimeZone' feature gate enabled (alpha)")
+	flags.StringVar((*string)(&g.CronJobMode), "cronjob-mode", string(g.CronJobMode), "How CronJobs are injected when --cronJobTimeZone is enabled (native/template), native sets spec.timeZone (kubernetes >=1.27.0) and template injects the pod template of the job template")
+	flags.BoolVar(&g.RewriteSchedule, "cronjob-schedule-rewrite", g.RewriteSchedule, "Rewrite the schedule of CronJobs injected in the template mode from their timezone to UTC with the current offset (the schedule drifts after daylight saving time changes)")
 }
@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/k8tz/k8tz/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var migrator = audit.NewAuditor()
+var migration = audit.NewMigrator()
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate --from=<strategy> --to=<strategy> [--namespace=<namespace>] [--dry-run]",
+	Short: "Move the injected pods of workloads from one injection strategy to another",
+	Long: `Move the injected pods of workloads from one injection strategy to another.
+
+Deployments, StatefulSets and DaemonSets whose live pods were injected by the
+admission controller with the '--from' strategy get the k8tz.io/strategy
+annotation of the '--to' strategy on their pod template, via server-side apply
+(field manager 'k8tz-migrate'). The change rolls out their pods, which the
+admission controller injects again with the new strategy.
+
+Namespaces are migrated one at a time, in batches of up to '--batch-size'
+workloads with a pause of '--batch-interval' between the batches, so not all
+the workloads of the cluster are rolled out at once. Workloads whose pod
+template was injected ahead of time (k8tz inject) are skipped, since their
+manifests must be injected again. Pods of the sidecar strategy cannot be told
+apart from pods of the initContainer strategy.
+
+The command exits with a non-zero code when any workload failed to migrate.
+
+Examples:
+# List the workloads that would move from hostPath to initContainer
+k8tz migrate --from=hostPath --to=initContainer --dry-run
+
+# Move a namespace to the native sidecar strategy, 5 workloads every minute
+k8tz migrate -n default --from=initContainer --to=sidecar --batch-size=5 --batch-interval=1m`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := migrator.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		// the workloads that were migrated before an interrupt are printed too
+		migrations, err := migrator.Migrate(ctx, &migration)
+		if migrations != nil {
+			if err := migrator.WriteMigrate(migrations, os.Stdout); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if failed := audit.Failed(migrations); failed > 0 {
+			return fmt.Errorf("%d workloads failed to migrate", failed)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().StringVarP(&migrator.Namespace, "namespace", "n", migrator.Namespace, "Migrate only the workloads of this namespace (default all namespaces)")
+	migrateCmd.Flags().StringVarP(&migrator.Output, "output", "o", migrator.Output, "Output format (table/json)")
+	migrateCmd.Flags().StringVar((*string)(&migration.From), "from", string(migration.From), "Injection strategy of the pods to migrate (csi/hostPath/image/initContainer/sidecar/tzdata/windows)")
+	migrateCmd.Flags().StringVar((*string)(&migration.To), "to", string(migration.To), "Injection strategy to migrate the pods to (csi/hostPath/image/initContainer/sidecar/tzdata/windows)")
+	migrateCmd.Flags().BoolVar(&migration.DryRun, "dry-run", migration.DryRun, "List the workloads that would be migrated without changing them")
+	migrateCmd.Flags().IntVar(&migration.BatchSize, "batch-size", migration.BatchSize, "Workloads of a namespace that are migrated together, the whole namespace if not positive")
+	migrateCmd.Flags().DurationVar(&migration.BatchInterval, "batch-interval", migration.BatchInterval, "Pause between two batches of migrated workloads")
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/spf13/cobra"
+)
+
+var mutateHandler = admission.NewRequestsHandler()
+var mutateOnce = false
+
+var mutateCmd = &cobra.Command{
+	Use:   "mutate [--once]",
+	Short: "Handle AdmissionReview objects from standard input",
+	Long: `Handle AdmissionReview objects from standard input and print the
+response AdmissionReview objects to standard output.
+
+The reviews are handled exactly like the admission controller webhook
+does, including the lookup of namespace annotations, so a connection
+to the kubernetes api is required.
+
+Examples:
+# Handle a single review and exit
+cat review.json | k8tz mutate --once
+
+# Handle a stream of reviews until end of input
+k8tz mutate -tEurope/Paris < reviews.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := mutateHandler.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		if mutateHandler.TimezonePolicyFile != "" {
+			policy, err := admission.LoadTimezonePolicy(mutateHandler.TimezonePolicyFile)
+			if err != nil {
+				return err
+			}
+			admission.SetTimezonePolicy(policy)
+		}
+
+		// keep stdout clean for the responses
+		admission.SetInfoOutput(os.Stderr)
+		return mutateHandler.MutateStream(os.Stdin, os.Stdout, mutateOnce)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mutateCmd)
+
+	mutateCmd.Flags().BoolVar(&mutateOnce, "once", mutateOnce, "Handle a single AdmissionReview and exit")
+	addHandlerFlags(mutateCmd.Flags(), &mutateHandler)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/spf13/cobra"
+)
+
+var postRenderGenerator = inject.NewPatchGenerator()
+
+var postRenderCmd = &cobra.Command{
+	Use:   "post-render",
+	Short: "Run as a helm post-renderer",
+	Long: `Run as a helm post-renderer.
+
+The rendered manifests of a chart are read from standard input, injected and
+written back to standard output, so the timezone is applied at install time
+without the admission webhook. The k8tz.io annotations of the rendered objects
+are applied like the admission webhook does, objects that cannot be injected
+are written as-is.
+
+Examples:
+# Install a chart with the Europe/London timezone (helm >=3.10.0)
+helm install my-release my-chart --post-renderer k8tz --post-renderer-args post-render --post-renderer-args --timezone=Europe/London
+
+# Older helm versions accept an executable without arguments, e.g. a script
+#!/bin/sh
+exec k8tz post-render --timezone=Europe/London --strategy=hostPath`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		transformer := &inject.Transformer{
+			PatchGenerator: postRenderGenerator,
+			Inputs:         inject.Inputs{{Identifier: "-", Reader: os.Stdin}},
+			Output:         os.Stdout,
+		}
+
+		return transformer.Transform()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(postRenderCmd)
+
+	addPatchGeneratorFlags(postRenderCmd.Flags(), &postRenderGenerator)
+}
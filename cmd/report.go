@@ -0,0 +1,72 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var reporter = audit.NewAuditor()
+
+var reportCmd = &cobra.Command{
+	Use:   "report [--namespace=<namespace>] [--output=table|json|csv]",
+	Short: "Report the timezones of the pods and namespaces in the cluster",
+	Long: `Report the timezones of the pods and namespaces in the cluster.
+
+Every namespace is summarized with the number of injected, uninjected and
+stale pods and the timezones of its injected pods, followed by the list of
+pods. Pods are stale when they were injected with an older tz database than
+the current one (k8tz.io/tzdata-version annotation), which is detected from
+'--zoneinfo-path' unless '--tzdata-version' is set.
+
+The table output includes both the namespaces and the pods, the CSV output
+lists the pods and the JSON output includes both.
+
+Examples:
+# Report all the namespaces in the cluster
+k8tz report
+
+# Export the pods of a namespace as CSV
+k8tz report -n default -o csv > pods.csv`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := reporter.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		report, err := reporter.Report(context.Background())
+		if err != nil {
+			return err
+		}
+
+		return report.Write(reporter.Output, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	reportCmd.Flags().StringVarP(&reporter.Namespace, "namespace", "n", reporter.Namespace, "Report only the pods of this namespace (default all namespaces)")
+	reportCmd.Flags().StringVarP(&reporter.Output, "output", "o", reporter.Output, "Output format (table/json/csv)")
+	reportCmd.Flags().StringVar(&reporter.ZoneInfoPath, "zoneinfo-path", reporter.ZoneInfoPath, "Location of zoneinfo used to detect the current tz database version")
+	reportCmd.Flags().StringVar(&reporter.TzdataVersion, "tzdata-version", reporter.TzdataVersion, "Current tz database version, detected from --zoneinfo-path if empty")
+}
@@ -18,10 +18,16 @@ package cmd
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
+// pluginBinaryName is the name of the binary when it is installed as a
+// kubectl plugin, kubectl runs it for 'kubectl k8tz'
+const pluginBinaryName = "kubectl-k8tz"
+
 var kubeConfigFile = ""
 
 var rootCmd = &cobra.Command{
@@ -41,11 +47,28 @@ For more information: https://k8tz.io`,
 }
 
 func Execute() {
+	if isPlugin(os.Args[0]) {
+		usePluginUsage()
+	}
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// isPlugin returns true if the binary runs as a kubectl plugin
+func isPlugin(binary string) bool {
+	name := strings.TrimSuffix(filepath.Base(binary), ".exe")
+	return name == pluginBinaryName
+}
+
+// usePluginUsage prints the commands in the usage and help of all the
+// commands as they are invoked through kubectl
+func usePluginUsage() {
+	replacer := strings.NewReplacer("{{.UseLine}}", "kubectl {{.UseLine}}", "{{.CommandPath}}", "kubectl {{.CommandPath}}")
+	rootCmd.SetUsageTemplate(replacer.Replace(rootCmd.UsageTemplate()))
+}
+
 func init() {
 	cobra.OnInitialize()
 
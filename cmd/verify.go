@@ -0,0 +1,77 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/audit"
+	"github.com/spf13/cobra"
+)
+
+var verifier = audit.NewAuditor()
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [--namespace=<namespace>] [--output=json]",
+	Short: "Check that injected pods have the TZ of their timezone annotations",
+	Long: `Check that injected pods have the TZ of their timezone annotations.
+
+For each pod with the k8tz.io/injected annotation, the TZ environment variable
+of every container is compared with the timezone of the k8tz.io/timezone and
+k8tz.io/container-timezones annotations of the pod. Containers whose TZ was
+changed after the injection, or that were added without it, are listed.
+
+The command exits with a non-zero code when any container mismatches.
+
+Examples:
+# Verify all the injected pods in the cluster
+k8tz verify
+
+# Verify the pods of a namespace as a kubectl plugin
+kubectl k8tz verify -n default`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := verifier.InitializeClientset(kubeConfigFile); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		mismatches, err := verifier.Verify(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if err := verifier.WriteVerify(mismatches, os.Stdout); err != nil {
+			return err
+		}
+
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%d containers do not match their timezone annotations", len(mismatches))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVarP(&verifier.Namespace, "namespace", "n", verifier.Namespace, "Verify only the pods of this namespace (default all namespaces)")
+	verifyCmd.Flags().StringVarP(&verifier.Output, "output", "o", verifier.Output, "Output format (table/json)")
+	verifyCmd.Flags().StringVar(&verifier.ZoneInfoPath, "zoneinfo-path", verifier.ZoneInfoPath, "Location of zoneinfo used to match TZ values in the POSIX format")
+}
@@ -17,19 +17,22 @@ limitations under the License.
 package cmd
 
 import (
+	"sort"
 	"strings"
 
 	"github.com/k8tz/k8tz/pkg/admission"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	cliflag "k8s.io/component-base/cli/flag"
 )
 
 var webhook = admission.NewAdmissionServer()
 
 var webhookCmd = &cobra.Command{
-	Use:    "webhook",
-	Hidden: true,
-	Short:  "Starts Kubernetes Mutating Admission Webhook Server",
+	Use:     "webhook",
+	Aliases: []string{"admission-controller"},
+	Hidden:  true,
+	Short:   "Starts Kubernetes Mutating Admission Webhook Server",
 	Long: `Starts k8tz's Kubernetes mutating admission controller webhook server.
 
 The webhook will listen to requests from Kubernetes and reply
@@ -43,17 +46,57 @@ webhook.k8tz.svc.
 
 Injection defaults can be controlled via flags such as '-t'
 to change the default timezone; or '-s' to change the injection
-strategy.`,
+strategy. The defaults can also be read from a '--config' file,
+e.g. a mounted ConfigMap, that is reloaded when it changes. Flags
+that are set explicitly override the values of the file.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		webhook.Handler.ConfigOverrides = configOverrides(cmd.Flags())
 		cobra.CheckErr(webhook.Start(kubeConfigFile))
 	},
 }
 
+// configFlags maps the flags of the handler defaults to the keys of the
+// webhook config they override
+var configFlags = map[string]string{
+	"timezone":           admission.ConfigTimezone,
+	"injection-strategy": admission.ConfigInjectionStrategy,
+	"bootstrap-image":    admission.ConfigBootstrapImage,
+	"exclude-namespaces": admission.ConfigExcludedNamespaces,
+}
+
+// configOverrides returns the keys of the webhook config whose flags are set
+// explicitly
+func configOverrides(flags *pflag.FlagSet) []string {
+	overrides := []string{}
+	for flag, key := range configFlags {
+		if flags.Changed(flag) {
+			overrides = append(overrides, key)
+		}
+	}
+
+	sort.Strings(overrides)
+	return overrides
+}
+
+// addRegistrationFlags adds the flags of the MutatingWebhookConfiguration that
+// the webhook registers and generate-kustomize generates
+func addRegistrationFlags(flags *pflag.FlagSet, r *admission.Registration) {
+	flags.StringVar(&r.Name, "webhook-configuration-name", r.Name, "Name of the MutatingWebhookConfiguration")
+	flags.StringVar(&r.ServiceName, "webhook-service-name", r.ServiceName, "Service of the webhook in --install-namespace that the configuration calls")
+	flags.Int32Var(&r.ServicePort, "webhook-service-port", r.ServicePort, "Port of the service of the webhook")
+	flags.StringVar((*string)(&r.FailurePolicy), "webhook-failure-policy", string(r.FailurePolicy), "failurePolicy of the configuration (Fail/Ignore)")
+	flags.Int32Var(&r.TimeoutSeconds, "webhook-timeout-seconds", r.TimeoutSeconds, "timeoutSeconds of the configuration, 1 to 30 seconds (0 for the api server default)")
+	flags.BoolVar(&r.EphemeralContainers, "webhook-ephemeral-containers", r.EphemeralContainers, "Configure the webhook for the ephemeral containers of 'kubectl debug'")
+}
+
 func init() {
 	rootCmd.AddCommand(webhookCmd)
 
 	webhookCmd.Flags().StringVar(&webhook.TLSCertFile, "tls-crt", webhook.TLSCertFile, "TLS Certificate file")
 	webhookCmd.Flags().StringVar(&webhook.TLSKeyFile, "tls-key", webhook.TLSKeyFile, "TLS Key file")
+	webhookCmd.Flags().StringVar(&webhook.ClientCAFile, "client-ca-file", webhook.ClientCAFile, "Require client certificates signed by the CAs of this file (e.g. of the kube-apiserver), disabled if empty. HTTPS probes need a client certificate too, use --health-addr for plaintext probes")
+	webhookCmd.Flags().DurationVar(&webhook.TLSReloadInterval, "tls-reload-interval", webhook.TLSReloadInterval, "How often the TLS certificate files are checked for rotation (0 to disable)")
+	webhookCmd.Flags().DurationVar(&webhook.TLSReloadJitter, "tls-reload-jitter", webhook.TLSReloadJitter, "Maximum random duration added to each wait of --tls-reload-interval, so the replicas do not check the certificate files at the same time (0 to disable)")
 	tlsCipherPreferredValues := cliflag.PreferredTLSCipherNames()
 	tlsCipherInsecureValues := cliflag.InsecureTLSCipherNames()
 	webhookCmd.Flags().StringSliceVar(&webhook.TLSCipherSuites, "tls-cipher-suites", webhook.TLSCipherSuites,
@@ -63,15 +106,59 @@ func init() {
 			"Insecure values: "+strings.Join(tlsCipherInsecureValues, ", ")+".")
 	tlsPossibleVersions := cliflag.TLSPossibleVersions()
 	webhookCmd.Flags().StringVar(&webhook.TLSMinVersion, "tls-min-version", webhook.TLSMinVersion,
-		"Minimum TLS version supported. "+
+		"Minimum TLS version supported, TLS 1.2 by default. "+
 			"Possible values: "+strings.Join(tlsPossibleVersions, ", "))
-	webhookCmd.Flags().StringVar(&webhook.Address, "addr", webhook.Address, "Webhook bind address")
-	webhookCmd.Flags().StringVarP(&webhook.Handler.DefaultTimezone, "timezone", "t", webhook.Handler.DefaultTimezone, "Default timezone if not specified explicitly")
-	webhookCmd.Flags().StringVar(&webhook.Handler.BootstrapImage, "bootstrap-image", webhook.Handler.BootstrapImage, "initContainer bootstrap image")
-	webhookCmd.Flags().StringVar(&webhook.Handler.HostPathPrefix, "hostPathPrefix", webhook.Handler.HostPathPrefix, "Location of zoneinfo on host machines")
-	webhookCmd.Flags().StringVar(&webhook.Handler.LocalTimePath, "localTimePath", webhook.Handler.LocalTimePath, "Mount path for TZif file on containers")
-	webhookCmd.Flags().StringVarP((*string)(&webhook.Handler.DefaultInjectionStrategy), "injection-strategy", "s", string(webhook.Handler.DefaultInjectionStrategy), "Default injection strategy if not specified explicitly (hostPath/initContainer)")
-	webhookCmd.Flags().BoolVar(&webhook.Handler.InjectByDefault, "inject", webhook.Handler.InjectByDefault, "Whether injection is enabled by default or should be requested by annotation")
-	webhookCmd.Flags().BoolVar(&webhook.Handler.CronJobTimeZone, "cronJobTimeZone", webhook.Handler.CronJobTimeZone, "Enable CronJob injection. Requires kubernetes >=1.24.0-beta.0 and the 'CronJobTimeZone' feature gate enabled (alpha)")
+	webhookCmd.Flags().StringVar((*string)(&webhook.CryptoPolicy), "crypto-policy", string(webhook.CryptoPolicy), "Crypto policy of the server (default/fips), fips requires a binary built with GOEXPERIMENT=boringcrypto and the fips build tag and restricts TLS to FIPS-approved versions, cipher suites and curves")
+	webhookCmd.Flags().StringSliceVar(&webhook.Addresses, "addr", webhook.Addresses, "Webhook bind addresses, can be repeated. An empty host (e.g. :8443) or [::] listens on both IPv4 and IPv6, host names are listened on all their resolved ips")
+	webhookCmd.Flags().StringVar(&webhook.UnixSocket, "unix-socket", webhook.UnixSocket, "Also serve the webhook in plaintext on this unix domain socket, for a proxy that terminates TLS in front of it (disabled if empty)")
+	webhookCmd.Flags().BoolVar(&webhook.ReusePort, "reuse-port", webhook.ReusePort, "Set SO_REUSEPORT on the TCP listeners, so another k8tz process (e.g. a newer version) can listen on the same addresses before this one stops")
+	webhookCmd.Flags().BoolVar(&webhook.Handover, "handover", webhook.Handover, "On SIGUSR2, start the executable again (e.g. an upgraded binary at the same path) with the same arguments and pass it the listening sockets, this process stops once the new one serves them")
+	webhookCmd.Flags().StringVar((*string)(&webhook.ServeMode), "serve-mode", string(webhook.ServeMode), "Protocols served on the webhook addresses: webhook (HTTPS admission webhook), grpc (gRPC processor k8tz.admission.v1.Processor instead of the webhook) or both")
+	webhookCmd.Flags().BoolVar(&webhook.Registration.Enabled, "register-webhook", webhook.Registration.Enabled, "Create or update the MutatingWebhookConfiguration on startup, with the rules and selectors derived from the flags of the webhook (requires get, create and update permissions on mutatingwebhookconfigurations)")
+	webhookCmd.Flags().BoolVar(&webhook.Registration.Unregister, "unregister-webhook", webhook.Registration.Unregister, "Remove the MutatingWebhookConfiguration registered with --register-webhook and exit without serving, e.g. from a pre-delete hook on uninstall")
+	addRegistrationFlags(webhookCmd.Flags(), &webhook.Registration)
+	webhookCmd.Flags().StringVar(&webhook.Registration.CABundleFile, "webhook-ca-bundle", webhook.Registration.CABundleFile, "PEM file with the CA bundle of the registered configuration, if empty the caBundle of the registered configuration is kept (e.g. injected by cert-manager) or the serving certificate is used")
+	webhookCmd.Flags().StringVar(&webhook.HealthAddress, "health-addr", webhook.HealthAddress, "Bind address of the plaintext /healthz and /readyz probes, e.g. :8080 (disabled if empty)")
+	webhookCmd.Flags().BoolVar(&webhook.EnablePprof, "enable-pprof", webhook.EnablePprof, "Serve the pprof and expvar debug endpoints on --debug-addr")
+	webhookCmd.Flags().BoolVar(&webhook.EnableReport, "enable-report", webhook.EnableReport, "Serve the timezone inventory of the pods in the cluster on /report of --debug-addr (requires permission to list pods)")
+	webhookCmd.Flags().StringVar(&webhook.DebugAddress, "debug-addr", webhook.DebugAddress, "Bind address of the plaintext debug endpoints (pprof, expvar, the report and the test-only chaos endpoint), must be a loopback address")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.APIStartupTimeout, "api-startup-timeout", webhook.Handler.APIStartupTimeout, "How long to retry reaching the kubernetes api on startup, with exponential backoff, before exiting")
+	webhookCmd.Flags().BoolVar(&webhook.LeaderElection, "leader-election", webhook.LeaderElection, "Run the controllers (re-injection, tz database and timezone transitions checks) only in the replica that holds the leader election lease, for webhooks with multiple replicas")
+	webhookCmd.Flags().StringVar(&webhook.LeaderElectionID, "leader-election-id", webhook.LeaderElectionID, "Name of the leader election lease")
+	webhookCmd.Flags().StringVar(&webhook.LeaseNamespace, "leader-election-namespace", webhook.LeaseNamespace, "Namespace of the leader election lease, the install namespace if empty")
+	webhookCmd.Flags().DurationVar(&webhook.LeaseDuration, "leader-election-lease-duration", webhook.LeaseDuration, "How long the other replicas wait before taking over the lease of a leader that stopped renewing it")
+	webhookCmd.Flags().DurationVar(&webhook.RenewDeadline, "leader-election-renew-deadline", webhook.RenewDeadline, "How long the leader retries to renew the lease before it stops the controllers")
+	webhookCmd.Flags().DurationVar(&webhook.RetryPeriod, "leader-election-retry-period", webhook.RetryPeriod, "How often the replicas try to acquire or renew the lease")
+	webhookCmd.Flags().DurationVar(&webhook.ShutdownDelay, "shutdown-delay", webhook.ShutdownDelay, "How long the health check fails before the server stops accepting requests on shutdown, to let the pod be removed from the service endpoints")
+	webhookCmd.Flags().DurationVar(&webhook.ShutdownTimeout, "shutdown-timeout", webhook.ShutdownTimeout, "How long to wait for in-flight requests on shutdown")
+	webhookCmd.Flags().DurationVar(&webhook.ReadTimeout, "read-timeout", webhook.ReadTimeout, "Maximum duration for reading an entire request, including the body (0 for no timeout), the gRPC Process stream is exempt")
+	webhookCmd.Flags().DurationVar(&webhook.WriteTimeout, "write-timeout", webhook.WriteTimeout, "Maximum duration before timing out writes of the response (0 for no timeout), the gRPC Process stream is exempt")
+	webhookCmd.Flags().Int64Var(&webhook.Handler.MaxRequestBytes, "max-request-bytes", webhook.Handler.MaxRequestBytes, "Maximum size of an admission review request body, larger requests are rejected (0 for no limit)")
+	webhookCmd.Flags().IntVar(&webhook.Handler.MaxConcurrentReviews, "max-concurrent-reviews", webhook.Handler.MaxConcurrentReviews, "Maximum number of admission reviews evaluated concurrently, other requests wait for a free slot (0 for no limit)")
+	webhookCmd.Flags().Float64Var(&webhook.Handler.MaxReviewsPerSecond, "max-reviews-per-second", webhook.Handler.MaxReviewsPerSecond, "Maximum rate of evaluated admission reviews, requests over the rate are allowed without injection and with a warning (0 for no limit)")
+	webhookCmd.Flags().IntVar(&webhook.Handler.ReviewBurst, "review-burst", webhook.Handler.ReviewBurst, "Number of admission reviews that can exceed --max-reviews-per-second at once (0 for the rate)")
+	webhookCmd.Flags().IntVar(&webhook.Handler.CircuitBreakerThreshold, "circuit-breaker-threshold", webhook.Handler.CircuitBreakerThreshold, "Number of internal or api lookup errors within --circuit-breaker-window after which admission reviews are allowed without injection for --circuit-breaker-cooldown (0 to disable)")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.CircuitBreakerWindow, "circuit-breaker-window", webhook.Handler.CircuitBreakerWindow, "Period in which the errors of --circuit-breaker-threshold are counted")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.CircuitBreakerCooldown, "circuit-breaker-cooldown", webhook.Handler.CircuitBreakerCooldown, "Period the circuit breaker stays open before admission reviews are evaluated again")
+	addHandlerFlags(webhookCmd.Flags(), &webhook.Handler)
+	webhookCmd.Flags().BoolVar(&webhook.Handler.PinBootstrapDigest, "pin-bootstrap-digest", webhook.Handler.PinBootstrapDigest, "Resolve the bootstrap images to their digests at startup and inject the digest references")
+	webhookCmd.Flags().StringVar(&webhook.Handler.BootstrapVerifyKey, "bootstrap-verify-key", webhook.Handler.BootstrapVerifyKey, "Cosign public key file, the webhook does not start unless the bootstrap images are signed with it (implies --pin-bootstrap-digest)")
+	webhookCmd.Flags().StringVar(&webhook.Handler.RegistryConfig, "registry-config", webhook.Handler.RegistryConfig, "Docker config.json file with the credentials of the registries of the bootstrap images, anonymous access if empty")
+	webhookCmd.Flags().StringVar(&webhook.Handler.ConfigFile, "config", webhook.Handler.ConfigFile, "YAML file with the defaults (timezone, injectionStrategy, bootstrapImage, excludedNamespaces) that is reloaded on SIGHUP and when its content changes, explicitly set flags take precedence")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.ConfigReload, "config-reload-interval", webhook.Handler.ConfigReload, "How often the config file is checked for changes (0 to reload only on SIGHUP)")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.WatchTimezonePolicies, "watch-timezone-policies", webhook.Handler.WatchTimezonePolicies, "Apply the TimezonePolicy (k8tz.io/v1alpha1) objects of the cluster to the pods they select, requires the CRD to be installed")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.ReinjectWorkloads, "reinject-workloads", webhook.Handler.ReinjectWorkloads, "Re-inject the injected pod templates of Deployments, StatefulSets and CronJobs that are opted in with the k8tz.io/reinject annotation or a TimezonePolicy when their desired injection changes, rolling out their pods")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.ReinjectInterval, "reinject-interval", webhook.Handler.ReinjectInterval, "How often all the opted in workloads are checked for re-injection, in addition to their changes")
+	webhookCmd.Flags().StringVar((*string)(&webhook.Handler.TzdataUpgrade), "tzdata-upgrade", string(webhook.Handler.TzdataUpgrade), "What to do with running pods injected with an older tz database (ignore/report/restart), restart rolls out their Deployments, StatefulSets and DaemonSets")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.TzdataCheckInterval, "tzdata-check-interval", webhook.Handler.TzdataCheckInterval, "How often the running pods are checked for an older tz database")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.DSTTransitions, "dst-transitions", webhook.Handler.DSTTransitions, "Look up the next UTC offset change (e.g. daylight saving time) of the timezones of the injected pods and expose it in the k8tz_next_dst_transition_seconds metric (requires permission to list pods)")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.DSTCheckInterval, "dst-check-interval", webhook.Handler.DSTCheckInterval, "How often the timezones of the injected pods are checked for their next transition")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.DSTNoticePeriod, "dst-notice-period", webhook.Handler.DSTNoticePeriod, "Emit an event on the injected pods this long before the UTC offset of their timezone changes, once per transition (0 to disable the events, requires permission to create events)")
+	webhookCmd.Flags().DurationVar(&webhook.Handler.TimezonePolicyReload, "timezone-policy-reload-interval", webhook.Handler.TimezonePolicyReload, "How often the timezone policy file is checked for changes (0 to reload only on SIGHUP)")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.EmitEvents, "emit-events", webhook.Handler.EmitEvents, "Emit Kubernetes events on the reviewed objects describing the injection decisions")
+	webhookCmd.Flags().StringVar(&webhook.Handler.AuditLog, "audit-log", webhook.Handler.AuditLog, "Record every admission decision (uid, object, timezone, strategy, patch hash, outcome) as JSON lines to stdout, a file path or an http(s) URL that receives a POST per record, disabled if empty")
+	webhookCmd.Flags().IntVar(&webhook.Handler.AuditLogMaxSize, "audit-log-max-size", webhook.Handler.AuditLogMaxSize, "Size in megabytes of the audit log file before it is rotated, 0 to never rotate")
+	webhookCmd.Flags().IntVar(&webhook.Handler.AuditLogMaxBackups, "audit-log-max-backups", webhook.Handler.AuditLogMaxBackups, "Number of rotated audit log files to keep")
+	webhookCmd.Flags().BoolVar(&webhook.Handler.AuditLogCompress, "audit-log-compress", webhook.Handler.AuditLogCompress, "Gzip the rotated audit log files and the bodies POSTed to an http(s) audit sink")
 	webhookCmd.Flags().BoolVar(&webhook.Verbose, "verbose", webhook.Verbose, "Print more verbose logs for debugging")
 }
@@ -0,0 +1,109 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/tzdata"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listAbbreviations bool
+	listAll           bool
+)
+
+var zonesCmd = &cobra.Command{
+	Use:   "zones [timezone...]",
+	Short: "List the timezone aliases and the timezones they are injected as",
+	Long: `List the timezone aliases and the timezones they are injected as.
+
+Deprecated and alias timezones (e.g. Asia/Calcutta or US/Eastern) are
+injected as their canonical timezone (Asia/Kolkata, America/New_York), and
+abbreviations (e.g. IST) are rejected since they are not timezones. The
+table is embedded in k8tz, so the result does not depend on the tz database
+of the nodes or of the images.
+
+Examples:
+# List all the aliases
+k8tz zones
+
+# Show the timezone that is injected for some timezones
+k8tz zones Asia/Calcutta US/Eastern Europe/Berlin
+
+# List the rejected abbreviations
+k8tz zones --abbreviations
+
+# List the timezones of the tz database embedded in k8tz
+k8tz zones --all`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if len(args) > 0 {
+			fmt.Fprintln(w, "TIMEZONE\tINJECTED AS")
+			for _, timezone := range args {
+				canonical, err := inject.CanonicalTimezone(timezone)
+				if err != nil {
+					canonical = err.Error()
+				}
+
+				fmt.Fprintf(w, "%s\t%s\n", timezone, canonical)
+			}
+		} else if listAll {
+			zones, err := tzdata.Zones()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(w, "TIMEZONE (tz database %s)\n", tzdata.Version())
+			for _, zone := range zones {
+				fmt.Fprintln(w, zone)
+			}
+		} else if listAbbreviations {
+			abbreviations := make([]string, 0, len(inject.TimezoneAbbreviations))
+			for abbreviation := range inject.TimezoneAbbreviations {
+				abbreviations = append(abbreviations, abbreviation)
+			}
+
+			sort.Strings(abbreviations)
+			fmt.Fprintln(w, "ABBREVIATION\tTIMEZONES")
+			for _, abbreviation := range abbreviations {
+				fmt.Fprintf(w, "%s\t%s\n", abbreviation, strings.Join(inject.TimezoneAbbreviations[abbreviation], ", "))
+			}
+		} else {
+			fmt.Fprintln(w, "ALIAS\tINJECTED AS")
+			for _, alias := range inject.SortedTimezoneAliases() {
+				fmt.Fprintf(w, "%s\t%s\n", alias, inject.TimezoneAliases[alias])
+			}
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(zonesCmd)
+
+	zonesCmd.Flags().BoolVar(&listAbbreviations, "abbreviations", listAbbreviations, "List the abbreviations that are rejected instead of the aliases")
+	zonesCmd.Flags().BoolVar(&listAll, "all", listAll, "List all the timezones of the embedded tz database instead of the aliases")
+}
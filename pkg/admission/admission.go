@@ -21,43 +21,293 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/apis/v1alpha1"
 	"github.com/k8tz/k8tz/pkg/inject"
 	"github.com/k8tz/k8tz/pkg/version"
+	admissionv1 "k8s.io/api/admission/v1"
 	admission "k8s.io/api/admission/v1beta1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// resourceHandler handles admission requests of a single resource and returns
+// the patches that should be applied on the requested object
+type resourceHandler func(h *RequestsHandler, req *admission.AdmissionRequest) (k8tz.Patches, error)
+
+var (
+	resourceHandlers = map[metav1.GroupVersionResource]resourceHandler{
+		podResource:         (*RequestsHandler).handlePodAdmissionRequest,
+		cronJobResource:     (*RequestsHandler).handleCronJobAdmissionRequest,
+		deploymentResource:  (*RequestsHandler).handleWorkloadAdmissionRequest,
+		statefulSetResource: (*RequestsHandler).handleWorkloadAdmissionRequest,
+		daemonSetResource:   (*RequestsHandler).handleWorkloadAdmissionRequest,
+		replicaSetResource:  (*RequestsHandler).handleWorkloadAdmissionRequest,
+		jobResource:         (*RequestsHandler).handleWorkloadAdmissionRequest,
+	}
+	unhandledResources sync.Map
 )
 
 type RequestsHandler struct {
 	DefaultTimezone          string
 	BootstrapImage           string
+	BootstrapImagePullPolicy corev1.PullPolicy
+	BootstrapArchImages      map[string]string
+	BootstrapResources       corev1.ResourceRequirements
+	BootstrapSecurity        inject.BootstrapSecurityContext
+	BootstrapPullSecrets     []string
+	BootstrapRegistries      []string
+	PinBootstrapDigest       bool
+	BootstrapVerifyKey       string
+	RegistryConfig           string
 	DefaultInjectionStrategy inject.InjectionStrategy
 	InjectByDefault          bool
 	HostPathPrefix           string
+	HostPathType             corev1.HostPathType
+	HostPathRoots            []string
+	HostPathNodeLabel        string
+	CSIDriver                string
+	CSIVolumeAttributes      map[string]string
+	CSIZoneInfoPath          string
 	LocalTimePath            string
 	CronJobTimeZone          bool
+	CronJobMode              inject.CronJobMode
+	RewriteCronJobSchedules  bool
+	FaketimeLibrary          string
+	InjectWorkloads          bool
+	TemplatePaths            TemplatePaths
+	TemplatePathMaxDepth     int
+	NamespaceCache           bool
+	WatchTimezonePolicies    bool
+	BootstrapSidecar         bool
+	HostNamespacesStrategy   inject.InjectionStrategy
+	PodSecurityLevel         inject.PodSecurityLevel
+	PodSecurityAction        inject.PodSecurityAction
+	InstallNamespace         string
+	ExcludeInstallNamespace  bool
+	ExcludedNamespaces       []string
+	NamespaceSelector        string
+	ObjectSelector           string
+	ExcludeNames             string
+	ConfigFile               string
+	ConfigReload             time.Duration
+	ConfigOverrides          []string
+	TimezoneFormat           inject.TimezoneFormat
+	DefaultLocale            string
+	ZoneInfoPath             string
+	ExtraEnv                 inject.ExtraEnv
+	AnnotateOffset           bool
+	TimezonePolicyFile       string
+	TimezonePolicyReload     time.Duration
+	AllowOnError             bool
+	OnError                  ErrorAction
+	OnErrorResources         ErrorActions
+	DryRun                   bool
+	EmitEvents               bool
+	DebugAnnotation          bool
+	ReinjectWorkloads        bool
+	ReinjectInterval         time.Duration
+	TzdataVersion            string
+	ConflictPolicy           inject.ConflictPolicy
+	Reinvocation             bool
+	TzdataUpgrade            TzdataUpgradeAction
+	TzdataCheckInterval      time.Duration
+	DSTTransitions           bool
+	DSTCheckInterval         time.Duration
+	DSTNoticePeriod          time.Duration
+	APIStartupTimeout        time.Duration
+	MaxRequestBytes          int64
+	MaxConcurrentReviews     int
+	MissingTimezoneAction    MissingTimezoneAction
+	FallbackTimezone         string
+	AutoTimezone             bool
+	RegionTimezones          map[string]string
+	CronJobOwners            bool
+	AuditLog                 string
+	AuditLogMaxSize          int
+	AuditLogMaxBackups       int
+	AuditLogCompress         bool
+	MaxReviewsPerSecond      float64
+	ReviewBurst              int
+	CircuitBreakerThreshold  int
+	CircuitBreakerWindow     time.Duration
+	CircuitBreakerCooldown   time.Duration
 	clientset                kubernetes.Interface
+	namespaces               corelisters.NamespaceLister
+	jobs                     batchlisters.JobLister
+	cronJobs                 batchlisters.CronJobLister
+	nodes                    corelisters.NodeLister
+	cacheSynced              []cache.InformerSynced
+	policies                 cache.GenericLister
+	nativeSidecars           bool
+	legacyCronJobs           bool
+	reviewSlots              chan struct{}
+	rateLimiter              flowcontrol.RateLimiter
+	breaker                  *circuitBreaker
+	selectors                *objectSelectors
+	auditSink                AuditSink
+	chaos                    *Chaos
+	state                    *reviewState
 }
 
 func NewRequestsHandler() RequestsHandler {
 	return RequestsHandler{
 		DefaultTimezone:          k8tz.DefaultTimezone,
 		BootstrapImage:           version.Image(),
+		BootstrapImagePullPolicy: "",
+		BootstrapArchImages:      map[string]string{},
+		BootstrapResources:       corev1.ResourceRequirements{},
+		BootstrapSecurity:        inject.BootstrapSecurityContext{},
+		BootstrapPullSecrets:     []string{},
+		BootstrapRegistries:      []string{},
+		PinBootstrapDigest:       false,
+		BootstrapVerifyKey:       "",
+		RegistryConfig:           "",
 		DefaultInjectionStrategy: inject.DefaultInjectionStrategy,
 		InjectByDefault:          true,
 		HostPathPrefix:           inject.DefaultHostPathPrefix,
+		HostPathType:             corev1.HostPathUnset,
+		HostPathRoots:            []string{},
+		HostPathNodeLabel:        "",
+		CSIDriver:                "",
+		CSIVolumeAttributes:      map[string]string{},
+		CSIZoneInfoPath:          "",
 		LocalTimePath:            inject.DefaultLocalTimePath,
 		CronJobTimeZone:          false,
+		CronJobMode:              inject.AutoCronJobMode,
+		RewriteCronJobSchedules:  false,
+		FaketimeLibrary:          inject.DefaultFaketimeLibrary,
+		InjectWorkloads:          false,
+		TemplatePaths:            TemplatePaths{},
+		TemplatePathMaxDepth:     DefaultTemplatePathMaxDepth,
+		NamespaceCache:           true,
+		WatchTimezonePolicies:    false,
+		BootstrapSidecar:         false,
+		HostNamespacesStrategy:   "",
+		PodSecurityLevel:         "",
+		PodSecurityAction:        inject.PodSecurityIgnore,
+		InstallNamespace:         detectInstallNamespace(),
+		ExcludeInstallNamespace:  true,
+		ExcludedNamespaces:       []string{},
+		NamespaceSelector:        "",
+		ObjectSelector:           "",
+		ExcludeNames:             "",
+		ConfigFile:               "",
+		ConfigReload:             30 * time.Second,
+		ConfigOverrides:          []string{},
+		TimezoneFormat:           inject.NameTimezoneFormat,
+		DefaultLocale:            "",
+		ZoneInfoPath:             inject.DefaultZoneInfoPath,
+		ExtraEnv:                 inject.ExtraEnv{},
+		AnnotateOffset:           false,
+		TimezonePolicyFile:       "",
+		TimezonePolicyReload:     30 * time.Second,
+		AllowOnError:             false,
+		OnError:                  "",
+		OnErrorResources:         ErrorActions{},
+		DryRun:                   false,
+		EmitEvents:               false,
+		DebugAnnotation:          true,
+		ReinjectWorkloads:        false,
+		ReinjectInterval:         10 * time.Minute,
+		TzdataVersion:            "",
+		ConflictPolicy:           inject.ConflictReplace,
+		Reinvocation:             false,
+		TzdataUpgrade:            TzdataUpgradeIgnore,
+		TzdataCheckInterval:      time.Hour,
+		DSTTransitions:           false,
+		DSTCheckInterval:         time.Hour,
+		DSTNoticePeriod:          7 * 24 * time.Hour,
+		APIStartupTimeout:        2 * time.Minute,
+		MaxRequestBytes:          DefaultMaxRequestBytes,
+		MaxConcurrentReviews:     0,
+		MissingTimezoneAction:    MissingTimezoneFallback,
+		FallbackTimezone:         k8tz.UTCTimezone,
+		AutoTimezone:             false,
+		RegionTimezones:          map[string]string{},
+		CronJobOwners:            false,
+		AuditLog:                 "",
+		AuditLogMaxSize:          DefaultAuditLogMaxSize,
+		AuditLogMaxBackups:       DefaultAuditLogMaxBackups,
+		AuditLogCompress:         false,
+		MaxReviewsPerSecond:      0,
+		ReviewBurst:              0,
+		CircuitBreakerThreshold:  0,
+		CircuitBreakerWindow:     time.Minute,
+		CircuitBreakerCooldown:   30 * time.Second,
+	}
+}
+
+// detectInstallNamespace returns the namespace k8tz is running in, either from
+// the POD_NAMESPACE environment variable (downward API) or from the service
+// account namespace file. An empty string is returned when running outside of
+// kubernetes.
+func detectInstallNamespace() string {
+	if namespace := os.Getenv(podNamespaceEnv); namespace != "" {
+		return namespace
+	}
+
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// validate checks the options of the handler and compiles its selectors, it
+// is called by the webhook and by MutateStream before the first review so an
+// invalid option fails the same way in both
+func (h *RequestsHandler) validate() error {
+	if h.CircuitBreakerThreshold > 0 && (h.CircuitBreakerWindow <= 0 || h.CircuitBreakerCooldown <= 0) {
+		return errors.New("the circuit breaker window and cooldown must be positive")
+	}
+
+	if h.DefaultLocale != "" {
+		if err := inject.ValidateLocale(h.DefaultLocale); err != nil {
+			return err
+		}
+	}
+
+	if err := inject.ValidateHostPathType(h.HostPathType); err != nil {
+		return err
+	}
+
+	if h.DefaultInjectionStrategy == inject.CSIInjectionStrategy && h.CSIDriver == "" {
+		return errors.New("the csi injection strategy requires a csi driver (--csi-driver)")
+	}
+
+	if err := h.validateTemplatePaths(); err != nil {
+		return err
 	}
+
+	if err := h.validateOnError(); err != nil {
+		return err
+	}
+
+	if h.DSTTransitions && h.DSTCheckInterval <= 0 {
+		return errors.New("the timezone transitions check interval must be positive")
+	}
+
+	return h.CompileSelectors()
 }
 
 func getKubeconfig(kubeconfPath string) (*restclient.Config, error) {
@@ -81,23 +331,211 @@ func (h *RequestsHandler) InitializeClientset(kubeconfPath string) error {
 		return fmt.Errorf("failed to get in-cluster config: %v", err)
 	}
 
-	clientset, _ := kubernetes.NewForConfig(config)
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return fmt.Errorf("failed to create k8s client: %v", err)
 	}
 
 	h.clientset = clientset
+	if err = h.waitForAPI(); err != nil {
+		return err
+	}
+
+	h.detectNativeSidecars()
+	h.detectCronJobTimeZone()
+
+	if h.WatchTimezonePolicies {
+		client, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create k8s dynamic client: %v", err)
+		}
+
+		if err := h.startTimezonePolicies(client, nil); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// waitForAPI retries to reach the kubernetes api with exponential backoff for
+// up to APIStartupTimeout, so a transient outage of the api server does not
+// crash-loop the webhook on startup
+func (h *RequestsHandler) waitForAPI() error {
+	delay := apiRetryDelay
+	deadline := time.Now().Add(h.APIStartupTimeout)
+	for attempt := 1; ; attempt++ {
+		err := h.pingAPI()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("kubernetes api is not reachable after %d attempts: %w", attempt, err)
+		}
+
+		warningLogger.Printf("kubernetes api is not reachable, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxAPIRetryDelay {
+			delay = maxAPIRetryDelay
+		}
+	}
+}
+
+// detectNativeSidecars checks whether the kubernetes api server supports
+// native sidecars (restartable initContainers), if it does not, the bootstrap
+// initContainer is injected as a plain initContainer. The detection is done
+// even without --bootstrap-sidecar since the sidecar strategy can be requested
+// by annotation.
+func (h *RequestsHandler) detectNativeSidecars() {
+	logger := verboseLogger
+	if h.BootstrapSidecar || h.DefaultInjectionStrategy == inject.SidecarInjectionStrategy {
+		logger = warningLogger
+	}
+
+	info, err := h.clientset.Discovery().ServerVersion()
+	if err != nil {
+		logger.Printf("failed to detect kubernetes version, bootstrap will be injected as plain initContainer: %v", err)
+		h.nativeSidecars = false
+		return
+	}
+
+	h.nativeSidecars = supportsNativeSidecars(info.Major, info.Minor)
+	if !h.nativeSidecars {
+		logger.Printf("kubernetes %s.%s does not support native sidecars, bootstrap will be injected as plain initContainer", info.Major, info.Minor)
+	}
+}
+
+// supportsNativeSidecars returns true if native sidecars are enabled by default
+// in the given kubernetes version (beta since 1.29). Minor versions of managed
+// distributions may have a suffix, e.g. "29+"
+func supportsNativeSidecars(major, minor string) bool {
+	return atLeastVersion(major, minor, 1, 29)
+}
+
+// atLeastVersion returns true if the kubernetes version is at least
+// wantMajor.wantMinor
+func atLeastVersion(major, minor string, wantMajor, wantMinor int) bool {
+	ma, err := strconv.Atoi(strings.TrimSuffix(major, "+"))
+	if err != nil {
+		return false
+	}
+
+	mi, err := strconv.Atoi(strings.TrimSuffix(minor, "+"))
+	if err != nil {
+		return false
+	}
+
+	return ma > wantMajor || (ma == wantMajor && mi >= wantMinor)
+}
+
+// detectCronJobTimeZone checks whether the kubernetes api server supports the
+// spec.timeZone field of CronJobs when the mode is auto, if it does not, the
+// job template of CronJobs is injected instead
+func (h *RequestsHandler) detectCronJobTimeZone() {
+	if !h.CronJobTimeZone || h.CronJobMode != inject.AutoCronJobMode {
+		return
+	}
+
+	info, err := h.clientset.Discovery().ServerVersion()
+	if err != nil {
+		warningLogger.Printf("failed to detect kubernetes version, assuming CronJobs support spec.timeZone: %v", err)
+		h.legacyCronJobs = false
+		return
+	}
+
+	h.legacyCronJobs = !supportsCronJobTimeZone(info.Major, info.Minor)
+	if h.legacyCronJobs {
+		warningLogger.Printf("kubernetes %s.%s does not support spec.timeZone of CronJobs, their job template will be injected instead", info.Major, info.Minor)
+	}
+}
+
+// supportsCronJobTimeZone returns true if the spec.timeZone field of CronJobs
+// is generally available in the given kubernetes version (GA since 1.27)
+func supportsCronJobTimeZone(major, minor string) bool {
+	return atLeastVersion(major, minor, 1, 27)
+}
+
+// cronJobMode returns the mode CronJobs are injected with, auto is resolved
+// by the kubernetes version detected on startup
+func (h *RequestsHandler) cronJobMode() inject.CronJobMode {
+	if h.CronJobMode != inject.AutoCronJobMode {
+		return h.CronJobMode
+	}
+
+	if h.legacyCronJobs {
+		return inject.TemplateCronJobMode
+	}
+
+	return inject.NativeCronJobMode
+}
+
 func (h *RequestsHandler) handleFunc(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startReviewSpan(r)
+	defer span.End()
+
+	_, decodeSpan := tracer().Start(ctx, "decode")
 	review, header, err := h.readAdmissionReview(r)
-	if err != nil {
+	endSpan(decodeSpan, err)
+
+	if decodeErr, ok := isDecodeError(err); ok && h.answerDecodeError(w, decodeErr) {
+		return
+	} else if err != nil {
 		warningLogger.Printf("failed to parse review: %v\n", err)
 		http.Error(w, fmt.Sprintf("failed to parse admission review from request, error=%s", err.Error()), header)
 		return
 	}
 
+	if misrouted(w, r, review) {
+		return
+	}
+
+	release, ok := h.acquireReviewSlot(r)
+	if !ok {
+		warningLogger.Printf("request uid=%s cancelled while waiting for a free review slot", review.Request.UID)
+		http.Error(w, "too many concurrent admission reviews", http.StatusServiceUnavailable)
+		return
+	}
+	defer release()
+
+	if h.chaos.load().closesConnections() {
+		w.Header().Set("Connection", "close")
+	}
+
+	setReviewAttributes(span, review.Request)
+	reviewResponse, err := h.reviewContext(ctx, review)
+	if err != nil {
+		endSpan(span, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, serializeSpan := tracer().Start(ctx, "serialize")
+	bytes, err := json.Marshal(reviewResponse)
+	endSpan(serializeSpan, err)
+	if err != nil {
+		errorLogger.Printf("failed to marshal response review: %+v, error=%v\n", reviewResponse, err)
+		http.Error(w, fmt.Sprintf("failed to marshal response review: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(bytes)
+	if err != nil {
+		errorLogger.Printf("failed to write response to output http stream: %v\n", err)
+		http.Error(w, fmt.Sprintf("failed to write response: %s", err.Error()), http.StatusInternalServerError)
+	}
+}
+
+// review handles a decoded admission review and returns the review that
+// should be sent back to the api server
+func (h *RequestsHandler) review(review *admission.AdmissionReview) (*admission.AdmissionReview, error) {
+	return h.reviewContext(context.Background(), review)
+}
+
+// reviewContext is review with the context of the trace of the review, the
+// stages of the review are traced as children of its span
+func (h *RequestsHandler) reviewContext(ctx context.Context, review *admission.AdmissionReview) (*admission.AdmissionReview, error) {
 	reviewResponse := admission.AdmissionReview{
 		TypeMeta: review.TypeMeta,
 		Response: &admission.AdmissionResponse{
@@ -105,60 +543,213 @@ func (h *RequestsHandler) handleFunc(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	verboseLogger.Printf("incoming review request=%+v", *review.Request)
+	debug := h.DebugAnnotation && debugRequested(review.Request)
+	logger := verboseLogger
+	if debug {
+		logger = debugLogger
+		logger.Printf("tracing request uid=%s, requested by the %s annotation, object=%s", review.Request.UID, k8tz.DebugAnnotation, review.Request.Object.Raw)
+	}
 
-	patches, err := h.handleAdmissionReview(review)
-	if err != nil {
-		warningLogger.Printf("rejecting request: error=%v, review=%+v\n", err, *review)
+	logger.Printf("incoming review request=%+v", *review.Request)
+	atomic.AddUint64(&admissionReviews, 1)
+
+	if mode, delay, ok := h.chaos.reviewFailure(); ok {
+		warningLogger.Printf("TEST ONLY: injecting failure (%s) to request uid=%s", mode, review.Request.UID)
+		switch mode {
+		case FailureModeError:
+			return nil, fmt.Errorf("injected failure (test only)")
+		case FailureModeSlow:
+			// the review is handled as usual after the delay
+			time.Sleep(delay)
+		case FailureModeMalformed:
+			patchType := admission.PatchTypeJSONPatch
+			reviewResponse.Response.Allowed = true
+			reviewResponse.Response.PatchType = &patchType
+			reviewResponse.Response.Patch = []byte(`{"injected":"failure (test only)"}`)
+			return &reviewResponse, nil
+		default:
+			reviewResponse.Response.Allowed = false
+			reviewResponse.Response.Result = &metav1.Status{
+				Message: "injected failure (test only)",
+			}
+
+			return &reviewResponse, nil
+		}
+	}
+
+	reason, message, trial := h.degraded(time.Now())
+	if reason != "" {
+		skippedRequests.inc(reason)
+		logger.Printf("allowing request uid=%s without injection (degraded): reason=%s, %s", review.Request.UID, reason, message)
+		reviewResponse.Response.Allowed = true
+		reviewResponse.Response.Warnings = []string{fmt.Sprintf("k8tz injection skipped: %s", message)}
+		h.audit(review.Request, &reviewState{skipReason: reason, skipMessage: message}, AuditSkipped, nil, 0, nil)
+		return &reviewResponse, nil
+	}
+
+	// the handler is copied to collect the state of this request only, with
+	// the webhook config of the time of the request
+	state := &reviewState{debug: debug, ctx: ctx}
+	handler := h.configured()
+	handler.state = state
+
+	if trial {
+		// a trial that panics fails, so the circuit breaker is not left
+		// waiting for its outcome
+		defer func() {
+			if p := recover(); p != nil {
+				h.recordOutcome(time.Now(), fmt.Errorf("panic: %v", p), true)
+				panic(p)
+			}
+		}()
+	}
+
+	patches, err := handler.handleAdmissionReview(review)
+	h.recordOutcome(time.Now(), err, trial)
+	warnings := state.warnings
+	count := len(patches)
+	outcome := AuditSkipped
+	var patchBytes []byte
+	if err != nil && h.failOpen(review.Request) {
+		outcome = AuditAllowedOnError
+		skippedRequests.inc(reasonOf(err))
+		h.countError(review.Request.Resource, ErrorActionAllow)
+		warningLogger.Printf("allowing request without injection (fail-open): reason=%s, error=%v, review=%+v\n", reasonOf(err), err, *review)
+		reviewResponse.Response.Allowed = true
+		warnings = append(warnings, fmt.Sprintf("k8tz injection skipped: %v", err))
+	} else if err != nil && h.DryRun {
+		outcome = AuditRejected
+		rejectedRequests.inc(reasonOf(err))
+		warningLogger.Printf("dry-run: allowing request that would be rejected: reason=%s, error=%v, review=%+v\n", reasonOf(err), err, *review)
+		reviewResponse.Response.Allowed = true
+		warnings = append(warnings, fmt.Sprintf("k8tz dry-run: the object would be rejected: %v", err))
+	} else if err != nil {
+		outcome = AuditRejected
+		rejectedRequests.inc(reasonOf(err))
+		h.countError(review.Request.Resource, ErrorActionDeny)
+		warningLogger.Printf("rejecting request: reason=%s, error=%v, review=%+v\n", reasonOf(err), err, *review)
 		reviewResponse.Response.Allowed = false
 		reviewResponse.Response.Result = &metav1.Status{
 			Message: err.Error(),
 		}
 	} else {
-		patchBytes, err := json.Marshal(patches)
-		if err != nil {
+		if patchBytes, err = json.Marshal(patches); err != nil {
 			errorLogger.Printf("failed to marshal json patch: %+v, error=%v\n", patches, err)
-			http.Error(w, fmt.Sprintf("could not marshal JSON patch: %s", err.Error()), http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("could not marshal JSON patch: %s", err.Error())
+		}
+
+		if count > 0 {
+			outcome = AuditMutated
 		}
 
 		reviewResponse.Response.Patch = patchBytes
+		if h.DryRun && count > 0 {
+			h.withholdPatches(review.Request, patches)
+			patches = nil
+			reviewResponse.Response.Patch = []byte("null")
+		}
+
 		reviewResponse.Response.PatchType = new(admission.PatchType)
 		*reviewResponse.Response.PatchType = admission.PatchTypeJSONPatch
 		reviewResponse.Response.Allowed = true
 	}
 
-	verboseLogger.Printf("sending response: allowed=%t, result=%+v, patches=%+v", reviewResponse.Response.Allowed, reviewResponse.Response.Result, patches)
+	if h.EmitEvents && !h.DryRun {
+		h.emitEvent(reviewEvent(review.Request, state, len(patches), err))
+	}
+
+	h.audit(review.Request, state, outcome, patchBytes, count, err)
+
+	reviewResponse.Response.Warnings = warnings
+	setReviewOutcome(ctx, reviewResponse.Response.Allowed, count)
+	logger.Printf("sending response: allowed=%t, result=%+v, timezone=%s, strategy=%s, patches=%s", reviewResponse.Response.Allowed, reviewResponse.Response.Result, state.timezone, state.strategy, patchBytes)
 
-	bytes, err := json.Marshal(&reviewResponse)
+	return &reviewResponse, nil
+}
+
+// withholdPatches logs and counts the patches that are not applied in dry-run
+// mode, so the effect of k8tz can be measured before enabling mutation
+func (h *RequestsHandler) withholdPatches(req *admission.AdmissionRequest, patches k8tz.Patches) {
+	atomic.AddUint64(&dryRunMutations, 1)
+
+	data, err := json.Marshal(patches)
 	if err != nil {
-		errorLogger.Printf("failed to marshal response review: %+v, error=%v\n", reviewResponse, err)
-		http.Error(w, fmt.Sprintf("failed to marshal response review: %s", err.Error()), http.StatusInternalServerError)
+		errorLogger.Printf("failed to marshal json patch: %+v, error=%v\n", patches, err)
 		return
 	}
 
-	_, err = w.Write(bytes)
-	if err != nil {
-		errorLogger.Printf("failed to write response to output http stream: %v\n", err)
-		http.Error(w, fmt.Sprintf("failed to write response: %s", err.Error()), http.StatusInternalServerError)
+	infoLogger.Printf("dry-run: withholding %d patches of %s (namespace=%s, name=%s): %s", len(patches), req.Kind.Kind, req.Namespace, req.Name, data)
+}
+
+// failOpen returns true if the request should be allowed without injection
+// when handling it fails. The FailOpenAnnotation of the object takes
+// precedence over the error action of the resource, but it can only be read
+// if the object metadata can be decoded.
+func (h *RequestsHandler) failOpen(req *admission.AdmissionRequest) bool {
+	object := metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		action, _ := h.errorAction(req.Resource)
+		return action == ErrorActionAllow
 	}
+
+	return h.failOpenObject(req.Resource, object.Annotations)
 }
 
-func (h *RequestsHandler) handleAdmissionReview(review *admission.AdmissionReview) (k8tz.Patches, error) {
-	if review.Request.Operation == admission.Create {
-		var patches k8tz.Patches
-		var err error
-		if review.Request.Resource == podResource {
-			patches, err = h.handlePodAdmissionRequest(review.Request)
-		} else if review.Request.Resource == cronJobResource {
-			patches, err = h.handleCronJobAdmissionRequest(review.Request)
+// failOpenObject returns true if an object of the resource with the
+// annotations should be allowed without injection when handling it fails
+func (h *RequestsHandler) failOpenObject(resource metav1.GroupVersionResource, annotations map[string]string) bool {
+	if val, ok := annotations[k8tz.FailOpenAnnotation]; ok {
+		if failOpen, err := strconv.ParseBool(val); err == nil {
+			return failOpen
 		}
 
-		return patches, err
+		warningLogger.Printf("ignoring invalid %s annotation value: %q", k8tz.FailOpenAnnotation, val)
 	}
 
-	return nil, nil
+	action, _ := h.errorAction(resource)
+	return action == ErrorActionAllow
+}
+
+func (h *RequestsHandler) handleAdmissionReview(review *admission.AdmissionReview) (k8tz.Patches, error) {
+	ephemeral := isEphemeralContainersUpdate(review.Request)
+	if review.Request.Operation != admission.Create && !ephemeral {
+		skippedRequests.inc(ReasonUnsupportedOperation)
+		return nil, nil
+	}
+
+	handler, ok := resourceHandlers[review.Request.Resource]
+	if _, template := h.TemplatePaths[groupResource(review.Request.Resource)]; !ok && template {
+		handler, ok = (*RequestsHandler).handleTemplateAdmissionRequest, true
+	}
+
+	if ephemeral {
+		handler = (*RequestsHandler).handleEphemeralContainersAdmissionRequest
+	} else if !ok || review.Request.SubResource != "" {
+		warnUnhandledResource(review.Request)
+		return nil, nil
+	}
 
+	if h.isExcludedNamespace(review.Request.Namespace) {
+		h.skip(ReasonExcludedNamespace, "skipping %s (namespace=%s, name=%s) because its namespace is excluded", review.Request.Kind.Kind, review.Request.Namespace, review.Request.Name)
+		return nil, nil
+	}
+
+	return handler(h, review.Request)
+}
+
+// warnUnhandledResource logs a warning the first time a resource that k8tz
+// does not know how to handle is received, this usually means that the
+// webhook rules are misconfigured. The request is allowed without patches.
+func warnUnhandledResource(req *admission.AdmissionRequest) {
+	key := fmt.Sprintf("%s/%s/%s", req.Resource.Group, req.Resource.Version, req.Resource.Resource)
+	if req.SubResource != "" {
+		key = fmt.Sprintf("%s/%s", key, req.SubResource)
+	}
+
+	skippedRequests.inc(ReasonUnsupportedKind)
+	if _, warned := unhandledResources.LoadOrStore(key, true); !warned {
+		warningLogger.Printf("ignoring unhandled resource %s (kind=%s), check the webhook rules; this warning is printed once per resource", key, req.Kind.Kind)
+	}
 }
 
 func (h *RequestsHandler) readAdmissionReview(r *http.Request) (*admission.AdmissionReview, int, error) {
@@ -166,128 +757,552 @@ func (h *RequestsHandler) readAdmissionReview(r *http.Request) (*admission.Admis
 		return nil, http.StatusMethodNotAllowed, fmt.Errorf("invalid method %s, only POST requests are allowed", r.Method)
 	}
 
-	body, err := io.ReadAll(r.Body)
+	body, status, err := h.readBody(r)
 	if err != nil {
-		return nil, http.StatusBadRequest, fmt.Errorf("could not read request body, error=%s", err.Error())
+		return nil, status, err
 	}
 
 	if contentType := r.Header.Get("Content-Type"); contentType != jsonContentType {
 		return nil, http.StatusBadRequest, fmt.Errorf("unsupported content type %s, only %s is supported", contentType, jsonContentType)
 	}
 
+	review, err := decodeAdmissionReview(body)
+	if err != nil {
+		return nil, http.StatusBadRequest, &decodeError{err: err, body: body}
+	}
+
+	return review, http.StatusOK, nil
+}
+
+// AdmissionReviewVersions are the versions of AdmissionReview that can be
+// handled, the objects of both versions are identical so they are decoded to
+// the same type and the response is sent in the version of the request
+var AdmissionReviewVersions = []string{
+	admissionv1.SchemeGroupVersion.String(),
+	admission.SchemeGroupVersion.String(),
+}
+
+func decodeAdmissionReview(data []byte) (*admission.AdmissionReview, error) {
 	review := &admission.AdmissionReview{}
-	if _, _, err := k8sdecode.Decode(body, nil, review); err != nil {
-		return nil, http.StatusBadRequest, fmt.Errorf("could not deserialize request to review object: %v", err)
+	if _, _, err := k8sdecode.Decode(data, nil, review); err != nil {
+		return nil, fmt.Errorf("could not deserialize request to review object: %v", err)
 	} else if review.Request == nil {
-		return nil, http.StatusBadRequest, errors.New("review parsed but request is null")
+		return nil, errors.New("review parsed but request is null")
+	} else if !isSupportedAdmissionReview(review.TypeMeta) {
+		return nil, fmt.Errorf("unsupported review %s, supported versions are %s", review.GroupVersionKind(), strings.Join(AdmissionReviewVersions, ", "))
 	}
 
-	return review, http.StatusOK, nil
+	return review, nil
+}
+
+// isSupportedAdmissionReview returns true if the type is an AdmissionReview
+// of one of the AdmissionReviewVersions
+func isSupportedAdmissionReview(typeMeta metav1.TypeMeta) bool {
+	if typeMeta.Kind != "AdmissionReview" {
+		return false
+	}
+
+	for _, v := range AdmissionReviewVersions {
+		if typeMeta.APIVersion == v {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (h *RequestsHandler) lookupPod(namespace string, pod *corev1.Pod) (*inject.PatchGenerator, error) {
-	namespaceObj, err := h.clientset.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	generator, _, err := h.resolvePod(namespace, pod)
+	return generator, err
+}
+
+// resolvePod returns the patch generator for the pod, or the reason why the
+// pod is skipped when the generator is nil
+func (h *RequestsHandler) resolvePod(namespace string, pod *corev1.Pod) (*inject.PatchGenerator, Reason, error) {
+	span := h.startSpan("select strategy")
+	generator, reason, err := h.selectPodGenerator(namespace, pod)
+	endSelection(span, generator, reason, err)
+	return generator, reason, err
+}
+
+// selectPodGenerator selects the timezone, the strategy and the other
+// settings of the injection of the pod
+func (h *RequestsHandler) selectPodGenerator(namespace string, pod *corev1.Pod) (*inject.PatchGenerator, Reason, error) {
+	namespaceObj, err := h.getNamespace(namespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup pod's namespace (%s): %v", formatObjectDetails(pod.ObjectMeta), err)
+		return nil, "", withReason(ReasonLookupFailed, "failed to lookup pod's namespace (%s): %v", formatObjectDetails(pod.ObjectMeta), err)
+	}
+
+	if reason, rule, err := h.selectObject(namespaceObj, &pod.ObjectMeta); err != nil || reason != "" {
+		if err == nil {
+			h.skip(reason, "skipping pod (%s) because %s", formatObjectDetails(pod.ObjectMeta), rule)
+		}
+		return nil, reason, err
 	}
 
 	if _, ok := pod.Annotations[k8tz.InjectedAnnotation]; ok {
-		infoLogger.Printf("skipping pod (%s) because its already injected", formatObjectDetails(pod.ObjectMeta))
-		return nil, nil
+		h.skip(ReasonAlreadyInjected, "skipping pod (%s) because its already injected", formatObjectDetails(pod.ObjectMeta))
+		return nil, ReasonAlreadyInjected, nil
 	}
 
-	if val, ok := pod.Annotations[k8tz.InjectAnnotation]; ok {
-		if val == "false" {
-			infoLogger.Printf("skipping pod (%s) because annotation on pod is explicitly false for injection", formatObjectDetails(pod.ObjectMeta))
-			return nil, nil
+	policy := h.matchingTimezonePolicy(namespaceObj, pod)
+	resolved := &settings{
+		kind:      "pod",
+		object:    pod.Annotations,
+		namespace: namespaceObj.Annotations,
+		policy:    policy,
+	}
+
+	if h.CronJobOwners {
+		resolved.controller = func() (map[string]string, error) {
+			annotations, err := h.ownerAnnotations(&pod.ObjectMeta)
+			if err != nil {
+				return nil, withReason(ReasonLookupFailed, "failed to lookup the cronjob of pod (%s): %v", formatObjectDetails(pod.ObjectMeta), err)
+			}
+
+			return annotations, nil
 		}
-	} else if val, ok := namespaceObj.Annotations[k8tz.InjectAnnotation]; ok {
-		if val == "false" {
-			infoLogger.Printf("skipping pod (%s) because annotation on namespace is explicitly false for injection", formatObjectDetails(pod.ObjectMeta))
-			return nil, nil
+	}
+
+	injected, level, err := resolved.injection(h.InjectByDefault)
+	if err != nil {
+		return nil, "", fmt.Errorf("pod (%s): %w", formatObjectDetails(pod.ObjectMeta), err)
+	}
+
+	if !injected {
+		h.skip(ReasonDisabled, "skipping pod (%s) because injection is disabled by the %s", formatObjectDetails(pod.ObjectMeta), resolved.describe(level))
+		return nil, ReasonDisabled, nil
+	}
+
+	if h.ConflictPolicy == inject.ConflictSkip {
+		if conflicts := inject.Conflicts(&pod.Spec); len(conflicts) > 0 {
+			h.skip(ReasonConflict, "skipping pod (%s) because it already has %s", formatObjectDetails(pod.ObjectMeta), strings.Join(conflicts, ", "))
+			return nil, ReasonConflict, nil
+		}
+	}
+
+	timezone, level, err := resolved.timezone(h.DefaultTimezone)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if level != LevelDefault {
+		infoLogger.Printf("explicit timezone requested by the %s of pod (%s): %s", resolved.describe(level), formatObjectDetails(pod.ObjectMeta), timezone)
+	}
+
+	if timezone == "" {
+		if timezone, err = h.missingTimezone("pod", formatObjectDetails(pod.ObjectMeta)); timezone == "" {
+			return nil, ReasonNoTimezone, err
+		}
+	}
+
+	if timezone == k8tz.AutoTimezone {
+		if timezone, err = h.resolveAutoTimezone(&pod.Spec, "pod", formatObjectDetails(pod.ObjectMeta)); timezone == "" {
+			return nil, ReasonNoTimezone, err
 		}
-	} else if !h.InjectByDefault {
-		infoLogger.Printf("skipping pod (%s) because no other instruction and injection disabled by default", formatObjectDetails(pod.ObjectMeta))
-		return nil, nil
 	}
 
-	timezone := h.DefaultTimezone
-	if val, ok := pod.Annotations[k8tz.TimezoneAnnotation]; ok {
-		timezone = val
-		infoLogger.Printf("explicit timezone requested on pod's (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), val)
-	} else if val, ok := namespaceObj.Annotations[k8tz.TimezoneAnnotation]; ok {
-		timezone = val
-		infoLogger.Printf("explicit timezone requested on namespace (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), val)
+	if timezone, err = h.canonicalTimezone(timezone, "pod", formatObjectDetails(pod.ObjectMeta)); err != nil {
+		return nil, "", err
 	}
 
-	strategy := h.DefaultInjectionStrategy
-	if v, e := pod.Annotations[k8tz.InjectionStrategyAnnotation]; e {
-		strategy = inject.InjectionStrategy(v)
-		infoLogger.Printf("explicit injection strategy requested on pod's (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), v)
-	} else if v, e := namespaceObj.Annotations[k8tz.InjectionStrategyAnnotation]; e {
-		strategy = inject.InjectionStrategy(v)
-		infoLogger.Printf("explicit injection strategy requested on namespace (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), v)
+	if err := checkTimezonePolicy(timezone); err != nil {
+		return nil, "", err
+	}
+
+	h.warnUnknownTimezone(timezone, "pod", formatObjectDetails(pod.ObjectMeta))
+	h.warnExistingTimezone(pod)
+
+	containerTimezones, err := h.containerTimezones(pod)
+	if err != nil {
+		return nil, "", err
+	}
+
+	locale, err := h.locale(policy, namespaceObj, &pod.ObjectMeta, "pod")
+	if err != nil {
+		return nil, "", err
+	}
+
+	strategy, level, err := resolved.strategy(h.DefaultInjectionStrategy)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if level != LevelDefault {
+		infoLogger.Printf("explicit injection strategy requested by the %s of pod (%s): %s", resolved.describe(level), formatObjectDetails(pod.ObjectMeta), strategy)
+	}
+
+	strategy = h.compatibleStrategy(pod, namespaceObj, strategy)
+
+	faketime, err := h.faketime(strategy, namespaceObj, &pod.ObjectMeta, "pod")
+	if err != nil {
+		return nil, "", err
+	}
+
+	format := h.TimezoneFormat
+	if v, e := pod.Annotations[k8tz.TimezoneFormatAnnotation]; e {
+		format = inject.TimezoneFormat(v)
+		infoLogger.Printf("explicit timezone format requested on pod's (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), v)
+	} else if v, e := namespaceObj.Annotations[k8tz.TimezoneFormatAnnotation]; e {
+		format = inject.TimezoneFormat(v)
+		infoLogger.Printf("explicit timezone format requested on namespace (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), v)
+	}
+
+	hostPath, err := h.hostPathPrefix(pod, namespaceObj)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tzdir := inject.DefaultTzdir
+	if v, e := pod.Annotations[k8tz.TzdirAnnotation]; e {
+		tzdir = v
+	} else if v, e := namespaceObj.Annotations[k8tz.TzdirAnnotation]; e {
+		tzdir = v
+	}
+
+	bootstrap, err := h.bootstrap(policy, namespaceObj, "pod", formatObjectDetails(pod.ObjectMeta))
+	if err != nil {
+		return nil, "", err
 	}
 
 	return &inject.PatchGenerator{
 		Strategy:           strategy,
 		Timezone:           timezone,
-		InitContainerImage: h.BootstrapImage,
-		HostPathPrefix:     h.HostPathPrefix,
+		InitContainerImage: bootstrap.image,
+		HostPathPrefix:     hostPath,
+		HostPathType:       h.HostPathType,
+		CSIDriver:          h.CSIDriver,
+		CSIZoneInfoPath:    h.CSIZoneInfoPath,
 		LocalTimePath:      h.LocalTimePath,
-	}, nil
+		BootstrapSidecar:   h.BootstrapSidecar && h.nativeSidecars,
+		PodSecurityLevel:   h.podSecurityLevel(namespaceObj),
+		PodSecurityAction:  h.PodSecurityAction,
+
+		InitContainerImagePullPolicy:  h.BootstrapImagePullPolicy,
+		InitContainerArchImages:       bootstrap.archImages,
+		InitContainerResources:        h.BootstrapResources,
+		InitContainerSecurityContext:  h.BootstrapSecurity,
+		InitContainerImagePullSecrets: bootstrap.pullSecrets,
+		CSIVolumeAttributes:           h.CSIVolumeAttributes,
+		TimezoneFormat:                format,
+		ZoneInfoPath:                  h.ZoneInfoPath,
+		ExtraEnv:                      h.ExtraEnv,
+		AnnotateOffset:                h.AnnotateOffset,
+		ContainerTimezones:            containerTimezones,
+		TzdataVersion:                 h.TzdataVersion,
+		Locale:                        locale,
+		ConflictPolicy:                h.ConflictPolicy,
+		Tzdir:                         tzdir,
+		Faketime:                      faketime,
+		FaketimeLibrary:               h.FaketimeLibrary,
+	}, "", nil
+}
+
+// containerTimezones returns the timezones of single containers requested on
+// the pod's annotation, every one of them must be allowed by the timezone
+// policy
+func (h *RequestsHandler) containerTimezones(pod *corev1.Pod) (map[string]string, error) {
+	val, ok := pod.Annotations[k8tz.ContainerTimezonesAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	timezones, err := inject.ParseContainerTimezones(val)
+	if err != nil {
+		return nil, withReason(ReasonInvalidObject, "invalid %s annotation on pod (%s): %v", k8tz.ContainerTimezonesAnnotation, formatObjectDetails(pod.ObjectMeta), err)
+	}
+
+	names := map[string]bool{}
+	for _, c := range pod.Spec.Containers {
+		names[c.Name] = true
+	}
+
+	for _, c := range pod.Spec.EphemeralContainers {
+		names[c.Name] = true
+	}
+
+	for name, timezone := range timezones {
+		if !names[name] {
+			h.warn("pod (%s) requests timezone %s for unknown container %s", formatObjectDetails(pod.ObjectMeta), timezone, name)
+		}
+
+		if timezone == k8tz.AutoTimezone {
+			return nil, withReason(ReasonInvalidTimezone, "pod (%s) requests the %s timezone for container %s, it can only be requested for the whole pod with the %s annotation", formatObjectDetails(pod.ObjectMeta), k8tz.AutoTimezone, name, k8tz.TimezoneAnnotation)
+		}
+
+		timezone, err := h.canonicalTimezone(timezone, "container "+name, formatObjectDetails(pod.ObjectMeta))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkTimezonePolicy(timezone); err != nil {
+			return nil, err
+		}
+
+		timezones[name] = timezone
+		h.warnUnknownTimezone(timezone, "container "+name, formatObjectDetails(pod.ObjectMeta))
+	}
+
+	infoLogger.Printf("explicit container timezones requested on pod's (%s) annotation: %s", formatObjectDetails(pod.ObjectMeta), val)
+	return timezones, nil
+}
+
+// locale returns the locale of the object, from its annotation, the annotation
+// of its namespace, the timezone policy or the default locale, in that order
+func (h *RequestsHandler) locale(policy *v1alpha1.TimezonePolicy, namespace *corev1.Namespace, meta *metav1.ObjectMeta, kind string) (string, error) {
+	locale := h.DefaultLocale
+	if policy != nil && policy.Spec.Locale != "" {
+		locale = policy.Spec.Locale
+	}
+
+	if val, ok := meta.Annotations[k8tz.LocaleAnnotation]; ok {
+		locale = val
+		infoLogger.Printf("explicit locale requested on %s's (%s) annotation: %s", kind, formatObjectDetails(*meta), val)
+	} else if val, ok := namespace.Annotations[k8tz.LocaleAnnotation]; ok {
+		locale = val
+		infoLogger.Printf("explicit locale requested on namespace (%s) annotation: %s", formatObjectDetails(*meta), val)
+	}
+
+	if locale == "" {
+		return "", nil
+	}
+
+	if err := inject.ValidateLocale(locale); err != nil {
+		return "", withReason(ReasonInvalidLocale, "invalid locale of %s (%s): %v", kind, formatObjectDetails(*meta), err)
+	}
+
+	return locale, nil
+}
+
+// faketime returns the fake time of the faketime strategy, from the
+// annotation of the object or of its namespace. The annotation is ignored with
+// a warning by the other strategies.
+func (h *RequestsHandler) faketime(strategy inject.InjectionStrategy, namespace *corev1.Namespace, meta *metav1.ObjectMeta, kind string) (string, error) {
+	val, ok := meta.Annotations[k8tz.FaketimeAnnotation]
+	if !ok {
+		val, ok = namespace.Annotations[k8tz.FaketimeAnnotation]
+	}
+
+	if strategy != inject.FaketimeInjectionStrategy {
+		if ok {
+			h.warn("%s (%s) requests fake time %q, it is ignored by the %s strategy", kind, formatObjectDetails(*meta), val, strategy)
+		}
+
+		return "", nil
+	}
+
+	if !ok {
+		return "", withReason(ReasonInvalidObject, "%s (%s) uses the %s strategy without the %s annotation", kind, formatObjectDetails(*meta), strategy, k8tz.FaketimeAnnotation)
+	}
+
+	if err := inject.ValidateFaketime(val); err != nil {
+		return "", withReason(ReasonInvalidObject, "invalid fake time of %s (%s): %v", kind, formatObjectDetails(*meta), err)
+	}
+
+	infoLogger.Printf("%s (%s) runs with fake time %q", kind, formatObjectDetails(*meta), val)
+	return val, nil
+}
+
+// podSecurityLevel returns the pod security standard enforced on the
+// namespace, or the configured default level if it is not labeled
+func (h *RequestsHandler) podSecurityLevel(namespace *corev1.Namespace) inject.PodSecurityLevel {
+	if level, ok := namespace.Labels[podSecurityEnforceLabel]; ok {
+		return inject.PodSecurityLevel(level)
+	}
+
+	return h.PodSecurityLevel
+}
+
+// compatibleStrategy adjusts the injection strategy for pods that cannot use
+// it: pods in host namespaces (hostNetwork/hostPID/hostIPC) use the
+// HostNamespacesStrategy if configured, and hostPath volumes are replaced by
+// initContainer in namespaces that enforce the baseline or restricted pod
+// security standards since such pods would be rejected anyway, or when
+// HostPathNodeLabel is set and the pod is not pinned to nodes with the label.
+// The sidecar strategy falls back to initContainer when the cluster does not
+// support native sidecars.
+func (h *RequestsHandler) compatibleStrategy(pod *corev1.Pod, namespace *corev1.Namespace, strategy inject.InjectionStrategy) inject.InjectionStrategy {
+	if inject.IsWindowsPod(&pod.Spec) {
+		if strategy != inject.WindowsInjectionStrategy {
+			infoLogger.Printf("pod (%s) runs on windows nodes, changing injection strategy from %s to %s", formatObjectDetails(pod.ObjectMeta), strategy, inject.WindowsInjectionStrategy)
+		}
+
+		return inject.WindowsInjectionStrategy
+	}
+
+	if h.HostNamespacesStrategy != "" && strategy != h.HostNamespacesStrategy &&
+		(pod.Spec.HostNetwork || pod.Spec.HostPID || pod.Spec.HostIPC) {
+		infoLogger.Printf("pod (%s) uses host namespaces, changing injection strategy from %s to %s", formatObjectDetails(pod.ObjectMeta), strategy, h.HostNamespacesStrategy)
+		strategy = h.HostNamespacesStrategy
+	}
+
+	if strategy == inject.HostPathInjectionStrategy {
+		switch level := namespace.Labels[podSecurityEnforceLabel]; level {
+		case "baseline", "restricted":
+			h.warn("namespace of pod (%s) enforces %s pod security standard which forbids hostPath volumes, changing injection strategy to %s", formatObjectDetails(pod.ObjectMeta), level, inject.InitContainerInjectionStrategy)
+			strategy = inject.InitContainerInjectionStrategy
+		}
+	}
+
+	if strategy == inject.HostPathInjectionStrategy && h.HostPathNodeLabel != "" {
+		if ok, err := h.hostPathNodes(&pod.Spec); err != nil {
+			h.warn("cannot check the nodes of pod (%s) for the %s label, changing injection strategy to %s: %v", formatObjectDetails(pod.ObjectMeta), h.HostPathNodeLabel, inject.InitContainerInjectionStrategy, err)
+			strategy = inject.InitContainerInjectionStrategy
+		} else if !ok {
+			infoLogger.Printf("pod (%s) is not pinned to nodes with the %s label, changing injection strategy to %s", formatObjectDetails(pod.ObjectMeta), h.HostPathNodeLabel, inject.InitContainerInjectionStrategy)
+			strategy = inject.InitContainerInjectionStrategy
+		}
+	}
+
+	if strategy == inject.SidecarInjectionStrategy && !h.nativeSidecars {
+		h.warn("kubernetes does not support native sidecars, changing injection strategy of pod (%s) to %s", formatObjectDetails(pod.ObjectMeta), inject.InitContainerInjectionStrategy)
+		strategy = inject.InitContainerInjectionStrategy
+	}
+
+	return strategy
 }
 
 func (h *RequestsHandler) lookupCronJob(namespace string, cronJob *batchv1.CronJob) (*inject.PatchGenerator, error) {
-	namespaceObj, err := h.clientset.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	span := h.startSpan("select strategy")
+	generator, err := h.selectCronJobGenerator(namespace, cronJob)
+	endSelection(span, generator, "", err)
+	return generator, err
+}
+
+// selectCronJobGenerator selects the timezone and the other settings of the
+// injection of the cronJob
+func (h *RequestsHandler) selectCronJobGenerator(namespace string, cronJob *batchv1.CronJob) (*inject.PatchGenerator, error) {
+	namespaceObj, err := h.getNamespace(namespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to lookup cronJob's namespace (%s): %v", formatObjectDetails(cronJob.ObjectMeta), err)
+		return nil, withReason(ReasonLookupFailed, "failed to lookup cronJob's namespace (%s): %v", formatObjectDetails(cronJob.ObjectMeta), err)
+	}
+
+	if reason, rule, err := h.selectObject(namespaceObj, &cronJob.ObjectMeta); err != nil || reason != "" {
+		if err == nil {
+			h.skip(reason, "skipping cronJob (%s) because %s", formatObjectDetails(cronJob.ObjectMeta), rule)
+		}
+		return nil, err
 	}
 
 	if _, ok := cronJob.Annotations[k8tz.InjectedAnnotation]; ok {
-		infoLogger.Printf("skipping cronJob (%s) because its already injected", formatObjectDetails(cronJob.ObjectMeta))
+		h.skip(ReasonAlreadyInjected, "skipping cronJob (%s) because its already injected", formatObjectDetails(cronJob.ObjectMeta))
 		return nil, nil
 	}
 
-	if val, ok := cronJob.Annotations[k8tz.InjectAnnotation]; ok {
-		if val == "false" {
-			infoLogger.Printf("skipping cronJob (%s) because annotation on cronJob is explicitly false for injection", formatObjectDetails(cronJob.ObjectMeta))
+	// the policy is matched against the pods of the cronJob, with the labels
+	// of its job template
+	policy := h.matchingTimezonePolicy(namespaceObj, templatePod(&cronJob.ObjectMeta, &cronJob.Spec.JobTemplate.Spec.Template))
+	resolved := &settings{
+		kind:      "cronJob",
+		object:    cronJob.Annotations,
+		namespace: namespaceObj.Annotations,
+		policy:    policy,
+	}
+
+	injected, level, err := resolved.injection(h.InjectByDefault)
+	if err != nil {
+		return nil, fmt.Errorf("cronJob (%s): %w", formatObjectDetails(cronJob.ObjectMeta), err)
+	}
+
+	if !injected {
+		h.skip(ReasonDisabled, "skipping cronJob (%s) because injection is disabled by the %s", formatObjectDetails(cronJob.ObjectMeta), resolved.describe(level))
+		return nil, nil
+	}
+
+	if h.ConflictPolicy == inject.ConflictSkip && h.CronJobTimeZone && h.cronJobMode() == inject.TemplateCronJobMode {
+		if conflicts := inject.Conflicts(&cronJob.Spec.JobTemplate.Spec.Template.Spec); len(conflicts) > 0 {
+			h.skip(ReasonConflict, "skipping cronJob (%s) because its job template already has %s", formatObjectDetails(cronJob.ObjectMeta), strings.Join(conflicts, ", "))
 			return nil, nil
 		}
-	} else if val, ok := namespaceObj.Annotations[k8tz.InjectAnnotation]; ok {
-		if val == "false" {
-			infoLogger.Printf("skipping cronJob (%s) because annotation on namespace is explicitly false for injection", formatObjectDetails(cronJob.ObjectMeta))
-			return nil, nil
+	}
+
+	timezone, level, err := resolved.timezone(h.DefaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if level != LevelDefault {
+		infoLogger.Printf("explicit timezone requested by the %s of cronJob (%s): %s", resolved.describe(level), formatObjectDetails(cronJob.ObjectMeta), timezone)
+	}
+
+	if timezone == "" {
+		if timezone, err = h.missingTimezone("cronJob", formatObjectDetails(cronJob.ObjectMeta)); timezone == "" {
+			return nil, err
+		}
+	}
+
+	if timezone == k8tz.AutoTimezone {
+		if timezone, err = h.resolveAutoTimezone(&cronJob.Spec.JobTemplate.Spec.Template.Spec, "cronJob", formatObjectDetails(cronJob.ObjectMeta)); timezone == "" {
+			return nil, err
 		}
-	} else if !h.InjectByDefault {
-		infoLogger.Printf("skipping cronJob (%s) because no other instruction and injection disabled by default", formatObjectDetails(cronJob.ObjectMeta))
-		return nil, nil
 	}
 
-	timezone := h.DefaultTimezone
-	if val, ok := cronJob.Annotations[k8tz.TimezoneAnnotation]; ok {
-		timezone = val
-		infoLogger.Printf("explicit timezone requested on cronJob's (%s) annotation: %s", formatObjectDetails(cronJob.ObjectMeta), val)
-	} else if val, ok := namespaceObj.Annotations[k8tz.TimezoneAnnotation]; ok {
-		timezone = val
-		infoLogger.Printf("explicit timezone requested on namespace (%s) annotation: %s", formatObjectDetails(cronJob.ObjectMeta), val)
+	if timezone, err = h.canonicalTimezone(timezone, "cronJob", formatObjectDetails(cronJob.ObjectMeta)); err != nil {
+		return nil, err
 	}
 
-	return &inject.PatchGenerator{
+	if err := checkTimezonePolicy(timezone); err != nil {
+		return nil, err
+	}
+
+	h.warnUnknownTimezone(timezone, "cronJob", formatObjectDetails(cronJob.ObjectMeta))
+
+	locale, err := h.locale(policy, namespaceObj, &cronJob.ObjectMeta, "cronJob")
+	if err != nil {
+		return nil, err
+	}
+
+	faketime, err := h.faketime(h.DefaultInjectionStrategy, namespaceObj, &cronJob.ObjectMeta, "cronJob")
+	if err != nil {
+		return nil, err
+	}
+
+	bootstrap, err := h.bootstrap(policy, namespaceObj, "cronJob", formatObjectDetails(cronJob.ObjectMeta))
+	if err != nil {
+		return nil, err
+	}
+
+	generator := &inject.PatchGenerator{
 		Strategy:           h.DefaultInjectionStrategy,
 		Timezone:           timezone,
-		InitContainerImage: h.BootstrapImage,
+		InitContainerImage: bootstrap.image,
 		HostPathPrefix:     h.HostPathPrefix,
+		HostPathType:       h.HostPathType,
+		CSIDriver:          h.CSIDriver,
+		CSIZoneInfoPath:    h.CSIZoneInfoPath,
 		LocalTimePath:      h.LocalTimePath,
 		CronJobTimeZone:    h.CronJobTimeZone,
-	}, nil
+		CronJobMode:        h.cronJobMode(),
+		ZoneInfoPath:       h.ZoneInfoPath,
+		AnnotateOffset:     h.AnnotateOffset,
+
+		InitContainerImagePullPolicy:  h.BootstrapImagePullPolicy,
+		InitContainerResources:        h.BootstrapResources,
+		InitContainerSecurityContext:  h.BootstrapSecurity,
+		InitContainerImagePullSecrets: bootstrap.pullSecrets,
+		CSIVolumeAttributes:           h.CSIVolumeAttributes,
+		Locale:                        locale,
+		ConflictPolicy:                h.ConflictPolicy,
+		Faketime:                      faketime,
+		FaketimeLibrary:               h.FaketimeLibrary,
+	}
+
+	if h.RewriteCronJobSchedules && h.CronJobTimeZone && generator.CronJobMode == inject.TemplateCronJobMode {
+		h.rewriteSchedule(generator, cronJob)
+	}
+
+	return generator, nil
 }
 
 func (h *RequestsHandler) handlePodAdmissionRequest(req *admission.AdmissionRequest) (k8tz.Patches, error) {
 	raw := req.Object.Raw
 	pod := corev1.Pod{}
 	if _, _, err := k8sdecode.Decode(raw, nil, &pod); err != nil {
-		return nil, fmt.Errorf("could not deserialize pod object: %v", err)
+		return nil, withReason(ReasonInvalidObject, "could not deserialize pod object: %v", err)
+	}
+
+	if h.Reinvocation && isInjected(&pod.ObjectMeta) {
+		return h.reinvokePod(req.Namespace, &pod)
 	}
 
 	generator, err := h.lookupPod(req.Namespace, &pod)
@@ -297,12 +1312,16 @@ func (h *RequestsHandler) handlePodAdmissionRequest(req *admission.AdmissionRequ
 
 	var patches k8tz.Patches
 	if generator != nil {
-		verboseLogger.Printf("Generating patches for pod (%s) using generator: %+v", formatObjectDetails(pod.ObjectMeta), *generator)
+		h.verbosef("Generating patches for pod (%s) using generator: %+v", formatObjectDetails(pod.ObjectMeta), *generator)
+		h.recordInjection(generator)
+		done := h.startGeneration()
 		patches, err = generator.Generate(&pod, "")
+		done(err)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate patches for pod, error=%w", err)
 		}
 
+		countInjection("Pod", req.Namespace)
 		infoLogger.Printf("%d patches generated for pod (%s), timezone=%s, strategy=%s", len(patches), formatObjectDetails(pod.ObjectMeta), generator.Timezone, generator.Strategy)
 	}
 
@@ -313,7 +1332,7 @@ func (h *RequestsHandler) handleCronJobAdmissionRequest(req *admission.Admission
 	raw := req.Object.Raw
 	cronJob := batchv1.CronJob{}
 	if _, _, err := k8sdecode.Decode(raw, nil, &cronJob); err != nil {
-		return nil, fmt.Errorf("could not deserialize cronJob object: %v", err)
+		return nil, withReason(ReasonInvalidObject, "could not deserialize cronJob object: %v", err)
 	}
 
 	generator, err := h.lookupCronJob(req.Namespace, &cronJob)
@@ -323,13 +1342,17 @@ func (h *RequestsHandler) handleCronJobAdmissionRequest(req *admission.Admission
 
 	var patches k8tz.Patches
 	if generator != nil {
-		verboseLogger.Printf("Generating patches for cronJob (%s) using generator: %+v", formatObjectDetails(cronJob.ObjectMeta), *generator)
+		h.verbosef("Generating patches for cronJob (%s) using generator: %+v", formatObjectDetails(cronJob.ObjectMeta), *generator)
+		h.recordInjection(generator)
+		done := h.startGeneration()
 		patches, err = generator.Generate(&cronJob, "")
+		done(err)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate patches for pod, error=%w", err)
 		}
 
-		infoLogger.Printf("%d patches generated for cronJob (%s), timezone=%s", len(patches), formatObjectDetails(cronJob.ObjectMeta), generator.Timezone)
+		countInjection("CronJob", req.Namespace)
+		infoLogger.Printf("%d patches generated for cronJob (%s), timezone=%s, mode=%s", len(patches), formatObjectDetails(cronJob.ObjectMeta), generator.Timezone, generator.CronJobMode)
 	}
 
 	return patches, err
@@ -342,3 +1365,19 @@ func formatObjectDetails(objectMeta metav1.ObjectMeta) string {
 
 	return fmt.Sprintf("namespace=%s, name=%s", objectMeta.Namespace, objectMeta.Name)
 }
+
+// SetClientset sets the kubernetes client used to lookup namespaces
+func (h *RequestsHandler) SetClientset(clientset kubernetes.Interface) {
+	h.clientset = clientset
+}
+
+// Decide returns the patch generator the webhook would use for the pod, or nil
+// if the pod would not be injected. It is used by tools that compare the live
+// state of the cluster with the current policy.
+func (h *RequestsHandler) Decide(namespace string, pod *corev1.Pod) (*inject.PatchGenerator, error) {
+	if h.isExcludedNamespace(namespace) {
+		return nil, nil
+	}
+
+	return h.lookupPod(namespace, pod)
+}
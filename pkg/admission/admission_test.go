@@ -18,19 +18,61 @@ package admission
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/apis/v1alpha1"
 	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/registry"
+	"github.com/k8tz/k8tz/pkg/tzdata"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	cliflag "k8s.io/component-base/cli/flag"
 )
 
 var updateGoldens = false
@@ -50,6 +92,11 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 		FakeObjects              []runtime.Object
 		WantCode                 int
 		CronJobTimeZone          bool
+		InjectWorkloads          bool
+		TemplatePaths            TemplatePaths
+		InstallNamespace         string
+		ExcludeInstallNamespace  bool
+		MaxRequestBytes          int64
 	}
 	tests := []struct {
 		name   string
@@ -72,6 +119,44 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 				WantCode:                 http.StatusOK,
 			},
 		},
+		{
+			name: "pod in k8tz install namespace should be skipped",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-pod.json",
+				GoldenFile:               "testdata/review-pod-skipped-install-namespace.json",
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+				WantCode:                 http.StatusOK,
+				InstallNamespace:         "default",
+				ExcludeInstallNamespace:  true,
+			},
+		},
+		{
+			name: "pod in k8tz install namespace should be injected when exclusion is disabled",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-pod.json",
+				GoldenFile:               "testdata/review-pod-golden.json",
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+				WantCode:                 http.StatusOK,
+				InstallNamespace:         "default",
+				ExcludeInstallNamespace:  false,
+			},
+		},
 		{
 			name: "request with wrong method: get",
 			fields: fields{
@@ -88,6 +173,23 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 				WantCode:                 http.StatusMethodNotAllowed,
 			},
 		},
+		{
+			name: "request body over the limit",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-pod.json",
+				GoldenFile:               "",
+				WantCode:                 http.StatusRequestEntityTooLarge,
+				MaxRequestBytes:          1024,
+			},
+		},
 		{
 			name: "request with wrong content type: text/plain",
 			fields: fields{
@@ -120,6 +222,38 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 				WantCode:                 http.StatusOK,
 			},
 		},
+		{
+			name: "unexpected resource kind as service should be ignored",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-service.json",
+				GoldenFile:               "testdata/review-service-ignored.json",
+				WantCode:                 http.StatusOK,
+			},
+		},
+		{
+			name: "pod subresource should be ignored",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-pod-binding.json",
+				GoldenFile:               "testdata/review-pod-binding-ignored.json",
+				WantCode:                 http.StatusOK,
+			},
+		},
 		{
 			name: "cronjob request should be handled when feature enabled",
 			fields: fields{
@@ -168,6 +302,165 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "deployment template should be injected with the timezone of the template annotation",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-deployment.json",
+				GoldenFile:               "testdata/review-deployment-injected.json",
+				WantCode:                 http.StatusOK,
+				InjectWorkloads:          true,
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "deployment should be ignored when workload injection is disabled",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-deployment.json",
+				GoldenFile:               "testdata/review-deployment-ignored.json",
+				WantCode:                 http.StatusOK,
+				InjectWorkloads:          false,
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "job should be skipped when injection is disabled by its annotation",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-job.json",
+				GoldenFile:               "testdata/review-job-skipped.json",
+				WantCode:                 http.StatusOK,
+				InjectWorkloads:          true,
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "custom resource should be injected at its template path",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-custom-resource.json",
+				GoldenFile:               "testdata/review-custom-resource-injected.json",
+				WantCode:                 http.StatusOK,
+				TemplatePaths:            TemplatePaths{"pipelines.example.com": {"spec.runner.template"}},
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "custom resource without template at the path should be allowed",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-custom-resource.json",
+				GoldenFile:               "testdata/review-custom-resource-ignored.json",
+				WantCode:                 http.StatusOK,
+				TemplatePaths:            TemplatePaths{"pipelines.example.com": {"spec.template"}},
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "custom resource without template path should be ignored",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-custom-resource.json",
+				GoldenFile:               "testdata/review-custom-resource-ignored.json",
+				WantCode:                 http.StatusOK,
+				TemplatePaths:            TemplatePaths{"workflows.example.com": {"spec.runner.template"}},
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			},
+		},
+		{
+			name: "containers should be injected with the timezones of the container timezones annotation",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-container-timezones-pod.json",
+				GoldenFile:               "testdata/review-container-timezones-pod-response.json",
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+				WantCode:                 http.StatusOK,
+			},
+		},
+		{
+			name: "new ephemeral containers of injected pod should be injected",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-ephemeral-containers.json",
+				GoldenFile:               "testdata/review-ephemeral-containers-response.json",
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+				WantCode:                 http.StatusOK,
+			},
+		},
+		{
+			name: "ephemeral containers of not injected pod should be ignored",
+			fields: fields{
+				DefaultTimezone:          pkg.UTCTimezone,
+				BootstrapImage:           "test:0.0.0",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				HostPathPrefix:           "/usr/share/zoneinfo",
+				LocalTimePath:            "/etc/localtime",
+				ContentType:              "application/json",
+				Method:                   "POST",
+				ReviewFile:               "testdata/review-ephemeral-containers-not-injected.json",
+				GoldenFile:               "testdata/review-ephemeral-containers-not-injected-response.json",
+				FakeObjects:              []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+				WantCode:                 http.StatusOK,
+			},
+		},
 		{
 			name: "unparsable review should be considered bad request",
 			fields: fields{
@@ -495,6 +788,11 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 				HostPathPrefix:           tt.fields.HostPathPrefix,
 				LocalTimePath:            tt.fields.LocalTimePath,
 				CronJobTimeZone:          tt.fields.CronJobTimeZone,
+				InjectWorkloads:          tt.fields.InjectWorkloads,
+				TemplatePaths:            tt.fields.TemplatePaths,
+				InstallNamespace:         tt.fields.InstallNamespace,
+				ExcludeInstallNamespace:  tt.fields.ExcludeInstallNamespace,
+				MaxRequestBytes:          tt.fields.MaxRequestBytes,
 				clientset:                fake.NewSimpleClientset(tt.fields.FakeObjects...),
 			}
 
@@ -530,47 +828,6681 @@ func TestAdmissionRequestsHandler_handleFunc(t *testing.T) {
 	}
 }
 
-func compareReviews(got *bytes.Buffer, goldenFile string) error {
-	golden, exists, err := readGolden(goldenFile)
+func TestRequestsHandler_handleFunc_tracing(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	h := &RequestsHandler{
+		DefaultTimezone:          "Europe/Amsterdam",
+		DefaultInjectionStrategy: inject.HostPathInjectionStrategy,
+		InjectByDefault:          true,
+		HostPathPrefix:           inject.DefaultHostPathPrefix,
+		LocalTimePath:            inject.DefaultLocalTimePath,
+		clientset:                fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}),
+	}
+
+	data, err := os.ReadFile("testdata/review-pod.json")
 	if err != nil {
-		return fmt.Errorf("golden file: %s, exists: %t, err: %v", goldenFile, exists, err)
+		t.Fatal(err)
 	}
 
-	if !exists || updateGoldens {
-		f, err := os.Create(goldenFile)
-		if err != nil {
-			return fmt.Errorf("failed to create golden file: %s, error: %v", goldenFile, err)
-		}
+	// the trace context of the api server
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	req.Header.Set("Content-Type", jsonContentType)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
 
-		defer f.Close()
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.handleFunc).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handleFunc() status = %d: %s", rr.Code, rr.Body)
+	}
 
-		_, err = f.Write(got.Bytes())
-		if err != nil {
-			return fmt.Errorf("failed to write golden file: %s, error: %v", goldenFile, err)
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	review, ok := spans["admission review"]
+	if !ok {
+		t.Fatalf("spans = %v, want an admission review span", spans)
+	}
+
+	if got := review.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace of the review = %s, want the trace of the api server %s", got, traceID)
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range review.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+
+	if got := attributes["k8tz.review.uid"].AsString(); got != "0c0829ff-c2f5-4634-a1c3-098147304d03" {
+		t.Errorf("uid attribute = %q, want the uid of the review", got)
+	}
+
+	if !attributes["k8tz.review.allowed"].AsBool() || attributes["k8tz.review.patches"].AsInt64() == 0 {
+		t.Errorf("attributes = %v, want an allowed review with patches", attributes)
+	}
+
+	for _, name := range []string{"decode", "select strategy", "generate patches", "serialize"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("missing span %q, spans = %v", name, spans)
+			continue
 		}
-	} else {
-		hyps := got.String()
-		refs := *golden
-		if refs != hyps {
-			return fmt.Errorf("actual: %v, want: %v", hyps, refs)
+
+		if span.Parent().SpanID() != review.SpanContext().SpanID() {
+			t.Errorf("span %q is not a child of the review span", name)
 		}
 	}
 
-	return nil
-}
-
-func readGolden(file string) (*string, bool, error) {
-	if _, err := os.Stat(file); err == nil {
-		data, err := os.ReadFile(file)
-		if err != nil {
-			return nil, true, err
+	for _, kv := range spans["select strategy"].Attributes() {
+		if kv.Key == "k8tz.strategy" && kv.Value.AsString() != string(inject.HostPathInjectionStrategy) {
+			t.Errorf("strategy attribute = %s, want %s", kv.Value.AsString(), inject.HostPathInjectionStrategy)
 		}
+	}
+}
 
-		content := string(data)
-		return &content, true, nil
-	} else if os.IsNotExist(err) {
-		return nil, false, nil
-	} else {
-		return nil, false, err
+func Test_tracingEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{
+			name: "no endpoint",
+			want: false,
+		},
+		{
+			name: "endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"},
+			want: true,
+		},
+		{
+			name: "traces endpoint",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/v1/traces"},
+			want: true,
+		},
+		{
+			name: "sdk disabled",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SDK_DISABLED": "true"},
+			want: false,
+		},
+		{
+			name: "traces exporter disabled",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_EXPORTER": "none"},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_SDK_DISABLED", "OTEL_TRACES_EXPORTER"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			if got := tracingEnabled(); got != tt.want {
+				t.Errorf("tracingEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_warnUnhandledResource(t *testing.T) {
+	var out bytes.Buffer
+	warningLogger.SetOutput(&out)
+	defer warningLogger.SetOutput(io.Discard)
+
+	req := &admissionv1beta1.AdmissionRequest{
+		Kind:     v1.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+		Resource: v1.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	}
+
+	for i := 0; i < 3; i++ {
+		warnUnhandledResource(req)
+	}
+
+	if lines := strings.Count(out.String(), "\n"); lines != 1 {
+		t.Errorf("warnUnhandledResource() logged %d warnings, want 1: %s", lines, out.String())
+	}
+}
+
+func Test_supportsNativeSidecars(t *testing.T) {
+	tests := []struct {
+		major string
+		minor string
+		want  bool
+	}{
+		{major: "1", minor: "27", want: false},
+		{major: "1", minor: "28", want: false},
+		{major: "1", minor: "29", want: true},
+		{major: "1", minor: "30+", want: true},
+		{major: "2", minor: "0", want: true},
+		{major: "", minor: "", want: false},
+		{major: "1", minor: "x", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s.%s", tt.major, tt.minor), func(t *testing.T) {
+			if got := supportsNativeSidecars(tt.major, tt.minor); got != tt.want {
+				t.Errorf("supportsNativeSidecars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_detectNativeSidecars(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name             string
+		bootstrapSidecar bool
+		serverVersion    version.Info
+		want             bool
+	}{
+		{
+			name:             "sidecar disabled",
+			bootstrapSidecar: false,
+			serverVersion:    version.Info{Major: "1", Minor: "29"},
+			want:             false,
+		},
+		{
+			name:             "sidecar enabled on supporting cluster",
+			bootstrapSidecar: true,
+			serverVersion:    version.Info{Major: "1", Minor: "29"},
+			want:             true,
+		},
+		{
+			name:             "sidecar enabled on old cluster falls back to initContainer",
+			bootstrapSidecar: true,
+			serverVersion:    version.Info{Major: "1", Minor: "26"},
+			want:             false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+			clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &tt.serverVersion
+
+			h := NewRequestsHandler()
+			h.BootstrapSidecar = tt.bootstrapSidecar
+			h.clientset = clientset
+			h.detectNativeSidecars()
+
+			generator, err := h.lookupPod("default", &corev1.Pod{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.BootstrapSidecar != tt.want {
+				t.Errorf("PatchGenerator.BootstrapSidecar = %v, want %v", generator.BootstrapSidecar, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_detectCronJobTimeZone(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name          string
+		mode          inject.CronJobMode
+		serverVersion version.Info
+		want          inject.CronJobMode
+	}{
+		{
+			name:          "auto on supporting cluster",
+			mode:          inject.AutoCronJobMode,
+			serverVersion: version.Info{Major: "1", Minor: "27"},
+			want:          inject.NativeCronJobMode,
+		},
+		{
+			name:          "auto on old cluster falls back to job template",
+			mode:          inject.AutoCronJobMode,
+			serverVersion: version.Info{Major: "1", Minor: "26+"},
+			want:          inject.TemplateCronJobMode,
+		},
+		{
+			name:          "forced native on old cluster",
+			mode:          inject.NativeCronJobMode,
+			serverVersion: version.Info{Major: "1", Minor: "25"},
+			want:          inject.NativeCronJobMode,
+		},
+		{
+			name:          "forced template on supporting cluster",
+			mode:          inject.TemplateCronJobMode,
+			serverVersion: version.Info{Major: "1", Minor: "29"},
+			want:          inject.TemplateCronJobMode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+			clientset.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &tt.serverVersion
+
+			h := NewRequestsHandler()
+			h.CronJobTimeZone = true
+			h.CronJobMode = tt.mode
+			h.clientset = clientset
+			h.detectCronJobTimeZone()
+
+			generator, err := h.lookupCronJob("default", &batchv1.CronJob{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.CronJobMode != tt.want {
+				t.Errorf("PatchGenerator.CronJobMode = %v, want %v", generator.CronJobMode, tt.want)
+			}
+		})
+	}
+}
+
+func compareReviews(got *bytes.Buffer, goldenFile string) error {
+	golden, exists, err := readGolden(goldenFile)
+	if err != nil {
+		return fmt.Errorf("golden file: %s, exists: %t, err: %v", goldenFile, exists, err)
+	}
+
+	if !exists || updateGoldens {
+		f, err := os.Create(goldenFile)
+		if err != nil {
+			return fmt.Errorf("failed to create golden file: %s, error: %v", goldenFile, err)
+		}
+
+		defer f.Close()
+
+		_, err = f.Write(got.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to write golden file: %s, error: %v", goldenFile, err)
+		}
+	} else {
+		hyps := got.String()
+		refs := *golden
+		if refs != hyps {
+			return fmt.Errorf("actual: %v, want: %v", hyps, refs)
+		}
+	}
+
+	return nil
+}
+
+func readGolden(file string) (*string, bool, error) {
+	if _, err := os.Stat(file); err == nil {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, true, err
+		}
+
+		content := string(data)
+		return &content, true, nil
+	} else if os.IsNotExist(err) {
+		return nil, false, nil
+	} else {
+		return nil, false, err
+	}
+}
+
+func TestRequestsHandler_MutateStream(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	review, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		input     string
+		once      bool
+		wantLines int
+		wantErr   bool
+	}{
+		{
+			name:      "single review with once",
+			input:     string(review),
+			once:      true,
+			wantLines: 1,
+		},
+		{
+			name:      "two reviews with once handles only the first",
+			input:     string(review) + string(review),
+			once:      true,
+			wantLines: 1,
+		},
+		{
+			name:      "two reviews without once",
+			input:     string(review) + string(review),
+			once:      false,
+			wantLines: 2,
+		},
+		{
+			name:    "empty input with once",
+			input:   "",
+			once:    true,
+			wantErr: true,
+		},
+		{
+			name:    "invalid input",
+			input:   "{not json",
+			once:    true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.BootstrapImage = "test:0.0.0"
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			var out bytes.Buffer
+			err := h.MutateStream(strings.NewReader(tt.input), &out, tt.once)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MutateStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(lines) != tt.wantLines {
+				t.Fatalf("MutateStream() wrote %d responses, want %d", len(lines), tt.wantLines)
+			}
+
+			for _, line := range lines {
+				if err := compareReviews(bytes.NewBufferString(line), "testdata/review-pod-golden.json"); err != nil {
+					t.Errorf("MutateStream(): %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_MutateStream_invalidOptions(t *testing.T) {
+	review, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		configure func(h *RequestsHandler)
+	}{
+		{
+			name:      "excluded namespace pattern",
+			configure: func(h *RequestsHandler) { h.ExcludedNamespaces = []string{"team-["} },
+		},
+		{
+			name:      "namespace selector",
+			configure: func(h *RequestsHandler) { h.NamespaceSelector = "env in (" },
+		},
+		{
+			name:      "locale",
+			configure: func(h *RequestsHandler) { h.DefaultLocale = "not a locale" },
+		},
+		{
+			name:      "hostPath type",
+			configure: func(h *RequestsHandler) { h.HostPathType = corev1.HostPathSocket },
+		},
+		{
+			name:      "error action",
+			configure: func(h *RequestsHandler) { h.OnError = "retry" },
+		},
+		{
+			name:      "csi strategy without driver",
+			configure: func(h *RequestsHandler) { h.DefaultInjectionStrategy = inject.CSIInjectionStrategy },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+			tt.configure(&h)
+
+			var out bytes.Buffer
+			if err := h.MutateStream(bytes.NewReader(review), &out, true); err == nil {
+				t.Errorf("MutateStream() should fail with an invalid %s", tt.name)
+			}
+
+			if out.Len() != 0 {
+				t.Errorf("MutateStream() wrote %s, want no response", out.String())
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_compatibleStrategy(t *testing.T) {
+	tests := []struct {
+		name                   string
+		hostNamespacesStrategy inject.InjectionStrategy
+		defaultStrategy        inject.InjectionStrategy
+		spec                   corev1.PodSpec
+		namespaceLabels        map[string]string
+		nativeSidecars         bool
+		want                   inject.InjectionStrategy
+	}{
+		{
+			name:            "regular pod keeps the default strategy",
+			defaultStrategy: inject.HostPathInjectionStrategy,
+			want:            inject.HostPathInjectionStrategy,
+		},
+		{
+			name:            "hostNetwork pod keeps the default strategy without policy",
+			defaultStrategy: inject.HostPathInjectionStrategy,
+			spec:            corev1.PodSpec{HostNetwork: true},
+			want:            inject.HostPathInjectionStrategy,
+		},
+		{
+			name:                   "hostNetwork pod avoids hostPath with policy",
+			hostNamespacesStrategy: inject.InitContainerInjectionStrategy,
+			defaultStrategy:        inject.HostPathInjectionStrategy,
+			spec:                   corev1.PodSpec{HostNetwork: true},
+			want:                   inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:                   "hostPID pod uses hostPath with policy",
+			hostNamespacesStrategy: inject.HostPathInjectionStrategy,
+			defaultStrategy:        inject.InitContainerInjectionStrategy,
+			spec:                   corev1.PodSpec{HostPID: true},
+			want:                   inject.HostPathInjectionStrategy,
+		},
+		{
+			name:                   "regular pod ignores host namespaces policy",
+			hostNamespacesStrategy: inject.InitContainerInjectionStrategy,
+			defaultStrategy:        inject.HostPathInjectionStrategy,
+			want:                   inject.HostPathInjectionStrategy,
+		},
+		{
+			name:            "hostPath in baseline namespace falls back to initContainer",
+			defaultStrategy: inject.HostPathInjectionStrategy,
+			namespaceLabels: map[string]string{podSecurityEnforceLabel: "baseline"},
+			want:            inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:            "hostPath in privileged namespace is kept",
+			defaultStrategy: inject.HostPathInjectionStrategy,
+			namespaceLabels: map[string]string{podSecurityEnforceLabel: "privileged"},
+			want:            inject.HostPathInjectionStrategy,
+		},
+		{
+			name:            "sidecar is kept when the cluster supports native sidecars",
+			defaultStrategy: inject.SidecarInjectionStrategy,
+			nativeSidecars:  true,
+			want:            inject.SidecarInjectionStrategy,
+		},
+		{
+			name:            "sidecar falls back to initContainer on old cluster",
+			defaultStrategy: inject.SidecarInjectionStrategy,
+			nativeSidecars:  false,
+			want:            inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:            "windows pod uses the windows strategy",
+			defaultStrategy: inject.InitContainerInjectionStrategy,
+			spec:            corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Windows}},
+			want:            inject.WindowsInjectionStrategy,
+		},
+		{
+			name:                   "windows pod ignores host namespaces policy",
+			hostNamespacesStrategy: inject.HostPathInjectionStrategy,
+			defaultStrategy:        inject.HostPathInjectionStrategy,
+			spec:                   corev1.PodSpec{HostNetwork: true, NodeSelector: map[string]string{corev1.LabelOSStable: "windows"}},
+			want:                   inject.WindowsInjectionStrategy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.DefaultInjectionStrategy = tt.defaultStrategy
+			h.HostNamespacesStrategy = tt.hostNamespacesStrategy
+			h.nativeSidecars = tt.nativeSidecars
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Labels: tt.namespaceLabels}})
+
+			generator, err := h.lookupPod("default", &corev1.Pod{Spec: tt.spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.Strategy != tt.want {
+				t.Errorf("PatchGenerator.Strategy = %v, want %v", generator.Strategy, tt.want)
+			}
+		})
+	}
+}
+
+func Test_detectInstallNamespace(t *testing.T) {
+	namespaceFile := filepath.Join(t.TempDir(), "namespace")
+	if err := os.WriteFile(namespaceFile, []byte("k8tz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		env  string
+		file string
+		want string
+	}{
+		{
+			name: "from downward api environment variable",
+			env:  "k8tz-system",
+			file: namespaceFile,
+			want: "k8tz-system",
+		},
+		{
+			name: "from service account namespace file",
+			env:  "",
+			file: namespaceFile,
+			want: "k8tz",
+		},
+		{
+			name: "outside of kubernetes",
+			env:  "",
+			file: filepath.Join(t.TempDir(), "missing"),
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(podNamespaceEnv, tt.env)
+			defer func(file string) { serviceAccountNamespaceFile = file }(serviceAccountNamespaceFile)
+			serviceAccountNamespaceFile = tt.file
+
+			if got := detectInstallNamespace(); got != tt.want {
+				t.Errorf("detectInstallNamespace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRequestsHandler_excludesInstallNamespace(t *testing.T) {
+	t.Setenv(podNamespaceEnv, "k8tz")
+
+	h := NewRequestsHandler()
+	if !h.ExcludeInstallNamespace || h.InstallNamespace != "k8tz" {
+		t.Errorf("NewRequestsHandler() should exclude the install namespace by default, got exclude=%v, namespace=%q", h.ExcludeInstallNamespace, h.InstallNamespace)
+	}
+}
+
+func TestRequestsHandler_reasons(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name       string
+		reviewFile string
+		handler    RequestsHandler
+		objects    []runtime.Object
+		counter    *reasonCounter
+		want       Reason
+	}{
+		{
+			name:       "unsupported kind",
+			reviewFile: "testdata/review-service.json",
+			handler:    RequestsHandler{InjectByDefault: true},
+			counter:    skippedRequests,
+			want:       ReasonUnsupportedKind,
+		},
+		{
+			name:       "template not found",
+			reviewFile: "testdata/review-custom-resource.json",
+			handler:    RequestsHandler{InjectByDefault: true, TemplatePaths: TemplatePaths{"pipelines.example.com": {"spec.template"}}},
+			objects:    []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			counter:    skippedRequests,
+			want:       ReasonTemplateNotFound,
+		},
+		{
+			name:       "already injected",
+			reviewFile: "testdata/review-injected-pod.json",
+			handler:    RequestsHandler{InjectByDefault: true},
+			objects:    []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			counter:    skippedRequests,
+			want:       ReasonAlreadyInjected,
+		},
+		{
+			name:       "disabled by default",
+			reviewFile: "testdata/review-pod.json",
+			handler:    RequestsHandler{InjectByDefault: false},
+			objects:    []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			counter:    skippedRequests,
+			want:       ReasonDisabled,
+		},
+		{
+			name:       "excluded namespace",
+			reviewFile: "testdata/review-pod.json",
+			handler:    RequestsHandler{InjectByDefault: true, InstallNamespace: "default", ExcludeInstallNamespace: true},
+			counter:    skippedRequests,
+			want:       ReasonExcludedNamespace,
+		},
+		{
+			name:       "missing namespace",
+			reviewFile: "testdata/review-pod.json",
+			handler:    RequestsHandler{InjectByDefault: true},
+			counter:    rejectedRequests,
+			want:       ReasonLookupFailed,
+		},
+		{
+			name:       "unparsable pod",
+			reviewFile: "testdata/review-unparsable-pod.json",
+			handler:    RequestsHandler{InjectByDefault: true},
+			objects:    []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			counter:    rejectedRequests,
+			want:       ReasonInvalidObject,
+		},
+		{
+			name:       "pod security violation",
+			reviewFile: "testdata/review-pod.json",
+			handler: RequestsHandler{
+				InjectByDefault:          true,
+				DefaultInjectionStrategy: inject.HostPathInjectionStrategy,
+				PodSecurityLevel:         inject.PodSecurityBaseline,
+				PodSecurityAction:        inject.PodSecurityDeny,
+			},
+			objects: []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			counter: rejectedRequests,
+			want:    ReasonPodSecurity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := os.ReadFile(tt.reviewFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := tt.handler
+			h.clientset = fake.NewSimpleClientset(tt.objects...)
+
+			before := tt.counter.snapshot()
+			if _, err := h.review(review); err != nil {
+				t.Fatal(err)
+			}
+
+			after := tt.counter.snapshot()
+			for _, r := range Reasons {
+				want := before[r]
+				if r == tt.want {
+					want++
+				}
+
+				if after[r] != want {
+					t.Errorf("count of %s = %d, want %d", r, after[r], want)
+				}
+			}
+		})
+	}
+}
+
+func Test_reasonCounter(t *testing.T) {
+	c := newReasonCounter()
+	c.inc(ReasonDisabled)
+	c.inc(Reason("free-form reason"))
+
+	snapshot := c.snapshot()
+	if len(snapshot) != len(Reasons) {
+		t.Fatalf("reasonCounter has %d labels, want %d", len(snapshot), len(Reasons))
+	}
+
+	for r := range snapshot {
+		found := false
+		for _, known := range Reasons {
+			found = found || r == known
+		}
+
+		if !found {
+			t.Errorf("reasonCounter has label %q that is not a known reason", r)
+		}
+	}
+
+	if snapshot[ReasonDisabled] != 1 || snapshot[ReasonInternal] != 1 {
+		t.Errorf("reasonCounter counts = %v, want disabled=1 and internal=1", snapshot)
+	}
+}
+
+func TestServer_capabilities(t *testing.T) {
+	tests := []struct {
+		name            string
+		cronJobTimeZone bool
+		injectWorkloads bool
+		wantResources   []string
+	}{
+		{
+			name:            "pods only",
+			cronJobTimeZone: false,
+			wantResources:   []string{"/v1, Resource=pods"},
+		},
+		{
+			name:            "pods and cronjobs",
+			cronJobTimeZone: true,
+			wantResources:   []string{"/v1, Resource=pods", "batch/v1, Resource=cronjobs"},
+		},
+		{
+			name:            "pods and workloads",
+			injectWorkloads: true,
+			wantResources: []string{"/v1, Resource=pods", "apps/v1, Resource=daemonsets", "apps/v1, Resource=deployments",
+				"apps/v1, Resource=replicasets", "apps/v1, Resource=statefulsets", "batch/v1, Resource=jobs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.Handler.CronJobTimeZone = tt.cronJobTimeZone
+			s.Handler.InjectWorkloads = tt.injectWorkloads
+
+			req, err := http.NewRequest(http.MethodGet, "/capabilities", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.capabilities).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("capabilities returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			var got Capabilities
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(got.Strategies) != "[initContainer hostPath sidecar tzdata windows csi image faketime]" {
+				t.Errorf("capabilities strategies = %v, want [initContainer hostPath sidecar tzdata windows csi image faketime]", got.Strategies)
+			}
+
+			var resources []string
+			for _, r := range got.Resources {
+				resources = append(resources, r.String())
+			}
+
+			if fmt.Sprint(resources) != fmt.Sprint(tt.wantResources) {
+				t.Errorf("capabilities resources = %v, want %v", resources, tt.wantResources)
+			}
+
+			if got.DefaultStrategy != inject.DefaultInjectionStrategy || got.DefaultTimezone != pkg.DefaultTimezone {
+				t.Errorf("capabilities defaults = %s/%s, want %s/%s", got.DefaultStrategy, got.DefaultTimezone, inject.DefaultInjectionStrategy, pkg.DefaultTimezone)
+			}
+		})
+	}
+}
+
+func TestServer_report(t *testing.T) {
+	pods := []runtime.Object{
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "a", Namespace: "default", Annotations: map[string]string{
+			pkg.InjectedAnnotation: "true", pkg.TimezoneAnnotation: "UTC", pkg.TzdataVersionAnnotation: "2023c"}}},
+		&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "b", Namespace: "kube-system"}},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		query           string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "csv of a namespace",
+			method:          http.MethodGet,
+			query:           "?namespace=default&format=csv",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/csv",
+			wantBody:        "namespace,name,injected,timezone,tzdataVersion,stale\ndefault,a,true,UTC,2023c,true\n",
+		},
+		{
+			name:            "json by default",
+			method:          http.MethodGet,
+			wantCode:        http.StatusOK,
+			wantContentType: jsonContentType,
+			wantBody:        `"name": "kube-system"`,
+		},
+		{
+			name:     "unknown format",
+			method:   http.MethodGet,
+			query:    "?format=xml",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "post",
+			method:   http.MethodPost,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.Handler.TzdataVersion = "2024a"
+			s.Handler.SetClientset(fake.NewSimpleClientset(pods...))
+			s.EnableReport = true
+
+			debug, err := s.debugServer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(tt.method, "/report"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			debug.Handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("report returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("report content type = %s, want %s", got, tt.wantContentType)
+			}
+
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("report body = %s, want it to contain %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServer_debugServer_withoutReport(t *testing.T) {
+	s := NewAdmissionServer()
+	s.EnablePprof = true
+	s.Handler.SetClientset(fake.NewSimpleClientset())
+
+	debug, err := s.debugServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	debug.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/report", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("debug server without --enable-report returned %d for /report, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestChaos_shouldFail(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		requests int
+		want     int
+	}{
+		{
+			name:     "disabled",
+			rate:     0,
+			requests: 100,
+			want:     0,
+		},
+		{
+			name:     "quarter of the requests",
+			rate:     0.25,
+			requests: 100,
+			want:     25,
+		},
+		{
+			name:     "third of the requests",
+			rate:     1.0 / 3,
+			requests: 99,
+			want:     33,
+		},
+		{
+			name:     "all requests",
+			rate:     1,
+			requests: 100,
+			want:     100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChaos()
+			f := failureInjection{rate: tt.rate, mode: FailureModeDeny}
+
+			got := 0
+			for i := 0; i < tt.requests; i++ {
+				if c.shouldFail(f) {
+					got++
+				}
+			}
+
+			if got != tt.want {
+				t.Errorf("shouldFail() failed %d out of %d requests, want %d", got, tt.requests, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_review_injectedFailure(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review, err := decodeAdmissionReview(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChaos()
+	h := &RequestsHandler{chaos: c}
+
+	c.settings.Store(failureInjection{rate: 1, mode: FailureModeDeny})
+	response, err := h.review(review)
+	if err != nil || response.Response.Allowed {
+		t.Errorf("review() with deny failure mode should reject the request, got response=%+v, error=%v", response, err)
+	}
+
+	c.settings.Store(failureInjection{rate: 1, mode: FailureModeError})
+	if _, err := h.review(review); err == nil {
+		t.Errorf("review() with error failure mode should return an error")
+	}
+
+	c.settings.Store(failureInjection{rate: 1, mode: FailureModeMalformed})
+	response, err = h.review(review)
+	if err != nil || !response.Response.Allowed || json.Unmarshal(response.Response.Patch, &[]interface{}{}) == nil {
+		t.Errorf("review() with malformed failure mode should allow the request with a malformed patch, got response=%+v, error=%v", response, err)
+	}
+
+	c.settings.Store(failureInjection{rate: 1, mode: FailureModeTLS})
+	if mode, _, ok := c.reviewFailure(); ok || !c.load().closesConnections() {
+		t.Errorf("review() with tls failure mode should not fail the review (%s) and should close the connections", mode)
+	}
+}
+
+func TestChaos_serveHTTP(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		wantCode int
+		want     FailureSettings
+	}{
+		{
+			name:     "settings",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+			want:     FailureSettings{Rate: 0, Mode: FailureModeDeny, Delay: "15s"},
+		},
+		{
+			name:     "slow responses",
+			method:   http.MethodPost,
+			query:    "?rate=0.5&mode=slow&delay=12s",
+			wantCode: http.StatusOK,
+			want:     FailureSettings{Rate: 0.5, Mode: FailureModeSlow, Delay: "12s"},
+		},
+		{
+			name:     "only the mode",
+			method:   http.MethodPost,
+			query:    "?mode=tls",
+			wantCode: http.StatusOK,
+			want:     FailureSettings{Rate: 0, Mode: FailureModeTLS, Delay: "15s"},
+		},
+		{
+			name:     "unknown mode",
+			method:   http.MethodPost,
+			query:    "?rate=1&mode=panic",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid rate",
+			method:   http.MethodPost,
+			query:    "?rate=2",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "delete",
+			method:   http.MethodDelete,
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChaos()
+			if err := c.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(tt.method, "/chaos"+tt.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(c.serveHTTP).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("chaos returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var got FailureSettings
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("chaos = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_debugServer_chaos(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAdmissionServer()
+	s.Chaos = NewChaos()
+	s.Chaos.Endpoint = true
+	s.Handler.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	s.Handler.chaos = s.Chaos
+	if err := s.Chaos.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	debug, err := s.debugServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	debug.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("debug server without pprof returned %d for /debug/pprof/, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	// the reviews work on copies of the handler while the chaos endpoint
+	// changes the failure injection, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				review, err := decodeAdmissionReview(data)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				s.Handler.review(review)
+			}
+		}()
+	}
+
+	for _, query := range []string{"?rate=0.5&mode=deny", "?mode=malformed", "?rate=0.25&mode=slow&delay=1ms", "?rate=0"} {
+		rr := httptest.NewRecorder()
+		debug.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/chaos"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("POST /chaos%s returned %d: %s", query, rr.Code, rr.Body.String())
+		}
+	}
+	wg.Wait()
+
+	if f := s.Chaos.load(); f.rate != 0 || f.mode != FailureModeSlow || f.delay != time.Millisecond {
+		t.Errorf("failure injection = %+v after the changes, want rate 0, mode slow and delay 1ms", f)
+	}
+}
+
+func TestRequestsHandler_withoutChaos(t *testing.T) {
+	// the release binaries have no failure injection
+	h := &RequestsHandler{}
+	if mode, _, ok := h.chaos.reviewFailure(); ok {
+		t.Errorf("reviewFailure() without chaos = %s, want no failure", mode)
+	}
+
+	if h.chaos.load().closesConnections() {
+		t.Errorf("closesConnections() without chaos = true, want false")
+	}
+}
+
+func TestChaos_validate(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name    string
+		rate    float64
+		mode    FailureMode
+		delay   time.Duration
+		wantErr bool
+	}{
+		{name: "disabled", rate: 0, mode: "", wantErr: false},
+		{name: "valid", rate: 0.5, mode: FailureModeError, wantErr: false},
+		{name: "rate above 1", rate: 1.5, mode: FailureModeDeny, wantErr: true},
+		{name: "negative rate", rate: -0.1, mode: FailureModeDeny, wantErr: true},
+		{name: "unknown mode", rate: 0.5, mode: "panic", wantErr: true},
+		{name: "slow", rate: 0.5, mode: FailureModeSlow, delay: time.Second, wantErr: false},
+		{name: "slow without delay", rate: 0.5, mode: FailureModeSlow, wantErr: true},
+		{name: "tls", rate: 0.1, mode: FailureModeTLS, wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Chaos{Rate: tt.rate, Mode: tt.mode, Delay: tt.delay}
+			if err := c.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimezonePolicy_Allowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *TimezonePolicy
+		timezone string
+		want     bool
+	}{
+		{name: "no policy", policy: nil, timezone: "Asia/Tokyo", want: true},
+		{name: "empty policy", policy: &TimezonePolicy{}, timezone: "Asia/Tokyo", want: true},
+		{name: "allowed by pattern", policy: &TimezonePolicy{Allow: []string{"Europe/*"}}, timezone: "Europe/Berlin", want: true},
+		{name: "not in allow list", policy: &TimezonePolicy{Allow: []string{"Europe/*", "UTC"}}, timezone: "Asia/Tokyo", want: false},
+		{name: "denied", policy: &TimezonePolicy{Deny: []string{"Europe/Moscow"}}, timezone: "Europe/Moscow", want: false},
+		{name: "deny takes precedence", policy: &TimezonePolicy{Allow: []string{"Europe/*"}, Deny: []string{"Europe/Moscow"}}, timezone: "Europe/Moscow", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allowed(tt.timezone); got != tt.want {
+				t.Errorf("Allowed(%s) = %v, want %v", tt.timezone, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseTimezonePolicy(t *testing.T) {
+	if _, err := parseTimezonePolicy([]byte("allow: [\"Europe/*\"]\ndeny: [UTC]\n")); err != nil {
+		t.Errorf("parseTimezonePolicy() unexpected error: %v", err)
+	}
+
+	if _, err := parseTimezonePolicy([]byte("allow: [\"Europe/[\"]\n")); err == nil {
+		t.Errorf("parseTimezonePolicy() should reject malformed patterns")
+	}
+
+	if _, err := parseTimezonePolicy([]byte("alow: [UTC]\n")); err == nil {
+		t.Errorf("parseTimezonePolicy() should reject unknown fields")
+	}
+}
+
+func TestRequestsHandler_review_timezonePolicy(t *testing.T) {
+	t.Cleanup(func() { SetTimezonePolicy(nil) })
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &RequestsHandler{DefaultTimezone: "Europe/Berlin", DefaultInjectionStrategy: inject.InitContainerInjectionStrategy, InjectByDefault: true}
+	h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+	allowed := func() bool {
+		review, err := decodeAdmissionReview(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response, err := h.review(review)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return response.Response.Allowed
+	}
+
+	if !allowed() {
+		t.Errorf("review() without policy should allow the request")
+	}
+
+	SetTimezonePolicy(&TimezonePolicy{Deny: []string{"Europe/*"}})
+	before := rejectedRequests.snapshot()[ReasonTimezoneDenied]
+	if allowed() {
+		t.Errorf("review() should reject timezone denied by the updated policy")
+	}
+
+	if got := rejectedRequests.snapshot()[ReasonTimezoneDenied]; got != before+1 {
+		t.Errorf("count of %s = %d, want %d", ReasonTimezoneDenied, got, before+1)
+	}
+
+	SetTimezonePolicy(&TimezonePolicy{Allow: []string{"Europe/Berlin"}})
+	if !allowed() {
+		t.Errorf("review() should allow timezone allowed by the updated policy")
+	}
+}
+
+func TestRequestsHandler_watchTimezonePolicy(t *testing.T) {
+	t.Cleanup(func() { SetTimezonePolicy(nil) })
+	infoLogger.SetOutput(io.Discard)
+	errorLogger.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.yaml")
+
+	// replace the file atomically like kubelet does for mounted ConfigMaps
+	writePolicy := func(content string) {
+		tmp := filepath.Join(dir, "policy.tmp")
+		if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writePolicy("allow: [\"Europe/*\"]\n")
+
+	h := &RequestsHandler{TimezonePolicyFile: file, TimezonePolicyReload: 10 * time.Millisecond}
+	if err := h.reloadTimezonePolicy(); err != nil {
+		t.Fatal(err)
+	}
+
+	if checkTimezonePolicy("Asia/Tokyo") == nil {
+		t.Fatalf("Asia/Tokyo should be denied by the initial policy")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go h.watchTimezonePolicy(stop)
+
+	// a malformed policy keeps the previous one
+	writePolicy("allow: [\"Asia/[\"]\n")
+
+	time.Sleep(50 * time.Millisecond)
+	if checkTimezonePolicy("Europe/Berlin") != nil {
+		t.Fatalf("Europe/Berlin should still be allowed after a malformed policy update")
+	}
+
+	writePolicy("allow: [\"Asia/*\"]\n")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for checkTimezonePolicy("Asia/Tokyo") != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("updated timezone policy was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if checkTimezonePolicy("Europe/Berlin") == nil {
+		t.Errorf("Europe/Berlin should be denied by the updated policy")
+	}
+}
+
+func TestRequestsHandler_configured(t *testing.T) {
+	t.Cleanup(func() { webhookConfig.Store((*WebhookConfig)(nil)) })
+	infoLogger.SetOutput(io.Discard)
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := NewRequestsHandler()
+	h.ConfigFile = file
+	h.ZoneInfoPath = "testdata/zoneinfo-missing"
+	h.InstallNamespace = "k8tz"
+	h.ConfigOverrides = []string{ConfigBootstrapImage}
+
+	if got := h.configured(); got.DefaultTimezone != h.DefaultTimezone {
+		t.Errorf("configured() without config timezone = %v, want %v", got.DefaultTimezone, h.DefaultTimezone)
+	}
+
+	writeConfig("timezone: Europe/Berlin\ninjectionStrategy: hostPath\nbootstrapImage: registry.local/k8tz:1.0.0\nexcludedNamespaces: [monitoring]\n")
+	if err := h.reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := h.configured()
+	if got.DefaultTimezone != "Europe/Berlin" || got.DefaultInjectionStrategy != inject.HostPathInjectionStrategy {
+		t.Errorf("configured() = %v/%v, want Europe/Berlin/hostPath", got.DefaultTimezone, got.DefaultInjectionStrategy)
+	}
+
+	if got.BootstrapImage != h.BootstrapImage {
+		t.Errorf("configured() bootstrap image = %v, want the overriding flag %v", got.BootstrapImage, h.BootstrapImage)
+	}
+
+	for namespace, want := range map[string]bool{"monitoring": true, "k8tz": true, "default": false} {
+		if excluded := got.isExcludedNamespace(namespace); excluded != want {
+			t.Errorf("isExcludedNamespace(%s) = %v, want %v", namespace, excluded, want)
+		}
+	}
+
+	writeConfig("injectionStrategy: unknown\n")
+	if err := h.reloadConfig(); err == nil {
+		t.Errorf("reloadConfig() should fail on unknown injection strategy")
+	}
+
+	if got = h.configured(); got.DefaultTimezone != "Europe/Berlin" {
+		t.Errorf("configured() after a malformed config = %v, want the previous config", got.DefaultTimezone)
+	}
+}
+
+func TestRequestsHandler_review_failOpen(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	// withAnnotation returns the pod review with the fail-open annotation
+	// set to value, or without it if value is empty
+	withAnnotation := func(value string) *admissionv1beta1.AdmissionReview {
+		data, err := os.ReadFile("testdata/review-pod.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		review, err := decodeAdmissionReview(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value == "" {
+			return review
+		}
+
+		pod := corev1.Pod{}
+		if err := json.Unmarshal(review.Request.Object.Raw, &pod); err != nil {
+			t.Fatal(err)
+		}
+
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[pkg.FailOpenAnnotation] = value
+
+		if review.Request.Object.Raw, err = json.Marshal(pod); err != nil {
+			t.Fatal(err)
+		}
+
+		return review
+	}
+
+	unparsable := func() *admissionv1beta1.AdmissionReview {
+		data, err := os.ReadFile("testdata/review-unparsable-pod.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		review, err := decodeAdmissionReview(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return review
+	}
+
+	tests := []struct {
+		name         string
+		allowOnError bool
+		review       *admissionv1beta1.AdmissionReview
+		wantAllowed  bool
+	}{
+		{name: "fail-closed by default", allowOnError: false, review: withAnnotation(""), wantAllowed: false},
+		{name: "global allow-on-error", allowOnError: true, review: withAnnotation(""), wantAllowed: true},
+		{name: "pod opts into fail-open", allowOnError: false, review: withAnnotation("true"), wantAllowed: true},
+		{name: "pod opts out of fail-open", allowOnError: true, review: withAnnotation("false"), wantAllowed: false},
+		{name: "invalid annotation uses global setting", allowOnError: true, review: withAnnotation("sometimes"), wantAllowed: true},
+		{name: "undecodable object uses global setting", allowOnError: true, review: unparsable(), wantAllowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the namespace does not exist, so the lookup fails
+			h := &RequestsHandler{InjectByDefault: true, AllowOnError: tt.allowOnError}
+			h.clientset = fake.NewSimpleClientset()
+
+			response, err := h.review(tt.review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.Response.Allowed != tt.wantAllowed {
+				t.Errorf("review() allowed = %v, want %v", response.Response.Allowed, tt.wantAllowed)
+			}
+
+			if tt.wantAllowed && (response.Response.Patch != nil || len(response.Response.Warnings) != 1) {
+				t.Errorf("fail-open review() should have no patch and a warning, got patch=%s, warnings=%v", response.Response.Patch, response.Response.Warnings)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_errorAction(t *testing.T) {
+	cronJobs := v1.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}
+	tests := []struct {
+		name           string
+		handler        RequestsHandler
+		resource       v1.GroupVersionResource
+		wantAction     ErrorAction
+		wantConfigured bool
+	}{
+		{name: "deny by default", resource: podResource, wantAction: ErrorActionDeny},
+		{name: "allow-on-error", handler: RequestsHandler{AllowOnError: true}, resource: podResource, wantAction: ErrorActionAllow},
+		{name: "on-error takes precedence", handler: RequestsHandler{AllowOnError: true, OnError: ErrorActionDeny}, resource: podResource, wantAction: ErrorActionDeny, wantConfigured: true},
+		{
+			name:           "resource override",
+			handler:        RequestsHandler{OnError: ErrorActionDeny, OnErrorResources: ErrorActions{"pods": ErrorActionAllow}},
+			resource:       podResource,
+			wantAction:     ErrorActionAllow,
+			wantConfigured: true,
+		},
+		{
+			name:           "override of a grouped resource",
+			handler:        RequestsHandler{AllowOnError: true, OnErrorResources: ErrorActions{"pods": ErrorActionAllow, "cronjobs.batch": ErrorActionDeny}},
+			resource:       cronJobs,
+			wantAction:     ErrorActionDeny,
+			wantConfigured: true,
+		},
+		{
+			name:           "resource without override",
+			handler:        RequestsHandler{OnError: ErrorActionAllow, OnErrorResources: ErrorActions{"cronjobs.batch": ErrorActionDeny}},
+			resource:       podResource,
+			wantAction:     ErrorActionAllow,
+			wantConfigured: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, configured := tt.handler.errorAction(tt.resource)
+			if action != tt.wantAction || configured != tt.wantConfigured {
+				t.Errorf("errorAction() = %s, %v, want %s, %v", action, configured, tt.wantAction, tt.wantConfigured)
+			}
+		})
+	}
+}
+
+func TestErrorActions_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    ErrorActions
+		wantErr bool
+	}{
+		{name: "resources", values: []string{"pods=allow", "cronjobs.batch=deny"}, want: ErrorActions{"pods": ErrorActionAllow, "cronjobs.batch": ErrorActionDeny}},
+		{name: "last value wins", values: []string{"pods=allow", "pods=deny"}, want: ErrorActions{"pods": ErrorActionDeny}},
+		{name: "missing action", values: []string{"pods"}, wantErr: true},
+		{name: "empty resource", values: []string{"=allow"}, wantErr: true},
+		{name: "unknown action", values: []string{"pods=ignore"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ErrorActions
+			var err error
+			for _, value := range tt.values {
+				if err = got.Set(value); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Set() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_validateOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler RequestsHandler
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "valid", handler: RequestsHandler{OnError: ErrorActionDeny, OnErrorResources: ErrorActions{"pods": ErrorActionAllow}}},
+		{name: "unknown action", handler: RequestsHandler{OnError: "ignore"}, wantErr: true},
+		{name: "unknown resource action", handler: RequestsHandler{OnErrorResources: ErrorActions{"pods": "ignore"}}, wantErr: true},
+		{name: "versioned resource", handler: RequestsHandler{OnErrorResources: ErrorActions{"batch/v1/cronjobs": ErrorActionDeny}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.handler.validateOnError(); (err != nil) != tt.wantErr {
+				t.Errorf("validateOnError() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_handleFunc_decodeError(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	// the operation has the wrong type, so the review cannot be decoded but
+	// its version, uid and resource can still be read
+	undecodable := func(resource string) string {
+		return fmt.Sprintf(`{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1","request":{"uid":"b5f0a3e4","resource":%s,"operation":5}}`, resource)
+	}
+	pods := `{"group":"","version":"v1","resource":"pods"}`
+	cronJobs := `{"group":"batch","version":"v1","resource":"cronjobs"}`
+
+	tests := []struct {
+		name        string
+		handler     RequestsHandler
+		body        string
+		wantStatus  int
+		wantAllowed bool
+		wantMetric  string
+	}{
+		{
+			name:       "failurePolicy applies by default",
+			handler:    RequestsHandler{AllowOnError: true},
+			body:       undecodable(pods),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "allow",
+			handler:     RequestsHandler{OnError: ErrorActionAllow},
+			body:        undecodable(pods),
+			wantStatus:  http.StatusOK,
+			wantAllowed: true,
+			wantMetric:  `k8tz_admission_errors_total{resource="pods",action="allow"}`,
+		},
+		{
+			name:       "deny",
+			handler:    RequestsHandler{OnError: ErrorActionDeny},
+			body:       undecodable(pods),
+			wantStatus: http.StatusOK,
+			wantMetric: `k8tz_admission_errors_total{resource="pods",action="deny"}`,
+		},
+		{
+			name:       "fail-closed for cronjobs",
+			handler:    RequestsHandler{OnError: ErrorActionAllow, OnErrorResources: ErrorActions{"cronjobs.batch": ErrorActionDeny}},
+			body:       undecodable(cronJobs),
+			wantStatus: http.StatusOK,
+			wantMetric: `k8tz_admission_errors_total{resource="cronjobs.batch",action="deny"}`,
+		},
+		{
+			name:        "unknown resource",
+			handler:     RequestsHandler{OnError: ErrorActionAllow},
+			body:        undecodable(`{"group":"example.com","version":"v1","resource":"widgets"}`),
+			wantStatus:  http.StatusOK,
+			wantAllowed: true,
+			wantMetric:  `k8tz_admission_errors_total{resource="other",action="allow"}`,
+		},
+		{
+			name:       "unreadable uid",
+			handler:    RequestsHandler{OnError: ErrorActionAllow},
+			body:       `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1","request":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported version",
+			handler:    RequestsHandler{OnError: ErrorActionAllow},
+			body:       `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v2","request":{"uid":"b5f0a3e4"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := metricValue(t, tt.wantMetric)
+
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", jsonContentType)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(tt.handler.handleFunc).ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("handleFunc() status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			response := admissionv1beta1.AdmissionReview{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			if response.APIVersion != "admission.k8s.io/v1" || response.Response == nil || response.Response.UID != "b5f0a3e4" {
+				t.Fatalf("handleFunc() = %s, want a response to the review", rr.Body)
+			}
+
+			if response.Response.Allowed != tt.wantAllowed {
+				t.Errorf("handleFunc() allowed = %v, want %v", response.Response.Allowed, tt.wantAllowed)
+			}
+
+			if got := metricValue(t, tt.wantMetric); got != before+1 {
+				t.Errorf("%s = %d, want %d", tt.wantMetric, got, before+1)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_review_onError(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		handler     RequestsHandler
+		wantAllowed bool
+		wantMetric  string
+	}{
+		{
+			name:        "allowed pods",
+			handler:     RequestsHandler{InjectByDefault: true, OnError: ErrorActionDeny, OnErrorResources: ErrorActions{"pods": ErrorActionAllow}},
+			wantAllowed: true,
+			wantMetric:  `k8tz_admission_errors_total{resource="pods",action="allow"}`,
+		},
+		{
+			name:       "denied pods",
+			handler:    RequestsHandler{InjectByDefault: true, AllowOnError: true, OnError: ErrorActionDeny},
+			wantMetric: `k8tz_admission_errors_total{resource="pods",action="deny"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the namespace does not exist, so the lookup fails
+			h := tt.handler
+			h.clientset = fake.NewSimpleClientset()
+			before := metricValue(t, tt.wantMetric)
+
+			response, err := h.review(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.Response.Allowed != tt.wantAllowed {
+				t.Errorf("review() allowed = %v, want %v", response.Response.Allowed, tt.wantAllowed)
+			}
+
+			if got := metricValue(t, tt.wantMetric); got != before+1 {
+				t.Errorf("%s = %d, want %d", tt.wantMetric, got, before+1)
+			}
+		})
+	}
+}
+
+// metricValue returns the value of the sample of writeMetrics, or 0 if it
+// is missing
+func metricValue(t *testing.T, sample string) int {
+	t.Helper()
+
+	var metrics strings.Builder
+	writeMetrics(&metrics)
+	for _, line := range strings.Split(metrics.String(), "\n") {
+		if strings.HasPrefix(line, sample+" ") {
+			var v int
+			if _, err := fmt.Sscan(strings.TrimPrefix(line, sample+" "), &v); err != nil {
+				t.Fatalf("invalid sample %q: %v", line, err)
+			}
+			return v
+		}
+	}
+
+	return 0
+}
+
+func TestRequestsHandler_review_missingTimezone(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		action      MissingTimezoneAction
+		wantAllowed bool
+		wantTZ      string
+		counter     *reasonCounter
+	}{
+		{name: "fallback", action: MissingTimezoneFallback, wantAllowed: true, wantTZ: "Asia/Tokyo"},
+		{name: "skip", action: MissingTimezoneSkip, wantAllowed: true, counter: skippedRequests},
+		{name: "deny", action: MissingTimezoneDeny, wantAllowed: false, counter: rejectedRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := &RequestsHandler{
+				DefaultTimezone:          "",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				MissingTimezoneAction:    tt.action,
+				FallbackTimezone:         "Asia/Tokyo",
+			}
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			var before uint64
+			if tt.counter != nil {
+				before = tt.counter.snapshot()[ReasonNoTimezone]
+			}
+
+			response, err := h.review(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.Response.Allowed != tt.wantAllowed {
+				t.Errorf("review() allowed = %v, want %v", response.Response.Allowed, tt.wantAllowed)
+			}
+
+			injected := strings.Contains(string(response.Response.Patch), `"name":"TZ"`)
+			if injected != (tt.wantTZ != "") || !strings.Contains(string(response.Response.Patch), tt.wantTZ) {
+				t.Errorf("review() patch = %s, want TZ=%q", response.Response.Patch, tt.wantTZ)
+			}
+
+			if tt.counter != nil {
+				if got := tt.counter.snapshot()[ReasonNoTimezone]; got != before+1 {
+					t.Errorf("count of %s = %d, want %d", ReasonNoTimezone, got, before+1)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_review_warnings(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		defaultTimezone string
+		annotations     map[string]string
+		namespaceLabels map[string]string
+		env             []corev1.EnvVar
+		want            []string
+	}{
+		{
+			name:            "no warnings",
+			defaultTimezone: "Europe/Berlin",
+		},
+		{
+			name:            "unknown timezone",
+			defaultTimezone: "Europe/Berlin",
+			annotations:     map[string]string{pkg.TimezoneAnnotation: "Mars/Olympus"},
+			want:            []string{`requests unknown timezone "Mars/Olympus"`},
+		},
+		{
+			name:            "fallback timezone",
+			defaultTimezone: "",
+			want:            []string{"using fallback timezone: Asia/Tokyo"},
+		},
+		{
+			name:            "hostPath blocked by pod security",
+			defaultTimezone: "Europe/Berlin",
+			annotations:     map[string]string{pkg.InjectionStrategyAnnotation: string(inject.HostPathInjectionStrategy)},
+			namespaceLabels: map[string]string{podSecurityEnforceLabel: "restricted"},
+			want:            []string{"forbids hostPath volumes"},
+		},
+		{
+			name:            "existing TZ environment variable",
+			defaultTimezone: "Europe/Berlin",
+			env:             []corev1.EnvVar{{Name: "TZ", Value: "UTC"}},
+			want:            []string{"already defines TZ"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pod := corev1.Pod{}
+			if err := json.Unmarshal(review.Request.Object.Raw, &pod); err != nil {
+				t.Fatal(err)
+			}
+
+			pod.Annotations = tt.annotations
+			pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, tt.env...)
+			if review.Request.Object.Raw, err = json.Marshal(pod); err != nil {
+				t.Fatal(err)
+			}
+
+			h := &RequestsHandler{
+				DefaultTimezone:          tt.defaultTimezone,
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				MissingTimezoneAction:    MissingTimezoneFallback,
+				FallbackTimezone:         "Asia/Tokyo",
+				ZoneInfoPath:             "../inject/testdata/zoneinfo",
+			}
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Labels: tt.namespaceLabels}})
+
+			response, err := h.review(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !response.Response.Allowed {
+				t.Fatalf("review() allowed = false, result=%+v", response.Response.Result)
+			}
+
+			if len(response.Response.Warnings) != len(tt.want) {
+				t.Fatalf("review() warnings = %q, want %d warnings", response.Response.Warnings, len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				if got := response.Response.Warnings[i]; !strings.HasPrefix(got, warningPrefix) || !strings.Contains(got, want) {
+					t.Errorf("review() warning = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_review_dryRun(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		namespaces   []runtime.Object
+		wantWithheld uint64
+		wantWarnings int
+	}{
+		{
+			name:         "patches are withheld",
+			namespaces:   []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			wantWithheld: 1,
+		},
+		{
+			// the namespace does not exist, so the lookup fails
+			name:         "rejection is allowed with a warning",
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := &RequestsHandler{
+				DefaultTimezone:          "Europe/Berlin",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				DryRun:                   true,
+			}
+			h.clientset = fake.NewSimpleClientset(tt.namespaces...)
+
+			before := atomic.LoadUint64(&dryRunMutations)
+			response, err := h.review(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !response.Response.Allowed {
+				t.Errorf("review() allowed = false in dry-run, result=%+v", response.Response.Result)
+			}
+
+			if patch := string(response.Response.Patch); patch != "" && patch != "null" {
+				t.Errorf("review() patch = %s, want no patches in dry-run", response.Response.Patch)
+			}
+
+			if got := atomic.LoadUint64(&dryRunMutations) - before; got != tt.wantWithheld {
+				t.Errorf("withheld reviews = %d, want %d", got, tt.wantWithheld)
+			}
+
+			if len(response.Response.Warnings) != tt.wantWarnings {
+				t.Errorf("review() warnings = %q, want %d warnings", response.Response.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_acquireReviewSlot(t *testing.T) {
+	h := &RequestsHandler{MaxConcurrentReviews: 1}
+	h.limitConcurrency()
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	release, ok := h.acquireReviewSlot(req)
+	if !ok {
+		t.Fatal("acquireReviewSlot() = false, want a free slot")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, ok := h.acquireReviewSlot(req.WithContext(ctx)); ok {
+		t.Error("acquireReviewSlot() = true while all slots are taken, want false after cancellation")
+	}
+
+	release()
+	if release, ok := h.acquireReviewSlot(req); !ok {
+		t.Error("acquireReviewSlot() = false after the slot was released")
+	} else {
+		release()
+	}
+}
+
+func Test_circuitBreaker(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+
+	start := time.Now()
+	b := &circuitBreaker{threshold: 2, window: time.Minute, cooldown: 30 * time.Second}
+	steps := []struct {
+		after     time.Duration
+		failed    bool
+		wantAllow bool
+	}{
+		{after: 0, failed: true, wantAllow: true},
+		// the first failure is out of the window
+		{after: 2 * time.Minute, failed: true, wantAllow: true},
+		{after: 2*time.Minute + time.Second, failed: true, wantAllow: false},
+		{after: 2*time.Minute + 20*time.Second, wantAllow: false},
+		// half-open after the cooldown, a failed trial opens it again
+		{after: 2*time.Minute + 40*time.Second, failed: true, wantAllow: false},
+		// half-open again, a successful trial closes it
+		{after: 3*time.Minute + 20*time.Second, wantAllow: true},
+		{after: 3*time.Minute + 21*time.Second, failed: true, wantAllow: true},
+	}
+	for i, step := range steps {
+		now := start.Add(step.after)
+		if allowed, trial := b.allow(now); allowed {
+			b.record(now, step.failed, trial)
+		}
+
+		allowed, trial := b.allow(now)
+		if allowed != step.wantAllow {
+			t.Errorf("step %d: allow() = %t, want %t", i, allowed, step.wantAllow)
+		}
+
+		if trial {
+			b.release()
+		}
+	}
+}
+
+func Test_circuitBreaker_halfOpen(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+	defer atomic.StoreInt32(&circuitBreakerOpen, 0)
+
+	start := time.Now()
+	b := &circuitBreaker{threshold: 1, window: time.Minute, cooldown: 30 * time.Second}
+	b.record(start, true, false)
+
+	// a single trial at a time after the cooldown
+	now := start.Add(time.Minute)
+	if allowed, trial := b.allow(now); !allowed || !trial {
+		t.Fatalf("allow() of the first review after the cooldown = %t, %t, want the trial", allowed, trial)
+	}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := b.allow(now); allowed {
+			t.Fatalf("allow() of concurrent review %d during the trial = true, want false", i)
+		}
+	}
+
+	// a review that started before the breaker opened does not end the trial
+	b.record(now, false, false)
+	if allowed, _ := b.allow(now); allowed {
+		t.Fatalf("allow() after the outcome of an older review = true, want false")
+	}
+
+	// a trial that was not evaluated lets another review be the trial
+	b.release()
+	if allowed, trial := b.allow(now); !allowed || !trial {
+		t.Fatalf("allow() after the release of the trial = %t, %t, want the trial", allowed, trial)
+	}
+
+	b.record(now, false, true)
+	for i := 0; i < 3; i++ {
+		if allowed, trial := b.allow(now); !allowed || trial {
+			t.Fatalf("allow() of review %d after a successful trial = %t, %t, want allowed without trial", i, allowed, trial)
+		}
+	}
+}
+
+func TestRequestsHandler_review_degraded(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		configure  func(h *RequestsHandler)
+		namespaces []runtime.Object
+		wantReason Reason
+	}{
+		{
+			name: "rate limited",
+			configure: func(h *RequestsHandler) {
+				h.MaxReviewsPerSecond = 0.001
+				h.ReviewBurst = 1
+			},
+			namespaces: []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			wantReason: ReasonRateLimited,
+		},
+		{
+			// the namespace does not exist, so the lookup of the first review fails
+			name: "circuit breaker",
+			configure: func(h *RequestsHandler) {
+				h.CircuitBreakerThreshold = 1
+				h.CircuitBreakerWindow = time.Minute
+				h.CircuitBreakerCooldown = time.Minute
+			},
+			wantReason: ReasonCircuitOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &RequestsHandler{
+				DefaultTimezone:          "Europe/Berlin",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+			}
+			h.clientset = fake.NewSimpleClientset(tt.namespaces...)
+			tt.configure(h)
+			h.limitRate()
+			h.startCircuitBreaker()
+
+			for i := 0; i < 2; i++ {
+				review, err := decodeAdmissionReview(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				before := skippedRequests.snapshot()[tt.wantReason]
+				response, err := h.review(review)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				degraded := skippedRequests.snapshot()[tt.wantReason] > before
+				if degraded != (i == 1) {
+					t.Fatalf("review %d degraded = %t, want %t", i, degraded, i == 1)
+				}
+
+				if degraded && (!response.Response.Allowed || response.Response.Patch != nil || len(response.Response.Warnings) != 1) {
+					t.Errorf("degraded review response = %+v, want allowed without patch and with a warning", response.Response)
+				}
+			}
+		})
+	}
+
+	atomic.StoreInt32(&circuitBreakerOpen, 0)
+}
+
+func Test_isLoopbackAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{address: "localhost:6060", want: true},
+		{address: "127.0.0.1:6060", want: true},
+		{address: "[::1]:6060", want: true},
+		{address: ":6060", want: false},
+		{address: "0.0.0.0:6060", want: false},
+		{address: "10.0.0.1:6060", want: false},
+		{address: "localhost", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := isLoopbackAddress(tt.address); got != tt.want {
+				t.Errorf("isLoopbackAddress(%s) = %v, want %v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_resolveAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    []string
+		wantErr bool
+	}{
+		{address: ":8443", want: []string{":8443"}},
+		{address: "[::]:8443", want: []string{"[::]:8443"}},
+		{address: "0.0.0.0:8443", want: []string{"0.0.0.0:8443"}},
+		{address: "[fd00::10]:8443", want: []string{"[fd00::10]:8443"}},
+		{address: "localhost:8443", want: []string{"127.0.0.1:8443"}},
+		{address: "8443", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := resolveAddress(context.Background(), net.DefaultResolver, tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAddress(%s) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+
+			// localhost may resolve to ::1 too, depending on the hosts file
+			for _, want := range tt.want {
+				found := false
+				for _, a := range got {
+					found = found || a == want
+				}
+
+				if !found {
+					t.Errorf("resolveAddress(%s) = %v, want %s", tt.address, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_listen(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	socket := filepath.Join(t.TempDir(), "webhook.sock")
+	// a stale socket file of a previous run
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	h := NewAdmissionServer()
+	h.Addresses = []string{"127.0.0.1:0"}
+	h.UnixSocket = socket
+
+	listeners, err := h.listen(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listeners) != 2 || listeners[0].Addr().Network() != "tcp" || listeners[1].Addr().Network() != "unix" {
+		t.Fatalf("listen() = %v, want a tcp and a unix listener", listeners)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", h.health)
+	server := &http.Server{Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serveListeners(server, listeners[1:])
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	resp, err := client.Get("http://k8tz/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /health over the unix socket returned %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	server.Close()
+	listeners[0].Close()
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serveListeners() = %v, want %v", err, http.ErrServerClosed)
+	}
+
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("unix socket %s was not removed: %v", socket, err)
+	}
+}
+
+func TestServer_listen_reusePort(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	first := NewAdmissionServer()
+	first.ReusePort = true
+	l, err := first.listenTCP(context.Background(), "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	second := NewAdmissionServer()
+	second.Addresses = []string{l.Addr().String()}
+	if _, err := second.listen(context.Background()); err == nil {
+		t.Fatalf("listen() without --reuse-port on a used address succeeded")
+	}
+
+	second.ReusePort = true
+	listeners, err := second.listen(context.Background())
+	if err != nil {
+		t.Fatalf("listen() with --reuse-port error = %v", err)
+	}
+	listeners[0].Close()
+}
+
+func TestServer_listen_inherited(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	socket := filepath.Join(t.TempDir(), "webhook.sock")
+	previous := NewAdmissionServer()
+	previous.Addresses = []string{"127.0.0.1:0"}
+	previous.UnixSocket = socket
+	if _, err := previous.listen(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the listeners as the new process gets them
+	files, keys, err := previous.listenerFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"tcp:127.0.0.1:0", "unix:" + socket}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("listenerFiles() keys = %v, want %v", keys, want)
+	}
+
+	h := NewAdmissionServer()
+	h.Addresses = []string{"127.0.0.1:0"}
+	h.UnixSocket = socket
+	h.inherited = map[string]net.Listener{}
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		h.inherited[keys[i]] = l
+	}
+
+	removed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.inherited["tcp:127.0.0.1:9"] = removed
+
+	listeners, err := h.listen(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := listeners[0].Addr().String(), previous.listeners[0].Addr().String(); got != want {
+		t.Errorf("listen() = %s, want the inherited listener %s", got, want)
+	}
+
+	if h.inherited != nil {
+		t.Errorf("inherited listeners %v were not closed", h.inherited)
+	}
+
+	if _, err := removed.Accept(); err == nil {
+		t.Errorf("inherited listener of a removed address was not closed")
+	}
+
+	// closing the listeners of the previous process keeps the unix socket
+	for _, l := range previous.listeners {
+		l.Close()
+	}
+
+	if _, err := os.Stat(socket); err != nil {
+		t.Errorf("unix socket of the new process was removed: %v", err)
+	}
+
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+func Test_handoverEnviron(t *testing.T) {
+	t.Setenv(handoverListenersEnv, "tcp::8443")
+	t.Setenv(handoverParentEnv, "1")
+
+	for _, e := range handoverEnviron() {
+		if strings.HasPrefix(e, "K8TZ_HANDOVER_") {
+			t.Errorf("handoverEnviron() passes %s", e)
+		}
+	}
+}
+
+func TestRequestsHandler_review_events(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		namespaces []runtime.Object
+		wantType   string
+		wantReason string
+	}{
+		{
+			name:       "injected",
+			namespaces: []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			wantType:   corev1.EventTypeNormal,
+			wantReason: EventTimezoneInjected,
+		},
+		{
+			name:       "skipped",
+			namespaces: []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Annotations: map[string]string{"k8tz.io/inject": "false"}}}},
+			wantType:   corev1.EventTypeNormal,
+			wantReason: EventTimezoneInjectionSkipped,
+		},
+		{
+			name:       "invalid timezone annotation",
+			namespaces: []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Annotations: map[string]string{"k8tz.io/timezone": "Mars/Olympus"}}}},
+			wantType:   corev1.EventTypeWarning,
+			wantReason: EventInvalidTimezoneAnnotation,
+		},
+		{
+			// the namespace does not exist, so the lookup fails
+			name:       "failed",
+			wantType:   corev1.EventTypeWarning,
+			wantReason: EventTimezoneInjectionFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clientset := fake.NewSimpleClientset(tt.namespaces...)
+			h := &RequestsHandler{
+				DefaultTimezone:          "Europe/Berlin",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				ZoneInfoPath:             inject.DefaultZoneInfoPath,
+				EmitEvents:               true,
+			}
+			h.clientset = clientset
+
+			if _, err := h.review(review); err != nil {
+				t.Fatal(err)
+			}
+
+			// events are created in the background
+			var events *corev1.EventList
+			for i := 0; i < 100; i++ {
+				events, err = clientset.CoreV1().Events("default").List(context.TODO(), v1.ListOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(events.Items) > 0 {
+					break
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			if len(events.Items) != 1 {
+				t.Fatalf("events = %+v, want exactly 1 event", events.Items)
+			}
+
+			event := events.Items[0]
+			if event.Type != tt.wantType || event.Reason != tt.wantReason {
+				t.Errorf("event = %s/%s, want %s/%s (message=%s)", event.Type, event.Reason, tt.wantType, tt.wantReason, event.Message)
+			}
+
+			if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != "elasticsearch-master-0" {
+				t.Errorf("event involved object = %+v, want Pod elasticsearch-master-0", event.InvolvedObject)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_review_auditLog(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	infoLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}
+	tests := []struct {
+		name         string
+		namespaces   []runtime.Object
+		allowOnError bool
+		dryRun       bool
+		wantOutcome  AuditOutcome
+		wantReason   Reason
+		wantHash     bool
+	}{
+		{
+			name:        "mutated",
+			namespaces:  []runtime.Object{namespace},
+			wantOutcome: AuditMutated,
+			wantHash:    true,
+		},
+		{
+			name:        "mutated in dry-run",
+			namespaces:  []runtime.Object{namespace},
+			dryRun:      true,
+			wantOutcome: AuditMutated,
+			wantHash:    true,
+		},
+		{
+			name:        "skipped",
+			namespaces:  []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Annotations: map[string]string{"k8tz.io/inject": "false"}}}},
+			wantOutcome: AuditSkipped,
+			wantReason:  ReasonDisabled,
+		},
+		{
+			// the namespace does not exist, so the lookup fails
+			name:        "rejected",
+			wantOutcome: AuditRejected,
+			wantReason:  ReasonLookupFailed,
+		},
+		{
+			name:         "allowed on error",
+			allowOnError: true,
+			wantOutcome:  AuditAllowedOnError,
+			wantReason:   ReasonLookupFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := &bytes.Buffer{}
+			h := &RequestsHandler{
+				DefaultTimezone:          "Europe/Berlin",
+				DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+				InjectByDefault:          true,
+				AllowOnError:             tt.allowOnError,
+				DryRun:                   tt.dryRun,
+				auditSink:                &streamAuditSink{out: out},
+			}
+			h.clientset = fake.NewSimpleClientset(tt.namespaces...)
+
+			if _, err := h.review(review); err != nil {
+				t.Fatal(err)
+			}
+
+			var record AuditRecord
+			if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+				t.Fatalf("audit record %q: %v", out.String(), err)
+			}
+
+			if record.Outcome != tt.wantOutcome || record.Reason != tt.wantReason || record.DryRun != tt.dryRun {
+				t.Errorf("audit record = %+v, want outcome %s, reason %q and dryRun %t", record, tt.wantOutcome, tt.wantReason, tt.dryRun)
+			}
+
+			if record.UID != "0c0829ff-c2f5-4634-a1c3-098147304d03" || record.Name != "elasticsearch-master-0" || record.Workload != "StatefulSet/elasticsearch-master" {
+				t.Errorf("audit record = %+v, want the pod elasticsearch-master-0 of StatefulSet/elasticsearch-master", record)
+			}
+
+			if got := strings.HasPrefix(record.PatchHash, "sha256:"); got != tt.wantHash {
+				t.Errorf("audit record patch hash = %q, want hash %t", record.PatchHash, tt.wantHash)
+			}
+
+			if tt.wantHash && (record.Timezone != "Europe/Berlin" || record.Strategy != inject.InitContainerInjectionStrategy || record.Patches == 0) {
+				t.Errorf("audit record = %+v, want patches with timezone Europe/Berlin and strategy initContainer", record)
+			}
+		})
+	}
+}
+
+func Test_fileAuditSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewAuditSink("file://"+path, 0, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate after every record
+	sink.(*fileAuditSink).maxSize = 1
+	for _, uid := range []string{"1", "2", "3", "4"} {
+		if err := sink.Write(&AuditRecord{UID: uid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, wantUID := range map[string]string{path: "4", path + ".1": "3", path + ".2": "2"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var record AuditRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.UID != wantUID {
+			t.Errorf("%s = %s, want the record of uid %s", file, data, wantUID)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("rotated file %s.3 exists, want only 2 backups", path)
+	}
+}
+
+func Test_fileAuditSink_failedRotation(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewAuditSink(path, 0, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	// a directory with a file cannot be replaced by the rotated file
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	sink.(*fileAuditSink).maxSize = 1
+	for _, uid := range []string{"1", "2"} {
+		if err := sink.Write(&AuditRecord{UID: uid}); err != nil {
+			t.Fatalf("Write() after a failed rotation error = %v", err)
+		}
+	}
+
+	if got := readAuditUIDs(t, path); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("records of %s = %v, want [1 2] written to the file that could not be rotated", path, got)
+	}
+
+	// the next rotation succeeds once the backup can be written again
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Write(&AuditRecord{UID: "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readAuditUIDs(t, path); !reflect.DeepEqual(got, []string{"3"}) {
+		t.Errorf("records of %s = %v, want [3]", path, got)
+	}
+
+	if got := readAuditUIDs(t, path+".1"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("records of %s.1 = %v, want [1 2]", path, got)
+	}
+}
+
+// readAuditUIDs returns the uids of the records of an audit log file
+func readAuditUIDs(t *testing.T, file string) []string {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var uids []string
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var record AuditRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, record.UID)
+	}
+
+	return uids
+}
+
+func Test_webhookAuditSink(t *testing.T) {
+	received := make(chan AuditRecord, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record AuditRecord
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		received <- record
+	}))
+	defer server.Close()
+
+	sink, err := NewAuditSink(server.URL, DefaultAuditLogMaxSize, DefaultAuditLogMaxBackups, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uid := range []string{"1", "2"} {
+		if err := sink.Write(&AuditRecord{UID: uid, Outcome: AuditMutated}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// close sends the buffered records
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	close(received)
+	var uids []string
+	for record := range received {
+		uids = append(uids, record.UID)
+	}
+
+	if !reflect.DeepEqual(uids, []string{"1", "2"}) {
+		t.Errorf("received records = %v, want [1 2]", uids)
+	}
+}
+
+func Test_fileAuditSink_compress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewAuditSink(path, 0, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate after every record
+	sink.(*fileAuditSink).maxSize = 1
+	for _, uid := range []string{"1", "2", "3", "4"} {
+		if err := sink.Write(&AuditRecord{UID: uid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, wantUID := range map[string]string{path + ".1.gz": "3", path + ".2.gz": "2"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+			t.Fatalf("%s is not gzipped: %q", file, data)
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var record AuditRecord
+		if err := json.NewDecoder(zr).Decode(&record); err != nil || record.UID != wantUID {
+			t.Errorf("%s = %+v, want the record of uid %s", file, record, wantUID)
+		}
+	}
+
+	for _, file := range []string{path + ".1", path + ".3.gz"} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("rotated file %s exists, want only 2 compressed backups", file)
+		}
+	}
+}
+
+func Test_webhookAuditSink_compress(t *testing.T) {
+	received := make(chan AuditRecord, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			http.Error(w, "body is not gzipped", http.StatusBadRequest)
+			return
+		}
+
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var record AuditRecord
+		if err := json.NewDecoder(zr).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		received <- record
+	}))
+	defer server.Close()
+
+	sink, err := NewAuditSink(server.URL, DefaultAuditLogMaxSize, DefaultAuditLogMaxBackups, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := AuditRecord{UID: "1", Kind: "Pod", Namespace: "default", Outcome: AuditMutated}
+	if err := sink.Write(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	close(received)
+	got, ok := <-received
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("received record = %+v, want %+v", got, want)
+	}
+}
+
+func Test_decodeAdmissionReview(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{
+			name: "v1",
+			data: `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1","request":{"uid":"1"}}`,
+		},
+		{
+			name: "v1beta1",
+			data: `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1beta1","request":{"uid":"1"}}`,
+		},
+		{
+			name:    "unsupported version",
+			data:    `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v2","request":{"uid":"1"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing type",
+			data:    `{"request":{"uid":"1"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "missing request",
+			data:    `{"kind":"AdmissionReview","apiVersion":"admission.k8s.io/v1"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeAdmissionReview() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			// the response is sent in the version of the request
+			response, err := (&RequestsHandler{}).review(review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.APIVersion != review.APIVersion || response.Kind != "AdmissionReview" {
+				t.Errorf("review() type = %+v, want %+v", response.TypeMeta, review.TypeMeta)
+			}
+		})
+	}
+}
+
+func TestServer_explain(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+	t.Cleanup(func() { SetTimezonePolicy(nil) })
+
+	// the keys of the Decision contract, they must never change within the
+	// same DecisionAPIVersion
+	keys := []string{"allowed", "apiVersion", "inject", "kind", "message", "name", "namespace", "reason", "strategy", "timezone", "timezoneFormat"}
+
+	tests := []struct {
+		name        string
+		pod         string
+		query       string
+		policy      *TimezonePolicy
+		namespaces  []runtime.Object
+		goldenFile  string
+		wantAllowed bool
+		wantInject  bool
+	}{
+		{
+			name:        "injected",
+			pod:         `{"metadata":{"name":"app","namespace":"default"}}`,
+			namespaces:  []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			goldenFile:  "testdata/explain-injected.json",
+			wantAllowed: true,
+			wantInject:  true,
+		},
+		{
+			name:        "namespace from query",
+			pod:         `{"metadata":{"name":"app","annotations":{"k8tz.io/timezone":"Europe/Berlin","k8tz.io/strategy":"hostPath"}}}`,
+			query:       "?namespace=default",
+			namespaces:  []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			goldenFile:  "testdata/explain-annotated.json",
+			wantAllowed: true,
+			wantInject:  true,
+		},
+		{
+			name:        "disabled",
+			pod:         `{"metadata":{"name":"app","namespace":"default","annotations":{"k8tz.io/inject":"false"}}}`,
+			namespaces:  []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			goldenFile:  "testdata/explain-disabled.json",
+			wantAllowed: true,
+		},
+		{
+			name:        "excluded namespace",
+			pod:         `{"metadata":{"name":"app","namespace":"k8tz"}}`,
+			goldenFile:  "testdata/explain-excluded.json",
+			wantAllowed: true,
+		},
+		{
+			name:        "denied timezone",
+			pod:         `{"metadata":{"name":"app","namespace":"default","annotations":{"k8tz.io/timezone":"Asia/Tokyo"}}}`,
+			policy:      &TimezonePolicy{Allow: []string{"Europe/*", "UTC"}},
+			namespaces:  []runtime.Object{&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}},
+			goldenFile:  "testdata/explain-denied.json",
+			wantAllowed: false,
+		},
+		{
+			name:        "fail-open on error",
+			pod:         `{"metadata":{"name":"app","namespace":"missing","annotations":{"k8tz.io/failOpen":"true"}}}`,
+			goldenFile:  "testdata/explain-fail-open.json",
+			wantAllowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTimezonePolicy(tt.policy)
+
+			s := NewAdmissionServer()
+			s.Handler.InstallNamespace = "k8tz"
+			s.Handler.SetClientset(fake.NewSimpleClientset(tt.namespaces...))
+
+			req, err := http.NewRequest(http.MethodPost, "/explain"+tt.query, strings.NewReader(tt.pod))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.explain).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("explain returned wrong status code: got %v want %v, body: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+
+			var decision map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &decision); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for k := range decision {
+				got = append(got, k)
+			}
+			sort.Strings(got)
+
+			if fmt.Sprint(got) != fmt.Sprint(keys) {
+				t.Errorf("decision keys = %v, want %v", got, keys)
+			}
+
+			if decision["allowed"] != tt.wantAllowed || decision["inject"] != tt.wantInject {
+				t.Errorf("decision allowed/inject = %v/%v, want %v/%v", decision["allowed"], decision["inject"], tt.wantAllowed, tt.wantInject)
+			}
+
+			if err := compareReviews(rr.Body, tt.goldenFile); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestServer_explain_badRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{name: "not POST", method: http.MethodGet, body: "", want: http.StatusMethodNotAllowed},
+		{name: "not a pod", method: http.MethodPost, body: "[]", want: http.StatusBadRequest},
+		{name: "no namespace", method: http.MethodPost, body: `{"metadata":{"name":"app"}}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+
+			req, err := http.NewRequest(tt.method, "/explain", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.explain).ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("explain returned wrong status code: got %v want %v", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_metrics(t *testing.T) {
+	errorLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review, err := decodeAdmissionReview(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAdmissionServer()
+	s.Handler.InstallNamespace = ""
+	s.Handler.SetClientset(fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}}))
+
+	scrape := func() string {
+		req, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(s.metrics).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("metrics returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+
+		return rr.Body.String()
+	}
+
+	// value returns the value of the sample, or -1 if it is missing
+	value := func(metrics string, sample string) int {
+		for _, line := range strings.Split(metrics, "\n") {
+			if strings.HasPrefix(line, sample+" ") {
+				var v int
+				if _, err := fmt.Sscan(strings.TrimPrefix(line, sample+" "), &v); err != nil {
+					t.Fatalf("invalid sample %q: %v", line, err)
+				}
+				return v
+			}
+		}
+		return -1
+	}
+
+	samples := []string{
+		"k8tz_admission_reviews_total",
+		`k8tz_injections_total{kind="Pod",namespace="default"}`,
+		`k8tz_patch_generation_duration_seconds_bucket{le="+Inf"}`,
+		"k8tz_patch_generation_duration_seconds_count",
+		"k8tz_tls_handshake_failures_total",
+	}
+
+	before := scrape()
+	if _, err := s.Handler.review(review); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(tlsErrorWriter{}, "http: TLS handshake error from 10.0.0.1:1234: EOF\n"); err != nil {
+		t.Fatal(err)
+	}
+	after := scrape()
+
+	for _, sample := range samples {
+		want := value(before, sample) + 1
+		if want == 0 {
+			want = 1
+		}
+
+		if got := value(after, sample); got != want {
+			t.Errorf("%s = %d, want %d", sample, got, want)
+		}
+	}
+
+	if value(after, `k8tz_admission_skipped_total{reason="disabled"}`) < 0 {
+		t.Errorf("skipped requests should be exposed for every reason:\n%s", after)
+	}
+}
+
+// writeCertificate writes a self-signed certificate valid in the period with
+// its key to the files, and returns the serial number
+func writeCertificate(t *testing.T, certFile string, keyFile string, notBefore time.Time, notAfter time.Time) *big.Int {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "k8tz.k8tz.svc"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return serial
+}
+
+func Test_certificateLoader(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	serial := func(l *certificateLoader) *big.Int {
+		cert, err := l.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Leaf.SerialNumber
+	}
+
+	// missing files are tolerated and loaded on the first handshake
+	l, err := newCertificateLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertificateLoader() with missing files should not fail: %v", err)
+	}
+
+	if _, err := l.GetCertificate(nil); err == nil {
+		t.Errorf("GetCertificate() without certificate should fail")
+	}
+
+	first := writeCertificate(t, certFile, keyFile, now.Add(-time.Hour), now.Add(time.Hour))
+	if got := serial(l); got.Cmp(first) != 0 {
+		t.Errorf("GetCertificate() serial = %s, want %s", got, first)
+	}
+
+	// unchanged files are not reloaded
+	if changed, err := l.reload(); changed || err != nil {
+		t.Errorf("reload() of unchanged files = %v, %v, want false, nil", changed, err)
+	}
+
+	// a rotated certificate replaces the cached one and its load time is
+	// exported
+	loadedAt := now.Add(time.Minute).Truncate(time.Second)
+	l.now = func() time.Time { return loadedAt }
+	second := writeCertificate(t, certFile, keyFile, now.Add(-time.Hour), now.Add(time.Hour))
+	if changed, err := l.reload(); !changed || err != nil {
+		t.Errorf("reload() of rotated files = %v, %v, want true, nil", changed, err)
+	}
+
+	if got := metricValue(t, "k8tz_cert_last_loaded_timestamp_seconds"); int64(got) != loadedAt.Unix() {
+		t.Errorf("k8tz_cert_last_loaded_timestamp_seconds = %d, want %d", got, loadedAt.Unix())
+	}
+
+	if got := serial(l); got.Cmp(second) != 0 {
+		t.Errorf("GetCertificate() serial after rotation = %s, want %s", got, second)
+	}
+
+	// an expired certificate is rejected and the previous one is kept
+	l.now = func() time.Time { return loadedAt.Add(time.Minute) }
+	writeCertificate(t, certFile, keyFile, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if _, err := l.reload(); err == nil {
+		t.Errorf("reload() of expired certificate should fail")
+	}
+
+	if got := metricValue(t, "k8tz_cert_last_loaded_timestamp_seconds"); int64(got) != loadedAt.Unix() {
+		t.Errorf("k8tz_cert_last_loaded_timestamp_seconds after a failed reload = %d, want %d", got, loadedAt.Unix())
+	}
+
+	if got := serial(l); got.Cmp(second) != 0 {
+		t.Errorf("GetCertificate() serial after invalid rotation = %s, want %s", got, second)
+	}
+
+	// an invalid certificate fails on startup
+	if _, err := newCertificateLoader(certFile, keyFile); err == nil {
+		t.Errorf("newCertificateLoader() with expired certificate should fail")
+	}
+}
+
+func Test_certificateLoader_watch(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	writeCertificate(t, certFile, keyFile, now.Add(-time.Hour), now.Add(time.Hour))
+	l, err := newCertificateLoader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.watch(10*time.Millisecond, 5*time.Millisecond, stop)
+
+	rotated := writeCertificate(t, certFile, keyFile, now.Add(-time.Hour), now.Add(time.Hour))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := l.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cert.Leaf.SerialNumber.Cmp(rotated) == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_jitteredInterval(t *testing.T) {
+	interval, jitter := time.Minute, 10*time.Second
+
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 1000; i++ {
+		wait := jitteredInterval(interval, jitter)
+		if wait < interval || wait > interval+jitter {
+			t.Fatalf("jitteredInterval(%v, %v) = %v, want between %v and %v", interval, jitter, wait, interval, interval+jitter)
+		}
+		seen[wait] = true
+	}
+
+	if len(seen) < 2 {
+		t.Errorf("jitteredInterval(%v, %v) is not random: %v", interval, jitter, seen)
+	}
+
+	if wait := jitteredInterval(interval, 0); wait != interval {
+		t.Errorf("jitteredInterval(%v, 0) = %v, want %v", interval, wait, interval)
+	}
+}
+
+func TestNewAdmissionServer_tlsDefaults(t *testing.T) {
+	s := NewAdmissionServer()
+
+	version, err := cliflag.TLSVersion(s.TLSMinVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != tls.VersionTLS12 {
+		t.Errorf("default minimum TLS version = %x, want %x", version, tls.VersionTLS12)
+	}
+
+	if len(s.TLSCipherSuites) != 0 {
+		t.Errorf("default cipher suites = %v, want the Go defaults", s.TLSCipherSuites)
+	}
+}
+
+func Test_warnInsecureCipherSuites(t *testing.T) {
+	var out bytes.Buffer
+	warningLogger.SetOutput(&out)
+	defer warningLogger.SetOutput(io.Discard)
+
+	warnInsecureCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"})
+
+	if got := out.String(); !strings.Contains(got, "TLS_RSA_WITH_RC4_128_SHA") || strings.Contains(got, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256") {
+		t.Errorf("warnInsecureCipherSuites() logged %q, want only the insecure suite", got)
+	}
+}
+
+func TestServer_serve_drain(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAdmissionServer()
+	s.ShutdownDelay = 100 * time.Millisecond
+	s.ShutdownTimeout = 5 * time.Second
+
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.health)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{Handler: mux}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ctx, server, func() error { return server.Serve(listener) })
+	}()
+
+	url := "http://" + listener.Addr().String()
+	status := func(path string) int {
+		resp, err := http.Get(url + path)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("/health"); got != http.StatusOK {
+		t.Fatalf("health before shutdown = %d, want %d", got, http.StatusOK)
+	}
+
+	inflight := make(chan int, 1)
+	go func() { inflight <- status("/slow") }()
+	<-started
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	// during the shutdown delay requests are still served, but the health
+	// check fails so the pod is removed from the endpoints
+	if got := status("/health"); got != http.StatusServiceUnavailable {
+		t.Errorf("health while draining = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+
+	close(release)
+	if got := <-inflight; got != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want %d", got, http.StatusOK)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("serve() error = %v", err)
+	}
+
+	if got := status("/health"); got != 0 {
+		t.Errorf("server should not accept connections after shutdown, got status %d", got)
+	}
+}
+
+func TestServer_serve_listenError(t *testing.T) {
+	s := NewAdmissionServer()
+	want := errors.New("address already in use")
+
+	if err := s.serve(context.Background(), &http.Server{}, func() error { return want }); !errors.Is(err, want) {
+		t.Errorf("serve() error = %v, want %v", err, want)
+	}
+}
+
+func TestServer_readyz(t *testing.T) {
+	valid := &certificateLoader{cert: &tls.Certificate{Leaf: &x509.Certificate{NotAfter: time.Now().Add(time.Hour)}}}
+	expired := &certificateLoader{cert: &tls.Certificate{Leaf: &x509.Certificate{NotAfter: time.Now().Add(-time.Hour)}}}
+
+	tests := []struct {
+		name        string
+		certificate *certificateLoader
+		connected   bool
+		unreachable bool
+		draining    bool
+		unsynced    bool
+		want        int
+	}{
+		{name: "ready", certificate: valid, connected: true, want: http.StatusOK},
+		{name: "caches not synced", certificate: valid, connected: true, unsynced: true, want: http.StatusServiceUnavailable},
+		{name: "no certificate loader", certificate: nil, connected: true, want: http.StatusServiceUnavailable},
+		{name: "certificate not loaded", certificate: &certificateLoader{}, connected: true, want: http.StatusServiceUnavailable},
+		{name: "expired certificate", certificate: expired, connected: true, want: http.StatusServiceUnavailable},
+		{name: "not connected", certificate: valid, connected: false, want: http.StatusServiceUnavailable},
+		{name: "api unreachable", certificate: valid, connected: true, unreachable: true, want: http.StatusServiceUnavailable},
+		{name: "draining", certificate: valid, connected: true, draining: true, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.certificate = tt.certificate
+			if tt.connected {
+				clientset := fake.NewSimpleClientset()
+				if tt.unreachable {
+					clientset.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+						return true, nil, errors.New("connection refused")
+					})
+				}
+				s.Handler.SetClientset(clientset)
+			}
+			if tt.draining {
+				s.draining = 1
+			}
+			if tt.unsynced {
+				s.Handler.cacheSynced = []cache.InformerSynced{func() bool { return false }}
+			}
+
+			health := s.healthServer().Handler
+			for path, want := range map[string]int{"/readyz": tt.want, "/healthz": http.StatusOK} {
+				req, err := http.NewRequest(http.MethodGet, path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				rr := httptest.NewRecorder()
+				health.ServeHTTP(rr, req)
+				if rr.Code != want {
+					t.Errorf("%s returned wrong status code: got %v want %v, body: %s", path, rr.Code, want, rr.Body)
+				}
+			}
+
+			wantReady := 0
+			if tt.want == http.StatusOK {
+				wantReady = 1
+			}
+
+			if got := metricValue(t, "k8tz_ready"); got != wantReady {
+				t.Errorf("k8tz_ready = %d, want %d", got, wantReady)
+			}
+		})
+	}
+}
+
+func TestServer_updateReady(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		atomic.StoreInt32(&circuitBreakerOpen, 0)
+		atomic.StoreInt32(&serverReady, 0)
+	})
+
+	var synced int32
+	s := NewAdmissionServer()
+	s.Handler.SetClientset(fake.NewSimpleClientset())
+	s.Handler.cacheSynced = []cache.InformerSynced{func() bool { return atomic.LoadInt32(&synced) == 1 }}
+	s.certificate = &certificateLoader{cert: &tls.Certificate{Leaf: &x509.Certificate{NotAfter: time.Now().Add(time.Hour)}}}
+
+	s.updateReady()
+	if got := metricValue(t, "k8tz_ready"); got != 0 {
+		t.Errorf("k8tz_ready before the caches are synced = %d, want 0", got)
+	}
+
+	// the caches sync without a readiness check
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.updateReadyOnCacheSync(nil)
+	}()
+	atomic.StoreInt32(&synced, 1)
+	<-done
+
+	if got := metricValue(t, "k8tz_ready"); got != 1 {
+		t.Errorf("k8tz_ready after the caches are synced = %d, want 1", got)
+	}
+
+	// the circuit breaker opens and closes between the readiness checks
+	now := time.Now()
+	breaker := &circuitBreaker{threshold: 1, window: time.Minute, cooldown: time.Second, changed: s.updateReady}
+	breaker.record(now, true, false)
+	if got := metricValue(t, "k8tz_ready"); got != 0 {
+		t.Errorf("k8tz_ready while the circuit breaker is open = %d, want 0", got)
+	}
+
+	breaker.allow(now.Add(2 * time.Second))
+	breaker.record(now.Add(2*time.Second), false, true)
+	if got := metricValue(t, "k8tz_ready"); got != 1 {
+		t.Errorf("k8tz_ready after the circuit breaker closed = %d, want 1", got)
+	}
+
+	// draining
+	atomic.StoreInt32(&s.draining, 1)
+	s.updateReady()
+	if got := metricValue(t, "k8tz_ready"); got != 0 {
+		t.Errorf("k8tz_ready while draining = %d, want 0", got)
+	}
+}
+
+func TestServer_statusz(t *testing.T) {
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	valid := &certificateLoader{cert: &tls.Certificate{Leaf: &x509.Certificate{NotAfter: notAfter}}}
+
+	tests := []struct {
+		name        string
+		unreachable bool
+		unsynced    bool
+		want        Status
+	}{
+		{
+			name: "ready",
+			want: Status{Ready: true, CachesSynced: true, API: APIStatus{Connected: true}},
+		},
+		{
+			name:     "caches not synced",
+			unsynced: true,
+			want:     Status{Message: "informer caches are not synced", API: APIStatus{Connected: true}},
+		},
+		{
+			name:        "api unreachable",
+			unreachable: true,
+			want:        Status{Message: "kubernetes api is not reachable", CachesSynced: true, API: APIStatus{Error: "connection refused"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.certificate = valid
+			s.Handler.TzdataVersion = "2023c"
+			clientset := fake.NewSimpleClientset()
+			if tt.unreachable {
+				clientset.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+			}
+			s.Handler.SetClientset(clientset)
+			if tt.unsynced {
+				s.Handler.cacheSynced = []cache.InformerSynced{func() bool { return false }}
+			}
+
+			req, err := http.NewRequest(http.MethodGet, "/statusz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			s.healthServer().Handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("/statusz returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			got := Status{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			want.Version = got.Version
+			want.TzdataVersion = "2023c"
+			want.BundledTzdata = tzdata.Version()
+			want.Certificate = CertificateStatus{Loaded: true, NotAfter: &notAfter}
+			want.ConfigHash = s.Handler.configHash()
+			want.Crypto = CryptoStatus{Policy: DefaultCryptoPolicy, Backend: "go"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("/statusz = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_configHash(t *testing.T) {
+	h := NewRequestsHandler()
+	hash := h.configHash()
+	if !strings.HasPrefix(hash, "sha256:") || hash != h.configHash() {
+		t.Fatalf("configHash() = %q, want a stable sha256", hash)
+	}
+
+	h.DefaultTimezone = "Asia/Tokyo"
+	if h.configHash() == hash {
+		t.Errorf("configHash() did not change with the configuration")
+	}
+}
+
+func TestServer_zones(t *testing.T) {
+	tests := []struct {
+		name        string
+		zoneinfo    string
+		wantSource  string
+		wantVersion string
+		wantZones   []string
+	}{
+		{
+			name:       "zoneinfo directory",
+			zoneinfo:   "../inject/testdata/zoneinfo",
+			wantSource: "../inject/testdata/zoneinfo",
+			wantZones:  []string{"America/New_York", "Asia/Tokyo", "Europe/Berlin"},
+		},
+		{
+			name:        "embedded tz database",
+			zoneinfo:    filepath.Join(t.TempDir(), "zoneinfo"),
+			wantSource:  inject.EmbeddedZoneInfo,
+			wantVersion: tzdata.Version(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.Handler.ZoneInfoPath = tt.zoneinfo
+
+			req, err := http.NewRequest(http.MethodGet, "/zones", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(s.zones).ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("/zones returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+			}
+
+			got := ZoneList{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Source != tt.wantSource || got.Version != tt.wantVersion || got.BundledVersion != tzdata.Version() {
+				t.Errorf("/zones source=%s, version=%s, bundledVersion=%s, want %s, %s, %s", got.Source, got.Version, got.BundledVersion, tt.wantSource, tt.wantVersion, tzdata.Version())
+			}
+
+			if tt.wantZones != nil && !reflect.DeepEqual(got.Zones, tt.wantZones) {
+				t.Errorf("/zones = %v, want %v", got.Zones, tt.wantZones)
+			}
+
+			if len(got.Zones) == 0 || !sort.StringsAreSorted(got.Zones) {
+				t.Errorf("/zones = %v, want sorted timezones", got.Zones)
+			}
+		})
+	}
+}
+
+func TestServer_register(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	certFile := filepath.Join(t.TempDir(), "tls.crt")
+	if err := os.WriteFile(certFile, []byte("serving certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewAdmissionServer()
+	s.TLSCertFile = certFile
+	s.Registration.Enabled = true
+	s.Registration.TimeoutSeconds = 5
+	s.Handler.InstallNamespace = "k8tz"
+	s.Handler.ExcludedNamespaces = []string{"kube-system", "team-*"}
+	s.Handler.NamespaceSelector = "env=dev"
+	clientset := fake.NewSimpleClientset()
+	s.Handler.clientset = clientset
+	if err := s.validateRegistration(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	configurations := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	if err := s.register(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err := configurations.Get(ctx, "k8tz", v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := registered.Webhooks[0]
+	if string(webhook.ClientConfig.CABundle) != "serving certificate" {
+		t.Errorf("caBundle = %q, want the serving certificate", webhook.ClientConfig.CABundle)
+	}
+
+	if service := webhook.ClientConfig.Service; service.Namespace != "k8tz" || service.Name != "k8tz" || *service.Port != 443 {
+		t.Errorf("service = %+v, want k8tz/k8tz:443", service)
+	}
+
+	if *webhook.TimeoutSeconds != 5 || *webhook.ReinvocationPolicy != "Never" || *webhook.FailurePolicy != "Fail" {
+		t.Errorf("webhook = %+v, want timeout 5, reinvocation Never and failure policy Fail", webhook)
+	}
+
+	if len(webhook.Rules) != 3 {
+		t.Errorf("rules = %+v, want pods, ephemeral containers and cronjobs", webhook.Rules)
+	}
+
+	wantSelector := &v1.LabelSelector{
+		MatchLabels: map[string]string{"env": "dev"},
+		MatchExpressions: []v1.LabelSelectorRequirement{
+			{Key: "k8tz.io/controller-namespace", Operator: v1.LabelSelectorOpNotIn, Values: []string{"true"}},
+			{Key: "kubernetes.io/metadata.name", Operator: v1.LabelSelectorOpNotIn, Values: []string{"k8tz", "kube-system"}},
+		},
+	}
+	if !reflect.DeepEqual(webhook.NamespaceSelector, wantSelector) {
+		t.Errorf("namespaceSelector = %+v, want %+v", webhook.NamespaceSelector, wantSelector)
+	}
+
+	// the caBundle is kept, e.g. when it is injected by cert-manager
+	registered.Webhooks[0].ClientConfig.CABundle = []byte("injected ca")
+	if _, err := configurations.Update(ctx, registered, v1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	clientset.ClearActions()
+	if err := s.register(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() != "get" {
+			t.Errorf("unchanged registration was updated: %v", action)
+		}
+	}
+
+	s.Handler.InjectWorkloads = true
+	s.Handler.Reinvocation = true
+	if err := s.register(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err = configurations.Get(ctx, "k8tz", v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook = registered.Webhooks[0]
+	if len(webhook.Rules) != 5 || *webhook.ReinvocationPolicy != "IfNeeded" {
+		t.Errorf("webhook = %+v, want the workloads rules and reinvocation IfNeeded", webhook)
+	}
+
+	if string(webhook.ClientConfig.CABundle) != "injected ca" {
+		t.Errorf("caBundle = %q, want the injected ca to be kept", webhook.ClientConfig.CABundle)
+	}
+
+	if err := s.unregister(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := configurations.Get(ctx, "k8tz", v1.GetOptions{}); err == nil {
+		t.Errorf("unregister() did not remove the configuration")
+	}
+
+	if err := s.unregister(ctx); err != nil {
+		t.Errorf("unregister() of a removed configuration error = %v", err)
+	}
+}
+
+func TestServer_register_notManaged(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	s := NewAdmissionServer()
+	s.Registration.Enabled = true
+	s.Handler.InstallNamespace = "k8tz"
+	s.Handler.clientset = fake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: v1.ObjectMeta{Name: "k8tz", Labels: map[string]string{"app.kubernetes.io/managed-by": "Helm"}},
+	})
+
+	if err := s.register(context.Background()); err == nil {
+		t.Errorf("register() replaced a configuration managed by Helm")
+	}
+
+	if err := s.unregister(context.Background()); err == nil {
+		t.Errorf("unregister() removed a configuration managed by Helm")
+	}
+}
+
+func TestServer_validateRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Server)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(*Server) {}},
+		{name: "grpc only", modify: func(s *Server) { s.ServeMode = ServeModeGRPC }, wantErr: true},
+		{name: "missing install namespace", modify: func(s *Server) { s.Handler.InstallNamespace = "" }, wantErr: true},
+		{name: "unknown failure policy", modify: func(s *Server) { s.Registration.FailurePolicy = "Retry" }, wantErr: true},
+		{name: "timeout too long", modify: func(s *Server) { s.Registration.TimeoutSeconds = 60 }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAdmissionServer()
+			s.Registration.Enabled = true
+			s.Handler.InstallNamespace = "k8tz"
+			tt.modify(s)
+
+			if err := s.validateRegistration(); (err != nil) != tt.wantErr {
+				t.Errorf("validateRegistration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKustomize_Generate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Kustomize)
+		wantErr bool
+	}{
+		{name: "default", modify: func(*Kustomize) {}},
+		{
+			name: "cluster issuer",
+			modify: func(k *Kustomize) {
+				k.Server.Handler.InstallNamespace = "timezones"
+				k.Server.Handler.InjectWorkloads = true
+				k.Server.Handler.AutoTimezone = true
+				k.Server.Handler.CronJobOwners = true
+				k.Server.Handler.Reinvocation = true
+				k.Server.Handler.ExcludedNamespaces = []string{"kube-system", "team-*"}
+				k.Server.Handler.ObjectSelector = "k8tz.io/inject=true"
+				k.Server.Registration.Name = "tz"
+				k.Server.Registration.ServiceName = "tz-webhook"
+				k.Server.Registration.FailurePolicy = "Ignore"
+				k.Server.Registration.TimeoutSeconds = 5
+				k.Server.Registration.EphemeralContainers = false
+				k.Args = []string{"--timezone=Europe/London", "--inject-workloads=true", "--auto-timezone=true"}
+				k.Issuer = "ca-issuer"
+				k.IssuerKind = "ClusterIssuer"
+			},
+		},
+		{name: "missing install namespace", modify: func(k *Kustomize) { k.Server.Handler.InstallNamespace = "" }, wantErr: true},
+		{name: "invalid handler", modify: func(k *Kustomize) { k.Server.Handler.HostPathType = "File" }, wantErr: true},
+		{name: "unknown failure policy", modify: func(k *Kustomize) { k.Server.Registration.FailurePolicy = "Retry" }, wantErr: true},
+		{name: "unknown issuer kind", modify: func(k *Kustomize) { k.IssuerKind = "Certificate" }, wantErr: true},
+		{name: "cluster issuer without name", modify: func(k *Kustomize) { k.IssuerKind = "ClusterIssuer" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKustomize()
+			k.Server.Handler.InstallNamespace = "k8tz"
+			k.Image = "quay.io/k8tz/k8tz:test"
+			tt.modify(&k)
+
+			files, err := k.Generate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			goldenDir := filepath.Join("testdata", "kustomize", strings.ReplaceAll(tt.name, " ", "-"))
+			goldens := 0
+			err = filepath.WalkDir(goldenDir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+
+				goldens++
+				name := filepath.ToSlash(strings.TrimPrefix(path, goldenDir+string(filepath.Separator)))
+				data, ok := files[name]
+				if !ok {
+					return fmt.Errorf("%s is not generated", name)
+				}
+
+				return compareReviews(bytes.NewBuffer(data), path)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if goldens != len(files) {
+				t.Errorf("Generate() returned %d files, want the %d files of %s", len(files), goldens, goldenDir)
+			}
+		})
+	}
+}
+
+func TestKustomize_Write(t *testing.T) {
+	k := NewKustomize()
+	k.Server.Handler.InstallNamespace = "k8tz"
+	dir := t.TempDir()
+
+	if err := k.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"kustomization.yaml", "base/kustomization.yaml", "base/deployment.yaml", "components/webhook/kustomization.yaml", "components/webhook/mutatingwebhookconfiguration.yaml"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s is not written: %v", name, err)
+		}
+	}
+}
+
+func TestServer_applyCryptoPolicy(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	defer func() { cryptoBackend = detectCryptoBackend }()
+
+	tests := []struct {
+		name         string
+		policy       CryptoPolicy
+		fips         bool
+		minVersion   uint16
+		cipherSuites []uint16
+		want         []uint16
+		wantErr      bool
+	}{
+		{
+			name:         "default policy",
+			policy:       DefaultCryptoPolicy,
+			minVersion:   tls.VersionTLS10,
+			cipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+			want:         []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+		},
+		{
+			name:       "fips policy without fips backend",
+			policy:     FIPSCryptoPolicy,
+			minVersion: tls.VersionTLS12,
+			wantErr:    true,
+		},
+		{
+			name:       "fips policy",
+			policy:     FIPSCryptoPolicy,
+			fips:       true,
+			minVersion: tls.VersionTLS12,
+			want:       fipsCipherSuites,
+		},
+		{
+			name:         "fips policy with approved cipher suites",
+			policy:       FIPSCryptoPolicy,
+			fips:         true,
+			minVersion:   tls.VersionTLS13,
+			cipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+			want:         []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		},
+		{
+			name:         "fips policy with other cipher suites",
+			policy:       FIPSCryptoPolicy,
+			fips:         true,
+			minVersion:   tls.VersionTLS12,
+			cipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+			wantErr:      true,
+		},
+		{
+			name:       "fips policy with TLS 1.1",
+			policy:     FIPSCryptoPolicy,
+			fips:       true,
+			minVersion: tls.VersionTLS11,
+			wantErr:    true,
+		},
+		{
+			name:    "unknown policy",
+			policy:  "strict",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cryptoBackend = func() (string, bool) { return "test", tt.fips }
+			s := NewAdmissionServer()
+			s.CryptoPolicy = tt.policy
+			tlsConfig := &tls.Config{MinVersion: tt.minVersion, CipherSuites: tt.cipherSuites}
+
+			err := s.applyCryptoPolicy(tlsConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyCryptoPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(tlsConfig.CipherSuites, tt.want) {
+				t.Errorf("applyCryptoPolicy() cipher suites = %v, want %v", tlsConfig.CipherSuites, tt.want)
+			}
+		})
+	}
+}
+
+func Test_requireClientCertificates(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	now := time.Now()
+	serverCert, serverKey := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	clientCert, clientKey := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	otherCert, otherKey := filepath.Join(dir, "other.crt"), filepath.Join(dir, "other.key")
+	writeCertificate(t, serverCert, serverKey, now.Add(-time.Hour), now.Add(time.Hour))
+	writeCertificate(t, clientCert, clientKey, now.Add(-time.Hour), now.Add(time.Hour))
+	writeCertificate(t, otherCert, otherKey, now.Add(-time.Hour), now.Add(time.Hour))
+
+	if err := requireClientCertificates(&tls.Config{}, filepath.Join(dir, "missing.crt")); err == nil {
+		t.Errorf("requireClientCertificates() with missing file should fail")
+	}
+
+	if err := requireClientCertificates(&tls.Config{}, clientKey); err == nil {
+		t.Errorf("requireClientCertificates() without certificates should fail")
+	}
+
+	loader, err := newCertificateLoader(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &tls.Config{GetCertificate: loader.GetCertificate}
+	if err := requireClientCertificates(config, clientCert); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	request := func(certFile string, keyFile string) error {
+		clientConfig := &tls.Config{InsecureSkipVerify: true}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+
+		return resp.Body.Close()
+	}
+
+	if err := request(clientCert, clientKey); err != nil {
+		t.Errorf("request with trusted client certificate failed: %v", err)
+	}
+
+	if err := request("", ""); err == nil {
+		t.Errorf("request without client certificate should fail")
+	}
+
+	if err := request(otherCert, otherKey); err == nil {
+		t.Errorf("request with untrusted client certificate should fail")
+	}
+}
+
+func TestTemplatePaths_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "paths of several resources",
+			values: []string{"pipelines.example.com=spec.runner.template", "pipelines.example.com=spec.template", "tasks.example.com=spec.pod"},
+			want:   "[pipelines.example.com=spec.runner.template,pipelines.example.com=spec.template,tasks.example.com=spec.pod]",
+		},
+		{
+			name:    "missing path",
+			values:  []string{"pipelines.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "empty field",
+			values:  []string{"pipelines.example.com=spec..template"},
+			wantErr: true,
+		},
+		{
+			name:   "path at the maximum depth",
+			values: []string{"pipelines.example.com=a.b.c.d.e.f.g.h.i.template"},
+			want:   "[pipelines.example.com=a.b.c.d.e.f.g.h.i.template]",
+		},
+		{
+			name:    "path deeper than the maximum depth",
+			values:  []string{"pipelines.example.com=a.b.c.d.e.f.g.h.i.j.template"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths TemplatePaths
+			var err error
+			for _, v := range tt.values {
+				if err = paths.Set(v); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && paths.String() != tt.want {
+				t.Errorf("String() = %s, want %s", paths.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatePathsFlag_Set(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDepth int
+		value    string
+		wantErr  string
+	}{
+		{
+			name:     "path within the maximum depth",
+			maxDepth: 3,
+			value:    "pipelines.example.com=spec.runner.template",
+		},
+		{
+			name:     "path deeper than the maximum depth",
+			maxDepth: 2,
+			value:    "pipelines.example.com=spec.runner.template",
+			wantErr:  `invalid template path "pipelines.example.com=spec.runner.template": spec.runner.template has 3 fields, more than the maximum depth of 2`,
+		},
+		{
+			name:     "path deeper than the default maximum depth",
+			maxDepth: 12,
+			value:    "pipelines.example.com=a.b.c.d.e.f.g.h.i.j.template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths TemplatePaths
+			maxDepth := tt.maxDepth
+			err := TemplatePathsFlag{Paths: &paths, MaxDepth: &maxDepth}.Set(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Set() error = %v, want %s", err, tt.wantErr)
+				}
+
+				if len(paths) != 0 {
+					t.Errorf("paths = %v, want the rejected path not to be added", paths)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+
+			if len(paths["pipelines.example.com"]) != 1 {
+				t.Errorf("paths = %v, want the path to be added", paths)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_validateTemplatePaths(t *testing.T) {
+	h := &RequestsHandler{
+		TemplatePaths:        TemplatePaths{"pipelines.example.com": {"spec.template", "spec.runner.template"}},
+		TemplatePathMaxDepth: 3,
+	}
+
+	if err := h.validateTemplatePaths(); err != nil {
+		t.Errorf("validateTemplatePaths() error = %v", err)
+	}
+
+	h.TemplatePathMaxDepth = 2
+	if err := h.validateTemplatePaths(); err == nil || !strings.Contains(err.Error(), "spec.runner.template has 3 fields, more than the maximum depth of 2") {
+		t.Errorf("validateTemplatePaths() error = %v, want the path that is too deep", err)
+	}
+
+	h.TemplatePathMaxDepth = 0
+	if err := h.validateTemplatePaths(); err == nil {
+		t.Errorf("validateTemplatePaths() should fail without a positive maximum depth")
+	}
+}
+
+func TestRequestsHandler_namespaceCache(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{
+		Name:        "team-a",
+		Annotations: map[string]string{pkg.TimezoneAnnotation: "Asia/Jakarta"},
+	}})
+
+	var gets int32
+	clientset.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&gets, 1)
+		return false, nil, nil
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	h := &RequestsHandler{NamespaceCache: true, clientset: clientset}
+	h.startCaches(stop)
+	if err := h.waitForCaches(cacheSyncTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	namespace, err := h.getNamespace("team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if namespace.Annotations[pkg.TimezoneAnnotation] != "Asia/Jakarta" || atomic.LoadInt32(&gets) != 0 {
+		t.Errorf("getNamespace() = %v with %d gets, want the cached namespace", namespace.Annotations, gets)
+	}
+
+	// a namespace that is not in the cache yet is fetched from the api server
+	if _, err := h.getNamespace("missing"); err == nil || atomic.LoadInt32(&gets) != 1 {
+		t.Errorf("getNamespace() of missing namespace err = %v with %d gets, want not found after 1 get", err, gets)
+	}
+}
+
+func TestRequestsHandler_nodeCache(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	clientset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-1", Labels: map[string]string{"topology.kubernetes.io/region": "eu-west-1"}}})
+
+	var gets int32
+	clientset.PrependReactor("get", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&gets, 1)
+		return false, nil, nil
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	h := &RequestsHandler{AutoTimezone: true, clientset: clientset}
+	h.startCaches(stop)
+	if err := h.waitForCaches(cacheSyncTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.cachesSynced() {
+		t.Fatal("cachesSynced() = false after the caches were synced")
+	}
+
+	timezone, err := h.autoTimezone(&corev1.PodSpec{NodeName: "node-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timezone != "Europe/Dublin" || atomic.LoadInt32(&gets) != 0 {
+		t.Errorf("autoTimezone() = %s with %d gets, want Europe/Dublin from the cached node", timezone, gets)
+	}
+
+	// a node that is not in the cache yet is fetched from the api server
+	if _, err := h.getNode("node-2"); err == nil || atomic.LoadInt32(&gets) != 1 {
+		t.Errorf("getNode() of missing node err = %v with %d gets, want not found after 1 get", err, gets)
+	}
+}
+
+func TestRequestsHandler_lookupPod_cronJobOwners(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	isController := true
+	controller := func(kind, name, uid string) []v1.OwnerReference {
+		return []v1.OwnerReference{{APIVersion: "batch/v1", Kind: kind, Name: name, UID: types.UID(uid), Controller: &isController}}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "batch", Annotations: map[string]string{pkg.TimezoneAnnotation: "Asia/Jakarta"}}},
+		&batchv1.CronJob{ObjectMeta: v1.ObjectMeta{Name: "report", Namespace: "batch", UID: "cronjob", Annotations: map[string]string{pkg.TimezoneAnnotation: "Europe/Berlin"}}},
+		&batchv1.Job{ObjectMeta: v1.ObjectMeta{Name: "report-1", Namespace: "batch", UID: "job", OwnerReferences: controller("CronJob", "report", "cronjob")}},
+		&batchv1.Job{ObjectMeta: v1.ObjectMeta{Name: "manual", Namespace: "batch", UID: "manual"}},
+	)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	h := &RequestsHandler{
+		DefaultTimezone:          pkg.UTCTimezone,
+		DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+		InjectByDefault:          true,
+		CronJobOwners:            true,
+		clientset:                clientset,
+	}
+
+	h.startCaches(stop)
+	if err := h.waitForCaches(cacheSyncTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		owners       []v1.OwnerReference
+		annotations  map[string]string
+		disabled     bool
+		wantTimezone string
+	}{
+		{
+			name:         "pod of a cronjob",
+			owners:       controller("Job", "report-1", "job"),
+			wantTimezone: "Europe/Berlin",
+		},
+		{
+			name:         "job of a cronjob",
+			owners:       controller("CronJob", "report", "cronjob"),
+			wantTimezone: "Europe/Berlin",
+		},
+		{
+			name:         "pod annotation takes precedence",
+			owners:       controller("Job", "report-1", "job"),
+			annotations:  map[string]string{pkg.TimezoneAnnotation: "UTC"},
+			wantTimezone: "UTC",
+		},
+		{
+			name:         "job without a cronjob",
+			owners:       controller("Job", "manual", "manual"),
+			wantTimezone: "Asia/Jakarta",
+		},
+		{
+			name:         "recreated job",
+			owners:       controller("Job", "report-1", "previous"),
+			wantTimezone: "Asia/Jakarta",
+		},
+		{
+			name:         "deleted job",
+			owners:       controller("Job", "report-0", "deleted"),
+			wantTimezone: "Asia/Jakarta",
+		},
+		{
+			name:         "disabled",
+			owners:       controller("Job", "report-1", "job"),
+			disabled:     true,
+			wantTimezone: "Asia/Jakarta",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.CronJobOwners = !tt.disabled
+			pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod", Namespace: "batch", Annotations: tt.annotations, OwnerReferences: tt.owners}}
+
+			generator, err := h.lookupPod("batch", pod)
+			if err != nil {
+				t.Fatalf("lookupPod() error = %v", err)
+			}
+
+			if generator == nil || generator.Timezone != tt.wantTimezone {
+				t.Errorf("lookupPod() = %+v, want timezone %s", generator, tt.wantTimezone)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_lookupPod_timezonePolicies(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	policy := func(name string, spec map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "k8tz.io/v1alpha1",
+			"kind":       "TimezonePolicy",
+			"metadata":   map[string]interface{}{"name": name},
+			"spec":       spec,
+		}}
+	}
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, p := range []*unstructured.Unstructured{
+		policy("team-a", map[string]interface{}{
+			"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"team": "a"}},
+			"timezone":          "Asia/Jakarta",
+			"strategy":          "hostPath",
+		}),
+		policy("team-a-batch", map[string]interface{}{
+			"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"team": "a"}},
+			"podSelector":       map[string]interface{}{"matchLabels": map[string]interface{}{"app": "batch"}},
+			"priority":          int64(10),
+			"timezone":          "UTC",
+		}),
+		policy("no-system", map[string]interface{}{
+			"namespaceSelector":  map[string]interface{}{"matchLabels": map[string]interface{}{"system": "true"}},
+			"excludedNamespaces": []interface{}{"kube-public"},
+			"inject":             false,
+		}),
+		policy("invalid", map[string]interface{}{
+			"podSelector": map[string]interface{}{"matchExpressions": []interface{}{map[string]interface{}{"key": "app", "operator": "Bad"}}},
+			"timezone":    "Europe/Berlin",
+		}),
+	} {
+		if err := indexer.Add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: name, Labels: labels}}
+	}
+
+	h := &RequestsHandler{
+		DefaultTimezone:          pkg.UTCTimezone,
+		DefaultInjectionStrategy: inject.InitContainerInjectionStrategy,
+		InjectByDefault:          true,
+		clientset: fake.NewSimpleClientset(
+			namespace("team-a", map[string]string{"team": "a"}),
+			namespace("team-b", map[string]string{"team": "b"}),
+			namespace("kube-system", map[string]string{"system": "true"}),
+			namespace("kube-public", map[string]string{"system": "true"}),
+		),
+		policies: cache.NewGenericLister(indexer, v1alpha1.TimezonePolicyResource.GroupResource()),
+	}
+
+	tests := []struct {
+		name         string
+		namespace    string
+		labels       map[string]string
+		annotations  map[string]string
+		wantInject   bool
+		wantTimezone string
+		wantStrategy inject.InjectionStrategy
+	}{
+		{
+			name:         "namespace selected by policy",
+			namespace:    "team-a",
+			wantInject:   true,
+			wantTimezone: "Asia/Jakarta",
+			wantStrategy: inject.HostPathInjectionStrategy,
+		},
+		{
+			name:         "higher priority policy wins",
+			namespace:    "team-a",
+			labels:       map[string]string{"app": "batch"},
+			wantInject:   true,
+			wantTimezone: pkg.UTCTimezone,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "pod annotation takes precedence over policy",
+			namespace:    "team-a",
+			annotations:  map[string]string{pkg.TimezoneAnnotation: "Europe/London"},
+			wantInject:   true,
+			wantTimezone: "Europe/London",
+			wantStrategy: inject.HostPathInjectionStrategy,
+		},
+		{
+			name:         "namespace without policy uses defaults",
+			namespace:    "team-b",
+			wantInject:   true,
+			wantTimezone: pkg.UTCTimezone,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:       "policy disables injection",
+			namespace:  "kube-system",
+			wantInject: false,
+		},
+		{
+			name:         "excluded namespace is not selected",
+			namespace:    "kube-public",
+			wantInject:   true,
+			wantTimezone: pkg.UTCTimezone,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod", Labels: tt.labels, Annotations: tt.annotations}}
+			generator, err := h.lookupPod(tt.namespace, pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (generator != nil) != tt.wantInject {
+				t.Fatalf("lookupPod() generator = %+v, want inject %t", generator, tt.wantInject)
+			}
+
+			if generator != nil && (generator.Timezone != tt.wantTimezone || generator.Strategy != tt.wantStrategy) {
+				t.Errorf("lookupPod() = %s/%s, want %s/%s", generator.Timezone, generator.Strategy, tt.wantTimezone, tt.wantStrategy)
+			}
+		})
+
+		t.Run(tt.name+" cronjob", func(t *testing.T) {
+			cronJob := &batchv1.CronJob{ObjectMeta: v1.ObjectMeta{Name: "cronjob", Annotations: tt.annotations}}
+			cronJob.Spec.JobTemplate.Spec.Template.Labels = tt.labels
+			generator, err := h.lookupCronJob(tt.namespace, cronJob)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (generator != nil) != tt.wantInject {
+				t.Fatalf("lookupCronJob() generator = %+v, want inject %t", generator, tt.wantInject)
+			}
+
+			if generator != nil && generator.Timezone != tt.wantTimezone {
+				t.Errorf("lookupCronJob() timezone = %s, want %s", generator.Timezone, tt.wantTimezone)
+			}
+		})
+	}
+}
+
+func Test_settings(t *testing.T) {
+	enabled, disabled := true, false
+	policy := func(inject *bool, timezone string, strategy inject.InjectionStrategy) *v1alpha1.TimezonePolicy {
+		return &v1alpha1.TimezonePolicy{
+			ObjectMeta: v1.ObjectMeta{Name: "team"},
+			Spec:       v1alpha1.TimezonePolicySpec{Inject: inject, Timezone: timezone, Strategy: strategy},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		pod          map[string]string
+		controller   map[string]string
+		namespace    map[string]string
+		policy       *v1alpha1.TimezonePolicy
+		byDefault    bool
+		wantInject   bool
+		wantLevel    Level
+		wantTimezone string
+		wantTzLevel  Level
+		wantStrategy inject.InjectionStrategy
+		wantErr      bool
+	}{
+		{
+			name:         "flag defaults",
+			byDefault:    true,
+			wantInject:   true,
+			wantLevel:    LevelDefault,
+			wantTimezone: "UTC",
+			wantTzLevel:  LevelDefault,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "disabled by default",
+			wantInject:   false,
+			wantLevel:    LevelDefault,
+			wantTimezone: "UTC",
+			wantTzLevel:  LevelDefault,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "policy over default",
+			policy:       policy(&disabled, "Asia/Tokyo", inject.HostPathInjectionStrategy),
+			byDefault:    true,
+			wantInject:   false,
+			wantLevel:    LevelPolicy,
+			wantTimezone: "Asia/Tokyo",
+			wantTzLevel:  LevelPolicy,
+			wantStrategy: inject.HostPathInjectionStrategy,
+		},
+		{
+			name:         "namespace over policy",
+			namespace:    map[string]string{pkg.InjectionAnnotation: pkg.InjectionDisabled, pkg.TimezoneAnnotation: "Europe/Paris", pkg.InjectionStrategyAnnotation: "tzdata"},
+			policy:       policy(&enabled, "Asia/Tokyo", inject.HostPathInjectionStrategy),
+			byDefault:    true,
+			wantInject:   false,
+			wantLevel:    LevelNamespace,
+			wantTimezone: "Europe/Paris",
+			wantTzLevel:  LevelNamespace,
+			wantStrategy: inject.TzdataInjectionStrategy,
+		},
+		{
+			name:         "controller over namespace",
+			controller:   map[string]string{pkg.InjectionAnnotation: pkg.InjectionDisabled, pkg.TimezoneAnnotation: "Europe/Berlin"},
+			namespace:    map[string]string{pkg.InjectionAnnotation: pkg.InjectionEnabled, pkg.TimezoneAnnotation: "Europe/Paris", pkg.InjectionStrategyAnnotation: "tzdata"},
+			byDefault:    true,
+			wantInject:   false,
+			wantLevel:    LevelController,
+			wantTimezone: "Europe/Berlin",
+			wantTzLevel:  LevelController,
+			wantStrategy: inject.TzdataInjectionStrategy,
+		},
+		{
+			name:         "pod over controller",
+			pod:          map[string]string{pkg.InjectionAnnotation: pkg.InjectionEnabled, pkg.TimezoneAnnotation: "America/Lima"},
+			controller:   map[string]string{pkg.InjectionAnnotation: pkg.InjectionDisabled, pkg.TimezoneAnnotation: "Europe/Berlin"},
+			wantInject:   true,
+			wantLevel:    LevelPod,
+			wantTimezone: "America/Lima",
+			wantTzLevel:  LevelPod,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "pod opts out of an enabled namespace",
+			pod:          map[string]string{pkg.InjectionAnnotation: pkg.InjectionDisabled},
+			namespace:    map[string]string{pkg.InjectionAnnotation: pkg.InjectionEnabled},
+			byDefault:    true,
+			wantInject:   false,
+			wantLevel:    LevelPod,
+			wantTimezone: "UTC",
+			wantTzLevel:  LevelDefault,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "legacy inject annotation",
+			namespace:    map[string]string{pkg.InjectAnnotation: "false"},
+			byDefault:    true,
+			wantInject:   false,
+			wantLevel:    LevelNamespace,
+			wantTimezone: "UTC",
+			wantTzLevel:  LevelDefault,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "injection over inject on the same object",
+			pod:          map[string]string{pkg.InjectAnnotation: "false", pkg.InjectionAnnotation: pkg.InjectionEnabled},
+			wantInject:   true,
+			wantLevel:    LevelPod,
+			wantTimezone: "UTC",
+			wantTzLevel:  LevelDefault,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:      "unknown injection value",
+			namespace: map[string]string{pkg.InjectionAnnotation: "off"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &settings{kind: "pod", object: tt.pod, namespace: tt.namespace, policy: tt.policy}
+			if tt.controller != nil {
+				s.controller = func() (map[string]string, error) { return tt.controller, nil }
+			}
+
+			injected, level, err := s.injection(tt.byDefault)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("injection() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if reasonOf(err) != ReasonInvalidObject {
+					t.Errorf("injection() reason = %s, want %s", reasonOf(err), ReasonInvalidObject)
+				}
+				return
+			}
+
+			if injected != tt.wantInject || level != tt.wantLevel {
+				t.Errorf("injection() = %t from %s, want %t from %s", injected, level, tt.wantInject, tt.wantLevel)
+			}
+
+			timezone, level, err := s.timezone("UTC")
+			if err != nil || timezone != tt.wantTimezone || level != tt.wantTzLevel {
+				t.Errorf("timezone() = %s from %s (err %v), want %s from %s", timezone, level, err, tt.wantTimezone, tt.wantTzLevel)
+			}
+
+			strategy, _, err := s.strategy(inject.InitContainerInjectionStrategy)
+			if err != nil || strategy != tt.wantStrategy {
+				t.Errorf("strategy() = %s (err %v), want %s", strategy, err, tt.wantStrategy)
+			}
+		})
+	}
+
+	t.Run("controller lookup error", func(t *testing.T) {
+		calls := 0
+		s := &settings{
+			kind:   "pod",
+			object: map[string]string{pkg.TimezoneAnnotation: "Asia/Jakarta"},
+			controller: func() (map[string]string, error) {
+				calls++
+				return nil, withReason(ReasonLookupFailed, "api unreachable")
+			},
+		}
+
+		// the pod sets the timezone, the controller is not looked up
+		if timezone, _, err := s.timezone("UTC"); err != nil || timezone != "Asia/Jakarta" || calls != 0 {
+			t.Errorf("timezone() = %s (err %v) with %d lookups, want Asia/Jakarta without lookups", timezone, err, calls)
+		}
+
+		if _, _, err := s.injection(true); reasonOf(err) != ReasonLookupFailed {
+			t.Errorf("injection() error = %v, want reason %s", err, ReasonLookupFailed)
+		}
+	})
+}
+
+func TestRequestsHandler_validateFunc(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name         string
+		operation    admissionv1beta1.Operation
+		annotations  map[string]string
+		autoTimezone bool
+		wantAllowed  bool
+	}{
+		{
+			name:        "valid timezone",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "Europe/Berlin"},
+			wantAllowed: true,
+		},
+		{
+			name:        "unknown injection value",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.InjectionAnnotation: "off"},
+			wantAllowed: false,
+		},
+		{
+			name:        "alias of a known timezone",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "US/Eastern"},
+			wantAllowed: true,
+		},
+		{
+			name:        "timezone abbreviation",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "IST"},
+			wantAllowed: false,
+		},
+		{
+			name:        "container timezone abbreviation",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.ContainerTimezonesAnnotation: "app=Asia/Tokyo,sidecar=JST"},
+			wantAllowed: false,
+		},
+		{
+			name:         "auto timezone",
+			operation:    admissionv1beta1.Create,
+			annotations:  map[string]string{pkg.TimezoneAnnotation: pkg.AutoTimezone},
+			autoTimezone: true,
+			wantAllowed:  true,
+		},
+		{
+			name:        "auto timezone disabled",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.TimezoneAnnotation: pkg.AutoTimezone},
+			wantAllowed: false,
+		},
+		{
+			name:         "container auto timezone",
+			operation:    admissionv1beta1.Create,
+			annotations:  map[string]string{pkg.ContainerTimezonesAnnotation: "app=auto"},
+			autoTimezone: true,
+			wantAllowed:  false,
+		},
+		{
+			name:        "host path outside roots",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.HostPathAnnotation: "/etc"},
+			wantAllowed: false,
+		},
+		{
+			name:        "without annotations",
+			operation:   admissionv1beta1.Create,
+			wantAllowed: true,
+		},
+		{
+			name:        "unknown timezone",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "Mars/Olympus_Mons"},
+			wantAllowed: false,
+		},
+		{
+			name:        "unknown timezone on update",
+			operation:   admissionv1beta1.Update,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "../../etc/passwd"},
+			wantAllowed: false,
+		},
+		{
+			name:        "unknown container timezone",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.ContainerTimezonesAnnotation: "app=Asia/Tokyo,sidecar=Europe/Atlantis"},
+			wantAllowed: false,
+		},
+		{
+			name:        "invalid container timezones",
+			operation:   admissionv1beta1.Create,
+			annotations: map[string]string{pkg.ContainerTimezonesAnnotation: "app"},
+			wantAllowed: false,
+		},
+		{
+			name:        "delete is not validated",
+			operation:   admissionv1beta1.Delete,
+			annotations: map[string]string{pkg.TimezoneAnnotation: "Mars/Olympus_Mons"},
+			wantAllowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &RequestsHandler{ZoneInfoPath: "../inject/testdata/zoneinfo", AutoTimezone: tt.autoTimezone}
+
+			pod, err := json.Marshal(corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod", Annotations: tt.annotations}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			review, err := json.Marshal(admissionv1beta1.AdmissionReview{
+				TypeMeta: v1.TypeMeta{Kind: "AdmissionReview", APIVersion: "admission.k8s.io/v1"},
+				Request: &admissionv1beta1.AdmissionRequest{
+					UID:       "uid",
+					Kind:      v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+					Resource:  podResource,
+					Operation: tt.operation,
+					Object:    runtime.RawExtension{Raw: pod},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, "/validate", bytes.NewReader(review))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Content-Type", jsonContentType)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.validateFunc).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("validateFunc() returned status %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var got admissionv1beta1.AdmissionReview
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Response.UID != "uid" || got.Response.Allowed != tt.wantAllowed {
+				t.Errorf("validateFunc() response = %+v, want allowed %t", got.Response, tt.wantAllowed)
+			}
+
+			if !tt.wantAllowed && (got.Response.Result == nil || got.Response.Result.Code != http.StatusUnprocessableEntity) {
+				t.Errorf("validateFunc() result = %+v, want code %d", got.Response.Result, http.StatusUnprocessableEntity)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_registerRoutes(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	h := NewRequestsHandler()
+	h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+	mux := http.NewServeMux()
+	h.registerRoutes(mux)
+
+	pod, err := json.Marshal(corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "busybox"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review, err := json.Marshal(admissionv1beta1.AdmissionReview{
+		TypeMeta: v1.TypeMeta{Kind: "AdmissionReview", APIVersion: "admission.k8s.io/v1"},
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      v1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  podResource,
+			Namespace: "default",
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: pod},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		wantCode  int
+		wantPatch bool
+	}{
+		{path: "/", wantCode: http.StatusOK, wantPatch: true},
+		{path: MutatePodsPath, wantCode: http.StatusOK, wantPatch: true},
+		{path: MutateCronJobsPath, wantCode: http.StatusOK, wantPatch: false},
+		{path: MutateWorkloadsPath, wantCode: http.StatusOK, wantPatch: false},
+		{path: "/validate", wantCode: http.StatusOK, wantPatch: false},
+		{path: ValidatePodsPath, wantCode: http.StatusOK, wantPatch: false},
+		{path: ValidateCronJobsPath, wantCode: http.StatusOK, wantPatch: false},
+		{path: "/mutate", wantCode: http.StatusNotFound},
+		{path: "/mutate/v1/pods/extra", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, tt.path, bytes.NewReader(review))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Content-Type", jsonContentType)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Fatalf("%s returned status %d, want %d: %s", tt.path, rr.Code, tt.wantCode, rr.Body.String())
+			}
+
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var got admissionv1beta1.AdmissionReview
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if !got.Response.Allowed || (got.Response.Patch != nil) != tt.wantPatch {
+				t.Errorf("%s response = %+v, want allowed with patch %t", tt.path, got.Response, tt.wantPatch)
+			}
+		})
+	}
+
+	var metrics bytes.Buffer
+	writeMetrics(&metrics)
+	for _, want := range []string{
+		`k8tz_route_requests_total{route="/mutate/v1/pods",code="200"}`,
+		`k8tz_route_requests_total{route="unknown",code="404"} 2`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("metrics do not contain %s:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestRequestsHandler_reinjected(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "k8tz.io/v1alpha1",
+		"kind":       "TimezonePolicy",
+		"metadata":   map[string]interface{}{"name": "team-a"},
+		"spec": map[string]interface{}{
+			"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"team": "a"}},
+			"timezone":          "Asia/Jakarta",
+			"reinject":          true,
+		},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewRequestsHandler()
+	h.DefaultInjectionStrategy = inject.InitContainerInjectionStrategy
+	h.clientset = fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}},
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+	)
+	h.policies = cache.NewGenericLister(indexer, v1alpha1.TimezonePolicyResource.GroupResource())
+
+	// deployment returns a deployment injected with the timezone and strategy
+	deployment := func(namespace string, annotations map[string]string, timezone string, strategy inject.InjectionStrategy) *appsv1.Deployment {
+		d := &appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: namespace, Annotations: annotations},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "busybox"}}},
+			}},
+		}
+
+		if timezone == "" {
+			return d
+		}
+
+		g := inject.NewPatchGenerator()
+		g.Timezone, g.Strategy = timezone, strategy
+		patches, err := g.Generate(d, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		injected, err := applyPatches(d, patches)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return injected.(*appsv1.Deployment)
+	}
+
+	optIn := map[string]string{pkg.ReinjectAnnotation: "true"}
+
+	tests := []struct {
+		name         string
+		object       *appsv1.Deployment
+		edit         func(d *appsv1.Deployment)
+		wantTimezone string
+		wantStrategy inject.InjectionStrategy
+		wantErr      bool
+	}{
+		{
+			name:         "default strategy changed",
+			object:       deployment("default", optIn, pkg.UTCTimezone, inject.HostPathInjectionStrategy),
+			wantTimezone: pkg.UTCTimezone,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:   "injection up to date",
+			object: deployment("default", optIn, pkg.UTCTimezone, inject.InitContainerInjectionStrategy),
+		},
+		{
+			name:   "not opted in",
+			object: deployment("default", nil, pkg.UTCTimezone, inject.HostPathInjectionStrategy),
+		},
+		{
+			name:   "opted out",
+			object: deployment("default", map[string]string{pkg.ReinjectAnnotation: "false"}, pkg.UTCTimezone, inject.HostPathInjectionStrategy),
+		},
+		{
+			name:   "not injected",
+			object: deployment("default", optIn, "", ""),
+		},
+		{
+			name:   "timezone annotation changed",
+			object: deployment("default", optIn, pkg.UTCTimezone, inject.InitContainerInjectionStrategy),
+			edit: func(d *appsv1.Deployment) {
+				d.Spec.Template.Annotations[pkg.TimezoneAnnotation] = "Europe/London"
+			},
+			wantTimezone: "Europe/London",
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "policy timezone replaces injected timezone",
+			object:       deployment("team-a", nil, pkg.UTCTimezone, inject.InitContainerInjectionStrategy),
+			wantTimezone: "Asia/Jakarta",
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:    "invalid annotation",
+			object:  deployment("default", map[string]string{pkg.ReinjectAnnotation: "yes please"}, pkg.UTCTimezone, inject.HostPathInjectionStrategy),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.edit != nil {
+				tt.edit(tt.object)
+			}
+
+			got, err := h.reinjected(tt.object)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reinjected() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantTimezone == "" {
+				if got != nil {
+					t.Fatalf("reinjected() = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil {
+				t.Fatal("reinjected() = nil, want re-injected deployment")
+			}
+
+			template := got.(*appsv1.Deployment).Spec.Template
+			if template.Annotations[pkg.TimezoneAnnotation] != tt.wantTimezone {
+				t.Errorf("timezone annotation = %q, want %q", template.Annotations[pkg.TimezoneAnnotation], tt.wantTimezone)
+			}
+
+			env := template.Spec.Containers[0].Env
+			if len(env) != 1 || env[0].Value != tt.wantTimezone {
+				t.Errorf("env = %+v, want a single TZ=%s", env, tt.wantTimezone)
+			}
+
+			strategy := inject.HostPathInjectionStrategy
+			if len(template.Spec.InitContainers) == 1 {
+				strategy = inject.InitContainerInjectionStrategy
+			}
+
+			if strategy != tt.wantStrategy || len(template.Spec.Volumes) != 1 {
+				t.Errorf("strategy = %s with volumes %+v, want %s with a single volume", strategy, template.Spec.Volumes, tt.wantStrategy)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_checkTzdataVersions(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	controller := func(kind string, name string) []v1.OwnerReference {
+		return []v1.OwnerReference{{Kind: kind, Name: name, Controller: &inject.True}}
+	}
+
+	pod := func(name string, version string, owners []v1.OwnerReference) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: v1.ObjectMeta{
+			Name:            name,
+			Namespace:       "default",
+			Annotations:     map[string]string{pkg.TzdataVersionAnnotation: version},
+			OwnerReferences: owners,
+		}}
+	}
+
+	injectedTemplate := corev1.PodTemplateSpec{ObjectMeta: v1.ObjectMeta{Annotations: map[string]string{pkg.InjectedAnnotation: "true"}}}
+
+	tests := []struct {
+		name          string
+		action        TzdataUpgradeAction
+		wantOutdated  int64
+		wantRestarted []string
+	}{
+		{
+			name:         "report",
+			action:       TzdataUpgradeReport,
+			wantOutdated: 4,
+		},
+		{
+			name:          "restart",
+			action:        TzdataUpgradeRestart,
+			wantOutdated:  4,
+			wantRestarted: []string{"deployments/app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				&appsv1.Deployment{ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: "default"}},
+				&appsv1.ReplicaSet{ObjectMeta: v1.ObjectMeta{Name: "app-1", Namespace: "default", OwnerReferences: controller("Deployment", "app")}},
+				&appsv1.StatefulSet{ObjectMeta: v1.ObjectMeta{Name: "db", Namespace: "default"}, Spec: appsv1.StatefulSetSpec{Template: injectedTemplate}},
+				pod("app-1-a", "2023c", controller("ReplicaSet", "app-1")),
+				pod("app-1-b", "2023c", controller("ReplicaSet", "app-1")),
+				pod("app-2-a", "2024a", controller("ReplicaSet", "app-2")),
+				pod("db-0", "2023c", controller("StatefulSet", "db")),
+				pod("standalone", "2022g", nil),
+			)
+
+			h := NewRequestsHandler()
+			h.clientset = clientset
+			h.TzdataVersion = "2024a"
+			h.TzdataUpgrade = tt.action
+
+			// the second check finds the restart of the first one
+			for i := 0; i < 2; i++ {
+				h.checkTzdataVersions(context.Background())
+			}
+
+			if got := atomic.LoadInt64(&outdatedTzdataPods); got != tt.wantOutdated {
+				t.Errorf("outdated pods = %d, want %d", got, tt.wantOutdated)
+			}
+
+			var restarted []string
+			for _, action := range clientset.Actions() {
+				if patch, ok := action.(k8stesting.PatchAction); ok {
+					restarted = append(restarted, fmt.Sprintf("%s/%s", action.GetResource().Resource, patch.GetName()))
+				}
+			}
+
+			if !reflect.DeepEqual(restarted, tt.wantRestarted) {
+				t.Errorf("restarted = %v, want %v", restarted, tt.wantRestarted)
+			}
+
+			if tt.wantRestarted != nil {
+				d, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "app", v1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := d.Spec.Template.Annotations[pkg.TzdataRestartAnnotation]; got != "2024a" {
+					t.Errorf("%s = %q, want 2024a", pkg.TzdataRestartAnnotation, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_checkDSTTransitions(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	pod := func(name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: v1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			UID:         types.UID(name),
+			Annotations: annotations,
+		}}
+	}
+
+	clientset := fake.NewSimpleClientset(
+		pod("berlin", map[string]string{pkg.InjectedAnnotation: "true", pkg.TimezoneAnnotation: "Europe/Berlin"}),
+		pod("tokyo", map[string]string{pkg.InjectedAnnotation: "true", pkg.TimezoneAnnotation: "Asia/Tokyo"}),
+		pod("containers", map[string]string{pkg.InjectedAnnotation: "true", pkg.TimezoneAnnotation: "Asia/Tokyo", pkg.ContainerTimezonesAnnotation: "app=America/New_York"}),
+		pod("uninjected", map[string]string{pkg.TimezoneAnnotation: "Europe/Berlin"}),
+	)
+
+	h := NewRequestsHandler()
+	h.clientset = clientset
+	h.ZoneInfoPath = "../inject/testdata/zoneinfo"
+	h.DSTNoticePeriod = 7 * 24 * time.Hour
+
+	// Europe/Berlin changes in 2 days, America/New_York in 9 days, the second
+	// check does not notify the pod of the same transition again
+	now := time.Date(2023, 10, 27, 0, 0, 0, 0, time.UTC)
+	notified := map[types.UID]time.Time{}
+	for i := 0; i < 2; i++ {
+		h.checkDSTTransitions(context.Background(), now, notified)
+	}
+
+	events, err := clientset.CoreV1().Events("default").List(context.Background(), v1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, event := range events.Items {
+		got = append(got, fmt.Sprintf("%s/%s: %s", event.InvolvedObject.Name, event.Reason, event.Message))
+	}
+
+	want := []string{"berlin/TimezoneTransitionUpcoming: timezone Europe/Berlin changes from CEST (+02:00) to CET (+01:00) at 2023-10-29T01:00:00Z in 49h0m0s"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	wantTransitions := map[string]time.Time{
+		"Europe/Berlin":    time.Date(2023, 10, 29, 1, 0, 0, 0, time.UTC),
+		"America/New_York": time.Date(2023, 11, 5, 6, 0, 0, 0, time.UTC),
+	}
+	if transitions := nextDSTTransitions.Load().(map[string]time.Time); !reflect.DeepEqual(transitions, wantTransitions) {
+		t.Errorf("transitions = %v, want %v", transitions, wantTransitions)
+	}
+
+	var metrics bytes.Buffer
+	writeDSTTransitions(&metrics)
+	for _, zone := range []string{"America/New_York", "Europe/Berlin"} {
+		if !strings.Contains(metrics.String(), fmt.Sprintf("k8tz_next_dst_transition_seconds{zone=%q} ", zone)) {
+			t.Errorf("metrics do not contain the transition of %s:\n%s", zone, metrics.String())
+		}
+	}
+
+	if strings.Contains(metrics.String(), "Asia/Tokyo") {
+		t.Errorf("metrics contain a timezone without transitions:\n%s", metrics.String())
+	}
+}
+
+func TestRequestsHandler_validateTzdataUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  TzdataUpgradeAction
+		version string
+		wantErr bool
+	}{
+		{name: "ignore without version", action: TzdataUpgradeIgnore},
+		{name: "restart with version", action: TzdataUpgradeRestart, version: "2024a"},
+		{name: "report without version", action: TzdataUpgradeReport, wantErr: true},
+		{name: "unknown action", action: "rollback", version: "2024a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.TzdataUpgrade = tt.action
+			h.TzdataVersion = tt.version
+
+			if err := h.validateTzdataUpgrade(); (err != nil) != tt.wantErr {
+				t.Errorf("validateTzdataUpgrade() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_pinBootstrapImages(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/k8tz/k8tz/manifests/0.13.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	tests := []struct {
+		name       string
+		pin        bool
+		image      string
+		archImages map[string]string
+		wantImage  string
+		wantArch   map[string]string
+		wantErr    bool
+	}{
+		{
+			name:      "pinning disabled",
+			pin:       false,
+			image:     host + "/k8tz/k8tz:0.13.1",
+			wantImage: host + "/k8tz/k8tz:0.13.1",
+		},
+		{
+			name:       "pinned images",
+			pin:        true,
+			image:      host + "/k8tz/k8tz:0.13.1",
+			archImages: map[string]string{"arm64": host + "/k8tz/k8tz:0.13.1"},
+			wantImage:  host + "/k8tz/k8tz:0.13.1@" + digest,
+			wantArch:   map[string]string{"arm64": host + "/k8tz/k8tz:0.13.1@" + digest},
+		},
+		{
+			name:    "unknown tag",
+			pin:     true,
+			image:   host + "/k8tz/k8tz:0.0.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.PinBootstrapDigest = tt.pin
+			h.BootstrapImage = tt.image
+			if tt.archImages != nil {
+				h.BootstrapArchImages = tt.archImages
+			}
+
+			client := registry.NewClient()
+			client.HTTPClient = server.Client()
+
+			err := h.pinBootstrapImages(client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pinBootstrapImages() error = %v, wantErr %v", err, tt.wantErr)
+			} else if tt.wantErr {
+				return
+			}
+
+			if h.BootstrapImage != tt.wantImage {
+				t.Errorf("pinBootstrapImages() image = %v, want %v", h.BootstrapImage, tt.wantImage)
+			}
+
+			if tt.wantArch != nil && !reflect.DeepEqual(h.BootstrapArchImages, tt.wantArch) {
+				t.Errorf("pinBootstrapImages() arch images = %v, want %v", h.BootstrapArchImages, tt.wantArch)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_selectors(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	namespaces := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "prod"}}},
+		&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "team-a", Labels: map[string]string{"env": "dev"}}},
+	}
+
+	tests := []struct {
+		name              string
+		excluded          []string
+		namespaceSelector string
+		objectSelector    string
+		excludeNames      string
+		namespace         string
+		pod               v1.ObjectMeta
+		want              Reason
+		wantErr           bool
+	}{
+		{
+			name:      "no selectors",
+			namespace: "default",
+			pod:       v1.ObjectMeta{Name: "app"},
+			want:      "",
+		},
+		{
+			name:      "excluded namespace pattern",
+			excluded:  []string{"team-*"},
+			namespace: "team-a",
+			pod:       v1.ObjectMeta{Name: "app"},
+			want:      ReasonExcludedNamespace,
+		},
+		{
+			name:              "namespace selector",
+			namespaceSelector: "env in (prod)",
+			namespace:         "team-a",
+			pod:               v1.ObjectMeta{Name: "app"},
+			want:              ReasonExcludedNamespace,
+		},
+		{
+			name:              "selected namespace",
+			namespaceSelector: "env in (prod)",
+			namespace:         "default",
+			pod:               v1.ObjectMeta{Name: "app"},
+			want:              "",
+		},
+		{
+			name:           "object selector",
+			objectSelector: "!k8tz.io/skip",
+			namespace:      "default",
+			pod:            v1.ObjectMeta{Name: "app", Labels: map[string]string{"k8tz.io/skip": ""}},
+			want:           ReasonExcludedObject,
+		},
+		{
+			name:         "excluded generated name",
+			excludeNames: "^(istio|linkerd)-",
+			namespace:    "default",
+			pod:          v1.ObjectMeta{GenerateName: "istio-ingress-"},
+			want:         ReasonExcludedObject,
+		},
+		{
+			name:         "invalid expression",
+			excludeNames: "(",
+			namespace:    "default",
+			pod:          v1.ObjectMeta{Name: "app"},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.ExcludedNamespaces = tt.excluded
+			h.NamespaceSelector = tt.namespaceSelector
+			h.ObjectSelector = tt.objectSelector
+			h.ExcludeNames = tt.excludeNames
+			h.clientset = fake.NewSimpleClientset(namespaces...)
+
+			if err := h.CompileSelectors(); (err != nil) != tt.wantErr {
+				t.Fatalf("CompileSelectors() error = %v, wantErr %v", err, tt.wantErr)
+			} else if tt.wantErr {
+				return
+			}
+
+			decision := h.Explain(tt.namespace, &corev1.Pod{ObjectMeta: tt.pod})
+			if decision.Reason != tt.want {
+				t.Errorf("Explain() reason = %v, want %v", decision.Reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_conflictPolicy(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name   string
+		policy inject.ConflictPolicy
+		spec   corev1.PodSpec
+		want   Reason
+	}{
+		{
+			name:   "skip pod with TZ",
+			policy: inject.ConflictSkip,
+			spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}}}},
+			want:   ReasonConflict,
+		},
+		{
+			name:   "skip pod with k8tz initContainer",
+			policy: inject.ConflictSkip,
+			spec:   corev1.PodSpec{InitContainers: []corev1.Container{{Name: inject.BootstrapContainerName}}, Containers: []corev1.Container{{Name: "app"}}},
+			want:   ReasonConflict,
+		},
+		{
+			name:   "skip pod without conflicts",
+			policy: inject.ConflictSkip,
+			spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			want:   "",
+		},
+		{
+			name:   "merge pod with TZ",
+			policy: inject.ConflictMerge,
+			spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}}}},
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.ConflictPolicy = tt.policy
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			generator, reason, err := h.resolvePod("default", &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "app"}, Spec: tt.spec})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reason != tt.want {
+				t.Errorf("resolvePod() reason = %v, want %v", reason, tt.want)
+			}
+
+			if tt.want == "" && generator.ConflictPolicy != tt.policy {
+				t.Errorf("resolvePod() conflict policy = %v, want %v", generator.ConflictPolicy, tt.policy)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_reinvokePod(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name     string
+		strategy inject.InjectionStrategy
+		added    []corev1.Container
+		want     []string
+	}{
+		{
+			name:     "no containers added",
+			strategy: inject.InitContainerInjectionStrategy,
+			want:     nil,
+		},
+		{
+			name:     "container added by another webhook",
+			strategy: inject.InitContainerInjectionStrategy,
+			added:    []corev1.Container{{Name: "istio-proxy"}},
+			want: []string{
+				"add /spec/containers/1/volumeMounts",
+				"add /spec/containers/1/volumeMounts/-",
+				"add /spec/containers/1/volumeMounts/-",
+				"add /spec/containers/1/env",
+				"add /spec/containers/1/env/-",
+			},
+		},
+		{
+			name:     "hostPath pod resolved with another default strategy",
+			strategy: inject.HostPathInjectionStrategy,
+			added:    []corev1.Container{{Name: "vault-agent", Env: []corev1.EnvVar{{Name: "VAULT_ADDR", Value: "https://vault"}}}},
+			want: []string{
+				"add /spec/containers/1/volumeMounts",
+				"add /spec/containers/1/volumeMounts/-",
+				"add /spec/containers/1/volumeMounts/-",
+				"add /spec/containers/1/env/-",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.DefaultTimezone = "Asia/Jerusalem"
+			h.DefaultInjectionStrategy = tt.strategy
+			h.Reinvocation = true
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "app"}, Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+			generator, err := h.lookupPod("default", pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patches, err := generator.Generate(pod, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			injected, err := applyPatches(pod, patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pod = injected.(*corev1.Pod)
+			pod.Spec.Containers = append(pod.Spec.Containers, tt.added...)
+
+			// the default strategy changes between the invocations
+			h.DefaultInjectionStrategy = inject.InitContainerInjectionStrategy
+			patches, err = h.reinvokePod("default", pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, p := range patches {
+				got = append(got, p.Op+" "+p.Path)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reinvokePod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_locale(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name                string
+		defaultLocale       string
+		namespaceAnnotation string
+		podAnnotation       string
+		want                string
+		wantReason          Reason
+	}{
+		{
+			name: "no locale",
+			want: "",
+		},
+		{
+			name:          "default locale",
+			defaultLocale: "en_US.UTF-8",
+			want:          "en_US.UTF-8",
+		},
+		{
+			name:                "namespace annotation",
+			defaultLocale:       "en_US.UTF-8",
+			namespaceAnnotation: "de_DE.UTF-8",
+			want:                "de_DE.UTF-8",
+		},
+		{
+			name:                "pod annotation",
+			namespaceAnnotation: "de_DE.UTF-8",
+			podAnnotation:       "ja_JP.UTF-8",
+			want:                "ja_JP.UTF-8",
+		},
+		{
+			name:          "unknown locale",
+			podAnnotation: "xx_YY.UTF-8",
+			wantReason:    ReasonInvalidLocale,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Annotations: map[string]string{}}}
+			if tt.namespaceAnnotation != "" {
+				namespace.Annotations[pkg.LocaleAnnotation] = tt.namespaceAnnotation
+			}
+
+			pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "app", Annotations: map[string]string{}}}
+			if tt.podAnnotation != "" {
+				pod.Annotations[pkg.LocaleAnnotation] = tt.podAnnotation
+			}
+
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.DefaultLocale = tt.defaultLocale
+			h.clientset = fake.NewSimpleClientset(namespace)
+
+			generator, _, err := h.resolvePod("default", pod)
+			if tt.wantReason != "" {
+				if reasonOf(err) != tt.wantReason {
+					t.Fatalf("resolvePod() error = %v, want reason %v", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.Locale != tt.want {
+				t.Errorf("resolvePod() locale = %q, want %q", generator.Locale, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_bootstrap(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name            string
+		image           string
+		archImages      map[string]string
+		registries      []string
+		annotations     map[string]string
+		policy          *v1alpha1.BootstrapSpec
+		wantImage       string
+		wantArchImages  map[string]string
+		wantPullSecrets []string
+		wantReason      Reason
+	}{
+		{
+			name:            "defaults",
+			wantImage:       "quay.io/k8tz/k8tz:0.16.0",
+			wantArchImages:  map[string]string{"arm64": "quay.io/k8tz/k8tz:0.16.0-arm64"},
+			wantPullSecrets: []string{"default-registry"},
+		},
+		{
+			name:            "namespace repository",
+			annotations:     map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local:5000/mirror/k8tz"},
+			wantImage:       "registry.tenant.local:5000/mirror/k8tz:0.16.0",
+			wantArchImages:  map[string]string{"arm64": "registry.tenant.local:5000/mirror/k8tz:0.16.0-arm64"},
+			wantPullSecrets: []string{"default-registry"},
+		},
+		{
+			name: "namespace repository, tag and pull secrets",
+			annotations: map[string]string{
+				pkg.BootstrapRepositoryAnnotation:  "registry.tenant.local/k8tz",
+				pkg.BootstrapTagAnnotation:         "0.15.0",
+				pkg.BootstrapPullSecretsAnnotation: "tenant-registry, tenant-mirror",
+			},
+			wantImage:       "registry.tenant.local/k8tz:0.15.0",
+			wantArchImages:  map[string]string{},
+			wantPullSecrets: []string{"tenant-registry", "tenant-mirror"},
+		},
+		{
+			name:            "policy",
+			policy:          &v1alpha1.BootstrapSpec{Repository: "registry.policy.local/k8tz", ImagePullSecrets: []string{"policy-registry"}},
+			wantImage:       "registry.policy.local/k8tz:0.16.0",
+			wantArchImages:  map[string]string{"arm64": "registry.policy.local/k8tz:0.16.0-arm64"},
+			wantPullSecrets: []string{"policy-registry"},
+		},
+		{
+			name:            "namespace takes precedence over policy",
+			annotations:     map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local/k8tz"},
+			policy:          &v1alpha1.BootstrapSpec{Repository: "registry.policy.local/k8tz", Tag: "0.15.0"},
+			wantImage:       "registry.tenant.local/k8tz:0.15.0",
+			wantArchImages:  map[string]string{},
+			wantPullSecrets: []string{"default-registry"},
+		},
+		{
+			name:            "pinned image keeps its digest",
+			image:           "quay.io/k8tz/k8tz:0.16.0@sha256:0123456789abcdef",
+			annotations:     map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local/k8tz", pkg.BootstrapTagAnnotation: "0.15.0"},
+			wantImage:       "registry.tenant.local/k8tz:0.16.0@sha256:0123456789abcdef",
+			wantArchImages:  map[string]string{},
+			wantPullSecrets: []string{"default-registry"},
+		},
+		{
+			name:            "allowed registry",
+			registries:      []string{"registry.tenant.local/"},
+			annotations:     map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local/k8tz"},
+			wantImage:       "registry.tenant.local/k8tz:0.16.0",
+			wantArchImages:  map[string]string{"arm64": "registry.tenant.local/k8tz:0.16.0-arm64"},
+			wantPullSecrets: []string{"default-registry"},
+		},
+		{
+			name:        "registry that is not allowed",
+			registries:  []string{"registry.tenant.local"},
+			annotations: map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local.evil.com/k8tz"},
+			wantReason:  ReasonInvalidObject,
+		},
+		{
+			name:        "repository with a tag",
+			annotations: map[string]string{pkg.BootstrapRepositoryAnnotation: "registry.tenant.local/k8tz:0.15.0"},
+			wantReason:  ReasonInvalidObject,
+		},
+		{
+			name:        "invalid tag",
+			annotations: map[string]string{pkg.BootstrapTagAnnotation: "0.15.0@sha256:0123"},
+			wantReason:  ReasonInvalidObject,
+		},
+		{
+			name:        "invalid pull secret",
+			annotations: map[string]string{pkg.BootstrapPullSecretsAnnotation: "Tenant_Registry"},
+			wantReason:  ReasonInvalidObject,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.BootstrapImage = "quay.io/k8tz/k8tz:0.16.0"
+			if tt.image != "" {
+				h.BootstrapImage = tt.image
+			}
+			h.BootstrapArchImages = map[string]string{"arm64": "quay.io/k8tz/k8tz:0.16.0-arm64"}
+			h.BootstrapPullSecrets = []string{"default-registry"}
+			h.BootstrapRegistries = tt.registries
+
+			namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "tenant", Annotations: tt.annotations}}
+			var policy *v1alpha1.TimezonePolicy
+			if tt.policy != nil {
+				policy = &v1alpha1.TimezonePolicy{Spec: v1alpha1.TimezonePolicySpec{Bootstrap: tt.policy}}
+			}
+
+			got, err := h.bootstrap(policy, namespace, "pod", "tenant/app")
+			if tt.wantReason != "" {
+				if reasonOf(err) != tt.wantReason {
+					t.Fatalf("bootstrap() error = %v, want reason %v", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.image != tt.wantImage {
+				t.Errorf("bootstrap() image = %q, want %q", got.image, tt.wantImage)
+			}
+
+			if !reflect.DeepEqual(got.archImages, tt.wantArchImages) {
+				t.Errorf("bootstrap() archImages = %v, want %v", got.archImages, tt.wantArchImages)
+			}
+
+			if !reflect.DeepEqual(got.pullSecrets, tt.wantPullSecrets) {
+				t.Errorf("bootstrap() pullSecrets = %v, want %v", got.pullSecrets, tt.wantPullSecrets)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_resolvePod_bootstrap(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	namespace := &corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "tenant", Annotations: map[string]string{
+		pkg.BootstrapRepositoryAnnotation:  "registry.tenant.local/k8tz",
+		pkg.BootstrapPullSecretsAnnotation: "tenant-registry",
+	}}}
+
+	h := NewRequestsHandler()
+	h.ZoneInfoPath = "testdata/zoneinfo-missing"
+	h.BootstrapImage = "quay.io/k8tz/k8tz:0.16.0"
+	h.clientset = fake.NewSimpleClientset(namespace)
+
+	generator, _, err := h.resolvePod("tenant", &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if generator.InitContainerImage != "registry.tenant.local/k8tz:0.16.0" {
+		t.Errorf("resolvePod() image = %q, want the image of the tenant registry", generator.InitContainerImage)
+	}
+
+	if !reflect.DeepEqual(generator.InitContainerImagePullSecrets, []string{"tenant-registry"}) {
+		t.Errorf("resolvePod() pull secrets = %v, want [tenant-registry]", generator.InitContainerImagePullSecrets)
+	}
+}
+
+func TestRequestsHandler_lookupCronJob_bootstrap(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(&unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "k8tz.io/v1alpha1",
+		"kind":       "TimezonePolicy",
+		"metadata":   map[string]interface{}{"name": "tenant"},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "report"}},
+			"bootstrap": map[string]interface{}{
+				"repository":       "registry.tenant.local/k8tz",
+				"imagePullSecrets": []interface{}{"tenant-registry"},
+			},
+		},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewRequestsHandler()
+	h.ZoneInfoPath = "testdata/zoneinfo-missing"
+	h.BootstrapImage = "quay.io/k8tz/k8tz:0.16.0"
+	h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "tenant"}})
+	h.policies = cache.NewGenericLister(indexer, v1alpha1.TimezonePolicyResource.GroupResource())
+
+	tests := []struct {
+		name            string
+		labels          map[string]string
+		wantImage       string
+		wantPullSecrets []string
+	}{
+		{
+			name:            "job template selected by policy",
+			labels:          map[string]string{"app": "report"},
+			wantImage:       "registry.tenant.local/k8tz:0.16.0",
+			wantPullSecrets: []string{"tenant-registry"},
+		},
+		{
+			name:      "job template not selected",
+			labels:    map[string]string{"app": "other"},
+			wantImage: "quay.io/k8tz/k8tz:0.16.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cronJob := &batchv1.CronJob{ObjectMeta: v1.ObjectMeta{Name: "report", Namespace: "tenant"}}
+			cronJob.Spec.JobTemplate.Spec.Template.Labels = tt.labels
+
+			generator, err := h.lookupCronJob("tenant", cronJob)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.InitContainerImage != tt.wantImage {
+				t.Errorf("lookupCronJob() image = %q, want %q", generator.InitContainerImage, tt.wantImage)
+			}
+
+			if len(generator.InitContainerImagePullSecrets) != 0 || len(tt.wantPullSecrets) != 0 {
+				if !reflect.DeepEqual(generator.InitContainerImagePullSecrets, tt.wantPullSecrets) {
+					t.Errorf("lookupCronJob() pull secrets = %v, want %v", generator.InitContainerImagePullSecrets, tt.wantPullSecrets)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_autoTimezone(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	regionAffinity := func(key string, regions ...string) *corev1.Affinity {
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{Key: key, Operator: corev1.NodeSelectorOpIn, Values: regions}},
+				}},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name            string
+		disabled        bool
+		regionTimezones map[string]string
+		action          MissingTimezoneAction
+		spec            corev1.PodSpec
+		want            string
+		wantReason      Reason
+	}{
+		{
+			name: "node name",
+			spec: corev1.PodSpec{NodeName: "node-tokyo"},
+			want: "Asia/Tokyo",
+		},
+		{
+			name: "node of daemonset pod",
+			spec: corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-legacy"}}},
+					}},
+				},
+			}}},
+			want: "Europe/Dublin",
+		},
+		{
+			name: "region nodeSelector",
+			spec: corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelTopologyRegion: "europe-west3"}},
+			want: "Europe/Berlin",
+		},
+		{
+			name: "region affinity",
+			spec: corev1.PodSpec{Affinity: regionAffinity(corev1.LabelTopologyRegion, "us-east-1", "us-east-2")},
+			want: "America/New_York",
+		},
+		{
+			name:            "region timezones override",
+			regionTimezones: map[string]string{"us-east-2": "America/New_York", "on-prem": "Asia/Jerusalem"},
+			spec:            corev1.PodSpec{NodeSelector: map[string]string{legacyRegionLabel: "on-prem"}},
+			want:            "Asia/Jerusalem",
+		},
+		{
+			name: "regions with different timezones",
+			spec: corev1.PodSpec{Affinity: regionAffinity(legacyRegionLabel, "us-east-1", "eu-west-1")},
+			want: pkg.UTCTimezone,
+		},
+		{
+			name: "unknown region",
+			spec: corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelTopologyRegion: "mars-north-1"}},
+			want: pkg.UTCTimezone,
+		},
+		{
+			name:       "unknown node",
+			action:     MissingTimezoneDeny,
+			spec:       corev1.PodSpec{NodeName: "node-missing"},
+			wantReason: ReasonNoTimezone,
+		},
+		{
+			name:   "unscheduled pod",
+			action: MissingTimezoneSkip,
+			spec:   corev1.PodSpec{},
+			want:   "",
+		},
+		{
+			name:       "disabled",
+			disabled:   true,
+			spec:       corev1.PodSpec{NodeName: "node-tokyo"},
+			wantReason: ReasonInvalidTimezone,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "app", Annotations: map[string]string{pkg.TimezoneAnnotation: pkg.AutoTimezone}},
+				Spec:       tt.spec,
+			}
+
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.AutoTimezone = !tt.disabled
+			if tt.regionTimezones != nil {
+				h.RegionTimezones = tt.regionTimezones
+			}
+			if tt.action != "" {
+				h.MissingTimezoneAction = tt.action
+			}
+			h.clientset = fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}},
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-tokyo", Labels: map[string]string{corev1.LabelTopologyRegion: "ap-northeast-1"}}},
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-legacy", Labels: map[string]string{legacyRegionLabel: "eu-west-1"}}},
+			)
+
+			generator, _, err := h.resolvePod("default", pod)
+			if tt.wantReason != "" {
+				if reasonOf(err) != tt.wantReason {
+					t.Fatalf("resolvePod() error = %v, want reason %v", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := ""
+			if generator != nil {
+				got = generator.Timezone
+			}
+			if got != tt.want {
+				t.Errorf("resolvePod() timezone = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_hostPath(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	labelAffinity := func(terms ...corev1.NodeSelectorRequirement) *corev1.Affinity {
+		selector := &corev1.NodeSelector{}
+		for _, term := range terms {
+			selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{term}})
+		}
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}}
+	}
+
+	tests := []struct {
+		name         string
+		nodeLabel    string
+		roots        []string
+		annotation   string
+		spec         corev1.PodSpec
+		wantStrategy inject.InjectionStrategy
+		wantHostPath string
+		wantReason   Reason
+	}{
+		{
+			name:         "without node label",
+			wantStrategy: inject.HostPathInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "annotation inside roots",
+			roots:        []string{"/opt/zoneinfo"},
+			annotation:   "/opt/zoneinfo/2023c",
+			wantStrategy: inject.HostPathInjectionStrategy,
+			wantHostPath: "/opt/zoneinfo/2023c",
+		},
+		{
+			name:       "annotation outside roots",
+			roots:      []string{"/opt/zoneinfo"},
+			annotation: "/etc",
+			wantReason: ReasonInvalidObject,
+		},
+		{
+			name:       "annotation with a prefix of a root",
+			annotation: "/usr/share/zoneinfo-fake",
+			wantReason: ReasonInvalidObject,
+		},
+		{
+			name:         "bound to labeled node",
+			nodeLabel:    "k8tz.io/tzdata=true",
+			spec:         corev1.PodSpec{NodeName: "node-tzdata"},
+			wantStrategy: inject.HostPathInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "bound to node without label",
+			nodeLabel:    "k8tz.io/tzdata=true",
+			spec:         corev1.PodSpec{NodeName: "node-plain"},
+			wantStrategy: inject.InitContainerInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "bound to unknown node",
+			nodeLabel:    "k8tz.io/tzdata",
+			spec:         corev1.PodSpec{NodeName: "node-missing"},
+			wantStrategy: inject.InitContainerInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "nodeSelector with label",
+			nodeLabel:    "k8tz.io/tzdata=true",
+			spec:         corev1.PodSpec{NodeSelector: map[string]string{"k8tz.io/tzdata": "true"}},
+			wantStrategy: inject.HostPathInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "nodeSelector with other value",
+			nodeLabel:    "k8tz.io/tzdata=true",
+			spec:         corev1.PodSpec{NodeSelector: map[string]string{"k8tz.io/tzdata": "false"}},
+			wantStrategy: inject.InitContainerInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:      "affinity terms with label",
+			nodeLabel: "k8tz.io/tzdata",
+			spec: corev1.PodSpec{Affinity: labelAffinity(
+				corev1.NodeSelectorRequirement{Key: "k8tz.io/tzdata", Operator: corev1.NodeSelectorOpExists},
+				corev1.NodeSelectorRequirement{Key: "k8tz.io/tzdata", Operator: corev1.NodeSelectorOpIn, Values: []string{"true", "2023c"}},
+			)},
+			wantStrategy: inject.HostPathInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:      "affinity term without label",
+			nodeLabel: "k8tz.io/tzdata=true",
+			spec: corev1.PodSpec{Affinity: labelAffinity(
+				corev1.NodeSelectorRequirement{Key: "k8tz.io/tzdata", Operator: corev1.NodeSelectorOpIn, Values: []string{"true"}},
+				corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}},
+			)},
+			wantStrategy: inject.InitContainerInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+		{
+			name:         "unpinned pod",
+			nodeLabel:    "k8tz.io/tzdata=true",
+			wantStrategy: inject.InitContainerInjectionStrategy,
+			wantHostPath: inject.DefaultHostPathPrefix,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "app", Annotations: map[string]string{}}, Spec: tt.spec}
+			if tt.annotation != "" {
+				pod.Annotations[pkg.HostPathAnnotation] = tt.annotation
+			}
+
+			h := NewRequestsHandler()
+			h.ZoneInfoPath = "testdata/zoneinfo-missing"
+			h.DefaultInjectionStrategy = inject.HostPathInjectionStrategy
+			h.HostPathNodeLabel = tt.nodeLabel
+			h.HostPathRoots = tt.roots
+			h.clientset = fake.NewSimpleClientset(
+				&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}},
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-tzdata", Labels: map[string]string{"k8tz.io/tzdata": "true"}}},
+				&corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "node-plain"}},
+			)
+
+			generator, _, err := h.resolvePod("default", pod)
+			if tt.wantReason != "" {
+				if reasonOf(err) != tt.wantReason {
+					t.Fatalf("resolvePod() error = %v, want reason %v", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.Strategy != tt.wantStrategy || generator.HostPathPrefix != tt.wantHostPath {
+				t.Errorf("resolvePod() = %s/%s, want %s/%s", generator.Strategy, generator.HostPathPrefix, tt.wantStrategy, tt.wantHostPath)
+			}
+		})
+	}
+}
+
+func TestServer_startControllers(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	clientset := fake.NewSimpleClientset()
+	s := NewAdmissionServer()
+	s.LeaderElection = true
+	s.LeaseNamespace = "k8tz"
+	s.LeaseDuration = time.Second
+	s.RenewDeadline = 500 * time.Millisecond
+	s.RetryPeriod = 100 * time.Millisecond
+	s.Handler.TzdataUpgrade = TzdataUpgradeReport
+	s.Handler.TzdataVersion = "2023c"
+	s.Handler.TzdataCheckInterval = time.Hour
+	s.Handler.clientset = clientset
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.startControllers(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	holder := func() string {
+		lease, err := clientset.CoordinationV1().Leases("k8tz").Get(context.Background(), s.LeaderElectionID, v1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	identity, _ := os.Hostname()
+	deadline := time.Now().Add(5 * time.Second)
+	for holder() != identity || atomic.LoadInt32(&leading) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lease holder = %q, want %q", holder(), identity)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	deadline = time.Now().Add(5 * time.Second)
+	for holder() != "" || atomic.LoadInt32(&leading) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lease was not released on shutdown, holder = %q", holder())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequestsHandler_waitForAPI(t *testing.T) {
+	warningLogger.SetOutput(io.Discard)
+
+	delay := apiRetryDelay
+	apiRetryDelay = time.Millisecond
+	t.Cleanup(func() { apiRetryDelay = delay })
+
+	tests := []struct {
+		name     string
+		failures int
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{name: "reachable", failures: 0, timeout: time.Second, wantErr: false},
+		{name: "transient outage", failures: 3, timeout: time.Second, wantErr: false},
+		{name: "outage longer than the timeout", failures: 1000, timeout: 50 * time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+				if attempts++; attempts <= tt.failures {
+					return true, nil, errors.New("connection refused")
+				}
+				return false, nil, nil
+			})
+
+			h := NewRequestsHandler()
+			h.APIStartupTimeout = tt.timeout
+			h.clientset = clientset
+
+			if err := h.waitForAPI(); (err != nil) != tt.wantErr {
+				t.Errorf("waitForAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_rewriteSchedule(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name         string
+		timezone     string
+		schedule     string
+		want         bool
+		wantWarnings int
+	}{
+		{
+			name:     "timezone without daylight saving time",
+			timezone: "Asia/Tokyo",
+			schedule: "0 2 * * *",
+			want:     true,
+		},
+		{
+			name:         "timezone with daylight saving time",
+			timezone:     "Europe/Berlin",
+			schedule:     "0 2 * * *",
+			want:         true,
+			wantWarnings: 1,
+		},
+		{
+			name:         "unsupported schedule",
+			timezone:     "Asia/Tokyo",
+			schedule:     "0 2 1 * *",
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+			h.ZoneInfoPath = "../inject/testdata/zoneinfo"
+			h.DefaultTimezone = tt.timezone
+			h.CronJobTimeZone = true
+			h.CronJobMode = inject.TemplateCronJobMode
+			h.RewriteCronJobSchedules = true
+			h.state = &reviewState{}
+
+			generator, err := h.lookupCronJob("default", &batchv1.CronJob{
+				ObjectMeta: v1.ObjectMeta{Name: "backup", Namespace: "default"},
+				Spec:       batchv1.CronJobSpec{Schedule: tt.schedule},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if generator.RewriteSchedule != tt.want {
+				t.Errorf("PatchGenerator.RewriteSchedule = %v, want %v", generator.RewriteSchedule, tt.want)
+			}
+
+			if len(h.state.warnings) != tt.wantWarnings {
+				t.Errorf("rewriteSchedule() warnings = %q, want %d warnings", h.state.warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_faketime(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name                 string
+		strategy             inject.InjectionStrategy
+		annotations          map[string]string
+		namespaceAnnotations map[string]string
+		want                 string
+		wantWarnings         int
+		wantErr              bool
+	}{
+		{
+			name:        "pod annotation",
+			strategy:    inject.FaketimeInjectionStrategy,
+			annotations: map[string]string{pkg.FaketimeAnnotation: "@2024-03-31 01:59:00"},
+			want:        "@2024-03-31 01:59:00",
+		},
+		{
+			name:                 "namespace annotation",
+			strategy:             inject.FaketimeInjectionStrategy,
+			namespaceAnnotations: map[string]string{pkg.FaketimeAnnotation: "+2d"},
+			want:                 "+2d",
+		},
+		{
+			name:     "missing annotation",
+			strategy: inject.FaketimeInjectionStrategy,
+			wantErr:  true,
+		},
+		{
+			name:        "invalid annotation",
+			strategy:    inject.FaketimeInjectionStrategy,
+			annotations: map[string]string{pkg.FaketimeAnnotation: "tomorrow"},
+			wantErr:     true,
+		},
+		{
+			name:         "ignored by other strategies",
+			strategy:     inject.InitContainerInjectionStrategy,
+			annotations:  map[string]string{pkg.FaketimeAnnotation: "+2d"},
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default", Annotations: tt.namespaceAnnotations}})
+			h.DefaultTimezone = "Europe/London"
+			h.DefaultInjectionStrategy = tt.strategy
+			h.state = &reviewState{}
+
+			generator, err := h.lookupPod("default", &corev1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: "app", Namespace: "default", Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if generator.Faketime != tt.want {
+				t.Errorf("PatchGenerator.Faketime = %q, want %q", generator.Faketime, tt.want)
+			}
+
+			if len(h.state.warnings) != tt.wantWarnings {
+				t.Errorf("faketime() warnings = %q, want %d warnings", h.state.warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_grpc(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewRequestsHandler()
+	h.DefaultTimezone = "Europe/Berlin"
+	h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+	mux := http.NewServeMux()
+	h.registerGRPC(mux)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	request := func(messages ...[]byte) []byte {
+		var body []byte
+		for _, m := range messages {
+			body = append(body, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(body[len(body)-4:], uint32(len(m)))
+			body = append(body, m...)
+		}
+		return body
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(marshalAdmissionReviewMessage(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       []byte
+		encoding   string
+		timeout    string
+		wantStatus string
+		wantCount  int
+	}{
+		{
+			name:       "unary review",
+			method:     GRPCReviewMethod,
+			body:       request(marshalAdmissionReviewMessage(data)),
+			wantStatus: "0",
+			wantCount:  1,
+		},
+		{
+			name:       "stream of reviews",
+			method:     GRPCProcessMethod,
+			body:       request(marshalAdmissionReviewMessage(data), marshalAdmissionReviewMessage(data)),
+			wantStatus: "0",
+			wantCount:  2,
+		},
+		{
+			name:       "unary without request",
+			method:     GRPCReviewMethod,
+			wantStatus: "3",
+		},
+		{
+			name:       "invalid admission review",
+			method:     GRPCReviewMethod,
+			body:       request(marshalAdmissionReviewMessage([]byte(`{"kind":"Pod"}`))),
+			wantStatus: "3",
+		},
+		{
+			name:       "gzip compressed message",
+			method:     GRPCProcessMethod,
+			body:       append([]byte{1}, request(compressed.Bytes())[1:]...),
+			encoding:   "gzip",
+			wantStatus: "0",
+			wantCount:  1,
+		},
+		{
+			name:       "compressed message without encoding",
+			method:     GRPCReviewMethod,
+			body:       append([]byte{1}, request(compressed.Bytes())[1:]...),
+			wantStatus: "13",
+		},
+		{
+			name:       "unsupported encoding",
+			method:     GRPCReviewMethod,
+			body:       request(marshalAdmissionReviewMessage(data)),
+			encoding:   "snappy",
+			wantStatus: "12",
+		},
+		{
+			name:       "timeout",
+			method:     GRPCReviewMethod,
+			body:       request(marshalAdmissionReviewMessage(data)),
+			timeout:    "5S",
+			wantStatus: "0",
+			wantCount:  1,
+		},
+		{
+			name:       "invalid timeout",
+			method:     GRPCReviewMethod,
+			body:       request(marshalAdmissionReviewMessage(data)),
+			timeout:    "5 seconds",
+			wantStatus: "3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+tt.method, bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", grpcContentType)
+			if tt.encoding != "" {
+				req.Header.Set("Grpc-Encoding", tt.encoding)
+			}
+			if tt.timeout != "" {
+				req.Header.Set("Grpc-Timeout", tt.timeout)
+			}
+
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var count int
+			for {
+				message, err := h.readGRPCMessage(resp.Body, "")
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				raw, err := unmarshalAdmissionReviewMessage(message)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				review := admissionv1beta1.AdmissionReview{}
+				if err := json.Unmarshal(raw, &review); err != nil {
+					t.Fatal(err)
+				}
+
+				if review.Response == nil || !review.Response.Allowed || len(review.Response.Patch) == 0 {
+					t.Errorf("ReviewResponse = %s, want an allowed response with patches", raw)
+				}
+				count++
+			}
+
+			if got := resp.Trailer.Get("Grpc-Status"); got != tt.wantStatus {
+				t.Errorf("grpc-status = %q (%s), want %q", got, resp.Trailer.Get("Grpc-Message"), tt.wantStatus)
+			}
+
+			if count != tt.wantCount {
+				t.Errorf("got %d ReviewResponse messages, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestRequestsHandler_grpc_stream(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := marshalAdmissionReviewMessage(data)
+	request := append([]byte{0, 0, 0, 0, 0}, message...)
+	binary.BigEndian.PutUint32(request[1:5], uint32(len(message)))
+
+	tests := []struct {
+		name       string
+		timeout    string
+		wantStatus string
+		wantCount  int
+	}{
+		{
+			name:       "longer than the read and write timeouts",
+			wantStatus: "0",
+			wantCount:  2,
+		},
+		{
+			name:       "longer than the grpc-timeout",
+			timeout:    "300m",
+			wantStatus: "4",
+			wantCount:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewRequestsHandler()
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			mux := http.NewServeMux()
+			h.registerGRPC(mux)
+			server := httptest.NewUnstartedServer(mux)
+			server.EnableHTTP2 = true
+			server.Config.ReadTimeout = 200 * time.Millisecond
+			server.Config.WriteTimeout = 200 * time.Millisecond
+			server.StartTLS()
+			defer server.Close()
+
+			body, writer := io.Pipe()
+			req, err := http.NewRequest(http.MethodPost, server.URL+GRPCProcessMethod, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", grpcContentType)
+			if tt.timeout != "" {
+				req.Header.Set("Grpc-Timeout", tt.timeout)
+			}
+
+			go func() {
+				// the stream outlasts the timeouts of the server between
+				// its messages
+				writer.Write(request)
+				time.Sleep(600 * time.Millisecond)
+				writer.Write(request)
+				writer.Close()
+			}()
+
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var count int
+			for {
+				if _, err := h.readGRPCMessage(resp.Body, ""); err != nil {
+					break
+				}
+				count++
+			}
+
+			if got := resp.Trailer.Get("Grpc-Status"); got != tt.wantStatus {
+				t.Errorf("grpc-status = %q (%s), want %q", got, resp.Trailer.Get("Grpc-Message"), tt.wantStatus)
+			}
+
+			if count != tt.wantCount {
+				t.Errorf("got %d ReviewResponse messages, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func Test_parseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "1H", want: time.Hour},
+		{value: "5S", want: 5 * time.Second},
+		{value: "250m", want: 250 * time.Millisecond},
+		{value: "99999999n", want: 99999999 * time.Nanosecond},
+		{value: "100", wantErr: true},
+		{value: "S", wantErr: true},
+		{value: "123456789S", wantErr: true},
+		{value: "-1S", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseGRPCTimeout(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGRPCTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("parseGRPCTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeMode_Validate(t *testing.T) {
+	for _, mode := range []ServeMode{ServeModeWebhook, ServeModeGRPC, ServeModeBoth} {
+		if err := mode.Validate(); err != nil {
+			t.Errorf("ServeMode(%q).Validate() = %v", mode, err)
+		}
+	}
+
+	if err := ServeMode("http3").Validate(); err == nil {
+		t.Error("ServeMode(\"http3\").Validate() = nil, want an error")
+	}
+}
+
+func TestRequestsHandler_review_debugAnnotation(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+	warningLogger.SetOutput(io.Discard)
+	defer debugLogger.SetOutput(os.Stderr)
+
+	data, err := os.ReadFile("testdata/review-pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		debugAnnotation bool
+		want            bool
+	}{
+		{
+			name:            "annotated pod",
+			annotations:     map[string]string{pkg.DebugAnnotation: "true"},
+			debugAnnotation: true,
+			want:            true,
+		},
+		{
+			name:            "pod without annotation",
+			debugAnnotation: true,
+		},
+		{
+			name:        "annotation disabled",
+			annotations: map[string]string{pkg.DebugAnnotation: "true"},
+		},
+		{
+			name:            "invalid annotation",
+			annotations:     map[string]string{pkg.DebugAnnotation: "yes please"},
+			debugAnnotation: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review, err := decodeAdmissionReview(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pod := corev1.Pod{}
+			if err := json.Unmarshal(review.Request.Object.Raw, &pod); err != nil {
+				t.Fatal(err)
+			}
+
+			pod.Annotations = tt.annotations
+			if review.Request.Object.Raw, err = json.Marshal(pod); err != nil {
+				t.Fatal(err)
+			}
+
+			out := &bytes.Buffer{}
+			debugLogger.SetOutput(out)
+
+			h := NewRequestsHandler()
+			h.DefaultTimezone = "Europe/Berlin"
+			h.DebugAnnotation = tt.debugAnnotation
+			h.clientset = fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: v1.ObjectMeta{Name: "default"}})
+
+			if _, err := h.review(review); err != nil {
+				t.Fatal(err)
+			}
+
+			logs := out.String()
+			if !tt.want {
+				if logs != "" {
+					t.Errorf("review() logged %q, want no debug logs", logs)
+				}
+				return
+			}
+
+			for _, want := range []string{"tracing request", "Generating patches for pod", "strategy=initContainer", `"op":"add"`} {
+				if !strings.Contains(logs, want) {
+					t.Errorf("review() debug logs = %q, want %q", logs, want)
+				}
+			}
+		})
 	}
 }
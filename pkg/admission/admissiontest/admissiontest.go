@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package admissiontest runs AdmissionReview fixtures through a k8tz
+// admission handler and compares the results with golden files, so custom
+// configurations and strategies can be regression tested against upstream
+// changes without a cluster
+package admissiontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/admission"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// UpdateGoldens makes CompareGolden rewrite the golden files with the actual
+// results instead of comparing them, e.g. after an intended change of the
+// patches. It is usually set from a flag of the test binary.
+var UpdateGoldens = false
+
+// Result is the outcome of an admission review, in the form it is stored in
+// the golden files
+type Result struct {
+	Allowed  bool            `json:"allowed"`
+	Message  string          `json:"message,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Patch    json.RawMessage `json:"patch,omitempty"`
+}
+
+// NewHandler returns a handler with the default configuration of
+// admission.NewRequestsHandler, a fixed bootstrap image and a fake clientset
+// with the objects. The "default" namespace is added if the objects have no
+// namespace with that name, since most fixtures are reviews of objects in it.
+// The zoneinfo checks are disabled, so the results do not depend on the tz
+// database of the machine that runs the tests.
+func NewHandler(objects ...runtime.Object) *admission.RequestsHandler {
+	hasDefault := false
+	for _, object := range objects {
+		if namespace, ok := object.(*corev1.Namespace); ok && namespace.Name == metav1.NamespaceDefault {
+			hasDefault = true
+		}
+	}
+
+	if !hasDefault {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceDefault}})
+	}
+
+	h := admission.NewRequestsHandler()
+	h.BootstrapImage = "test:0.0.0"
+	h.InstallNamespace = ""
+	h.ZoneInfoPath = ""
+	h.SetClientset(fake.NewSimpleClientset(objects...))
+	return &h
+}
+
+// Review handles an AdmissionReview (JSON) the same way the webhook does and
+// returns its result
+func Review(h *admission.RequestsHandler, fixture []byte) (*Result, error) {
+	out := &bytes.Buffer{}
+	if err := h.MutateStream(bytes.NewReader(fixture), out, true); err != nil {
+		return nil, err
+	}
+
+	review := admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(out.Bytes(), &review); err != nil {
+		return nil, fmt.Errorf("failed to parse response review: %w", err)
+	}
+
+	if review.Response == nil {
+		return nil, errors.New("response review has no response")
+	}
+
+	result := &Result{
+		Allowed:  review.Response.Allowed,
+		Warnings: review.Response.Warnings,
+	}
+
+	// objects that are not mutated get a "null" patch
+	if string(review.Response.Patch) != "null" {
+		result.Patch = review.Response.Patch
+	}
+
+	if review.Response.Result != nil {
+		result.Message = review.Response.Result.Message
+	}
+
+	return result, nil
+}
+
+// ReviewFile handles the AdmissionReview of the fixture file
+func ReviewFile(h *admission.RequestsHandler, fixtureFile string) (*Result, error) {
+	fixture, err := os.ReadFile(fixtureFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+
+	return Review(h, fixture)
+}
+
+// CompareGolden compares the result with the golden file, the golden file is
+// written if it does not exist or UpdateGoldens is set
+func CompareGolden(result *Result, goldenFile string) error {
+	got, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	got = append(got, '\n')
+	want, err := os.ReadFile(goldenFile)
+	if os.IsNotExist(err) || (err == nil && UpdateGoldens) {
+		if err := os.WriteFile(goldenFile, got, 0644); err != nil {
+			return fmt.Errorf("failed to write golden file: %s, error: %v", goldenFile, err)
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read golden file: %s, error: %v", goldenFile, err)
+	}
+
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("result of %s differs from the golden file\nactual: %s\nwant: %s", goldenFile, got, want)
+	}
+
+	return nil
+}
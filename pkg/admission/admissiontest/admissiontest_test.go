@@ -0,0 +1,155 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admissiontest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGoldenReviews(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixture   string
+		configure func(h *admission.RequestsHandler)
+	}{
+		{name: "pod", fixture: "pod"},
+		{name: "pod-timezone", fixture: "pod-timezone"},
+		{name: "pod-timezone-alias", fixture: "pod-timezone-alias"},
+		{name: "pod-timezone-abbreviation", fixture: "pod-timezone-abbreviation"},
+		{name: "pod-hostpath", fixture: "pod-hostpath"},
+		{name: "pod-sidecar", fixture: "pod-sidecar"},
+		{name: "pod-not-injected", fixture: "pod-not-injected"},
+		{name: "pod-init-containers", fixture: "pod-init-containers"},
+		{name: "pod-container-timezones", fixture: "pod-container-timezones"},
+		{name: "pod-existing-tz", fixture: "pod-existing-tz"},
+		{
+			name:    "pod-existing-tz-skip",
+			fixture: "pod-existing-tz",
+			configure: func(h *admission.RequestsHandler) {
+				h.ConflictPolicy = inject.ConflictSkip
+			},
+		},
+		{
+			name:    "pod-default-hostpath",
+			fixture: "pod",
+			configure: func(h *admission.RequestsHandler) {
+				h.DefaultInjectionStrategy = inject.HostPathInjectionStrategy
+				h.DefaultTimezone = "America/Sao_Paulo"
+			},
+		},
+		{name: "pod-delete", fixture: "pod-delete"},
+		{name: "pod-v1beta1", fixture: "pod-v1beta1"},
+		{name: "pod-unparsable", fixture: "pod-unparsable"},
+		{name: "cronjob-disabled", fixture: "cronjob"},
+		{
+			name:    "cronjob-native",
+			fixture: "cronjob",
+			configure: func(h *admission.RequestsHandler) {
+				h.CronJobTimeZone = true
+				h.CronJobMode = inject.NativeCronJobMode
+			},
+		},
+		{
+			name:    "cronjob-template",
+			fixture: "cronjob",
+			configure: func(h *admission.RequestsHandler) {
+				h.CronJobTimeZone = true
+				h.CronJobMode = inject.TemplateCronJobMode
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler()
+			if tt.configure != nil {
+				tt.configure(h)
+			}
+
+			result, err := ReviewFile(h, filepath.Join("testdata", tt.fixture+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := CompareGolden(result, filepath.Join("testdata", tt.name+"-golden.json")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	h := NewHandler(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Annotations: map[string]string{"k8tz.io/timezone": "Europe/Paris"}}})
+
+	fixture, err := os.ReadFile("testdata/pod.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Review(h, []byte(strings.ReplaceAll(string(fixture), `"default"`, `"team-a"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Allowed || !strings.Contains(string(result.Patch), "Europe/Paris") {
+		t.Errorf("Review() = %+v, want the timezone of the namespace", result)
+	}
+}
+
+func TestReview_invalidFixture(t *testing.T) {
+	if _, err := Review(NewHandler(), []byte("{not json")); err == nil {
+		t.Error("Review() error = nil, want error")
+	}
+
+	if _, err := ReviewFile(NewHandler(), "testdata/missing.json"); err == nil {
+		t.Error("ReviewFile() error = nil, want error")
+	}
+}
+
+func TestCompareGolden(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "golden.json")
+	result := &Result{Allowed: true, Warnings: []string{"k8tz: warning"}}
+	if err := CompareGolden(result, golden); err != nil {
+		t.Fatalf("CompareGolden() of missing golden file error = %v", err)
+	}
+
+	if err := CompareGolden(result, golden); err != nil {
+		t.Errorf("CompareGolden() of same result error = %v", err)
+	}
+
+	if err := CompareGolden(&Result{Allowed: false}, golden); err == nil {
+		t.Error("CompareGolden() of different result error = nil, want error")
+	}
+
+	UpdateGoldens = true
+	defer func() { UpdateGoldens = false }()
+	if err := CompareGolden(&Result{Allowed: false}, golden); err != nil {
+		t.Errorf("CompareGolden() with UpdateGoldens error = %v", err)
+	}
+
+	UpdateGoldens = false
+	if err := CompareGolden(&Result{Allowed: false}, golden); err != nil {
+		t.Errorf("CompareGolden() of updated golden file error = %v", err)
+	}
+}
@@ -0,0 +1,520 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AuditOutcome is what happened to the object of an admission review
+type AuditOutcome string
+
+const (
+	// AuditMutated is the outcome of reviews that patched the object
+	AuditMutated AuditOutcome = "mutated"
+	// AuditSkipped is the outcome of reviews that allowed the object as is
+	AuditSkipped AuditOutcome = "skipped"
+	// AuditRejected is the outcome of reviews that rejected the object
+	AuditRejected AuditOutcome = "rejected"
+	// AuditAllowedOnError is the outcome of reviews that failed and allowed
+	// the object as is since the webhook fails open
+	AuditAllowedOnError AuditOutcome = "allowed-on-error"
+)
+
+const (
+	// DefaultAuditLogMaxSize is the size in megabytes of the audit log file
+	// before it is rotated
+	DefaultAuditLogMaxSize = 100
+	// DefaultAuditLogMaxBackups is the number of rotated audit log files
+	// that are kept
+	DefaultAuditLogMaxBackups = 5
+
+	// auditWebhookTimeout bounds the POST of a single record
+	auditWebhookTimeout = 5 * time.Second
+	// auditWebhookBuffer is the number of records that wait for the POST,
+	// records are dropped when the webhook cannot keep up
+	auditWebhookBuffer = 1024
+)
+
+var auditDroppedRecords uint64
+
+// AuditRecord is the audit log entry of a single admission review, one JSON
+// object per line
+type AuditRecord struct {
+	Time      time.Time                `json:"time"`
+	UID       string                   `json:"uid"`
+	Operation string                   `json:"operation"`
+	Kind      string                   `json:"kind"`
+	Namespace string                   `json:"namespace"`
+	Name      string                   `json:"name"`
+	Workload  string                   `json:"workload"`
+	Timezone  string                   `json:"timezone,omitempty"`
+	Strategy  inject.InjectionStrategy `json:"strategy,omitempty"`
+	Patches   int                      `json:"patches"`
+	PatchHash string                   `json:"patchHash,omitempty"`
+	Outcome   AuditOutcome             `json:"outcome"`
+	Reason    Reason                   `json:"reason,omitempty"`
+	Message   string                   `json:"message,omitempty"`
+	DryRun    bool                     `json:"dryRun"`
+}
+
+// AuditSink stores the audit records
+type AuditSink interface {
+	Write(record *AuditRecord) error
+	Close() error
+}
+
+// NewAuditSink returns the sink of the target: "stdout", an http(s) URL that
+// every record is POSTed to, or the path of a file that is rotated after
+// maxSize megabytes keeping maxBackups rotated files. With compress the
+// rotated files and the POST bodies are gzipped.
+func NewAuditSink(target string, maxSize int, maxBackups int, compress bool) (AuditSink, error) {
+	switch {
+	case target == "stdout":
+		return &streamAuditSink{out: os.Stdout}, nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return newWebhookAuditSink(target, http.DefaultClient, compress), nil
+	default:
+		return newFileAuditSink(strings.TrimPrefix(target, "file://"), int64(maxSize)*1024*1024, maxBackups, compress)
+	}
+}
+
+// OpenAuditLog opens the sink of AuditLog, nothing is recorded when it is
+// empty
+func (h *RequestsHandler) OpenAuditLog() error {
+	if h.AuditLog == "" {
+		return nil
+	}
+
+	sink, err := NewAuditSink(h.AuditLog, h.AuditLogMaxSize, h.AuditLogMaxBackups, h.AuditLogCompress)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	h.auditSink = sink
+	return nil
+}
+
+// CloseAuditLog flushes and closes the audit log
+func (h *RequestsHandler) CloseAuditLog() {
+	if h.auditSink == nil {
+		return
+	}
+
+	if err := h.auditSink.Close(); err != nil {
+		warningLogger.Printf("failed to close audit log: %v", err)
+	}
+}
+
+// recordInjection keeps the timezone and the strategy of the generator in the
+// state of the review for the audit log
+func (h *RequestsHandler) recordInjection(generator *inject.PatchGenerator) {
+	if h.state != nil {
+		h.state.timezone = generator.Timezone
+		h.state.strategy = generator.Strategy
+	}
+}
+
+// audit writes the record of the review, failures are logged since the
+// review must not depend on the audit log
+func (h *RequestsHandler) audit(req *admission.AdmissionRequest, state *reviewState, outcome AuditOutcome, patches []byte, count int, err error) {
+	if h.auditSink == nil {
+		return
+	}
+
+	record := auditRecord(req, state, outcome, patches, count, err)
+	record.DryRun = h.DryRun
+	if err := h.auditSink.Write(record); err != nil {
+		warningLogger.Printf("failed to write audit record of request uid=%s: %v", req.UID, err)
+	}
+}
+
+// auditRecord returns the audit record of the review, the patch hash is the
+// sha256 of the JSON patch
+func auditRecord(req *admission.AdmissionRequest, state *reviewState, outcome AuditOutcome, patches []byte, count int, err error) *AuditRecord {
+	object := metav1.PartialObjectMetadata{}
+	if len(req.Object.Raw) > 0 {
+		// only the metadata is needed, a failure leaves the name empty
+		_ = json.Unmarshal(req.Object.Raw, &object)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = object.Name
+	}
+
+	if name == "" {
+		name = object.GenerateName
+	}
+
+	workload := fmt.Sprintf("%s/%s", req.Kind.Kind, name)
+	if owner := metav1.GetControllerOfNoCopy(&object); owner != nil {
+		workload = fmt.Sprintf("%s/%s", owner.Kind, owner.Name)
+	}
+
+	record := &AuditRecord{
+		Time:      time.Now().UTC(),
+		UID:       string(req.UID),
+		Operation: string(req.Operation),
+		Kind:      req.Kind.Kind,
+		Namespace: req.Namespace,
+		Name:      name,
+		Workload:  workload,
+		Patches:   count,
+		Outcome:   outcome,
+	}
+
+	if count > 0 {
+		sum := sha256.Sum256(patches)
+		record.PatchHash = "sha256:" + hex.EncodeToString(sum[:])
+		record.Timezone = state.timezone
+		record.Strategy = state.strategy
+	}
+
+	switch {
+	case err != nil:
+		record.Reason = reasonOf(err)
+		record.Message = err.Error()
+	case outcome == AuditSkipped:
+		record.Reason = state.skipReason
+		record.Message = state.skipMessage
+	}
+
+	return record
+}
+
+// streamAuditSink writes the records to a stream, one JSON object per line
+type streamAuditSink struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (s *streamAuditSink) Write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.out.Write(append(line, '\n'))
+	return err
+}
+
+func (s *streamAuditSink) Close() error {
+	return nil
+}
+
+// fileAuditSink writes the records to a file that is rotated when it grows
+// over maxSize, the rotated files are named <path>.1 (the newest) up to
+// <path>.<maxBackups>, or <path>.1.gz and so on when they are compressed
+type fileAuditSink struct {
+	mu          sync.Mutex
+	path        string
+	maxSize     int64
+	maxBackups  int
+	compress    bool
+	file        *os.File
+	size        int64
+	compressing sync.WaitGroup
+}
+
+func newFileAuditSink(path string, maxSize int64, maxBackups int, compress bool) (*fileAuditSink, error) {
+	s := &fileAuditSink{path: path, maxSize: maxSize, maxBackups: maxBackups, compress: compress}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *fileAuditSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate moves the file to <path>.1 and opens a new one, the oldest backup is
+// removed. With compress the moved file is gzipped to <path>.1.gz in the
+// background, so the reviews that write records are not delayed by it. The
+// file is reopened whatever fails, a file that could not be moved keeps
+// growing until the next rotation.
+func (s *fileAuditSink) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err == nil {
+		err = s.moveToBackup()
+	}
+
+	if openErr := s.open(); openErr != nil {
+		// the next write opens the file again
+		return fmt.Errorf("failed to reopen %s: %w", s.path, openErr)
+	}
+
+	return err
+}
+
+// moveToBackup shifts the backups and moves the closed file to the first one
+func (s *fileAuditSink) moveToBackup() error {
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	// the previous file must be compressed before the backups are shifted
+	s.compressing.Wait()
+
+	_ = os.Remove(s.backup(s.maxBackups))
+	for i := s.maxBackups - 1; i > 0; i-- {
+		_ = os.Rename(s.backup(i), s.backup(i+1))
+	}
+
+	if !s.compress {
+		return os.Rename(s.path, s.backup(1))
+	}
+
+	rotated := fmt.Sprintf("%s.1", s.path)
+	if err := os.Rename(s.path, rotated); err != nil {
+		return err
+	}
+
+	s.compressing.Add(1)
+	go func(dst string) {
+		defer s.compressing.Done()
+
+		if err := gzipFile(rotated, dst); err != nil {
+			warningLogger.Printf("failed to compress the rotated audit log, it is kept uncompressed: %v", err)
+			return
+		}
+
+		if err := os.Remove(rotated); err != nil {
+			warningLogger.Printf("failed to remove the compressed audit log %s: %v", rotated, err)
+		}
+	}(s.backup(1))
+
+	return nil
+}
+
+// backup returns the name of the i-th rotated file
+func (s *fileAuditSink) backup(i int) string {
+	if s.compress {
+		return fmt.Sprintf("%s.%d.gz", s.path, i)
+	}
+
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// gzipFile writes the gzipped content of the file to dst
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(dst)
+		return fmt.Errorf("failed to compress %s: %w", src, err)
+	}
+
+	return nil
+}
+
+func (s *fileAuditSink) Write(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return fmt.Errorf("failed to open %s: %w", s.path, err)
+		}
+	}
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil && s.file == nil {
+			return fmt.Errorf("failed to rotate %s: %w", s.path, err)
+		} else if err != nil {
+			warningLogger.Printf("failed to rotate %s, the records are still written to it: %v", s.path, err)
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *fileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.compressing.Wait()
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Close()
+}
+
+// webhookAuditSink POSTs every record (JSON) to a URL in the background, so
+// the reviews are not delayed by the webhook. Records are dropped when the
+// buffer is full, and failed POSTs are not retried. With compress the bodies
+// are sent with "Content-Encoding: gzip".
+type webhookAuditSink struct {
+	url      string
+	client   *http.Client
+	compress bool
+	records  chan *AuditRecord
+	done     chan struct{}
+}
+
+func newWebhookAuditSink(url string, client *http.Client, compress bool) *webhookAuditSink {
+	s := &webhookAuditSink{
+		url:      url,
+		client:   client,
+		compress: compress,
+		records:  make(chan *AuditRecord, auditWebhookBuffer),
+		done:     make(chan struct{}),
+	}
+
+	go s.run()
+	return s
+}
+
+func (s *webhookAuditSink) run() {
+	defer close(s.done)
+
+	for record := range s.records {
+		if err := s.post(record); err != nil {
+			warningLogger.Printf("failed to send audit record of request uid=%s to %s: %v", record.UID, s.url, err)
+		}
+	}
+}
+
+func (s *webhookAuditSink) post(record *AuditRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if s.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err = zw.Write(body); err != nil {
+			return err
+		}
+
+		if err = zw.Close(); err != nil {
+			return err
+		}
+
+		body = buf.Bytes()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", jsonContentType)
+	if s.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (s *webhookAuditSink) Write(record *AuditRecord) error {
+	select {
+	case s.records <- record:
+		return nil
+	default:
+		atomic.AddUint64(&auditDroppedRecords, 1)
+		return fmt.Errorf("audit webhook buffer is full, record dropped")
+	}
+}
+
+// Close sends the buffered records and stops the sink
+func (s *webhookAuditSink) Close() error {
+	close(s.records)
+	<-s.done
+	return nil
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/apis/v1alpha1"
+	"github.com/k8tz/k8tz/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// imageTag is the grammar of image tags
+var imageTag = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// bootstrapImage is the bootstrap image of a pod and its image pull secrets
+type bootstrapImage struct {
+	image       string
+	archImages  map[string]string
+	pullSecrets []string
+}
+
+// bootstrap returns the bootstrap image and image pull secrets of the pods of
+// the namespace, e.g. for tenants that pull from their own registry. The
+// repository, tag and pull secrets of the namespace annotations take
+// precedence over the timezone policy, which takes precedence over the
+// handler defaults.
+func (h *RequestsHandler) bootstrap(policy *v1alpha1.TimezonePolicy, namespace *corev1.Namespace, kind string, details string) (bootstrapImage, error) {
+	b := bootstrapImage{
+		image:       h.BootstrapImage,
+		archImages:  h.BootstrapArchImages,
+		pullSecrets: h.BootstrapPullSecrets,
+	}
+
+	var repository, tag string
+	if policy != nil && policy.Spec.Bootstrap != nil {
+		repository, tag = policy.Spec.Bootstrap.Repository, policy.Spec.Bootstrap.Tag
+		if len(policy.Spec.Bootstrap.ImagePullSecrets) > 0 {
+			b.pullSecrets = policy.Spec.Bootstrap.ImagePullSecrets
+		}
+	}
+
+	if val, ok := namespace.Annotations[k8tz.BootstrapRepositoryAnnotation]; ok {
+		repository = val
+	}
+
+	if val, ok := namespace.Annotations[k8tz.BootstrapTagAnnotation]; ok {
+		tag = val
+	}
+
+	if val, ok := namespace.Annotations[k8tz.BootstrapPullSecretsAnnotation]; ok {
+		b.pullSecrets = splitPullSecrets(val)
+	}
+
+	for _, secret := range b.pullSecrets {
+		if errs := validation.IsDNS1123Subdomain(secret); len(errs) > 0 {
+			return b, withReason(ReasonInvalidObject, "invalid bootstrap image pull secret %q of %s (%s): %s", secret, kind, details, strings.Join(errs, ", "))
+		}
+	}
+
+	if repository == "" && tag == "" {
+		return b, nil
+	}
+
+	if err := h.validateBootstrapRepository(repository); err != nil {
+		return b, withReason(ReasonInvalidObject, "invalid bootstrap image repository of %s (%s): %v", kind, details, err)
+	}
+
+	if tag != "" && !imageTag.MatchString(tag) {
+		return b, withReason(ReasonInvalidObject, "invalid bootstrap image tag of %s (%s): %q", kind, details, tag)
+	}
+
+	image, err := overrideImage(b.image, repository, tag)
+	if err != nil {
+		return b, err
+	}
+
+	if image != b.image {
+		infoLogger.Printf("bootstrap image of %s (%s) overridden by its namespace or timezone policy: %s", kind, details, image)
+	}
+	b.image = image
+
+	// the images by architecture are moved to the repository, a tag applies
+	// to all architectures so they are not used with it
+	archImages := map[string]string{}
+	if tag == "" {
+		for arch, archImage := range b.archImages {
+			if archImages[arch], err = overrideImage(archImage, repository, ""); err != nil {
+				return b, err
+			}
+		}
+	}
+	b.archImages = archImages
+
+	return b, nil
+}
+
+// overrideImage returns the image with the repository and tag replaced, the
+// digest of a pinned image is kept with a new repository since it is the same
+// image in a mirror, but a new tag is ignored since it would not match the
+// digest anymore
+func overrideImage(image string, repository string, tag string) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid bootstrap image: %w", err)
+	}
+
+	if repository != "" {
+		ref.Name = repository
+	}
+
+	if tag != "" && ref.Digest != "" {
+		warningLogger.Printf("ignoring bootstrap image tag %s, the bootstrap image is pinned to %s", tag, ref.Digest)
+	} else if tag != "" {
+		ref.Tag = tag
+	}
+
+	return ref.String(), nil
+}
+
+// validateBootstrapRepository checks a repository that overrides the one of
+// the bootstrap image, it must be in one of the BootstrapRegistries if they
+// are set
+func (h *RequestsHandler) validateBootstrapRepository(repository string) error {
+	if repository == "" {
+		return nil
+	}
+
+	if strings.ContainsAny(repository, "@ ") || strings.HasSuffix(repository, "/") ||
+		strings.LastIndex(repository, ":") > strings.LastIndex(repository, "/") {
+		return fmt.Errorf("%q must be a repository without a tag or digest", repository)
+	}
+
+	if len(h.BootstrapRegistries) == 0 {
+		return nil
+	}
+
+	for _, allowed := range h.BootstrapRegistries {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if repository == allowed || strings.HasPrefix(repository, allowed+"/") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s is not in the allowed registries %s", repository, strings.Join(h.BootstrapRegistries, ", "))
+}
+
+// splitPullSecrets returns the secret names of a comma separated list
+func splitPullSecrets(val string) []string {
+	secrets := []string{}
+	for _, secret := range strings.Split(val, ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	return secrets
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheSyncTimeout is how long the webhook waits for the initial list of the
+// objects of the informers
+const cacheSyncTimeout = 30 * time.Second
+
+// startCaches starts the shared informers of the objects that the reviews
+// look up, so they are read from memory instead of the api server: the
+// namespaces with NamespaceCache, the Jobs and CronJobs with CronJobOwners and
+// the nodes with AutoTimezone or HostPathNodeLabel. The listers are used right
+// away, objects that are missing from a cache that is still syncing are
+// fetched from the api server. The informers run until stop is closed.
+func (h *RequestsHandler) startCaches(stop <-chan struct{}) {
+	factory := informers.NewSharedInformerFactory(h.clientset, 0)
+	h.cacheSynced = nil
+
+	if h.NamespaceCache {
+		namespaces := factory.Core().V1().Namespaces()
+		h.cacheSynced = append(h.cacheSynced, namespaces.Informer().HasSynced)
+		h.namespaces = namespaces.Lister()
+	}
+
+	if h.CronJobOwners {
+		jobs := factory.Batch().V1().Jobs()
+		cronJobs := factory.Batch().V1().CronJobs()
+		h.cacheSynced = append(h.cacheSynced, jobs.Informer().HasSynced, cronJobs.Informer().HasSynced)
+		h.jobs = jobs.Lister()
+		h.cronJobs = cronJobs.Lister()
+	}
+
+	if h.AutoTimezone || h.HostPathNodeLabel != "" {
+		nodes := factory.Core().V1().Nodes()
+		h.cacheSynced = append(h.cacheSynced, nodes.Informer().HasSynced)
+		h.nodes = nodes.Lister()
+	}
+
+	factory.Start(stop)
+}
+
+// waitForCaches waits up to the timeout until the informer caches are synced
+func (h *RequestsHandler) waitForCaches(timeout time.Duration) error {
+	expired := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(expired) })
+	defer timer.Stop()
+
+	if !cache.WaitForCacheSync(expired, h.cacheSynced...) {
+		return fmt.Errorf("informer caches were not synced within %s", timeout)
+	}
+
+	infoLogger.Printf("informer caches synced")
+	return nil
+}
+
+// cachesSynced returns true once all the informer caches are synced, the
+// webhook is not ready before since every review would reach the api server
+func (h *RequestsHandler) cachesSynced() bool {
+	for _, synced := range h.cacheSynced {
+		if !synced() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getNode returns the node from the cache if it is enabled, or from the api
+// server otherwise. Nodes that are missing from the cache are fetched as well
+// since they may have joined the cluster just now.
+func (h *RequestsHandler) getNode(name string) (*corev1.Node, error) {
+	if h.nodes != nil {
+		node, err := h.nodes.Get(name)
+		if err == nil {
+			return node, nil
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return h.clientset.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+}
@@ -0,0 +1,88 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Capabilities describes what the running webhook supports, it is served on
+// /capabilities for tools and dashboards
+type Capabilities struct {
+	Version         string                        `json:"version"`
+	Strategies      []inject.InjectionStrategy    `json:"strategies"`
+	Resources       []metav1.GroupVersionResource `json:"resources"`
+	DefaultStrategy inject.InjectionStrategy      `json:"defaultStrategy"`
+	DefaultTimezone string                        `json:"defaultTimezone"`
+	TemplatePaths   TemplatePaths                 `json:"templatePaths,omitempty"`
+	CronJobMode     inject.CronJobMode            `json:"cronJobMode,omitempty"`
+}
+
+// Capabilities returns the capabilities of the handler, CronJobs and workloads
+// are listed only when their injection is enabled
+func (h *RequestsHandler) Capabilities() Capabilities {
+	var resources []metav1.GroupVersionResource
+	for gvr := range resourceHandlers {
+		if gvr == cronJobResource && !h.CronJobTimeZone {
+			continue
+		}
+
+		if _, workload := workloadResources[gvr]; workload && !h.InjectWorkloads {
+			continue
+		}
+
+		resources = append(resources, gvr)
+	}
+
+	var cronJobMode inject.CronJobMode
+	if h.CronJobTimeZone {
+		cronJobMode = h.cronJobMode()
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].String() < resources[j].String()
+	})
+
+	return Capabilities{
+		Version:         version.Version(),
+		Strategies:      inject.RegisteredStrategies(),
+		Resources:       resources,
+		DefaultStrategy: h.DefaultInjectionStrategy,
+		DefaultTimezone: h.DefaultTimezone,
+		TemplatePaths:   h.TemplatePaths,
+		CronJobMode:     cronJobMode,
+	}
+}
+
+func (h *Server) capabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	handler := h.Handler.configured()
+	if err := json.NewEncoder(w).Encode(handler.Capabilities()); err != nil {
+		errorLogger.Printf("failed to write capabilities: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// certificateExpiryWarning is how long before the expiration of the serving
+// certificate a warning is logged on every reload
+const certificateExpiryWarning = 7 * 24 * time.Hour
+
+// certificateLoader caches the parsed serving certificate and reloads it when
+// the files change, so a handshake never reads from disk
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	data []byte
+
+	now func() time.Time
+}
+
+// newCertificateLoader loads and validates the certificate, an error is
+// returned if it is invalid. Missing files are tolerated since they may be
+// written by the cert-watcher sidecar after the webhook starts.
+func newCertificateLoader(certFile string, keyFile string) (*certificateLoader, error) {
+	l := &certificateLoader{certFile: certFile, keyFile: keyFile, now: time.Now}
+	if _, err := l.reload(); errors.Is(err, fs.ErrNotExist) {
+		warningLogger.Printf("TLS certificate is not available yet: %v", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// GetCertificate returns the cached certificate, it is used as
+// tls.Config.GetCertificate. The files are read only if no certificate was
+// loaded yet.
+func (l *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := l.current(); cert != nil {
+		return cert, nil
+	}
+
+	if _, err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	return l.current(), nil
+}
+
+// current returns the cached certificate without reading the files, nil if
+// no certificate was loaded yet
+func (l *certificateLoader) current() *tls.Certificate {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.cert
+}
+
+// reload loads the certificate if the content of the files changed since the
+// last load, and returns true if it was replaced. The previous certificate is
+// kept when the new one is invalid.
+func (l *certificateLoader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(l.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(l.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read TLS key: %w", err)
+	}
+
+	data := append(append([]byte{}, certPEM...), keyPEM...)
+
+	l.mu.RLock()
+	unchanged := bytes.Equal(data, l.data)
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse TLS key pair: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+
+	now := l.now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return false, fmt.Errorf("TLS certificate is not valid now, valid from %s until %s", leaf.NotBefore, leaf.NotAfter)
+	}
+
+	if leaf.NotAfter.Sub(now) < certificateExpiryWarning {
+		warningLogger.Printf("TLS certificate expires soon: %s", leaf.NotAfter)
+	}
+
+	cert.Leaf = leaf
+
+	l.mu.Lock()
+	l.cert = &cert
+	l.data = data
+	l.mu.Unlock()
+	atomic.StoreInt64(&certificateLoadedAt, now.Unix())
+
+	infoLogger.Printf("TLS certificate loaded: subject=%s, serial=%s, expires=%s", leaf.Subject, leaf.SerialNumber, leaf.NotAfter)
+	return true, nil
+}
+
+// watch checks the certificate files for changes every interval until stop is
+// closed, which picks up rotations by cert-manager or the cert-watcher
+func (l *certificateLoader) watch(interval time.Duration, jitter time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(jitteredInterval(interval, jitter))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			if _, err := l.reload(); err != nil {
+				errorLogger.Printf("failed to reload TLS certificate, keeping the previous one: %v", err)
+			}
+			timer.Reset(jitteredInterval(interval, jitter))
+		}
+	}
+}
+
+// jitteredInterval returns the interval plus a random duration of up to the
+// jitter, so the replicas of the webhook do not all read the certificate
+// files at the same time
+func jitteredInterval(interval time.Duration, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(jitter)+1))
+}
+
+// requireClientCertificates configures the TLS server to require client
+// certificates signed by the CAs of the file, e.g. the kube-apiserver's
+// client certificate, so only the api server can send admission reviews
+func requireClientCertificates(config *tls.Config, caFile string) error {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FailureMode is how a request selected by the test-only failure injection
+// fails
+type FailureMode string
+
+const (
+	// FailureModeDeny rejects the admission request
+	FailureModeDeny FailureMode = "deny"
+	// FailureModeError fails the webhook call with an internal server error,
+	// so the failurePolicy of the webhook configuration is applied
+	FailureModeError FailureMode = "error"
+	// FailureModeSlow delays the response by the Delay of Chaos, so the
+	// timeoutSeconds of the webhook configuration can be tuned
+	FailureModeSlow FailureMode = "slow"
+	// FailureModeMalformed allows the request with a patch that is not a
+	// JSON patch, so the api server fails the webhook call
+	FailureModeMalformed FailureMode = "malformed"
+	// FailureModeTLS fails the TLS handshake of new connections, every
+	// response closes its connection so each request needs a new handshake
+	FailureModeTLS FailureMode = "tls"
+)
+
+// FailureModes are the modes of the test-only failure injection
+var FailureModes = []FailureMode{FailureModeDeny, FailureModeError, FailureModeSlow, FailureModeMalformed, FailureModeTLS}
+
+// Chaos is the test-only failure injection. Only the binaries built with the
+// chaos tag create it and register its flags, it is nil in the release
+// binaries so no review can fail on purpose there.
+type Chaos struct {
+	// requests counts the requests seen by the failure injection, it is
+	// first so it is 64-bit aligned for the atomic operations
+	requests uint64
+
+	Rate     float64
+	Mode     FailureMode
+	Delay    time.Duration
+	Endpoint bool
+
+	// mu serializes the changes of the settings by the chaos endpoint
+	mu sync.Mutex
+	// settings holds the failureInjection in effect, the chaos endpoint
+	// changes it at runtime while the reviews work on copies of the handler
+	settings atomic.Value
+}
+
+// NewChaos returns the failure injection with the default settings, it fails
+// no request until the rate is set
+func NewChaos() *Chaos {
+	return &Chaos{
+		Rate:  0,
+		Mode:  FailureModeDeny,
+		Delay: 15 * time.Second,
+	}
+}
+
+// failureInjection are the test-only failure injection settings in effect
+type failureInjection struct {
+	rate  float64
+	mode  FailureMode
+	delay time.Duration
+}
+
+// load returns the failure injection settings in effect, none without chaos
+func (c *Chaos) load() failureInjection {
+	if c == nil {
+		return failureInjection{}
+	}
+
+	f, _ := c.settings.Load().(failureInjection)
+	return f
+}
+
+// FailureSettings are the test-only failure injection settings served and
+// changed by the chaos endpoint
+type FailureSettings struct {
+	Rate  float64     `json:"rate"`
+	Mode  FailureMode `json:"mode"`
+	Delay string      `json:"delay"`
+}
+
+// validate checks the test-only failure injection settings, puts them in
+// effect and warns loudly when it is enabled
+func (c *Chaos) validate() error {
+	if c.Rate != 0 {
+		if err := validateFailureSettings(c.Rate, c.Mode, c.Delay); err != nil {
+			return err
+		}
+
+		for i := 0; i < 3; i++ {
+			warningLogger.Printf("!!! TEST ONLY: failure injection is enabled, %.0f%% of the requests will fail (%s). NEVER USE IN PRODUCTION !!!", c.Rate*100, c.Mode)
+		}
+	}
+
+	c.settings.Store(failureInjection{rate: c.Rate, mode: c.Mode, delay: c.Delay})
+	return nil
+}
+
+func validateFailureSettings(rate float64, mode FailureMode, delay time.Duration) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("failure rate must be between 0 and 1, got %v", rate)
+	}
+
+	switch mode {
+	case FailureModeDeny, FailureModeError, FailureModeMalformed, FailureModeTLS:
+	case FailureModeSlow:
+		if delay <= 0 {
+			return fmt.Errorf("failure mode %s requires a positive delay", mode)
+		}
+	default:
+		return fmt.Errorf("unknown failure mode: %s, expected one of %v", mode, FailureModes)
+	}
+
+	return nil
+}
+
+// shouldFail returns true if the current request should fail. The selection
+// is deterministic: out of every N requests, exactly N*rate (rounded down)
+// fail, evenly spread.
+func (c *Chaos) shouldFail(f failureInjection) bool {
+	if f.rate <= 0 {
+		return false
+	}
+
+	n := atomic.AddUint64(&c.requests, 1)
+	return uint64(float64(n)*f.rate) > uint64(float64(n-1)*f.rate)
+}
+
+// closesConnections returns true if the TLS failures are injected, so the
+// responses close their connection and the next request needs a handshake
+func (f failureInjection) closesConnections() bool {
+	return f.rate > 0 && f.mode == FailureModeTLS
+}
+
+// reviewFailure returns the mode of the failure that the current review
+// should have, false is returned if it should not fail. TLS failures are
+// injected in the handshake instead.
+func (c *Chaos) reviewFailure() (FailureMode, time.Duration, bool) {
+	f := c.load()
+	if f.mode == FailureModeTLS || !c.shouldFail(f) {
+		return "", 0, false
+	}
+
+	return f.mode, f.delay, true
+}
+
+// getCertificate wraps the GetCertificate of the server certificate, so
+// handshakes fail when TLS failures are injected
+func (h *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if f := h.Chaos.load(); f.closesConnections() && h.Chaos.shouldFail(f) {
+		warningLogger.Printf("TEST ONLY: injecting TLS handshake failure to %s", hello.Conn.RemoteAddr())
+		return nil, errors.New("injected TLS failure (test only)")
+	}
+
+	return h.certificate.GetCertificate(hello)
+}
+
+// chaos serves the failure injection settings, a POST changes them with the
+// rate, mode and delay query parameters so outage scenarios can be rehearsed
+// without restarting the webhook. It is served on the debug listener, and
+// only by binaries built with the chaos tag.
+func (c *Chaos) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := c.set(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "only GET and POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f := c.load()
+	settings := FailureSettings{
+		Rate:  f.rate,
+		Mode:  f.mode,
+		Delay: f.delay.String(),
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	if err := json.NewEncoder(w).Encode(settings); err != nil {
+		errorLogger.Printf("failed to write failure settings: %v", err)
+	}
+}
+
+// set changes the settings that are set in the query of the request, the
+// others are kept
+func (c *Chaos) set(r *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := c.load()
+	query := r.URL.Query()
+
+	var err error
+	if v := query.Get("rate"); v != "" {
+		if f.rate, err = strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("invalid rate %q: %w", v, err)
+		}
+	}
+
+	if v := query.Get("mode"); v != "" {
+		f.mode = FailureMode(v)
+	}
+
+	if v := query.Get("delay"); v != "" {
+		if f.delay, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("invalid delay %q: %w", v, err)
+		}
+	}
+
+	if err = validateFailureSettings(f.rate, f.mode, f.delay); err != nil {
+		return err
+	}
+
+	c.settings.Store(f)
+	warningLogger.Printf("!!! TEST ONLY: failure injection changed, %.0f%% of the requests will fail (%s) !!!", f.rate*100, f.mode)
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync/atomic"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	ConfigTimezone           = "timezone"
+	ConfigInjectionStrategy  = "injectionStrategy"
+	ConfigBootstrapImage     = "bootstrapImage"
+	ConfigExcludedNamespaces = "excludedNamespaces"
+)
+
+// WebhookConfig holds the handler defaults that are reloaded at runtime from
+// the ConfigFile, e.g. a mounted ConfigMap. Empty values keep the defaults of
+// the flags.
+type WebhookConfig struct {
+	Timezone           string                   `json:"timezone,omitempty"`
+	InjectionStrategy  inject.InjectionStrategy `json:"injectionStrategy,omitempty"`
+	BootstrapImage     string                   `json:"bootstrapImage,omitempty"`
+	ExcludedNamespaces []string                 `json:"excludedNamespaces,omitempty"`
+}
+
+// webhookConfig holds the current *WebhookConfig, it is swapped as a whole on
+// reload and applied to the copy of the handler of every request
+var webhookConfig atomic.Value
+
+// LoadWebhookConfig reads a YAML (or JSON) webhook configuration file
+func LoadWebhookConfig(file string) (*WebhookConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+
+	config := &WebhookConfig{}
+	if err = yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook config: %w", err)
+	}
+
+	if _, ok := inject.LookupStrategy(config.InjectionStrategy); config.InjectionStrategy != "" && !ok {
+		return nil, fmt.Errorf("unknown injection strategy in webhook config: %s", config.InjectionStrategy)
+	}
+
+	for _, pattern := range config.ExcludedNamespaces {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid excluded namespace pattern %q in webhook config: %w", pattern, err)
+		}
+	}
+
+	return config, nil
+}
+
+func currentWebhookConfig() *WebhookConfig {
+	config, _ := webhookConfig.Load().(*WebhookConfig)
+	return config
+}
+
+// reloadConfig loads the ConfigFile and swaps the current configuration, the
+// previous configuration is kept when the file cannot be loaded
+func (h *RequestsHandler) reloadConfig() error {
+	config, err := LoadWebhookConfig(h.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if config.Timezone != "" {
+		if config.Timezone, err = inject.CanonicalTimezone(config.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone in webhook config: %w", err)
+		}
+
+		if info, err := os.Stat(h.ZoneInfoPath); err == nil && info.IsDir() {
+			if err = inject.ValidateTimezone(h.ZoneInfoPath, config.Timezone); err != nil {
+				return fmt.Errorf("invalid timezone in webhook config: %w", err)
+			}
+		}
+	}
+
+	if config.BootstrapImage != "" && (h.PinBootstrapDigest || h.BootstrapVerifyKey != "") {
+		warningLogger.Printf("%s of the webhook config is ignored, the bootstrap image is pinned at startup", ConfigBootstrapImage)
+		config.BootstrapImage = ""
+	}
+
+	webhookConfig.Store(config)
+	infoLogger.Printf("webhook config loaded from %s: %+v", h.ConfigFile, *config)
+	return nil
+}
+
+// watchConfig reloads the ConfigFile on SIGHUP and whenever its content
+// changes, until stop is closed
+func (h *RequestsHandler) watchConfig(stop <-chan struct{}) {
+	watchFile(h.ConfigFile, h.ConfigReload, "webhook config", h.reloadConfig, stop)
+}
+
+// configured returns a copy of the handler with the current webhook config
+// applied, the values of the ConfigOverrides keys keep the value of their flag
+func (h *RequestsHandler) configured() RequestsHandler {
+	handler := *h
+	config := currentWebhookConfig()
+	if config == nil {
+		return handler
+	}
+
+	overridden := map[string]bool{}
+	for _, key := range h.ConfigOverrides {
+		overridden[key] = true
+	}
+
+	if config.Timezone != "" && !overridden[ConfigTimezone] {
+		handler.DefaultTimezone = config.Timezone
+	}
+
+	if config.InjectionStrategy != "" && !overridden[ConfigInjectionStrategy] {
+		handler.DefaultInjectionStrategy = config.InjectionStrategy
+	}
+
+	if config.BootstrapImage != "" && !overridden[ConfigBootstrapImage] {
+		handler.BootstrapImage = config.BootstrapImage
+	}
+
+	if config.ExcludedNamespaces != nil && !overridden[ConfigExcludedNamespaces] {
+		handler.ExcludedNamespaces = config.ExcludedNamespaces
+	}
+
+	return handler
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CryptoPolicy restricts the cryptography of the webhook server
+type CryptoPolicy string
+
+const (
+	// DefaultCryptoPolicy uses the TLS settings of the flags with the crypto
+	// backend of the binary
+	DefaultCryptoPolicy CryptoPolicy = "default"
+	// FIPSCryptoPolicy requires a binary built with a FIPS 140 validated
+	// crypto backend and restricts TLS to FIPS-approved versions, cipher
+	// suites and curves
+	FIPSCryptoPolicy CryptoPolicy = "fips"
+)
+
+// fipsCipherSuites are the FIPS-approved TLS 1.2 cipher suites, the TLS 1.3
+// suites are not configurable and are restricted to AES-GCM by the backend
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// cryptoBackend returns the name of the crypto backend of the binary and
+// whether it is a FIPS 140 validated module that is in use
+var cryptoBackend = detectCryptoBackend
+
+// Validate returns an error if the crypto policy is unknown
+func (p CryptoPolicy) Validate() error {
+	switch p {
+	case DefaultCryptoPolicy, FIPSCryptoPolicy:
+		return nil
+	default:
+		return fmt.Errorf("unknown crypto policy %q, expected %s or %s", p, DefaultCryptoPolicy, FIPSCryptoPolicy)
+	}
+}
+
+// applyCryptoPolicy checks the crypto backend and the TLS settings against
+// the crypto policy, all the FIPS-approved cipher suites are used unless
+// --tls-cipher-suites selects some of them
+func (h *Server) applyCryptoPolicy(tlsConfig *tls.Config) error {
+	if err := h.CryptoPolicy.Validate(); err != nil {
+		return err
+	}
+
+	if h.CryptoPolicy != FIPSCryptoPolicy {
+		return nil
+	}
+
+	if backend, fips := cryptoBackend(); !fips {
+		return fmt.Errorf("the %s crypto policy requires a binary built with a FIPS 140 validated crypto backend (GOEXPERIMENT=boringcrypto and the fips build tag), this binary uses %s", FIPSCryptoPolicy, backend)
+	}
+
+	if tlsConfig.MinVersion < tls.VersionTLS12 {
+		return fmt.Errorf("the %s crypto policy requires TLS 1.2 or later (--tls-min-version)", FIPSCryptoPolicy)
+	}
+
+	if len(tlsConfig.CipherSuites) == 0 {
+		tlsConfig.CipherSuites = fipsCipherSuites
+	}
+
+	var rejected []string
+	for _, id := range tlsConfig.CipherSuites {
+		if !isFIPSCipherSuite(id) {
+			rejected = append(rejected, tls.CipherSuiteName(id))
+		}
+	}
+
+	if len(rejected) > 0 {
+		return errors.New("cipher suites that are not FIPS-approved are configured (--tls-cipher-suites): " + strings.Join(rejected, ", "))
+	}
+
+	tlsConfig.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+	infoLogger.Printf("TLS is restricted by the %s crypto policy", FIPSCryptoPolicy)
+	return nil
+}
+
+func isFIPSCipherSuite(id uint16) bool {
+	for _, approved := range fipsCipherSuites {
+		if id == approved {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,33 @@
+//go:build fips
+
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"crypto/boring"
+
+	// restricts all the TLS configurations of the process, including the
+	// clients of the kubernetes api, to FIPS-approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+// detectCryptoBackend returns BoringCrypto, the FIPS 140 validated module of
+// binaries built with GOEXPERIMENT=boringcrypto and the fips build tag
+func detectCryptoBackend() (string, bool) {
+	return "boringcrypto", boring.Enabled()
+}
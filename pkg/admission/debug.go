@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// DefaultDebugAddress is the default bind address of the debug server, it is
+// reachable from inside the pod only, e.g. with 'kubectl port-forward'
+const DefaultDebugAddress = "localhost:6060"
+
+// debugServer returns the plaintext server of the pprof and expvar endpoints,
+// of the report of the pods in the cluster and of the test-only chaos
+// endpoint, it must only listen on a loopback address since it exposes the
+// internals of the process and of the cluster without any authentication
+func (h *Server) debugServer() (*http.Server, error) {
+	if !isLoopbackAddress(h.DebugAddress) {
+		return nil, fmt.Errorf("debug address %s is not a loopback address, e.g. %s", h.DebugAddress, DefaultDebugAddress)
+	}
+
+	mux := http.NewServeMux()
+	if h.EnablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+
+	if h.EnableReport {
+		mux.HandleFunc("/report", h.report)
+	}
+
+	if h.Chaos != nil && h.Chaos.Endpoint {
+		warningLogger.Printf("!!! TEST ONLY: failure injection can be changed on /chaos. NEVER USE IN PRODUCTION !!!")
+		mux.HandleFunc("/chaos", h.Chaos.serveHTTP)
+	}
+
+	return &http.Server{
+		Addr:    h.DebugAddress,
+		Handler: mux,
+	}, nil
+}
+
+// isLoopbackAddress returns true if the host of the address is localhost or a
+// loopback ip, an empty host listens on all interfaces and is not loopback
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+var (
+	circuitBreakerOpen  int32
+	circuitBreakerTrips uint64
+)
+
+// limitRate creates the token bucket of the reviews, there is no limit if
+// MaxReviewsPerSecond is not positive. The burst is the rate (at least 1)
+// when ReviewBurst is not positive.
+func (h *RequestsHandler) limitRate() {
+	if h.MaxReviewsPerSecond <= 0 {
+		return
+	}
+
+	burst := h.ReviewBurst
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(h.MaxReviewsPerSecond)))
+	}
+
+	h.rateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(h.MaxReviewsPerSecond), burst)
+}
+
+// startCircuitBreaker creates the circuit breaker, it is disabled if
+// CircuitBreakerThreshold is not positive
+func (h *RequestsHandler) startCircuitBreaker() {
+	if h.CircuitBreakerThreshold > 0 {
+		h.breaker = &circuitBreaker{
+			threshold: h.CircuitBreakerThreshold,
+			window:    h.CircuitBreakerWindow,
+			cooldown:  h.CircuitBreakerCooldown,
+		}
+	}
+}
+
+// degraded returns the reason and the message if the review must be allowed
+// without evaluating it, since the reviews exceed the rate limit or the
+// circuit breaker is open. trial is true if the review is the single trial of
+// the half-open circuit breaker, its outcome must be passed to recordOutcome.
+func (h *RequestsHandler) degraded(now time.Time) (reason Reason, message string, trial bool) {
+	allowed := true
+	if h.breaker != nil {
+		allowed, trial = h.breaker.allow(now)
+	}
+
+	if !allowed {
+		return ReasonCircuitOpen, fmt.Sprintf("circuit breaker is open after %d errors within %s", h.breaker.threshold, h.breaker.window), false
+	}
+
+	if h.rateLimiter != nil && !h.rateLimiter.TryAccept() {
+		if trial {
+			h.breaker.release()
+		}
+		return ReasonRateLimited, fmt.Sprintf("more than %g admission reviews per second", h.MaxReviewsPerSecond), false
+	}
+
+	return "", "", trial
+}
+
+// recordOutcome passes the outcome of an evaluated review to the circuit
+// breaker, only errors that are not caused by the object itself (e.g. a bug,
+// a config error or an unreachable api) count as failures
+func (h *RequestsHandler) recordOutcome(now time.Time, err error, trial bool) {
+	if h.breaker == nil {
+		return
+	}
+
+	reason := reasonOf(err)
+	h.breaker.record(now, err != nil && (reason == ReasonInternal || reason == ReasonLookupFailed), trial)
+}
+
+// circuitBreaker opens after threshold failures within the window, and stays
+// open for the cooldown. After the cooldown it is half-open: a single trial
+// review is evaluated at a time while the others are still allowed without
+// evaluation, so a recovering api server does not get the full load at once.
+// A failed trial opens it again and a successful one closes it.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	failures  []time.Time
+	openUntil time.Time
+	trial     bool
+	// changed is called when the breaker opens or closes
+	changed func()
+}
+
+// allow returns false while the breaker is open, and while the trial review
+// of the half-open breaker is evaluated. trial is true for the review that is
+// allowed as the trial.
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true, false
+	}
+
+	if now.Before(b.openUntil) || b.trial {
+		return false, false
+	}
+
+	b.trial = true
+	return true, true
+}
+
+// release ends a trial review that was not evaluated, so another review can
+// be the trial
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *circuitBreaker) record(now time.Time, failed bool, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.openUntil.IsZero() {
+		if !trial {
+			// a review that started before the breaker opened
+			return
+		}
+
+		b.trial = false
+		if failed {
+			b.open(now)
+		} else {
+			b.openUntil = time.Time{}
+			atomic.StoreInt32(&circuitBreakerOpen, 0)
+			infoLogger.Printf("circuit breaker closed, admission reviews are evaluated again")
+			b.notify()
+		}
+
+		return
+	}
+
+	if !failed {
+		return
+	}
+
+	failures := b.failures[:0]
+	for _, t := range b.failures {
+		if now.Sub(t) < b.window {
+			failures = append(failures, t)
+		}
+	}
+
+	b.failures = append(failures, now)
+	if len(b.failures) >= b.threshold {
+		b.open(now)
+	}
+}
+
+func (b *circuitBreaker) open(now time.Time) {
+	b.failures = nil
+	b.openUntil = now.Add(b.cooldown)
+	atomic.StoreInt32(&circuitBreakerOpen, 1)
+	atomic.AddUint64(&circuitBreakerTrips, 1)
+	warningLogger.Printf("circuit breaker opened after %d errors within %s, admission reviews are allowed without injection for %s", b.threshold, b.window, b.cooldown)
+	b.notify()
+}
+
+func (b *circuitBreaker) notify() {
+	if b.changed != nil {
+		b.changed()
+	}
+}
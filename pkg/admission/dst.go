@@ -0,0 +1,204 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// EventDSTTransition is the reason of the events that are emitted on the
+// injected pods before the UTC offset of their timezone changes
+const EventDSTTransition = "TimezoneTransitionUpcoming"
+
+// dstHorizon is how far ahead the transitions are looked up, timezones
+// without a transition in this period are not reported
+const dstHorizon = 366 * 24 * time.Hour
+
+// nextDSTTransitions holds the map[string]time.Time of the next transition of
+// every timezone of the injected pods, found by the last check
+var nextDSTTransitions atomic.Value
+
+// watchDSTTransitions looks up the next transitions of the timezones of the
+// injected pods every DSTCheckInterval until stop is closed
+func (h *RequestsHandler) watchDSTTransitions(stop <-chan struct{}) {
+	ticker := time.NewTicker(h.DSTCheckInterval)
+	defer ticker.Stop()
+
+	notified := map[types.UID]time.Time{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), h.DSTCheckInterval)
+		h.checkDSTTransitions(ctx, time.Now(), notified)
+		cancel()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkDSTTransitions finds the next transition of every timezone of the
+// injected pods, and emits an event on the pods whose timezone changes within
+// the DSTNoticePeriod. Every pod is notified once per transition, notified
+// holds the transitions the pods were already notified of.
+func (h *RequestsHandler) checkDSTTransitions(ctx context.Context, now time.Time, notified map[types.UID]time.Time) {
+	pods, err := h.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		warningLogger.Printf("failed to list pods for timezone transitions check: %v", err)
+		return
+	}
+
+	transitions := map[string]*inject.Transition{}
+	transition := func(timezone string) *inject.Transition {
+		if t, ok := transitions[timezone]; ok {
+			return t
+		}
+
+		t, err := inject.NextTransition(h.ZoneInfoPath, timezone, now, dstHorizon)
+		if err != nil {
+			warningLogger.Printf("failed to find the next transition of %s: %v", timezone, err)
+		}
+
+		transitions[timezone] = t
+		return t
+	}
+
+	seen := map[types.UID]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation]); !injected || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		var next *inject.Transition
+		for _, timezone := range podTimezones(pod) {
+			if t := transition(timezone); t != nil && (next == nil || t.At.Before(next.At)) {
+				next = t
+			}
+		}
+
+		seen[pod.UID] = true
+		if h.DSTNoticePeriod <= 0 || next == nil || next.At.Sub(now) > h.DSTNoticePeriod || notified[pod.UID].Equal(next.At) {
+			continue
+		}
+
+		if err := h.notifyTransition(ctx, pod, next, now); err != nil {
+			warningLogger.Printf("failed to create event %s for pod (%s): %v", EventDSTTransition, formatObjectDetails(pod.ObjectMeta), err)
+			continue
+		}
+
+		notified[pod.UID] = next.At
+	}
+
+	for uid := range notified {
+		if !seen[uid] {
+			delete(notified, uid)
+		}
+	}
+
+	next := map[string]time.Time{}
+	for timezone, t := range transitions {
+		if t != nil {
+			next[timezone] = t.At
+		}
+	}
+
+	nextDSTTransitions.Store(next)
+}
+
+// podTimezones returns the timezones injected into the pod, the timezone of
+// the pod and the timezones of single containers
+func podTimezones(pod *corev1.Pod) []string {
+	var timezones []string
+	if timezone := pod.Annotations[k8tz.TimezoneAnnotation]; timezone != "" {
+		timezones = append(timezones, timezone)
+	}
+
+	if v, ok := pod.Annotations[k8tz.ContainerTimezonesAnnotation]; ok {
+		containers, err := inject.ParseContainerTimezones(v)
+		if err != nil {
+			return timezones
+		}
+
+		for _, timezone := range containers {
+			timezones = append(timezones, timezone)
+		}
+	}
+
+	return timezones
+}
+
+// notifyTransition creates an event on the pod about the upcoming transition
+// of its timezone
+func (h *RequestsHandler) notifyTransition(ctx context.Context, pod *corev1.Pod, transition *inject.Transition, now time.Time) error {
+	infoLogger.Printf("pod (%s): %s", formatObjectDetails(pod.ObjectMeta), transition)
+
+	timestamp := metav1.NewTime(now)
+	_, err := h.clientset.CoreV1().Events(pod.Namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        pod.UID,
+		},
+		Reason:         EventDSTTransition,
+		Message:        fmt.Sprintf("timezone %s in %s", transition, transition.At.Sub(now).Round(time.Minute)),
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+	}, metav1.CreateOptions{})
+
+	return err
+}
+
+// writeDSTTransitions writes the seconds until the next transition of every
+// timezone found by the last check
+func writeDSTTransitions(w io.Writer) {
+	fmt.Fprintln(w, "# HELP k8tz_next_dst_transition_seconds Seconds until the next UTC offset change (e.g. daylight saving time) of the timezones of the injected pods.")
+	fmt.Fprintln(w, "# TYPE k8tz_next_dst_transition_seconds gauge")
+
+	next, _ := nextDSTTransitions.Load().(map[string]time.Time)
+	zones := make([]string, 0, len(next))
+	for zone := range next {
+		zones = append(zones, zone)
+	}
+
+	sort.Strings(zones)
+	for _, zone := range zones {
+		fmt.Fprintf(w, "k8tz_next_dst_transition_seconds{zone=%q} %v\n", zone, time.Until(next[zone]).Seconds())
+	}
+}
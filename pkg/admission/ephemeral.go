@@ -0,0 +1,129 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"strconv"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	admission "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ephemeralContainersSubResource is the pod subresource that ephemeral
+// containers are added with, e.g. by 'kubectl debug'
+const ephemeralContainersSubResource = "ephemeralcontainers"
+
+// isEphemeralContainersUpdate returns true if the request adds ephemeral
+// containers to a running pod
+func isEphemeralContainersUpdate(req *admission.AdmissionRequest) bool {
+	return req.Resource == podResource && req.SubResource == ephemeralContainersSubResource && req.Operation == admission.Update
+}
+
+// handleEphemeralContainersAdmissionRequest injects the ephemeral containers
+// that are added to an injected pod with the timezone of the pod, so debug
+// containers do not run in UTC
+func (h *RequestsHandler) handleEphemeralContainersAdmissionRequest(req *admission.AdmissionRequest) (k8tz.Patches, error) {
+	pod := corev1.Pod{}
+	if _, _, err := k8sdecode.Decode(req.Object.Raw, nil, &pod); err != nil {
+		return nil, withReason(ReasonInvalidObject, "could not deserialize pod object: %v", err)
+	}
+
+	oldPod := corev1.Pod{}
+	if len(req.OldObject.Raw) > 0 {
+		if _, _, err := k8sdecode.Decode(req.OldObject.Raw, nil, &oldPod); err != nil {
+			return nil, withReason(ReasonInvalidObject, "could not deserialize old pod object: %v", err)
+		}
+	}
+
+	if injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation]); !injected {
+		h.skip(ReasonDisabled, "skipping ephemeral containers of pod (%s) because the pod is not injected", formatObjectDetails(pod.ObjectMeta))
+		return nil, nil
+	}
+
+	existing := map[string]bool{}
+	for _, c := range oldPod.Spec.EphemeralContainers {
+		existing[c.Name] = true
+	}
+
+	var added []int
+	for i, c := range pod.Spec.EphemeralContainers {
+		if !existing[c.Name] {
+			added = append(added, i)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	generator, err := h.lookupEphemeralContainers(req.Namespace, &pod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup generator for ephemeral containers, error=%w", err)
+	}
+
+	h.verbosef("Generating patches for ephemeral containers of pod (%s) using generator: %+v", formatObjectDetails(pod.ObjectMeta), *generator)
+	h.recordInjection(generator)
+	done := h.startGeneration()
+	patches, err := generator.ForEphemeralContainers(&pod, added, "")
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate patches for ephemeral containers, error=%w", err)
+	}
+
+	countInjection("EphemeralContainer", req.Namespace)
+	infoLogger.Printf("%d patches generated for %d ephemeral containers of pod (%s), timezone=%s", len(patches), len(added), formatObjectDetails(pod.ObjectMeta), generator.Timezone)
+	return patches, nil
+}
+
+// lookupEphemeralContainers returns the patch generator of the ephemeral
+// containers of an injected pod, the timezone is the one recorded by the
+// post injection annotation of the pod
+func (h *RequestsHandler) lookupEphemeralContainers(namespace string, pod *corev1.Pod) (*inject.PatchGenerator, error) {
+	namespaceObj, err := h.getNamespace(namespace)
+	if err != nil {
+		return nil, withReason(ReasonLookupFailed, "failed to lookup pod's namespace (%s): %v", formatObjectDetails(pod.ObjectMeta), err)
+	}
+
+	timezone := pod.Annotations[k8tz.TimezoneAnnotation]
+	if timezone == "" {
+		timezone = h.DefaultTimezone
+	}
+
+	containerTimezones, err := h.containerTimezones(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	format := h.TimezoneFormat
+	if v, e := pod.Annotations[k8tz.TimezoneFormatAnnotation]; e {
+		format = inject.TimezoneFormat(v)
+	} else if v, e := namespaceObj.Annotations[k8tz.TimezoneFormatAnnotation]; e {
+		format = inject.TimezoneFormat(v)
+	}
+
+	return &inject.PatchGenerator{
+		Timezone:           timezone,
+		LocalTimePath:      h.LocalTimePath,
+		TimezoneFormat:     format,
+		ZoneInfoPath:       h.ZoneInfoPath,
+		ExtraEnv:           h.ExtraEnv,
+		ContainerTimezones: containerTimezones,
+	}, nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	admission "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// reasons of the events that are emitted on the objects of the admission
+// reviews when EmitEvents is enabled
+const (
+	EventTimezoneInjected          = "TimezoneInjected"
+	EventTimezoneInjectionSkipped  = "TimezoneInjectionSkipped"
+	EventInvalidTimezoneAnnotation = "InvalidTimezoneAnnotation"
+	EventTimezoneInjectionFailed   = "TimezoneInjectionFailed"
+)
+
+// eventComponent is the source component of the emitted events
+const eventComponent = "k8tz"
+
+// eventTimeout bounds the creation of a single event, events are best effort
+// and are created in the background of the admission review
+const eventTimeout = 5 * time.Second
+
+// reviewState is the state that is collected while a single admission review
+// is handled
+type reviewState struct {
+	warnings        []string
+	skipReason      Reason
+	skipMessage     string
+	invalidTimezone string
+	timezone        string
+	strategy        inject.InjectionStrategy
+	debug           bool
+	// ctx carries the span of the review, the stages of the review are
+	// traced as its children
+	ctx context.Context
+}
+
+// reviewEvent returns the event that describes the decision of an admission
+// review, nil is returned when there is nothing worth an event
+func reviewEvent(req *admission.AdmissionRequest, state *reviewState, patches int, err error) *corev1.Event {
+	var eventType, reason, message string
+	switch {
+	case err != nil && isTimezoneReason(reasonOf(err)):
+		eventType, reason, message = corev1.EventTypeWarning, EventInvalidTimezoneAnnotation, err.Error()
+	case err != nil:
+		eventType, reason, message = corev1.EventTypeWarning, EventTimezoneInjectionFailed, err.Error()
+	case state.invalidTimezone != "":
+		eventType, reason, message = corev1.EventTypeWarning, EventInvalidTimezoneAnnotation, state.invalidTimezone
+	case patches > 0:
+		eventType, reason, message = corev1.EventTypeNormal, EventTimezoneInjected, fmt.Sprintf("timezone injected with %d patches", patches)
+	case state.skipReason != "" && state.skipReason != ReasonAlreadyInjected:
+		eventType, reason, message = corev1.EventTypeNormal, EventTimezoneInjectionSkipped, fmt.Sprintf("%s (reason=%s)", state.skipMessage, state.skipReason)
+	default:
+		return nil
+	}
+
+	object := metav1.PartialObjectMetadata{}
+	if len(req.Object.Raw) > 0 {
+		// only the metadata is needed, a failure leaves the name empty
+		_, _, _ = k8sdecode.Decode(req.Object.Raw, nil, &object)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = object.Name
+	}
+
+	if name == "" {
+		// objects with a generated name are not named yet during admission
+		return nil
+	}
+
+	now := metav1.Now()
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + ".",
+			Namespace:    req.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: metav1.GroupVersion{Group: req.Kind.Group, Version: req.Kind.Version}.String(),
+			Kind:       req.Kind.Kind,
+			Namespace:  req.Namespace,
+			Name:       name,
+			UID:        object.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
+
+// isTimezoneReason returns true if the reason is caused by the requested
+// timezone of the object
+func isTimezoneReason(reason Reason) bool {
+	return reason == ReasonTimezoneDenied || reason == ReasonInvalidTimezone || reason == ReasonNoTimezone
+}
+
+// emitEvent creates the event in the background, so the admission review is
+// never delayed or failed by the events api
+func (h *RequestsHandler) emitEvent(event *corev1.Event) {
+	if event == nil || h.clientset == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+		defer cancel()
+
+		if _, err := h.clientset.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+			warningLogger.Printf("failed to create event %s for %s (%s/%s): %v", event.Reason, event.InvolvedObject.Kind, event.Namespace, event.InvolvedObject.Name, err)
+		}
+	}()
+}
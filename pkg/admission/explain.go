@@ -0,0 +1,134 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// DecisionAPIVersion is the version of the Decision contract, fields are
+	// only added to it, they are never renamed or removed within a version
+	DecisionAPIVersion = "k8tz.io/v1"
+	// DecisionKind is the kind of the Decision contract
+	DecisionKind = "Decision"
+)
+
+// Decision is what the webhook would do with a pod. It is served on /explain
+// as a stable JSON contract for policy engines (e.g. CEL expressions of a
+// ValidatingAdmissionPolicy) and tooling. All the fields are always present,
+// the fields that do not apply are empty.
+type Decision struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	// Allowed is true if the pod would be admitted
+	Allowed bool `json:"allowed"`
+	// Inject is true if the timezone would be injected to the pod
+	Inject bool `json:"inject"`
+	// Timezone, Strategy and TimezoneFormat are set when Inject is true
+	Timezone       string                   `json:"timezone"`
+	Strategy       inject.InjectionStrategy `json:"strategy"`
+	TimezoneFormat inject.TimezoneFormat    `json:"timezoneFormat"`
+	// Reason is set when the pod is skipped or rejected, it is one of Reasons
+	Reason Reason `json:"reason"`
+	// Message is the human readable error of a rejection
+	Message string `json:"message"`
+}
+
+// Explain returns the decision of the handler for the pod without modifying
+// it, the same way the pod would be handled on admission
+func (h *RequestsHandler) Explain(namespace string, pod *corev1.Pod) Decision {
+	decision := Decision{
+		APIVersion: DecisionAPIVersion,
+		Kind:       DecisionKind,
+		Namespace:  namespace,
+		Name:       pod.Name,
+		Allowed:    true,
+	}
+
+	if h.isExcludedNamespace(namespace) {
+		decision.Reason = ReasonExcludedNamespace
+		return decision
+	}
+
+	generator, reason, err := h.resolvePod(namespace, pod)
+	if err == nil && generator != nil {
+		_, err = generator.Generate(pod.DeepCopy(), "")
+	}
+
+	switch {
+	case err != nil:
+		decision.Allowed = h.failOpenObject(podResource, pod.Annotations)
+		decision.Reason = reasonOf(err)
+		decision.Message = err.Error()
+	case generator == nil:
+		decision.Reason = reason
+	default:
+		decision.Inject = true
+		decision.Timezone = generator.Timezone
+		decision.Strategy = generator.Strategy
+		decision.TimezoneFormat = generator.TimezoneFormat
+	}
+
+	return decision
+}
+
+// explain handles POST requests with a pod in the body and responds with the
+// Decision for it. The namespace is taken from the "namespace" query parameter
+// or from the pod.
+func (h *Server) explain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("could not read request body, error=%s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	pod := corev1.Pod{}
+	if err := json.Unmarshal(body, &pod); err != nil {
+		http.Error(w, fmt.Sprintf("could not deserialize pod object: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+
+	if namespace == "" {
+		http.Error(w, "namespace is required, either in the pod or as a query parameter", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	handler := h.Handler.configured()
+	if err := json.NewEncoder(w).Encode(handler.Explain(namespace, &pod)); err != nil {
+		errorLogger.Printf("failed to write decision: %v", err)
+	}
+}
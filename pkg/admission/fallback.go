@@ -0,0 +1,61 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+)
+
+// MissingTimezoneAction is what k8tz does with an object when no default
+// timezone is configured and the object has no timezone annotation
+type MissingTimezoneAction string
+
+const (
+	// MissingTimezoneFallback injects the FallbackTimezone
+	MissingTimezoneFallback MissingTimezoneAction = "fallback"
+	// MissingTimezoneSkip admits the object without injection
+	MissingTimezoneSkip MissingTimezoneAction = "skip"
+	// MissingTimezoneDeny rejects the object until a timezone is requested
+	// explicitly with an annotation
+	MissingTimezoneDeny MissingTimezoneAction = "deny"
+)
+
+// missingTimezone resolves the timezone of an object that has none according
+// to the MissingTimezoneAction, an empty timezone means that the object should
+// be skipped
+func (h *RequestsHandler) missingTimezone(kind string, details string) (string, error) {
+	switch h.MissingTimezoneAction {
+	case "", MissingTimezoneFallback:
+		fallback := h.FallbackTimezone
+		if fallback == "" {
+			fallback = k8tz.UTCTimezone
+		}
+
+		h.warn("no timezone configured for %s (%s), using fallback timezone: %s", kind, details, fallback)
+		return fallback, nil
+	case MissingTimezoneSkip:
+		h.skip(ReasonNoTimezone, "skipping %s (%s) because no timezone is configured", kind, details)
+		h.warn("%s (%s) is not injected because no timezone is configured, set the %s annotation", kind, details, k8tz.TimezoneAnnotation)
+		return "", nil
+	case MissingTimezoneDeny:
+		return "", withReason(ReasonNoTimezone, "no timezone is configured for %s (%s), set the %s annotation", kind, details, k8tz.TimezoneAnnotation)
+	default:
+		return "", fmt.Errorf("unknown missing timezone action specified: %s", h.MissingTimezoneAction)
+	}
+}
@@ -0,0 +1,456 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ServeMode selects the protocols served on the webhook listeners
+type ServeMode string
+
+const (
+	// ServeModeWebhook serves the HTTPS admission webhook routes
+	ServeModeWebhook ServeMode = "webhook"
+	// ServeModeGRPC serves the gRPC processor instead of the webhook routes,
+	// for gateways that aggregate the mutations of several admission
+	// controllers behind a single webhook
+	ServeModeGRPC ServeMode = "grpc"
+	// ServeModeBoth serves both the webhook routes and the gRPC processor
+	ServeModeBoth ServeMode = "both"
+)
+
+const (
+	// GRPCReviewMethod is the unary method of the processor, a ReviewRequest
+	// is answered with a ReviewResponse
+	GRPCReviewMethod = "/k8tz.admission.v1.Processor/Review"
+	// GRPCProcessMethod is the bidirectional streaming method of the
+	// processor, every ReviewRequest of the stream is answered with a
+	// ReviewResponse in the same order
+	GRPCProcessMethod = "/k8tz.admission.v1.Processor/Process"
+
+	grpcContentType = "application/grpc"
+
+	// grpcGzipEncoding is the only message compression supported besides
+	// identity, it is advertised in the grpc-accept-encoding header
+	grpcGzipEncoding = "gzip"
+
+	// admissionReviewField is the field number of the admission_review bytes
+	// of both ReviewRequest and ReviewResponse (see processor.proto)
+	admissionReviewField protowire.Number = 1
+)
+
+// gRPC status codes, https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+)
+
+// grpcError is a failure of a gRPC call with its status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// Validate returns an error if the serve mode is unknown
+func (m ServeMode) Validate() error {
+	switch m {
+	case ServeModeWebhook, ServeModeGRPC, ServeModeBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown serve mode %q, expected %s, %s or %s", m, ServeModeWebhook, ServeModeGRPC, ServeModeBoth)
+	}
+}
+
+// ServesWebhook returns true if the webhook routes are served
+func (m ServeMode) ServesWebhook() bool {
+	return m != ServeModeGRPC
+}
+
+// ServesGRPC returns true if the gRPC processor is served
+func (m ServeMode) ServesGRPC() bool {
+	return m == ServeModeGRPC || m == ServeModeBoth
+}
+
+// registerGRPC adds the methods of the gRPC processor to the mux. The
+// processor takes the same AdmissionReview (JSON) as the webhook and answers
+// with the same response review, so a gateway can embed k8tz with the patch
+// generation of the webhook.
+func (h *RequestsHandler) registerGRPC(mux *http.ServeMux) {
+	mux.HandleFunc(GRPCReviewMethod, countRoute(GRPCReviewMethod, h.grpcFunc(true)))
+	mux.HandleFunc(GRPCProcessMethod, countRoute(GRPCProcessMethod, h.grpcFunc(false)))
+}
+
+// grpcFunc serves a method of the processor, the unary method answers the
+// first request message only. The gRPC status is sent in the trailers.
+//
+// The read and write timeouts of the server are meant for the webhook
+// requests, the streaming method lasts as long as the client keeps it open
+// or until the grpc-timeout of the call, so it is exempt from them.
+func (h *RequestsHandler) grpcFunc(unary bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+			http.Error(w, "gRPC requires HTTP/2 POST requests", http.StatusBadRequest)
+			return
+		}
+
+		if contentType := r.Header.Get("Content-Type"); contentType != grpcContentType && contentType != grpcContentType+"+proto" {
+			http.Error(w, fmt.Sprintf("unsupported content type %s, only %s is supported", contentType, grpcContentType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		w.Header().Set("Content-Type", grpcContentType)
+		w.Header().Set("Grpc-Accept-Encoding", grpcGzipEncoding)
+
+		r, cancel, err := h.startGRPCCall(w, r, unary)
+		defer cancel()
+
+		w.WriteHeader(http.StatusOK)
+		if err == nil {
+			err = h.processGRPCStream(w, r, unary)
+		}
+		code, message := grpcOK, ""
+		if err != nil {
+			code, message = grpcInternal, err.Error()
+			var e *grpcError
+			if errors.As(err, &e) {
+				code = e.code
+			}
+
+			warningLogger.Printf("gRPC call %s failed with status %d: %s", r.URL.Path, code, message)
+		}
+
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+		if message != "" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(message))
+		}
+	}
+}
+
+// startGRPCCall checks the encoding of the call and returns the request with
+// the grpc-timeout of the call applied to its context. For the streaming
+// method the read deadline is cleared or set to the grpc-timeout, and the
+// write deadline is cleared.
+func (h *RequestsHandler) startGRPCCall(w http.ResponseWriter, r *http.Request, unary bool) (*http.Request, context.CancelFunc, error) {
+	cancel := func() {}
+	switch encoding := r.Header.Get("Grpc-Encoding"); encoding {
+	case "", "identity", grpcGzipEncoding:
+	default:
+		return r, cancel, grpcErrorf(grpcUnimplemented, "unsupported message encoding %s, only %s is supported", encoding, grpcGzipEncoding)
+	}
+
+	var deadline time.Time
+	if value := r.Header.Get("Grpc-Timeout"); value != "" {
+		timeout, err := parseGRPCTimeout(value)
+		if err != nil {
+			return r, cancel, grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+
+		var ctx context.Context
+		deadline = time.Now().Add(timeout)
+		ctx, cancel = context.WithDeadline(r.Context(), deadline)
+		r = r.WithContext(ctx)
+	}
+
+	if unary {
+		return r, cancel, nil
+	}
+
+	controller := http.NewResponseController(w)
+	if err := controller.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return r, cancel, grpcErrorf(grpcInternal, "failed to set the read deadline of the stream: %v", err)
+	}
+
+	// the status of a call past its deadline is still written in the trailers
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return r, cancel, grpcErrorf(grpcInternal, "failed to set the write deadline of the stream: %v", err)
+	}
+
+	return r, cancel, nil
+}
+
+// processGRPCStream answers the request messages of the call until the client
+// closes the stream, or after the first message of a unary call
+func (h *RequestsHandler) processGRPCStream(w http.ResponseWriter, r *http.Request, unary bool) error {
+	controller := http.NewResponseController(w)
+	encoding := r.Header.Get("Grpc-Encoding")
+	for n := 0; ; n++ {
+		message, err := h.readGRPCMessage(r.Body, encoding)
+		if err == io.EOF {
+			if unary && n == 0 {
+				return grpcErrorf(grpcInvalidArgument, "missing ReviewRequest message")
+			}
+
+			return nil
+		} else if err != nil {
+			return grpcContextError(r.Context(), err)
+		}
+
+		response, err := h.processGRPC(r, message)
+		if err != nil {
+			return grpcContextError(r.Context(), err)
+		}
+
+		if err := writeGRPCMessage(w, response); err != nil {
+			return grpcContextError(r.Context(), grpcErrorf(grpcUnavailable, "failed to write ReviewResponse: %v", err))
+		}
+
+		if err := controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return grpcContextError(r.Context(), grpcErrorf(grpcUnavailable, "failed to flush ReviewResponse: %v", err))
+		}
+
+		if unary {
+			return nil
+		}
+	}
+}
+
+// grpcContextError returns the deadline exceeded status when the grpc-timeout
+// of the call caused the error
+func grpcContextError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return grpcErrorf(grpcDeadlineExceeded, "deadline of the call exceeded: %v", err)
+	}
+
+	return err
+}
+
+// parseGRPCTimeout parses the value of the grpc-timeout header, at most 8
+// digits followed by the unit (H, M, S, m, u or n)
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc-timeout %q, unknown unit", value)
+	}
+
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", value)
+	}
+
+	return time.Duration(n) * unit, nil
+}
+
+// readGRPCMessage reads a length-prefixed message of the call, compressed
+// messages are decompressed with the encoding of the call. io.EOF is returned
+// when the stream ends before a message.
+func (h *RequestsHandler) readGRPCMessage(r io.Reader, encoding string) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "failed to read message prefix: %v", err)
+	}
+
+	compressed := prefix[0] == 1
+	if prefix[0] > 1 {
+		return nil, grpcErrorf(grpcInternal, "invalid compressed flag %d", prefix[0])
+	}
+
+	if compressed && encoding != grpcGzipEncoding {
+		return nil, grpcErrorf(grpcInternal, "compressed message without grpc-encoding")
+	}
+
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if h.MaxRequestBytes > 0 && int64(length) > h.MaxRequestBytes {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes exceeds the limit of %d bytes", length, h.MaxRequestBytes)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "failed to read message of %d bytes: %v", length, err)
+	}
+
+	if !compressed {
+		return message, nil
+	}
+
+	return h.decompressGRPCMessage(message)
+}
+
+// decompressGRPCMessage returns the gzip compressed message, the limit of the
+// request size applies to the decompressed message
+func (h *RequestsHandler) decompressGRPCMessage(message []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(message))
+	if err != nil {
+		return nil, grpcErrorf(grpcInternal, "failed to decompress message: %v", err)
+	}
+	defer gz.Close()
+
+	var reader io.Reader = gz
+	if h.MaxRequestBytes > 0 {
+		reader = io.LimitReader(gz, h.MaxRequestBytes+1)
+	}
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, grpcErrorf(grpcInternal, "failed to decompress message: %v", err)
+	}
+
+	if h.MaxRequestBytes > 0 && int64(len(decompressed)) > h.MaxRequestBytes {
+		return nil, grpcErrorf(grpcResourceExhausted, "decompressed message exceeds the limit of %d bytes", h.MaxRequestBytes)
+	}
+
+	return decompressed, nil
+}
+
+// writeGRPCMessage writes a length-prefixed, uncompressed message
+func writeGRPCMessage(w io.Writer, message []byte) error {
+	prefix := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	_, err := w.Write(append(prefix, message...))
+	return err
+}
+
+// processGRPC handles a ReviewRequest the same way the webhook handles an
+// admission review and returns the ReviewResponse
+func (h *RequestsHandler) processGRPC(r *http.Request, message []byte) ([]byte, error) {
+	ctx, span := startReviewSpan(r)
+	defer span.End()
+
+	_, decodeSpan := tracer().Start(ctx, "decode")
+	raw, err := unmarshalAdmissionReviewMessage(message)
+	if err != nil {
+		endSpan(decodeSpan, err)
+		return nil, grpcErrorf(grpcInvalidArgument, "invalid ReviewRequest: %v", err)
+	}
+
+	review, err := decodeAdmissionReview(raw)
+	endSpan(decodeSpan, err)
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+
+	release, ok := h.acquireReviewSlot(r)
+	if !ok {
+		return nil, grpcErrorf(grpcUnavailable, "too many concurrent admission reviews")
+	}
+	defer release()
+
+	setReviewAttributes(span, review.Request)
+	reviewResponse, err := h.reviewContext(ctx, review)
+	if err != nil {
+		endSpan(span, err)
+		return nil, grpcErrorf(grpcInternal, "%v", err)
+	}
+
+	_, serializeSpan := tracer().Start(ctx, "serialize")
+	bytes, err := json.Marshal(reviewResponse)
+	endSpan(serializeSpan, err)
+	if err != nil {
+		return nil, grpcErrorf(grpcInternal, "failed to marshal response review: %v", err)
+	}
+
+	return marshalAdmissionReviewMessage(bytes), nil
+}
+
+// unmarshalAdmissionReviewMessage returns the admission_review field of a
+// ReviewRequest, unknown fields are ignored
+func unmarshalAdmissionReviewMessage(message []byte) ([]byte, error) {
+	var review []byte
+	for len(message) > 0 {
+		number, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+
+		if number == admissionReviewField && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(message)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			review, message = v, message[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(number, typ, message)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		message = message[n:]
+	}
+
+	if len(review) == 0 {
+		return nil, errors.New("missing admission_review")
+	}
+
+	return review, nil
+}
+
+// marshalAdmissionReviewMessage returns a ReviewResponse with the response
+// review
+func marshalAdmissionReviewMessage(review []byte) []byte {
+	message := protowire.AppendTag(nil, admissionReviewField, protowire.BytesType)
+	return protowire.AppendBytes(message, review)
+}
+
+// grpcEncodeMessage percent-encodes the status message as required for the
+// grpc-message trailer
+func grpcEncodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,272 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+const (
+	// handoverListenersEnv lists the listeners that a process inherits from
+	// the process it takes over from, in the order of their file descriptors
+	handoverListenersEnv = "K8TZ_HANDOVER_LISTENERS"
+	// handoverParentEnv is the pid of the process that is stopped once the
+	// new process serves the inherited listeners
+	handoverParentEnv = "K8TZ_HANDOVER_PID"
+
+	// firstInheritedFD is the descriptor of the first file of
+	// exec.Cmd.ExtraFiles in the new process, after stdin, stdout and stderr
+	firstInheritedFD = 3
+)
+
+// trackedListener is a listener that is passed to the new process on
+// handover, identified by its network and the address it was opened with
+// (e.g. tcp::8443), which may differ from its resolved address
+type trackedListener struct {
+	net.Listener
+	key string
+}
+
+// filer is implemented by the tcp and unix listeners of the net package
+type filer interface {
+	File() (*os.File, error)
+}
+
+func listenerKey(network, address string) string {
+	return network + ":" + address
+}
+
+// inheritListeners takes the listeners passed by the process this process
+// takes over from, they are used instead of opening new ones for the same
+// addresses. The variables are removed so they are not passed on again.
+func (h *Server) inheritListeners() error {
+	value, ok := os.LookupEnv(handoverListenersEnv)
+	if !ok {
+		return nil
+	}
+	os.Unsetenv(handoverListenersEnv)
+
+	h.inherited = map[string]net.Listener{}
+	for i, key := range strings.Split(value, ",") {
+		if key == "" {
+			continue
+		}
+
+		f := os.NewFile(uintptr(firstInheritedFD+i), key)
+		if f == nil {
+			return fmt.Errorf("inherited listener %s has no file descriptor %d", key, firstInheritedFD+i)
+		}
+
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to use inherited listener %s: %w", key, err)
+		}
+
+		if u, ok := l.(*net.UnixListener); ok {
+			u.SetUnlinkOnClose(true)
+		}
+
+		infoLogger.Printf("inherited listener %s from the previous process", key)
+		h.inherited[key] = l
+	}
+
+	return nil
+}
+
+// takeInherited returns the inherited listener of the address, if any
+func (h *Server) takeInherited(network, address string) (net.Listener, bool) {
+	key := listenerKey(network, address)
+	l, ok := h.inherited[key]
+	if ok {
+		delete(h.inherited, key)
+	}
+
+	return l, ok
+}
+
+// closeInherited closes the inherited listeners of addresses that this
+// process no longer listens on
+func (h *Server) closeInherited() {
+	for key, l := range h.inherited {
+		infoLogger.Printf("closing inherited listener %s, it is not configured anymore", key)
+		l.Close()
+	}
+
+	h.inherited = nil
+}
+
+// track keeps the listener to pass it to the new process on handover
+func (h *Server) track(network, address string, l net.Listener) net.Listener {
+	tracked := &trackedListener{Listener: l, key: listenerKey(network, address)}
+	h.listeners = append(h.listeners, tracked)
+	return tracked
+}
+
+// notifyHandoverParent stops the process that passed its listeners once this
+// process serves them, the previous process drains its in-flight requests and
+// exits
+func (h *Server) notifyHandoverParent() {
+	value, ok := os.LookupEnv(handoverParentEnv)
+	if !ok {
+		return
+	}
+	os.Unsetenv(handoverParentEnv)
+
+	pid, err := strconv.Atoi(value)
+	if err != nil || pid != os.Getppid() {
+		warningLogger.Printf("ignoring %s=%s, it is not the parent process", handoverParentEnv, value)
+		return
+	}
+
+	parent, err := os.FindProcess(pid)
+	if err == nil {
+		err = parent.Signal(syscall.SIGTERM)
+	}
+
+	if err != nil {
+		warningLogger.Printf("failed to stop the previous process %d after the handover: %v", pid, err)
+		return
+	}
+
+	infoLogger.Printf("took over the listeners of process %d", pid)
+}
+
+// watchHandover starts a new process of the executable (e.g. an upgraded
+// binary at the same path) with the same arguments on the handover signal,
+// and passes it the listening sockets. The sockets are shared, so requests
+// are accepted by either process until the new one stops this one; nothing is
+// dropped. This process keeps serving if the new one fails to start.
+func (h *Server) watchHandover(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, handoverSignals...)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := h.handover(); err != nil {
+				errorLogger.Printf("handover failed, serving on: %v", err)
+			}
+		}
+	}
+}
+
+// handover starts the new process with the listeners
+func (h *Server) handover() error {
+	if !atomic.CompareAndSwapInt32(&h.handingOver, 0, 1) {
+		return errors.New("a handover is already in progress")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		atomic.StoreInt32(&h.handingOver, 0)
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+
+	files, keys, err := h.listenerFiles()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if err != nil {
+		atomic.StoreInt32(&h.handingOver, 0)
+		return err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(handoverEnviron(),
+		handoverListenersEnv+"="+strings.Join(keys, ","),
+		handoverParentEnv+"="+strconv.Itoa(os.Getpid()))
+
+	if err := cmd.Start(); err != nil {
+		atomic.StoreInt32(&h.handingOver, 0)
+		return fmt.Errorf("failed to start %s: %w", executable, err)
+	}
+
+	infoLogger.Printf("handing over %d listeners to process %d (%s)", len(files), cmd.Process.Pid, executable)
+	go func() {
+		// the new process stops this one once it serves, it exiting first
+		// means that it failed to start
+		err := cmd.Wait()
+		atomic.StoreInt32(&h.handingOver, 0)
+		errorLogger.Printf("process %d exited before taking over (%v), serving on", cmd.Process.Pid, err)
+	}()
+
+	return nil
+}
+
+// listenerFiles returns duplicates of the file descriptors of the listeners
+// and their keys. Unix sockets are not removed anymore when this process
+// closes them, since the new process keeps listening on them.
+func (h *Server) listenerFiles() ([]*os.File, []string, error) {
+	var files []*os.File
+	var keys []string
+	for _, l := range h.listeners {
+		if u, ok := l.Listener.(*net.UnixListener); ok {
+			u.SetUnlinkOnClose(false)
+		}
+
+		f, ok := l.Listener.(filer)
+		if !ok {
+			return files, nil, fmt.Errorf("listener %s cannot be passed to another process", l.key)
+		}
+
+		file, err := f.File()
+		if err != nil {
+			return files, nil, fmt.Errorf("failed to get the file of listener %s: %w", l.key, err)
+		}
+
+		files = append(files, file)
+		keys = append(keys, l.key)
+	}
+
+	return files, keys, nil
+}
+
+// handoverEnviron returns the environment of this process without the
+// variables of a previous handover
+func handoverEnviron() []string {
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, handoverListenersEnv+"=") && !strings.HasPrefix(e, handoverParentEnv+"=") {
+			env = append(env, e)
+		}
+	}
+
+	return env
+}
+
+// isHandingOver returns true while a new process is taking over
+func (h *Server) isHandingOver() bool {
+	return atomic.LoadInt32(&h.handingOver) == 1
+}
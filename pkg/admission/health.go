@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// readyTimeout bounds the kubernetes api request of the readiness check
+const readyTimeout = 5 * time.Second
+
+var (
+	// apiRetryDelay is the first delay of the kubernetes api retries on
+	// startup, it is doubled after every failure up to maxAPIRetryDelay
+	apiRetryDelay    = time.Second
+	maxAPIRetryDelay = 30 * time.Second
+)
+
+// healthServer returns the plaintext server of the /healthz and /readyz
+// probes and the /statusz document, so kubelet, load balancers and monitoring
+// can check the pod without TLS
+func (h *Server) healthServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/statusz", h.statusz)
+
+	return &http.Server{
+		Addr:    h.HealthAddress,
+		Handler: mux,
+	}
+}
+
+func (h *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	err := h.ready()
+	setReady(err == nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// setReady sets the k8tz_ready gauge, it is 0 while the circuit breaker is
+// open since the reviews are allowed without injection then
+func setReady(ready bool) {
+	var value int32
+	if ready && atomic.LoadInt32(&circuitBreakerOpen) == 0 {
+		value = 1
+	}
+
+	atomic.StoreInt32(&serverReady, value)
+}
+
+// updateReady sets the k8tz_ready gauge when the readiness of the server
+// changes between the readiness checks: the certificate is loaded, the
+// informer caches are synced, the circuit breaker opens or closes or the
+// server starts draining. The kubernetes api is only checked by /readyz.
+func (h *Server) updateReady() {
+	setReady(h.readiness() == nil)
+}
+
+// updateReadyOnCacheSync updates the k8tz_ready gauge once the informer
+// caches are synced, for caches that were not synced on startup
+func (h *Server) updateReadyOnCacheSync(stop <-chan struct{}) {
+	if cache.WaitForCacheSync(stop, h.Handler.cacheSynced...) {
+		h.updateReady()
+	}
+}
+
+// ready returns an error if the server cannot handle admission reviews: the
+// readiness of the server fails or the kubernetes api cannot list a single
+// namespace, the lookup that every review depends on
+func (h *Server) ready() error {
+	if err := h.readiness(); err != nil {
+		return err
+	}
+
+	if err := h.Handler.pingAPI(); err != nil {
+		return fmt.Errorf("kubernetes api is not reachable: %w", err)
+	}
+
+	return nil
+}
+
+// readiness returns an error if the server is shutting down, it has no valid
+// certificate, it is not connected to the kubernetes api or its informer
+// caches are not synced yet
+func (h *Server) readiness() error {
+	if h.isDraining() {
+		return errors.New("shutting down")
+	}
+
+	if h.certificate == nil || h.certificate.current() == nil {
+		return errors.New("TLS certificate is not loaded")
+	}
+
+	if leaf := h.certificate.current().Leaf; leaf != nil && time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("TLS certificate expired at %s", leaf.NotAfter)
+	}
+
+	if h.Handler.clientset == nil {
+		return errors.New("not connected to kubernetes api")
+	}
+
+	if !h.Handler.cachesSynced() {
+		return errors.New("informer caches are not synced")
+	}
+
+	return nil
+}
+
+// pingAPI lists a single namespace, the lookup that every review depends on
+func (h *RequestsHandler) pingAPI() error {
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	_, err := h.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
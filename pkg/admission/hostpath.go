@@ -0,0 +1,118 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hostPathPrefix returns the zoneinfo directory of the nodes that the
+// hostPath strategy mounts, the k8tz.io/hostpath annotation of the pod or its
+// namespace must be inside the allowed roots
+func (h *RequestsHandler) hostPathPrefix(pod *corev1.Pod, namespace *corev1.Namespace) (string, error) {
+	dir, ok := pod.Annotations[k8tz.HostPathAnnotation]
+	if !ok {
+		dir, ok = namespace.Annotations[k8tz.HostPathAnnotation]
+	}
+
+	if !ok {
+		return h.HostPathPrefix, nil
+	}
+
+	if err := inject.ValidateHostPath(dir, h.hostPathRoots()); err != nil {
+		return "", withReason(ReasonInvalidObject, "invalid %s annotation of pod (%s): %v", k8tz.HostPathAnnotation, formatObjectDetails(pod.ObjectMeta), err)
+	}
+
+	return dir, nil
+}
+
+// hostPathRoots returns the directories that can be mounted with the
+// k8tz.io/hostpath annotation, HostPathPrefix is always allowed
+func (h *RequestsHandler) hostPathRoots() []string {
+	return append([]string{h.HostPathPrefix}, h.HostPathRoots...)
+}
+
+// hostPathNodes returns true if the pod can only run on nodes with the
+// HostPathNodeLabel, either since it is bound to such nodes or since its
+// nodeSelector or every term of its required node affinity selects the label
+func (h *RequestsHandler) hostPathNodes(spec *corev1.PodSpec) (bool, error) {
+	key, value, _ := strings.Cut(h.HostPathNodeLabel, "=")
+	matches := func(v string, ok bool) bool {
+		return ok && (value == "" || v == value)
+	}
+
+	if nodes := nodeNames(spec); len(nodes) > 0 {
+		for _, name := range nodes {
+			node, err := h.getNode(name)
+			if err != nil {
+				return false, fmt.Errorf("failed to lookup node %s: %w", name, err)
+			}
+
+			if v, ok := node.Labels[key]; !matches(v, ok) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	}
+
+	if v, ok := spec.NodeSelector[key]; matches(v, ok) {
+		return true, nil
+	}
+
+	terms := requiredNodeSelectorTerms(spec.Affinity)
+	for _, term := range terms {
+		if !selectsLabel(term, key, value) {
+			return false, nil
+		}
+	}
+
+	return len(terms) > 0, nil
+}
+
+// selectsLabel returns true if the term selects only nodes with the label, an
+// empty value selects any value of the key
+func selectsLabel(term corev1.NodeSelectorTerm, key string, value string) bool {
+	for _, expression := range term.MatchExpressions {
+		if expression.Key != key {
+			continue
+		}
+
+		switch expression.Operator {
+		case corev1.NodeSelectorOpExists:
+			if value == "" {
+				return true
+			}
+		case corev1.NodeSelectorOpIn:
+			selected := len(expression.Values) > 0
+			for _, v := range expression.Values {
+				selected = selected && (value == "" || v == value)
+			}
+
+			if selected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/registry"
+)
+
+// pinTimeout bounds resolving and verifying all the bootstrap images
+const pinTimeout = time.Minute
+
+// pinBootstrapImages replaces the bootstrap images with references to their
+// digests, so the injected pods run the image that was resolved at startup.
+// When BootstrapVerifyKey is set, the signature of every digest is verified
+// and the webhook does not start with an unsigned image. Verified images are
+// always pinned, otherwise the tag could be moved after the verification.
+func (h *RequestsHandler) pinBootstrapImages(client *registry.Client) error {
+	if !h.PinBootstrapDigest && h.BootstrapVerifyKey == "" {
+		return nil
+	}
+
+	var key crypto.PublicKey
+	if h.BootstrapVerifyKey != "" {
+		var err error
+		if key, err = registry.LoadPublicKey(h.BootstrapVerifyKey); err != nil {
+			return err
+		}
+	}
+
+	if h.RegistryConfig != "" {
+		if err := client.LoadDockerConfig(h.RegistryConfig); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+	defer cancel()
+
+	pinned, err := pinImage(ctx, client, h.BootstrapImage, key)
+	if err != nil {
+		return err
+	}
+	h.BootstrapImage = pinned
+
+	archImages := make(map[string]string, len(h.BootstrapArchImages))
+	for arch, image := range h.BootstrapArchImages {
+		if archImages[arch], err = pinImage(ctx, client, image, key); err != nil {
+			return err
+		}
+	}
+	h.BootstrapArchImages = archImages
+
+	return nil
+}
+
+// pinImage returns the image pinned to its digest, after verifying its
+// signature if a key is given
+func pinImage(ctx context.Context, client *registry.Client, image string, key crypto.PublicKey) (string, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := client.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve digest of bootstrap image %s: %w", image, err)
+	}
+
+	if key != nil {
+		if err = client.Verify(ctx, ref, digest, key); err != nil {
+			return "", fmt.Errorf("bootstrap image signature verification failed: %w", err)
+		}
+		infoLogger.Printf("bootstrap image %s signature verified", ref.WithDigest(digest))
+	}
+
+	infoLogger.Printf("bootstrap image %s pinned to %s", image, ref.WithDigest(digest))
+	return ref.WithDigest(digest).String(), nil
+}
@@ -0,0 +1,433 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/k8tz/k8tz/pkg/version"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	kustomizeBaseDir      = "base"
+	kustomizeComponentDir = "components/webhook"
+
+	certManagerInjectCAAnnotation = "cert-manager.io/inject-ca-from"
+)
+
+// Kustomize generates a Kustomize base with the webhook server (namespace,
+// service account, rbac, service and deployment) and a component with the
+// MutatingWebhookConfiguration of the registration and its cert-manager
+// certificate, whose CA is injected in the caBundle by cert-manager's
+// ca-injector. The configuration is the one --register-webhook registers.
+type Kustomize struct {
+	Server *Server
+	Image  string
+	// Args are the arguments of the webhook container after "webhook"
+	Args []string
+	// Issuer is the cert-manager issuer of the certificate, a self-signed
+	// Issuer is generated if empty
+	Issuer     string
+	IssuerKind string
+}
+
+func NewKustomize() Kustomize {
+	server := NewAdmissionServer()
+	if server.Handler.InstallNamespace == "" {
+		server.Handler.InstallNamespace = "k8tz"
+	}
+
+	return Kustomize{
+		Server:     server,
+		Image:      version.Image(),
+		Args:       []string{},
+		Issuer:     "",
+		IssuerKind: "Issuer",
+	}
+}
+
+// kustomization is the kustomization.yaml of the root, the base and the
+// component
+type kustomization struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Resources  []string `json:"resources,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// Write writes the files of the kustomization to the directory
+func (k *Kustomize) Write(dir string) error {
+	files, err := k.Generate()
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		file := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return fmt.Errorf("failed to create directory of %s: %w", file, err)
+		}
+
+		if err := os.WriteFile(file, files[path], 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// Generate returns the files of the kustomization by their slash separated
+// path: kustomization.yaml, which includes the base and the component, and
+// the files of base/ and components/webhook/
+func (k *Kustomize) Generate() (map[string][]byte, error) {
+	if err := k.Server.Handler.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := k.Server.validateWebhookConfiguration(); err != nil {
+		return nil, err
+	}
+
+	if k.IssuerKind != "Issuer" && k.IssuerKind != "ClusterIssuer" {
+		return nil, fmt.Errorf("unknown issuer kind %q, expected Issuer or ClusterIssuer", k.IssuerKind)
+	}
+
+	if k.Issuer == "" && k.IssuerKind != "Issuer" {
+		return nil, fmt.Errorf("a %s requires the name of the issuer", k.IssuerKind)
+	}
+
+	configuration, err := k.webhookConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []struct {
+		path   string
+		object interface{}
+	}{
+		{"kustomization.yaml", kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1beta1",
+			Kind:       "Kustomization",
+			Resources:  []string{kustomizeBaseDir},
+			Components: []string{kustomizeComponentDir},
+		}},
+		{kustomizeBaseDir + "/kustomization.yaml", kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1beta1",
+			Kind:       "Kustomization",
+			Resources:  []string{"namespace.yaml", "serviceaccount.yaml", "rbac.yaml", "service.yaml", "deployment.yaml"},
+		}},
+		{kustomizeBaseDir + "/namespace.yaml", k.namespace()},
+		{kustomizeBaseDir + "/serviceaccount.yaml", k.serviceAccount()},
+		{kustomizeBaseDir + "/rbac.yaml", []interface{}{k.clusterRole(), k.clusterRoleBinding()}},
+		{kustomizeBaseDir + "/service.yaml", k.service()},
+		{kustomizeBaseDir + "/deployment.yaml", k.deployment()},
+		{kustomizeComponentDir + "/kustomization.yaml", kustomization{
+			APIVersion: "kustomize.config.k8s.io/v1alpha1",
+			Kind:       "Component",
+			Resources:  []string{"certificate.yaml", "mutatingwebhookconfiguration.yaml"},
+		}},
+		{kustomizeComponentDir + "/certificate.yaml", k.certificate()},
+		{kustomizeComponentDir + "/mutatingwebhookconfiguration.yaml", configuration},
+	}
+
+	files := map[string][]byte{}
+	for _, manifest := range manifests {
+		documents, ok := manifest.object.([]interface{})
+		if !ok {
+			documents = []interface{}{manifest.object}
+		}
+
+		var data []byte
+		for i, document := range documents {
+			out, err := manifestYAML(document)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal %s: %w", manifest.path, err)
+			}
+
+			if i > 0 {
+				data = append(data, "---\n"...)
+			}
+			data = append(data, out...)
+		}
+
+		files[manifest.path] = data
+	}
+
+	return files, nil
+}
+
+// webhookConfiguration returns the configuration of the registration, with
+// the caBundle injected by cert-manager from the certificate of the component
+func (k *Kustomize) webhookConfiguration() (interface{}, error) {
+	configuration, err := k.Server.webhookConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	configuration.TypeMeta = metav1.TypeMeta{APIVersion: "admissionregistration.k8s.io/v1", Kind: "MutatingWebhookConfiguration"}
+	// the configuration is not managed by --register-webhook
+	configuration.Labels = k.labels()
+	configuration.Annotations = map[string]string{
+		certManagerInjectCAAnnotation: k.namespaceName() + "/" + k.secretName(),
+	}
+
+	return configuration, nil
+}
+
+func (k *Kustomize) name() string {
+	return k.Server.Registration.Name
+}
+
+func (k *Kustomize) namespaceName() string {
+	return k.Server.Handler.InstallNamespace
+}
+
+func (k *Kustomize) secretName() string {
+	return k.name() + "-tls"
+}
+
+func (k *Kustomize) labels() map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "k8tz",
+		"app.kubernetes.io/instance": k.name(),
+	}
+}
+
+func (k *Kustomize) objectMeta(name string, namespaced bool) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Labels: k.labels()}
+	if namespaced {
+		meta.Namespace = k.namespaceName()
+	}
+
+	return meta
+}
+
+// namespace returns the install namespace, labeled so the webhook is not
+// called for it
+func (k *Kustomize) namespace() *corev1.Namespace {
+	namespace := &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: k.objectMeta(k.namespaceName(), false),
+	}
+	namespace.Labels["k8tz.io/controller-namespace"] = "true"
+
+	return namespace
+}
+
+func (k *Kustomize) serviceAccount() *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: k.objectMeta(k.name(), true),
+	}
+}
+
+// clusterRole returns the permissions of the lookups of the handler
+func (k *Kustomize) clusterRole() *rbacv1.ClusterRole {
+	handler := &k.Server.Handler
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+	}
+
+	if handler.AutoTimezone || handler.HostPathNodeLabel != "" {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get", "list", "watch"}})
+	}
+
+	if handler.CronJobOwners {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: []string{"get", "list", "watch"}})
+	}
+
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+		ObjectMeta: k.objectMeta(k.name()+"-role", false),
+		Rules:      rules,
+	}
+}
+
+func (k *Kustomize) clusterRoleBinding() *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+		ObjectMeta: k.objectMeta(k.name()+"-role-binding", false),
+		Subjects: []rbacv1.Subject{
+			{Kind: "ServiceAccount", Name: k.name(), Namespace: k.namespaceName()},
+		},
+		RoleRef: rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: k.name() + "-role"},
+	}
+}
+
+func (k *Kustomize) service() *corev1.Service {
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: k.objectMeta(k.Server.Registration.ServiceName, true),
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{
+				Name:       "https",
+				Port:       k.Server.Registration.ServicePort,
+				TargetPort: intstr.FromString("https"),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+			Selector: k.labels(),
+		},
+	}
+}
+
+// deployment returns the webhook server, serving the certificate of the
+// secret that it reloads when cert-manager renews it
+func (k *Kustomize) deployment() *appsv1.Deployment {
+	replicas := int32(1)
+	noEscalation := false
+	nonRoot := true
+	seccomp := &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	probe := func(path string) *corev1.Probe {
+		return &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+			Path:   path,
+			Port:   intstr.FromString("https"),
+			Scheme: corev1.URISchemeHTTPS,
+		}}}
+	}
+
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: k.objectMeta(k.name(), true),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: k.labels()},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: k.labels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: k.name(),
+					SecurityContext:    &corev1.PodSecurityContext{RunAsNonRoot: &nonRoot, SeccompProfile: seccomp},
+					Volumes: []corev1.Volume{{
+						Name:         "tls",
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: k.secretName()}},
+					}},
+					Containers: []corev1.Container{{
+						Name:  "k8tz",
+						Image: k.Image,
+						Args:  append([]string{"webhook"}, k.Args...),
+						Env: []corev1.EnvVar{{
+							Name:      "POD_NAMESPACE",
+							ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}},
+						}},
+						Ports: []corev1.ContainerPort{{Name: "https", ContainerPort: 8443, Protocol: corev1.ProtocolTCP}},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "tls",
+							MountPath: "/run/secrets/tls",
+							ReadOnly:  true,
+						}},
+						LivenessProbe:  probe("/healthz"),
+						ReadinessProbe: probe("/readyz"),
+						SecurityContext: &corev1.SecurityContext{
+							AllowPrivilegeEscalation: &noEscalation,
+							Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+							RunAsNonRoot:             &nonRoot,
+							SeccompProfile:           seccomp,
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// certificate returns the cert-manager Certificate of the webhook service, and
+// its self-signed Issuer if no issuer is given
+func (k *Kustomize) certificate() []interface{} {
+	metadata := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "namespace": k.namespaceName(), "labels": k.labels()}
+	}
+
+	issuer := map[string]interface{}{"name": k.Issuer, "kind": k.IssuerKind}
+	var documents []interface{}
+	if k.Issuer == "" {
+		issuer["name"] = k.name() + "-selfsigned"
+		documents = append(documents, map[string]interface{}{
+			"apiVersion": "cert-manager.io/v1",
+			"kind":       "Issuer",
+			"metadata":   metadata(k.name() + "-selfsigned"),
+			"spec":       map[string]interface{}{"selfSigned": map[string]interface{}{}},
+		})
+	}
+
+	return append(documents, map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata":   metadata(k.secretName()),
+		"spec": map[string]interface{}{
+			"secretName":  k.secretName(),
+			"dnsNames":    []string{fmt.Sprintf("%s.%s.svc", k.Server.Registration.ServiceName, k.namespaceName())},
+			"duration":    "2160h",
+			"renewBefore": "720h",
+			"issuerRef":   issuer,
+		},
+	})
+}
+
+// manifestYAML returns the object as YAML, the empty fields of the typed
+// objects (e.g. creationTimestamp and status) are removed
+func manifestYAML(object interface{}) ([]byte, error) {
+	if _, untyped := object.(map[string]interface{}); untyped {
+		return yaml.Marshal(object)
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(pruneEmpty(fields))
+}
+
+// pruneEmpty removes the null values and the empty objects
+func pruneEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			field = pruneEmpty(field)
+			if object, ok := field.(map[string]interface{}); field == nil || ok && len(object) == 0 {
+				delete(v, key)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = pruneEmpty(item)
+		}
+	}
+
+	return value
+}
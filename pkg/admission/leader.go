@@ -0,0 +1,144 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// leading is 1 while the controllers of this replica are running
+var leading int32
+
+// hasControllers returns true if any of the features that reconcile cluster
+// objects is enabled, they must run in a single replica at a time
+func (h *Server) hasControllers() bool {
+	return h.Handler.ReinjectWorkloads || h.Handler.DSTTransitions || h.Handler.TzdataUpgrade == TzdataUpgradeReport || h.Handler.TzdataUpgrade == TzdataUpgradeRestart
+}
+
+// runControllers starts the re-injection, the tz database checks and the
+// timezone transitions checks, until stop is closed
+func (h *Server) runControllers(stop <-chan struct{}) error {
+	if h.Handler.TzdataUpgrade == TzdataUpgradeReport || h.Handler.TzdataUpgrade == TzdataUpgradeRestart {
+		go h.Handler.watchTzdataVersions(stop)
+	}
+
+	if h.Handler.DSTTransitions {
+		go h.Handler.watchDSTTransitions(stop)
+	}
+
+	if h.Handler.ReinjectWorkloads {
+		if err := h.Handler.startReinjection(stop); err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreInt32(&leading, 1)
+	return nil
+}
+
+// startControllers runs the controllers in this replica, or in the replica
+// that holds the LeaderElectionID lease when LeaderElection is enabled, so the
+// webhook can run multiple replicas without reconciling the same objects
+// twice. The lease is released when ctx is done.
+func (h *Server) startControllers(ctx context.Context) error {
+	if !h.hasControllers() {
+		return nil
+	}
+
+	if !h.LeaderElection {
+		return h.runControllers(nil)
+	}
+
+	namespace := h.LeaseNamespace
+	if namespace == "" {
+		namespace = h.Handler.InstallNamespace
+	}
+
+	if namespace == "" {
+		return fmt.Errorf("leader election requires the namespace of the lease, set --leader-election-namespace")
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get the identity for leader election: %w", err)
+	}
+
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, h.LeaderElectionID,
+		h.Handler.clientset.CoreV1(), h.Handler.clientset.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return err
+	}
+
+	go h.campaign(ctx, lock)
+	return nil
+}
+
+// campaign runs the controllers whenever this replica is elected, until ctx
+// is done. The controllers stop when the lease is lost, and the replica joins
+// the election again.
+func (h *Server) campaign(ctx context.Context, lock resourcelock.Interface) {
+	for ctx.Err() == nil {
+		term, cancel := context.WithCancel(ctx)
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   h.LeaseDuration,
+			RenewDeadline:   h.RenewDeadline,
+			RetryPeriod:     h.RetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            h.LeaderElectionID,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leaderCtx context.Context) {
+					infoLogger.Printf("elected as the leader of %s, starting controllers", h.LeaderElectionID)
+					if err := h.runControllers(leaderCtx.Done()); err != nil {
+						errorLogger.Printf("failed to start controllers, releasing the leadership: %v", err)
+						cancel()
+					}
+				},
+				OnStoppedLeading: func() {
+					atomic.StoreInt32(&leading, 0)
+					infoLogger.Printf("lost the leadership of %s, controllers stopped", lock.Identity())
+				},
+				OnNewLeader: func(identity string) {
+					if identity != lock.Identity() {
+						infoLogger.Printf("%s is the leader of %s", identity, h.LeaderElectionID)
+					}
+				},
+			},
+		})
+
+		if err != nil {
+			cancel()
+			errorLogger.Printf("leader election disabled: %v", err)
+			return
+		}
+
+		elector.Run(term)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(h.RetryPeriod):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxRequestBytes is the default limit of the size of an admission
+// review, it fits both the object and the old object of the largest objects
+// that etcd accepts
+const DefaultMaxRequestBytes = 7 * 1024 * 1024
+
+// readBody reads the request body up to MaxRequestBytes, larger bodies are
+// rejected without being read to the end
+func (h *RequestsHandler) readBody(r *http.Request) ([]byte, int, error) {
+	if h.MaxRequestBytes <= 0 {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("could not read request body, error=%s", err.Error())
+		}
+
+		return body, http.StatusOK, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.MaxRequestBytes+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("could not read request body, error=%s", err.Error())
+	}
+
+	if int64(len(body)) > h.MaxRequestBytes {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds the limit of %d bytes", h.MaxRequestBytes)
+	}
+
+	return body, http.StatusOK, nil
+}
+
+// limitConcurrency creates the slots of the concurrent reviews, there is no
+// limit if MaxConcurrentReviews is not positive
+func (h *RequestsHandler) limitConcurrency() {
+	if h.MaxConcurrentReviews > 0 {
+		h.reviewSlots = make(chan struct{}, h.MaxConcurrentReviews)
+	}
+}
+
+// acquireReviewSlot waits for a free slot to review the request, false is
+// returned if the request is cancelled first, e.g. by the timeout of the api
+// server. The returned function releases the slot.
+func (h *RequestsHandler) acquireReviewSlot(r *http.Request) (func(), bool) {
+	if h.reviewSlots == nil {
+		return func() {}, true
+	}
+
+	select {
+	case h.reviewSlots <- struct{}{}:
+		return func() { <-h.reviewSlots }, true
+	case <-r.Context().Done():
+		return nil, false
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// listen opens the listeners of the webhook: one per resolved address of
+// Addresses, served with TLS, and the UnixSocket, served in plaintext since
+// the proxy in front of it (e.g. envoy) terminates the TLS connections
+func (h *Server) listen(ctx context.Context) ([]net.Listener, error) {
+	if len(h.Addresses) == 0 && h.UnixSocket == "" {
+		return nil, errors.New("no address to listen on, set --addr or --unix-socket")
+	}
+
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	for _, address := range h.Addresses {
+		resolved, err := resolveAddress(ctx, net.DefaultResolver, address)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+
+		for _, a := range resolved {
+			l, err := h.listenTCP(ctx, a)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+
+			infoLogger.Printf("Listening on %s\n", l.Addr())
+			listeners = append(listeners, l)
+		}
+	}
+
+	if h.UnixSocket != "" {
+		l, ok := h.takeInherited("unix", h.UnixSocket)
+		if !ok {
+			var err error
+			if l, err = listenUnix(h.UnixSocket); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+
+		infoLogger.Printf("Listening on unix socket %s (plaintext)\n", h.UnixSocket)
+		listeners = append(listeners, h.track("unix", h.UnixSocket, l))
+	}
+
+	h.closeInherited()
+	return listeners, nil
+}
+
+// listenTCP listens on the address, or uses the listener of the address that
+// is inherited on handover. With ReusePort other processes can listen on the
+// same address.
+func (h *Server) listenTCP(ctx context.Context, address string) (net.Listener, error) {
+	l, ok := h.takeInherited("tcp", address)
+	if !ok {
+		config := net.ListenConfig{}
+		if h.ReusePort {
+			config.Control = reusePort
+		}
+
+		var err error
+		if l, err = config.Listen(ctx, "tcp", address); err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+	}
+
+	return h.track("tcp", address, l), nil
+}
+
+// resolveAddress returns the addresses to listen on for the address. An empty
+// host or an ip is kept as is (an empty host or "::" listens on both ip
+// families), while a host name is resolved to all its ips, e.g. localhost to
+// both 127.0.0.1 and ::1, since a single listener only binds one of them.
+func resolveAddress(ctx context.Context, resolver *net.Resolver, address string) ([]string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{address}, nil
+	}
+
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	seen := map[string]bool{}
+	var addresses []string
+	for _, ip := range ips {
+		a := net.JoinHostPort(ip.String(), port)
+		if !seen[a] {
+			seen[a] = true
+			addresses = append(addresses, a)
+		}
+	}
+
+	return addresses, nil
+}
+
+// listenUnix listens on the unix socket, a stale socket file left by a
+// previous run is removed first. The file is removed when the listener is
+// closed.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket %s: %w", path, err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on unix socket %s: %w", path, err)
+	}
+
+	return l, nil
+}
+
+// serveListeners serves the listeners until the server is closed or one of
+// them fails, tcp listeners with TLS and unix sockets in plaintext
+func serveListeners(server *http.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			if l.Addr().Network() == "unix" {
+				errs <- server.Serve(l)
+			} else {
+				errs <- server.ServeTLS(l, "", "")
+			}
+		}(l)
+	}
+
+	return <-errs
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	admissionReviews       uint64
+	dryRunMutations        uint64
+	tlsHandshakeFailures   uint64
+	serverReady            int32
+	certificateLoadedAt    int64    // unix seconds
+	injections             sync.Map // injectionKey -> *uint64
+	patchGenerationSeconds = newHistogram([]float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1})
+)
+
+// injectionKey identifies the per-namespace injection counters
+type injectionKey struct {
+	kind      string
+	namespace string
+}
+
+// countInjection counts an injected object of the kind in the namespace
+func countInjection(kind string, namespace string) {
+	count, _ := injections.LoadOrStore(injectionKey{kind: kind, namespace: namespace}, new(uint64))
+	atomic.AddUint64(count.(*uint64), 1)
+}
+
+// histogram is a minimal Prometheus histogram with fixed buckets
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// observeSince observes the seconds passed since start
+func (h *histogram) observeSince(start time.Time) {
+	h.observe(time.Since(start).Seconds())
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bucket := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", name, bucket, h.counts[i])
+	}
+
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %v\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// tlsErrorWriter is the output of the http server error log, it counts the TLS
+// handshake failures and forwards the messages to the error logger
+type tlsErrorWriter struct{}
+
+func (tlsErrorWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("TLS handshake error")) {
+		atomic.AddUint64(&tlsHandshakeFailures, 1)
+	}
+
+	errorLogger.Print(string(p))
+	return len(p), nil
+}
+
+// writeMetrics writes all the metrics in the Prometheus text format
+func writeMetrics(w io.Writer) {
+	fmt.Fprintln(w, "# HELP k8tz_admission_reviews_total Total number of admission reviews handled.")
+	fmt.Fprintln(w, "# TYPE k8tz_admission_reviews_total counter")
+	fmt.Fprintf(w, "k8tz_admission_reviews_total %d\n", atomic.LoadUint64(&admissionReviews))
+
+	writeReasons(w, "k8tz_admission_skipped_total", "Total number of admission requests allowed without injection, by reason.", skippedRequests)
+	writeReasons(w, "k8tz_admission_rejected_total", "Total number of rejected admission requests, by reason.", rejectedRequests)
+
+	writeRouteRequests(w)
+	writeReviewErrors(w)
+
+	fmt.Fprintln(w, "# HELP k8tz_injections_total Total number of injected objects, by kind and namespace.")
+	fmt.Fprintln(w, "# TYPE k8tz_injections_total counter")
+	var lines []string
+	injections.Range(func(key, count interface{}) bool {
+		k := key.(injectionKey)
+		lines = append(lines, fmt.Sprintf("k8tz_injections_total{kind=%q,namespace=%q} %d", k.kind, k.namespace, atomic.LoadUint64(count.(*uint64))))
+		return true
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+
+	fmt.Fprintln(w, "# HELP k8tz_dry_run_mutations_total Total number of admission reviews whose patches were withheld by the dry-run mode.")
+	fmt.Fprintln(w, "# TYPE k8tz_dry_run_mutations_total counter")
+	fmt.Fprintf(w, "k8tz_dry_run_mutations_total %d\n", atomic.LoadUint64(&dryRunMutations))
+
+	fmt.Fprintln(w, "# HELP k8tz_audit_dropped_records_total Total number of audit records dropped since the audit webhook could not keep up.")
+	fmt.Fprintln(w, "# TYPE k8tz_audit_dropped_records_total counter")
+	fmt.Fprintf(w, "k8tz_audit_dropped_records_total %d\n", atomic.LoadUint64(&auditDroppedRecords))
+
+	fmt.Fprintln(w, "# HELP k8tz_circuit_breaker_open Whether the circuit breaker is open and admission reviews are allowed without injection.")
+	fmt.Fprintln(w, "# TYPE k8tz_circuit_breaker_open gauge")
+	fmt.Fprintf(w, "k8tz_circuit_breaker_open %d\n", atomic.LoadInt32(&circuitBreakerOpen))
+
+	fmt.Fprintln(w, "# HELP k8tz_circuit_breaker_trips_total Total number of times the circuit breaker opened.")
+	fmt.Fprintln(w, "# TYPE k8tz_circuit_breaker_trips_total counter")
+	fmt.Fprintf(w, "k8tz_circuit_breaker_trips_total %d\n", atomic.LoadUint64(&circuitBreakerTrips))
+
+	fmt.Fprintln(w, "# HELP k8tz_patch_generation_duration_seconds Latency of the patch generation of injected objects.")
+	fmt.Fprintln(w, "# TYPE k8tz_patch_generation_duration_seconds histogram")
+	patchGenerationSeconds.write(w, "k8tz_patch_generation_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP k8tz_outdated_tzdata_pods Number of running pods injected with an older tz database, found by the last check.")
+	fmt.Fprintln(w, "# TYPE k8tz_outdated_tzdata_pods gauge")
+	fmt.Fprintf(w, "k8tz_outdated_tzdata_pods %d\n", atomic.LoadInt64(&outdatedTzdataPods))
+
+	writeDSTTransitions(w)
+
+	fmt.Fprintln(w, "# HELP k8tz_controllers_leader Whether the controllers (re-injection, tz database and timezone transitions checks) run in this replica.")
+	fmt.Fprintln(w, "# TYPE k8tz_controllers_leader gauge")
+	fmt.Fprintf(w, "k8tz_controllers_leader %d\n", atomic.LoadInt32(&leading))
+
+	fmt.Fprintln(w, "# HELP k8tz_ready Whether the webhook is ready and evaluates the admission reviews, updated by the readiness checks (/readyz) and when the caches sync, the circuit breaker opens or closes or the webhook starts draining.")
+	fmt.Fprintln(w, "# TYPE k8tz_ready gauge")
+	fmt.Fprintf(w, "k8tz_ready %d\n", atomic.LoadInt32(&serverReady))
+
+	fmt.Fprintln(w, "# HELP k8tz_cert_last_loaded_timestamp_seconds Unix time the TLS certificate was last loaded, 0 if it was never loaded.")
+	fmt.Fprintln(w, "# TYPE k8tz_cert_last_loaded_timestamp_seconds gauge")
+	fmt.Fprintf(w, "k8tz_cert_last_loaded_timestamp_seconds %d\n", atomic.LoadInt64(&certificateLoadedAt))
+
+	fmt.Fprintln(w, "# HELP k8tz_tls_handshake_failures_total Total number of failed TLS handshakes.")
+	fmt.Fprintln(w, "# TYPE k8tz_tls_handshake_failures_total counter")
+	fmt.Fprintf(w, "k8tz_tls_handshake_failures_total %d\n", atomic.LoadUint64(&tlsHandshakeFailures))
+}
+
+func writeReasons(w io.Writer, name string, help string, counter *reasonCounter) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+
+	snapshot := counter.snapshot()
+	for _, r := range Reasons {
+		fmt.Fprintf(w, "%s{reason=%q} %d\n", name, r, snapshot[r])
+	}
+}
+
+func (h *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(w)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getNamespace returns the namespace from the cache if it is enabled, or from
+// the api server otherwise. Namespaces that are missing from the cache are
+// fetched as well since they may have been created just now. The returned
+// namespace is shared with the cache and must not be modified.
+func (h *RequestsHandler) getNamespace(name string) (*corev1.Namespace, error) {
+	if h.namespaces != nil {
+		namespace, err := h.namespaces.Get(name)
+		if err == nil {
+			return namespace, nil
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return h.clientset.CoreV1().Namespaces().Get(context.TODO(), name, metav1.GetOptions{})
+}
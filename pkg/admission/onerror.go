@@ -0,0 +1,266 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ErrorAction is what the webhook answers when it fails to decode or handle
+// an admission review
+type ErrorAction string
+
+const (
+	// ErrorActionAllow admits the object without injection, with a warning
+	ErrorActionAllow ErrorAction = "allow"
+	// ErrorActionDeny rejects the object with the error
+	ErrorActionDeny ErrorAction = "deny"
+)
+
+// Validate returns an error if the action is unknown, empty is allowed and
+// keeps the behavior of --allow-on-error
+func (a ErrorAction) Validate() error {
+	switch a {
+	case "", ErrorActionAllow, ErrorActionDeny:
+		return nil
+	default:
+		return fmt.Errorf("unknown error action %q, expected %s or %s", a, ErrorActionAllow, ErrorActionDeny)
+	}
+}
+
+// ErrorActions are the error actions of resources by "resource.group", e.g.
+// pods or cronjobs.batch, they override OnError. It implements pflag.Value so
+// it can be set with repeated "resource.group=action" flags.
+type ErrorActions map[string]ErrorAction
+
+func (a *ErrorActions) String() string {
+	var values []string
+	for resource, action := range *a {
+		values = append(values, fmt.Sprintf("%s=%s", resource, action))
+	}
+
+	sort.Strings(values)
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func (a *ErrorActions) Set(value string) error {
+	resource, action, ok := strings.Cut(value, "=")
+	if !ok || resource == "" || action == "" {
+		return fmt.Errorf("invalid error action %q, expected resource.group=%s|%s", value, ErrorActionAllow, ErrorActionDeny)
+	}
+
+	if err := ErrorAction(action).Validate(); err != nil {
+		return err
+	}
+
+	if *a == nil {
+		*a = ErrorActions{}
+	}
+
+	(*a)[resource] = ErrorAction(action)
+	return nil
+}
+
+func (a *ErrorActions) Type() string {
+	return "resource.group=action"
+}
+
+// errorKey identifies the counters of the reviews that failed, by resource
+// and the action taken
+type errorKey struct {
+	resource string
+	action   ErrorAction
+}
+
+// reviewErrors counts the reviews that failed by errorKey
+var reviewErrors sync.Map // errorKey -> *uint64
+
+// countError counts a review of the resource that failed and was answered
+// with the action
+func (h *RequestsHandler) countError(resource metav1.GroupVersionResource, action ErrorAction) {
+	count, _ := reviewErrors.LoadOrStore(errorKey{resource: h.errorResourceLabel(resource), action: action}, new(uint64))
+	atomic.AddUint64(count.(*uint64), 1)
+}
+
+// errorResourceLabel returns the resource as a metric label, resources that
+// the webhook does not handle are counted as "other" so a malformed review
+// cannot add labels
+func (h *RequestsHandler) errorResourceLabel(resource metav1.GroupVersionResource) string {
+	name := groupResource(resource)
+	if _, ok := resourceHandlers[resource]; ok {
+		return name
+	}
+
+	if _, ok := h.TemplatePaths[name]; ok {
+		return name
+	}
+
+	if _, ok := h.OnErrorResources[name]; ok {
+		return name
+	}
+
+	return "other"
+}
+
+func writeReviewErrors(w io.Writer) {
+	fmt.Fprintln(w, "# HELP k8tz_admission_errors_total Total number of admission reviews that k8tz failed to decode or handle, by resource and the action taken (allow or deny).")
+	fmt.Fprintln(w, "# TYPE k8tz_admission_errors_total counter")
+	var lines []string
+	reviewErrors.Range(func(key, count interface{}) bool {
+		k := key.(errorKey)
+		lines = append(lines, fmt.Sprintf("k8tz_admission_errors_total{resource=%q,action=%q} %d", k.resource, k.action, atomic.LoadUint64(count.(*uint64))))
+		return true
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// validateOnError checks the error actions, resources are named by their
+// plural name and group, e.g. pods or cronjobs.batch
+func (h *RequestsHandler) validateOnError() error {
+	if err := h.OnError.Validate(); err != nil {
+		return err
+	}
+
+	for resource, action := range h.OnErrorResources {
+		if resource == "" || strings.ContainsAny(resource, "/ ") {
+			return fmt.Errorf("invalid resource %q of the error actions, expected e.g. pods or cronjobs.batch", resource)
+		}
+
+		if action == "" {
+			return fmt.Errorf("missing error action of resource %s", resource)
+		}
+
+		if err := action.Validate(); err != nil {
+			return fmt.Errorf("invalid error action of resource %s: %w", resource, err)
+		}
+	}
+
+	return nil
+}
+
+// errorAction returns the action for failed reviews of the resource: the
+// override of the resource, OnError, or allow with AllowOnError. The second
+// value is false if neither an override nor OnError is set, reviews that
+// cannot be decoded fail with an HTTP error then and the failurePolicy of the
+// webhook configuration applies.
+func (h *RequestsHandler) errorAction(resource metav1.GroupVersionResource) (ErrorAction, bool) {
+	if action, ok := h.OnErrorResources[groupResource(resource)]; ok {
+		return action, true
+	}
+
+	if h.OnError != "" {
+		return h.OnError, true
+	}
+
+	if h.AllowOnError {
+		return ErrorActionAllow, false
+	}
+
+	return ErrorActionDeny, false
+}
+
+// decodeError is an admission review that cannot be decoded
+type decodeError struct {
+	err  error
+	body []byte
+}
+
+func (e *decodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
+
+// answerDecodeError answers a review that cannot be decoded with the error
+// action of its resource, it returns false if no action is configured or if
+// the uid and version of the review cannot be read, which a response needs
+func (h *RequestsHandler) answerDecodeError(w http.ResponseWriter, decodeErr *decodeError) bool {
+	partial := struct {
+		metav1.TypeMeta `json:",inline"`
+		Request         *struct {
+			UID      types.UID                   `json:"uid"`
+			Resource metav1.GroupVersionResource `json:"resource"`
+		} `json:"request"`
+	}{}
+
+	if err := json.Unmarshal(decodeErr.body, &partial); err != nil || partial.Request == nil || partial.Request.UID == "" || !isSupportedAdmissionReview(partial.TypeMeta) {
+		return false
+	}
+
+	action, configured := h.errorAction(partial.Request.Resource)
+	if !configured {
+		return false
+	}
+
+	h.countError(partial.Request.Resource, action)
+	response := admission.AdmissionReview{
+		TypeMeta: partial.TypeMeta,
+		Response: &admission.AdmissionResponse{UID: partial.Request.UID},
+	}
+
+	if action == ErrorActionAllow {
+		skippedRequests.inc(ReasonInvalidObject)
+		warningLogger.Printf("allowing undecodable review uid=%s without injection (on-error=%s): %v", partial.Request.UID, action, decodeErr)
+		response.Response.Allowed = true
+		response.Response.Warnings = []string{fmt.Sprintf("k8tz injection skipped: %v", decodeErr)}
+	} else {
+		rejectedRequests.inc(ReasonInvalidObject)
+		warningLogger.Printf("rejecting undecodable review uid=%s (on-error=%s): %v", partial.Request.UID, action, decodeErr)
+		response.Response.Result = &metav1.Status{
+			Message: decodeErr.Error(),
+			Reason:  metav1.StatusReasonBadRequest,
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		errorLogger.Printf("failed to marshal response review: %+v, error=%v\n", response, err)
+		return false
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	if _, err = w.Write(bytes); err != nil {
+		errorLogger.Printf("failed to write response to output http stream: %v\n", err)
+	}
+
+	return true
+}
+
+// isDecodeError returns the decode error of a failed read of a review
+func isDecodeError(err error) (*decodeError, bool) {
+	var de *decodeError
+	ok := errors.As(err, &de)
+	return de, ok
+}
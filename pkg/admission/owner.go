@@ -0,0 +1,108 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ownerAnnotations returns the annotations of the CronJob that owns the
+// object, either directly (a Job) or through its Job (a pod), so the jobs of
+// CronJobs that were admitted before k8tz was installed are resolved like the
+// CronJob. Nil is returned if the lookup is disabled or the object has no
+// such owner.
+func (h *RequestsHandler) ownerAnnotations(meta *metav1.ObjectMeta) (map[string]string, error) {
+	if !h.CronJobOwners {
+		return nil, nil
+	}
+
+	owner := metav1.GetControllerOfNoCopy(meta)
+	if owner != nil && isBatchOwner(owner, "Job") {
+		job, err := h.getJob(meta.Namespace, owner.Name)
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if job.UID != owner.UID {
+			return nil, nil
+		}
+
+		owner = metav1.GetControllerOfNoCopy(&job.ObjectMeta)
+	}
+
+	if owner == nil || !isBatchOwner(owner, "CronJob") {
+		return nil, nil
+	}
+
+	cronJob, err := h.getCronJob(meta.Namespace, owner.Name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if cronJob.UID != owner.UID {
+		return nil, nil
+	}
+
+	return cronJob.Annotations, nil
+}
+
+// isBatchOwner returns true if the owner is of the kind in the batch group,
+// in any version
+func isBatchOwner(owner *metav1.OwnerReference, kind string) bool {
+	gv, err := schema.ParseGroupVersion(owner.APIVersion)
+	return err == nil && gv.Group == batchv1.GroupName && owner.Kind == kind
+}
+
+// getJob returns the job from the cache if it is enabled, or from the api
+// server otherwise. Jobs that are missing from the cache are fetched as well
+// since their pods are created right after them.
+func (h *RequestsHandler) getJob(namespace string, name string) (*batchv1.Job, error) {
+	if h.jobs != nil {
+		job, err := h.jobs.Jobs(namespace).Get(name)
+		if err == nil {
+			return job, nil
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return h.clientset.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+// getCronJob returns the cronjob from the cache if it is enabled, or from the
+// api server otherwise
+func (h *RequestsHandler) getCronJob(namespace string, name string) (*batchv1.CronJob, error) {
+	if h.cronJobs != nil {
+		cronJob, err := h.cronJobs.CronJobs(namespace).Get(name)
+		if err == nil {
+			return cronJob, nil
+		} else if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	return h.clientset.BatchV1().CronJobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+}
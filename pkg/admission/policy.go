@@ -0,0 +1,167 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TimezonePolicy restricts the timezones that can be injected. Both lists
+// contain timezone names or glob patterns (e.g. "Europe/*"), deny takes
+// precedence over allow and an empty allow list allows every timezone.
+type TimezonePolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// timezonePolicy holds the current *TimezonePolicy, it is swapped as a whole
+// on reload and shared between the copies of the handler
+var timezonePolicy atomic.Value
+
+// LoadTimezonePolicy reads a YAML (or JSON) timezone policy file
+func LoadTimezonePolicy(file string) (*TimezonePolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read timezone policy: %w", err)
+	}
+
+	return parseTimezonePolicy(data)
+}
+
+func parseTimezonePolicy(data []byte) (*TimezonePolicy, error) {
+	policy := &TimezonePolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to parse timezone policy: %w", err)
+	}
+
+	for _, pattern := range append(append([]string{}, policy.Allow...), policy.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid timezone pattern %q: %w", pattern, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// Allowed returns true if the timezone can be injected according to the policy
+func (p *TimezonePolicy) Allowed(timezone string) bool {
+	if p == nil {
+		return true
+	}
+
+	if matchTimezone(p.Deny, timezone) {
+		return false
+	}
+
+	return len(p.Allow) == 0 || matchTimezone(p.Allow, timezone)
+}
+
+func matchTimezone(patterns []string, timezone string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, timezone); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetTimezonePolicy replaces the timezone policy used by all the following
+// requests, nil removes the restrictions
+func SetTimezonePolicy(policy *TimezonePolicy) {
+	timezonePolicy.Store(policy)
+}
+
+func currentTimezonePolicy() *TimezonePolicy {
+	policy, _ := timezonePolicy.Load().(*TimezonePolicy)
+	return policy
+}
+
+// checkTimezonePolicy rejects timezones that are not allowed by the current
+// timezone policy
+func checkTimezonePolicy(timezone string) error {
+	if !currentTimezonePolicy().Allowed(timezone) {
+		return withReason(ReasonTimezoneDenied, "timezone %s is not allowed by the timezone policy", timezone)
+	}
+
+	return nil
+}
+
+// reloadTimezonePolicy loads the TimezonePolicyFile and swaps the current
+// policy, the previous policy is kept when the file cannot be loaded
+func (h *RequestsHandler) reloadTimezonePolicy() error {
+	policy, err := LoadTimezonePolicy(h.TimezonePolicyFile)
+	if err != nil {
+		return err
+	}
+
+	SetTimezonePolicy(policy)
+	infoLogger.Printf("timezone policy loaded from %s: allow=%v, deny=%v", h.TimezonePolicyFile, policy.Allow, policy.Deny)
+	return nil
+}
+
+// watchTimezonePolicy reloads the TimezonePolicyFile on SIGHUP, and whenever
+// its content changes (e.g. a mounted ConfigMap is updated) when
+// TimezonePolicyReload is set. It returns when stop is closed.
+func (h *RequestsHandler) watchTimezonePolicy(stop <-chan struct{}) {
+	watchFile(h.TimezonePolicyFile, h.TimezonePolicyReload, "timezone policy", h.reloadTimezonePolicy, stop)
+}
+
+// watchFile calls reload on SIGHUP, and whenever the content of the file
+// changes when interval is set. It returns when stop is closed.
+func watchFile(file string, interval time.Duration, name string, reload func() error, stop <-chan struct{}) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last, _ := os.ReadFile(file)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hangup:
+			infoLogger.Printf("received SIGHUP, reloading %s", name)
+		case <-tick:
+			if data, err := os.ReadFile(file); err != nil || bytes.Equal(data, last) {
+				continue
+			}
+		}
+
+		// the content is remembered even if it is invalid, so a broken
+		// file is reported once rather than on every tick
+		last, _ = os.ReadFile(file)
+		if err := reload(); err != nil {
+			errorLogger.Printf("failed to reload %s, keeping the previous one: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/apis/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// startTimezonePolicies starts an informer that keeps the TimezonePolicy
+// objects in memory, they are evaluated on every request. It runs until stop
+// is closed.
+func (h *RequestsHandler) startTimezonePolicies(client dynamic.Interface, stop <-chan struct{}) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	informer := factory.ForResource(v1alpha1.TimezonePolicyResource)
+	factory.Start(stop)
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(cacheSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+
+	if !cache.WaitForCacheSync(timeout, informer.Informer().HasSynced) {
+		return fmt.Errorf("timezone policies were not synced within %s, is the %s CRD installed?", cacheSyncTimeout, v1alpha1.TimezonePolicyResource.GroupResource())
+	}
+
+	h.policies = informer.Lister()
+	infoLogger.Printf("watching timezone policies")
+	return nil
+}
+
+// matchingTimezonePolicy returns the TimezonePolicy that selects the pod, the
+// one with the highest priority if there are several, or nil if none does.
+// Invalid policies are ignored.
+func (h *RequestsHandler) matchingTimezonePolicy(namespace *corev1.Namespace, pod *corev1.Pod) *v1alpha1.TimezonePolicy {
+	if h.policies == nil {
+		return nil
+	}
+
+	objects, err := h.policies.List(labels.Everything())
+	if err != nil {
+		warningLogger.Printf("failed to list timezone policies: %v", err)
+		return nil
+	}
+
+	var match *v1alpha1.TimezonePolicy
+	for _, object := range objects {
+		u, ok := object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		policy := &v1alpha1.TimezonePolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, policy); err != nil {
+			warningLogger.Printf("ignoring invalid timezone policy %s: %v", u.GetName(), err)
+			continue
+		}
+
+		selected, err := selectsPod(policy, namespace, pod)
+		if err != nil {
+			warningLogger.Printf("ignoring invalid timezone policy %s: %v", policy.Name, err)
+			continue
+		} else if !selected {
+			continue
+		}
+
+		if match == nil || policy.Spec.Priority > match.Spec.Priority ||
+			(policy.Spec.Priority == match.Spec.Priority && policy.Name < match.Name) {
+			match = policy
+		}
+	}
+
+	if match != nil {
+		infoLogger.Printf("timezone policy %s selects pod (%s)", match.Name, formatObjectDetails(pod.ObjectMeta))
+	}
+
+	return match
+}
+
+// selectsPod returns true if the policy selects the pod in the namespace
+func selectsPod(policy *v1alpha1.TimezonePolicy, namespace *corev1.Namespace, pod *corev1.Pod) (bool, error) {
+	for _, excluded := range policy.Spec.ExcludedNamespaces {
+		if excluded == namespace.Name {
+			return false, nil
+		}
+	}
+
+	if selected, err := selectsLabels(policy.Spec.NamespaceSelector, namespace.Labels); err != nil || !selected {
+		return false, err
+	}
+
+	return selectsLabels(policy.Spec.PodSelector, pod.Labels)
+}
+
+// selectsLabels returns true if the selector matches the labels, a nil
+// selector matches everything
+func selectsLabels(selector *metav1.LabelSelector, set map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+
+	return s.Matches(labels.Set(set)), nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/apis/v1alpha1"
+	"github.com/k8tz/k8tz/pkg/inject"
+)
+
+// Level is a source of the settings of an object. The settings are resolved
+// from the first level that sets them, in this order:
+//
+//	pod annotation > controller annotation > namespace annotation > policy > default
+type Level string
+
+const (
+	// LevelPod is the annotation of the object itself, the pod or the cronjob
+	LevelPod Level = "pod"
+	// LevelController is the annotation of the CronJob that owns the pod,
+	// it is only looked up with --resolve-cronjob-owners
+	LevelController Level = "controller"
+	// LevelNamespace is the annotation of the namespace of the object
+	LevelNamespace Level = "namespace"
+	// LevelPolicy is the TimezonePolicy that selects the pod
+	LevelPolicy Level = "policy"
+	// LevelDefault is the flag of the webhook
+	LevelDefault Level = "default"
+)
+
+// settings resolves the settings of an object along the precedence chain
+type settings struct {
+	kind      string
+	object    map[string]string
+	namespace map[string]string
+	policy    *v1alpha1.TimezonePolicy
+
+	// controller returns the annotations of the controller of the object, it
+	// is called at most once and only if the object does not set the setting
+	controller       func() (map[string]string, error)
+	controllerLoaded bool
+	controllerValues map[string]string
+}
+
+// lookup returns the first annotation level that find resolves the setting
+// from, false is returned if no annotation sets it
+func (s *settings) lookup(find func(annotations map[string]string) (string, bool)) (string, Level, bool, error) {
+	if v, ok := find(s.object); ok {
+		return v, LevelPod, true, nil
+	}
+
+	if s.controller != nil {
+		if !s.controllerLoaded {
+			values, err := s.controller()
+			if err != nil {
+				return "", "", false, err
+			}
+
+			s.controllerValues, s.controllerLoaded = values, true
+		}
+
+		if v, ok := find(s.controllerValues); ok {
+			return v, LevelController, true, nil
+		}
+	}
+
+	if v, ok := find(s.namespace); ok {
+		return v, LevelNamespace, true, nil
+	}
+
+	return "", "", false, nil
+}
+
+// annotation returns the value of the annotation from the first level that
+// sets it
+func (s *settings) annotation(key string) (string, Level, bool, error) {
+	return s.lookup(func(annotations map[string]string) (string, bool) {
+		v, ok := annotations[key]
+		return v, ok
+	})
+}
+
+// injection returns whether the object is injected and the level that decided
+// it. On each annotation level k8tz.io/injection ("enabled" or "disabled")
+// takes precedence over k8tz.io/inject, which only disables with "false".
+func (s *settings) injection(byDefault bool) (bool, Level, error) {
+	v, level, ok, err := s.lookup(injectionAnnotation)
+	if err != nil {
+		return false, "", err
+	}
+
+	if ok {
+		switch v {
+		case k8tz.InjectionEnabled:
+			return true, level, nil
+		case k8tz.InjectionDisabled:
+			return false, level, nil
+		default:
+			return false, level, withReason(ReasonInvalidObject, "invalid %s %s: %q, must be %s or %s", k8tz.InjectionAnnotation, s.describe(level), v, k8tz.InjectionEnabled, k8tz.InjectionDisabled)
+		}
+	}
+
+	if s.policy != nil && s.policy.Spec.Inject != nil {
+		return *s.policy.Spec.Inject, LevelPolicy, nil
+	}
+
+	return byDefault, LevelDefault, nil
+}
+
+// injectionAnnotation returns the injection of the annotations as
+// k8tz.io/injection values
+func injectionAnnotation(annotations map[string]string) (string, bool) {
+	if v, ok := annotations[k8tz.InjectionAnnotation]; ok {
+		return v, true
+	}
+
+	if v, ok := annotations[k8tz.InjectAnnotation]; ok {
+		if v == "false" {
+			return k8tz.InjectionDisabled, true
+		}
+
+		return k8tz.InjectionEnabled, true
+	}
+
+	return "", false
+}
+
+// timezone returns the requested timezone and its level
+func (s *settings) timezone(defaultTimezone string) (string, Level, error) {
+	v, level, ok, err := s.annotation(k8tz.TimezoneAnnotation)
+	if err != nil || ok {
+		return v, level, err
+	}
+
+	if s.policy != nil && s.policy.Spec.Timezone != "" {
+		return s.policy.Spec.Timezone, LevelPolicy, nil
+	}
+
+	return defaultTimezone, LevelDefault, nil
+}
+
+// strategy returns the requested injection strategy and its level
+func (s *settings) strategy(defaultStrategy inject.InjectionStrategy) (inject.InjectionStrategy, Level, error) {
+	v, level, ok, err := s.annotation(k8tz.InjectionStrategyAnnotation)
+	if err != nil || ok {
+		return inject.InjectionStrategy(v), level, err
+	}
+
+	if s.policy != nil && s.policy.Spec.Strategy != "" {
+		return s.policy.Spec.Strategy, LevelPolicy, nil
+	}
+
+	return defaultStrategy, LevelDefault, nil
+}
+
+// describe returns where the setting of the level comes from, for the log
+// messages
+func (s *settings) describe(level Level) string {
+	switch level {
+	case LevelPod:
+		return fmt.Sprintf("annotation on %s", s.kind)
+	case LevelController:
+		return "annotation on its cronjob"
+	case LevelNamespace:
+		return "annotation on namespace"
+	case LevelPolicy:
+		return fmt.Sprintf("timezone policy %s", s.policy.Name)
+	}
+
+	return "webhook default"
+}
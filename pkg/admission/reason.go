@@ -0,0 +1,157 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+)
+
+// Reason is a bounded identifier of why a request was skipped or rejected. It
+// is safe to be used as a metric label, details belong to the logs.
+type Reason string
+
+const (
+	ReasonUnsupportedOperation Reason = "unsupported_operation"
+	ReasonUnsupportedKind      Reason = "unsupported_kind"
+	ReasonTemplateNotFound     Reason = "template_not_found"
+	ReasonExcludedNamespace    Reason = "excluded_namespace"
+	ReasonExcludedObject       Reason = "excluded_object"
+	ReasonConflict             Reason = "conflict"
+	ReasonAlreadyInjected      Reason = "already_injected"
+	ReasonDisabled             Reason = "disabled"
+	ReasonInvalidObject        Reason = "invalid_object"
+	ReasonLookupFailed         Reason = "lookup_failed"
+	ReasonPodSecurity          Reason = "pod_security"
+	ReasonTimezoneDenied       Reason = "timezone_denied"
+	ReasonNoTimezone           Reason = "no_timezone"
+	ReasonInvalidTimezone      Reason = "invalid_timezone"
+	ReasonInvalidLocale        Reason = "invalid_locale"
+	ReasonRateLimited          Reason = "rate_limited"
+	ReasonCircuitOpen          Reason = "circuit_open"
+	ReasonInternal             Reason = "internal"
+)
+
+// Reasons is the complete list of reasons, any other value is counted as
+// ReasonInternal
+var Reasons = []Reason{
+	ReasonUnsupportedOperation,
+	ReasonUnsupportedKind,
+	ReasonTemplateNotFound,
+	ReasonExcludedNamespace,
+	ReasonExcludedObject,
+	ReasonConflict,
+	ReasonAlreadyInjected,
+	ReasonDisabled,
+	ReasonInvalidObject,
+	ReasonLookupFailed,
+	ReasonPodSecurity,
+	ReasonTimezoneDenied,
+	ReasonNoTimezone,
+	ReasonInvalidTimezone,
+	ReasonInvalidLocale,
+	ReasonRateLimited,
+	ReasonCircuitOpen,
+	ReasonInternal,
+}
+
+var (
+	skippedRequests  = newReasonCounter()
+	rejectedRequests = newReasonCounter()
+)
+
+// reasonCounter counts requests by reason, the set of keys is fixed to
+// Reasons so it can never grow
+type reasonCounter struct {
+	counts map[Reason]*uint64
+}
+
+func newReasonCounter() *reasonCounter {
+	c := &reasonCounter{counts: make(map[Reason]*uint64, len(Reasons))}
+	for _, r := range Reasons {
+		c.counts[r] = new(uint64)
+	}
+
+	return c
+}
+
+func (c *reasonCounter) inc(reason Reason) {
+	count, ok := c.counts[reason]
+	if !ok {
+		count = c.counts[ReasonInternal]
+	}
+
+	atomic.AddUint64(count, 1)
+}
+
+func (c *reasonCounter) snapshot() map[Reason]uint64 {
+	snapshot := make(map[Reason]uint64, len(c.counts))
+	for r, count := range c.counts {
+		snapshot[r] = atomic.LoadUint64(count)
+	}
+
+	return snapshot
+}
+
+// reasonError is an error that carries the reason of a rejection
+type reasonError struct {
+	reason Reason
+	err    error
+}
+
+func (e *reasonError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reasonError) Unwrap() error {
+	return e.err
+}
+
+func withReason(reason Reason, format string, args ...interface{}) error {
+	return &reasonError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+// reasonOf returns the reason of a rejection error, errors without an explicit
+// reason are considered internal
+func reasonOf(err error) Reason {
+	var re *reasonError
+	if errors.As(err, &re) {
+		return re.reason
+	}
+
+	var pe *inject.PodSecurityViolationError
+	if errors.As(err, &pe) {
+		return ReasonPodSecurity
+	}
+
+	return ReasonInternal
+}
+
+// skip logs why a request is skipped and counts it by its reason, the reason
+// is recorded for the event of the admission review
+func (h *RequestsHandler) skip(reason Reason, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	skippedRequests.inc(reason)
+	infoLogger.Printf("%s (reason=%s)", message, reason)
+	if h.state != nil {
+		h.state.skipReason = reason
+		h.state.skipMessage = message
+	}
+}
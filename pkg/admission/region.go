@@ -0,0 +1,199 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// legacyRegionLabel is the region label of kubernetes <1.17 nodes
+const legacyRegionLabel = "failure-domain.beta.kubernetes.io/region"
+
+//go:embed regions
+var regionsFile string
+
+// regionTimezones maps the regions of the cloud providers to their timezone
+var regionTimezones = func() map[string]string {
+	timezones := map[string]string{}
+	for _, line := range strings.Split(regionsFile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "#") {
+			timezones[fields[0]] = fields[1]
+		}
+	}
+
+	return timezones
+}()
+
+// autoTimezone resolves the auto timezone from the region of the nodes that
+// the pod can be scheduled on. The region is read from the node of
+// spec.nodeName or of the metadata.name node affinity of DaemonSet pods, and
+// otherwise from the region nodeSelector or required node affinity of the
+// pod. An empty timezone is returned if the region cannot be inferred.
+func (h *RequestsHandler) autoTimezone(spec *corev1.PodSpec) (string, error) {
+	regions, err := h.podRegions(spec)
+	if err != nil {
+		return "", err
+	}
+
+	timezones := map[string]bool{}
+	for _, region := range regions {
+		timezone, ok := h.RegionTimezones[region]
+		if !ok {
+			timezone, ok = regionTimezones[region]
+		}
+
+		if !ok {
+			return "", fmt.Errorf("no timezone is known for region %s, add it with --region-timezones", region)
+		}
+
+		timezones[timezone] = true
+	}
+
+	if len(timezones) > 1 {
+		names := make([]string, 0, len(timezones))
+		for timezone := range timezones {
+			names = append(names, timezone)
+		}
+
+		sort.Strings(names)
+		return "", fmt.Errorf("the regions %s have different timezones: %s", strings.Join(regions, ", "), strings.Join(names, ", "))
+	}
+
+	for timezone := range timezones {
+		return timezone, nil
+	}
+
+	return "", nil
+}
+
+// podRegions returns the regions that the pod can be scheduled in, sorted
+func (h *RequestsHandler) podRegions(spec *corev1.PodSpec) ([]string, error) {
+	nodes := nodeNames(spec)
+	regions := map[string]bool{}
+	for _, name := range nodes {
+		node, err := h.getNode(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup node %s: %w", name, err)
+		}
+
+		if region := nodeRegion(node.Labels); region != "" {
+			regions[region] = true
+		}
+	}
+
+	if len(nodes) == 0 {
+		if region := nodeRegion(spec.NodeSelector); region != "" {
+			regions[region] = true
+		}
+
+		for _, region := range affinityRegions(spec.Affinity) {
+			regions[region] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(regions))
+	for region := range regions {
+		sorted = append(sorted, region)
+	}
+
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// nodeNames returns the nodes that the pod is bound to, with spec.nodeName or
+// with the metadata.name node affinity that DaemonSets set on their pods
+func nodeNames(spec *corev1.PodSpec) []string {
+	if spec.NodeName != "" {
+		return []string{spec.NodeName}
+	}
+
+	var names []string
+	for _, term := range requiredNodeSelectorTerms(spec.Affinity) {
+		for _, field := range term.MatchFields {
+			if field.Key == metav1.ObjectNameField && field.Operator == corev1.NodeSelectorOpIn {
+				names = append(names, field.Values...)
+			}
+		}
+	}
+
+	return names
+}
+
+// affinityRegions returns the regions of the region In expressions of the
+// required node affinity of the pod
+func affinityRegions(affinity *corev1.Affinity) []string {
+	var regions []string
+	for _, term := range requiredNodeSelectorTerms(affinity) {
+		for _, expression := range term.MatchExpressions {
+			if (expression.Key == corev1.LabelTopologyRegion || expression.Key == legacyRegionLabel) &&
+				expression.Operator == corev1.NodeSelectorOpIn {
+				regions = append(regions, expression.Values...)
+			}
+		}
+	}
+
+	return regions
+}
+
+func requiredNodeSelectorTerms(affinity *corev1.Affinity) []corev1.NodeSelectorTerm {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return nil
+	}
+
+	return affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+}
+
+// nodeRegion returns the region of the labels, the legacy label is used if
+// the topology label is missing
+func nodeRegion(labels map[string]string) string {
+	if region, ok := labels[corev1.LabelTopologyRegion]; ok {
+		return region
+	}
+
+	return labels[legacyRegionLabel]
+}
+
+// resolveAutoTimezone returns the timezone of an object that requests the
+// auto timezone, the MissingTimezoneAction applies when its region cannot be
+// inferred
+func (h *RequestsHandler) resolveAutoTimezone(spec *corev1.PodSpec, kind string, details string) (string, error) {
+	if !h.AutoTimezone {
+		return "", withReason(ReasonInvalidTimezone, "%s (%s) requests the %s timezone which is disabled, enable it with --auto-timezone", kind, details, k8tz.AutoTimezone)
+	}
+
+	timezone, err := h.autoTimezone(spec)
+	if err == nil && timezone != "" {
+		infoLogger.Printf("timezone of %s (%s) inferred from its region: %s", kind, details, timezone)
+		return timezone, nil
+	}
+
+	if err == nil {
+		err = errors.New("it is neither bound to a node nor pinned to a region")
+	}
+
+	h.warn("cannot infer the timezone of %s (%s) from its region, %v", kind, details, err)
+	return h.missingTimezone(kind, details)
+}
@@ -0,0 +1,406 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// registrationManagedByLabel marks the webhook configurations that the
+	// webhook registered itself, other configurations are never changed
+	registrationManagedByLabel = "app.kubernetes.io/managed-by"
+	registrationManager        = "k8tz"
+	// registrationHashAnnotation is the hash of the registered configuration,
+	// the configuration is updated only when it changes
+	registrationHashAnnotation = "k8tz.io/registration-hash"
+
+	registrationWebhookName = "admission-controller.k8tz.io"
+)
+
+// Registration describes the MutatingWebhookConfiguration that the webhook
+// creates or updates on startup (--register-webhook), the rules and the
+// namespace and object selectors are derived from the handler so the
+// registration cannot drift from what the server handles
+type Registration struct {
+	Enabled             bool
+	Unregister          bool
+	Name                string
+	ServiceName         string
+	ServicePort         int32
+	CABundleFile        string
+	FailurePolicy       admissionregistrationv1.FailurePolicyType
+	TimeoutSeconds      int32
+	EphemeralContainers bool
+}
+
+func NewRegistration() Registration {
+	return Registration{
+		Enabled:             false,
+		Unregister:          false,
+		Name:                "k8tz",
+		ServiceName:         "k8tz",
+		ServicePort:         443,
+		CABundleFile:        "",
+		FailurePolicy:       admissionregistrationv1.Fail,
+		TimeoutSeconds:      0,
+		EphemeralContainers: true,
+	}
+}
+
+// validateRegistration returns an error if the registration cannot be
+// created with the configuration of the server
+func (h *Server) validateRegistration() error {
+	if !h.Registration.Enabled {
+		return nil
+	}
+
+	return h.validateWebhookConfiguration()
+}
+
+// validateWebhookConfiguration returns an error if the configuration of the
+// registration cannot be derived from the configuration of the server
+func (h *Server) validateWebhookConfiguration() error {
+	r := h.Registration
+	if !h.ServeMode.ServesWebhook() {
+		return fmt.Errorf("the webhook cannot be registered with --serve-mode=%s", h.ServeMode)
+	}
+
+	if r.Name == "" || r.ServiceName == "" {
+		return errors.New("the webhook registration requires a configuration name and a service name")
+	}
+
+	if h.Handler.InstallNamespace == "" {
+		return errors.New("the webhook registration requires the install namespace (--install-namespace)")
+	}
+
+	if r.FailurePolicy != admissionregistrationv1.Fail && r.FailurePolicy != admissionregistrationv1.Ignore {
+		return fmt.Errorf("unknown failure policy %q, expected %s or %s", r.FailurePolicy, admissionregistrationv1.Fail, admissionregistrationv1.Ignore)
+	}
+
+	if r.TimeoutSeconds < 0 || r.TimeoutSeconds > 30 {
+		return fmt.Errorf("invalid webhook timeout %d, expected 1 to 30 seconds or 0 for the api server default", r.TimeoutSeconds)
+	}
+
+	return nil
+}
+
+// webhookConfiguration returns the desired configuration, the caBundle is set
+// by register
+func (h *Server) webhookConfiguration() (*admissionregistrationv1.MutatingWebhookConfiguration, error) {
+	handler := h.Handler.configured()
+	none := admissionregistrationv1.SideEffectClassNone
+	failurePolicy := h.Registration.FailurePolicy
+	reinvocation := admissionregistrationv1.NeverReinvocationPolicy
+	if handler.Reinvocation {
+		reinvocation = admissionregistrationv1.IfNeededReinvocationPolicy
+	}
+
+	namespaceSelector, err := handler.registrationNamespaceSelector()
+	if err != nil {
+		return nil, err
+	}
+
+	objectSelector, err := metav1.ParseToLabelSelector(handler.ObjectSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object selector: %w", err)
+	}
+
+	webhook := admissionregistrationv1.MutatingWebhook{
+		Name: registrationWebhookName,
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Namespace: handler.InstallNamespace,
+				Name:      h.Registration.ServiceName,
+				Path:      stringPtr("/"),
+				Port:      &h.Registration.ServicePort,
+			},
+		},
+		Rules:                   handler.registrationRules(h.Registration.EphemeralContainers),
+		FailurePolicy:           &failurePolicy,
+		NamespaceSelector:       namespaceSelector,
+		ObjectSelector:          objectSelector,
+		SideEffects:             &none,
+		AdmissionReviewVersions: []string{"v1", "v1beta1"},
+		ReinvocationPolicy:      &reinvocation,
+	}
+
+	if h.Registration.TimeoutSeconds > 0 {
+		webhook.TimeoutSeconds = &h.Registration.TimeoutSeconds
+	}
+
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   h.Registration.Name,
+			Labels: map[string]string{registrationManagedByLabel: registrationManager},
+		},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{webhook},
+	}, nil
+}
+
+// registrationRules returns the resources the handler injects: pods (and their
+// ephemeral containers), cronjobs and the workloads with --inject-workloads
+func (h *RequestsHandler) registrationRules(ephemeralContainers bool) []admissionregistrationv1.RuleWithOperations {
+	rule := func(operation admissionregistrationv1.OperationType, group string, resources ...string) admissionregistrationv1.RuleWithOperations {
+		return admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{operation},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{group},
+				APIVersions: []string{"v1"},
+				Resources:   resources,
+			},
+		}
+	}
+
+	rules := []admissionregistrationv1.RuleWithOperations{rule(admissionregistrationv1.Create, "", "pods")}
+	if ephemeralContainers {
+		rules = append(rules, rule(admissionregistrationv1.Update, "", "pods/ephemeralcontainers"))
+	}
+
+	rules = append(rules, rule(admissionregistrationv1.Create, "batch", "cronjobs"))
+
+	if h.InjectWorkloads {
+		rules = append(rules,
+			rule(admissionregistrationv1.Create, "apps", "deployments", "statefulsets", "daemonsets", "replicasets"),
+			rule(admissionregistrationv1.Create, "batch", "jobs"))
+	}
+
+	return rules
+}
+
+// registrationNamespaceSelector returns the --namespace-selector with the
+// namespaces the handler never injects excluded, so the api server does not
+// call the webhook for them. Glob patterns of --exclude-namespaces cannot be
+// expressed in a label selector and are left to the handler.
+func (h *RequestsHandler) registrationNamespaceSelector() (*metav1.LabelSelector, error) {
+	selector, err := metav1.ParseToLabelSelector(h.NamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespace selector: %w", err)
+	}
+
+	selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      "k8tz.io/controller-namespace",
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{"true"},
+	})
+
+	var excluded []string
+	if h.ExcludeInstallNamespace && h.InstallNamespace != "" {
+		excluded = append(excluded, h.InstallNamespace)
+	}
+
+	for _, pattern := range h.ExcludedNamespaces {
+		if !hasGlobMeta(pattern) {
+			excluded = append(excluded, pattern)
+		}
+	}
+
+	if len(excluded) > 0 {
+		selector.MatchExpressions = append(selector.MatchExpressions, metav1.LabelSelectorRequirement{
+			Key:      "kubernetes.io/metadata.name",
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   excluded,
+		})
+	}
+
+	return selector, nil
+}
+
+// register creates the webhook configuration, or updates it when the
+// configuration of the server changed since it was registered. Replicas that
+// start together register the same configuration, and retry when another one
+// was faster.
+func (h *Server) register(ctx context.Context) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return k8serrors.IsConflict(err) || k8serrors.IsAlreadyExists(err)
+	}, func() error {
+		return h.applyRegistration(ctx)
+	})
+}
+
+// applyRegistration creates or updates the webhook configuration once. The
+// caBundle is read from --webhook-ca-bundle, kept from the registered
+// configuration (e.g. injected by cert-manager or k8tz certgen) or taken from
+// the serving certificate if it is self-signed.
+func (h *Server) applyRegistration(ctx context.Context) error {
+	desired, err := h.webhookConfiguration()
+	if err != nil {
+		return err
+	}
+
+	configurations := h.Handler.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	current, err := configurations.Get(ctx, desired.Name, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get mutating webhook configuration %s: %w", desired.Name, err)
+	}
+
+	exists := err == nil
+	if !exists {
+		current = nil
+	} else if current.Labels[registrationManagedByLabel] != registrationManager {
+		return fmt.Errorf("mutating webhook configuration %s is not managed by k8tz (%s=%s), remove it or use another --webhook-configuration-name",
+			desired.Name, registrationManagedByLabel, current.Labels[registrationManagedByLabel])
+	}
+
+	hash, err := registrationHash(desired)
+	if err != nil {
+		return err
+	}
+
+	caBundle, err := h.registrationCABundle(current)
+	if err != nil {
+		return err
+	}
+	desired.Webhooks[0].ClientConfig.CABundle = caBundle
+	desired.Annotations = map[string]string{registrationHashAnnotation: hash}
+
+	if !exists {
+		if _, err := configurations.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create mutating webhook configuration %s: %w", desired.Name, err)
+		}
+
+		infoLogger.Printf("registered mutating webhook configuration %s", desired.Name)
+		return nil
+	}
+
+	if current.Annotations[registrationHashAnnotation] == hash && registeredCABundle(current, caBundle) {
+		infoLogger.Printf("mutating webhook configuration %s is up to date", desired.Name)
+		return nil
+	}
+
+	desired.ResourceVersion = current.ResourceVersion
+	for key, value := range current.Annotations {
+		if key != registrationHashAnnotation {
+			desired.Annotations[key] = value
+		}
+	}
+
+	if _, err := configurations.Update(ctx, desired, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update mutating webhook configuration %s: %w", desired.Name, err)
+	}
+
+	infoLogger.Printf("updated mutating webhook configuration %s", desired.Name)
+	return nil
+}
+
+// registrationCABundle returns the CA bundle of the registered configuration
+func (h *Server) registrationCABundle(current *admissionregistrationv1.MutatingWebhookConfiguration) ([]byte, error) {
+	if h.Registration.CABundleFile != "" {
+		caBundle, err := os.ReadFile(h.Registration.CABundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook ca bundle: %w", err)
+		}
+
+		return caBundle, nil
+	}
+
+	if current != nil {
+		for _, webhook := range current.Webhooks {
+			if len(webhook.ClientConfig.CABundle) > 0 {
+				return webhook.ClientConfig.CABundle, nil
+			}
+		}
+	}
+
+	caBundle, err := os.ReadFile(h.TLSCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the serving certificate as webhook ca bundle: %w", err)
+	}
+
+	return caBundle, nil
+}
+
+// unregister deletes the webhook configuration if the webhook registered it,
+// e.g. from a pre-delete hook when k8tz is uninstalled
+func (h *Server) unregister(ctx context.Context) error {
+	name := h.Registration.Name
+	configurations := h.Handler.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	current, err := configurations.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		infoLogger.Printf("mutating webhook configuration %s is not registered", name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration %s: %w", name, err)
+	}
+
+	if current.Labels[registrationManagedByLabel] != registrationManager {
+		return fmt.Errorf("mutating webhook configuration %s is not managed by k8tz, it is not removed", name)
+	}
+
+	err = configurations.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &current.UID},
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete mutating webhook configuration %s: %w", name, err)
+	}
+
+	infoLogger.Printf("removed mutating webhook configuration %s", name)
+	return nil
+}
+
+// registeredCABundle returns true if all the webhooks of the configuration
+// trust the CA bundle
+func registeredCABundle(configuration *admissionregistrationv1.MutatingWebhookConfiguration, caBundle []byte) bool {
+	for _, webhook := range configuration.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, caBundle) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// registrationHash returns the sha256 of the desired configuration without
+// its caBundle, which can be injected by other controllers
+func registrationHash(configuration *admissionregistrationv1.MutatingWebhookConfiguration) (string, error) {
+	data, err := json.Marshal(configuration.Webhooks)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal mutating webhook configuration: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// hasGlobMeta returns true if the pattern has special characters of
+// path.Match
+func hasGlobMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,334 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EventTimezoneReinjected is the reason of the event that is emitted on a
+// workload whose pod template is re-injected, when EmitEvents is enabled
+const EventTimezoneReinjected = "TimezoneReinjected"
+
+// reinjectTimeout bounds the update of a single re-injected workload
+const reinjectTimeout = 10 * time.Second
+
+// startReinjection starts informers of the Deployments, StatefulSets and
+// CronJobs that re-inject the opted in workloads when they change, and every
+// ReinjectInterval so changes of the namespaces, policies and defaults are
+// applied as well. It runs until stop is closed.
+func (h *RequestsHandler) startReinjection(stop <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(h.clientset, h.ReinjectInterval)
+	workloads := []cache.SharedIndexInformer{
+		factory.Apps().V1().Deployments().Informer(),
+		factory.Apps().V1().StatefulSets().Informer(),
+	}
+
+	if !h.legacyCronJobs {
+		workloads = append(workloads, factory.Batch().V1().CronJobs().Informer())
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { h.reinject(obj) },
+		UpdateFunc: func(_, obj interface{}) { h.reinject(obj) },
+	}
+
+	synced := make([]cache.InformerSynced, 0, len(workloads))
+	for _, informer := range workloads {
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return err
+		}
+		synced = append(synced, informer.HasSynced)
+	}
+
+	factory.Start(stop)
+
+	timeout := make(chan struct{})
+	timer := time.AfterFunc(cacheSyncTimeout, func() { close(timeout) })
+	defer timer.Stop()
+
+	if !cache.WaitForCacheSync(timeout, synced...) {
+		return fmt.Errorf("workloads were not synced within %s", cacheSyncTimeout)
+	}
+
+	infoLogger.Printf("re-injecting workloads every %s", h.ReinjectInterval)
+	return nil
+}
+
+// reinject updates the workload if its injection is not up to date, failures
+// are logged and retried on the next resync
+func (h *RequestsHandler) reinject(obj interface{}) {
+	object, ok := obj.(runtime.Object)
+	if !ok {
+		return
+	}
+
+	handler := h.configured()
+	desired, err := handler.reinjected(object)
+	if err != nil {
+		warningLogger.Printf("failed to re-inject %s: %v", workloadDetails(object), err)
+		return
+	} else if desired == nil {
+		return
+	}
+
+	if h.DryRun {
+		infoLogger.Printf("dry run: %s would be re-injected", workloadDetails(object))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reinjectTimeout)
+	defer cancel()
+
+	if err = h.updateWorkload(ctx, desired); err != nil {
+		warningLogger.Printf("failed to update re-injected %s: %v", workloadDetails(object), err)
+		return
+	}
+
+	infoLogger.Printf("%s re-injected", workloadDetails(object))
+	if h.EmitEvents {
+		h.emitEvent(reinjectEvent(desired))
+	}
+}
+
+// reinjected returns the workload with its injection removed and generated
+// again with the current settings, nil is returned if the workload is not
+// opted in, its pod template is not injected or the injection is up to date.
+// Workloads that are opted in by a TimezonePolicy ignore the timezone
+// annotation that the injection wrote, so the policy timezone is applied.
+func (h *RequestsHandler) reinjected(object runtime.Object) (runtime.Object, error) {
+	meta, template := reinjectTemplate(object)
+	if meta == nil || !isInjected(meta) {
+		return nil, nil
+	}
+
+	optedIn, byPolicy, err := h.reinjectOptIn(meta, template)
+	if err != nil || !optedIn {
+		return nil, err
+	}
+
+	stripped := object.DeepCopyObject()
+	meta, template = reinjectTemplate(stripped)
+	if isInjected(&template.ObjectMeta) {
+		remover := inject.PatchGenerator{ExtraEnv: h.ExtraEnv}
+		remover.RemoveInjection(&template.Spec)
+	} else if cronJob, ok := stripped.(*batchv1.CronJob); ok && h.cronJobMode() == inject.NativeCronJobMode {
+		cronJob.Spec.TimeZone = nil
+	}
+
+	if cronJob, ok := stripped.(*batchv1.CronJob); ok {
+		if schedule, ok := cronJob.Annotations[k8tz.ScheduleAnnotation]; ok {
+			cronJob.Spec.Schedule = schedule
+			delete(cronJob.Annotations, k8tz.ScheduleAnnotation)
+		}
+	}
+
+	for _, m := range []*metav1.ObjectMeta{meta, &template.ObjectMeta} {
+		delete(m.Annotations, k8tz.InjectedAnnotation)
+		delete(m.Annotations, k8tz.OffsetAnnotation)
+		delete(m.Annotations, k8tz.AbbreviationAnnotation)
+		if byPolicy {
+			delete(m.Annotations, k8tz.TimezoneAnnotation)
+		}
+	}
+
+	var generator *inject.PatchGenerator
+	if cronJob, ok := stripped.(*batchv1.CronJob); ok {
+		generator, err = h.lookupCronJob(meta.Namespace, cronJob)
+	} else {
+		generator, err = h.lookupPod(meta.Namespace, templatePod(meta, template))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	desired := stripped
+	if generator != nil {
+		patches, err := generator.Generate(stripped, "")
+		if err != nil {
+			return nil, err
+		}
+
+		if desired, err = applyPatches(stripped, patches); err != nil {
+			return nil, err
+		}
+	}
+
+	if apiequality.Semantic.DeepEqual(object, desired) {
+		return nil, nil
+	}
+
+	return desired, nil
+}
+
+// reinjectOptIn returns true if the workload is opted in to re-injection by
+// the k8tz.io/reinject annotation of the workload or its pod template, or
+// otherwise by the TimezonePolicy that selects its pods
+func (h *RequestsHandler) reinjectOptIn(meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec) (optedIn bool, byPolicy bool, err error) {
+	pod := templatePod(meta, template)
+	if v, ok := pod.Annotations[k8tz.ReinjectAnnotation]; ok {
+		optedIn, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, false, fmt.Errorf("invalid %s annotation value %q: %w", k8tz.ReinjectAnnotation, v, err)
+		}
+
+		return optedIn, false, nil
+	}
+
+	if h.policies == nil {
+		return false, false, nil
+	}
+
+	namespace, err := h.getNamespace(meta.Namespace)
+	if err != nil {
+		return false, false, err
+	}
+
+	policy := h.matchingTimezonePolicy(namespace, pod)
+	return policy != nil && policy.Spec.Reinject, true, nil
+}
+
+// reinjectTemplate returns the metadata and the pod template of the workloads
+// that can be re-injected
+func reinjectTemplate(object interface{}) (*metav1.ObjectMeta, *corev1.PodTemplateSpec) {
+	switch o := object.(type) {
+	case *appsv1.Deployment, *appsv1.StatefulSet:
+		return podTemplate(o)
+	case *batchv1.CronJob:
+		return &o.ObjectMeta, &o.Spec.JobTemplate.Spec.Template
+	}
+
+	return nil, nil
+}
+
+func isInjected(meta *metav1.ObjectMeta) bool {
+	injected, _ := strconv.ParseBool(meta.Annotations[k8tz.InjectedAnnotation])
+	return injected
+}
+
+// applyPatches returns a copy of the object with the patches applied
+func applyPatches(object runtime.Object, patches k8tz.Patches) (runtime.Object, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	patchJSON, err := json.Marshal(patches)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err = patch.Apply(data); err != nil {
+		return nil, fmt.Errorf("failed to apply patches: %w", err)
+	}
+
+	patched := reflect.New(reflect.TypeOf(object).Elem()).Interface().(runtime.Object)
+	return patched, json.Unmarshal(data, patched)
+}
+
+// updateWorkload updates the workload, the change of its pod template rolls
+// out its pods
+func (h *RequestsHandler) updateWorkload(ctx context.Context, object runtime.Object) (err error) {
+	switch o := object.(type) {
+	case *appsv1.Deployment:
+		_, err = h.clientset.AppsV1().Deployments(o.Namespace).Update(ctx, o, metav1.UpdateOptions{})
+	case *appsv1.StatefulSet:
+		_, err = h.clientset.AppsV1().StatefulSets(o.Namespace).Update(ctx, o, metav1.UpdateOptions{})
+	case *batchv1.CronJob:
+		_, err = h.clientset.BatchV1().CronJobs(o.Namespace).Update(ctx, o, metav1.UpdateOptions{})
+	default:
+		err = fmt.Errorf("unsupported workload: %T", object)
+	}
+
+	return err
+}
+
+// workloadKind returns the kind and the api version of the workload, the
+// objects of informers have no TypeMeta
+func workloadKind(object runtime.Object) (string, string) {
+	switch object.(type) {
+	case *appsv1.Deployment:
+		return "Deployment", appsv1.SchemeGroupVersion.String()
+	case *appsv1.StatefulSet:
+		return "StatefulSet", appsv1.SchemeGroupVersion.String()
+	case *batchv1.CronJob:
+		return "CronJob", batchv1.SchemeGroupVersion.String()
+	}
+
+	return fmt.Sprintf("%T", object), ""
+}
+
+func workloadDetails(object runtime.Object) string {
+	kind, _ := workloadKind(object)
+	meta, _ := reinjectTemplate(object)
+	if meta == nil {
+		return kind
+	}
+
+	return fmt.Sprintf("%s (%s)", kind, formatObjectDetails(*meta))
+}
+
+// reinjectEvent returns the event of a re-injected workload
+func reinjectEvent(object runtime.Object) *corev1.Event {
+	meta, _ := reinjectTemplate(object)
+	kind, apiVersion := workloadKind(object)
+
+	now := metav1.Now()
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: meta.Name + ".",
+			Namespace:    meta.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  meta.Namespace,
+			Name:       meta.Name,
+			UID:        meta.UID,
+		},
+		Reason:         EventTimezoneReinjected,
+		Message:        fmt.Sprintf("pod template re-injected with timezone %s", meta.Annotations[k8tz.TimezoneAnnotation]),
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+}
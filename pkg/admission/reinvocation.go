@@ -0,0 +1,89 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reinvokePod injects the containers that other mutating webhooks (e.g. the
+// istio or vault agent injectors) add to a pod after k8tz injected it, when
+// the webhook is re-invoked with reinvocationPolicy IfNeeded. The volume, the
+// bootstrap container and the TZ variables of the first invocation are kept
+// as is, so the patches of the first invocation are never duplicated.
+func (h *RequestsHandler) reinvokePod(namespace string, pod *corev1.Pod) (k8tz.Patches, error) {
+	// the injected annotation is removed to resolve the pod like on the first
+	// invocation, the timezone is still taken from its annotation
+	resolved := pod.DeepCopy()
+	delete(resolved.Annotations, k8tz.InjectedAnnotation)
+
+	generator, _, err := h.resolvePod(namespace, resolved)
+	if err != nil || generator == nil {
+		return nil, err
+	}
+
+	generator.ConflictPolicy = inject.ConflictMerge
+	generator.Strategy = injectedStrategy(&pod.Spec, generator.Strategy)
+
+	h.verbosef("Generating patches for re-invoked pod (%s) using generator: %+v", formatObjectDetails(pod.ObjectMeta), *generator)
+	h.recordInjection(generator)
+	done := h.startGeneration()
+	patches, err := generator.Generate(pod, "")
+	done(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate patches for re-invoked pod, error=%w", err)
+	}
+
+	if len(patches) == 0 {
+		h.skip(ReasonAlreadyInjected, "skipping pod (%s) because its already injected", formatObjectDetails(pod.ObjectMeta))
+		return nil, nil
+	}
+
+	infoLogger.Printf("%d patches generated for containers added to re-invoked pod (%s), timezone=%s, strategy=%s", len(patches), formatObjectDetails(pod.ObjectMeta), generator.Timezone, generator.Strategy)
+	return patches, nil
+}
+
+// injectedStrategy returns the strategy that the pod was injected with, from
+// the source of its k8tz volume, or the strategy if the pod has no volume
+func injectedStrategy(spec *corev1.PodSpec, strategy inject.InjectionStrategy) inject.InjectionStrategy {
+	for _, v := range spec.Volumes {
+		if v.Name != inject.VolumeName {
+			continue
+		}
+
+		switch {
+		case v.HostPath != nil:
+			return inject.HostPathInjectionStrategy
+		case v.CSI != nil:
+			return inject.CSIInjectionStrategy
+		case v.VolumeSource == (corev1.VolumeSource{}):
+			// the image source is missing from the API types
+			return inject.ImageVolumeInjectionStrategy
+		}
+
+		switch strategy {
+		case inject.HostPathInjectionStrategy, inject.CSIInjectionStrategy, inject.ImageVolumeInjectionStrategy:
+			return inject.InitContainerInjectionStrategy
+		}
+	}
+
+	return strategy
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/k8tz/k8tz/pkg/report"
+)
+
+var reportContentTypes = map[string]string{
+	report.JSONOutput:  jsonContentType,
+	report.CSVOutput:   "text/csv",
+	report.TableOutput: "text/plain; charset=utf-8",
+}
+
+// report serves the timezone inventory of the pods in the cluster, the
+// 'namespace' query parameter limits it to a single namespace and the 'format'
+// query parameter is one of json (default), csv or table
+func (h *Server) report(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = report.JSONOutput
+	}
+
+	contentType, ok := reportContentTypes[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q, expected one of: %s", format, strings.Join(report.Formats, ", ")), http.StatusBadRequest)
+		return
+	}
+
+	inventory, err := report.Build(r.Context(), h.Handler.clientset, r.URL.Query().Get("namespace"), h.Handler.TzdataVersion)
+	if err != nil {
+		errorLogger.Printf("failed to build report: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if err := inventory.Write(format, w); err != nil {
+		errorLogger.Printf("failed to write report: %v", err)
+	}
+}
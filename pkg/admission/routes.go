@@ -0,0 +1,204 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MutatePodsPath serves the pods and their ephemeral containers
+	MutatePodsPath = "/mutate/v1/pods"
+	// MutateCronJobsPath serves the cronjobs
+	MutateCronJobsPath = "/mutate/v1/cronjobs"
+	// MutateWorkloadsPath serves the deployments, statefulsets, daemonsets,
+	// replicasets and jobs
+	MutateWorkloadsPath = "/mutate/v1/workloads"
+	// ValidatePodsPath validates the pods
+	ValidatePodsPath = "/validate/v1/pods"
+	// ValidateCronJobsPath validates the cronjobs
+	ValidateCronJobsPath = "/validate/v1/cronjobs"
+
+	// unknownRoute is the route label of the requests to unknown paths
+	unknownRoute = "unknown"
+)
+
+var routeRequests sync.Map // routeKey -> *uint64
+
+// routeKey identifies the per-route request counters
+type routeKey struct {
+	route string
+	code  int
+}
+
+// route is a webhook endpoint, the reviews of resources it does not serve are
+// allowed without patches. A route without resources serves all of them, so
+// a separate webhook configuration (e.g. with its own timeout and failure
+// policy) can target each versioned path.
+type route struct {
+	path      string
+	validate  bool
+	resources []metav1.GroupVersionResource
+}
+
+// routes are the webhook endpoints, "/" and "/validate" serve all the
+// resources as they did before the versioned paths were added
+var routes = []route{
+	{path: "/"},
+	{path: "/validate", validate: true},
+	{path: MutatePodsPath, resources: []metav1.GroupVersionResource{podResource}},
+	{path: MutateCronJobsPath, resources: []metav1.GroupVersionResource{cronJobResource}},
+	{path: MutateWorkloadsPath, resources: []metav1.GroupVersionResource{deploymentResource, statefulSetResource, daemonSetResource, replicaSetResource, jobResource}},
+	{path: ValidatePodsPath, validate: true, resources: []metav1.GroupVersionResource{podResource}},
+	{path: ValidateCronJobsPath, validate: true, resources: []metav1.GroupVersionResource{cronJobResource}},
+}
+
+// registerRoutes adds the webhook endpoints to the mux, requests to any other
+// path are answered with 404
+func (h *RequestsHandler) registerRoutes(mux *http.ServeMux) {
+	for i := range routes {
+		r := &routes[i]
+		handler := h.handleFunc
+		if r.validate {
+			handler = h.validateFunc
+		}
+
+		counted := countRoute(r.path, withRoute(r, handler))
+		if r.path != "/" {
+			mux.HandleFunc(r.path, counted)
+			continue
+		}
+
+		// the "/" pattern of the mux matches every path
+		notFound := countRoute(unknownRoute, http.NotFound)
+		mux.HandleFunc(r.path, func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/" {
+				notFound(w, req)
+				return
+			}
+
+			counted(w, req)
+		})
+	}
+}
+
+type routeContextKey struct{}
+
+// withRoute keeps the route in the context of the request
+func withRoute(r *route, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		next(w, req.WithContext(context.WithValue(req.Context(), routeContextKey{}, r)))
+	}
+}
+
+// serves returns true if the route handles reviews of the resource
+func (r *route) serves(resource metav1.GroupVersionResource) bool {
+	if r.resources == nil {
+		return true
+	}
+
+	for _, res := range r.resources {
+		if res == resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+// misrouted answers the review with an allowed response without patches if
+// the route of the request does not serve its resource, which means that the
+// webhook rules send it to the wrong path
+func misrouted(w http.ResponseWriter, r *http.Request, review *admission.AdmissionReview) bool {
+	route, ok := r.Context().Value(routeContextKey{}).(*route)
+	if !ok || route.serves(review.Request.Resource) {
+		return false
+	}
+
+	skippedRequests.inc(ReasonUnsupportedKind)
+	warningLogger.Printf("ignoring %s (kind=%s) sent to %s, check the webhook rules", review.Request.Resource.Resource, review.Request.Kind.Kind, route.path)
+
+	bytes, err := json.Marshal(admission.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: &admission.AdmissionResponse{UID: review.Request.UID, Allowed: true},
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal response review: %s", err.Error()), http.StatusInternalServerError)
+		return true
+	}
+
+	if _, err := w.Write(bytes); err != nil {
+		errorLogger.Printf("failed to write response to output http stream: %v\n", err)
+	}
+
+	return true
+}
+
+// countRoute counts the requests of the route by response status code
+func countRoute(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(recorder, r)
+
+		count, _ := routeRequests.LoadOrStore(routeKey{route: route, code: recorder.code}, new(uint64))
+		atomic.AddUint64(count.(*uint64), 1)
+	}
+}
+
+// statusRecorder keeps the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap returns the recorded response writer, so an http.ResponseController
+// can flush it and change its deadlines
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// writeRouteRequests writes the k8tz_route_requests_total lines sorted by
+// route and code
+func writeRouteRequests(w io.Writer) {
+	fmt.Fprintln(w, "# HELP k8tz_route_requests_total Total number of requests to the webhook endpoints, by route and status code.")
+	fmt.Fprintln(w, "# TYPE k8tz_route_requests_total counter")
+	var lines []string
+	routeRequests.Range(func(key, count interface{}) bool {
+		k := key.(routeKey)
+		lines = append(lines, fmt.Sprintf("k8tz_route_requests_total{route=%q,code=\"%d\"} %d", k.route, k.code, atomic.LoadUint64(count.(*uint64))))
+		return true
+	})
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// rewriteSchedule makes the generator rewrite the schedule of the CronJob
+// from its timezone to UTC, for clusters without spec.timeZone. The schedule
+// is kept in UTC with a warning when it cannot be rewritten, and a warning
+// tells that the rewritten schedule drifts when the timezone changes its
+// offset.
+func (h *RequestsHandler) rewriteSchedule(generator *inject.PatchGenerator, cronJob *batchv1.CronJob) {
+	schedule, err := generator.UTCSchedule(cronJob.Spec.Schedule)
+	if err != nil {
+		h.warn("schedule %q of cronJob (%s) is not rewritten to %s and runs in UTC: %v", cronJob.Spec.Schedule, formatObjectDetails(cronJob.ObjectMeta), generator.Timezone, err)
+		return
+	}
+
+	generator.RewriteSchedule = true
+	if schedule == cronJob.Spec.Schedule {
+		return
+	}
+
+	transition, err := inject.NextTransition(h.ZoneInfoPath, generator.Timezone, time.Now(), dstHorizon)
+	if err != nil || transition == nil {
+		infoLogger.Printf("schedule %q of cronJob (%s) in %s is rewritten to %q in UTC", cronJob.Spec.Schedule, formatObjectDetails(cronJob.ObjectMeta), generator.Timezone, schedule)
+		return
+	}
+
+	h.warn("schedule %q of cronJob (%s) in %s is rewritten to %q in UTC with the current offset, it is off by %s after %s until the cronJob is injected again",
+		cronJob.Spec.Schedule, formatObjectDetails(cronJob.ObjectMeta), generator.Timezone, schedule,
+		time.Duration(abs(transition.OffsetAfter-transition.OffsetBefore))*time.Second, transition.At.Format(time.RFC3339))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// objectSelectors are the compiled NamespaceSelector, ObjectSelector and
+// ExcludeNames of the handler
+type objectSelectors struct {
+	namespaces labels.Selector
+	objects    labels.Selector
+	names      *regexp.Regexp
+}
+
+// CompileSelectors validates and compiles the selectors of the handler, the
+// selectors of a handler that is not compiled are compiled on every request
+func (h *RequestsHandler) CompileSelectors() error {
+	selectors, err := h.compileSelectors()
+	if err != nil {
+		return err
+	}
+
+	h.selectors = selectors
+	return nil
+}
+
+func (h *RequestsHandler) compileSelectors() (*objectSelectors, error) {
+	selectors := &objectSelectors{namespaces: labels.Everything(), objects: labels.Everything()}
+	for _, pattern := range h.ExcludedNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid excluded namespace pattern %q: %w", pattern, err)
+		}
+	}
+
+	var err error
+	if h.NamespaceSelector != "" {
+		if selectors.namespaces, err = labels.Parse(h.NamespaceSelector); err != nil {
+			return nil, fmt.Errorf("invalid namespace selector %q: %w", h.NamespaceSelector, err)
+		}
+	}
+
+	if h.ObjectSelector != "" {
+		if selectors.objects, err = labels.Parse(h.ObjectSelector); err != nil {
+			return nil, fmt.Errorf("invalid object selector %q: %w", h.ObjectSelector, err)
+		}
+	}
+
+	if h.ExcludeNames != "" {
+		if selectors.names, err = regexp.Compile(h.ExcludeNames); err != nil {
+			return nil, fmt.Errorf("invalid excluded names expression %q: %w", h.ExcludeNames, err)
+		}
+	}
+
+	return selectors, nil
+}
+
+// isExcludedNamespace returns true if the objects of the namespace are never
+// injected, the excluded namespaces are names or glob patterns (e.g. "team-*")
+func (h *RequestsHandler) isExcludedNamespace(namespace string) bool {
+	if h.ExcludeInstallNamespace && h.InstallNamespace != "" && namespace == h.InstallNamespace {
+		return true
+	}
+
+	for _, pattern := range h.ExcludedNamespaces {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectObject returns the reason and the description of the rule that
+// excludes the object from injection, or an empty reason if the object is
+// selected by the NamespaceSelector, the ObjectSelector and the ExcludeNames
+// of the handler. Objects without a name are matched by their generateName.
+func (h *RequestsHandler) selectObject(namespace *corev1.Namespace, meta *metav1.ObjectMeta) (Reason, string, error) {
+	selectors := h.selectors
+	if selectors == nil {
+		var err error
+		if selectors, err = h.compileSelectors(); err != nil {
+			return "", "", err
+		}
+	}
+
+	if !selectors.namespaces.Matches(labels.Set(namespace.Labels)) {
+		return ReasonExcludedNamespace, fmt.Sprintf("its namespace does not match the namespace selector %q", h.NamespaceSelector), nil
+	}
+
+	if !selectors.objects.Matches(labels.Set(meta.Labels)) {
+		return ReasonExcludedObject, fmt.Sprintf("it does not match the object selector %q", h.ObjectSelector), nil
+	}
+
+	name := meta.Name
+	if name == "" {
+		name = meta.GenerateName
+	}
+
+	if selectors.names != nil && selectors.names.MatchString(name) {
+		return ReasonExcludedObject, fmt.Sprintf("its name matches the excluded names %q", h.ExcludeNames), nil
+	}
+
+	return "", "", nil
+}
@@ -17,14 +17,23 @@ limitations under the License.
 package admission
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/k8tz/k8tz/pkg/registry"
 	"github.com/k8tz/k8tz/pkg/version"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -32,7 +41,9 @@ import (
 )
 
 const (
-	jsonContentType = `application/json`
+	jsonContentType         = `application/json`
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	podNamespaceEnv         = "POD_NAMESPACE"
 )
 
 var (
@@ -40,32 +51,96 @@ var (
 	podResource     = metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
 	cronJobResource = metav1.GroupVersionResource{Version: "v1", Resource: "cronjobs", Group: "batch"}
 	verboseLogger   *log.Logger
+	debugLogger     *log.Logger
 	warningLogger   *log.Logger
 	infoLogger      *log.Logger
 	errorLogger     *log.Logger
+
+	// serviceAccountNamespaceFile is mounted by kubernetes with the namespace
+	// of the pod, it is used when the namespace is not passed via downward API
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 type Server struct {
-	TLSCertFile     string
-	TLSKeyFile      string
-	TLSCipherSuites []string
-	TLSMinVersion   string
-	Address         string
-	Handler         RequestsHandler
-	Verbose         bool
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSCipherSuites   []string
+	TLSMinVersion     string
+	TLSReloadInterval time.Duration
+	TLSReloadJitter   time.Duration
+	CryptoPolicy      CryptoPolicy
+	ClientCAFile      string
+	Addresses         []string
+	UnixSocket        string
+	ServeMode         ServeMode
+	Handler           RequestsHandler
+	Verbose           bool
+	ShutdownDelay     time.Duration
+	ShutdownTimeout   time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	HealthAddress     string
+	EnablePprof       bool
+	EnableReport      bool
+	Chaos             *Chaos
+	DebugAddress      string
+	LeaderElection    bool
+	LeaderElectionID  string
+	LeaseNamespace    string
+	LeaseDuration     time.Duration
+	RenewDeadline     time.Duration
+	RetryPeriod       time.Duration
+	Registration      Registration
+	ReusePort         bool
+	Handover          bool
+	draining          int32
+	handingOver       int32
+	inherited         map[string]net.Listener
+	listeners         []*trackedListener
+	certificate       *certificateLoader
 }
 
 func NewAdmissionServer() *Server {
 	return &Server{
-		TLSCertFile: "/run/secrets/tls/tls.crt",
-		TLSKeyFile:  "/run/secrets/tls/tls.key",
-		Address:     ":8443",
-		Handler:     NewRequestsHandler(),
-		Verbose:     false,
+		TLSCertFile:       "/run/secrets/tls/tls.crt",
+		TLSKeyFile:        "/run/secrets/tls/tls.key",
+		TLSMinVersion:     "VersionTLS12",
+		TLSReloadInterval: time.Minute,
+		TLSReloadJitter:   10 * time.Second,
+		CryptoPolicy:      DefaultCryptoPolicy,
+		ClientCAFile:      "",
+		Addresses:         []string{":8443"},
+		UnixSocket:        "",
+		ServeMode:         ServeModeWebhook,
+		Handler:           NewRequestsHandler(),
+		Verbose:           false,
+		ShutdownDelay:     5 * time.Second,
+		ShutdownTimeout:   20 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		HealthAddress:     "",
+		EnablePprof:       false,
+		EnableReport:      false,
+		Chaos:             nil,
+		DebugAddress:      DefaultDebugAddress,
+		LeaderElection:    false,
+		LeaderElectionID:  "k8tz-controllers",
+		LeaseNamespace:    "",
+		LeaseDuration:     15 * time.Second,
+		RenewDeadline:     10 * time.Second,
+		RetryPeriod:       2 * time.Second,
+		Registration:      NewRegistration(),
+		ReusePort:         false,
+		Handover:          false,
 	}
 }
 
 func (h *Server) health(w http.ResponseWriter, _ *http.Request) {
+	if h.isDraining() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -76,6 +151,15 @@ func (h *Server) Start(kubeconfigFlag string) error {
 		verboseLogger.SetOutput(os.Stderr)
 		verboseLogger.Printf("server=%+v", *h)
 	}
+
+	if h.Registration.Unregister {
+		if err := h.Handler.InitializeClientset(kubeconfigFlag); err != nil {
+			return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+		}
+
+		return h.unregister(context.Background())
+	}
+
 	minTLSVersion, err := cliflag.TLSVersion(h.TLSMinVersion)
 	if err != nil {
 		return err
@@ -85,38 +169,238 @@ func (h *Server) Start(kubeconfigFlag string) error {
 		return err
 	}
 
+	warnInsecureCipherSuites(h.TLSCipherSuites)
+
+	tlsConfig := &tls.Config{
+		CipherSuites: tlsCipherSuites,
+		MinVersion:   minTLSVersion,
+	}
+
+	if err = h.applyCryptoPolicy(tlsConfig); err != nil {
+		return err
+	}
+
+	if h.ClientCAFile != "" {
+		if err = requireClientCertificates(tlsConfig, h.ClientCAFile); err != nil {
+			return err
+		}
+	}
+
+	if err = h.ServeMode.Validate(); err != nil {
+		return err
+	}
+
+	if err = h.validateRegistration(); err != nil {
+		return err
+	}
+
+	if h.Handover && len(handoverSignals) == 0 {
+		return errors.New("listener handover is not supported on this platform")
+	}
+
+	if err = h.inheritListeners(); err != nil {
+		return err
+	}
+
+	if h.Chaos != nil {
+		if err = h.Chaos.validate(); err != nil {
+			return err
+		}
+		h.Handler.chaos = h.Chaos
+	}
+
+	if err = h.Handler.validate(); err != nil {
+		return err
+	}
+
+	h.Handler.limitConcurrency()
+	h.Handler.limitRate()
+	h.Handler.startCircuitBreaker()
+	if h.Handler.breaker != nil {
+		h.Handler.breaker.changed = h.updateReady
+	}
+
+	if err = h.Handler.pinBootstrapImages(registry.NewClient()); err != nil {
+		return err
+	}
+
+	if err = h.Handler.OpenAuditLog(); err != nil {
+		return err
+	}
+	defer h.Handler.CloseAuditLog()
+
+	shutdown, err := setupTracing(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to setup tracing: %w", err)
+	}
+	defer shutdownTracing(shutdown)
+
+	h.Handler.detectTzdataVersion()
+	if err = h.Handler.validateTzdataUpgrade(); err != nil {
+		return err
+	}
+
+	if h.Handler.ConfigFile != "" {
+		if err = h.Handler.reloadConfig(); err != nil {
+			return err
+		}
+		go h.Handler.watchConfig(nil)
+	}
+
+	if h.Handler.TimezonePolicyFile != "" {
+		if err = h.Handler.reloadTimezonePolicy(); err != nil {
+			return err
+		}
+		go h.Handler.watchTimezonePolicy(nil)
+	}
+
 	if err = h.Handler.InitializeClientset(kubeconfigFlag); err != nil {
 		return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
 	}
 
-	infoLogger.Printf("Listening on %s\n", h.Address)
+	h.Handler.startCaches(nil)
+	if err = h.Handler.waitForCaches(cacheSyncTimeout); err != nil {
+		warningLogger.Printf("%v, the webhook is not ready until they are synced", err)
+		go h.updateReadyOnCacheSync(nil)
+	}
+
+	controllers, stopControllers := context.WithCancel(context.Background())
+	defer stopControllers()
+
+	if err = h.startControllers(controllers); err != nil {
+		return err
+	}
+
+	h.certificate, err = newCertificateLoader(h.TLSCertFile, h.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	h.updateReady()
+
+	if h.TLSReloadInterval > 0 {
+		go h.certificate.watch(h.TLSReloadInterval, h.TLSReloadJitter, nil)
+	}
+
+	if h.HealthAddress != "" {
+		health := h.healthServer()
+		defer health.Close()
+
+		l, err := h.listenTCP(context.Background(), h.HealthAddress)
+		if err != nil {
+			return err
+		}
+
+		infoLogger.Printf("Serving health probes on %s\n", h.HealthAddress)
+		go func() {
+			if err := health.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				errorLogger.Printf("health probes server failed: %v", err)
+			}
+		}()
+	}
+
+	if h.EnablePprof || h.EnableReport || h.Chaos != nil && h.Chaos.Endpoint {
+		debug, err := h.debugServer()
+		if err != nil {
+			return err
+		}
+		defer debug.Close()
+
+		l, err := h.listenTCP(context.Background(), h.DebugAddress)
+		if err != nil {
+			return err
+		}
+
+		infoLogger.Printf("Serving debug endpoints on %s\n", h.DebugAddress)
+		go func() {
+			if err := debug.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				errorLogger.Printf("debug server failed: %v", err)
+			}
+		}()
+	}
 
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/", h.Handler.handleFunc)
+	if h.ServeMode.ServesWebhook() {
+		h.Handler.registerRoutes(mux)
+	}
+	if h.ServeMode.ServesGRPC() {
+		h.Handler.registerGRPC(mux)
+	}
 	mux.HandleFunc("/health", h.health)
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/statusz", h.statusz)
+	mux.HandleFunc("/capabilities", h.capabilities)
+	mux.HandleFunc("/explain", h.explain)
+	mux.HandleFunc("/zones", h.zones)
+	mux.HandleFunc("/metrics", h.metrics)
+
+	tlsConfig.GetCertificate = h.getCertificate
+	var handler http.Handler = mux
+	if h.ServeMode.ServesGRPC() {
+		// the unix socket is plaintext, gRPC clients use HTTP/2 without
+		// TLS (h2c) there
+		handler = h2c.NewHandler(mux, &http2.Server{})
+	}
 
 	server := &http.Server{
-		Addr:    h.Address,
-		Handler: mux,
-		TLSConfig: &tls.Config{
-			GetCertificate: func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
-				cert, err := tls.LoadX509KeyPair(h.TLSCertFile, h.TLSKeyFile)
-				if err != nil {
-					return nil, err
-				}
-				return &cert, nil
-			},
-			CipherSuites: tlsCipherSuites,
-			MinVersion:   minTLSVersion,
-		},
-	}
-
-	return server.ListenAndServeTLS("", "")
+		Handler:      handler,
+		ErrorLog:     log.New(tlsErrorWriter{}, "", 0),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  h.ReadTimeout,
+		WriteTimeout: h.WriteTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	listeners, err := h.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	if h.Registration.Enabled {
+		// the listeners are bound, the api server can call the webhook as
+		// soon as it is registered
+		if err = h.register(ctx); err != nil {
+			return err
+		}
+	}
+
+	h.notifyHandoverParent()
+	if h.Handover {
+		go h.watchHandover(ctx)
+	}
+
+	return h.serve(ctx, server, func() error {
+		return serveListeners(server, listeners)
+	})
+}
+
+// warnInsecureCipherSuites logs a warning for each configured cipher suite
+// that is considered insecure
+func warnInsecureCipherSuites(names []string) {
+	insecure := map[string]bool{}
+	for _, name := range cliflag.InsecureTLSCipherNames() {
+		insecure[name] = true
+	}
+
+	for _, name := range names {
+		if insecure[name] {
+			warningLogger.Printf("insecure TLS cipher suite configured: %s", name)
+		}
+	}
+}
+
+// SetInfoOutput redirects the info logs, e.g. to stderr for commands that
+// write their results to stdout
+func SetInfoOutput(w io.Writer) {
+	infoLogger.SetOutput(w)
 }
 
 func init() {
 	verboseLogger = log.New(io.Discard, "VERBOSE: ", log.Ldate|log.Ltime|log.Lshortfile)
+	debugLogger = log.New(os.Stderr, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
 	infoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
 	warningLogger = log.New(os.Stderr, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
 	errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
@@ -0,0 +1,75 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// serve runs listen until ctx is done, then drains the server: the health
+// check fails for ShutdownDelay so the pod is removed from the service
+// endpoints while requests are still served, and then the server stops
+// accepting connections and waits up to ShutdownTimeout for the in-flight
+// requests. There is no delay after a handover, since the new process keeps
+// serving the same sockets.
+func (h *Server) serve(ctx context.Context, server *http.Server, listen func() error) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- listen()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	if h.isHandingOver() {
+		// the new process serves the same sockets, there are no endpoints
+		// to wait for
+		infoLogger.Printf("shutting down after the handover")
+	} else {
+		infoLogger.Printf("shutting down, draining for %s", h.ShutdownDelay)
+		atomic.StoreInt32(&h.draining, 1)
+		h.updateReady()
+		time.Sleep(h.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), h.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	infoLogger.Printf("server stopped")
+	return nil
+}
+
+// isDraining returns true once the server is shutting down
+func (h *Server) isDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/tzdata"
+	"github.com/k8tz/k8tz/pkg/version"
+)
+
+// Status describes the state of the components of the webhook, it is served
+// on /statusz for monitoring dashboards
+type Status struct {
+	Version       string            `json:"version"`
+	Ready         bool              `json:"ready"`
+	Message       string            `json:"message,omitempty"`
+	Draining      bool              `json:"draining"`
+	Leader        bool              `json:"leader"`
+	Certificate   CertificateStatus `json:"certificate"`
+	TzdataVersion string            `json:"tzdataVersion"`
+	BundledTzdata string            `json:"bundledTzdataVersion"`
+	API           APIStatus         `json:"api"`
+	CachesSynced  bool              `json:"cachesSynced"`
+	ConfigHash    string            `json:"configHash"`
+	Crypto        CryptoStatus      `json:"crypto"`
+}
+
+// CertificateStatus describes the serving certificate
+type CertificateStatus struct {
+	Loaded   bool       `json:"loaded"`
+	NotAfter *time.Time `json:"notAfter,omitempty"`
+	Expired  bool       `json:"expired"`
+}
+
+// CryptoStatus describes the crypto policy and the crypto backend of the
+// binary
+type CryptoStatus struct {
+	Policy  CryptoPolicy `json:"policy"`
+	Backend string       `json:"backend"`
+	FIPS    bool         `json:"fips"`
+}
+
+// APIStatus describes the connectivity to the kubernetes api
+type APIStatus struct {
+	Connected bool   `json:"connected"`
+	Error     string `json:"error,omitempty"`
+}
+
+// status returns the state of the components, the kubernetes api is pinged
+// once and the webhook is ready if all of them are healthy, the same way
+// /readyz checks them
+func (h *Server) status(now time.Time) Status {
+	status := Status{
+		Version:       version.Version(),
+		Draining:      h.isDraining(),
+		Leader:        atomic.LoadInt32(&leading) == 1,
+		TzdataVersion: h.Handler.TzdataVersion,
+		BundledTzdata: tzdata.Version(),
+		ConfigHash:    h.Handler.configHash(),
+		Crypto:        CryptoStatus{Policy: h.CryptoPolicy},
+	}
+
+	status.Crypto.Backend, status.Crypto.FIPS = cryptoBackend()
+
+	if h.certificate != nil && h.certificate.current() != nil {
+		status.Certificate.Loaded = true
+		if leaf := h.certificate.current().Leaf; leaf != nil {
+			notAfter := leaf.NotAfter.UTC()
+			status.Certificate.NotAfter = &notAfter
+			status.Certificate.Expired = now.After(notAfter)
+		}
+	}
+
+	if h.Handler.clientset == nil {
+		status.API.Error = "not connected to kubernetes api"
+	} else if err := h.Handler.pingAPI(); err != nil {
+		status.API.Error = err.Error()
+	} else {
+		status.API.Connected = true
+	}
+
+	status.CachesSynced = h.Handler.clientset != nil && h.Handler.cachesSynced()
+
+	switch {
+	case status.Draining:
+		status.Message = "shutting down"
+	case !status.Certificate.Loaded:
+		status.Message = "TLS certificate is not loaded"
+	case status.Certificate.Expired:
+		status.Message = "TLS certificate expired"
+	case !status.API.Connected:
+		status.Message = "kubernetes api is not reachable"
+	case !status.CachesSynced:
+		status.Message = "informer caches are not synced"
+	default:
+		status.Ready = true
+	}
+
+	return status
+}
+
+// configHash returns the sha256 of the effective configuration of the
+// handler (the flags with the current webhook config applied), so replicas
+// running with different configurations can be told apart
+func (h *RequestsHandler) configHash() string {
+	data, err := json.Marshal(h.configured())
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (h *Server) statusz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	if err := json.NewEncoder(w).Encode(h.status(time.Now())); err != nil {
+		errorLogger.Printf("failed to write status: %v", err)
+	}
+}
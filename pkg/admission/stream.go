@@ -0,0 +1,78 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MutateStream reads admission reviews (JSON) from the input, handles them
+// the same way the webhook does and writes the response reviews to the
+// output, one per line. If once is true, only the first review is handled.
+// The options are validated like the webhook validates them on startup.
+func (h *RequestsHandler) MutateStream(in io.Reader, out io.Writer, once bool) error {
+	if err := h.validate(); err != nil {
+		return err
+	}
+
+	// the informers stop with the stream
+	stop := make(chan struct{})
+	defer close(stop)
+
+	h.startCaches(stop)
+	if err := h.waitForCaches(cacheSyncTimeout); err != nil {
+		warningLogger.Printf("%v, the objects are fetched from the api server", err)
+	}
+
+	decoder := json.NewDecoder(in)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			if once {
+				return fmt.Errorf("no admission review found in input")
+			}
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read admission review from input: %w", err)
+		}
+
+		review, err := decodeAdmissionReview(raw)
+		if err != nil {
+			return err
+		}
+
+		reviewResponse, err := h.review(review)
+		if err != nil {
+			return err
+		}
+
+		bytes, err := json.Marshal(reviewResponse)
+		if err != nil {
+			return fmt.Errorf("failed to marshal response review: %w", err)
+		}
+
+		if _, err = out.Write(append(bytes, '\n')); err != nil {
+			return fmt.Errorf("failed to write response review to output: %w", err)
+		}
+
+		if once {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	admission "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultTemplatePathMaxDepth is the default maximum number of fields of a
+// template path
+const DefaultTemplatePathMaxDepth = 10
+
+// TemplatePaths are the locations of pod templates in resources k8tz has no
+// built-in handler for (e.g. CRDs of operators), by "resource.group". It
+// implements pflag.Value so it can be set with repeated
+// "resource.group=spec.template" flags.
+type TemplatePaths map[string][]string
+
+func (p *TemplatePaths) String() string {
+	var values []string
+	for resource, paths := range *p {
+		for _, path := range paths {
+			values = append(values, fmt.Sprintf("%s=%s", resource, path))
+		}
+	}
+
+	sort.Strings(values)
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+// Set adds a path, paths deeper than DefaultTemplatePathMaxDepth are rejected,
+// TemplatePathsFlag sets them with another maximum depth
+func (p *TemplatePaths) Set(value string) error {
+	return p.add(value, DefaultTemplatePathMaxDepth)
+}
+
+func (p *TemplatePaths) Type() string {
+	return "resource.group=path"
+}
+
+func (p *TemplatePaths) add(value string, maxDepth int) error {
+	resource, path, ok := strings.Cut(value, "=")
+	if !ok || resource == "" || path == "" {
+		return fmt.Errorf("invalid template path %q, expected resource.group=path", value)
+	}
+
+	if err := validateTemplatePath(path, maxDepth); err != nil {
+		return fmt.Errorf("invalid template path %q: %w", value, err)
+	}
+
+	if *p == nil {
+		*p = TemplatePaths{}
+	}
+
+	(*p)[resource] = append((*p)[resource], path)
+	return nil
+}
+
+// validateTemplatePath checks the fields of a template path, a path has at
+// most maxDepth fields so a misconfigured path cannot make k8tz traverse
+// objects arbitrarily deep
+func validateTemplatePath(path string, maxDepth int) error {
+	fields := strings.Split(path, ".")
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("empty field in %s", path)
+		}
+	}
+
+	if len(fields) > maxDepth {
+		return fmt.Errorf("%s has %d fields, more than the maximum depth of %d", path, len(fields), maxDepth)
+	}
+
+	return nil
+}
+
+// TemplatePathsFlag is the pflag.Value of repeated "resource.group=path" flags
+// that rejects the paths deeper than MaxDepth, e.g. the value of another
+// flag, it must be set before the paths
+type TemplatePathsFlag struct {
+	Paths    *TemplatePaths
+	MaxDepth *int
+}
+
+func (f TemplatePathsFlag) String() string {
+	if f.Paths == nil {
+		return "[]"
+	}
+
+	return f.Paths.String()
+}
+
+func (f TemplatePathsFlag) Set(value string) error {
+	return f.Paths.add(value, *f.MaxDepth)
+}
+
+func (f TemplatePathsFlag) Type() string {
+	return f.Paths.Type()
+}
+
+// validateTemplatePaths checks the configured template paths against the
+// maximum depth of the handler
+func (h *RequestsHandler) validateTemplatePaths() error {
+	if len(h.TemplatePaths) > 0 && h.TemplatePathMaxDepth <= 0 {
+		return errors.New("the maximum depth of the template paths must be positive")
+	}
+
+	for resource, paths := range h.TemplatePaths {
+		for _, path := range paths {
+			if err := validateTemplatePath(path, h.TemplatePathMaxDepth); err != nil {
+				return fmt.Errorf("invalid template path of %s: %w", resource, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// groupResource returns the "resource.group" key of the TemplatePaths, the
+// same form kubectl uses, e.g. "workflows.argoproj.io"
+func groupResource(gvr metav1.GroupVersionResource) string {
+	if gvr.Group == "" {
+		return gvr.Resource
+	}
+
+	return gvr.Resource + "." + gvr.Group
+}
+
+// templatePointer returns the JSON pointer of the fields of a template path
+func templatePointer(fields []string) string {
+	escape := strings.NewReplacer("~", "~0", "/", "~1")
+	var pointer strings.Builder
+	for _, field := range fields {
+		pointer.WriteString("/" + escape.Replace(field))
+	}
+
+	return pointer.String()
+}
+
+// handleTemplateAdmissionRequest injects the pod templates found at the
+// configured paths of an arbitrary object, the object is traversed as
+// unstructured so no code is needed per resource
+func (h *RequestsHandler) handleTemplateAdmissionRequest(req *admission.AdmissionRequest) (k8tz.Patches, error) {
+	resource := groupResource(req.Resource)
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		return nil, withReason(ReasonInvalidObject, "could not deserialize %s object: %v", resource, err)
+	}
+
+	meta := metav1.ObjectMeta{}
+	if raw, ok := object["metadata"].(map[string]interface{}); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &meta); err != nil {
+			return nil, withReason(ReasonInvalidObject, "could not deserialize %s metadata: %v", resource, err)
+		}
+	}
+
+	var patches k8tz.Patches
+	for _, path := range h.TemplatePaths[resource] {
+		fields := strings.Split(path, ".")
+		raw, found, err := unstructured.NestedMap(object, fields...)
+		if err != nil {
+			return nil, withReason(ReasonInvalidObject, "invalid pod template at %s of %s (%s): %v", path, resource, formatObjectDetails(meta), err)
+		} else if !found {
+			h.skip(ReasonTemplateNotFound, "skipping pod template at %s of %s (%s) because it is not set", path, resource, formatObjectDetails(meta))
+			continue
+		}
+
+		template := corev1.PodTemplateSpec{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &template); err != nil {
+			return nil, withReason(ReasonInvalidObject, "could not deserialize pod template at %s of %s (%s): %v", path, resource, formatObjectDetails(meta), err)
+		}
+
+		generator, err := h.lookupPod(req.Namespace, templatePod(&meta, &template))
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup generator for %s, error=%w", resource, err)
+		}
+
+		if generator == nil {
+			continue
+		}
+
+		pointer := templatePointer(fields)
+		if _, ok := raw["metadata"]; !ok {
+			// the post injection annotations are added to the metadata
+			patches = append(patches, k8tz.Patch{Op: "add", Path: pointer + "/metadata", Value: map[string]interface{}{}})
+		}
+
+		h.verbosef("Generating patches for pod template at %s of %s (%s) using generator: %+v", path, resource, formatObjectDetails(meta), *generator)
+		h.recordInjection(generator)
+		done := h.startGeneration()
+		templatePatches, err := generator.Generate(&corev1.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}, pointer)
+		done(err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate patches for %s, error=%w", resource, err)
+		}
+
+		countInjection(req.Kind.Kind, req.Namespace)
+		infoLogger.Printf("%d patches generated for pod template at %s of %s (%s), timezone=%s, strategy=%s", len(templatePatches), path, resource, formatObjectDetails(meta), generator.Timezone, generator.Strategy)
+		patches = append(patches, templatePatches...)
+	}
+
+	return patches, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// debugRequested returns true if the object of the request has the
+// DebugAnnotation, its review is then logged regardless of the verbosity
+func debugRequested(req *admission.AdmissionRequest) bool {
+	object := metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		return false
+	}
+
+	val, ok := object.Annotations[k8tz.DebugAnnotation]
+	if !ok {
+		return false
+	}
+
+	debug, err := strconv.ParseBool(val)
+	if err != nil {
+		warningLogger.Printf("ignoring invalid %s annotation value: %q", k8tz.DebugAnnotation, val)
+	}
+
+	return debug
+}
+
+// verbosef logs a verbose message of the review, it is logged regardless of
+// the verbosity when the object of the review requested debug logs
+func (h *RequestsHandler) verbosef(format string, args ...interface{}) {
+	logger := verboseLogger
+	if h.state != nil && h.state.debug {
+		logger = debugLogger
+	}
+
+	// the caller of verbosef is the source of the message
+	logger.Output(2, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	admission "k8s.io/api/admission/v1beta1"
+)
+
+// tracerName is the instrumentation name of the spans of the admission
+// reviews
+const tracerName = "github.com/k8tz/k8tz/pkg/admission"
+
+// tracingEnabled returns true if an OTLP endpoint is set with the standard
+// OpenTelemetry environment variables, unless the SDK or the traces exporter
+// are disabled by them
+func tracingEnabled() bool {
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return false
+	}
+
+	if os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing exports the spans of the admission reviews with OTLP over
+// HTTP when tracingEnabled. The exporter, the sampler and the resource are
+// configured by the standard OTEL_* environment variables. The returned
+// function flushes the pending spans and stops the exporter.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	if !tracingEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the service name of OTEL_SERVICE_NAME and the attributes of
+	// OTEL_RESOURCE_ATTRIBUTES take precedence over the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceNameKey.String("k8tz"), semconv.ServiceVersionKey.String(version.Version())),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		warningLogger.Printf("failed to export traces: %v", err)
+	}))
+
+	infoLogger.Printf("Exporting OpenTelemetry traces of the admission reviews")
+	return provider.Shutdown, nil
+}
+
+// shutdownTracing flushes the pending spans on shutdown
+func shutdownTracing(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := shutdown(ctx); err != nil {
+		warningLogger.Printf("failed to flush the traces: %v", err)
+	}
+}
+
+// tracer returns the tracer of the global provider, which does not record
+// spans unless setupTracing configured an exporter
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName, trace.WithInstrumentationVersion(version.Version()))
+}
+
+// startReviewSpan starts the span of an admission review sent over HTTP, a
+// child of the span of the api server when the request carries its trace
+// context (traceparent header)
+func startReviewSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer().Start(ctx, "admission review", trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("http.route", r.URL.Path)))
+}
+
+// setReviewAttributes adds the request of the review to its span
+func setReviewAttributes(span trace.Span, req *admission.AdmissionRequest) {
+	span.SetAttributes(
+		attribute.String("k8tz.review.uid", string(req.UID)),
+		attribute.String("k8tz.review.operation", string(req.Operation)),
+		attribute.String("k8tz.review.resource", groupResource(req.Resource)),
+		attribute.String("k8tz.review.namespace", req.Namespace),
+		attribute.String("k8tz.review.name", req.Name),
+	)
+}
+
+// setReviewOutcome adds the response of the review to its span
+func setReviewOutcome(ctx context.Context, allowed bool, patches int) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("k8tz.review.allowed", allowed), attribute.Int("k8tz.review.patches", patches))
+}
+
+// startSpan starts a span of a stage of the review, a child of the span of
+// the review. Lookups outside of a review, e.g. of the re-injection, are not
+// traced.
+func (h *RequestsHandler) startSpan(name string) trace.Span {
+	if h.state == nil || h.state.ctx == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+
+	_, span := tracer().Start(h.state.ctx, name)
+	return span
+}
+
+// endSpan ends the span of a stage, with the error if the stage failed
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// endSelection ends the span of the strategy selection with the timezone and
+// the strategy of the generator, or the reason why the object is skipped
+func endSelection(span trace.Span, generator *inject.PatchGenerator, reason Reason, err error) {
+	if generator != nil {
+		span.SetAttributes(attribute.String("k8tz.timezone", generator.Timezone), attribute.String("k8tz.strategy", string(generator.Strategy)))
+	} else if reason != "" {
+		span.SetAttributes(attribute.String("k8tz.skip_reason", string(reason)))
+	}
+
+	endSpan(span, err)
+}
+
+// startGeneration starts the patch generation of a review, the returned
+// function observes its duration and ends its span
+func (h *RequestsHandler) startGeneration() func(error) {
+	start := time.Now()
+	span := h.startSpan("generate patches")
+	return func(err error) {
+		patchGenerationSeconds.observeSince(start)
+		endSpan(span, err)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/tzdata"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TzdataUpgradeAction is what k8tz does with the running pods that were
+// injected with an older tz database than the one of the webhook
+type TzdataUpgradeAction string
+
+const (
+	// TzdataUpgradeIgnore does not check the running pods
+	TzdataUpgradeIgnore TzdataUpgradeAction = "ignore"
+	// TzdataUpgradeReport logs the outdated pods and counts them in the
+	// k8tz_outdated_tzdata_pods metric
+	TzdataUpgradeReport TzdataUpgradeAction = "report"
+	// TzdataUpgradeRestart reports the outdated pods and restarts the
+	// Deployments, StatefulSets and DaemonSets they belong to, like
+	// 'kubectl rollout restart' does
+	TzdataUpgradeRestart TzdataUpgradeAction = "restart"
+)
+
+// outdatedTzdataPods is the number of outdated pods found by the last check
+var outdatedTzdataPods int64
+
+// detectTzdataVersion sets the TzdataVersion from the zoneinfo of the webhook
+// if it is not set explicitly, the bootstrap image is expected to have the
+// same tz database since it is the same image by default. Without zoneinfo
+// (e.g. a scratch image) it is the version of the embedded tz database.
+func (h *RequestsHandler) detectTzdataVersion() {
+	if inject.ZoneInfoSource(h.ZoneInfoPath) == inject.EmbeddedZoneInfo {
+		infoLogger.Printf("zoneinfo %s does not exist, timezones are validated with the embedded tz database %s", h.ZoneInfoPath, tzdata.Version())
+	}
+
+	if h.TzdataVersion != "" {
+		return
+	}
+
+	version, err := inject.TzdataVersion(h.ZoneInfoPath)
+	if err != nil {
+		warningLogger.Printf("tz database version is not recorded on injected pods: %v", err)
+		return
+	}
+
+	h.TzdataVersion = version
+	infoLogger.Printf("tz database version: %s", version)
+}
+
+// validateTzdataUpgrade checks the TzdataUpgradeAction, the outdated pods can
+// only be found when the tz database version is known
+func (h *RequestsHandler) validateTzdataUpgrade() error {
+	switch h.TzdataUpgrade {
+	case "", TzdataUpgradeIgnore:
+		return nil
+	case TzdataUpgradeReport, TzdataUpgradeRestart:
+		if h.TzdataVersion == "" {
+			return fmt.Errorf("tzdata upgrade action %s requires the tz database version, set --tzdata-version", h.TzdataUpgrade)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown tzdata upgrade action specified: %s", h.TzdataUpgrade)
+}
+
+// watchTzdataVersions checks the running pods for outdated tz databases every
+// TzdataCheckInterval until stop is closed
+func (h *RequestsHandler) watchTzdataVersions(stop <-chan struct{}) {
+	ticker := time.NewTicker(h.TzdataCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), h.TzdataCheckInterval)
+		h.checkTzdataVersions(ctx)
+		cancel()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkTzdataVersions finds the running pods that were injected with an older
+// tz database and handles them according to the TzdataUpgradeAction. Every
+// workload is restarted once per tz database version, so a rollout that is
+// still in progress is not restarted again.
+func (h *RequestsHandler) checkTzdataVersions(ctx context.Context) {
+	pods, err := h.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		warningLogger.Printf("failed to list pods for tz database check: %v", err)
+		return
+	}
+
+	var outdated int64
+	restarted := map[string]bool{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		version, ok := pod.Annotations[k8tz.TzdataVersionAnnotation]
+		if !ok || version >= h.TzdataVersion || pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		outdated++
+		infoLogger.Printf("pod (%s) has tz database %s, the current version is %s", formatObjectDetails(pod.ObjectMeta), version, h.TzdataVersion)
+		if h.TzdataUpgrade != TzdataUpgradeRestart {
+			continue
+		}
+
+		kind, name, err := h.podWorkload(ctx, pod)
+		if err != nil {
+			warningLogger.Printf("failed to find the workload of pod (%s): %v", formatObjectDetails(pod.ObjectMeta), err)
+			continue
+		} else if kind == "" {
+			infoLogger.Printf("pod (%s) does not belong to a Deployment, StatefulSet or DaemonSet and must be recreated manually", formatObjectDetails(pod.ObjectMeta))
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s/%s", kind, pod.Namespace, name)
+		if restarted[key] {
+			continue
+		}
+
+		restarted[key] = true
+		if err := h.restartWorkload(ctx, kind, pod.Namespace, name); err != nil {
+			warningLogger.Printf("failed to restart %s (namespace=%s, name=%s): %v", kind, pod.Namespace, name, err)
+		}
+	}
+
+	atomic.StoreInt64(&outdatedTzdataPods, outdated)
+}
+
+// podWorkload returns the kind and the name of the Deployment, StatefulSet or
+// DaemonSet that controls the pod, an empty kind is returned for other pods
+func (h *RequestsHandler) podWorkload(ctx context.Context, pod *corev1.Pod) (string, string, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", "", nil
+	}
+
+	switch owner.Kind {
+	case "StatefulSet", "DaemonSet":
+		return owner.Kind, owner.Name, nil
+	case "ReplicaSet":
+		rs, err := h.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", "", err
+		}
+
+		if owner = metav1.GetControllerOf(rs); owner != nil && owner.Kind == "Deployment" {
+			return owner.Kind, owner.Name, nil
+		}
+	}
+
+	return "", "", nil
+}
+
+// restartWorkload sets the TzdataRestartAnnotation on the pod template of the
+// workload, so its pods are rolled out and injected again. Workloads with an
+// injected pod template are not restarted, their template has to be injected
+// again with the new bootstrap image, e.g. by re-injection.
+func (h *RequestsHandler) restartWorkload(ctx context.Context, kind string, namespace string, name string) error {
+	var (
+		object runtime.Object
+		err    error
+	)
+
+	switch kind {
+	case "Deployment":
+		object, err = h.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "StatefulSet":
+		object, err = h.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "DaemonSet":
+		object, err = h.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return fmt.Errorf("unsupported workload: %s", kind)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, template := podTemplate(object)
+	if isInjected(&template.ObjectMeta) {
+		infoLogger.Printf("%s (namespace=%s, name=%s) has an injected pod template, it is not restarted until it is injected again", kind, namespace, name)
+		return nil
+	} else if template.Annotations[k8tz.TzdataRestartAnnotation] == h.TzdataVersion {
+		return nil
+	}
+
+	if h.DryRun {
+		infoLogger.Printf("dry run: %s (namespace=%s, name=%s) would be restarted for tz database %s", kind, namespace, name, h.TzdataVersion)
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{k8tz.TzdataRestartAnnotation: h.TzdataVersion},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case "Deployment":
+		_, err = h.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "StatefulSet":
+		_, err = h.clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	case "DaemonSet":
+		_, err = h.clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	}
+
+	if err == nil {
+		infoLogger.Printf("%s (namespace=%s, name=%s) restarted for tz database %s", kind, namespace, name, h.TzdataVersion)
+	}
+
+	return err
+}
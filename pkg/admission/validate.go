@@ -0,0 +1,169 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	admission "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validateFunc handles the admission reviews of the validating webhook, they
+// are rejected if the object requests a timezone that does not exist
+func (h *RequestsHandler) validateFunc(w http.ResponseWriter, r *http.Request) {
+	review, header, err := h.readAdmissionReview(r)
+	if err != nil {
+		warningLogger.Printf("failed to parse review: %v\n", err)
+		http.Error(w, fmt.Sprintf("failed to parse admission review from request, error=%s", err.Error()), header)
+		return
+	}
+
+	if misrouted(w, r, review) {
+		return
+	}
+
+	atomic.AddUint64(&admissionReviews, 1)
+	reviewResponse := admission.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: &admission.AdmissionResponse{
+			UID:     review.Request.UID,
+			Allowed: true,
+		},
+	}
+
+	if err := h.validateTimezones(review.Request); err != nil {
+		rejectedRequests.inc(reasonOf(err))
+		warningLogger.Printf("rejecting request: reason=%s, error=%v\n", reasonOf(err), err)
+		reviewResponse.Response.Allowed = false
+		reviewResponse.Response.Result = &metav1.Status{
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		}
+	}
+
+	bytes, err := json.Marshal(reviewResponse)
+	if err != nil {
+		errorLogger.Printf("failed to marshal response review: %+v, error=%v\n", reviewResponse, err)
+		http.Error(w, fmt.Sprintf("failed to marshal response review: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = w.Write(bytes); err != nil {
+		errorLogger.Printf("failed to write response to output http stream: %v\n", err)
+	}
+}
+
+// validateTimezones checks the timezone annotations of the object, deleted
+// objects and objects that cannot be decoded are allowed
+func (h *RequestsHandler) validateTimezones(req *admission.AdmissionRequest) error {
+	if req.Operation != admission.Create && req.Operation != admission.Update {
+		return nil
+	}
+
+	object := metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(req.Object.Raw, &object); err != nil {
+		return nil
+	}
+
+	annotations := object.Annotations
+	if val, ok := annotations[k8tz.TimezoneAnnotation]; ok {
+		if err := h.validateTimezone(val); err != nil {
+			return withReason(ReasonInvalidTimezone, "invalid %s annotation on %s (%s): %v", k8tz.TimezoneAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+	}
+
+	if val, ok := annotations[k8tz.InjectionAnnotation]; ok && val != k8tz.InjectionEnabled && val != k8tz.InjectionDisabled {
+		return withReason(ReasonInvalidObject, "invalid %s annotation on %s (%s): %q, must be %s or %s", k8tz.InjectionAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), val, k8tz.InjectionEnabled, k8tz.InjectionDisabled)
+	}
+
+	if val, ok := annotations[k8tz.LocaleAnnotation]; ok {
+		if err := inject.ValidateLocale(val); err != nil {
+			return withReason(ReasonInvalidLocale, "invalid %s annotation on %s (%s): %v", k8tz.LocaleAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+	}
+
+	if val, ok := annotations[k8tz.FaketimeAnnotation]; ok {
+		if err := inject.ValidateFaketime(val); err != nil {
+			return withReason(ReasonInvalidObject, "invalid %s annotation on %s (%s): %v", k8tz.FaketimeAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+	}
+
+	if val, ok := annotations[k8tz.TzdirAnnotation]; ok {
+		if err := inject.ValidateTzdir(val); err != nil {
+			return withReason(ReasonInvalidObject, "invalid %s annotation on %s (%s): %v", k8tz.TzdirAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+	}
+
+	if val, ok := annotations[k8tz.HostPathAnnotation]; ok {
+		if err := inject.ValidateHostPath(val, h.hostPathRoots()); err != nil {
+			return withReason(ReasonInvalidObject, "invalid %s annotation on %s (%s): %v", k8tz.HostPathAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+	}
+
+	if val, ok := annotations[k8tz.ContainerTimezonesAnnotation]; ok {
+		timezones, err := inject.ParseContainerTimezones(val)
+		if err != nil {
+			return withReason(ReasonInvalidTimezone, "invalid %s annotation on %s (%s): %v", k8tz.ContainerTimezonesAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), err)
+		}
+
+		names := make([]string, 0, len(timezones))
+		for name := range timezones {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			if timezones[name] == k8tz.AutoTimezone {
+				return withReason(ReasonInvalidTimezone, "invalid %s annotation on %s (%s), container %s: the %s timezone can only be requested with the %s annotation", k8tz.ContainerTimezonesAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), name, k8tz.AutoTimezone, k8tz.TimezoneAnnotation)
+			}
+
+			if err := h.validateTimezone(timezones[name]); err != nil {
+				return withReason(ReasonInvalidTimezone, "invalid %s annotation on %s (%s), container %s: %v", k8tz.ContainerTimezonesAnnotation, req.Kind.Kind, formatObjectDetails(object.ObjectMeta), name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateTimezone checks that the timezone is not an abbreviation and that
+// its canonical timezone exists in the zoneinfo of the webhook, the auto
+// timezone is allowed when it is enabled
+func (h *RequestsHandler) validateTimezone(timezone string) error {
+	if timezone == k8tz.AutoTimezone {
+		if !h.AutoTimezone {
+			return fmt.Errorf("the %s timezone is disabled, enable it with --auto-timezone", k8tz.AutoTimezone)
+		}
+
+		return nil
+	}
+
+	canonical, err := inject.CanonicalTimezone(timezone)
+	if err != nil {
+		return err
+	}
+
+	return inject.ValidateTimezone(h.ZoneInfoPath, canonical)
+}
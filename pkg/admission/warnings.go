@@ -0,0 +1,88 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// warningPrefix is prepended to the admission warnings, kubectl prints them
+// as "Warning: <message>" so the prefix tells where they come from
+const warningPrefix = "k8tz: "
+
+// warn logs a warning, and when an admission review is being handled it is
+// also returned to the client in the warnings of the AdmissionResponse, so
+// users see it in the kubectl output
+func (h *RequestsHandler) warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	warningLogger.Print(message)
+	if h.state != nil {
+		h.state.warnings = append(h.state.warnings, warningPrefix+message)
+	}
+}
+
+// canonicalTimezone returns the canonical timezone of the object and warns if
+// the requested timezone is an alias, abbreviations are rejected
+func (h *RequestsHandler) canonicalTimezone(timezone string, kind string, details string) (string, error) {
+	canonical, err := inject.CanonicalTimezone(timezone)
+	if err != nil {
+		return "", withReason(ReasonInvalidTimezone, "invalid timezone of %s (%s): %v", kind, details, err)
+	}
+
+	if canonical != timezone {
+		h.warn("%s (%s) requests timezone %s which is an alias of %s, %s is injected", kind, details, timezone, canonical, canonical)
+	}
+
+	return canonical, nil
+}
+
+// warnUnknownTimezone warns if the timezone is missing from the zoneinfo of
+// the webhook, such a timezone would leave the containers in UTC. Nothing is
+// checked when the zoneinfo directory does not exist.
+func (h *RequestsHandler) warnUnknownTimezone(timezone string, kind string, details string) {
+	if info, err := os.Stat(h.ZoneInfoPath); err != nil || !info.IsDir() {
+		return
+	}
+
+	if err := inject.ValidateTimezone(h.ZoneInfoPath, timezone); err != nil {
+		h.warn("%s (%s) requests %v, its containers will fallback to UTC", kind, details, err)
+		if h.state != nil {
+			h.state.invalidTimezone = fmt.Sprintf("%v, the containers fallback to UTC", err)
+		}
+	}
+}
+
+// warnExistingTimezone warns about containers that already define the TZ
+// environment variable, the injected TZ overrides it since it is added last
+func (h *RequestsHandler) warnExistingTimezone(pod *corev1.Pod) {
+	for _, c := range pod.Spec.Containers {
+		for _, env := range c.Env {
+			if env.Name == "TZ" {
+				if h.ConflictPolicy == inject.ConflictMerge {
+					h.warn("container %s of pod (%s) already defines TZ, it is kept by the %s conflict policy", c.Name, formatObjectDetails(pod.ObjectMeta), h.ConflictPolicy)
+				} else {
+					h.warn("container %s of pod (%s) already defines TZ, it is replaced by the injected timezone", c.Name, formatObjectDetails(pod.ObjectMeta))
+				}
+				break
+			}
+		}
+	}
+}
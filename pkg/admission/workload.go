@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"fmt"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	admission "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var (
+	deploymentResource  = metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	statefulSetResource = metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}
+	daemonSetResource   = metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
+	replicaSetResource  = metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}
+	jobResource         = metav1.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+)
+
+// workloadResources creates empty objects of the workloads that are injected
+// at the pod template level
+var workloadResources = map[metav1.GroupVersionResource]func() runtime.Object{
+	deploymentResource:  func() runtime.Object { return &appsv1.Deployment{} },
+	statefulSetResource: func() runtime.Object { return &appsv1.StatefulSet{} },
+	daemonSetResource:   func() runtime.Object { return &appsv1.DaemonSet{} },
+	replicaSetResource:  func() runtime.Object { return &appsv1.ReplicaSet{} },
+	jobResource:         func() runtime.Object { return &batchv1.Job{} },
+}
+
+// podTemplate returns the metadata and the pod template of a workload object
+func podTemplate(object interface{}) (*metav1.ObjectMeta, *corev1.PodTemplateSpec) {
+	switch o := object.(type) {
+	case *appsv1.Deployment:
+		return &o.ObjectMeta, &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.ObjectMeta, &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return &o.ObjectMeta, &o.Spec.Template
+	case *appsv1.ReplicaSet:
+		return &o.ObjectMeta, &o.Spec.Template
+	case *batchv1.Job:
+		return &o.ObjectMeta, &o.Spec.Template
+	}
+
+	return nil, nil
+}
+
+// templatePod returns the pod that the workload would create, the annotations
+// of the pod template take precedence over the annotations of the workload
+func templatePod(meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+
+	pod.Namespace = meta.Namespace
+	pod.Name = meta.Name
+	pod.GenerateName = meta.GenerateName
+	pod.OwnerReferences = meta.OwnerReferences
+	pod.Annotations = make(map[string]string, len(meta.Annotations)+len(template.Annotations))
+	for k, v := range meta.Annotations {
+		pod.Annotations[k] = v
+	}
+
+	for k, v := range template.Annotations {
+		pod.Annotations[k] = v
+	}
+
+	return pod
+}
+
+// handleWorkloadAdmissionRequest injects the pod template of workloads, the
+// pods they create are then skipped since their template is already injected
+func (h *RequestsHandler) handleWorkloadAdmissionRequest(req *admission.AdmissionRequest) (k8tz.Patches, error) {
+	kind := req.Kind.Kind
+	if !h.InjectWorkloads {
+		h.skip(ReasonDisabled, "skipping %s (namespace=%s, name=%s) because workload injection is disabled", kind, req.Namespace, req.Name)
+		return nil, nil
+	}
+
+	object := workloadResources[req.Resource]()
+	if _, _, err := k8sdecode.Decode(req.Object.Raw, nil, object); err != nil {
+		return nil, withReason(ReasonInvalidObject, "could not deserialize %s object: %v", kind, err)
+	}
+
+	meta, template := podTemplate(object)
+	generator, err := h.lookupPod(req.Namespace, templatePod(meta, template))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup generator for %s, error=%w", kind, err)
+	}
+
+	var patches k8tz.Patches
+	if generator != nil {
+		h.verbosef("Generating patches for %s (%s) using generator: %+v", kind, formatObjectDetails(*meta), *generator)
+		h.recordInjection(generator)
+		done := h.startGeneration()
+		patches, err = generator.Generate(object, "")
+		done(err)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate patches for %s, error=%w", kind, err)
+		}
+
+		countInjection(kind, req.Namespace)
+		infoLogger.Printf("%d patches generated for %s (%s), timezone=%s, strategy=%s", len(patches), kind, formatObjectDetails(*meta), generator.Timezone, generator.Strategy)
+	}
+
+	return patches, err
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package admission
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/tzdata"
+)
+
+// ZoneList is the timezones that the webhook accepts, it is served on /zones
+type ZoneList struct {
+	// Source is the zoneinfo directory the timezones are validated with, or
+	// "embedded" if it does not exist
+	Source string `json:"source"`
+	// Version is the tz database version of the source
+	Version string `json:"version,omitempty"`
+	// BundledVersion is the version of the tz database embedded in k8tz
+	BundledVersion string   `json:"bundledVersion"`
+	Zones          []string `json:"zones"`
+}
+
+// ZoneList returns the timezones of the zoneinfo of the handler
+func (h *RequestsHandler) ZoneList() (ZoneList, error) {
+	zones, err := inject.Zones(h.ZoneInfoPath)
+	if err != nil {
+		return ZoneList{}, err
+	}
+
+	version, _ := inject.TzdataVersion(h.ZoneInfoPath)
+	return ZoneList{
+		Source:         inject.ZoneInfoSource(h.ZoneInfoPath),
+		Version:        version,
+		BundledVersion: tzdata.Version(),
+		Zones:          zones,
+	}, nil
+}
+
+func (h *Server) zones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := h.Handler.ZoneList()
+	if err != nil {
+		errorLogger.Printf("failed to list timezones: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", jsonContentType)
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		errorLogger.Printf("failed to write timezones: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the k8tz.io/v1alpha1 API types
+package v1alpha1
+
+import (
+	"github.com/k8tz/k8tz/pkg/inject"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "k8tz.io"
+	Version = "v1alpha1"
+)
+
+// TimezonePolicyResource is the resource of the cluster scoped TimezonePolicy
+var TimezonePolicyResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "timezonepolicies"}
+
+// TimezonePolicy defines the injection of the pods it selects, it replaces the
+// handler defaults for those pods. Annotations on the pod or its namespace
+// still take precedence.
+type TimezonePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TimezonePolicySpec `json:"spec"`
+}
+
+type TimezonePolicySpec struct {
+	// NamespaceSelector selects the namespaces of the pods by their labels,
+	// all namespaces are selected if it is not set
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// PodSelector selects the pods by their labels, all pods are selected if
+	// it is not set
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExcludedNamespaces are never selected, even if they match the
+	// NamespaceSelector
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// Priority decides between several matching policies, the highest wins
+	// and ties are broken by name
+	Priority int32 `json:"priority,omitempty"`
+	// Inject enables or disables the injection of the selected pods, the
+	// handler default is used if it is not set
+	Inject *bool `json:"inject,omitempty"`
+	// Timezone is injected into the selected pods
+	Timezone string `json:"timezone,omitempty"`
+	// Locale is injected into the selected pods with the LANG and LC_ALL
+	// environment variables
+	Locale string `json:"locale,omitempty"`
+	// Strategy is the injection strategy of the selected pods
+	Strategy inject.InjectionStrategy `json:"strategy,omitempty"`
+	// Reinject keeps the injected pod templates of the selected Deployments,
+	// StatefulSets and CronJobs up to date with the policy, see
+	// k8tz.io/reinject
+	Reinject bool `json:"reinject,omitempty"`
+	// Bootstrap overrides the bootstrap image and its image pull secrets for
+	// the selected pods, e.g. for tenants that pull from their own registry
+	Bootstrap *BootstrapSpec `json:"bootstrap,omitempty"`
+}
+
+// BootstrapSpec overrides the bootstrap image of the selected pods, the
+// k8tz.io/bootstrap-* annotations of the namespace take precedence
+type BootstrapSpec struct {
+	// Repository replaces the repository of the bootstrap image, e.g.
+	// registry.tenant.local/k8tz
+	Repository string `json:"repository,omitempty"`
+	// Tag replaces the tag of the bootstrap image
+	Tag string `json:"tag,omitempty"`
+	// ImagePullSecrets replace the image pull secrets of the bootstrap image,
+	// the secrets must exist in the namespaces of the pods
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	TableOutput = "table"
+	JSONOutput  = "json"
+)
+
+// PodStatus is the injection status of a single pod in the cluster
+type PodStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Injected  bool   `json:"injected"`
+	Timezone  string `json:"timezone,omitempty"`
+}
+
+type Auditor struct {
+	Namespace    string
+	Workers      int
+	Output       string
+	ZoneInfoPath string
+	// TzdataVersion is the current tz database version of the report
+	TzdataVersion string
+	clientset     kubernetes.Interface
+	// contextNamespace is the namespace of the current kubeconfig context
+	contextNamespace string
+}
+
+func NewAuditor() *Auditor {
+	return &Auditor{
+		Namespace:        "",
+		Workers:          4,
+		Output:           TableOutput,
+		ZoneInfoPath:     inject.DefaultZoneInfoPath,
+		TzdataVersion:    "",
+		contextNamespace: metav1.NamespaceDefault,
+	}
+}
+
+func getKubeconfig(kubeconfPath string) (*restclient.Config, error) {
+	if kubeconfPath == "" {
+		kubeconfig, err := restclient.InClusterConfig()
+		if err == nil {
+			return kubeconfig, nil
+		}
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules(kubeconfPath),
+		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: ""}}).ClientConfig()
+}
+
+// loadingRules loads the kubeconfig file of the path, or the KUBECONFIG files
+// and ~/.kube/config like kubectl does when the path is empty
+func loadingRules(kubeconfPath string) *clientcmd.ClientConfigLoadingRules {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfPath
+	return rules
+}
+
+func (a *Auditor) InitializeClientset(kubeconfPath string) error {
+	config, err := getKubeconfig(kubeconfPath)
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes config: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %v", err)
+	}
+
+	a.clientset = clientset
+	if namespace, _, err := kubeconfigNamespace(kubeconfPath); err == nil && namespace != "" {
+		a.contextNamespace = namespace
+	}
+
+	return nil
+}
+
+// kubeconfigNamespace returns the namespace of the current context of the
+// kubeconfig, or of the pod when running in a cluster
+func kubeconfigNamespace(kubeconfPath string) (string, bool, error) {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules(kubeconfPath),
+		&clientcmd.ConfigOverrides{}).Namespace()
+}
+
+// Audit lists the pods of all the namespaces (or a single namespace if
+// specified) and returns their injection status sorted by namespace and name.
+// Namespaces are scanned in parallel by up to Workers goroutines.
+func (a *Auditor) Audit(ctx context.Context) ([]PodStatus, error) {
+	namespaces, err := a.namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := a.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses []PodStatus
+		firstErr error
+	)
+
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for namespace := range queue {
+				result, err := a.auditNamespace(ctx, namespace)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				statuses = append(statuses, result...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, namespace := range namespaces {
+		queue <- namespace
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Namespace != statuses[j].Namespace {
+			return statuses[i].Namespace < statuses[j].Namespace
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
+
+func (a *Auditor) namespaces(ctx context.Context) ([]string, error) {
+	if a.Namespace != "" {
+		return []string{a.Namespace}, nil
+	}
+
+	list, err := a.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	namespaces := make([]string, 0, len(list.Items))
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, ns.Name)
+	}
+
+	return namespaces, nil
+}
+
+func (a *Auditor) auditNamespace(ctx context.Context, namespace string) ([]PodStatus, error) {
+	list, err := a.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+	}
+
+	statuses := make([]PodStatus, 0, len(list.Items))
+	for i := range list.Items {
+		statuses = append(statuses, podStatus(&list.Items[i]))
+	}
+
+	return statuses, nil
+}
+
+func podStatus(pod *corev1.Pod) PodStatus {
+	injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation])
+	status := PodStatus{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Injected:  injected,
+	}
+
+	if injected {
+		status.Timezone = pod.Annotations[k8tz.TimezoneAnnotation]
+	}
+
+	return status
+}
+
+// Write prints the statuses to the output in the configured format
+func (a *Auditor) Write(statuses []PodStatus, out io.Writer) error {
+	switch a.Output {
+	case JSONOutput:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statuses)
+	case TableOutput:
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tINJECTED\tTIMEZONE")
+		for _, s := range statuses {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", s.Namespace, s.Name, s.Injected, s.Timezone)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", a.Output)
+}
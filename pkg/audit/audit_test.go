@@ -0,0 +1,514 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/k8tz/k8tz/pkg/inject"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakeObjects(namespaces, podsPerNamespace int) []runtime.Object {
+	objects := []runtime.Object{}
+	for n := 0; n < namespaces; n++ {
+		namespace := fmt.Sprintf("ns-%02d", n)
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		for p := 0; p < podsPerNamespace; p++ {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%03d", p), Namespace: namespace}}
+			if p%2 == 0 {
+				pod.Annotations = map[string]string{
+					k8tz.InjectedAnnotation: "true",
+					k8tz.TimezoneAnnotation: "Europe/Rome",
+				}
+			}
+			objects = append(objects, pod)
+		}
+	}
+
+	return objects
+}
+
+func TestAuditor_Audit(t *testing.T) {
+	const namespaces, podsPerNamespace = 20, 25
+	clientset := fake.NewSimpleClientset(fakeObjects(namespaces, podsPerNamespace)...)
+
+	var reference []PodStatus
+	for _, workers := range []int{0, 1, 4, 16, 64} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			a := &Auditor{Workers: workers, clientset: clientset}
+			got, err := a.Audit(context.Background())
+			if err != nil {
+				t.Fatalf("Audit() error = %v", err)
+			}
+
+			if len(got) != namespaces*podsPerNamespace {
+				t.Fatalf("Audit() returned %d pods, want %d", len(got), namespaces*podsPerNamespace)
+			}
+
+			if !sort.SliceIsSorted(got, func(i, j int) bool {
+				if got[i].Namespace != got[j].Namespace {
+					return got[i].Namespace < got[j].Namespace
+				}
+				return got[i].Name < got[j].Name
+			}) {
+				t.Errorf("Audit() result is not sorted")
+			}
+
+			injected := 0
+			for _, s := range got {
+				if s.Injected {
+					injected++
+					if s.Timezone != "Europe/Rome" {
+						t.Errorf("Audit() pod %s/%s timezone = %s, want Europe/Rome", s.Namespace, s.Name, s.Timezone)
+					}
+				}
+			}
+
+			if want := namespaces * ((podsPerNamespace + 1) / 2); injected != want {
+				t.Errorf("Audit() injected pods = %d, want %d", injected, want)
+			}
+
+			if reference == nil {
+				reference = got
+			} else if !reflect.DeepEqual(reference, got) {
+				t.Errorf("Audit() result with %d workers differs from the result with a single worker", workers)
+			}
+		})
+	}
+}
+
+func TestAuditor_AuditNamespace(t *testing.T) {
+	a := &Auditor{Namespace: "ns-03", Workers: 4, clientset: fake.NewSimpleClientset(fakeObjects(5, 3)...)}
+	got, err := a.Audit(context.Background())
+	if err != nil {
+		t.Fatalf("Audit() error = %v", err)
+	}
+
+	want := []PodStatus{
+		{Namespace: "ns-03", Name: "pod-000", Injected: true, Timezone: "Europe/Rome"},
+		{Namespace: "ns-03", Name: "pod-001", Injected: false},
+		{Namespace: "ns-03", Name: "pod-002", Injected: true, Timezone: "Europe/Rome"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Audit() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAuditor_Write(t *testing.T) {
+	statuses := []PodStatus{
+		{Namespace: "default", Name: "a", Injected: true, Timezone: "UTC"},
+		{Namespace: "default", Name: "b", Injected: false},
+	}
+
+	tests := []struct {
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			output: TableOutput,
+			want: "NAMESPACE   NAME   INJECTED   TIMEZONE\n" +
+				"default     a      true       UTC\n" +
+				"default     b      false      \n",
+		},
+		{
+			output: JSONOutput,
+			want: `[
+  {
+    "namespace": "default",
+    "name": "a",
+    "injected": true,
+    "timezone": "UTC"
+  },
+  {
+    "namespace": "default",
+    "name": "b",
+    "injected": false
+  }
+]
+`,
+		},
+		{
+			output:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var out bytes.Buffer
+			a := &Auditor{Output: tt.output}
+			if err := a.Write(statuses, &out); (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && out.String() != tt.want {
+				t.Errorf("Write() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func diffObjects() []runtime.Object {
+	labels := func(app string) map[string]string { return map[string]string{"app": app} }
+	selector := func(app string) *metav1.LabelSelector { return &metav1.LabelSelector{MatchLabels: labels(app)} }
+	injected := func(name, app, timezone string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels(app),
+				Annotations: map[string]string{
+					k8tz.InjectedAnnotation: "true",
+					k8tz.TimezoneAnnotation: timezone,
+				},
+			},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{Name: inject.VolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+			},
+		}
+	}
+
+	return []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		// compliant: injected with the default timezone
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "compliant", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector("compliant"), Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels("compliant")}}},
+		},
+		injected("compliant-1", "compliant", "Europe/Rome"),
+		// compliant: opted out and not injected
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "opted-out", Namespace: "default"},
+			Spec: appsv1.DeploymentSpec{Selector: selector("opted-out"), Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+				Labels:      labels("opted-out"),
+				Annotations: map[string]string{k8tz.InjectAnnotation: "false"},
+			}}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "opted-out-1", Namespace: "default", Labels: labels("opted-out")}},
+		// drifted: created before k8tz was installed
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "not-injected", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector("not-injected"), Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels("not-injected")}}},
+		},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "not-injected-1", Namespace: "default", Labels: labels("not-injected")}},
+		// drifted: one pod has the timezone of a previous policy
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "stale", Namespace: "default"},
+			Spec: appsv1.StatefulSetSpec{Selector: selector("stale"), Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+				Labels:      labels("stale"),
+				Annotations: map[string]string{k8tz.TimezoneAnnotation: "Asia/Tokyo"},
+			}}},
+		},
+		injected("stale-0", "stale", "Asia/Tokyo"),
+		injected("stale-1", "stale", "UTC"),
+	}
+}
+
+func TestAuditor_Diff(t *testing.T) {
+	a := &Auditor{Output: JSONOutput, clientset: fake.NewSimpleClientset(diffObjects()...)}
+	policy := admission.NewRequestsHandler()
+	policy.DefaultTimezone = "Europe/Rome"
+
+	got, err := a.Diff(context.Background(), &policy)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	rome := Injection{Injected: true, Timezone: "Europe/Rome", Strategy: inject.InitContainerInjectionStrategy}
+	want := []WorkloadDiff{
+		{Kind: "Deployment", Namespace: "default", Name: "compliant", Desired: rome, Differences: []Difference{}},
+		{Kind: "Deployment", Namespace: "default", Name: "not-injected", Desired: rome, Differences: []Difference{
+			{Pod: "not-injected-1", Field: "injected", Want: "true", Got: "false"},
+		}},
+		{Kind: "Deployment", Namespace: "default", Name: "opted-out", Desired: Injection{Injected: false}, Differences: []Difference{}},
+		{Kind: "StatefulSet", Namespace: "default", Name: "stale", Desired: Injection{Injected: true, Timezone: "Asia/Tokyo", Strategy: inject.InitContainerInjectionStrategy}, Differences: []Difference{
+			{Pod: "stale-1", Field: "timezone", Want: "Asia/Tokyo", Got: "UTC"},
+		}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+
+	if drifted := Drifted(got); drifted != 2 {
+		t.Errorf("Drifted() = %d, want 2", drifted)
+	}
+
+	var out bytes.Buffer
+	if err := a.WriteDiff(got, &out); err != nil {
+		t.Fatalf("WriteDiff() error = %v", err)
+	}
+
+	golden, err := os.ReadFile("testdata/diff.json")
+	if os.IsNotExist(err) {
+		if err := os.WriteFile("testdata/diff.json", out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	} else if err != nil {
+		t.Fatal(err)
+	} else if out.String() != string(golden) {
+		t.Errorf("WriteDiff() = %s, want %s", out.String(), golden)
+	}
+}
+
+func TestAuditor_Verify(t *testing.T) {
+	injected := func(name string, annotations map[string]string, env map[string]string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{k8tz.InjectedAnnotation: "true"}}}
+		for k, v := range annotations {
+			pod.Annotations[k] = v
+		}
+
+		for container, tz := range env {
+			c := corev1.Container{Name: container}
+			if tz != "" {
+				c.Env = []corev1.EnvVar{{Name: "TZ", Value: tz}}
+			}
+			pod.Spec.Containers = append(pod.Spec.Containers, c)
+		}
+
+		return pod
+	}
+
+	a := &Auditor{ZoneInfoPath: "../inject/testdata/zoneinfo", clientset: fake.NewSimpleClientset(
+		injected("matching", map[string]string{k8tz.TimezoneAnnotation: "Europe/Rome"}, map[string]string{"app": "Europe/Rome"}),
+		injected("changed", map[string]string{k8tz.TimezoneAnnotation: "Europe/Rome"}, map[string]string{"app": "UTC"}),
+		injected("missing", map[string]string{k8tz.TimezoneAnnotation: "Europe/Rome"}, map[string]string{"app": ""}),
+		injected("containers", map[string]string{k8tz.TimezoneAnnotation: "UTC", k8tz.ContainerTimezonesAnnotation: "app=Asia/Tokyo"}, map[string]string{"app": "Asia/Tokyo"}),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "not-injected", Namespace: "default"}, Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}},
+	)}
+	a.Namespace = "default"
+
+	got, err := a.Verify(context.Background())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	want := []Mismatch{
+		{Namespace: "default", Pod: "changed", Container: "app", Want: "Europe/Rome", Got: "UTC"},
+		{Namespace: "default", Pod: "missing", Container: "app", Want: "Europe/Rome", Got: ""},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		arg      string
+		wantKind string
+		wantName string
+		wantOk   bool
+	}{
+		{arg: "deployment/foo", wantKind: "Deployment", wantName: "foo", wantOk: true},
+		{arg: "deploy/foo", wantKind: "Deployment", wantName: "foo", wantOk: true},
+		{arg: "cj/nightly", wantKind: "CronJob", wantName: "nightly", wantOk: true},
+		{arg: "service/foo"},
+		{arg: "deployment/"},
+		{arg: "foo.yaml"},
+		{arg: "testdata/diff.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			kind, name, ok := ParseReference(tt.arg)
+			if kind != tt.wantKind || name != tt.wantName || ok != tt.wantOk {
+				t.Errorf("ParseReference(%s) = %s, %s, %t, want %s, %s, %t", tt.arg, kind, name, ok, tt.wantKind, tt.wantName, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAuditor_Manifest(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:          "foo",
+		Namespace:     "team",
+		ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+	}}
+	a := NewAuditor()
+	a.clientset = fake.NewSimpleClientset(deployment)
+	a.contextNamespace = "team"
+
+	got, err := a.Manifest(context.Background(), "Deployment", "foo")
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+
+	for _, want := range []string{"apiVersion: apps/v1", "kind: Deployment", "name: foo"} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("Manifest() = %s, want it to contain %q", got, want)
+		}
+	}
+
+	if bytes.Contains(got, []byte("managedFields")) {
+		t.Errorf("Manifest() = %s, want no managed fields", got)
+	}
+
+	if _, err := a.Manifest(context.Background(), "Deployment", "bar"); err == nil {
+		t.Error("Manifest() of a missing object should fail")
+	}
+}
+
+func migrateObjects() []runtime.Object {
+	labels := func(app string) map[string]string { return map[string]string{"app": app} }
+	selector := func(app string) *metav1.LabelSelector { return &metav1.LabelSelector{MatchLabels: labels(app)} }
+	template := func(app string, annotations map[string]string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: labels(app), Annotations: annotations}}
+	}
+	pod := func(namespace, name, app string, source corev1.VolumeSource) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Labels:      labels(app),
+				Annotations: map[string]string{k8tz.InjectedAnnotation: "true", k8tz.TimezoneAnnotation: "UTC"},
+			},
+			Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: inject.VolumeName, VolumeSource: source}}},
+		}
+	}
+	hostPath := corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: inject.DefaultHostPathPrefix}}
+	emptyDir := corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}
+
+	return []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "a"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "b"}},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "a"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector("legacy"), Template: template("legacy", nil)},
+		},
+		pod("a", "legacy-1", "legacy", hostPath),
+		pod("a", "legacy-2", "legacy", hostPath),
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "current", Namespace: "a"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector("current"), Template: template("current", nil)},
+		},
+		pod("a", "current-1", "current", emptyDir),
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "pinned", Namespace: "a"},
+			Spec:       appsv1.StatefulSetSpec{Selector: selector("pinned"), Template: template("pinned", map[string]string{k8tz.InjectedAnnotation: "true"})},
+		},
+		pod("a", "pinned-0", "pinned", hostPath),
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "rolling", Namespace: "a"},
+			Spec:       appsv1.DaemonSetSpec{Selector: selector("rolling"), Template: template("rolling", map[string]string{k8tz.InjectionStrategyAnnotation: "initContainer"})},
+		},
+		pod("a", "rolling-1", "rolling", hostPath),
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "b"},
+			Spec:       appsv1.StatefulSetSpec{Selector: selector("legacy"), Template: template("legacy", nil)},
+		},
+		pod("b", "legacy-0", "legacy", hostPath),
+	}
+}
+
+func TestAuditor_Migrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		dryRun     bool
+		wantStatus []MigrationStatus
+		wantTo     string
+	}{
+		{
+			name:       "dry run",
+			dryRun:     true,
+			wantStatus: []MigrationStatus{MigrationDryRun, MigrationSkipped, MigrationSkipped, MigrationDryRun},
+			wantTo:     "",
+		},
+		{
+			name:       "applied",
+			wantStatus: []MigrationStatus{MigrationApplied, MigrationSkipped, MigrationSkipped, MigrationApplied},
+			wantTo:     "initContainer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuditor()
+			a.clientset = fake.NewSimpleClientset(migrateObjects()...)
+
+			m := NewMigrator()
+			m.DryRun = tt.dryRun
+			m.BatchInterval = 0
+
+			got, err := a.Migrate(context.Background(), &m)
+			if err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+
+			want := []string{"a/Deployment/legacy", "a/StatefulSet/pinned", "a/DaemonSet/rolling", "b/StatefulSet/legacy"}
+			if len(got) != len(want) {
+				t.Fatalf("Migrate() = %+v, want %d workloads", got, len(want))
+			}
+
+			for i, migration := range got {
+				if name := fmt.Sprintf("%s/%s/%s", migration.Namespace, migration.Kind, migration.Name); name != want[i] {
+					t.Errorf("Migrate()[%d] = %s, want %s", i, name, want[i])
+				}
+
+				if migration.Status != tt.wantStatus[i] {
+					t.Errorf("Migrate()[%d] status = %s, want %s (%s)", i, migration.Status, tt.wantStatus[i], migration.Message)
+				}
+			}
+
+			if got[0].Pods != 2 {
+				t.Errorf("Migrate() pods of a/Deployment/legacy = %d, want 2", got[0].Pods)
+			}
+
+			deployment, err := a.clientset.AppsV1().Deployments("a").Get(context.Background(), "legacy", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if to := deployment.Spec.Template.Annotations[k8tz.InjectionStrategyAnnotation]; to != tt.wantTo {
+				t.Errorf("Migrate() strategy of a/Deployment/legacy = %q, want %q", to, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestMigrator_Validate(t *testing.T) {
+	tests := []struct {
+		from    inject.InjectionStrategy
+		to      inject.InjectionStrategy
+		wantErr bool
+	}{
+		{from: inject.HostPathInjectionStrategy, to: inject.SidecarInjectionStrategy},
+		{from: inject.InitContainerInjectionStrategy, to: inject.InitContainerInjectionStrategy, wantErr: true},
+		{from: "nfs", to: inject.InitContainerInjectionStrategy, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%s", tt.from, tt.to), func(t *testing.T) {
+			m := NewMigrator()
+			m.From, m.To = tt.from, tt.to
+			if err := m.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
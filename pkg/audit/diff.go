@@ -0,0 +1,335 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/admission"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Injection is the timezone injection state of a pod
+type Injection struct {
+	Injected bool                     `json:"injected"`
+	Timezone string                   `json:"timezone,omitempty"`
+	Strategy inject.InjectionStrategy `json:"strategy,omitempty"`
+}
+
+// Difference is a single field of a pod that differs from the desired state
+type Difference struct {
+	Pod   string `json:"pod"`
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+// WorkloadDiff is the desired injection of a workload and the differences of
+// its live pods from it
+type WorkloadDiff struct {
+	Kind        string       `json:"kind"`
+	Namespace   string       `json:"namespace"`
+	Name        string       `json:"name"`
+	Desired     Injection    `json:"desired"`
+	Differences []Difference `json:"differences"`
+}
+
+// workload is a pod template and the selector of the pods created from it
+type workload struct {
+	kind     string
+	meta     metav1.ObjectMeta
+	template corev1.PodTemplateSpec
+	selector *metav1.LabelSelector
+}
+
+// Diff computes the injection that each Deployment, StatefulSet and DaemonSet
+// should have under the policy of the handler and compares it with the live
+// pods of the workload. Workloads without differences are included with an
+// empty list of differences.
+func (a *Auditor) Diff(ctx context.Context, policy *admission.RequestsHandler) ([]WorkloadDiff, error) {
+	policy.SetClientset(a.clientset)
+
+	namespaces, err := a.namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := []WorkloadDiff{}
+	for _, namespace := range namespaces {
+		workloads, err := a.workloads(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, w := range workloads {
+			diff, err := a.diffWorkload(ctx, policy, w)
+			if err != nil {
+				return nil, err
+			}
+
+			diffs = append(diffs, diff)
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Namespace != diffs[j].Namespace {
+			return diffs[i].Namespace < diffs[j].Namespace
+		}
+		if diffs[i].Kind != diffs[j].Kind {
+			return diffs[i].Kind < diffs[j].Kind
+		}
+		return diffs[i].Name < diffs[j].Name
+	})
+
+	return diffs, nil
+}
+
+func (a *Auditor) workloads(ctx context.Context, namespace string) ([]workload, error) {
+	var workloads []workload
+
+	deployments, err := a.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments in namespace %s: %w", namespace, err)
+	}
+	for _, d := range deployments.Items {
+		workloads = append(workloads, workload{kind: "Deployment", meta: d.ObjectMeta, template: d.Spec.Template, selector: d.Spec.Selector})
+	}
+
+	statefulSets, err := a.clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace %s: %w", namespace, err)
+	}
+	for _, s := range statefulSets.Items {
+		workloads = append(workloads, workload{kind: "StatefulSet", meta: s.ObjectMeta, template: s.Spec.Template, selector: s.Spec.Selector})
+	}
+
+	daemonSets, err := a.clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets in namespace %s: %w", namespace, err)
+	}
+	for _, d := range daemonSets.Items {
+		workloads = append(workloads, workload{kind: "DaemonSet", meta: d.ObjectMeta, template: d.Spec.Template, selector: d.Spec.Selector})
+	}
+
+	return workloads, nil
+}
+
+func (a *Auditor) diffWorkload(ctx context.Context, policy *admission.RequestsHandler, w workload) (WorkloadDiff, error) {
+	diff := WorkloadDiff{
+		Kind:        w.kind,
+		Namespace:   w.meta.Namespace,
+		Name:        w.meta.Name,
+		Differences: []Difference{},
+	}
+
+	desired, err := desiredInjection(policy, w)
+	if err != nil {
+		return diff, fmt.Errorf("failed to compute desired injection of %s %s/%s: %w", w.kind, w.meta.Namespace, w.meta.Name, err)
+	}
+	diff.Desired = desired
+
+	selector, err := metav1.LabelSelectorAsSelector(w.selector)
+	if err != nil {
+		return diff, fmt.Errorf("invalid selector of %s %s/%s: %w", w.kind, w.meta.Namespace, w.meta.Name, err)
+	}
+
+	pods, err := a.clientset.CoreV1().Pods(w.meta.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return diff, fmt.Errorf("failed to list pods of %s %s/%s: %w", w.kind, w.meta.Namespace, w.meta.Name, err)
+	}
+
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+
+	for i := range pods.Items {
+		diff.Differences = append(diff.Differences, compareInjection(pods.Items[i].Name, desired, liveInjection(&pods.Items[i]))...)
+	}
+
+	return diff, nil
+}
+
+// desiredInjection returns the injection that the pods of the workload should
+// have. Templates that were injected ahead of time (k8tz inject) are the
+// source of truth, otherwise the webhook policy decides.
+func desiredInjection(policy *admission.RequestsHandler, w workload) (Injection, error) {
+	if injected, _ := strconv.ParseBool(w.template.Annotations[k8tz.InjectedAnnotation]); injected {
+		return Injection{
+			Injected: true,
+			Timezone: w.template.Annotations[k8tz.TimezoneAnnotation],
+			Strategy: injectionStrategy(&w.template.Spec),
+		}, nil
+	}
+
+	pod := &corev1.Pod{ObjectMeta: *w.template.ObjectMeta.DeepCopy(), Spec: *w.template.Spec.DeepCopy()}
+	pod.Namespace = w.meta.Namespace
+	pod.Name = w.meta.Name
+
+	generator, err := policy.Decide(w.meta.Namespace, pod)
+	if err != nil {
+		return Injection{}, err
+	}
+
+	if generator == nil {
+		return Injection{Injected: false}, nil
+	}
+
+	strategy := generator.Strategy
+	if strategy == inject.SidecarInjectionStrategy {
+		// the sidecar strategy uses the emptyDir volume of initContainer and
+		// the restartPolicy of containers is missing from the API types, so
+		// they cannot be told apart
+		strategy = inject.InitContainerInjectionStrategy
+	}
+
+	return Injection{Injected: true, Timezone: generator.Timezone, Strategy: strategy}, nil
+}
+
+// liveInjection returns the injection of a pod from its annotations and the
+// volume that k8tz added
+func liveInjection(pod *corev1.Pod) Injection {
+	injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation])
+	if !injected {
+		return Injection{Injected: false}
+	}
+
+	return Injection{
+		Injected: true,
+		Timezone: pod.Annotations[k8tz.TimezoneAnnotation],
+		Strategy: injectionStrategy(&pod.Spec),
+	}
+}
+
+// injectionStrategy detects the strategy from the type of the k8tz volume and
+// the TZDIR variable of the tzdata strategy, an empty strategy is returned if
+// it cannot be detected
+func injectionStrategy(spec *corev1.PodSpec) inject.InjectionStrategy {
+	for _, v := range spec.Volumes {
+		if v.Name != inject.VolumeName {
+			continue
+		}
+
+		if v.HostPath != nil {
+			return inject.HostPathInjectionStrategy
+		}
+
+		if v.EmptyDir != nil {
+			if hasTzdir(spec) {
+				return inject.TzdataInjectionStrategy
+			}
+
+			if hasEnv(spec, "FAKETIME") {
+				return inject.FaketimeInjectionStrategy
+			}
+
+			return inject.InitContainerInjectionStrategy
+		}
+
+		if v.CSI != nil {
+			return inject.CSIInjectionStrategy
+		}
+
+		// the image source is missing from the API types
+		if v.VolumeSource == (corev1.VolumeSource{}) {
+			return inject.ImageVolumeInjectionStrategy
+		}
+	}
+
+	return ""
+}
+
+// hasTzdir returns true if any container has the TZDIR variable
+func hasTzdir(spec *corev1.PodSpec) bool {
+	return hasEnv(spec, "TZDIR")
+}
+
+// hasEnv returns true if any container of the pod has the variable
+func hasEnv(spec *corev1.PodSpec, name string) bool {
+	for _, c := range spec.Containers {
+		for _, e := range c.Env {
+			if e.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func compareInjection(pod string, want, got Injection) []Difference {
+	if want.Injected != got.Injected {
+		return []Difference{{Pod: pod, Field: "injected", Want: strconv.FormatBool(want.Injected), Got: strconv.FormatBool(got.Injected)}}
+	}
+
+	if !want.Injected {
+		return nil
+	}
+
+	var differences []Difference
+	if want.Timezone != got.Timezone {
+		differences = append(differences, Difference{Pod: pod, Field: "timezone", Want: want.Timezone, Got: got.Timezone})
+	}
+
+	if want.Strategy != "" && got.Strategy != "" && want.Strategy != got.Strategy {
+		differences = append(differences, Difference{Pod: pod, Field: "strategy", Want: string(want.Strategy), Got: string(got.Strategy)})
+	}
+
+	return differences
+}
+
+// WriteDiff prints the workload diffs to the output in the configured format,
+// the table output lists only the differences
+func (a *Auditor) WriteDiff(diffs []WorkloadDiff, out io.Writer) error {
+	switch a.Output {
+	case JSONOutput:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diffs)
+	case TableOutput:
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tWORKLOAD\tPOD\tFIELD\tWANT\tGOT")
+		for _, d := range diffs {
+			for _, difference := range d.Differences {
+				fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\t%s\t%s\n", d.Namespace, d.Kind, d.Name, difference.Pod, difference.Field, difference.Want, difference.Got)
+			}
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", a.Output)
+}
+
+// Drifted returns the number of workloads with differences
+func Drifted(diffs []WorkloadDiff) int {
+	drifted := 0
+	for _, d := range diffs {
+		if len(d.Differences) > 0 {
+			drifted++
+		}
+	}
+
+	return drifted
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// referenceKinds maps the kinds and their kubectl aliases to the kinds of the
+// objects that can be fetched by reference
+var referenceKinds = map[string]string{
+	"pod": "Pod", "pods": "Pod", "po": "Pod",
+	"deployment": "Deployment", "deployments": "Deployment", "deploy": "Deployment",
+	"statefulset": "StatefulSet", "statefulsets": "StatefulSet", "sts": "StatefulSet",
+	"daemonset": "DaemonSet", "daemonsets": "DaemonSet", "ds": "DaemonSet",
+	"replicaset": "ReplicaSet", "replicasets": "ReplicaSet", "rs": "ReplicaSet",
+	"job": "Job", "jobs": "Job",
+	"cronjob": "CronJob", "cronjobs": "CronJob", "cj": "CronJob",
+}
+
+// ParseReference parses an object reference like kubectl does, e.g.
+// deployment/foo. False is returned if the argument is an existing path or is
+// not a reference of a supported kind.
+func ParseReference(arg string) (kind string, name string, ok bool) {
+	if _, err := os.Stat(arg); err == nil {
+		return "", "", false
+	}
+
+	parts := strings.Split(arg, "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false
+	}
+
+	kind, ok = referenceKinds[strings.ToLower(parts[0])]
+	if !ok {
+		return "", "", false
+	}
+
+	return kind, parts[1], true
+}
+
+// Manifest returns the YAML manifest of the object of the kind in the
+// namespace of the auditor, or in the namespace of the kubeconfig context if
+// no namespace is set. The managed fields are removed.
+func (a *Auditor) Manifest(ctx context.Context, kind string, name string) ([]byte, error) {
+	namespace := a.Namespace
+	if namespace == "" {
+		namespace = a.contextNamespace
+	}
+
+	var (
+		object runtime.Object
+		meta   *metav1.ObjectMeta
+		err    error
+	)
+
+	switch kind {
+	case "Pod":
+		var o *corev1.Pod
+		if o, err = a.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: kind}
+		}
+	case "Deployment":
+		var o *appsv1.Deployment
+		if o, err = a.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	case "StatefulSet":
+		var o *appsv1.StatefulSet
+		if o, err = a.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	case "DaemonSet":
+		var o *appsv1.DaemonSet
+		if o, err = a.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	case "ReplicaSet":
+		var o *appsv1.ReplicaSet
+		if o, err = a.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: appsv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	case "Job":
+		var o *batchv1.Job
+		if o, err = a.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: batchv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	case "CronJob":
+		var o *batchv1.CronJob
+		if o, err = a.clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			object, meta = o, &o.ObjectMeta
+			o.TypeMeta = metav1.TypeMeta{APIVersion: batchv1.SchemeGroupVersion.String(), Kind: kind}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind: %s", kind)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+	}
+
+	meta.ManagedFields = nil
+	return yaml.Marshal(object)
+}
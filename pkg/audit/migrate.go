@@ -0,0 +1,303 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// MigrationFieldManager is the field manager of the server-side apply of the
+// migrated workloads
+const MigrationFieldManager = "k8tz-migrate"
+
+// MigrationStatus is the result of the migration of a single workload
+type MigrationStatus string
+
+const (
+	// MigrationApplied is the status of workloads whose pod template was
+	// annotated with the new strategy
+	MigrationApplied MigrationStatus = "migrated"
+	// MigrationDryRun is the status of workloads that would be migrated
+	MigrationDryRun MigrationStatus = "dry-run"
+	// MigrationSkipped is the status of workloads that cannot be migrated
+	MigrationSkipped MigrationStatus = "skipped"
+	// MigrationFailed is the status of workloads whose apply failed
+	MigrationFailed MigrationStatus = "failed"
+)
+
+// Migrator moves the pods that were injected by the admission controller with
+// one strategy to another strategy
+type Migrator struct {
+	From          inject.InjectionStrategy
+	To            inject.InjectionStrategy
+	DryRun        bool
+	BatchSize     int
+	BatchInterval time.Duration
+}
+
+func NewMigrator() Migrator {
+	return Migrator{
+		From:          inject.HostPathInjectionStrategy,
+		To:            inject.InitContainerInjectionStrategy,
+		DryRun:        false,
+		BatchSize:     10,
+		BatchInterval: 30 * time.Second,
+	}
+}
+
+// Migration is the migration of a single workload
+type Migration struct {
+	Kind      string          `json:"kind"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Pods      int             `json:"pods"`
+	Status    MigrationStatus `json:"status"`
+	Message   string          `json:"message,omitempty"`
+}
+
+// Validate checks that both strategies are known and differ
+func (m *Migrator) Validate() error {
+	for _, strategy := range []inject.InjectionStrategy{m.From, m.To} {
+		if _, ok := inject.LookupStrategy(strategy); !ok {
+			return fmt.Errorf("unknown injection strategy: %q", strategy)
+		}
+	}
+
+	if m.From == m.To {
+		return fmt.Errorf("the strategy to migrate to must differ from %s", m.From)
+	}
+
+	return nil
+}
+
+// Migrate finds the Deployments, StatefulSets and DaemonSets whose live pods
+// were injected with the From strategy, and annotates their pod templates with
+// the To strategy via server-side apply. The change rolls out the pods, which
+// the admission controller injects again with the new strategy. Namespaces
+// are migrated one at a time in batches of up to BatchSize workloads (the
+// whole namespace if not positive), with a pause of BatchInterval between the
+// batches so the rollouts are spread. Nothing is applied in a dry run.
+func (a *Auditor) Migrate(ctx context.Context, m *Migrator) ([]Migration, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	namespaces, err := a.namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(namespaces)
+
+	migrations := []Migration{}
+	applied := false
+	for _, namespace := range namespaces {
+		workloads, err := a.workloads(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		// every namespace starts a new batch
+		batch := 0
+		for _, w := range workloads {
+			migration, err := a.migration(ctx, m, w)
+			if err != nil {
+				return nil, err
+			}
+
+			if migration == nil {
+				continue
+			}
+
+			if migration.Status == "" {
+				if applied && (batch == 0 || batch == m.BatchSize) {
+					if err := waitBatch(ctx, m.BatchInterval); err != nil {
+						return migrations, err
+					}
+					batch = 0
+				}
+
+				a.applyMigration(ctx, m, w, migration)
+				batch++
+				applied = !m.DryRun
+			}
+
+			migrations = append(migrations, *migration)
+		}
+	}
+
+	return migrations, nil
+}
+
+// migration returns the migration of the workload, nil is returned if none of
+// its pods was injected with the From strategy. The status is empty if the
+// workload must be migrated.
+func (a *Auditor) migration(ctx context.Context, m *Migrator, w workload) (*Migration, error) {
+	selector, err := metav1.LabelSelectorAsSelector(w.selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of %s %s/%s: %w", w.kind, w.meta.Namespace, w.meta.Name, err)
+	}
+
+	pods, err := a.clientset.CoreV1().Pods(w.meta.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s %s/%s: %w", w.kind, w.meta.Namespace, w.meta.Name, err)
+	}
+
+	// the sidecar strategy uses the emptyDir volume of initContainer, so their
+	// pods cannot be told apart
+	from := m.From
+	if from == inject.SidecarInjectionStrategy {
+		from = inject.InitContainerInjectionStrategy
+	}
+
+	migration := &Migration{Kind: w.kind, Namespace: w.meta.Namespace, Name: w.meta.Name}
+	for i := range pods.Items {
+		if live := liveInjection(&pods.Items[i]); live.Injected && live.Strategy == from {
+			migration.Pods++
+		}
+	}
+
+	switch {
+	case migration.Pods == 0:
+		return nil, nil
+	case isInjectedTemplate(&w.template.ObjectMeta):
+		migration.Status = MigrationSkipped
+		migration.Message = "the pod template is injected, inject its manifests again with the new strategy"
+	case inject.InjectionStrategy(w.template.Annotations[k8tz.InjectionStrategyAnnotation]) == m.To:
+		migration.Status = MigrationSkipped
+		migration.Message = fmt.Sprintf("the pod template already has the %s strategy, its pods were not recreated yet", m.To)
+	}
+
+	return migration, nil
+}
+
+// applyMigration sets the k8tz.io/strategy annotation of the pod template,
+// the failure is recorded in the migration so the other workloads are still
+// migrated
+func (a *Auditor) applyMigration(ctx context.Context, m *Migrator, w workload, migration *Migration) {
+	if m.DryRun {
+		migration.Status = MigrationDryRun
+		migration.Message = fmt.Sprintf("would be migrated to the %s strategy", m.To)
+		return
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"apiVersion": appsv1.SchemeGroupVersion.String(),
+		"kind":       w.kind,
+		"metadata":   map[string]string{"name": w.meta.Name, "namespace": w.meta.Namespace},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{k8tz.InjectionStrategyAnnotation: string(m.To)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		migration.Status = MigrationFailed
+		migration.Message = err.Error()
+		return
+	}
+
+	force := true
+	options := metav1.PatchOptions{FieldManager: MigrationFieldManager, Force: &force}
+	switch w.kind {
+	case "Deployment":
+		_, err = a.clientset.AppsV1().Deployments(w.meta.Namespace).Patch(ctx, w.meta.Name, types.ApplyPatchType, patch, options)
+	case "StatefulSet":
+		_, err = a.clientset.AppsV1().StatefulSets(w.meta.Namespace).Patch(ctx, w.meta.Name, types.ApplyPatchType, patch, options)
+	case "DaemonSet":
+		_, err = a.clientset.AppsV1().DaemonSets(w.meta.Namespace).Patch(ctx, w.meta.Name, types.ApplyPatchType, patch, options)
+	default:
+		err = fmt.Errorf("unsupported kind: %s", w.kind)
+	}
+
+	if err != nil {
+		migration.Status = MigrationFailed
+		migration.Message = err.Error()
+		return
+	}
+
+	migration.Status = MigrationApplied
+	migration.Message = fmt.Sprintf("migrated to the %s strategy", m.To)
+}
+
+func isInjectedTemplate(meta *metav1.ObjectMeta) bool {
+	injected, _ := strconv.ParseBool(meta.Annotations[k8tz.InjectedAnnotation])
+	return injected
+}
+
+// waitBatch pauses between two batches of migrated workloads
+func waitBatch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Failed returns the number of workloads whose migration failed
+func Failed(migrations []Migration) int {
+	failed := 0
+	for _, m := range migrations {
+		if m.Status == MigrationFailed {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// WriteMigrate prints the migrations to the output in the configured format
+func (a *Auditor) WriteMigrate(migrations []Migration, out io.Writer) error {
+	switch a.Output {
+	case JSONOutput:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(migrations)
+	case TableOutput:
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tWORKLOAD\tPODS\tSTATUS\tMESSAGE")
+		for _, m := range migrations {
+			fmt.Fprintf(w, "%s\t%s/%s\t%d\t%s\t%s\n", m.Namespace, m.Kind, m.Name, m.Pods, m.Status, m.Message)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", a.Output)
+}
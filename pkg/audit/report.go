@@ -0,0 +1,36 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	"github.com/k8tz/k8tz/pkg/report"
+)
+
+// Report returns the timezone inventory of the pods, the current tz database
+// version is detected from the ZoneInfoPath when TzdataVersion is empty
+func (a *Auditor) Report(ctx context.Context) (*report.Report, error) {
+	version := a.TzdataVersion
+	if version == "" {
+		// without a version the stale pods are not reported
+		version, _ = inject.TzdataVersion(a.ZoneInfoPath)
+	}
+
+	return report.Build(ctx, a.clientset, a.Namespace, version)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Mismatch is a container of an injected pod whose TZ environment variable
+// does not match the timezone of the pod annotations
+type Mismatch struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Want      string `json:"want"`
+	Got       string `json:"got"`
+}
+
+// Verify checks that the containers of the injected pods have the TZ
+// environment variable of the timezone in their k8tz.io/timezone and
+// k8tz.io/container-timezones annotations. A TZ in the POSIX format matches
+// when the POSIX rule of the timezone can be derived from ZoneInfoPath.
+func (a *Auditor) Verify(ctx context.Context) ([]Mismatch, error) {
+	namespaces, err := a.namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []Mismatch{}
+	for _, namespace := range namespaces {
+		list, err := a.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods in namespace %s: %w", namespace, err)
+		}
+
+		for i := range list.Items {
+			mismatches = append(mismatches, a.verifyPod(&list.Items[i])...)
+		}
+	}
+
+	sort.SliceStable(mismatches, func(i, j int) bool {
+		if mismatches[i].Namespace != mismatches[j].Namespace {
+			return mismatches[i].Namespace < mismatches[j].Namespace
+		}
+		return mismatches[i].Pod < mismatches[j].Pod
+	})
+
+	return mismatches, nil
+}
+
+func (a *Auditor) verifyPod(pod *corev1.Pod) []Mismatch {
+	if injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation]); !injected {
+		return nil
+	}
+
+	// an invalid annotation is rejected by the webhook, so it is not expected
+	// on an injected pod and the pod timezone is used for all the containers
+	containerTimezones, _ := inject.ParseContainerTimezones(pod.Annotations[k8tz.ContainerTimezonesAnnotation])
+
+	var mismatches []Mismatch
+	for _, c := range pod.Spec.Containers {
+		want := pod.Annotations[k8tz.TimezoneAnnotation]
+		if v, ok := containerTimezones[c.Name]; ok {
+			want = v
+		}
+
+		got := ""
+		for _, env := range c.Env {
+			if env.Name == "TZ" {
+				got = env.Value
+			}
+		}
+
+		if !a.timezoneMatches(want, got) {
+			mismatches = append(mismatches, Mismatch{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Container: c.Name,
+				Want:      want,
+				Got:       got,
+			})
+		}
+	}
+
+	return mismatches
+}
+
+// timezoneMatches returns true if the TZ value is the timezone name or its
+// POSIX rule
+func (a *Auditor) timezoneMatches(timezone string, tz string) bool {
+	if tz == timezone {
+		return true
+	}
+
+	posix, err := inject.PosixTZ(a.ZoneInfoPath, timezone)
+	return err == nil && tz == posix
+}
+
+// WriteVerify prints the mismatches to the output in the configured format
+func (a *Auditor) WriteVerify(mismatches []Mismatch, out io.Writer) error {
+	switch a.Output {
+	case JSONOutput:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(mismatches)
+	case TableOutput:
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tPOD\tCONTAINER\tWANT\tGOT")
+		for _, m := range mismatches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Namespace, m.Pod, m.Container, m.Want, m.Got)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", a.Output)
+}
@@ -1,21 +1,53 @@
 package bootstrap
 
-import "github.com/k8tz/k8tz/pkg/inject"
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+)
 
 type BootstrapOperation struct {
 	From      string
 	To        string
 	Overwrite bool
+	KeepAlive time.Duration
+	Check     bool
 }
 
 func NewBootstrapOperation() BootstrapOperation {
 	return BootstrapOperation{
 		From:      inject.DefaultHostPathPrefix,
-		To:        "/mnt/zoneinfo",
+		To:        inject.BootstrapMountPath,
 		Overwrite: true,
+		KeepAlive: 0,
+		Check:     false,
 	}
 }
 
+// Bootstrap copies the zoneinfo directory to the target directory. When
+// KeepAlive is set, the operation never returns successfully and the files
+// are copied again every KeepAlive interval, this is used when the bootstrap
+// container runs as a native sidecar.
 func (o *BootstrapOperation) Bootstrap() error {
-	return copyDirectory(o.From, o.To, o.Overwrite)
+	if o.Check {
+		return checkDirectory(o.From, o.To)
+	}
+
+	if err := copyDirectory(o.From, o.To, o.Overwrite); err != nil {
+		return err
+	}
+
+	if o.KeepAlive <= 0 {
+		return nil
+	}
+
+	for {
+		time.Sleep(o.KeepAlive)
+		fmt.Fprintf(os.Stderr, "refreshing '%s' from '%s'\n", o.To, o.From)
+		if err := copyDirectory(o.From, o.To, o.Overwrite); err != nil {
+			return err
+		}
+	}
 }
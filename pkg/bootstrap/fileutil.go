@@ -144,3 +144,29 @@ func copySymLinkIfNotExists(source, dest string, force bool) error {
 	fmt.Fprintf(os.Stderr, "symlink created: '%s' => '%s'\n", dest, link)
 	return nil
 }
+
+// checkDirectory verifies that every file in src also exists in dst, it is
+// used as a startup probe to tell when the initial copy is complete
+func checkDirectory(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		sourcePath := filepath.Join(src, entry.Name())
+		destPath := filepath.Join(dst, entry.Name())
+
+		if _, err := os.Lstat(destPath); err != nil {
+			return fmt.Errorf("'%s' is not bootstrapped yet: %w", destPath, err)
+		}
+
+		if entry.IsDir() {
+			if err := checkDirectory(sourcePath, destPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
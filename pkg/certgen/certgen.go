@@ -0,0 +1,339 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/version"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// CAKey is the key of the CA certificate in the secret, next to the
+	// standard tls.crt and tls.key keys
+	CAKey = "ca.crt"
+
+	rsaKeySize = 2048
+)
+
+var (
+	verboseLogger *log.Logger
+	warningLogger *log.Logger
+	infoLogger    *log.Logger
+	errorLogger   *log.Logger
+)
+
+// CertGen provisions a self-signed CA and a serving certificate for the
+// webhook service, stores them in a Secret and patches the caBundle of the
+// MutatingWebhookConfiguration, so no external certificate tooling is needed
+type CertGen struct {
+	SecretName      string
+	SecretNamespace string
+	ServiceName     string
+	WebhookName     string
+	Validity        time.Duration
+	RenewBefore     time.Duration
+	Verbose         bool
+	clientset       kubernetes.Interface
+	now             func() time.Time
+}
+
+func NewCertGen() *CertGen {
+	return &CertGen{
+		SecretName:      "k8tz-tls",
+		SecretNamespace: "k8tz",
+		ServiceName:     "k8tz",
+		WebhookName:     "k8tz",
+		Validity:        5 * 365 * 24 * time.Hour,
+		RenewBefore:     30 * 24 * time.Hour,
+		Verbose:         false,
+		clientset:       nil,
+		now:             time.Now,
+	}
+}
+
+func (g *CertGen) Start(kubeconfigFlag string) error {
+	infoLogger.Println(version.DisplayVersion())
+
+	if g.Verbose {
+		verboseLogger.SetOutput(os.Stderr)
+		verboseLogger.Printf("certgen=%+v", *g)
+	}
+
+	err := g.initializeClientset(kubeconfigFlag)
+	if err != nil {
+		errorLogger.Printf("failed to setup connection with kubernetes api: %v", err)
+		return fmt.Errorf("failed to setup connection with kubernetes api: %w", err)
+	}
+
+	return g.Provision(context.Background())
+}
+
+// Provision makes sure the secret holds a valid certificate for the service,
+// generating a new CA and certificate if needed, and that the webhook trusts
+// its CA
+func (g *CertGen) Provision(ctx context.Context) error {
+	ca, err := g.provisionSecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	return g.patchCABundle(ctx, ca)
+}
+
+// DNSNames returns the names the serving certificate is valid for
+func (g *CertGen) DNSNames() []string {
+	return []string{
+		g.ServiceName,
+		fmt.Sprintf("%s.%s", g.ServiceName, g.SecretNamespace),
+		fmt.Sprintf("%s.%s.svc", g.ServiceName, g.SecretNamespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", g.ServiceName, g.SecretNamespace),
+	}
+}
+
+// provisionSecret returns the CA certificate (PEM) of the secret, the secret is
+// created or replaced when its certificate is missing, invalid, expires within
+// RenewBefore or does not cover the service names
+func (g *CertGen) provisionSecret(ctx context.Context) ([]byte, error) {
+	secrets := g.clientset.CoreV1().Secrets(g.SecretNamespace)
+	secret, err := secrets.Get(ctx, g.SecretName, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", g.SecretNamespace, g.SecretName, err)
+	}
+
+	exists := err == nil
+	if exists {
+		err := g.validate(secret.Data)
+		if err == nil {
+			infoLogger.Printf("secret %s/%s has a valid certificate, keeping it", g.SecretNamespace, g.SecretName)
+			return secret.Data[CAKey], nil
+		}
+
+		infoLogger.Printf("secret %s/%s will be regenerated: %v", g.SecretNamespace, g.SecretName, err)
+	}
+
+	caPEM, certPEM, keyPEM, err := GenerateCertificates(g.DNSNames(), g.now(), g.Validity)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{
+		corev1.TLSCertKey:       certPEM,
+		corev1.TLSPrivateKeyKey: keyPEM,
+		CAKey:                   caPEM,
+	}
+
+	if exists {
+		secret.Data = data
+		secret.Type = corev1.SecretTypeTLS
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to update secret %s/%s: %w", g.SecretNamespace, g.SecretName, err)
+		}
+	} else {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: g.SecretName, Namespace: g.SecretNamespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to create secret %s/%s: %w", g.SecretNamespace, g.SecretName, err)
+		}
+	}
+
+	infoLogger.Printf("stored new certificate in secret %s/%s, valid until %s", g.SecretNamespace, g.SecretName, g.now().Add(g.Validity))
+	return caPEM, nil
+}
+
+// validate checks that the secret data holds a CA and a key pair signed by it
+// that is valid for the service names for at least RenewBefore
+func (g *CertGen) validate(data map[string][]byte) error {
+	pair, err := tls.X509KeyPair(data[corev1.TLSCertKey], data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("invalid key pair: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data[CAKey]) {
+		return fmt.Errorf("missing or invalid %s", CAKey)
+	}
+
+	for _, name := range g.DNSNames() {
+		_, err := cert.Verify(x509.VerifyOptions{
+			DNSName:     name,
+			Roots:       roots,
+			CurrentTime: g.now().Add(g.RenewBefore),
+		})
+		if err != nil {
+			return fmt.Errorf("certificate is not valid for %s until %s: %w", name, g.now().Add(g.RenewBefore), err)
+		}
+	}
+
+	return nil
+}
+
+// patchCABundle sets the CA as the caBundle of all the webhooks of the
+// MutatingWebhookConfiguration
+func (g *CertGen) patchCABundle(ctx context.Context, ca []byte) error {
+	configurations := g.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	configuration, err := configurations.Get(ctx, g.WebhookName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration %s: %w", g.WebhookName, err)
+	}
+
+	changed := false
+	for i := range configuration.Webhooks {
+		if !bytes.Equal(configuration.Webhooks[i].ClientConfig.CABundle, ca) {
+			configuration.Webhooks[i].ClientConfig.CABundle = ca
+			changed = true
+		}
+	}
+
+	if !changed {
+		infoLogger.Printf("caBundle of mutating webhook configuration %s is up to date", g.WebhookName)
+		return nil
+	}
+
+	if _, err := configurations.Update(ctx, configuration, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update mutating webhook configuration %s: %w", g.WebhookName, err)
+	}
+
+	infoLogger.Printf("patched caBundle of mutating webhook configuration %s", g.WebhookName)
+	return nil
+}
+
+// GenerateCertificates generates a self-signed CA and a serving certificate
+// signed by it for the DNS names, and returns the CA certificate, the serving
+// certificate and its key in PEM format
+func GenerateCertificates(dnsNames []string, notBefore time.Time, validity time.Duration) ([]byte, []byte, []byte, error) {
+	caKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "k8tz-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[len(dnsNames)-1]},
+		DNSNames:     dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return caPEM, certPEM, keyPEM, nil
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+
+	return serial
+}
+
+func getKubeconfig(kubeconfPath string) (*restclient.Config, error) {
+	if kubeconfPath == "" {
+		verboseLogger.Println("--kubeconfig not specified. Using the inClusterConfig. This might not work.")
+		kubeconfig, err := restclient.InClusterConfig()
+		if err == nil {
+			return kubeconfig, nil
+		}
+
+		warningLogger.Println("error creating inClusterConfig, falling back to default config.")
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfPath},
+		&clientcmd.ConfigOverrides{ClusterInfo: clientcmdapi.Cluster{Server: ""}}).ClientConfig()
+}
+
+func (g *CertGen) initializeClientset(kubeconfPath string) error {
+	config, err := getKubeconfig(kubeconfPath)
+	if err != nil {
+		return fmt.Errorf("failed to get in-cluster config: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create k8s client: %v", err)
+	}
+
+	g.clientset = clientset
+	return nil
+}
+
+func init() {
+	verboseLogger = log.New(io.Discard, "VERBOSE: ", log.Ldate|log.Ltime|log.Lshortfile)
+	infoLogger = log.New(os.Stdout, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	warningLogger = log.New(os.Stderr, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
+	errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+}
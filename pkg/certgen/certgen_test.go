@@ -0,0 +1,141 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certgen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCertGen_Provision(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	now := time.Now()
+	tests := []struct {
+		name           string
+		existing       func(g *CertGen) map[string][]byte
+		wantRegenerate bool
+	}{
+		{
+			name:           "missing secret",
+			existing:       nil,
+			wantRegenerate: true,
+		},
+		{
+			name: "valid secret",
+			existing: func(g *CertGen) map[string][]byte {
+				return generate(t, g.DNSNames(), now, time.Hour*24*365)
+			},
+			wantRegenerate: false,
+		},
+		{
+			name: "expiring secret",
+			existing: func(g *CertGen) map[string][]byte {
+				return generate(t, g.DNSNames(), now, time.Hour*24)
+			},
+			wantRegenerate: true,
+		},
+		{
+			name: "secret for another service",
+			existing: func(g *CertGen) map[string][]byte {
+				return generate(t, []string{"other.k8tz.svc"}, now, time.Hour*24*365)
+			},
+			wantRegenerate: true,
+		},
+		{
+			name: "invalid secret",
+			existing: func(g *CertGen) map[string][]byte {
+				return map[string][]byte{corev1.TLSCertKey: []byte("test"), corev1.TLSPrivateKeyKey: []byte("test")}
+			},
+			wantRegenerate: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewCertGen()
+			g.now = func() time.Time { return now }
+
+			webhook := &admissionregistrationv1.MutatingWebhookConfiguration{
+				ObjectMeta: v1.ObjectMeta{Name: g.WebhookName},
+				Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "admission-controller.k8tz.io"}},
+			}
+
+			var existing map[string][]byte
+			g.clientset = fake.NewSimpleClientset(webhook)
+			if tt.existing != nil {
+				existing = tt.existing(g)
+				secret := &corev1.Secret{ObjectMeta: v1.ObjectMeta{Name: g.SecretName, Namespace: g.SecretNamespace}, Data: existing}
+				g.clientset = fake.NewSimpleClientset(webhook, secret)
+			}
+
+			ctx := context.Background()
+			if err := g.Provision(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			secret, err := g.clientset.CoreV1().Secrets(g.SecretNamespace).Get(ctx, g.SecretName, v1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			regenerated := !bytes.Equal(secret.Data[corev1.TLSCertKey], existing[corev1.TLSCertKey])
+			if regenerated != tt.wantRegenerate {
+				t.Errorf("Provision() regenerated = %v, want %v", regenerated, tt.wantRegenerate)
+			}
+
+			if err := g.validate(secret.Data); err != nil {
+				t.Errorf("Provision() stored an invalid certificate: %v", err)
+			}
+
+			configuration, err := g.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, g.WebhookName, v1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(configuration.Webhooks[0].ClientConfig.CABundle, secret.Data[CAKey]) {
+				t.Errorf("Provision() did not patch the caBundle with the CA of the secret")
+			}
+		})
+	}
+}
+
+func TestCertGen_Provision_missingWebhook(t *testing.T) {
+	infoLogger.SetOutput(io.Discard)
+
+	g := NewCertGen()
+	g.clientset = fake.NewSimpleClientset()
+	if err := g.Provision(context.Background()); err == nil {
+		t.Errorf("Provision() without webhook configuration should fail")
+	}
+}
+
+func generate(t *testing.T, dnsNames []string, notBefore time.Time, validity time.Duration) map[string][]byte {
+	ca, cert, key, err := GenerateCertificates(dnsNames, notBefore, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string][]byte{corev1.TLSCertKey: cert, corev1.TLSPrivateKeyKey: key, CAKey: ca}
+}
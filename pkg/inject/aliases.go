@@ -0,0 +1,143 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+)
+
+//go:embed aliases
+var aliasesFile string
+
+// TimezoneAliases maps the deprecated and alias timezones to their canonical
+// timezone, e.g. "Asia/Calcutta" to "Asia/Kolkata"
+var TimezoneAliases map[string]string
+
+// TimezoneAbbreviations maps the abbreviations that are rejected instead of
+// timezones to the timezones that use them, e.g. "IST" to "Asia/Kolkata",
+// "Europe/Dublin" and "Asia/Jerusalem"
+var TimezoneAbbreviations map[string][]string
+
+func init() {
+	var err error
+	TimezoneAliases, TimezoneAbbreviations, err = parseAliases(aliasesFile)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// parseAliases parses the Link and Abbrev lines of the aliases file, a link
+// to another alias is not allowed so every alias is resolved in one lookup
+func parseAliases(data string) (map[string]string, map[string][]string, error) {
+	aliases := map[string]string{}
+	abbreviations := map[string][]string{}
+	for i, line := range strings.Split(data, "\n") {
+		if index := strings.IndexByte(line, '#'); index >= 0 {
+			line = line[:index]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch {
+		case fields[0] == "Link" && len(fields) == 3:
+			if _, ok := aliases[fields[2]]; ok {
+				return nil, nil, fmt.Errorf("line %d: duplicate alias %s", i+1, fields[2])
+			}
+			aliases[fields[2]] = fields[1]
+		case fields[0] == "Abbrev" && len(fields) >= 3:
+			abbreviations[fields[1]] = fields[2:]
+		default:
+			return nil, nil, fmt.Errorf("line %d: expected 'Link TARGET ALIAS' or 'Abbrev ABBREVIATION TIMEZONE...': %q", i+1, line)
+		}
+	}
+
+	for alias, target := range aliases {
+		if _, ok := aliases[target]; ok {
+			return nil, nil, fmt.Errorf("alias %s links to alias %s", alias, target)
+		}
+	}
+
+	return aliases, abbreviations, nil
+}
+
+// CanonicalTimezone returns the canonical timezone of an alias, other
+// timezones are returned as is. Abbreviations are rejected since most of them
+// are ambiguous and none of them follows the DST rules of a location.
+func CanonicalTimezone(timezone string) (string, error) {
+	if timezones, ok := TimezoneAbbreviations[timezone]; ok {
+		return "", fmt.Errorf("%q is a timezone abbreviation, use a timezone name instead, e.g. %s", timezone, strings.Join(timezones, ", "))
+	}
+
+	if target, ok := TimezoneAliases[timezone]; ok {
+		return target, nil
+	}
+
+	return timezone, nil
+}
+
+// SortedTimezoneAliases returns the aliases sorted by name
+func SortedTimezoneAliases() []string {
+	aliases := make([]string, 0, len(TimezoneAliases))
+	for alias := range TimezoneAliases {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+	return aliases
+}
+
+// canonical returns a copy of the generator with the canonical timezones, the
+// generator itself is returned if all of its timezones are canonical
+func (g *PatchGenerator) canonical() (*PatchGenerator, error) {
+	if g.Timezone == k8tz.AutoTimezone {
+		return nil, fmt.Errorf("the %s timezone can only be resolved by the admission webhook with --auto-timezone", k8tz.AutoTimezone)
+	}
+
+	timezone, err := CanonicalTimezone(g.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := timezone != g.Timezone
+	containerTimezones := make(map[string]string, len(g.ContainerTimezones))
+	for name, tz := range g.ContainerTimezones {
+		canonical, err := CanonicalTimezone(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone of container %s: %w", name, err)
+		}
+
+		changed = changed || canonical != tz
+		containerTimezones[name] = canonical
+	}
+
+	if !changed {
+		return g, nil
+	}
+
+	generator := *g
+	generator.Timezone = timezone
+	generator.ContainerTimezones = containerTimezones
+	return &generator, nil
+}
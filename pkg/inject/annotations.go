@@ -0,0 +1,123 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"strconv"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// withObjectAnnotations returns a copy of the generator with the k8tz
+// annotations of the object applied, the same way the admission webhook
+// applies them. The annotations of the pod template take precedence over the
+// annotations of the object. False is returned if the object should not be
+// injected, because it is already injected or injection is disabled.
+func (g *PatchGenerator) withObjectAnnotations(object interface{}) (*PatchGenerator, bool, error) {
+	generator := *g
+	for _, meta := range objectMetas(object) {
+		if isObjectInjected(meta) {
+			return nil, false, nil
+		}
+
+		if v, ok := meta.Annotations[k8tz.InjectionAnnotation]; ok {
+			switch v {
+			case k8tz.InjectionEnabled:
+			case k8tz.InjectionDisabled:
+				return nil, false, nil
+			default:
+				return nil, false, fmt.Errorf("invalid %s annotation value %q on %s, must be %s or %s", k8tz.InjectionAnnotation, v, meta.Name, k8tz.InjectionEnabled, k8tz.InjectionDisabled)
+			}
+		} else if v, ok := meta.Annotations[k8tz.InjectAnnotation]; ok {
+			inject, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s annotation value %q on %s: %w", k8tz.InjectAnnotation, v, meta.Name, err)
+			}
+
+			if !inject {
+				return nil, false, nil
+			}
+		}
+
+		if v, ok := meta.Annotations[k8tz.TimezoneAnnotation]; ok {
+			generator.Timezone = v
+		}
+
+		if v, ok := meta.Annotations[k8tz.InjectionStrategyAnnotation]; ok {
+			generator.Strategy = InjectionStrategy(v)
+		}
+
+		if v, ok := meta.Annotations[k8tz.LocaleAnnotation]; ok {
+			generator.Locale = v
+		}
+
+		if v, ok := meta.Annotations[k8tz.FaketimeAnnotation]; ok {
+			generator.Faketime = v
+		}
+
+		if v, ok := meta.Annotations[k8tz.TimezoneFormatAnnotation]; ok {
+			generator.TimezoneFormat = TimezoneFormat(v)
+		}
+
+		if v, ok := meta.Annotations[k8tz.TzdirAnnotation]; ok {
+			generator.Tzdir = v
+		}
+
+		if v, ok := meta.Annotations[k8tz.HostPathAnnotation]; ok {
+			generator.HostPathPrefix = v
+		}
+
+		if v, ok := meta.Annotations[k8tz.ContainerTimezonesAnnotation]; ok {
+			timezones, err := ParseContainerTimezones(v)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s annotation on %s: %w", k8tz.ContainerTimezonesAnnotation, meta.Name, err)
+			}
+
+			generator.ContainerTimezones = timezones
+		}
+	}
+
+	return &generator, true, nil
+}
+
+// objectMetas returns the metadata of the object followed by the metadata of
+// its pod template, if any
+func objectMetas(object interface{}) []*metav1.ObjectMeta {
+	switch o := object.(type) {
+	case *batchv1.CronJob:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.JobTemplate.Spec.Template.ObjectMeta}
+	case *appsv1.StatefulSet:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.Template.ObjectMeta}
+	case *appsv1.Deployment:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.Template.ObjectMeta}
+	case *appsv1.DaemonSet:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.Template.ObjectMeta}
+	case *appsv1.ReplicaSet:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.Template.ObjectMeta}
+	case *batchv1.Job:
+		return []*metav1.ObjectMeta{&o.ObjectMeta, &o.Spec.Template.ObjectMeta}
+	case *corev1.Pod:
+		return []*metav1.ObjectMeta{&o.ObjectMeta}
+	}
+
+	return nil
+}
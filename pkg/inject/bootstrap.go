@@ -0,0 +1,196 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// BootstrapSecurityContext is the configurable part of the securityContext
+// of the bootstrap container, privilege escalation is always disallowed and
+// all the capabilities are always dropped
+type BootstrapSecurityContext struct {
+	RunAsNonRoot           bool
+	ReadOnlyRootFilesystem bool
+	// SeccompProfile is RuntimeDefault when its type is empty
+	SeccompProfile SeccompProfile
+}
+
+// SeccompProfile is the seccomp profile of the bootstrap container, it
+// implements pflag.Value and is "RuntimeDefault", "Unconfined" or
+// "Localhost=<profile path>"
+type SeccompProfile string
+
+func (p *SeccompProfile) String() string {
+	return string(*p)
+}
+
+func (p *SeccompProfile) Set(value string) error {
+	profile := SeccompProfile(value)
+	if _, err := profile.seccompProfile(); err != nil {
+		return err
+	}
+
+	*p = profile
+	return nil
+}
+
+func (p *SeccompProfile) Type() string {
+	return "profile"
+}
+
+// seccompProfile returns the profile of the securityContext, RuntimeDefault
+// if the profile is empty
+func (p SeccompProfile) seccompProfile() (*corev1.SeccompProfile, error) {
+	profileType, path, _ := strings.Cut(string(p), "=")
+	switch corev1.SeccompProfileType(profileType) {
+	case "":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, nil
+	case corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined:
+		if path != "" {
+			return nil, fmt.Errorf("seccomp profile %s has no profile path", profileType)
+		}
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileType(profileType)}, nil
+	case corev1.SeccompProfileTypeLocalhost:
+		if path == "" {
+			return nil, fmt.Errorf("seccomp profile %s requires a profile path, e.g. %s=profiles/k8tz.json", profileType, profileType)
+		}
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown seccomp profile %q, expected RuntimeDefault, Unconfined or Localhost=<path>", string(p))
+}
+
+// ResourceList is a list of compute resources that implements pflag.Value,
+// it is set with comma separated name=quantity pairs, e.g. cpu=10m,memory=16Mi
+type ResourceList corev1.ResourceList
+
+func (r *ResourceList) String() string {
+	var values []string
+	for name, quantity := range *r {
+		values = append(values, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (r *ResourceList) Set(value string) error {
+	list := ResourceList{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, quantity, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid resource %q, expected name=quantity", pair)
+		}
+
+		q, err := resource.ParseQuantity(strings.TrimSpace(quantity))
+		if err != nil {
+			return fmt.Errorf("invalid quantity of resource %s: %w", name, err)
+		}
+
+		list[corev1.ResourceName(strings.TrimSpace(name))] = q
+	}
+
+	*r = list
+	return nil
+}
+
+func (r *ResourceList) Type() string {
+	return "resources"
+}
+
+// bootstrapSecurityContext returns the securityContext of the bootstrap
+// container, the seccomp profile is validated by forPodSpec
+func (g *PatchGenerator) bootstrapSecurityContext() *corev1.SecurityContext {
+	seccomp, err := g.InitContainerSecurityContext.SeccompProfile.seccompProfile()
+	if err != nil {
+		seccomp = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+
+	context := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &False,
+		SeccompProfile:           seccomp,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{
+				"ALL",
+			},
+		},
+	}
+
+	if g.InitContainerSecurityContext.RunAsNonRoot {
+		context.RunAsNonRoot = &True
+	}
+
+	if g.InitContainerSecurityContext.ReadOnlyRootFilesystem {
+		context.ReadOnlyRootFilesystem = &True
+	}
+
+	return context
+}
+
+// createImagePullSecretPatches adds the image pull secrets of the bootstrap
+// image that the pod does not reference yet
+func (g *PatchGenerator) createImagePullSecretPatches(spec *corev1.PodSpec, pathprefix string) k8tz.Patches {
+	var missing []corev1.LocalObjectReference
+	for _, name := range g.InitContainerImagePullSecrets {
+		referenced := false
+		for _, secret := range spec.ImagePullSecrets {
+			referenced = referenced || secret.Name == name
+		}
+
+		for _, secret := range missing {
+			referenced = referenced || secret.Name == name
+		}
+
+		if !referenced {
+			missing = append(missing, corev1.LocalObjectReference{Name: name})
+		}
+	}
+
+	var patches = k8tz.Patches{}
+	if len(missing) == 0 {
+		return patches
+	}
+
+	if len(spec.ImagePullSecrets) == 0 {
+		return append(patches, k8tz.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/imagePullSecrets", pathprefix),
+			Value: missing,
+		})
+	}
+
+	for _, secret := range missing {
+		patches = append(patches, k8tz.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/imagePullSecrets/-", pathprefix),
+			Value: secret,
+		})
+	}
+
+	return patches
+}
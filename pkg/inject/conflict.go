@@ -0,0 +1,111 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ConflictPolicy is what k8tz does with pods that already have a TZ variable,
+// a k8tz volume or a k8tz initContainer, either from a previous injection or
+// from a manual configuration
+type ConflictPolicy string
+
+const (
+	// ConflictSkip does not inject pods that have any of the artifacts
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictMerge keeps the existing artifacts and adds the missing ones
+	ConflictMerge ConflictPolicy = "merge"
+	// ConflictReplace replaces the existing artifacts with the injected ones
+	ConflictReplace ConflictPolicy = "replace"
+)
+
+// ConflictError is returned for pods with existing artifacts when the
+// ConflictPolicy is skip
+type ConflictError struct {
+	Conflicts []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("the pod already has %s", strings.Join(e.Conflicts, ", "))
+}
+
+func (p ConflictPolicy) validate() error {
+	switch p {
+	case "", ConflictSkip, ConflictMerge, ConflictReplace:
+		return nil
+	}
+
+	return fmt.Errorf("unknown conflict policy specified: %s", p)
+}
+
+// Conflicts returns the artifacts of k8tz that the pod already has, the
+// artifacts that are exactly the same as the injected ones are included
+func Conflicts(spec *corev1.PodSpec) []string {
+	var conflicts []string
+	for _, c := range spec.Containers {
+		if hasEnv(&c, "TZ") {
+			conflicts = append(conflicts, fmt.Sprintf("TZ variable in container '%s'", c.Name))
+		}
+	}
+
+	if volumeIndex(spec) >= 0 {
+		conflicts = append(conflicts, fmt.Sprintf("volume '%s'", VolumeName))
+	}
+
+	if initContainerIndex(spec) >= 0 {
+		conflicts = append(conflicts, fmt.Sprintf("initContainer '%s'", BootstrapContainerName))
+	}
+
+	return conflicts
+}
+
+// volumeIndex returns the index of the k8tz volume of the pod, or -1
+func volumeIndex(spec *corev1.PodSpec) int {
+	for i, v := range spec.Volumes {
+		if v.Name == VolumeName {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// initContainerIndex returns the index of the k8tz initContainer, or -1
+func initContainerIndex(spec *corev1.PodSpec) int {
+	for i, c := range spec.InitContainers {
+		if c.Name == BootstrapContainerName {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// envIndex returns the index of the variable in the container, or -1
+func envIndex(container *corev1.Container, name string) int {
+	for i, v := range container.Env {
+		if v.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,49 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseContainerTimezones parses the value of the container timezones
+// annotation, a comma separated list of container=timezone pairs, e.g.
+// "app=Asia/Jakarta,sidecar=UTC"
+func ParseContainerTimezones(value string) (map[string]string, error) {
+	timezones := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, timezone, ok := strings.Cut(pair, "=")
+		name, timezone = strings.TrimSpace(name), strings.TrimSpace(timezone)
+		if !ok || name == "" || timezone == "" {
+			return nil, fmt.Errorf("invalid container timezone %q, expected container=timezone", pair)
+		}
+
+		if _, exists := timezones[name]; exists {
+			return nil, fmt.Errorf("timezone of container %s is specified more than once", name)
+		}
+
+		timezones[name] = timezone
+	}
+
+	return timezones, nil
+}
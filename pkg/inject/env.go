@@ -0,0 +1,126 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ExtraEnv is a static set of environment variables that are injected in
+// addition to TZ, per injection strategy. It implements pflag.Value so it can
+// be set with repeated "strategy:NAME=value" flags.
+type ExtraEnv map[InjectionStrategy][]corev1.EnvVar
+
+func (e *ExtraEnv) String() string {
+	var values []string
+	for strategy, vars := range *e {
+		for _, v := range vars {
+			values = append(values, fmt.Sprintf("%s:%s=%s", strategy, v.Name, v.Value))
+		}
+	}
+
+	sort.Strings(values)
+	return "[" + strings.Join(values, ",") + "]"
+}
+
+func (e *ExtraEnv) Set(value string) error {
+	strategy, env, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("invalid extra env %q, expected strategy:NAME=value", value)
+	}
+
+	name, val, ok := strings.Cut(env, "=")
+	if !ok {
+		return fmt.Errorf("invalid extra env %q, expected strategy:NAME=value", value)
+	}
+
+	if *e == nil {
+		*e = ExtraEnv{}
+	}
+
+	s := InjectionStrategy(strategy)
+	(*e)[s] = append((*e)[s], corev1.EnvVar{Name: name, Value: val})
+
+	return e.validate()
+}
+
+func (e *ExtraEnv) Type() string {
+	return "strategy:NAME=value"
+}
+
+// reservedEnv are the environment variables that the generator injects
+// itself: the timezone, the locale, the tzdata directory of the tzdata
+// strategy and the fake time of the faketime strategy
+var reservedEnv = []string{"TZ", "LANG", "LC_ALL", "TZDIR", "FAKETIME"}
+
+// validate checks that the strategies are known, the names are legal
+// environment variable names and that they collide neither with the reserved
+// variables nor with each other
+func (e *ExtraEnv) validate() error {
+	for strategy, vars := range *e {
+		if _, ok := LookupStrategy(strategy); !ok || strategy.volumeStrategy() != strategy {
+			return fmt.Errorf("unknown injection strategy for extra env: %s", strategy)
+		}
+
+		names := map[string]bool{}
+		for _, name := range reservedEnv {
+			names[name] = true
+		}
+
+		for _, v := range vars {
+			if errs := validation.IsEnvVarName(v.Name); len(errs) > 0 {
+				return fmt.Errorf("invalid extra env name %q: %s", v.Name, strings.Join(errs, ", "))
+			}
+
+			if names[v.Name] {
+				return fmt.Errorf("extra env %s is already injected for %s strategy", v.Name, strategy)
+			}
+
+			names[v.Name] = true
+		}
+	}
+
+	return nil
+}
+
+// hasEnv returns true if the container already defines the environment variable
+func hasEnv(container *corev1.Container, name string) bool {
+	for _, v := range container.Env {
+		if v.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasEnvValue returns true if the container defines the variable with the
+// value and without a valueFrom source
+func hasEnvValue(container *corev1.Container, name, value string) bool {
+	for _, v := range container.Env {
+		if v.Name == name {
+			return v.Value == value && v.ValueFrom == nil
+		}
+	}
+
+	return false
+}
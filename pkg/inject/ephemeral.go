@@ -0,0 +1,140 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ForEphemeralContainers returns the patches that inject the ephemeral
+// containers at the given indexes of an already injected pod, e.g. the debug
+// containers of 'kubectl debug'. Volumes cannot be added to a running pod, so
+// the k8tz volume is mounted only if the pod has it, otherwise just the TZ
+// environment variable is set. Ephemeral containers may not use subPath
+// mounts, so the zoneinfo directory is mounted instead of the localtime file
+// and the timezone is resolved through TZ. Variables and mounts that the
+// container already defines are kept as is.
+func (g *PatchGenerator) ForEphemeralContainers(pod *corev1.Pod, indexes []int, pathprefix string) (k8tz.Patches, error) {
+	if err := g.ExtraEnv.validate(); err != nil {
+		return nil, err
+	}
+
+	g, err := g.canonical()
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := podVolumeStrategy(&pod.Spec)
+
+	var patches = k8tz.Patches{}
+	for _, i := range indexes {
+		// the common fields of ephemeral containers are the fields of Container
+		container := (*corev1.Container)(&pod.Spec.EphemeralContainers[i].EphemeralContainerCommon)
+		path := fmt.Sprintf("%s/spec/ephemeralContainers/%d", pathprefix, i)
+		timezone := g.containerTimezone(container)
+
+		env := []corev1.EnvVar{}
+		if !hasEnv(container, "TZ") {
+			value, err := g.timezoneValue(timezone)
+			if err != nil {
+				return nil, err
+			}
+
+			env = append(env, corev1.EnvVar{Name: "TZ", Value: value})
+		}
+
+		if strategy != "" {
+			for _, v := range g.ExtraEnv[strategy] {
+				if !hasEnv(container, v.Name) {
+					env = append(env, v)
+				}
+			}
+		}
+
+		if len(env) > 0 && len(container.Env) == 0 {
+			patches = append(patches, k8tz.Patch{Op: "add", Path: path + "/env", Value: []corev1.EnvVar{}})
+		}
+
+		for _, v := range env {
+			patches = append(patches, k8tz.Patch{Op: "add", Path: path + "/env/-", Value: v})
+		}
+
+		// the zoneinfo directory of csi and image volumes may need a subPath
+		if strategy == "" || g.zoneInfoSubPath(strategy) != "" || hasMount(container, "/usr/share/zoneinfo") {
+			continue
+		}
+
+		if len(container.VolumeMounts) == 0 {
+			patches = append(patches, k8tz.Patch{Op: "add", Path: path + "/volumeMounts", Value: []corev1.VolumeMount{}})
+		}
+
+		patches = append(patches, k8tz.Patch{
+			Op:   "add",
+			Path: path + "/volumeMounts/-",
+			Value: corev1.VolumeMount{
+				Name:      VolumeName,
+				ReadOnly:  true,
+				MountPath: "/usr/share/zoneinfo",
+			},
+		})
+	}
+
+	return patches, nil
+}
+
+// podVolumeStrategy detects the strategy of an injected pod from the type of
+// its k8tz volume, an empty strategy is returned if the pod has no k8tz volume
+func podVolumeStrategy(spec *corev1.PodSpec) InjectionStrategy {
+	for _, v := range spec.Volumes {
+		if v.Name != VolumeName {
+			continue
+		}
+
+		if v.HostPath != nil {
+			return HostPathInjectionStrategy
+		}
+
+		if v.EmptyDir != nil {
+			return InitContainerInjectionStrategy
+		}
+
+		if v.CSI != nil {
+			return CSIInjectionStrategy
+		}
+
+		// the image source is missing from the API types
+		if v.VolumeSource == (corev1.VolumeSource{}) {
+			return ImageVolumeInjectionStrategy
+		}
+	}
+
+	return ""
+}
+
+// hasMount returns true if the container already mounts a volume on the path
+func hasMount(container *corev1.Container, mountPath string) bool {
+	for _, m := range container.VolumeMounts {
+		if m.MountPath == mountPath {
+			return true
+		}
+	}
+
+	return false
+}
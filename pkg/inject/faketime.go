@@ -0,0 +1,99 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultFaketimeLibrary is where Debian and Ubuntu install libfaketime, the
+// faketime strategy preloads it from the image of the containers
+const DefaultFaketimeLibrary = "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1"
+
+// faketimePattern matches the FAKETIME specifications of libfaketime: an
+// absolute time ("2024-03-31 01:59:00"), a start time that advances
+// ("@2024-03-31 01:59:00") or an offset ("+2d", "-90m"), with an optional
+// clock speed ("x10")
+var faketimePattern = regexp.MustCompile(`^(@?\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}|[+-]\d+(\.\d+)?[smhdy]?)( x\d+(\.\d+)?)?$`)
+
+// ValidateFaketime checks that the fake time is a FAKETIME specification that
+// libfaketime understands, absolute times are in the timezone of the pod
+func ValidateFaketime(faketime string) error {
+	if !faketimePattern.MatchString(faketime) {
+		return fmt.Errorf("invalid fake time %q, expected an absolute time (e.g. \"2024-03-31 01:59:00\" or \"@2024-03-31 01:59:00\") or an offset (e.g. \"+2d\") with an optional speed (e.g. \" x10\")", faketime)
+	}
+
+	return nil
+}
+
+// faketimeStrategy is the initContainer strategy with the clock of the
+// containers faked by libfaketime, see faketimeEnv
+func faketimeStrategy(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	if g.Faketime == "" {
+		return nil, fmt.Errorf("the %s strategy requires a fake time, set the %s annotation", FaketimeInjectionStrategy, k8tz.FaketimeAnnotation)
+	}
+
+	if err := ValidateFaketime(g.Faketime); err != nil {
+		return nil, err
+	}
+
+	if library := g.faketimeLibrary(); !path.IsAbs(library) || path.Clean(library) != library {
+		return nil, fmt.Errorf("invalid faketime library %q, expected a clean absolute path", library)
+	}
+
+	return bootstrapStrategy(spec, g, pathprefix)
+}
+
+// faketimeLibrary returns the path of libfaketime in the containers
+func (g *PatchGenerator) faketimeLibrary() string {
+	if g.FaketimeLibrary == "" {
+		return DefaultFaketimeLibrary
+	}
+
+	return g.FaketimeLibrary
+}
+
+// faketimeEnv returns the variables that make libfaketime fake the clock of
+// the containers of the faketime strategy, nil for other strategies
+func (g *PatchGenerator) faketimeEnv() []corev1.EnvVar {
+	if g.Strategy != FaketimeInjectionStrategy {
+		return nil
+	}
+
+	return []corev1.EnvVar{
+		{Name: "LD_PRELOAD", Value: g.faketimeLibrary()},
+		{Name: "FAKETIME", Value: g.Faketime},
+	}
+}
+
+// isFaketimeEnv returns true if the variable is one of the variables of the
+// faketime strategy with the value that the generator injects
+func (g *PatchGenerator) isFaketimeEnv(env corev1.EnvVar) bool {
+	switch env.Name {
+	case "LD_PRELOAD":
+		return env.Value == g.faketimeLibrary()
+	case "FAKETIME":
+		return true
+	}
+
+	return false
+}
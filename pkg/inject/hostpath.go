@@ -0,0 +1,63 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ValidateHostPath checks that the zoneinfo directory of the hostPath
+// strategy is a clean absolute path inside one of the roots, so annotations
+// cannot mount arbitrary directories of the nodes. Any directory other than
+// the root directory is allowed when there are no roots.
+func ValidateHostPath(dir string, roots []string) error {
+	if !path.IsAbs(dir) || path.Clean(dir) != dir || dir == "/" {
+		return fmt.Errorf("invalid host path %q, expected a clean absolute path, e.g. %s", dir, DefaultHostPathPrefix)
+	}
+
+	if len(roots) == 0 {
+		return nil
+	}
+
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+
+		if dir == root || strings.HasPrefix(dir, strings.TrimSuffix(root, "/")+"/") {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("host path %q is not inside the allowed roots: %s", dir, strings.Join(roots, ", "))
+}
+
+// ValidateHostPathType checks the type of the hostPath volume, only the types
+// that make the kubelet check the zoneinfo directory without creating it are
+// allowed
+func ValidateHostPathType(t corev1.HostPathType) error {
+	switch t {
+	case corev1.HostPathUnset, corev1.HostPathDirectory:
+		return nil
+	default:
+		return fmt.Errorf("unsupported hostPath type %q, expected %q or empty", t, corev1.HostPathDirectory)
+	}
+}
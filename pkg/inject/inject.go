@@ -18,8 +18,12 @@ package inject
 
 import (
 	"fmt"
+	"path"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	k8tz "github.com/k8tz/k8tz/pkg"
 	"github.com/k8tz/k8tz/pkg/version"
@@ -34,9 +38,40 @@ import (
 // than one way how it can be done
 type InjectionStrategy string
 
+// volumeStrategy returns the strategy that provides the TZif files of the
+// strategy, the sidecar, tzdata and faketime strategies share the volume of
+// initContainer and custom strategies provide their own
+func (s InjectionStrategy) volumeStrategy() InjectionStrategy {
+	if s == SidecarInjectionStrategy || s == TzdataInjectionStrategy || s == FaketimeInjectionStrategy {
+		return InitContainerInjectionStrategy
+	}
+
+	return s
+}
+
+// CronJobMode is how the timezone of CronJobs is set
+type CronJobMode string
+
 const (
 	DefaultHostPathPrefix string = "/usr/share/zoneinfo"
 	DefaultLocalTimePath  string = "/etc/localtime"
+	// DefaultZoneInfoPath is where TZif files are read from when the timezone
+	// has to be derived from tzdata, e.g. for PosixTimezoneFormat
+	DefaultZoneInfoPath string = "/usr/share/zoneinfo"
+	// DefaultTzdir is where the tzdata strategy mounts the tz database
+	DefaultTzdir string = "/usr/share/zoneinfo"
+
+	// VolumeName is the name of the volume that holds the TZif files, it is
+	// shared between the bootstrap initContainer and the app containers
+	VolumeName = "k8tz"
+	// BootstrapContainerName is the name of the bootstrap initContainer
+	BootstrapContainerName = "k8tz"
+	// BootstrapMountPath is where the volume is mounted on the bootstrap
+	// initContainer, the TZif files are copied to this directory
+	BootstrapMountPath = "/mnt/zoneinfo"
+	// BootstrapSidecarRefreshInterval is how often the bootstrap container
+	// copies the TZif files again when it runs as a native sidecar
+	BootstrapSidecarRefreshInterval = time.Hour
 
 	// DefaultInjectionStrategy is the default injection strategy of k8tz
 	DefaultInjectionStrategy = InitContainerInjectionStrategy
@@ -49,6 +84,47 @@ const (
 	// TZif files exists on the node machines, and we can just mount them
 	// with hostPath volumes
 	HostPathInjectionStrategy InjectionStrategy = "hostPath"
+	// SidecarInjectionStrategy is the initContainer strategy with the
+	// bootstrap container injected as a native sidecar (restartPolicy:
+	// Always), so the TZif files are refreshed while the pod is running.
+	// Requires kubernetes >=1.29.0 or the 'SidecarContainers' feature gate
+	SidecarInjectionStrategy InjectionStrategy = "sidecar"
+	// TzdataInjectionStrategy is the initContainer strategy with the whole
+	// tz database mounted read-only at Tzdir and the TZDIR variable instead
+	// of the localtime file, so the processes of the pod can switch between
+	// timezones at runtime by changing TZ without re-injection
+	TzdataInjectionStrategy InjectionStrategy = "tzdata"
+	// WindowsInjectionStrategy is an injection strategy for windows pods,
+	// only the TZ environment variable is injected since windows containers
+	// can neither run the bootstrap container nor read TZif files. Pods with
+	// spec.os.name or the kubernetes.io/os nodeSelector set to windows always
+	// get this strategy.
+	WindowsInjectionStrategy InjectionStrategy = "windows"
+	// CSIInjectionStrategy is an injection strategy where the TZif files are
+	// provided by a CSI driver and mounted with a CSI ephemeral inline volume,
+	// no initContainer is injected
+	CSIInjectionStrategy InjectionStrategy = "csi"
+	// ImageVolumeInjectionStrategy is an injection strategy where the TZif
+	// files of the bootstrap image are mounted with an image volume, no
+	// initContainer is injected. Requires kubernetes >=1.31.0 with the
+	// 'ImageVolume' feature gate
+	ImageVolumeInjectionStrategy InjectionStrategy = "image"
+	// FaketimeInjectionStrategy is the initContainer strategy with the clock
+	// of the containers faked by libfaketime (experimental, for test
+	// environments): the FAKETIME variable is set to the Faketime of the
+	// k8tz.io/faketime annotation and LD_PRELOAD to the FaketimeLibrary,
+	// which must be installed in the images of the containers
+	FaketimeInjectionStrategy InjectionStrategy = "faketime"
+
+	// AutoCronJobMode sets spec.timeZone of CronJobs if the cluster supports
+	// it (kubernetes >=1.27.0), otherwise it falls back to TemplateCronJobMode
+	AutoCronJobMode CronJobMode = "auto"
+	// NativeCronJobMode sets spec.timeZone of CronJobs, so the schedule is
+	// evaluated in the timezone
+	NativeCronJobMode CronJobMode = "native"
+	// TemplateCronJobMode injects the pod template of the job template of
+	// CronJobs, the containers run in the timezone but the schedule stays UTC
+	TemplateCronJobMode CronJobMode = "template"
 )
 
 var (
@@ -56,6 +132,10 @@ var (
 
 	True  = true
 	False = false
+
+	// InjectionStrategies is the list of the built-in injection strategies,
+	// see RegisteredStrategies for the custom strategies
+	InjectionStrategies = []InjectionStrategy{InitContainerInjectionStrategy, HostPathInjectionStrategy, SidecarInjectionStrategy, TzdataInjectionStrategy, WindowsInjectionStrategy, CSIInjectionStrategy, ImageVolumeInjectionStrategy, FaketimeInjectionStrategy}
 )
 
 type PatchGenerator struct {
@@ -65,6 +145,88 @@ type PatchGenerator struct {
 	HostPathPrefix     string
 	LocalTimePath      string
 	CronJobTimeZone    bool
+	CronJobMode        CronJobMode
+	BootstrapSidecar   bool
+	PodSecurityLevel   PodSecurityLevel
+	PodSecurityAction  PodSecurityAction
+	// InitContainerImagePullPolicy is the imagePullPolicy of the bootstrap
+	// container, the kubernetes default is used when empty
+	InitContainerImagePullPolicy corev1.PullPolicy
+	// InitContainerArchImages overrides InitContainerImage for pods that are
+	// pinned to an architecture with the kubernetes.io/arch nodeSelector,
+	// keyed by architecture (e.g. arm64)
+	InitContainerArchImages map[string]string
+	// InitContainerResources are the resource requests and limits of the
+	// bootstrap container
+	InitContainerResources corev1.ResourceRequirements
+	// InitContainerSecurityContext configures the securityContext of the
+	// bootstrap container
+	InitContainerSecurityContext BootstrapSecurityContext
+	// InitContainerImagePullSecrets are added to the image pull secrets of
+	// the pods that get the bootstrap container
+	InitContainerImagePullSecrets []string
+	// TimezoneFormat is the format of the TZ environment variable value
+	TimezoneFormat TimezoneFormat
+	// ZoneInfoPath is the local zoneinfo directory used to derive the POSIX
+	// TZ rule of the timezone
+	ZoneInfoPath string
+	// ExtraEnv are environment variables injected in addition to TZ when the
+	// matching strategy is used
+	ExtraEnv ExtraEnv
+	// AnnotateOffset adds the UTC offset and abbreviation of the timezone at
+	// injection time to the post injection annotations
+	AnnotateOffset bool
+	// ContainerTimezones overrides Timezone for containers by name
+	ContainerTimezones map[string]string
+	// ObjectAnnotations applies the k8tz annotations of every generated
+	// object like the admission webhook does, for injection without a webhook
+	ObjectAnnotations bool
+	// TzdataVersion is the tz database version of the bootstrap image, it is
+	// recorded on the objects that are injected with the bootstrap container
+	// or image
+	TzdataVersion string
+	// Locale is injected with the LocaleVariables in addition to TZ, no
+	// locale is injected when empty
+	Locale string
+	// ConflictPolicy is what to do with the TZ variables, volumes and
+	// initContainers of k8tz that the pod already has, replace when empty
+	ConflictPolicy ConflictPolicy
+	// Tzdir is where the tzdata strategy mounts the tz database, it is also
+	// the value of the TZDIR variable, DefaultTzdir when empty
+	Tzdir string
+	// HostPathType is the type of the hostPath volume, Directory makes the
+	// kubelet check that HostPathPrefix exists on the node instead of
+	// creating an empty directory, no type is set when empty
+	HostPathType corev1.HostPathType
+	// CSIDriver is the driver of the CSI ephemeral inline volume of the csi
+	// strategy
+	CSIDriver string
+	// CSIVolumeAttributes are passed to the CSI driver with the volume
+	CSIVolumeAttributes map[string]string
+	// CSIZoneInfoPath is the zoneinfo directory inside the CSI volume,
+	// relative to its root, the root of the volume when empty
+	CSIZoneInfoPath string
+	// RewriteSchedule rewrites the schedule of the CronJobs that are injected
+	// with TemplateCronJobMode from the timezone to UTC, see UTCSchedule
+	RewriteSchedule bool
+	// Faketime is the FAKETIME of the faketime strategy, e.g. "@2024-03-31
+	// 01:59:00" starts the clock of the containers at that time in their
+	// timezone
+	Faketime string
+	// FaketimeLibrary is the path of libfaketime in the containers of the
+	// faketime strategy, DefaultFaketimeLibrary when empty
+	FaketimeLibrary string
+
+	// now returns the injection time, time.Now is used if nil
+	now func() time.Time
+}
+
+// sidecarContainer is a container with restartPolicy, the field was added in
+// kubernetes 1.28 for native sidecars and it is missing from the API types
+// that k8tz is compiled with
+type sidecarContainer struct {
+	corev1.Container
+	RestartPolicy corev1.RestartPolicy `json:"restartPolicy,omitempty"`
 }
 
 func NewPatchGenerator() PatchGenerator {
@@ -75,6 +237,32 @@ func NewPatchGenerator() PatchGenerator {
 		HostPathPrefix:     DefaultHostPathPrefix,
 		LocalTimePath:      DefaultLocalTimePath,
 		CronJobTimeZone:    false,
+		CronJobMode:        NativeCronJobMode,
+		BootstrapSidecar:   false,
+		PodSecurityLevel:   "",
+		PodSecurityAction:  PodSecurityIgnore,
+
+		InitContainerImagePullPolicy:  "",
+		InitContainerArchImages:       map[string]string{},
+		InitContainerResources:        corev1.ResourceRequirements{},
+		InitContainerSecurityContext:  BootstrapSecurityContext{},
+		InitContainerImagePullSecrets: []string{},
+		TimezoneFormat:                NameTimezoneFormat,
+		ZoneInfoPath:                  DefaultZoneInfoPath,
+		ExtraEnv:                      ExtraEnv{},
+		AnnotateOffset:                false,
+		ContainerTimezones:            map[string]string{},
+		ObjectAnnotations:             false,
+		TzdataVersion:                 "",
+		Locale:                        "",
+		ConflictPolicy:                ConflictReplace,
+		Tzdir:                         DefaultTzdir,
+		HostPathType:                  corev1.HostPathUnset,
+		CSIDriver:                     "",
+		CSIVolumeAttributes:           map[string]string{},
+		CSIZoneInfoPath:               "",
+		Faketime:                      "",
+		FaketimeLibrary:               DefaultFaketimeLibrary,
 	}
 }
 
@@ -89,21 +277,39 @@ func isObjectInjected(obj *metav1.ObjectMeta) bool {
 }
 
 func (g *PatchGenerator) Generate(object interface{}, pathprefix string) (patches k8tz.Patches, err error) {
+	if g.ObjectAnnotations {
+		generator, inject, err := g.withObjectAnnotations(object)
+		if err != nil || !inject {
+			return k8tz.Patches{}, err
+		}
+
+		g = generator
+	}
+
+	g, err = g.canonical()
+	if err != nil {
+		return k8tz.Patches{}, err
+	}
+
 	switch o := object.(type) {
 	case *batchv1.CronJob:
+		if g.CronJobTimeZone && g.CronJobMode == TemplateCronJobMode {
+			return g.forJobTemplate(o, pathprefix)
+		}
+
 		return g.forCronJobSpec(&o.Spec, fmt.Sprintf("%s/spec", pathprefix), map[string]*metav1.ObjectMeta{
 			fmt.Sprintf("%s/metadata", pathprefix): &o.ObjectMeta,
 		})
 	case *appsv1.StatefulSet:
-		return g.forPodSpec(&o.Spec.Template.Spec, fmt.Sprintf("%s/spec/template/spec", pathprefix), map[string]*metav1.ObjectMeta{
-			fmt.Sprintf("%s/metadata", pathprefix):               &o.ObjectMeta,
-			fmt.Sprintf("%s/spec/template/metadata", pathprefix): &o.Spec.Template.ObjectMeta,
-		})
+		return g.forPodTemplate(&o.ObjectMeta, &o.Spec.Template, pathprefix)
 	case *appsv1.Deployment:
-		return g.forPodSpec(&o.Spec.Template.Spec, fmt.Sprintf("%s/spec/template/spec", pathprefix), map[string]*metav1.ObjectMeta{
-			fmt.Sprintf("%s/metadata", pathprefix):               &o.ObjectMeta,
-			fmt.Sprintf("%s/spec/template/metadata", pathprefix): &o.Spec.Template.ObjectMeta,
-		})
+		return g.forPodTemplate(&o.ObjectMeta, &o.Spec.Template, pathprefix)
+	case *appsv1.DaemonSet:
+		return g.forPodTemplate(&o.ObjectMeta, &o.Spec.Template, pathprefix)
+	case *appsv1.ReplicaSet:
+		return g.forPodTemplate(&o.ObjectMeta, &o.Spec.Template, pathprefix)
+	case *batchv1.Job:
+		return g.forPodTemplate(&o.ObjectMeta, &o.Spec.Template, pathprefix)
 	case *corev1.Pod:
 		return g.forPodSpec(&o.Spec, fmt.Sprintf("%s/spec", pathprefix), map[string]*metav1.ObjectMeta{
 			fmt.Sprintf("%s/metadata", pathprefix): &o.ObjectMeta,
@@ -115,6 +321,29 @@ func (g *PatchGenerator) Generate(object interface{}, pathprefix string) (patche
 	return make(k8tz.Patches, 0), fmt.Errorf("not injectable object: %T", object)
 }
 
+// forPodTemplate returns the patches of a workload with a pod template at
+// spec.template, the post injection annotations are added to both
+func (g *PatchGenerator) forPodTemplate(meta *metav1.ObjectMeta, template *corev1.PodTemplateSpec, pathprefix string) (k8tz.Patches, error) {
+	templatePath := fmt.Sprintf("%s/spec/template", pathprefix)
+
+	var patches k8tz.Patches
+	if reflect.DeepEqual(template.ObjectMeta, metav1.ObjectMeta{}) {
+		// the metadata of the template is optional in manifests, the post
+		// injection annotations are added to it
+		patches = append(patches, k8tz.Patch{Op: "add", Path: templatePath + "/metadata", Value: map[string]interface{}{}})
+	}
+
+	templatePatches, err := g.forPodSpec(&template.Spec, templatePath+"/spec", map[string]*metav1.ObjectMeta{
+		fmt.Sprintf("%s/metadata", pathprefix): meta,
+		templatePath + "/metadata":             &template.ObjectMeta,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(patches, templatePatches...), nil
+}
+
 func (g *PatchGenerator) handleList(list *corev1.List, pathprefix string) (patches k8tz.Patches, err error) {
 	patches = k8tz.Patches{}
 	if len(list.Items) == 0 {
@@ -148,30 +377,75 @@ func (g *PatchGenerator) handleList(list *corev1.List, pathprefix string) (patch
 }
 
 func (g *PatchGenerator) forPodSpec(spec *corev1.PodSpec, pathprefix string, postInjectionAnnotations map[string]*metav1.ObjectMeta) (patches k8tz.Patches, err error) {
-	if g.Strategy == HostPathInjectionStrategy {
-		patches = append(patches, g.createHostPathPatches(spec, pathprefix)...)
-	} else if g.Strategy == InitContainerInjectionStrategy {
-		patches = append(patches, g.createInitContainerPatches(spec, pathprefix)...)
-	} else {
+	if err := g.ConflictPolicy.validate(); err != nil {
+		return nil, err
+	}
+
+	if g.ConflictPolicy == ConflictSkip {
+		if conflicts := Conflicts(spec); len(conflicts) > 0 {
+			return nil, &ConflictError{Conflicts: conflicts}
+		}
+	}
+
+	if strategy := g.podStrategy(spec); strategy != g.Strategy {
+		// the generator is copied to keep the strategy of the other objects
+		windows := *g
+		windows.Strategy = strategy
+		return windows.forPodSpec(spec, pathprefix, postInjectionAnnotations)
+	}
+
+	strategy, ok := LookupStrategy(g.Strategy)
+	if !ok {
 		return nil, fmt.Errorf("unknown injection strategy specified: %s", g.Strategy)
 	}
 
-	patches = append(patches, g.createEnvironmentVariablePatches(spec, pathprefix)...)
+	patches, err = strategy.Patch(spec, g, pathprefix)
+	if err != nil {
+		return nil, err
+	}
 
-	for k, v := range postInjectionAnnotations {
-		patches = append(patches, g.createPostInjectionAnnotations(v, k)...)
+	envPatches, err := g.createEnvironmentVariablePatches(spec, pathprefix)
+	if err != nil {
+		return nil, err
 	}
 
+	patches = append(patches, envPatches...)
+
+	if err := validateVolumeNames(spec, patches); err != nil {
+		return nil, fmt.Errorf("inconsistent patches generated for %s strategy: %w", g.Strategy, err)
+	}
+
+	patches, err = g.enforcePodSecurity(spec, pathprefix, patches)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations, err := g.postInjectionPatches(postInjectionAnnotations)
+	if err != nil {
+		return nil, err
+	}
+
+	patches = append(patches, annotations...)
+
 	return patches, nil
 }
 
 func (g *PatchGenerator) forCronJobSpec(spec *batchv1.CronJobSpec, pathprefix string, postInjectionAnnotations map[string]*metav1.ObjectMeta) (patches k8tz.Patches, err error) {
 	if g.CronJobTimeZone {
+		switch g.CronJobMode {
+		case NativeCronJobMode, AutoCronJobMode, "":
+		default:
+			return nil, fmt.Errorf("unknown cronJob mode specified: %s", g.CronJobMode)
+		}
+
 		patches = append(patches, g.createCronJobPatches(spec, pathprefix)...)
 
-		for k, v := range postInjectionAnnotations {
-			patches = append(patches, g.createPostInjectionAnnotations(v, k)...)
+		annotations, err := g.postInjectionPatches(postInjectionAnnotations)
+		if err != nil {
+			return nil, err
 		}
+
+		patches = append(patches, annotations...)
 	}
 
 	return patches, nil
@@ -189,10 +463,71 @@ func (g *PatchGenerator) createCronJobPatches(spec *batchv1.CronJobSpec, pathpre
 	return patches
 }
 
-func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec, pathprefix string) k8tz.Patches {
+// forJobTemplate injects the pod template of the job template of a CronJob,
+// it is used on clusters that do not support spec.timeZone
+func (g *PatchGenerator) forJobTemplate(cronJob *batchv1.CronJob, pathprefix string) (k8tz.Patches, error) {
+	template := &cronJob.Spec.JobTemplate.Spec.Template
+	templatePath := fmt.Sprintf("%s/spec/jobTemplate/spec/template", pathprefix)
+
+	var patches k8tz.Patches
+	if reflect.DeepEqual(template.ObjectMeta, metav1.ObjectMeta{}) {
+		// the post injection annotations are added to the metadata
+		patches = append(patches, k8tz.Patch{Op: "add", Path: templatePath + "/metadata", Value: map[string]interface{}{}})
+	}
+
+	templatePatches, err := g.forPodSpec(&template.Spec, templatePath+"/spec", map[string]*metav1.ObjectMeta{
+		fmt.Sprintf("%s/metadata", pathprefix): &cronJob.ObjectMeta,
+		templatePath + "/metadata":             &template.ObjectMeta,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patches = append(patches, templatePatches...)
+	if !g.RewriteSchedule {
+		return patches, nil
+	}
+
+	schedule, err := g.UTCSchedule(cronJob.Spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite the schedule of the cronJob: %w", err)
+	}
+
+	if schedule == cronJob.Spec.Schedule {
+		return patches, nil
+	}
+
+	// the post injection annotations are added to the CronJob by now, so the
+	// original schedule is added to its annotations
+	annotated := cronJob.ObjectMeta.DeepCopy()
+	if annotated.Annotations == nil {
+		annotated.Annotations = map[string]string{}
+	}
+	annotated.Annotations[k8tz.InjectedAnnotation] = "true"
+
+	patches = append(patches, k8tz.Patch{Op: "replace", Path: fmt.Sprintf("%s/spec/schedule", pathprefix), Value: schedule})
+	return append(patches, annotationPatches(annotated, fmt.Sprintf("%s/metadata", pathprefix), map[string]string{k8tz.ScheduleAnnotation: cronJob.Spec.Schedule})...), nil
+}
+
+func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec, pathprefix string) (k8tz.Patches, error) {
 	var patches = k8tz.Patches{}
 
+	if err := g.ExtraEnv.validate(); err != nil {
+		return nil, err
+	}
+
+	if g.Locale != "" {
+		if err := ValidateLocale(g.Locale); err != nil {
+			return nil, err
+		}
+	}
+
 	for containerId := 0; containerId < len(spec.Containers); containerId++ {
+		timezone, err := g.timezoneValue(g.containerTimezone(&spec.Containers[containerId]))
+		if err != nil {
+			return nil, err
+		}
+
 		if len(spec.Containers[containerId].Env) == 0 {
 			patches = append(patches, k8tz.Patch{
 				Op:    "add",
@@ -201,29 +536,196 @@ func (g *PatchGenerator) createEnvironmentVariablePatches(spec *corev1.PodSpec,
 			})
 		}
 
-		patches = append(patches, k8tz.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
-			Value: corev1.EnvVar{
-				Name:  "TZ",
-				Value: g.Timezone,
-			},
-		})
+		// a TZ variable that the container already has is kept by the merge
+		// policy, and replaced in place otherwise
+		if index := envIndex(&spec.Containers[containerId], "TZ"); index < 0 {
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
+				Value: envFragment("TZ", timezone),
+			})
+		} else if g.ConflictPolicy != ConflictMerge && !hasEnvValue(&spec.Containers[containerId], "TZ", timezone) {
+			patches = append(patches, k8tz.Patch{
+				Op:    "replace",
+				Path:  fmt.Sprintf("%s/containers/%d/env/%d", pathprefix, containerId, index),
+				Value: envFragment("TZ", timezone),
+			})
+		}
+
+		// variables that are already defined by the container are kept as is
+		injected := map[string]bool{}
+		for _, name := range LocaleVariables {
+			if g.Locale == "" || hasEnv(&spec.Containers[containerId], name) {
+				continue
+			}
+
+			injected[name] = true
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
+				Value: envFragment(name, g.Locale),
+			})
+		}
+
+		if g.Strategy == TzdataInjectionStrategy && !hasEnv(&spec.Containers[containerId], "TZDIR") {
+			injected["TZDIR"] = true
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
+				Value: envFragment("TZDIR", g.tzdir()),
+			})
+		}
+
+		for _, env := range g.faketimeEnv() {
+			if hasEnv(&spec.Containers[containerId], env.Name) {
+				continue
+			}
+
+			injected[env.Name] = true
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
+				Value: envFragment(env.Name, env.Value),
+			})
+		}
+
+		for _, env := range g.ExtraEnv[g.Strategy.volumeStrategy()] {
+			if hasEnv(&spec.Containers[containerId], env.Name) || injected[env.Name] {
+				continue
+			}
+
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/env/-", pathprefix, containerId),
+				Value: env,
+			})
+		}
 	}
 
-	return patches
+	return patches, nil
+}
+
+// containerTimezone returns the timezone of the container, either from the
+// ContainerTimezones or the Timezone of the generator
+func (g *PatchGenerator) containerTimezone(container *corev1.Container) string {
+	if timezone, ok := g.ContainerTimezones[container.Name]; ok {
+		return timezone
+	}
+
+	return g.Timezone
+}
+
+// hasProvidedLocalTime returns true if the container already gets the
+// localtime file from a projected, secret, configMap or downwardAPI volume,
+// either mounted directly on the localtime path or on one of its parent
+// directories with an item that targets it. Such containers are left without
+// k8tz volumeMounts to avoid conflicting mounts. Secrets and configMaps that
+// are projected without explicit items are assumed to provide localtime.
+func (g *PatchGenerator) hasProvidedLocalTime(spec *corev1.PodSpec, container *corev1.Container) bool {
+	volumes := map[string]*corev1.Volume{}
+	for i := range spec.Volumes {
+		volumes[spec.Volumes[i].Name] = &spec.Volumes[i]
+	}
+
+	for _, mount := range container.VolumeMounts {
+		volume, ok := volumes[mount.Name]
+		if !ok {
+			continue
+		}
+
+		paths, projected := projectedPaths(volume)
+		if !projected {
+			continue
+		}
+
+		if path.Clean(mount.MountPath) == path.Clean(g.LocalTimePath) {
+			return true
+		}
+
+		if mount.SubPath != "" {
+			continue
+		}
+
+		rel := strings.TrimPrefix(path.Clean(g.LocalTimePath), path.Clean(mount.MountPath)+"/")
+		if rel == path.Clean(g.LocalTimePath) {
+			// the volume is not mounted on a parent directory of localtime
+			continue
+		}
+
+		if paths == nil {
+			return true
+		}
+
+		for _, p := range paths {
+			if path.Clean(p) == rel {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// projectedPaths returns the item paths of volumes that project files from the
+// kubernetes api (projected, secret, configMap and downwardAPI volumes). The
+// paths are nil if the volume projects all the keys of a secret or configMap,
+// since they are unknown at admission time.
+func projectedPaths(volume *corev1.Volume) (paths []string, projected bool) {
+	keyPaths := func(items []corev1.KeyToPath) []string {
+		if len(items) == 0 {
+			return nil
+		}
+
+		paths := make([]string, 0, len(items))
+		for _, item := range items {
+			paths = append(paths, item.Path)
+		}
+		return paths
+	}
+
+	switch {
+	case volume.Secret != nil:
+		return keyPaths(volume.Secret.Items), true
+	case volume.ConfigMap != nil:
+		return keyPaths(volume.ConfigMap.Items), true
+	case volume.DownwardAPI != nil:
+		paths = []string{}
+		for _, item := range volume.DownwardAPI.Items {
+			paths = append(paths, item.Path)
+		}
+		return paths, true
+	case volume.Projected != nil:
+		paths = []string{}
+		for _, source := range volume.Projected.Sources {
+			switch {
+			case source.Secret != nil:
+				if len(source.Secret.Items) == 0 {
+					return nil, true
+				}
+				paths = append(paths, keyPaths(source.Secret.Items)...)
+			case source.ConfigMap != nil:
+				if len(source.ConfigMap.Items) == 0 {
+					return nil, true
+				}
+				paths = append(paths, keyPaths(source.ConfigMap.Items)...)
+			case source.DownwardAPI != nil:
+				for _, item := range source.DownwardAPI.Items {
+					paths = append(paths, item.Path)
+				}
+			case source.ServiceAccountToken != nil:
+				paths = append(paths, source.ServiceAccountToken.Path)
+			}
+		}
+		return paths, true
+	}
+
+	return nil, false
 }
 
 func (g *PatchGenerator) removeContainerVolumeMounts(volumeMounts []corev1.VolumeMount, pathprefix string, containerId int) k8tz.Patches {
 	patches := k8tz.Patches{}
 	for index := len(volumeMounts) - 1; index >= 0; index-- {
-		if volumeMounts[index].MountPath == g.LocalTimePath {
-			patches = append(patches, k8tz.Patch{
-				Op:    "remove",
-				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts/%d", pathprefix, containerId, index),
-				Value: "",
-			})
-		} else if volumeMounts[index].MountPath == g.HostPathPrefix {
+		if g.isReplacedMount(volumeMounts[index]) {
 			patches = append(patches, k8tz.Patch{
 				Op:    "remove",
 				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts/%d", pathprefix, containerId, index),
@@ -242,98 +744,181 @@ func (g *PatchGenerator) createInitContainerPatches(spec *corev1.PodSpec, pathpr
 		return patches
 	}
 
-	if len(spec.Volumes) == 0 {
+	patches = append(patches, g.createVolumePatches(spec, pathprefix, emptyDirVolumeFragment())...)
+
+	for containerId := 0; containerId < containers; containerId++ {
+		if g.hasProvidedLocalTime(spec, &spec.Containers[containerId]) {
+			continue
+		}
+
+		patches = append(patches, g.createVolumeMountPatches(&spec.Containers[containerId], pathprefix, containerId)...)
+	}
+
+	bootstrap := g.bootstrapFragment(g.bootstrapImage(spec))
+	if index := initContainerIndex(spec); index >= 0 {
+		if g.ConflictPolicy != ConflictMerge && !hasInitContainer(spec, bootstrap) {
+			patches = append(patches, k8tz.Patch{
+				Op:    "replace",
+				Path:  fmt.Sprintf("%s/initContainers/%d", pathprefix, index),
+				Value: bootstrap,
+			})
+		}
+	} else {
+		if len(spec.InitContainers) == 0 {
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/initContainers", pathprefix),
+				Value: []corev1.Container{},
+			})
+		}
+
 		patches = append(patches, k8tz.Patch{
 			Op:    "add",
-			Path:  fmt.Sprintf("%s/volumes", pathprefix),
-			Value: []corev1.Volume{},
+			Path:  fmt.Sprintf("%s/initContainers/-", pathprefix),
+			Value: bootstrap,
 		})
 	}
 
-	patches = append(patches, k8tz.Patch{
-		Op:   "add",
-		Path: fmt.Sprintf("%s/volumes/-", pathprefix),
-		Value: corev1.Volume{
-			Name: "k8tz",
-			VolumeSource: corev1.VolumeSource{
-				EmptyDir: &corev1.EmptyDirVolumeSource{},
-			},
-		},
-	})
+	patches = append(patches, g.createImagePullSecretPatches(spec, pathprefix)...)
 
-	for containerId := 0; containerId < containers; containerId++ {
-		if len(spec.Containers[containerId].VolumeMounts) == 0 {
+	return patches
+}
+
+// createVolumePatches adds the k8tz volume, a volume with the same name that
+// the pod already has is kept by the merge policy, and replaced otherwise.
+// Image volumes are always replaced since their source is missing from the
+// API types.
+func (g *PatchGenerator) createVolumePatches(spec *corev1.PodSpec, pathprefix string, volume interface{}) k8tz.Patches {
+	var patches = k8tz.Patches{}
+	if index := volumeIndex(spec); index >= 0 {
+		existing, ok := valueOf(volume).(corev1.Volume)
+		if g.ConflictPolicy != ConflictMerge && !(ok && hasVolume(spec, existing)) {
 			patches = append(patches, k8tz.Patch{
-				Op:    "add",
-				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathprefix, containerId),
-				Value: []corev1.VolumeMount{},
+				Op:    "replace",
+				Path:  fmt.Sprintf("%s/volumes/%d", pathprefix, index),
+				Value: volume,
 			})
 		}
 
-		patches = append(patches, g.removeContainerVolumeMounts(spec.Containers[containerId].VolumeMounts, pathprefix, containerId)...)
+		return patches
+	}
 
+	if len(spec.Volumes) == 0 {
 		patches = append(patches, k8tz.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathprefix, containerId),
-			Value: corev1.VolumeMount{
-				Name:      "k8tz",
-				ReadOnly:  true,
-				MountPath: g.LocalTimePath,
-				SubPath:   g.Timezone,
-			},
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/volumes", pathprefix),
+			Value: []corev1.Volume{},
 		})
+	}
 
+	return append(patches, k8tz.Patch{
+		Op:    "add",
+		Path:  fmt.Sprintf("%s/volumes/-", pathprefix),
+		Value: volume,
+	})
+}
+
+// createVolumeMountPatches mounts the localtime file and the zoneinfo
+// directory of the k8tz volume in the container. Existing mounts on these
+// paths are replaced, unless they are exactly the mounts that k8tz adds.
+func (g *PatchGenerator) createVolumeMountPatches(container *corev1.Container, pathprefix string, containerId int) k8tz.Patches {
+	var patches = k8tz.Patches{}
+
+	subPath := g.zoneInfoSubPath(g.Strategy)
+	mounts := []interface{}{
+		volumeMountFragment(g.LocalTimePath, path.Join(subPath, g.containerTimezone(container))),
+		volumeMountFragment("/usr/share/zoneinfo", subPath),
+	}
+	if g.Strategy == TzdataInjectionStrategy {
+		mounts = []interface{}{volumeMountFragment(g.tzdir(), "")}
+	}
+
+	if g.hasVolumeMounts(container, mounts...) {
+		return patches
+	}
+
+	if len(container.VolumeMounts) == 0 {
 		patches = append(patches, k8tz.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathprefix, containerId),
-			Value: corev1.VolumeMount{
-				Name:      "k8tz",
-				ReadOnly:  true,
-				MountPath: "/usr/share/zoneinfo",
-			},
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathprefix, containerId),
+			Value: []corev1.VolumeMount{},
 		})
 	}
 
-	if len(spec.InitContainers) == 0 {
+	patches = append(patches, g.removeContainerVolumeMounts(container.VolumeMounts, pathprefix, containerId)...)
+
+	for _, mount := range mounts {
 		patches = append(patches, k8tz.Patch{
 			Op:    "add",
-			Path:  fmt.Sprintf("%s/initContainers", pathprefix),
-			Value: []corev1.Container{},
+			Path:  fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathprefix, containerId),
+			Value: mount,
 		})
 	}
 
-	patches = append(patches, k8tz.Patch{
-		Op:   "add",
-		Path: fmt.Sprintf("%s/initContainers/-", pathprefix),
-		Value: corev1.Container{
-			Name:  "k8tz",
-			Image: g.InitContainerImage,
-			Args:  []string{"bootstrap"},
-			SecurityContext: &corev1.SecurityContext{
-				AllowPrivilegeEscalation: &False,
-				SeccompProfile: &corev1.SeccompProfile{
-					Type: "RuntimeDefault",
-				},
-				Capabilities: &corev1.Capabilities{
-					Drop: []corev1.Capability{
-						"ALL",
-					},
-				},
-			},
-			VolumeMounts: []corev1.VolumeMount{
-				{
-					Name:      "k8tz",
-					MountPath: "/mnt/zoneinfo",
-					ReadOnly:  false,
-				},
+	return patches
+}
+
+// hasVolumeMounts returns true if the container has all the mounts and no
+// other mount that removeContainerVolumeMounts would remove
+func (g *PatchGenerator) hasVolumeMounts(container *corev1.Container, mounts ...interface{}) bool {
+	for _, mount := range mounts {
+		if !hasVolumeMount(container, valueOf(mount).(corev1.VolumeMount)) {
+			return false
+		}
+	}
+
+	replaced := 0
+	for _, m := range container.VolumeMounts {
+		if g.isReplacedMount(m) {
+			replaced++
+		}
+	}
+
+	return replaced == len(mounts)
+}
+
+// asBootstrapSidecar turns the bootstrap initContainer into a native sidecar
+// that keeps running and refreshes the TZif files periodically, the app
+// containers are started only after the startup probe confirms that the
+// initial copy is complete
+func (g *PatchGenerator) asBootstrapSidecar(bootstrap corev1.Container) sidecarContainer {
+	bootstrap.Args = append(bootstrap.Args, fmt.Sprintf("--keep-alive=%s", BootstrapSidecarRefreshInterval))
+	bootstrap.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/k8tz", "bootstrap", "--check", fmt.Sprintf("--to=%s", BootstrapMountPath)},
 			},
 		},
-	})
+		PeriodSeconds:    1,
+		FailureThreshold: 60,
+	}
 
-	return patches
+	return sidecarContainer{
+		Container:     bootstrap,
+		RestartPolicy: corev1.RestartPolicyAlways,
+	}
+}
+
+// bootstrapImage returns the bootstrap image for the architecture the pod is
+// pinned to with the kubernetes.io/arch nodeSelector, pods that are not pinned
+// get InitContainerImage which should be a multi-arch (manifest list) image
+func (g *PatchGenerator) bootstrapImage(spec *corev1.PodSpec) string {
+	if arch, ok := spec.NodeSelector[corev1.LabelArchStable]; ok {
+		if image, ok := g.InitContainerArchImages[arch]; ok && image != "" {
+			return image
+		}
+	}
+
+	return g.InitContainerImage
 }
 
 func (g *PatchGenerator) createHostPathPatches(spec *corev1.PodSpec, pathprefix string) k8tz.Patches {
+	return g.createReadOnlyVolumePatches(spec, pathprefix, hostPathVolumeFragment(g.HostPathPrefix, g.HostPathType))
+}
+
+// createReadOnlyVolumePatches mounts the volume in the containers, it is shared
+// by the strategies whose volume already holds the TZif files
+func (g *PatchGenerator) createReadOnlyVolumePatches(spec *corev1.PodSpec, pathprefix string, volume interface{}) k8tz.Patches {
 	var patches = k8tz.Patches{}
 	containers := len(spec.Containers)
 	if containers == 0 {
@@ -341,82 +926,147 @@ func (g *PatchGenerator) createHostPathPatches(spec *corev1.PodSpec, pathprefix
 	}
 
 	for containerId := 0; containerId < containers; containerId++ {
-		if len(spec.Containers[containerId].VolumeMounts) == 0 {
-			patches = append(patches, k8tz.Patch{
-				Op:    "add",
-				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathprefix, containerId),
-				Value: []corev1.VolumeMount{},
-			})
+		if g.hasProvidedLocalTime(spec, &spec.Containers[containerId]) {
+			continue
 		}
 
-		patches = append(patches, g.removeContainerVolumeMounts(spec.Containers[containerId].VolumeMounts, pathprefix, containerId)...)
+		patches = append(patches, g.createVolumeMountPatches(&spec.Containers[containerId], pathprefix, containerId)...)
+	}
 
-		patches = append(patches, k8tz.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathprefix, containerId),
-			Value: corev1.VolumeMount{
-				Name:      "k8tz",
-				ReadOnly:  true,
-				MountPath: g.LocalTimePath,
-				SubPath:   g.Timezone,
-			},
-		})
+	return append(patches, g.createVolumePatches(spec, pathprefix, volume)...)
+}
 
-		patches = append(patches, k8tz.Patch{
-			Op:   "add",
-			Path: fmt.Sprintf("%s/containers/%d/volumeMounts/-", pathprefix, containerId),
-			Value: corev1.VolumeMount{
-				Name:      "k8tz",
-				ReadOnly:  true,
-				MountPath: "/usr/share/zoneinfo",
-			},
-		})
+// validateVolumeNames makes sure that every volumeMount added by the patches
+// (on app containers and on the bootstrap initContainer) refers to a volume
+// that is added by the same patches or that the pod already has, otherwise the
+// initContainer may write the TZif files into one volume while the app
+// containers mount another one
+func validateVolumeNames(spec *corev1.PodSpec, patches k8tz.Patches) error {
+	volumes := map[string]bool{}
+	for _, v := range spec.Volumes {
+		volumes[v.Name] = true
 	}
 
-	if len(spec.Volumes) == 0 {
-		patches = append(patches, k8tz.Patch{
-			Op:    "add",
-			Path:  fmt.Sprintf("%s/volumes", pathprefix),
-			Value: []corev1.Volume{},
-		})
+	for _, p := range patches {
+		switch v := valueOf(p.Value).(type) {
+		case corev1.Volume:
+			volumes[v.Name] = true
+		case imageVolume:
+			volumes[v.Name] = true
+		}
 	}
 
-	patches = append(patches, k8tz.Patch{
-		Op:   "add",
-		Path: fmt.Sprintf("%s/volumes/-", pathprefix),
-		Value: corev1.Volume{
-			Name: "k8tz",
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Path: g.HostPathPrefix,
-				},
-			},
-		},
-	})
+	for _, p := range patches {
+		var mounts []corev1.VolumeMount
+		switch v := valueOf(p.Value).(type) {
+		case corev1.VolumeMount:
+			mounts = append(mounts, v)
+		case corev1.Container:
+			mounts = append(mounts, v.VolumeMounts...)
+		case sidecarContainer:
+			mounts = append(mounts, v.VolumeMounts...)
+		}
 
-	return patches
+		for _, m := range mounts {
+			if !volumes[m.Name] {
+				return fmt.Errorf("volumeMount '%s' (%s) in patch %s refers to a volume that is not injected", m.Name, m.MountPath, p.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// postInjectionPatches creates the post injection annotations of all the
+// objects, ordered by path so the same object always gets the same patches
+func (g *PatchGenerator) postInjectionPatches(postInjectionAnnotations map[string]*metav1.ObjectMeta) (patches k8tz.Patches, err error) {
+	paths := make([]string, 0, len(postInjectionAnnotations))
+	for k := range postInjectionAnnotations {
+		paths = append(paths, k)
+	}
+
+	sort.Strings(paths)
+	for _, k := range paths {
+		annotations, err := g.createPostInjectionAnnotations(postInjectionAnnotations[k], k)
+		if err != nil {
+			return nil, err
+		}
+
+		patches = append(patches, annotations...)
+	}
+
+	return patches, nil
 }
 
-func (g *PatchGenerator) createPostInjectionAnnotations(meta *metav1.ObjectMeta, pathprefix string) k8tz.Patches {
+func (g *PatchGenerator) createPostInjectionAnnotations(meta *metav1.ObjectMeta, pathprefix string) (k8tz.Patches, error) {
+	annotations := map[string]string{
+		k8tz.InjectedAnnotation: "true",
+		k8tz.TimezoneAnnotation: g.Timezone,
+	}
+
+	if g.Locale != "" {
+		annotations[k8tz.LocaleAnnotation] = g.Locale
+	}
+
+	if g.Strategy == FaketimeInjectionStrategy {
+		annotations[k8tz.FaketimeAnnotation] = g.Faketime
+	}
+
+	if g.TzdataVersion != "" && (g.Strategy.volumeStrategy() == InitContainerInjectionStrategy || g.Strategy == ImageVolumeInjectionStrategy) {
+		annotations[k8tz.TzdataVersionAnnotation] = g.TzdataVersion
+	}
+
+	if g.AnnotateOffset {
+		offset, err := g.offsetAnnotations()
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range offset {
+			annotations[k] = v
+		}
+	}
+
+	return annotationPatches(meta, pathprefix, annotations), nil
+}
+
+// annotationPatches returns the minimal patches that set the annotations on
+// the object. When the object has no annotations the whole map is added in a
+// single operation, so no operation depends on a map that is created by
+// another one; otherwise only missing or different annotations are added, in
+// a stable order.
+func annotationPatches(meta *metav1.ObjectMeta, pathprefix string, annotations map[string]string) k8tz.Patches {
 	var patches = k8tz.Patches{}
+	if len(annotations) == 0 {
+		return patches
+	}
+
 	if len(meta.Annotations) == 0 {
-		patches = append(patches, k8tz.Patch{
+		return append(patches, k8tz.Patch{
 			Op:    "add",
 			Path:  fmt.Sprintf("%s/annotations", pathprefix),
-			Value: map[string]string{},
+			Value: annotations,
 		})
 	}
 
-	patches = append(patches, k8tz.Patch{
-		Op:    "add",
-		Path:  fmt.Sprintf("%s/annotations/%s", pathprefix, escapeJsonPointer(k8tz.InjectedAnnotation)),
-		Value: "true",
-	})
-	patches = append(patches, k8tz.Patch{
-		Op:    "add",
-		Path:  fmt.Sprintf("%s/annotations/%s", pathprefix, escapeJsonPointer(k8tz.TimezoneAnnotation)),
-		Value: g.Timezone,
-	})
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if v, ok := meta.Annotations[k]; ok && v == annotations[k] {
+			continue
+		}
+
+		patches = append(patches, k8tz.Patch{
+			Op:    "add",
+			Path:  fmt.Sprintf("%s/annotations/%s", pathprefix, escapeJsonPointer(k)),
+			Value: annotations[k],
+		})
+	}
 
 	return patches
 }
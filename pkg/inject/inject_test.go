@@ -20,11 +20,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	k8tz "github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/tzdata"
 	"github.com/k8tz/k8tz/pkg/version"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -227,6 +234,45 @@ func TestPatchGenerator_Generate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "DaemonSet object should not raise exception",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "UTC",
+				InitContainerImage: "",
+				HostPathPrefix:     "/",
+			},
+			args: args{
+				object: &appsv1.DaemonSet{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "ReplicaSet object should not raise exception",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "UTC",
+				InitContainerImage: "",
+				HostPathPrefix:     "/",
+			},
+			args: args{
+				object: &appsv1.ReplicaSet{},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Job object should not raise exception",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "UTC",
+				InitContainerImage: "",
+				HostPathPrefix:     "/",
+			},
+			args: args{
+				object: &batchv1.Job{},
+			},
+			wantErr: false,
+		},
 		{
 			name: "List object should not raise exception",
 			fields: fields{
@@ -334,6 +380,10 @@ func TestPatchGenerator_createEnvironmentVariablePatches(t *testing.T) {
 		Timezone           string
 		InitContainerImage string
 		HostPathPrefix     string
+		TimezoneFormat     TimezoneFormat
+		ExtraEnv           ExtraEnv
+		ContainerTimezones map[string]string
+		Locale             string
 	}
 	type args struct {
 		meta       *metav1.ObjectMeta
@@ -409,6 +459,129 @@ func TestPatchGenerator_createEnvironmentVariablePatches(t *testing.T) {
 			},
 			golden: "testdata/env-without-containers.yaml",
 		},
+		{
+			name: "test TZ environment variable in posix format",
+			fields: fields{
+				Strategy:       InitContainerInjectionStrategy,
+				Timezone:       "Europe/Berlin",
+				TimezoneFormat: PosixTimezoneFormat,
+			},
+			args: args{
+				meta: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "container",
+							Image: "alpine",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/env-posix.yaml",
+		},
+		{
+			name: "test extra environment variables for the configured strategy",
+			fields: fields{
+				Strategy: InitContainerInjectionStrategy,
+				Timezone: "Europe/Berlin",
+				ExtraEnv: ExtraEnv{
+					InitContainerInjectionStrategy: {{Name: "ZONEINFO", Value: "/usr/share/zoneinfo"}},
+				},
+			},
+			args: args{
+				meta: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "alpine",
+						},
+						{
+							Name:  "container2",
+							Image: "alpine",
+							Env:   []corev1.EnvVar{{Name: "ZONEINFO", Value: "/custom"}},
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/env-extra-initcontainer.yaml",
+		},
+		{
+			name: "test extra environment variables are not injected for other strategies",
+			fields: fields{
+				Strategy: HostPathInjectionStrategy,
+				Timezone: "Europe/Berlin",
+				ExtraEnv: ExtraEnv{
+					InitContainerInjectionStrategy: {{Name: "ZONEINFO", Value: "/usr/share/zoneinfo"}},
+				},
+			},
+			args: args{
+				meta: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "alpine",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/env-extra-hostpath.yaml",
+		},
+		{
+			name: "test TZ environment variable with container timezones",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Asia/Jakarta",
+				ContainerTimezones: map[string]string{"sidecar": "UTC"},
+			},
+			args: args{
+				meta: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "app",
+							Image: "alpine",
+						},
+						{
+							Name:  "sidecar",
+							Image: "alpine",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/env-container-timezones.yaml",
+		},
+		{
+			name: "test locale environment variables",
+			fields: fields{
+				Strategy: InitContainerInjectionStrategy,
+				Timezone: "Asia/Jakarta",
+				Locale:   "id_ID.UTF-8",
+			},
+			args: args{
+				meta: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "app",
+							Image: "alpine",
+						},
+						{
+							Name:  "legacy",
+							Image: "alpine",
+							Env:   []corev1.EnvVar{{Name: "LC_ALL", Value: "C"}},
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/env-locale.yaml",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -417,9 +590,18 @@ func TestPatchGenerator_createEnvironmentVariablePatches(t *testing.T) {
 				Timezone:           tt.fields.Timezone,
 				InitContainerImage: version.Image(),
 				HostPathPrefix:     "/usr/share/zoneinfo",
+				TimezoneFormat:     tt.fields.TimezoneFormat,
+				ZoneInfoPath:       "testdata/zoneinfo",
+				ExtraEnv:           tt.fields.ExtraEnv,
+				ContainerTimezones: tt.fields.ContainerTimezones,
+				Locale:             tt.fields.Locale,
+			}
+
+			got, err := g.createEnvironmentVariablePatches(tt.args.spec, tt.args.pathprefix)
+			if err != nil {
+				t.Fatal(err)
 			}
 
-			got := g.createEnvironmentVariablePatches(tt.args.spec, tt.args.pathprefix)
 			if err := comparePatches(&got, tt.golden); err != nil {
 				t.Errorf("PatchGenerator.createEnvironmentVariablePatches(): %v", err)
 			}
@@ -433,6 +615,10 @@ func TestPatchGenerator_createInitContainerPatches(t *testing.T) {
 		Timezone           string
 		InitContainerImage string
 		HostPathPrefix     string
+		BootstrapSidecar   bool
+		PullPolicy         corev1.PullPolicy
+		ArchImages         map[string]string
+		ContainerTimezones map[string]string
 	}
 	type args struct {
 		metadata   *metav1.ObjectMeta
@@ -484,6 +670,169 @@ func TestPatchGenerator_createInitContainerPatches(t *testing.T) {
 			},
 			golden: "testdata/initcontainerstrategy-2-containers.json",
 		},
+		{
+			name: "test initContainer patch as native sidecar",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Asia/Tokyo",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+				BootstrapSidecar:   true,
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "container:1",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-sidecar.json",
+		},
+		{
+			name: "test sidecar strategy patch",
+			fields: fields{
+				Strategy:           SidecarInjectionStrategy,
+				Timezone:           "Asia/Tokyo",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "container:1",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-sidecar.json",
+		},
+		{
+			name: "test initContainer patch skips container with projected localtime",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Asia/Tokyo",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "etc",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											ConfigMap: &corev1.ConfigMapProjection{
+												LocalObjectReference: corev1.LocalObjectReference{Name: "tz"},
+												Items:                []corev1.KeyToPath{{Key: "tz", Path: "localtime"}},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:         "container1",
+							Image:        "container:1",
+							VolumeMounts: []corev1.VolumeMount{{Name: "etc", MountPath: "/etc"}},
+						},
+						{
+							Name:  "container2",
+							Image: "container:2",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-projected-localtime.json",
+		},
+		{
+			name: "test initContainer patch uses arch image for arm64 nodeSelector",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Europe/Berlin",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+				PullPolicy:         corev1.PullIfNotPresent,
+				ArchImages: map[string]string{
+					"arm64": "custom.registry.local:5000/repository/k8tz:1.0.0-beta1-arm64",
+				},
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					NodeSelector: map[string]string{"kubernetes.io/arch": "arm64"},
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "container:1",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-arm64.json",
+		},
+		{
+			name: "test initContainer patch uses default image for arch without override",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Europe/Berlin",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+				ArchImages: map[string]string{
+					"arm64": "custom.registry.local:5000/repository/k8tz:1.0.0-beta1-arm64",
+				},
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					NodeSelector: map[string]string{"kubernetes.io/arch": "amd64"},
+					Containers: []corev1.Container{
+						{
+							Name:  "container1",
+							Image: "container:1",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-amd64.json",
+		},
+		{
+			name: "test initContainer patch with container timezones",
+			fields: fields{
+				Strategy:           InitContainerInjectionStrategy,
+				Timezone:           "Asia/Jakarta",
+				InitContainerImage: "custom.registry.local:5000/repository/k8tz:1.0.0-beta1",
+				ContainerTimezones: map[string]string{"sidecar": "UTC"},
+			},
+			args: args{
+				metadata: &metav1.ObjectMeta{Name: "myPod"},
+				spec: &corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "app",
+							Image: "container:1",
+						},
+						{
+							Name:  "sidecar",
+							Image: "container:2",
+						},
+					},
+				},
+				pathprefix: "/spec",
+			},
+			golden: "testdata/initcontainerstrategy-container-timezones.json",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -493,6 +842,11 @@ func TestPatchGenerator_createInitContainerPatches(t *testing.T) {
 				InitContainerImage: tt.fields.InitContainerImage,
 				HostPathPrefix:     "/usr/share/zoneinfo",
 				LocalTimePath:      "/etc/localtime",
+				BootstrapSidecar:   tt.fields.BootstrapSidecar,
+
+				InitContainerImagePullPolicy: tt.fields.PullPolicy,
+				InitContainerArchImages:      tt.fields.ArchImages,
+				ContainerTimezones:           tt.fields.ContainerTimezones,
 			}
 
 			got := g.createInitContainerPatches(tt.args.spec, tt.args.pathprefix)
@@ -605,25 +959,211 @@ func TestPatchGenerator_createPostInjectionAnnotations(t *testing.T) {
 			},
 			golden: "testdata/postinjectionannotations-patch.json",
 		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			g := &PatchGenerator{
-				Strategy:           tt.fields.Strategy,
-				Timezone:           tt.fields.Timezone,
-				InitContainerImage: tt.fields.InitContainerImage,
-				HostPathPrefix:     tt.fields.HostPathPrefix,
-			}
-
-			got := g.createPostInjectionAnnotations(tt.args.meta, tt.args.pathprefix)
-			if err := comparePatches(&got, tt.golden); err != nil {
-				t.Errorf("TestPatchGenerator_createPostInjectionAnnotations: %v", err)
-			}
-		})
-	}
-}
-
-func comparePatches(got *k8tz.Patches, goldenFile string) error {
+		{
+			name: "test post injection annotations with existing annotations",
+			fields: fields{
+				Strategy:       InitContainerInjectionStrategy,
+				Timezone:       "America/Anguilla",
+				HostPathPrefix: "/usr/share/zoneinfo",
+			},
+			args: args{
+				pathprefix: "/spec",
+				meta:       &metav1.ObjectMeta{Name: "k8tz", Annotations: map[string]string{"app": "k8tz"}},
+			},
+			golden: "testdata/postinjectionannotations-existing-patch.json",
+		},
+		{
+			name: "test post injection annotations with explicit timezone annotation",
+			fields: fields{
+				Strategy:       InitContainerInjectionStrategy,
+				Timezone:       "America/Anguilla",
+				HostPathPrefix: "/usr/share/zoneinfo",
+			},
+			args: args{
+				pathprefix: "/spec",
+				meta:       &metav1.ObjectMeta{Name: "k8tz", Annotations: map[string]string{k8tz.TimezoneAnnotation: "America/Anguilla"}},
+			},
+			golden: "testdata/postinjectionannotations-explicit-timezone-patch.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &PatchGenerator{
+				Strategy:           tt.fields.Strategy,
+				Timezone:           tt.fields.Timezone,
+				InitContainerImage: tt.fields.InitContainerImage,
+				HostPathPrefix:     tt.fields.HostPathPrefix,
+			}
+
+			got, err := g.createPostInjectionAnnotations(tt.args.meta, tt.args.pathprefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := comparePatches(&got, tt.golden); err != nil {
+				t.Errorf("TestPatchGenerator_createPostInjectionAnnotations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_offsetAnnotations(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		time     time.Time
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "timezone without daylight saving time",
+			timezone: "Asia/Tokyo",
+			time:     time.Date(2023, time.July, 1, 12, 0, 0, 0, time.UTC),
+			want:     map[string]string{k8tz.OffsetAnnotation: "+09:00", k8tz.AbbreviationAnnotation: "JST"},
+		},
+		{
+			name:     "timezone in standard time",
+			timezone: "Europe/Berlin",
+			time:     time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC),
+			want:     map[string]string{k8tz.OffsetAnnotation: "+01:00", k8tz.AbbreviationAnnotation: "CET"},
+		},
+		{
+			name:     "timezone in daylight saving time",
+			timezone: "America/New_York",
+			time:     time.Date(2023, time.July, 1, 12, 0, 0, 0, time.UTC),
+			want:     map[string]string{k8tz.OffsetAnnotation: "-04:00", k8tz.AbbreviationAnnotation: "EDT"},
+		},
+		{
+			name:     "unknown timezone",
+			timezone: "Mars/Olympus_Mons",
+			time:     time.Date(2023, time.July, 1, 12, 0, 0, 0, time.UTC),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &PatchGenerator{
+				Timezone:       tt.timezone,
+				ZoneInfoPath:   "testdata/zoneinfo",
+				AnnotateOffset: true,
+				now:            func() time.Time { return tt.time },
+			}
+
+			got, err := g.offsetAnnotations()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("offsetAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("offsetAnnotations() = %v, want %v", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			patches, err := g.createPostInjectionAnnotations(&metav1.ObjectMeta{}, "/metadata")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			annotations := patches[0].Value.(map[string]string)
+			for k, v := range tt.want {
+				if annotations[k] != v {
+					t.Errorf("createPostInjectionAnnotations() annotation %s = %q, want %q", k, annotations[k], v)
+				}
+			}
+		})
+	}
+}
+
+func Test_annotationPatches(t *testing.T) {
+	want := map[string]string{
+		k8tz.InjectedAnnotation: "true",
+		k8tz.TimezoneAnnotation: "Europe/Berlin",
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantOps     int
+	}{
+		{
+			name:        "without annotations",
+			annotations: nil,
+			wantOps:     1,
+		},
+		{
+			name:        "with empty annotations",
+			annotations: map[string]string{},
+			wantOps:     1,
+		},
+		{
+			name:        "with unrelated annotations",
+			annotations: map[string]string{"app": "k8tz"},
+			wantOps:     2,
+		},
+		{
+			name:        "with stale annotations",
+			annotations: map[string]string{k8tz.InjectedAnnotation: "false", k8tz.TimezoneAnnotation: "UTC"},
+			wantOps:     2,
+		},
+		{
+			name:        "with all annotations up to date",
+			annotations: map[string]string{k8tz.InjectedAnnotation: "true", k8tz.TimezoneAnnotation: "Europe/Berlin"},
+			wantOps:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tt.annotations}}
+
+			patches := annotationPatches(&pod.ObjectMeta, "/metadata", want)
+			if len(patches) != tt.wantOps {
+				t.Errorf("annotationPatches() returned %d operations, want %d: %+v", len(patches), tt.wantOps, patches)
+			}
+
+			podJSON, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patchJSON, err := json.Marshal(patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patch, err := jsonpatch.DecodePatch(patchJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := patch.Apply(podJSON)
+			if err != nil {
+				t.Fatalf("failed to apply patches: %v", err)
+			}
+
+			var got corev1.Pod
+			if err := json.Unmarshal(patched, &got); err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.annotations {
+				if _, ok := want[k]; !ok && got.Annotations[k] != v {
+					t.Errorf("annotation %s = %q, want it preserved as %q", k, got.Annotations[k], v)
+				}
+			}
+
+			for k, v := range want {
+				if got.Annotations[k] != v {
+					t.Errorf("annotation %s = %q, want %q", k, got.Annotations[k], v)
+				}
+			}
+		})
+	}
+}
+
+func comparePatches(got *k8tz.Patches, goldenFile string) error {
 	hyp, err := json.MarshalIndent(got, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to convert reference to json, reference: %v, err: %v", got, err)
@@ -876,3 +1416,2011 @@ func Test_removeContainerVolume(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateVolumeNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes []corev1.Volume
+		patches k8tz.Patches
+		wantErr bool
+	}{
+		{
+			name:    "no patches",
+			patches: k8tz.Patches{},
+			wantErr: false,
+		},
+		{
+			name: "matching volume, volumeMount and initContainer names",
+			patches: k8tz.Patches{
+				{Op: "add", Path: "/spec/volumes/-", Value: corev1.Volume{Name: VolumeName}},
+				{Op: "add", Path: "/spec/containers/0/volumeMounts/-", Value: corev1.VolumeMount{Name: VolumeName, MountPath: "/etc/localtime"}},
+				{Op: "add", Path: "/spec/initContainers/-", Value: corev1.Container{Name: "k8tz", VolumeMounts: []corev1.VolumeMount{{Name: VolumeName, MountPath: "/mnt/zoneinfo"}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "app container mounts a volume with a different name",
+			patches: k8tz.Patches{
+				{Op: "add", Path: "/spec/volumes/-", Value: corev1.Volume{Name: VolumeName}},
+				{Op: "add", Path: "/spec/containers/0/volumeMounts/-", Value: corev1.VolumeMount{Name: "tzdata", MountPath: "/etc/localtime"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "initContainer writes to a volume with a different name",
+			patches: k8tz.Patches{
+				{Op: "add", Path: "/spec/volumes/-", Value: corev1.Volume{Name: VolumeName}},
+				{Op: "add", Path: "/spec/containers/0/volumeMounts/-", Value: corev1.VolumeMount{Name: VolumeName, MountPath: "/etc/localtime"}},
+				{Op: "add", Path: "/spec/initContainers/-", Value: corev1.Container{Name: "k8tz", VolumeMounts: []corev1.VolumeMount{{Name: "tzdata", MountPath: "/mnt/zoneinfo"}}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "volumeMount without any injected volume",
+			patches: k8tz.Patches{
+				{Op: "add", Path: "/spec/containers/0/volumeMounts/-", Value: corev1.VolumeMount{Name: VolumeName, MountPath: "/etc/localtime"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "volumeMount of a volume that the pod already has",
+			volumes: []corev1.Volume{{Name: VolumeName}},
+			patches: k8tz.Patches{
+				{Op: "add", Path: "/spec/containers/0/volumeMounts/-", Value: volumeMountFragment("/etc/localtime", "UTC")},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateVolumeNames(&corev1.PodSpec{Volumes: tt.volumes}, tt.patches); (err != nil) != tt.wantErr {
+				t.Errorf("validateVolumeNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_minimalPatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy InjectionStrategy
+		sidecar  bool
+		want     int
+	}{
+		{
+			name:     "initContainer strategy",
+			strategy: InitContainerInjectionStrategy,
+			want:     0,
+		},
+		{
+			name:     "hostPath strategy",
+			strategy: HostPathInjectionStrategy,
+			want:     0,
+		},
+		{
+			// native sidecars cannot be found in the pod
+			name:     "bootstrap sidecar",
+			strategy: InitContainerInjectionStrategy,
+			sidecar:  true,
+			want:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = tt.strategy
+			g.BootstrapSidecar = tt.sidecar
+			g.Timezone = "Asia/Jerusalem"
+
+			spec := &corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "LANG", Value: "C"}}}, {Name: "sidecar"}},
+			}
+
+			for i := 0; i < 2; i++ {
+				patches, err := g.forPodSpec(spec, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if i == 1 {
+					if len(patches) != tt.want {
+						t.Errorf("forPodSpec() of an injected pod = %d patches, want %d: %+v", len(patches), tt.want, patches)
+					}
+					return
+				}
+
+				patchJSON, err := json.Marshal(patches)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				patch, err := jsonpatch.DecodePatch(patchJSON)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				specJSON, err := json.Marshal(spec)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if specJSON, err = patch.Apply(specJSON); err != nil {
+					t.Fatal(err)
+				}
+
+				spec = &corev1.PodSpec{}
+				if err = json.Unmarshal(specJSON, spec); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_conflictPolicy(t *testing.T) {
+	spec := func() *corev1.PodSpec {
+		return &corev1.PodSpec{
+			Volumes:        []corev1.Volume{{Name: VolumeName, VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/zoneinfo"}}}},
+			InitContainers: []corev1.Container{{Name: BootstrapContainerName, Image: "k8tz:old"}},
+			Containers: []corev1.Container{
+				{Name: "app", Env: []corev1.EnvVar{{Name: "LANG", Value: "C"}, {Name: "TZ", Value: "UTC"}}},
+				{Name: "sidecar"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		policy  ConflictPolicy
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "replace",
+			policy: ConflictReplace,
+			want: []string{
+				"replace /volumes/0",
+				"replace /initContainers/0",
+				"replace /containers/0/env/1",
+				"add /containers/1/env",
+				"add /containers/1/env/-",
+			},
+		},
+		{
+			name:   "empty policy replaces",
+			policy: "",
+			want: []string{
+				"replace /volumes/0",
+				"replace /initContainers/0",
+				"replace /containers/0/env/1",
+				"add /containers/1/env",
+				"add /containers/1/env/-",
+			},
+		},
+		{
+			name:   "merge",
+			policy: ConflictMerge,
+			want:   []string{"add /containers/1/env", "add /containers/1/env/-"},
+		},
+		{
+			name:    "skip",
+			policy:  ConflictSkip,
+			wantErr: true,
+		},
+		{
+			name:    "unknown policy",
+			policy:  "ignore",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Timezone = "Asia/Jerusalem"
+			g.ConflictPolicy = tt.policy
+
+			patches, err := g.forPodSpec(spec(), "", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, p := range patches {
+				// the volumeMounts are replaced regardless of the policy
+				if strings.Contains(p.Path, "/volumeMounts") {
+					continue
+				}
+				got = append(got, p.Op+" "+p.Path)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forPodSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_windowsPods(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   InjectionStrategy
+		spec       corev1.PodSpec
+		want       []string
+		wantTzdata bool
+	}{
+		{
+			name:     "linux pod",
+			strategy: InitContainerInjectionStrategy,
+			spec:     corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Linux}, Containers: []corev1.Container{{Name: "app"}}},
+			want: []string{
+				"add /volumes",
+				"add /volumes/-",
+				"add /containers/0/volumeMounts",
+				"add /containers/0/volumeMounts/-",
+				"add /containers/0/volumeMounts/-",
+				"add /initContainers",
+				"add /initContainers/-",
+				"add /containers/0/env",
+				"add /containers/0/env/-",
+			},
+			wantTzdata: true,
+		},
+		{
+			name:     "spec.os.name",
+			strategy: InitContainerInjectionStrategy,
+			spec:     corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Windows}, Containers: []corev1.Container{{Name: "app"}}},
+			want:     []string{"add /containers/0/env", "add /containers/0/env/-"},
+		},
+		{
+			name:     "nodeSelector",
+			strategy: HostPathInjectionStrategy,
+			spec: corev1.PodSpec{
+				NodeSelector: map[string]string{corev1.LabelOSStable: "windows"},
+				Containers:   []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "A", Value: "B"}}}},
+			},
+			want: []string{"add /containers/0/env/-"},
+		},
+		{
+			name:     "windows strategy",
+			strategy: WindowsInjectionStrategy,
+			spec:     corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			want:     []string{"add /containers/0/env", "add /containers/0/env/-"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = tt.strategy
+			g.Timezone = "Asia/Jerusalem"
+			g.TzdataVersion = "2023c"
+
+			patches, err := g.forPodSpec(&tt.spec, "", map[string]*metav1.ObjectMeta{"/metadata": {}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			var tzdata bool
+			for _, p := range patches {
+				if annotations, ok := p.Value.(map[string]string); ok && p.Path == "/metadata/annotations" {
+					_, tzdata = annotations[k8tz.TzdataVersionAnnotation]
+					continue
+				}
+				got = append(got, p.Op+" "+p.Path)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forPodSpec() = %v, want %v", got, tt.want)
+			}
+
+			if tzdata != tt.wantTzdata {
+				t.Errorf("forPodSpec() tzdata version annotated = %v, want %v", tzdata, tt.wantTzdata)
+			}
+
+			if g.Strategy != tt.strategy {
+				t.Errorf("forPodSpec() changed the strategy of the generator to %s", g.Strategy)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_tzdataStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		tzdir     string
+		container corev1.Container
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "default tzdir",
+			container: corev1.Container{Name: "app"},
+			want: []string{
+				"add /containers/0/volumeMounts",
+				"add /containers/0/volumeMounts/- k8tz:/usr/share/zoneinfo",
+				"add /containers/0/env",
+				"add /containers/0/env/- TZ=Europe/London",
+				"add /containers/0/env/- TZDIR=/usr/share/zoneinfo",
+			},
+		},
+		{
+			name:  "custom tzdir replaces the localtime mount",
+			tzdir: "/opt/zoneinfo",
+			container: corev1.Container{
+				Name:         "app",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}, {Name: "tz", MountPath: "/etc/localtime"}},
+			},
+			want: []string{
+				"remove /containers/0/volumeMounts/1",
+				"add /containers/0/volumeMounts/- k8tz:/opt/zoneinfo",
+				"add /containers/0/env",
+				"add /containers/0/env/- TZ=Europe/London",
+				"add /containers/0/env/- TZDIR=/opt/zoneinfo",
+			},
+		},
+		{
+			name:  "existing TZDIR is kept",
+			tzdir: "/opt/zoneinfo",
+			container: corev1.Container{
+				Name: "app",
+				Env:  []corev1.EnvVar{{Name: "TZDIR", Value: "/zoneinfo"}},
+			},
+			want: []string{
+				"add /containers/0/volumeMounts",
+				"add /containers/0/volumeMounts/- k8tz:/opt/zoneinfo",
+				"add /containers/0/env/- TZ=Europe/London",
+			},
+		},
+		{
+			name:      "relative tzdir",
+			tzdir:     "zoneinfo",
+			container: corev1.Container{Name: "app"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = TzdataInjectionStrategy
+			g.Timezone = "Europe/London"
+			g.Tzdir = tt.tzdir
+
+			spec := &corev1.PodSpec{Containers: []corev1.Container{tt.container}}
+			patches, err := g.forPodSpec(spec, "", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, p := range patches {
+				if !strings.HasPrefix(p.Path, "/containers/") {
+					continue
+				}
+
+				switch v := valueOf(p.Value).(type) {
+				case corev1.VolumeMount:
+					got = append(got, fmt.Sprintf("%s %s %s:%s", p.Op, p.Path, v.Name, v.MountPath))
+				case corev1.EnvVar:
+					got = append(got, fmt.Sprintf("%s %s %s=%s", p.Op, p.Path, v.Name, v.Value))
+				default:
+					got = append(got, p.Op+" "+p.Path)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forPodSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	const nfs InjectionStrategy = "nfs"
+	defer func() {
+		strategiesLock.Lock()
+		delete(strategies, nfs)
+		strategiesLock.Unlock()
+	}()
+
+	err := RegisterStrategy(nfs, StrategyFunc(func(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+		patches := k8tz.Patches{
+			{Op: "add", Path: pathprefix + "/volumes", Value: []corev1.Volume{{
+				Name:         VolumeName,
+				VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "tzdata.example.com", Path: "/zoneinfo"}},
+			}}},
+		}
+		for i := range spec.Containers {
+			patches = append(patches, k8tz.Patch{
+				Op:    "add",
+				Path:  fmt.Sprintf("%s/containers/%d/volumeMounts", pathprefix, i),
+				Value: []corev1.VolumeMount{{Name: VolumeName, MountPath: g.LocalTimePath, SubPath: g.Timezone}},
+			})
+		}
+		return patches, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []InjectionStrategy{nfs, InitContainerInjectionStrategy, ""} {
+		if err := RegisterStrategy(name, StrategyFunc(windowsStrategy)); err == nil {
+			t.Errorf("RegisterStrategy(%q) error = nil, want error", name)
+		}
+	}
+
+	if err := RegisterStrategy("nil", nil); err == nil {
+		t.Error("RegisterStrategy() of nil strategy error = nil, want error")
+	}
+
+	want := append(append([]InjectionStrategy{}, InjectionStrategies...), nfs)
+	if got := RegisteredStrategies(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RegisteredStrategies() = %v, want %v", got, want)
+	}
+
+	g := NewPatchGenerator()
+	g.Strategy = nfs
+	g.Timezone = "Europe/Rome"
+	g.TzdataVersion = "2023c"
+	patches, err := g.forPodSpec(&corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}, "/spec", map[string]*metav1.ObjectMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range patches {
+		got = append(got, p.Op+" "+p.Path)
+	}
+
+	wantPatches := []string{"add /spec/volumes", "add /spec/containers/0/volumeMounts", "add /spec/containers/0/env", "add /spec/containers/0/env/-"}
+	if !reflect.DeepEqual(got, wantPatches) {
+		t.Errorf("forPodSpec() = %v, want %v", got, wantPatches)
+	}
+
+	g.Strategy = "unknown"
+	if _, err := g.forPodSpec(&corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}, "/spec", map[string]*metav1.ObjectMeta{}); err == nil {
+		t.Error("forPodSpec() of unknown strategy error = nil, want error")
+	}
+
+	env := ExtraEnv{}
+	if err := env.Set("nfs:TZDIR_HINT=/tz"); err != nil {
+		t.Errorf("ExtraEnv.Set() of custom strategy error = %v", err)
+	}
+}
+
+func TestValidateHostPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		dir     string
+		roots   []string
+		wantErr bool
+	}{
+		{name: "default without roots", dir: DefaultHostPathPrefix},
+		{name: "root itself", dir: "/opt/zoneinfo", roots: []string{"/opt/zoneinfo"}},
+		{name: "inside root", dir: "/opt/zoneinfo/2023c", roots: []string{DefaultHostPathPrefix, "/opt/zoneinfo/"}},
+		{name: "outside roots", dir: "/etc", roots: []string{DefaultHostPathPrefix}, wantErr: true},
+		{name: "sibling with common prefix", dir: "/opt/zoneinfo2", roots: []string{"/opt/zoneinfo"}, wantErr: true},
+		{name: "relative", dir: "zoneinfo", wantErr: true},
+		{name: "not clean", dir: "/opt/zoneinfo/../../etc", roots: []string{"/opt/zoneinfo"}, wantErr: true},
+		{name: "root directory", dir: "/", wantErr: true},
+		{name: "empty root", dir: "/etc", roots: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHostPath(tt.dir, tt.roots); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateHostPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_hostPathType(t *testing.T) {
+	tests := []struct {
+		name         string
+		hostPathType corev1.HostPathType
+		want         *corev1.HostPathType
+		wantErr      bool
+	}{
+		{name: "unset", hostPathType: corev1.HostPathUnset},
+		{name: "directory", hostPathType: corev1.HostPathDirectory, want: func() *corev1.HostPathType { d := corev1.HostPathDirectory; return &d }()},
+		{name: "directory or create", hostPathType: corev1.HostPathDirectoryOrCreate, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = HostPathInjectionStrategy
+			g.HostPathType = tt.hostPathType
+
+			patches, err := g.forPodSpec(&corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}, "", map[string]*metav1.ObjectMeta{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			for _, p := range patches {
+				if volume, ok := valueOf(p.Value).(corev1.Volume); ok {
+					if !reflect.DeepEqual(volume.HostPath.Type, tt.want) {
+						t.Errorf("forPodSpec() hostPath type = %v, want %v", volume.HostPath.Type, tt.want)
+					}
+
+					for _, mount := range patches {
+						if m, ok := valueOf(mount.Value).(corev1.VolumeMount); ok && !m.ReadOnly {
+							t.Errorf("forPodSpec() volumeMount %s is not read-only", m.MountPath)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_volumeStrategies(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     InjectionStrategy
+		configure    func(g *PatchGenerator)
+		wantVolume   string
+		wantSubPaths []string
+		wantErr      bool
+	}{
+		{
+			name:     "csi",
+			strategy: CSIInjectionStrategy,
+			configure: func(g *PatchGenerator) {
+				g.CSIDriver = "image.csi.k8s.io"
+				g.CSIVolumeAttributes = map[string]string{"image": "quay.io/k8tz/tzdata"}
+			},
+			wantVolume:   `{"name":"k8tz","csi":{"driver":"image.csi.k8s.io","readOnly":true,"volumeAttributes":{"image":"quay.io/k8tz/tzdata"}}}`,
+			wantSubPaths: []string{"Europe/Rome", ""},
+		},
+		{
+			name:     "csi with zoneinfo path",
+			strategy: CSIInjectionStrategy,
+			configure: func(g *PatchGenerator) {
+				g.CSIDriver = "tzdata.example.com"
+				g.CSIZoneInfoPath = "zoneinfo"
+			},
+			wantVolume:   `{"name":"k8tz","csi":{"driver":"tzdata.example.com","readOnly":true}}`,
+			wantSubPaths: []string{"zoneinfo/Europe/Rome", "zoneinfo"},
+		},
+		{
+			name:      "csi without driver",
+			strategy:  CSIInjectionStrategy,
+			configure: func(g *PatchGenerator) {},
+			wantErr:   true,
+		},
+		{
+			name:     "csi with zoneinfo path outside the volume",
+			strategy: CSIInjectionStrategy,
+			configure: func(g *PatchGenerator) {
+				g.CSIDriver = "tzdata.example.com"
+				g.CSIZoneInfoPath = "../zoneinfo"
+			},
+			wantErr: true,
+		},
+		{
+			name:     "image",
+			strategy: ImageVolumeInjectionStrategy,
+			configure: func(g *PatchGenerator) {
+				g.InitContainerImage = "quay.io/k8tz/k8tz:0.0.0"
+				g.InitContainerImagePullPolicy = corev1.PullIfNotPresent
+			},
+			wantVolume:   `{"name":"k8tz","image":{"reference":"quay.io/k8tz/k8tz:0.0.0","pullPolicy":"IfNotPresent"}}`,
+			wantSubPaths: []string{"usr/share/zoneinfo/Europe/Rome", "usr/share/zoneinfo"},
+		},
+		{
+			name:     "image without bootstrap image",
+			strategy: ImageVolumeInjectionStrategy,
+			configure: func(g *PatchGenerator) {
+				g.InitContainerImage = ""
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = tt.strategy
+			g.Timezone = "Europe/Rome"
+			tt.configure(&g)
+
+			patches, err := g.forPodSpec(&corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}, "", map[string]*metav1.ObjectMeta{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var subPaths []string
+			for _, p := range patches {
+				if strings.Contains(p.Path, "initContainers") {
+					t.Errorf("forPodSpec() patch %s adds an initContainer", p.Path)
+				}
+
+				if p.Path == "/volumes/-" {
+					got, err := json.Marshal(p.Value)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if string(got) != tt.wantVolume {
+						t.Errorf("forPodSpec() volume = %s, want %s", got, tt.wantVolume)
+					}
+				}
+
+				if m, ok := valueOf(p.Value).(corev1.VolumeMount); ok {
+					subPaths = append(subPaths, m.SubPath)
+				}
+			}
+
+			if !reflect.DeepEqual(subPaths, tt.wantSubPaths) {
+				t.Errorf("forPodSpec() volumeMount subPaths = %q, want %q", subPaths, tt.wantSubPaths)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_imageStrategyInjected(t *testing.T) {
+	g := NewPatchGenerator()
+	g.Strategy = ImageVolumeInjectionStrategy
+
+	// the image source of injected pods is dropped by the API types
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app"}},
+		Volumes:    []corev1.Volume{{Name: VolumeName}},
+		EphemeralContainers: []corev1.EphemeralContainer{
+			{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}},
+		},
+	}}
+
+	if got := podVolumeStrategy(&pod.Spec); got != ImageVolumeInjectionStrategy {
+		t.Errorf("podVolumeStrategy() = %s, want %s", got, ImageVolumeInjectionStrategy)
+	}
+
+	patches, err := g.ForEphemeralContainers(pod, []int{0}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range patches {
+		if strings.HasSuffix(p.Path, "/volumeMounts") || strings.HasSuffix(p.Path, "/volumeMounts/-") {
+			t.Errorf("ForEphemeralContainers() patch %s mounts the image volume without subPath", p.Path)
+		}
+	}
+
+	patches, err = g.forPodSpec(&pod.Spec, "", map[string]*metav1.ObjectMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := false
+	for _, p := range patches {
+		replaced = replaced || (p.Op == "replace" && p.Path == "/volumes/0")
+	}
+
+	if !replaced {
+		t.Errorf("forPodSpec() = %v, want the volume without source replaced", patches)
+	}
+}
+
+func Test_cachedFragment(t *testing.T) {
+	first := volumeMountFragment("/etc/localtime", "Europe/London")
+	second := volumeMountFragment("/etc/localtime", "Europe/London")
+
+	if _, ok := first.(fragment); !ok {
+		t.Fatalf("cachedFragment() = %T, want a fragment", first)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cachedFragment() = %+v, want the cached %+v", second, first)
+	}
+
+	got, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := json.Marshal(valueOf(first))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(want) {
+		t.Errorf("fragment marshaled to %s, want %s", got, want)
+	}
+}
+
+func TestPatchGenerator_hasProvidedLocalTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		volumes []corev1.Volume
+		mounts  []corev1.VolumeMount
+		want    bool
+	}{
+		{
+			name: "no volumes",
+			want: false,
+		},
+		{
+			name: "hostPath volume mounted on localtime is not provided",
+			volumes: []corev1.Volume{
+				{Name: "tz", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/etc/localtime"}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "tz", MountPath: "/etc/localtime"}},
+			want:   false,
+		},
+		{
+			name: "configMap mounted on localtime with subPath",
+			volumes: []corev1.Volume{
+				{Name: "tz", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tz"}}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "tz", MountPath: "/etc/localtime", SubPath: "Asia/Tokyo"}},
+			want:   true,
+		},
+		{
+			name: "projected volume on /etc with localtime item",
+			volumes: []corev1.Volume{
+				{Name: "etc", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{{Path: "labels"}}}},
+					{ConfigMap: &corev1.ConfigMapProjection{Items: []corev1.KeyToPath{{Key: "tz", Path: "localtime"}}}},
+				}}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "etc", MountPath: "/etc"}},
+			want:   true,
+		},
+		{
+			name: "projected volume on /etc without localtime item",
+			volumes: []corev1.Volume{
+				{Name: "etc", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{{Path: "labels"}}}},
+				}}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "etc", MountPath: "/etc"}},
+			want:   false,
+		},
+		{
+			name: "secret with all keys on /etc",
+			volumes: []corev1.Volume{
+				{Name: "etc", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "etc"}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "etc", MountPath: "/etc/"}},
+			want:   true,
+		},
+		{
+			name: "secret mounted elsewhere",
+			volumes: []corev1.Volume{
+				{Name: "certs", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "certs"}}},
+			},
+			mounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/etc/ssl"}},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &PatchGenerator{LocalTimePath: "/etc/localtime"}
+			spec := &corev1.PodSpec{
+				Volumes:    tt.volumes,
+				Containers: []corev1.Container{{Name: "app", VolumeMounts: tt.mounts}},
+			}
+
+			if got := g.hasProvidedLocalTime(spec, &spec.Containers[0]); got != tt.want {
+				t.Errorf("PatchGenerator.hasProvidedLocalTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_enforcePodSecurity(t *testing.T) {
+	nonRoot := corev1.PodSecurityContext{RunAsNonRoot: &True}
+	tests := []struct {
+		name        string
+		strategy    InjectionStrategy
+		level       PodSecurityLevel
+		action      PodSecurityAction
+		podContext  *corev1.PodSecurityContext
+		security    BootstrapSecurityContext
+		wantErr     bool
+		wantNonRoot bool
+	}{
+		{
+			name:     "ignore action never fails",
+			strategy: HostPathInjectionStrategy,
+			level:    PodSecurityRestricted,
+			action:   PodSecurityIgnore,
+			wantErr:  false,
+		},
+		{
+			name:     "privileged level never fails",
+			strategy: HostPathInjectionStrategy,
+			level:    PodSecurityPrivileged,
+			action:   PodSecurityDeny,
+			wantErr:  false,
+		},
+		{
+			name:     "hostPath violates baseline",
+			strategy: HostPathInjectionStrategy,
+			level:    PodSecurityBaseline,
+			action:   PodSecurityAdjust,
+			wantErr:  true,
+		},
+		{
+			name:     "initContainer complies with baseline",
+			strategy: InitContainerInjectionStrategy,
+			level:    PodSecurityBaseline,
+			action:   PodSecurityDeny,
+			wantErr:  false,
+		},
+		{
+			name:     "initContainer without runAsNonRoot is denied on restricted",
+			strategy: InitContainerInjectionStrategy,
+			level:    PodSecurityRestricted,
+			action:   PodSecurityDeny,
+			wantErr:  true,
+		},
+		{
+			name:        "initContainer is adjusted to runAsNonRoot on restricted",
+			strategy:    InitContainerInjectionStrategy,
+			level:       PodSecurityRestricted,
+			action:      PodSecurityAdjust,
+			wantErr:     false,
+			wantNonRoot: true,
+		},
+		{
+			name:       "pod level runAsNonRoot complies with restricted",
+			strategy:   InitContainerInjectionStrategy,
+			level:      PodSecurityRestricted,
+			action:     PodSecurityDeny,
+			podContext: &nonRoot,
+			wantErr:    false,
+		},
+		{
+			name:        "configured runAsNonRoot complies with restricted",
+			strategy:    InitContainerInjectionStrategy,
+			level:       PodSecurityRestricted,
+			action:      PodSecurityDeny,
+			security:    BootstrapSecurityContext{RunAsNonRoot: true},
+			wantErr:     false,
+			wantNonRoot: true,
+		},
+		{
+			name:     "invalid seccomp profile",
+			strategy: InitContainerInjectionStrategy,
+			action:   PodSecurityIgnore,
+			security: BootstrapSecurityContext{SeccompProfile: "Localhost"},
+			wantErr:  true,
+		},
+		{
+			name:     "unconfined seccomp profile is denied on baseline",
+			strategy: InitContainerInjectionStrategy,
+			level:    PodSecurityBaseline,
+			action:   PodSecurityDeny,
+			security: BootstrapSecurityContext{SeccompProfile: "Unconfined"},
+			wantErr:  true,
+		},
+		{
+			name:     "unconfined seccomp profile is adjusted on baseline",
+			strategy: InitContainerInjectionStrategy,
+			level:    PodSecurityBaseline,
+			action:   PodSecurityAdjust,
+			security: BootstrapSecurityContext{SeccompProfile: "Unconfined"},
+			wantErr:  false,
+		},
+		{
+			name:       "violations of the pod itself are left to the api server",
+			strategy:   InitContainerInjectionStrategy,
+			level:      PodSecurityRestricted,
+			action:     PodSecurityDeny,
+			podContext: &corev1.PodSecurityContext{RunAsNonRoot: &True, Sysctls: []corev1.Sysctl{{Name: "kernel.msgmax", Value: "1"}}},
+			wantErr:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = tt.strategy
+			g.PodSecurityLevel = tt.level
+			g.PodSecurityAction = tt.action
+			g.InitContainerSecurityContext = tt.security
+
+			spec := &corev1.PodSpec{
+				SecurityContext: tt.podContext,
+				Containers:      []corev1.Container{{Name: "app"}},
+			}
+
+			patches, err := g.forPodSpec(spec, "/spec", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			nonRoot := false
+			for _, p := range patches {
+				if c, ok := valueOf(p.Value).(corev1.Container); ok && c.SecurityContext.RunAsNonRoot != nil {
+					nonRoot = *c.SecurityContext.RunAsNonRoot
+				}
+			}
+
+			if nonRoot != tt.wantNonRoot {
+				t.Errorf("forPodSpec() initContainer runAsNonRoot = %v, want %v", nonRoot, tt.wantNonRoot)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_enforcePodSecurity_adjust(t *testing.T) {
+	root := int64(0)
+	tests := []struct {
+		name       string
+		level      PodSecurityLevel
+		podContext *corev1.PodSecurityContext
+		context    *corev1.SecurityContext
+		wantErr    bool
+	}{
+		{
+			name:  "no securityContext",
+			level: PodSecurityRestricted,
+		},
+		{
+			name:  "every restricted check fails",
+			level: PodSecurityRestricted,
+			context: &corev1.SecurityContext{
+				Privileged:               &True,
+				AllowPrivilegeEscalation: &True,
+				RunAsNonRoot:             &False,
+				RunAsUser:                &root,
+				Capabilities:             &corev1.Capabilities{Add: []corev1.Capability{"SYS_ADMIN", "NET_BIND_SERVICE"}},
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+			},
+		},
+		{
+			name:    "baseline capabilities",
+			level:   PodSecurityBaseline,
+			context: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN", "CHOWN"}}},
+		},
+		{
+			name:       "seccomp profile of the pod",
+			level:      PodSecurityRestricted,
+			podContext: &corev1.PodSecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}},
+		},
+		{
+			name:    "host process cannot be adjusted",
+			level:   PodSecurityBaseline,
+			context: &corev1.SecurityContext{WindowsOptions: &corev1.WindowsSecurityContextOptions{HostProcess: &True}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.PodSecurityLevel = tt.level
+			g.PodSecurityAction = PodSecurityAdjust
+
+			spec := &corev1.PodSpec{
+				SecurityContext: tt.podContext,
+				Containers:      []corev1.Container{{Name: "app"}},
+			}
+
+			injected := corev1.Container{Name: "k8tz", SecurityContext: tt.context}
+			patches := k8tz.Patches{
+				{Op: "add", Path: "/spec/initContainers", Value: []corev1.Container{}},
+				{Op: "add", Path: "/spec/initContainers/-", Value: injected},
+			}
+
+			got, err := g.enforcePodSecurity(spec, "/spec", patches)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("enforcePodSecurity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			mutated, err := applyPodSpecPatches(spec, "/spec", got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the app container is left to the api server
+			for _, violation := range checkPodSecurity(tt.level, mutated) {
+				if violation.container == injected.Name {
+					t.Errorf("adjusted container violates the %s level: %s", tt.level, violation.message)
+				}
+			}
+
+			if !reflect.DeepEqual(injected, patches[1].Value) {
+				t.Errorf("enforcePodSecurity() changed the container of the patches = %+v", patches[1].Value)
+			}
+		})
+	}
+}
+
+func Test_checkPodSecurity(t *testing.T) {
+	hostPathType := corev1.HostPathFile
+	unmasked := corev1.UnmaskedProcMount
+	tests := []struct {
+		name  string
+		level PodSecurityLevel
+		spec  corev1.PodSpec
+		want  []string
+	}{
+		{
+			name:  "host namespaces and volumes",
+			level: PodSecurityBaseline,
+			spec: corev1.PodSpec{
+				HostNetwork: true,
+				HostPID:     true,
+				Volumes: []corev1.Volume{
+					{Name: "host", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/etc/localtime", Type: &hostPathType}}},
+					{Name: "nfs", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/"}}},
+				},
+				Containers: []corev1.Container{{Name: "app", Ports: []corev1.ContainerPort{{ContainerPort: 80, HostPort: 80}}}},
+			},
+			want: []string{
+				"pod must not set hostNetwork=true",
+				"pod must not set hostPID=true",
+				"hostPath volume 'host' is forbidden, use the initContainer strategy",
+				"container 'app' must not set hostPort 80",
+			},
+		},
+		{
+			name:  "restricted volumes",
+			level: PodSecurityRestricted,
+			spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{
+					RunAsNonRoot:   &True,
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				Volumes: []corev1.Volume{
+					{Name: "nfs", VolumeSource: corev1.VolumeSource{NFS: &corev1.NFSVolumeSource{Server: "nfs", Path: "/"}}},
+					{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{}}},
+				},
+				Containers: []corev1.Container{{Name: "app", SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: &False,
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				}}},
+			},
+			want: []string{
+				"volume 'nfs' must be of a type allowed by the restricted level (configMap, csi, downwardAPI, emptyDir, ephemeral, persistentVolumeClaim, projected or secret)",
+			},
+		},
+		{
+			name:  "baseline containers",
+			level: PodSecurityBaseline,
+			spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{Sysctls: []corev1.Sysctl{{Name: "net.ipv4.tcp_syncookies"}, {Name: "kernel.msgmax"}}},
+				EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+					Name:            "debug",
+					SecurityContext: &corev1.SecurityContext{ProcMount: &unmasked, SELinuxOptions: &corev1.SELinuxOptions{Type: "spc_t"}},
+				}}},
+			},
+			want: []string{
+				"pod must not set the sysctl kernel.msgmax",
+				"container 'debug' must not set securityContext.procMount=Unmasked",
+				"container 'debug' must not set securityContext.seLinuxOptions other than the container types",
+			},
+		},
+		{
+			name:  "windows pod",
+			level: PodSecurityRestricted,
+			spec: corev1.PodSpec{
+				OS:         &corev1.PodOS{Name: corev1.Windows},
+				Containers: []corev1.Container{{Name: "app"}},
+			},
+			want: []string{
+				"container 'app' must set securityContext.runAsNonRoot=true",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, violation := range checkPodSecurity(tt.level, &tt.spec) {
+				got = append(got, violation.message)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkPodSecurity() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPosixTZ(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "timezone with daylight saving time",
+			timezone: "Europe/Berlin",
+			want:     "CET-1CEST,M3.5.0,M10.5.0/3",
+		},
+		{
+			name:     "timezone with daylight saving time in the west",
+			timezone: "America/New_York",
+			want:     "EST5EDT,M3.2.0,M11.1.0",
+		},
+		{
+			name:     "timezone without daylight saving time",
+			timezone: "Asia/Tokyo",
+			want:     "JST-9",
+		},
+		{
+			name:     "unknown timezone",
+			timezone: "Mars/Olympus_Mons",
+			wantErr:  true,
+		},
+		{
+			name:     "path traversal",
+			timezone: "../../../etc/passwd",
+			wantErr:  true,
+		},
+		{
+			name:     "not a TZif file",
+			timezone: "README",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PosixTZ("testdata/zoneinfo", tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PosixTZ() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("PosixTZ() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		name     string
+		zoneinfo string
+		timezone string
+		wantErr  bool
+	}{
+		{
+			name:     "known timezone",
+			timezone: "Asia/Tokyo",
+		},
+		{
+			name:     "unknown timezone",
+			timezone: "Mars/Olympus_Mons",
+			wantErr:  true,
+		},
+		{
+			name:     "directory",
+			timezone: "Europe",
+			wantErr:  true,
+		},
+		{
+			name:     "not a TZif file",
+			timezone: "README",
+			wantErr:  true,
+		},
+		{
+			name:     "path traversal",
+			timezone: "../../../etc/passwd",
+			wantErr:  true,
+		},
+		{
+			name:     "embedded tz database without zoneinfo",
+			zoneinfo: "testdata/missing",
+			timezone: "Pacific/Auckland",
+		},
+		{
+			name:     "unknown timezone of the embedded tz database",
+			zoneinfo: "testdata/missing",
+			timezone: "Mars/Olympus_Mons",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zoneinfo := tt.zoneinfo
+			if zoneinfo == "" {
+				zoneinfo = "testdata/zoneinfo"
+			}
+
+			if err := ValidateTimezone(zoneinfo, tt.timezone); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTimezone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	tests := []struct {
+		locale  string
+		wantErr bool
+	}{
+		{locale: "en_US.UTF-8"},
+		{locale: "de_DE.UTF-8@euro"},
+		{locale: "ja_JP"},
+		{locale: "C.UTF-8"},
+		{locale: "POSIX"},
+		{locale: "xx_YY.UTF-8", wantErr: true},
+		{locale: "en_US.UTF 8", wantErr: true},
+		{locale: "en-US", wantErr: true},
+		{locale: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			if err := ValidateLocale(tt.locale); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLocale() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCanonicalTimezone(t *testing.T) {
+	tests := []struct {
+		timezone string
+		want     string
+		wantErr  bool
+	}{
+		{timezone: "Asia/Calcutta", want: "Asia/Kolkata"},
+		{timezone: "US/Eastern", want: "America/New_York"},
+		{timezone: "Europe/Kiev", want: "Europe/Kyiv"},
+		{timezone: "EST5EDT", want: "America/New_York"},
+		{timezone: "Asia/Kolkata", want: "Asia/Kolkata"},
+		{timezone: "UTC", want: "UTC"},
+		{timezone: "Mars/Olympus_Mons", want: "Mars/Olympus_Mons"},
+		{timezone: "IST", wantErr: true},
+		{timezone: "PST", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.timezone, func(t *testing.T) {
+			got, err := CanonicalTimezone(tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CanonicalTimezone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("CanonicalTimezone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "link and abbreviation", data: "# comment\nLink\tAsia/Kolkata\tAsia/Calcutta # inline\n\nAbbrev\tIST\tAsia/Kolkata\n"},
+		{name: "duplicate alias", data: "Link Asia/Kolkata Asia/Calcutta\nLink Asia/Dhaka Asia/Calcutta\n", wantErr: true},
+		{name: "link to alias", data: "Link Asia/Kolkata Asia/Calcutta\nLink Asia/Calcutta India\n", wantErr: true},
+		{name: "unknown directive", data: "Zone Asia/Kolkata 5:30 - IST\n", wantErr: true},
+		{name: "abbreviation without timezones", data: "Abbrev IST\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseAliases(tt.data); (err != nil) != tt.wantErr {
+				t.Errorf("parseAliases() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_canonicalTimezones(t *testing.T) {
+	g := NewPatchGenerator()
+	g.Timezone = "Asia/Calcutta"
+	g.ContainerTimezones = map[string]string{"app": "US/Pacific"}
+
+	patches, err := g.Generate(&corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, p := range patches {
+		if env, ok := valueOf(p.Value).(corev1.EnvVar); ok {
+			got = append(got, env.Value)
+		}
+	}
+
+	if want := []string{"America/Los_Angeles", "Asia/Kolkata"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Generate() TZ = %v, want %v", got, want)
+	}
+
+	if g.Timezone != "Asia/Calcutta" || g.ContainerTimezones["app"] != "US/Pacific" {
+		t.Errorf("Generate() changed the timezones of the generator")
+	}
+
+	g.Timezone = "IST"
+	if _, err := g.Generate(&corev1.Pod{}, ""); err == nil {
+		t.Errorf("Generate() error = nil for a timezone abbreviation")
+	}
+}
+
+func TestExtraEnv_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "single variable",
+			values: []string{"initContainer:ZONEINFO=/usr/share/zoneinfo"},
+			want:   "[initContainer:ZONEINFO=/usr/share/zoneinfo]",
+		},
+		{
+			name:   "same variable for both strategies",
+			values: []string{"initContainer:ZONEINFO=/usr/share/zoneinfo", "hostPath:ZONEINFO=/usr/share/zoneinfo"},
+			want:   "[hostPath:ZONEINFO=/usr/share/zoneinfo,initContainer:ZONEINFO=/usr/share/zoneinfo]",
+		},
+		{
+			name:    "missing strategy",
+			values:  []string{"ZONEINFO=/usr/share/zoneinfo"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown strategy",
+			values:  []string{"sidecar:ZONEINFO=/usr/share/zoneinfo"},
+			wantErr: true,
+		},
+		{
+			name:    "illegal name",
+			values:  []string{"initContainer:1ZONEINFO=/usr/share/zoneinfo"},
+			wantErr: true,
+		},
+		{
+			name:    "collision with TZ",
+			values:  []string{"initContainer:TZ=UTC"},
+			wantErr: true,
+		},
+		{
+			name:    "collision with LANG of the locale",
+			values:  []string{"initContainer:LANG=C.UTF-8"},
+			wantErr: true,
+		},
+		{
+			name:    "collision with LC_ALL of the locale",
+			values:  []string{"hostPath:LC_ALL=C"},
+			wantErr: true,
+		},
+		{
+			name:    "collision with TZDIR of the tzdata strategy",
+			values:  []string{"initContainer:TZDIR=/usr/share/zoneinfo"},
+			wantErr: true,
+		},
+		{
+			name:    "collision with FAKETIME of the faketime strategy",
+			values:  []string{"initContainer:FAKETIME=@2000-01-01 00:00:00"},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate variable",
+			values:  []string{"hostPath:ZONEINFO=/a", "hostPath:ZONEINFO=/b"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e ExtraEnv
+			var err error
+			for _, v := range tt.values {
+				if err = e.Set(v); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtraEnv.Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && e.String() != tt.want {
+				t.Errorf("ExtraEnv.String() = %v, want %v", e.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSeccompProfile_Set(t *testing.T) {
+	localhost := "profiles/k8tz.json"
+	tests := []struct {
+		name    string
+		value   string
+		want    *corev1.SeccompProfile
+		wantErr bool
+	}{
+		{
+			name:  "empty is RuntimeDefault",
+			value: "",
+			want:  &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+		{
+			name:  "unconfined",
+			value: "Unconfined",
+			want:  &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined},
+		},
+		{
+			name:  "localhost",
+			value: "Localhost=profiles/k8tz.json",
+			want:  &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &localhost},
+		},
+		{
+			name:    "localhost without path",
+			value:   "Localhost",
+			wantErr: true,
+		},
+		{
+			name:    "runtime default with path",
+			value:   "RuntimeDefault=profiles/k8tz.json",
+			wantErr: true,
+		},
+		{
+			name:    "unknown profile",
+			value:   "runtimedefault",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p SeccompProfile
+			if err := p.Set(tt.value); (err != nil) != tt.wantErr {
+				t.Fatalf("SeccompProfile.Set() error = %v, wantErr %v", err, tt.wantErr)
+			} else if tt.wantErr {
+				return
+			}
+
+			g := NewPatchGenerator()
+			g.InitContainerSecurityContext.SeccompProfile = p
+			if got := g.bootstrapSecurityContext().SeccompProfile; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bootstrapSecurityContext() seccompProfile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceList_Set(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "requests",
+			value: "memory=16Mi, cpu=10m",
+			want:  "cpu=10m,memory=16Mi",
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  "",
+		},
+		{
+			name:    "missing quantity",
+			value:   "cpu",
+			wantErr: true,
+		},
+		{
+			name:    "invalid quantity",
+			value:   "cpu=ten",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r ResourceList
+			if err := r.Set(tt.value); (err != nil) != tt.wantErr {
+				t.Fatalf("ResourceList.Set() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && r.String() != tt.want {
+				t.Errorf("ResourceList.String() = %v, want %v", r.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_createImagePullSecretPatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  []string
+		existing []corev1.LocalObjectReference
+		want     k8tz.Patches
+	}{
+		{
+			name:    "no secrets",
+			secrets: []string{},
+			want:    k8tz.Patches{},
+		},
+		{
+			name:    "pod without secrets",
+			secrets: []string{"registry", "registry"},
+			want: k8tz.Patches{
+				{Op: "add", Path: "/spec/imagePullSecrets", Value: []corev1.LocalObjectReference{{Name: "registry"}}},
+			},
+		},
+		{
+			name:     "pod with secrets",
+			secrets:  []string{"registry", "mirror"},
+			existing: []corev1.LocalObjectReference{{Name: "registry"}},
+			want: k8tz.Patches{
+				{Op: "add", Path: "/spec/imagePullSecrets/-", Value: corev1.LocalObjectReference{Name: "mirror"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.InitContainerImagePullSecrets = tt.secrets
+
+			spec := &corev1.PodSpec{ImagePullSecrets: tt.existing}
+			if got := g.createImagePullSecretPatches(spec, "/spec"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("createImagePullSecretPatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContainerTimezones(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "several containers",
+			value: "app=Asia/Jakarta, sidecar=UTC",
+			want:  map[string]string{"app": "Asia/Jakarta", "sidecar": "UTC"},
+		},
+		{
+			name:  "empty value",
+			value: "",
+			want:  map[string]string{},
+		},
+		{
+			name:    "missing timezone",
+			value:   "app=Asia/Jakarta,sidecar",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate container",
+			value:   "app=Asia/Jakarta,app=UTC",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseContainerTimezones(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseContainerTimezones() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseContainerTimezones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_RemoveInjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy InjectionStrategy
+		sidecar  bool
+	}{
+		{name: "hostPath", strategy: HostPathInjectionStrategy},
+		{name: "initContainer", strategy: InitContainerInjectionStrategy},
+		{name: "bootstrap sidecar", strategy: InitContainerInjectionStrategy, sidecar: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "migrate", Image: "busybox"}},
+					Containers: []corev1.Container{{
+						Name:         "app",
+						Image:        "busybox",
+						Env:          []corev1.EnvVar{{Name: "ZONEINFO", Value: "/custom"}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}},
+					}},
+					Volumes: []corev1.Volume{{Name: "data"}},
+				},
+			}
+			original := pod.DeepCopy()
+
+			g := NewPatchGenerator()
+			g.Strategy = tt.strategy
+			g.BootstrapSidecar = tt.sidecar
+			g.Timezone = "Asia/Tokyo"
+			g.ExtraEnv = ExtraEnv{InitContainerInjectionStrategy: {{Name: "ZONEINFO", Value: "/usr/share/zoneinfo"}}}
+
+			patches, err := g.Generate(pod, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			podJSON, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patchJSON, err := json.Marshal(patches)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patch, err := jsonpatch.DecodePatch(patchJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := patch.Apply(podJSON)
+			if err != nil {
+				t.Fatalf("failed to apply patches: %v", err)
+			}
+
+			var injected corev1.Pod
+			if err := json.Unmarshal(patched, &injected); err != nil {
+				t.Fatal(err)
+			}
+
+			g.RemoveInjection(&injected.Spec)
+			if !reflect.DeepEqual(injected.Spec, original.Spec) {
+				t.Errorf("RemoveInjection() = %+v, want %+v", injected.Spec, original.Spec)
+			}
+		})
+	}
+}
+
+func TestTzdataVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "version line", content: "# version 2023c\n# This zic input file is in the public domain.\n", want: "2023c"},
+		{name: "no version line", content: "R d 1916 o - Jun 14 23s 1 S\n", wantErr: true},
+		{name: "empty file", content: "", wantErr: true},
+		{name: "missing file", wantErr: true},
+		{name: "embedded tz database without zoneinfo", want: tzdata.Version()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.name == "embedded tz database without zoneinfo" {
+				dir += "/missing"
+			} else if tt.name != "missing file" {
+				if err := os.WriteFile(dir+"/tzdata.zi", []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := TzdataVersion(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TzdataVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("TzdataVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZones(t *testing.T) {
+	got, err := Zones("testdata/zoneinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"America/New_York", "Asia/Tokyo", "Europe/Berlin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Zones() = %v, want %v", got, want)
+	}
+
+	embedded, err := Zones("testdata/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embedded) < 400 || !sort.StringsAreSorted(embedded) {
+		t.Errorf("Zones() of the embedded tz database = %d timezones, want all of them sorted", len(embedded))
+	}
+
+	for _, zone := range embedded {
+		if err := ValidateTimezone("testdata/missing", zone); err != nil {
+			t.Errorf("ValidateTimezone(%s) of the embedded tz database: %v", zone, err)
+		}
+	}
+}
+
+func TestPatchGenerator_tzdataVersionAnnotation(t *testing.T) {
+	for _, strategy := range InjectionStrategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = strategy
+			g.TzdataVersion = "2023c"
+
+			patches, err := g.createPostInjectionAnnotations(&metav1.ObjectMeta{}, "/metadata")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			annotations := patches[0].Value.(map[string]string)
+			_, got := annotations[k8tz.TzdataVersionAnnotation]
+			if want := strategy != HostPathInjectionStrategy && strategy != WindowsInjectionStrategy && strategy != CSIInjectionStrategy; got != want {
+				t.Errorf("%s annotation recorded = %t, want %t", k8tz.TzdataVersionAnnotation, got, want)
+			}
+		})
+	}
+}
+
+func TestNextTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		after    time.Time
+		horizon  time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "end of daylight saving time",
+			timezone: "Europe/Berlin",
+			after:    time.Date(2023, 10, 1, 12, 30, 15, 500, time.UTC),
+			horizon:  60 * 24 * time.Hour,
+			want:     "Europe/Berlin changes from CEST (+02:00) to CET (+01:00) at 2023-10-29T01:00:00Z",
+		},
+		{
+			name:     "start of daylight saving time",
+			timezone: "America/New_York",
+			after:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			horizon:  365 * 24 * time.Hour,
+			want:     "America/New_York changes from EST (-05:00) to EDT (-04:00) at 2023-03-12T07:00:00Z",
+		},
+		{
+			name:     "transition after the horizon",
+			timezone: "Europe/Berlin",
+			after:    time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+			horizon:  7 * 24 * time.Hour,
+		},
+		{
+			name:     "timezone without daylight saving time",
+			timezone: "Asia/Tokyo",
+			after:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			horizon:  365 * 24 * time.Hour,
+		},
+		{
+			name:     "unknown timezone",
+			timezone: "Mars/Olympus_Mons",
+			wantErr:  true,
+		},
+		{
+			name:     "path traversal",
+			timezone: "../../../etc/passwd",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextTransition("testdata/zoneinfo", tt.timezone, tt.after, tt.horizon)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NextTransition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (got == nil) != (tt.want == "") {
+				t.Fatalf("NextTransition() = %v, want %q", got, tt.want)
+			}
+
+			if got != nil && got.String() != tt.want {
+				t.Errorf("NextTransition() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		offset   int
+		want     string
+		wantErr  bool
+	}{
+		{name: "east of utc", schedule: "0 2 * * *", offset: 7 * 3600, want: "0 19 * * *"},
+		{name: "west of utc", schedule: "30 22 * * *", offset: -5 * 3600, want: "30 3 * * *"},
+		{name: "macro", schedule: "@daily", offset: 2 * 3600, want: "0 22 * * *"},
+		{name: "offset with minutes", schedule: "15 9 * * *", offset: 5*3600 + 1800, want: "45 3 * * *"},
+		{name: "offset with minutes carry", schedule: "45 9 * * *", offset: 5*3600 + 1800, want: "15 4 * * *"},
+		{name: "list and range of hours", schedule: "0 8-10,23 * * *", offset: 3600, want: "0 7,8,9,22 * * *"},
+		{name: "every hour", schedule: "*/15 * * * *", offset: 3 * 3600, want: "*/15 * * * *"},
+		{name: "every hour with offset with minutes", schedule: "@hourly", offset: 5*3600 + 1800, want: "30 * * * *"},
+		{name: "every hour of a day of week", schedule: "0 * * * 1", offset: 2 * 3600, wantErr: true},
+		{name: "every hour of a day of week west of utc", schedule: "0 * * * 1", offset: -5 * 3600, wantErr: true},
+		{name: "every hour of a day of month", schedule: "*/30 * 1 * *", offset: 3600, wantErr: true},
+		{name: "every hour of a month", schedule: "0 * * 1 *", offset: -3600, wantErr: true},
+		{name: "every hour of a day of week with minute offset", schedule: "0 * * * 1", offset: 1800, wantErr: true},
+		{name: "every hour of a day of week in utc", schedule: "0 * * * 1", offset: 0, want: "0 * * * 1"},
+		{name: "utc", schedule: "0 2 1 * *", offset: 0, want: "0 2 1 * *"},
+		{name: "day of week to previous day", schedule: "0 2 * * 1", offset: 7 * 3600, want: "0 19 * * 0"},
+		{name: "day of week names to next day", schedule: "0 22 * * FRI-SAT", offset: -5 * 3600, want: "0 3 * * 0,6"},
+		{name: "day of month without day shift", schedule: "0 12 1 * *", offset: 2 * 3600, want: "0 10 1 * *"},
+		{name: "day of month with day shift", schedule: "0 2 1 * *", offset: 7 * 3600, wantErr: true},
+		{name: "hours shifted to different days", schedule: "0 2,12 * * 1", offset: 7 * 3600, wantErr: true},
+		{name: "minutes shifted to different hours", schedule: "0,45 9 * * *", offset: 5*3600 + 1800, wantErr: true},
+		{name: "invalid hour", schedule: "0 24 * * *", offset: 3600, wantErr: true},
+		{name: "missing fields", schedule: "0 2 * *", offset: 3600, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ShiftSchedule(tt.schedule, tt.offset)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShiftSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("ShiftSchedule() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_UTCSchedule(t *testing.T) {
+	g := &PatchGenerator{
+		Timezone:     "Europe/Berlin",
+		ZoneInfoPath: "testdata/zoneinfo",
+	}
+
+	for now, want := range map[time.Time]string{
+		time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC):  "0 0 * * *",
+		time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC): "0 1 * * *",
+	} {
+		now := now
+		g.now = func() time.Time { return now }
+
+		got, err := g.UTCSchedule("0 2 * * *")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("UTCSchedule() at %s = %q, want %q", now, got, want)
+		}
+	}
+}
+
+func TestValidateFaketime(t *testing.T) {
+	for faketime, valid := range map[string]bool{
+		"2024-03-31 01:59:00":       true,
+		"@2024-03-31 01:59:00":      true,
+		"@2024-03-31 01:59:00 x10":  true,
+		"+2d":                       true,
+		"-90m":                      true,
+		"+1.5h x0.5":                true,
+		"":                          false,
+		"tomorrow":                  false,
+		"2024-03-31":                false,
+		"+2d; rm -rf /":             false,
+		"@2024-03-31 01:59:00 x":    false,
+		"2024-03-31T01:59:00Z":      false,
+		"@2024-03-31 01:59:00\nx10": false,
+	} {
+		if err := ValidateFaketime(faketime); (err == nil) != valid {
+			t.Errorf("ValidateFaketime(%q) error = %v, valid %v", faketime, err, valid)
+		}
+	}
+}
+
+func TestPatchGenerator_faketimeStrategy(t *testing.T) {
+	tests := []struct {
+		name      string
+		faketime  string
+		library   string
+		container corev1.Container
+		want      []string
+		wantErr   bool
+	}{
+		{
+			name:      "absolute time",
+			faketime:  "@2024-03-31 01:59:00",
+			container: corev1.Container{Name: "app"},
+			want: []string{
+				"add /containers/0/volumeMounts",
+				"add /containers/0/volumeMounts/- k8tz:/etc/localtime",
+				"add /containers/0/volumeMounts/- k8tz:/usr/share/zoneinfo",
+				"add /containers/0/env",
+				"add /containers/0/env/- TZ=Europe/London",
+				"add /containers/0/env/- LD_PRELOAD=" + DefaultFaketimeLibrary,
+				"add /containers/0/env/- FAKETIME=@2024-03-31 01:59:00",
+			},
+		},
+		{
+			name:     "existing LD_PRELOAD is kept",
+			faketime: "+2d",
+			library:  "/opt/faketime/libfaketime.so.1",
+			container: corev1.Container{
+				Name: "app",
+				Env:  []corev1.EnvVar{{Name: "LD_PRELOAD", Value: "/lib/libjemalloc.so"}},
+			},
+			want: []string{
+				"add /containers/0/volumeMounts",
+				"add /containers/0/volumeMounts/- k8tz:/etc/localtime",
+				"add /containers/0/volumeMounts/- k8tz:/usr/share/zoneinfo",
+				"add /containers/0/env/- TZ=Europe/London",
+				"add /containers/0/env/- FAKETIME=+2d",
+			},
+		},
+		{
+			name:      "missing fake time",
+			container: corev1.Container{Name: "app"},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid fake time",
+			faketime:  "tomorrow",
+			container: corev1.Container{Name: "app"},
+			wantErr:   true,
+		},
+		{
+			name:      "relative library",
+			faketime:  "+2d",
+			library:   "libfaketime.so.1",
+			container: corev1.Container{Name: "app"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewPatchGenerator()
+			g.Strategy = FaketimeInjectionStrategy
+			g.Timezone = "Europe/London"
+			g.Faketime = tt.faketime
+			if tt.library != "" {
+				g.FaketimeLibrary = tt.library
+			}
+
+			spec := &corev1.PodSpec{Containers: []corev1.Container{tt.container}}
+			patches, err := g.forPodSpec(spec, "", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forPodSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			initContainer := false
+			for _, p := range patches {
+				if p.Path == "/initContainers" {
+					initContainer = true
+				}
+
+				if !strings.HasPrefix(p.Path, "/containers/") {
+					continue
+				}
+
+				switch v := valueOf(p.Value).(type) {
+				case corev1.VolumeMount:
+					got = append(got, fmt.Sprintf("%s %s %s:%s", p.Op, p.Path, v.Name, v.MountPath))
+				case corev1.EnvVar:
+					got = append(got, fmt.Sprintf("%s %s %s=%s", p.Op, p.Path, v.Name, v.Value))
+				default:
+					got = append(got, p.Op+" "+p.Path)
+				}
+			}
+
+			if !initContainer {
+				t.Errorf("forPodSpec() did not add the bootstrap initContainer")
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("forPodSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	yamlconvert "sigs.k8s.io/yaml"
+)
+
+// ResourceListKind is the kind of the input and output of KRM functions, see
+// https://github.com/kubernetes-sigs/kustomize/blob/master/cmd/config/docs/api-conventions/functions-spec.md
+const ResourceListKind = "ResourceList"
+
+// resourceList is the input and output of a KRM function, the items are kept
+// raw so the fields that k8tz does not know are written back as they are
+type resourceList struct {
+	APIVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	Items          []json.RawMessage `json:"items"`
+	FunctionConfig json.RawMessage   `json:"functionConfig,omitempty"`
+}
+
+// functionConfig is the configuration of the function, either a ConfigMap
+// with the settings in data or any other object with the settings in spec
+type functionConfig struct {
+	Kind string                 `json:"kind"`
+	Data map[string]string      `json:"data,omitempty"`
+	Spec map[string]interface{} `json:"spec,omitempty"`
+}
+
+// KRMFunction injects the items of a ResourceList, so k8tz can run as a
+// kustomize transformer or a kpt function without a webhook
+type KRMFunction struct {
+	PatchGenerator PatchGenerator
+}
+
+// Run reads a ResourceList from the input, injects its items with the
+// generator configured by the functionConfig and writes the ResourceList to
+// the output. Items that cannot be injected are written as they are.
+func (f *KRMFunction) Run(in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return fmt.Errorf("failed to read resource list: %w", err)
+	}
+
+	data, err = yamlconvert.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse resource list: %w", err)
+	}
+
+	list := resourceList{}
+	if err = json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse resource list: %w", err)
+	}
+
+	if list.Kind != ResourceListKind {
+		return fmt.Errorf("unexpected input kind %q, want %s", list.Kind, ResourceListKind)
+	}
+
+	generator, err := f.PatchGenerator.withFunctionConfig(list.FunctionConfig)
+	if err != nil {
+		return err
+	}
+
+	for i, item := range list.Items {
+		injected, err := generator.injectManifest(item)
+		if err != nil {
+			return fmt.Errorf("failed to inject item %d: %w", i, err)
+		}
+
+		if injected != nil {
+			list.Items[i] = injected
+		}
+	}
+
+	data, err = json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	data, err = yamlconvert.JSONToYAML(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// withFunctionConfig returns a copy of the generator with the settings of the
+// function config applied
+func (g *PatchGenerator) withFunctionConfig(raw json.RawMessage) (*PatchGenerator, error) {
+	generator := *g
+	if len(raw) == 0 || string(raw) == "null" {
+		return &generator, nil
+	}
+
+	config := functionConfig{}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse function config: %w", err)
+	}
+
+	settings := config.Data
+	if config.Kind != "ConfigMap" {
+		settings = map[string]string{}
+		for k, v := range config.Spec {
+			settings[k] = fmt.Sprint(v)
+		}
+	}
+
+	// sorted so the first invalid setting is always the one reported
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := generator.applySetting(k, settings[k]); err != nil {
+			return nil, fmt.Errorf("invalid function config %s: %w", k, err)
+		}
+	}
+
+	return &generator, nil
+}
+
+// applySetting sets the generator field of a function config setting
+func (g *PatchGenerator) applySetting(key string, value string) (err error) {
+	switch key {
+	case "timezone":
+		g.Timezone = value
+	case "strategy":
+		g.Strategy = InjectionStrategy(value)
+	case "image":
+		g.InitContainerImage = value
+	case "imagePullPolicy":
+		g.InitContainerImagePullPolicy = corev1.PullPolicy(value)
+	case "timezoneFormat":
+		g.TimezoneFormat = TimezoneFormat(value)
+	case "hostPathPrefix":
+		g.HostPathPrefix = value
+	case "hostPathType":
+		g.HostPathType = corev1.HostPathType(value)
+	case "csiDriver":
+		g.CSIDriver = value
+	case "csiZoneInfoPath":
+		g.CSIZoneInfoPath = value
+	case "localTimePath":
+		g.LocalTimePath = value
+	case "cronJobMode":
+		g.CronJobMode = CronJobMode(value)
+	case "cronJobTimeZone":
+		g.CronJobTimeZone, err = strconv.ParseBool(value)
+	case "bootstrapSidecar":
+		g.BootstrapSidecar, err = strconv.ParseBool(value)
+	case "annotateOffset":
+		g.AnnotateOffset, err = strconv.ParseBool(value)
+	case "objectAnnotations":
+		g.ObjectAnnotations, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown setting")
+	}
+
+	return err
+}
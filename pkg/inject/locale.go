@@ -0,0 +1,77 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LocaleVariables are the environment variables that are set to the locale,
+// LC_ALL overrides the LC_* variables that the image may define
+var LocaleVariables = []string{"LANG", "LC_ALL"}
+
+// localePattern matches language[_territory][.codeset][@modifier]
+var localePattern = regexp.MustCompile(`^([a-z]{2,3})(_[A-Z]{2})?(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+
+// knownLocales are the language_territory pairs of the glibc SUPPORTED list
+// that the locale of the injected pods is validated against
+var knownLocales = func() map[string]bool {
+	locales := map[string]bool{}
+	for _, locale := range strings.Fields(`
+		af_ZA am_ET ar_AE ar_BH ar_DZ ar_EG ar_IQ ar_JO ar_KW ar_LB ar_LY ar_MA
+		ar_OM ar_QA ar_SA ar_SD ar_SY ar_TN ar_YE az_AZ be_BY bg_BG bn_BD bn_IN
+		bs_BA ca_AD ca_ES ca_FR ca_IT cs_CZ cy_GB da_DK de_AT de_BE de_CH de_DE
+		de_IT de_LI de_LU el_CY el_GR en_AG en_AU en_BW en_CA en_DK en_GB en_HK
+		en_IE en_IL en_IN en_NG en_NZ en_PH en_SC en_SG en_US en_ZA en_ZM en_ZW
+		eo es_AR es_BO es_CL es_CO es_CR es_CU es_DO es_EC es_ES es_GT es_HN
+		es_MX es_NI es_PA es_PE es_PR es_PY es_SV es_US es_UY es_VE et_EE eu_ES
+		fa_IR fi_FI fil_PH fo_FO fr_BE fr_CA fr_CH fr_FR fr_LU ga_IE gd_GB gl_ES
+		gu_IN he_IL hi_IN hr_HR hu_HU hy_AM id_ID is_IS it_CH it_IT ja_JP ka_GE
+		kk_KZ km_KH kn_IN ko_KR ky_KG lo_LA lt_LT lv_LV mk_MK ml_IN mn_MN mr_IN
+		ms_MY mt_MT my_MM nb_NO ne_NP nl_AW nl_BE nl_NL nn_NO pa_IN pa_PK pl_PL
+		ps_AF pt_BR pt_PT ro_RO ru_RU ru_UA si_LK sk_SK sl_SI sq_AL sr_ME sr_RS
+		sv_FI sv_SE sw_KE sw_TZ ta_IN ta_LK te_IN tg_TJ th_TH tk_TM tl_PH tr_CY
+		tr_TR uk_UA ur_IN ur_PK uz_UZ vi_VN yue_HK zh_CN zh_HK zh_SG zh_TW zu_ZA
+	`) {
+		locales[locale] = true
+	}
+
+	return locales
+}()
+
+// ValidateLocale checks that the locale is C, C.UTF-8, POSIX or a known
+// locale, e.g. "en_US.UTF-8". Only the language and territory are validated
+// against the known locales, the codeset and the modifier must be well formed.
+func ValidateLocale(locale string) error {
+	switch locale {
+	case "C", "POSIX", "C.UTF-8", "C.utf8":
+		return nil
+	}
+
+	match := localePattern.FindStringSubmatch(locale)
+	if match == nil {
+		return fmt.Errorf("invalid locale %q, expected language_TERRITORY.codeset, e.g. en_US.UTF-8", locale)
+	}
+
+	if !knownLocales[match[1]+match[2]] {
+		return fmt.Errorf("unknown locale %q", locale)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"time"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+)
+
+// offsetAnnotations returns the UTC offset and abbreviation of the timezone
+// at injection time. The values are a snapshot for display only, they are
+// not updated when daylight saving time starts or ends.
+func (g *PatchGenerator) offsetAnnotations() (map[string]string, error) {
+	location, err := LoadLocation(g.ZoneInfoPath, g.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+
+	t := now().In(location)
+	abbreviation, _ := t.Zone()
+
+	return map[string]string{
+		k8tz.OffsetAnnotation:       t.Format("-07:00"),
+		k8tz.AbbreviationAnnotation: abbreviation,
+	}, nil
+}
@@ -0,0 +1,564 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSecurityLevel is a level of the kubernetes Pod Security Standards
+type PodSecurityLevel string
+
+// PodSecurityAction is what k8tz does when the injected objects would violate
+// the Pod Security Standards level of the pod
+type PodSecurityAction string
+
+const (
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	PodSecurityBaseline   PodSecurityLevel = "baseline"
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+
+	// PodSecurityIgnore skips the pod security check
+	PodSecurityIgnore PodSecurityAction = "ignore"
+	// PodSecurityAdjust changes the securityContext of the injected
+	// containers when possible, and fails the injection otherwise
+	PodSecurityAdjust PodSecurityAction = "adjust"
+	// PodSecurityDeny fails the injection on any violation
+	PodSecurityDeny PodSecurityAction = "deny"
+
+	// bootstrapUser is the non-root user of the k8tz image
+	bootstrapUser int64 = 1000
+)
+
+// podSecurityViolation is a Pod Security Standards check that the pod fails,
+// container is the name of the container that fails it (empty for the pod
+// and its volumes) and fix is nil when it cannot be fixed by k8tz
+type podSecurityViolation struct {
+	message   string
+	container string
+	fix       func(c *corev1.Container)
+}
+
+// PodSecurityViolationError is returned when the injected objects violate the
+// Pod Security Standards level and cannot be adjusted
+type PodSecurityViolationError struct {
+	Level      PodSecurityLevel
+	Violations []string
+}
+
+func (e *PodSecurityViolationError) Error() string {
+	return fmt.Sprintf("k8tz injection would violate the %s pod security standard: %s", e.Level, strings.Join(e.Violations, ", "))
+}
+
+var (
+	// baselineCapabilities are the capabilities that the baseline level
+	// allows to add
+	baselineCapabilities = []corev1.Capability{"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT"}
+	// restrictedCapabilities are the capabilities that the restricted level
+	// allows to add
+	restrictedCapabilities = []corev1.Capability{"NET_BIND_SERVICE"}
+	// safeSysctls are the sysctls that the baseline level allows
+	safeSysctls = map[string]bool{
+		"kernel.shm_rmid_forced":              true,
+		"net.ipv4.ip_local_port_range":        true,
+		"net.ipv4.ip_unprivileged_port_start": true,
+		"net.ipv4.tcp_syncookies":             true,
+		"net.ipv4.ping_group_range":           true,
+	}
+	// seLinuxTypes are the SELinux types that the baseline level allows
+	seLinuxTypes = map[string]bool{"": true, "container_t": true, "container_init_t": true, "container_kvm_t": true}
+)
+
+// enforcePodSecurity evaluates the pod with the patches applied against the
+// checks of the PodSecurityLevel, the same checks as the pod security
+// admission. Only the violations that the patches add are reported, the api
+// server admits or rejects the rest of the pod on its own. The adjust action
+// fixes the securityContext of the containers injected by k8tz and evaluates
+// the pod again.
+func (g *PatchGenerator) enforcePodSecurity(spec *corev1.PodSpec, pathprefix string, patches k8tz.Patches) (k8tz.Patches, error) {
+	if g.PodSecurityAction == "" || g.PodSecurityAction == PodSecurityIgnore {
+		return patches, nil
+	}
+
+	if g.PodSecurityLevel != PodSecurityBaseline && g.PodSecurityLevel != PodSecurityRestricted {
+		return patches, nil
+	}
+
+	existing := map[string]bool{}
+	for _, violation := range checkPodSecurity(g.PodSecurityLevel, spec) {
+		existing[violation.message] = true
+	}
+
+	violations, err := g.addedPodSecurityViolations(spec, pathprefix, patches, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(violations) > 0 && g.PodSecurityAction == PodSecurityAdjust {
+		if patches = adjustInjectedContainers(patches, violations); patches != nil {
+			if violations, err = g.addedPodSecurityViolations(spec, pathprefix, patches, existing); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		messages := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			messages = append(messages, violation.message)
+		}
+
+		return nil, &PodSecurityViolationError{Level: g.PodSecurityLevel, Violations: messages}
+	}
+
+	return patches, nil
+}
+
+// addedPodSecurityViolations returns the violations of the pod with the
+// patches applied that are not in the existing violations
+func (g *PatchGenerator) addedPodSecurityViolations(spec *corev1.PodSpec, pathprefix string, patches k8tz.Patches, existing map[string]bool) ([]podSecurityViolation, error) {
+	mutated, err := applyPodSpecPatches(spec, pathprefix, patches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the patches to check the pod security: %w", err)
+	}
+
+	var violations []podSecurityViolation
+	for _, violation := range checkPodSecurity(g.PodSecurityLevel, mutated) {
+		if !existing[violation.message] {
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, nil
+}
+
+// adjustInjectedContainers returns the patches with the fixes of the
+// violations applied to the containers that k8tz injects, nil is returned if
+// a violation cannot be fixed
+func adjustInjectedContainers(patches k8tz.Patches, violations []podSecurityViolation) k8tz.Patches {
+	adjusted := make(k8tz.Patches, len(patches))
+	copy(adjusted, patches)
+
+	for _, violation := range violations {
+		if violation.fix == nil || violation.container == "" {
+			return nil
+		}
+
+		fixed := false
+		for i, p := range adjusted {
+			// the container is copied since fragments are shared between requests
+			switch v := valueOf(p.Value).(type) {
+			case corev1.Container:
+				if v.Name == violation.container {
+					c := v.DeepCopy()
+					violation.fix(c)
+					adjusted[i].Value = *c
+					fixed = true
+				}
+			case sidecarContainer:
+				if v.Name == violation.container {
+					v.Container = *v.Container.DeepCopy()
+					violation.fix(&v.Container)
+					adjusted[i].Value = v
+					fixed = true
+				}
+			}
+		}
+
+		if !fixed {
+			return nil
+		}
+	}
+
+	return adjusted
+}
+
+// applyPodSpecPatches returns a copy of the pod spec with the patches of the
+// pathprefix applied
+func applyPodSpecPatches(spec *corev1.PodSpec, pathprefix string, patches k8tz.Patches) (*corev1.PodSpec, error) {
+	var document interface{} = spec
+	segments := strings.Split(strings.TrimPrefix(pathprefix, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] != "" {
+			document = map[string]interface{}{segments[i]: document}
+		}
+	}
+
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	patchJSON, err := json.Marshal(patches)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	patchedJSON, err := patch.Apply(documentJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched interface{}
+	if err := json.Unmarshal(patchedJSON, &patched); err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		if segment == "" {
+			continue
+		}
+
+		object, ok := patched.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("patched object has no %s", pathprefix)
+		}
+		patched = object[segment]
+	}
+
+	specJSON, err := json.Marshal(patched)
+	if err != nil {
+		return nil, err
+	}
+
+	mutated := &corev1.PodSpec{}
+	if err := json.Unmarshal(specJSON, mutated); err != nil {
+		return nil, err
+	}
+
+	return mutated, nil
+}
+
+// checkPodSecurity returns the violations of the checks of the level by the
+// pod spec
+func checkPodSecurity(level PodSecurityLevel, spec *corev1.PodSpec) []podSecurityViolation {
+	podContext := spec.SecurityContext
+	if podContext == nil {
+		podContext = &corev1.PodSecurityContext{}
+	}
+
+	containers := podContainers(spec)
+	violations := checkBaseline(spec, podContext, containers)
+	if level == PodSecurityRestricted {
+		violations = append(violations, checkRestricted(spec, podContext, containers)...)
+	}
+
+	return violations
+}
+
+// podContainers returns the init, regular and ephemeral containers of the
+// pod, the ephemeral containers only have the fields that are checked
+func podContainers(spec *corev1.PodSpec) []corev1.Container {
+	containers := make([]corev1.Container, 0, len(spec.InitContainers)+len(spec.Containers)+len(spec.EphemeralContainers))
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, c := range spec.EphemeralContainers {
+		containers = append(containers, corev1.Container{
+			Name:            c.Name,
+			Ports:           c.Ports,
+			SecurityContext: c.SecurityContext,
+		})
+	}
+
+	return containers
+}
+
+// checkBaseline returns the violations of the baseline level
+func checkBaseline(spec *corev1.PodSpec, podContext *corev1.PodSecurityContext, containers []corev1.Container) []podSecurityViolation {
+	var violations []podSecurityViolation
+	pod := func(format string, args ...interface{}) {
+		violations = append(violations, podSecurityViolation{message: fmt.Sprintf(format, args...)})
+	}
+
+	container := func(c *corev1.Container, fix func(c *corev1.Container), format string, args ...interface{}) {
+		violations = append(violations, podSecurityViolation{
+			message:   fmt.Sprintf("container '%s' %s", c.Name, fmt.Sprintf(format, args...)),
+			container: c.Name,
+			fix:       fix,
+		})
+	}
+
+	if spec.HostNetwork {
+		pod("pod must not set hostNetwork=true")
+	}
+	if spec.HostPID {
+		pod("pod must not set hostPID=true")
+	}
+	if spec.HostIPC {
+		pod("pod must not set hostIPC=true")
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != nil {
+			pod("hostPath volume '%s' is forbidden, use the %s strategy", volume.Name, InitContainerInjectionStrategy)
+		}
+	}
+
+	for _, sysctl := range podContext.Sysctls {
+		if !safeSysctls[sysctl.Name] {
+			pod("pod must not set the sysctl %s", sysctl.Name)
+		}
+	}
+
+	if podContext.SeccompProfile != nil && podContext.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		pod("pod must not set securityContext.seccompProfile.type=Unconfined")
+	}
+
+	if options := podContext.SELinuxOptions; options != nil && !allowedSELinuxOptions(options) {
+		pod("pod must not set securityContext.seLinuxOptions other than the container types")
+	}
+
+	if options := podContext.WindowsOptions; options != nil && options.HostProcess != nil && *options.HostProcess {
+		pod("pod must not set securityContext.windowsOptions.hostProcess=true")
+	}
+
+	for i := range containers {
+		c := &containers[i]
+		for _, port := range c.Ports {
+			if port.HostPort != 0 {
+				container(c, nil, "must not set hostPort %d", port.HostPort)
+			}
+		}
+
+		context := c.SecurityContext
+		if context == nil {
+			continue
+		}
+
+		if context.Privileged != nil && *context.Privileged {
+			container(c, setPrivileged, "must not set securityContext.privileged=true")
+		}
+
+		if context.Capabilities != nil {
+			if added := disallowedCapabilities(context.Capabilities.Add, baselineCapabilities); len(added) > 0 {
+				container(c, removeCapabilities(baselineCapabilities), "must not add the capabilities %v", added)
+			}
+		}
+
+		if context.ProcMount != nil && *context.ProcMount != corev1.DefaultProcMount {
+			container(c, nil, "must not set securityContext.procMount=%s", *context.ProcMount)
+		}
+
+		if context.SeccompProfile != nil && context.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			container(c, setSeccompProfile, "must not set securityContext.seccompProfile.type=Unconfined")
+		}
+
+		if options := context.SELinuxOptions; options != nil && !allowedSELinuxOptions(options) {
+			container(c, nil, "must not set securityContext.seLinuxOptions other than the container types")
+		}
+
+		if options := context.WindowsOptions; options != nil && options.HostProcess != nil && *options.HostProcess {
+			container(c, nil, "must not set securityContext.windowsOptions.hostProcess=true")
+		}
+	}
+
+	return violations
+}
+
+// checkRestricted returns the violations of the restricted level, in addition
+// to the ones of the baseline level
+func checkRestricted(spec *corev1.PodSpec, podContext *corev1.PodSecurityContext, containers []corev1.Container) []podSecurityViolation {
+	var violations []podSecurityViolation
+	pod := func(format string, args ...interface{}) {
+		violations = append(violations, podSecurityViolation{message: fmt.Sprintf(format, args...)})
+	}
+
+	container := func(c *corev1.Container, fix func(c *corev1.Container), format string, args ...interface{}) {
+		violations = append(violations, podSecurityViolation{
+			message:   fmt.Sprintf("container '%s' %s", c.Name, fmt.Sprintf(format, args...)),
+			container: c.Name,
+			fix:       fix,
+		})
+	}
+
+	for _, volume := range spec.Volumes {
+		// hostPath volumes are already forbidden by the baseline level
+		if volume.HostPath == nil && !restrictedVolume(&volume) {
+			pod("volume '%s' must be of a type allowed by the restricted level (configMap, csi, downwardAPI, emptyDir, ephemeral, persistentVolumeClaim, projected or secret)", volume.Name)
+		}
+	}
+
+	if podContext.RunAsNonRoot != nil && !*podContext.RunAsNonRoot {
+		pod("pod must not set securityContext.runAsNonRoot=false")
+	}
+
+	if podContext.RunAsUser != nil && *podContext.RunAsUser == 0 {
+		pod("pod must not set securityContext.runAsUser=0")
+	}
+
+	podNonRoot := podContext.RunAsNonRoot != nil && *podContext.RunAsNonRoot
+	podSeccomp := podContext.SeccompProfile != nil && restrictedSeccompProfile(podContext.SeccompProfile)
+
+	// the pod security admission exempts windows pods from the linux only
+	// checks
+	linux := spec.OS == nil || spec.OS.Name != corev1.Windows
+
+	for i := range containers {
+		c := &containers[i]
+		context := c.SecurityContext
+		if context == nil {
+			context = &corev1.SecurityContext{}
+		}
+
+		if context.RunAsNonRoot != nil && !*context.RunAsNonRoot {
+			container(c, setRunAsNonRoot, "must not set securityContext.runAsNonRoot=false")
+		} else if context.RunAsNonRoot == nil && !podNonRoot {
+			container(c, setRunAsNonRoot, "must set securityContext.runAsNonRoot=true")
+		}
+
+		if context.RunAsUser != nil && *context.RunAsUser == 0 {
+			container(c, setRunAsUser, "must not set securityContext.runAsUser=0")
+		}
+
+		if !linux {
+			continue
+		}
+
+		if context.AllowPrivilegeEscalation == nil || *context.AllowPrivilegeEscalation {
+			container(c, disallowPrivilegeEscalation, "must set securityContext.allowPrivilegeEscalation=false")
+		}
+
+		if context.Capabilities == nil || !containsCapability(context.Capabilities.Drop, "ALL") {
+			container(c, dropAllCapabilities, "must set securityContext.capabilities.drop=[\"ALL\"]")
+		}
+
+		if context.Capabilities != nil {
+			if added := disallowedCapabilities(context.Capabilities.Add, restrictedCapabilities); len(added) > 0 {
+				container(c, removeCapabilities(restrictedCapabilities), "must not add the capabilities %v", added)
+			}
+		}
+
+		if context.SeccompProfile != nil {
+			if !restrictedSeccompProfile(context.SeccompProfile) && context.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+				container(c, setSeccompProfile, "must set securityContext.seccompProfile.type to RuntimeDefault or Localhost")
+			}
+		} else if !podSeccomp {
+			container(c, setSeccompProfile, "must set securityContext.seccompProfile.type to RuntimeDefault or Localhost")
+		}
+	}
+
+	return violations
+}
+
+// securityContext returns the securityContext of the container, it is added
+// if missing
+func securityContext(c *corev1.Container) *corev1.SecurityContext {
+	if c.SecurityContext == nil {
+		c.SecurityContext = &corev1.SecurityContext{}
+	}
+
+	return c.SecurityContext
+}
+
+func setPrivileged(c *corev1.Container) {
+	securityContext(c).Privileged = &False
+}
+
+func setRunAsNonRoot(c *corev1.Container) {
+	securityContext(c).RunAsNonRoot = &True
+}
+
+func setRunAsUser(c *corev1.Container) {
+	user := bootstrapUser
+	securityContext(c).RunAsUser = &user
+}
+
+func disallowPrivilegeEscalation(c *corev1.Container) {
+	securityContext(c).AllowPrivilegeEscalation = &False
+}
+
+func setSeccompProfile(c *corev1.Container) {
+	securityContext(c).SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+}
+
+func dropAllCapabilities(c *corev1.Container) {
+	context := securityContext(c)
+	if context.Capabilities == nil {
+		context.Capabilities = &corev1.Capabilities{}
+	}
+
+	context.Capabilities.Drop = append(context.Capabilities.Drop, "ALL")
+}
+
+// removeCapabilities returns a fix that removes the added capabilities that
+// are not allowed
+func removeCapabilities(allowed []corev1.Capability) func(c *corev1.Container) {
+	return func(c *corev1.Container) {
+		capabilities := securityContext(c).Capabilities
+		add := capabilities.Add[:0:0]
+		for _, capability := range capabilities.Add {
+			if containsCapability(allowed, capability) {
+				add = append(add, capability)
+			}
+		}
+
+		capabilities.Add = add
+	}
+}
+
+// disallowedCapabilities returns the capabilities that are not allowed
+func disallowedCapabilities(capabilities []corev1.Capability, allowed []corev1.Capability) []corev1.Capability {
+	var disallowed []corev1.Capability
+	for _, capability := range capabilities {
+		if !containsCapability(allowed, capability) {
+			disallowed = append(disallowed, capability)
+		}
+	}
+
+	return disallowed
+}
+
+// allowedSELinuxOptions returns true if the options only set one of the
+// container types
+func allowedSELinuxOptions(options *corev1.SELinuxOptions) bool {
+	return seLinuxTypes[options.Type] && options.User == "" && options.Role == ""
+}
+
+// restrictedSeccompProfile returns true if the profile is RuntimeDefault or
+// Localhost
+func restrictedSeccompProfile(profile *corev1.SeccompProfile) bool {
+	return profile.Type == corev1.SeccompProfileTypeRuntimeDefault || profile.Type == corev1.SeccompProfileTypeLocalhost
+}
+
+// restrictedVolume returns true if the type of the volume is allowed by the
+// restricted level
+func restrictedVolume(volume *corev1.Volume) bool {
+	source := volume.VolumeSource
+	return source.ConfigMap != nil || source.CSI != nil || source.DownwardAPI != nil || source.EmptyDir != nil ||
+		source.Ephemeral != nil || source.PersistentVolumeClaim != nil || source.Projected != nil || source.Secret != nil
+}
+
+func containsCapability(capabilities []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
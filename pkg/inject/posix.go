@@ -0,0 +1,153 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TimezoneFormat is the format of the TZ environment variable value
+type TimezoneFormat string
+
+const (
+	// NameTimezoneFormat is the IANA name of the timezone, e.g. Europe/Berlin
+	NameTimezoneFormat TimezoneFormat = "name"
+	// PosixTimezoneFormat is the POSIX TZ rule of the timezone, e.g.
+	// CET-1CEST,M3.5.0,M10.5.0/3, some minimal libc implementations can only
+	// parse this format
+	PosixTimezoneFormat TimezoneFormat = "posix"
+
+	tzifHeaderLength = 44
+)
+
+// timezoneValue returns the value of the TZ environment variable of the
+// timezone according to the TimezoneFormat of the generator
+func (g *PatchGenerator) timezoneValue(timezone string) (string, error) {
+	switch g.TimezoneFormat {
+	case "", NameTimezoneFormat:
+		return timezone, nil
+	case PosixTimezoneFormat:
+		return PosixTZ(g.ZoneInfoPath, timezone)
+	default:
+		return "", fmt.Errorf("unknown timezone format specified: %s", g.TimezoneFormat)
+	}
+}
+
+// PosixTZ returns the POSIX TZ rule of the timezone, it is read from the footer
+// of the TZif (version 2 or above) file of the timezone in zoneinfo directory
+func PosixTZ(zoneinfo string, timezone string) (string, error) {
+	if timezone == "" || strings.Contains(timezone, "..") || filepath.IsAbs(timezone) {
+		return "", fmt.Errorf("invalid timezone name: %q", timezone)
+	}
+
+	data, err := readTZif(zoneinfo, timezone)
+	if err != nil {
+		return "", fmt.Errorf("failed to read TZif file of %s: %w", timezone, err)
+	}
+
+	footer, err := tzifFooter(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse TZif file of %s: %w", timezone, err)
+	}
+
+	if footer == "" {
+		return "", fmt.Errorf("TZif file of %s has no POSIX TZ rule", timezone)
+	}
+
+	return footer, nil
+}
+
+// ValidateTimezone returns an error if the timezone is not a TZif file of the
+// zoneinfo directory, i.e. not a known IANA timezone name
+func ValidateTimezone(zoneinfo string, timezone string) error {
+	if timezone == "" || strings.Contains(timezone, "..") || filepath.IsAbs(timezone) {
+		return fmt.Errorf("invalid timezone name: %q", timezone)
+	}
+
+	data, err := readTZif(zoneinfo, timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", timezone)
+	}
+
+	if _, err := tzifBlockLength(data, 4); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+
+	return nil
+}
+
+// tzifFooter skips the version 1 and version 2 data blocks of a TZif file
+// (RFC 8536) and returns the POSIX TZ string from the footer
+func tzifFooter(data []byte) (string, error) {
+	v1, err := tzifBlockLength(data, 4)
+	if err != nil {
+		return "", err
+	}
+
+	if data[4] < '2' {
+		return "", errors.New("TZif version 1 files have no footer")
+	}
+
+	data = data[v1:]
+	v2, err := tzifBlockLength(data, 8)
+	if err != nil {
+		return "", err
+	}
+
+	footer := data[v2:]
+	if len(footer) < 2 || footer[0] != '\n' {
+		return "", errors.New("missing footer")
+	}
+
+	end := bytes.IndexByte(footer[1:], '\n')
+	if end < 0 {
+		return "", errors.New("unterminated footer")
+	}
+
+	return string(footer[1 : end+1]), nil
+}
+
+// tzifBlockLength returns the length of the header and data block at the
+// beginning of data, timeSize is 4 for the version 1 block and 8 otherwise
+func tzifBlockLength(data []byte, timeSize int) (int, error) {
+	if len(data) < tzifHeaderLength || string(data[:4]) != "TZif" {
+		return 0, errors.New("not a TZif file")
+	}
+
+	count := func(i int) int {
+		return int(binary.BigEndian.Uint32(data[20+i*4:]))
+	}
+
+	isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt := count(0), count(1), count(2), count(3), count(4), count(5)
+	length := tzifHeaderLength +
+		timecnt*timeSize + timecnt +
+		typecnt*6 +
+		charcnt +
+		leapcnt*(timeSize+4) +
+		isstdcnt + isutcnt
+
+	if len(data) < length {
+		return 0, errors.New("truncated TZif file")
+	}
+
+	return length, nil
+}
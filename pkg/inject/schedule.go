@@ -0,0 +1,254 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleMacros are the predefined schedules of the CronJob controller
+var scheduleMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// weekdays are the names of the day of week field
+var weekdays = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+// UTCSchedule returns the cron schedule of a CronJob in the timezone of the
+// generator as a schedule in UTC, with the offset of the timezone at injection
+// time. It is used on clusters without spec.timeZone, where the schedules are
+// evaluated in the timezone of the controller manager (UTC); the rewritten
+// schedule is off by the change of the offset after a daylight saving time
+// transition.
+func (g *PatchGenerator) UTCSchedule(schedule string) (string, error) {
+	location, err := LoadLocation(g.ZoneInfoPath, g.Timezone)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+
+	_, offset := now().In(location).Zone()
+	return ShiftSchedule(schedule, offset)
+}
+
+// ShiftSchedule returns the cron schedule of a timezone with the offset in
+// seconds east of UTC as a schedule in UTC. Only schedules whose shifted times
+// can be expressed with the standard cron fields are supported: the days are
+// only shifted with a day of week field, the schedules of every hour (*) can
+// only be shifted if they run every day, and offsets with minutes (e.g.
+// +05:30) need the same hour for every minute of the schedule.
+func ShiftSchedule(schedule string, offset int) (string, error) {
+	expanded := strings.TrimSpace(schedule)
+	if macro, ok := scheduleMacros[expanded]; ok {
+		expanded = macro
+	}
+
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return "", fmt.Errorf("unsupported schedule %q, expected 5 fields", schedule)
+	}
+
+	if offset%60 != 0 {
+		return "", fmt.Errorf("unsupported offset of %d seconds", offset)
+	}
+
+	minuteField, hourField, domField, monthField, dowField := fields[0], fields[1], fields[2], fields[3], fields[4]
+	minutes, err := expandField(minuteField, 0, 59, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid minute field of schedule %q: %w", schedule, err)
+	}
+
+	hourOffset, minuteOffset := -offset/3600, -offset/60%60
+	carry := map[int]bool{}
+	if minuteOffset != 0 {
+		for i, m := range minutes {
+			shifted := m + minuteOffset
+			c := floorDiv(shifted, 60)
+			carry[c] = true
+			minutes[i] = shifted - c*60
+		}
+
+		minuteField = joinValues(minutes)
+	}
+
+	everyDay := domField == "*" && monthField == "*" && dowField == "*"
+	if hourField == "*" {
+		// every hour is shifted to another hour of the schedule, but on
+		// restricted days the first or last hours are shifted to the previous
+		// or next day, e.g. 0 * * * 1 at +02:00 runs from 22:00 on Sunday to
+		// 21:00 on Monday in UTC, which a single schedule cannot express
+		if offset != 0 && !everyDay {
+			return "", fmt.Errorf("unsupported schedule %q, every hour of restricted days is shifted to two different days", schedule)
+		}
+
+		return strings.Join([]string{minuteField, hourField, domField, monthField, dowField}, " "), nil
+	}
+
+	if len(carry) > 1 {
+		return "", fmt.Errorf("unsupported schedule %q, the minutes are shifted to different hours", schedule)
+	}
+
+	for c := range carry {
+		hourOffset += c
+	}
+
+	if hourOffset == 0 {
+		return strings.Join([]string{minuteField, hourField, domField, monthField, dowField}, " "), nil
+	}
+
+	hours, err := expandField(hourField, 0, 23, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid hour field of schedule %q: %w", schedule, err)
+	}
+
+	days := map[int]bool{}
+	for i, h := range hours {
+		shifted := h + hourOffset
+		d := floorDiv(shifted, 24)
+		days[d] = true
+		hours[i] = shifted - d*24
+	}
+
+	dayOffset := 0
+	for d := range days {
+		dayOffset = d
+	}
+
+	switch {
+	case everyDay || (len(days) == 1 && dayOffset == 0):
+	case len(days) > 1:
+		return "", fmt.Errorf("unsupported schedule %q, the hours are shifted to different days", schedule)
+	case domField != "*" || monthField != "*":
+		return "", fmt.Errorf("unsupported schedule %q, the day of month and month cannot be shifted to the previous or next day", schedule)
+	default:
+		dows, err := expandField(dowField, 0, 7, weekdays)
+		if err != nil {
+			return "", fmt.Errorf("invalid day of week field of schedule %q: %w", schedule, err)
+		}
+
+		for i, d := range dows {
+			dows[i] = ((d+dayOffset)%7 + 7) % 7
+		}
+
+		dowField = joinValues(dows)
+	}
+
+	return strings.Join([]string{minuteField, joinValues(hours), domField, monthField, dowField}, " "), nil
+}
+
+// expandField returns the values of a cron field, e.g. "1-10/3,20" is 1, 4,
+// 7, 10 and 20. The names are the alternative names of the values.
+func expandField(field string, min int, max int, names map[string]int) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(field, ",") {
+		expression, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step %q", part)
+			}
+
+			expression, step = part[:i], s
+		}
+
+		first, last := min, max
+		switch {
+		case expression == "*":
+		case strings.Contains(expression, "-"):
+			from, to, _ := strings.Cut(expression, "-")
+			var err error
+			if first, err = fieldValue(from, min, max, names); err != nil {
+				return nil, err
+			}
+
+			if last, err = fieldValue(to, min, max, names); err != nil {
+				return nil, err
+			}
+
+			if first > last {
+				return nil, fmt.Errorf("invalid range %q", expression)
+			}
+		default:
+			value, err := fieldValue(expression, min, max, names)
+			if err != nil {
+				return nil, err
+			}
+
+			first = value
+			if step == 1 {
+				last = value
+			}
+		}
+
+		for v := first; v <= last; v += step {
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
+
+// fieldValue parses a single value of a cron field
+func fieldValue(value string, min int, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", value, min, max)
+	}
+
+	return v, nil
+}
+
+// joinValues formats the values as a sorted cron list without duplicates
+func joinValues(values []int) string {
+	sort.Ints(values)
+
+	parts := make([]string, 0, len(values))
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			parts = append(parts, strconv.Itoa(v))
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// floorDiv divides rounding towards negative infinity
+func floorDiv(a int, b int) int {
+	if a < 0 && a%b != 0 {
+		return a/b - 1
+	}
+
+	return a / b
+}
@@ -0,0 +1,150 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Strategy makes the TZif files available to the containers of a pod. Patch
+// returns the patches of the pod spec at pathprefix, e.g. volumes, volume
+// mounts and init containers, the environment variables and the annotations
+// are added by the PatchGenerator for all the strategies. Patches that mount
+// a volume must also add it, or the pod must already have it.
+type Strategy interface {
+	Patch(spec *corev1.PodSpec, config *PatchGenerator, pathprefix string) (k8tz.Patches, error)
+}
+
+// StrategyFunc is a Strategy implemented by a function
+type StrategyFunc func(spec *corev1.PodSpec, config *PatchGenerator, pathprefix string) (k8tz.Patches, error)
+
+// Patch calls f(spec, config, pathprefix)
+func (f StrategyFunc) Patch(spec *corev1.PodSpec, config *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	return f(spec, config, pathprefix)
+}
+
+var (
+	strategiesLock sync.RWMutex
+	strategies     = map[InjectionStrategy]Strategy{
+		InitContainerInjectionStrategy: StrategyFunc(bootstrapStrategy),
+		HostPathInjectionStrategy:      StrategyFunc(hostPathStrategy),
+		SidecarInjectionStrategy:       StrategyFunc(bootstrapStrategy),
+		TzdataInjectionStrategy:        StrategyFunc(bootstrapStrategy),
+		WindowsInjectionStrategy:       StrategyFunc(windowsStrategy),
+		CSIInjectionStrategy:           StrategyFunc(csiStrategy),
+		ImageVolumeInjectionStrategy:   StrategyFunc(imageStrategy),
+		FaketimeInjectionStrategy:      StrategyFunc(faketimeStrategy),
+	}
+)
+
+// RegisterStrategy adds a custom injection strategy, so it can be selected
+// like the built-in strategies with the k8tz.io/strategy annotation or the
+// --injection-strategy flag. It is usually called from an init function of
+// the package that implements the strategy. The built-in strategies cannot
+// be replaced.
+func RegisterStrategy(name InjectionStrategy, strategy Strategy) error {
+	if name == "" {
+		return errors.New("injection strategy name is empty")
+	}
+
+	if strategy == nil {
+		return fmt.Errorf("injection strategy %s is nil", name)
+	}
+
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+
+	if _, ok := strategies[name]; ok {
+		return fmt.Errorf("injection strategy %s is already registered", name)
+	}
+
+	strategies[name] = strategy
+	return nil
+}
+
+// LookupStrategy returns the registered injection strategy with the name
+func LookupStrategy(name InjectionStrategy) (Strategy, bool) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+
+	strategy, ok := strategies[name]
+	return strategy, ok
+}
+
+// RegisteredStrategies returns the built-in injection strategies followed by
+// the custom strategies sorted by name
+func RegisteredStrategies() []InjectionStrategy {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+
+	var custom []InjectionStrategy
+	for name := range strategies {
+		if !isBuiltinStrategy(name) {
+			custom = append(custom, name)
+		}
+	}
+
+	sort.Slice(custom, func(i, j int) bool {
+		return custom[i] < custom[j]
+	})
+
+	return append(append([]InjectionStrategy{}, InjectionStrategies...), custom...)
+}
+
+func isBuiltinStrategy(name InjectionStrategy) bool {
+	for _, builtin := range InjectionStrategies {
+		if name == builtin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bootstrapStrategy copies the TZif files to an emptyDir volume with the
+// bootstrap container, it is shared by the initContainer, sidecar and tzdata
+// strategies
+func bootstrapStrategy(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	if _, err := g.InitContainerSecurityContext.SeccompProfile.seccompProfile(); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateTzdir(g.tzdir()); err != nil {
+		return nil, err
+	}
+
+	return g.createInitContainerPatches(spec, pathprefix), nil
+}
+
+func hostPathStrategy(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	if err := ValidateHostPathType(g.HostPathType); err != nil {
+		return nil, err
+	}
+
+	return g.createHostPathPatches(spec, pathprefix), nil
+}
+
+// windowsStrategy mounts nothing, only the environment variables are injected
+func windowsStrategy(*corev1.PodSpec, *PatchGenerator, string) (k8tz.Patches, error) {
+	return nil, nil
+}
@@ -0,0 +1,317 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxFragments bounds the number of cached fragments, the keys include
+// values from the object annotations (e.g. the timezone) so the cache must
+// not grow with every distinct value that is sent to the webhook
+const maxFragments = 4096
+
+// fragment is a patch value that is built and marshaled once per
+// configuration, and shared by the patches of all the requests that use the
+// same configuration. Marshaling the kubernetes types on every request is the
+// most expensive part of the patch generation.
+type fragment struct {
+	value interface{}
+	raw   json.RawMessage
+}
+
+func (f fragment) MarshalJSON() ([]byte, error) {
+	return f.raw, nil
+}
+
+// fragments holds the fragments by their key, the key is a comparable struct
+// with every parameter that the value is built from
+var (
+	fragments     sync.Map
+	fragmentCount int32
+)
+
+type volumeKey struct {
+	emptyDir        bool
+	hostPath        string
+	hostPathType    corev1.HostPathType
+	csiDriver       string
+	csiAttributes   string
+	image           string
+	imagePullPolicy corev1.PullPolicy
+}
+
+type volumeMountKey struct {
+	mountPath string
+	subPath   string
+}
+
+type envKey struct {
+	name  string
+	value string
+}
+
+type bootstrapKey struct {
+	image      string
+	pullPolicy corev1.PullPolicy
+	sidecar    bool
+	security   BootstrapSecurityContext
+	requests   string
+	limits     string
+}
+
+// cachedFragment returns the fragment of the key, build is called only for
+// keys that are not cached yet. The value is returned as is if it cannot be
+// marshaled or the cache is full.
+func cachedFragment(key interface{}, build func() interface{}) interface{} {
+	if f, ok := fragments.Load(key); ok {
+		return f
+	}
+
+	value := build()
+	raw, err := json.Marshal(value)
+	if err != nil || atomic.LoadInt32(&fragmentCount) >= maxFragments {
+		return value
+	}
+
+	f, loaded := fragments.LoadOrStore(key, fragment{value: value, raw: raw})
+	if !loaded {
+		atomic.AddInt32(&fragmentCount, 1)
+	}
+
+	return f
+}
+
+// valueOf returns the value of a patch, the values of fragments must not be
+// modified since they are shared between requests
+func valueOf(value interface{}) interface{} {
+	if f, ok := value.(fragment); ok {
+		return f.value
+	}
+
+	return value
+}
+
+// emptyDirVolumeFragment returns the emptyDir k8tz volume of the bootstrap
+// container strategies
+func emptyDirVolumeFragment() interface{} {
+	return cachedFragment(volumeKey{emptyDir: true}, func() interface{} {
+		return corev1.Volume{
+			Name: VolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		}
+	})
+}
+
+// hostPathVolumeFragment returns the k8tz volume of the hostPath strategy
+func hostPathVolumeFragment(hostPath string, hostPathType corev1.HostPathType) interface{} {
+	return cachedFragment(volumeKey{hostPath: hostPath, hostPathType: hostPathType}, func() interface{} {
+		volume := corev1.Volume{
+			Name: VolumeName,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: hostPath,
+				},
+			},
+		}
+
+		if hostPathType != corev1.HostPathUnset {
+			volume.HostPath.Type = &hostPathType
+		}
+
+		return volume
+	})
+}
+
+// csiVolumeFragment returns the k8tz volume of the csi strategy, the volume is
+// read only since the TZif files are only read
+func csiVolumeFragment(driver string, attributes map[string]string) interface{} {
+	keys := make([]string, 0, len(attributes))
+	for k, v := range attributes {
+		keys = append(keys, k+"="+v)
+	}
+
+	sort.Strings(keys)
+	return cachedFragment(volumeKey{csiDriver: driver, csiAttributes: strings.Join(keys, ",")}, func() interface{} {
+		volume := corev1.Volume{
+			Name: VolumeName,
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{
+					Driver:   driver,
+					ReadOnly: &True,
+				},
+			},
+		}
+
+		if len(attributes) > 0 {
+			volume.CSI.VolumeAttributes = attributes
+		}
+
+		return volume
+	})
+}
+
+// imageVolumeFragment returns the k8tz volume of the image strategy
+func imageVolumeFragment(image string, pullPolicy corev1.PullPolicy) interface{} {
+	return cachedFragment(volumeKey{image: image, imagePullPolicy: pullPolicy}, func() interface{} {
+		return imageVolume{
+			Name: VolumeName,
+			Image: imageVolumeSource{
+				Reference:  image,
+				PullPolicy: pullPolicy,
+			},
+		}
+	})
+}
+
+// volumeMountFragment returns a read only volumeMount of the k8tz volume
+func volumeMountFragment(mountPath, subPath string) interface{} {
+	return cachedFragment(volumeMountKey{mountPath: mountPath, subPath: subPath}, func() interface{} {
+		return corev1.VolumeMount{
+			Name:      VolumeName,
+			ReadOnly:  true,
+			MountPath: mountPath,
+			SubPath:   subPath,
+		}
+	})
+}
+
+// envFragment returns an environment variable with a plain value
+func envFragment(name, value string) interface{} {
+	return cachedFragment(envKey{name: name, value: value}, func() interface{} {
+		return corev1.EnvVar{
+			Name:  name,
+			Value: value,
+		}
+	})
+}
+
+// bootstrapFragment returns the bootstrap container of the image, as an
+// initContainer or as a native sidecar
+func (g *PatchGenerator) bootstrapFragment(image string) interface{} {
+	requests := ResourceList(g.InitContainerResources.Requests)
+	limits := ResourceList(g.InitContainerResources.Limits)
+	key := bootstrapKey{
+		image:      image,
+		pullPolicy: g.InitContainerImagePullPolicy,
+		sidecar:    g.BootstrapSidecar || g.Strategy == SidecarInjectionStrategy,
+		security:   g.InitContainerSecurityContext,
+		requests:   requests.String(),
+		limits:     limits.String(),
+	}
+
+	return cachedFragment(key, func() interface{} {
+		bootstrap := corev1.Container{
+			Name:            BootstrapContainerName,
+			Image:           image,
+			ImagePullPolicy: g.InitContainerImagePullPolicy,
+			Args:            []string{"bootstrap"},
+			Resources:       g.InitContainerResources,
+			SecurityContext: g.bootstrapSecurityContext(),
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      VolumeName,
+					MountPath: BootstrapMountPath,
+					ReadOnly:  false,
+				},
+			},
+		}
+
+		if key.sidecar {
+			return g.asBootstrapSidecar(bootstrap)
+		}
+
+		return bootstrap
+	})
+}
+
+// hasVolume returns true if the pod already has the volume, the fields that
+// are defaulted by the api server are not compared
+func hasVolume(spec *corev1.PodSpec, volume corev1.Volume) bool {
+	for _, v := range spec.Volumes {
+		if v.Name != volume.Name {
+			continue
+		}
+
+		switch {
+		case volume.EmptyDir != nil:
+			return v.EmptyDir != nil && v.EmptyDir.Medium == volume.EmptyDir.Medium && v.EmptyDir.SizeLimit == nil
+		case volume.HostPath != nil:
+			return v.HostPath != nil && v.HostPath.Path == volume.HostPath.Path
+		case volume.CSI != nil:
+			return v.CSI != nil && v.CSI.Driver == volume.CSI.Driver && sameAttributes(v.CSI.VolumeAttributes, volume.CSI.VolumeAttributes)
+		}
+	}
+
+	return false
+}
+
+// sameAttributes returns true if the volume attributes are equal, nil and
+// empty attributes are the same
+func sameAttributes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasVolumeMount returns true if the container already has the volumeMount
+func hasVolumeMount(container *corev1.Container, mount corev1.VolumeMount) bool {
+	for _, m := range container.VolumeMounts {
+		if m.Name == mount.Name && m.MountPath == mount.MountPath && m.SubPath == mount.SubPath && m.ReadOnly == mount.ReadOnly {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasInitContainer returns true if the pod already has the bootstrap
+// initContainer with the same image, args and volumeMounts. Native sidecars
+// are never found since their restartPolicy is missing from the API types.
+func hasInitContainer(spec *corev1.PodSpec, container interface{}) bool {
+	bootstrap, ok := valueOf(container).(corev1.Container)
+	if !ok {
+		return false
+	}
+
+	for i := range spec.InitContainers {
+		c := &spec.InitContainers[i]
+		if c.Name == bootstrap.Name && c.Image == bootstrap.Image &&
+			reflect.DeepEqual(c.Args, bootstrap.Args) && reflect.DeepEqual(c.VolumeMounts, bootstrap.VolumeMounts) {
+			return true
+		}
+	}
+
+	return false
+}
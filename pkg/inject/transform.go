@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	appsv1 "k8s.io/api/apps/v1"
@@ -42,21 +46,88 @@ func ArgumentsToInputs(args []string) (Inputs, error) {
 			continue
 		}
 
-		file, err := os.Open(arg)
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			reader, err := openURL(arg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i, arg, err)
+			}
+
+			inputs = append(inputs, Input{
+				ArgNumber:  i,
+				Identifier: arg,
+				Reader:     reader,
+			})
+			continue
+		}
+
+		paths, err := manifestPaths(arg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i, arg, err)
 		}
 
-		input := Input{
-			ArgNumber:  i,
-			Identifier: arg,
-			Reader:     file,
+		for _, path := range paths {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open input(%d): %s, error: %w", i, path, err)
+			}
+
+			input := Input{
+				ArgNumber:  i,
+				Identifier: path,
+				Reader:     file,
+			}
+			inputs = append(inputs, input)
 		}
-		inputs = append(inputs, input)
 	}
 
 	return inputs, nil
 }
+
+// openURL returns the body of the manifests at the url
+func openURL(url string) (io.Reader, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", response.Status)
+	}
+
+	return response.Body, nil
+}
+
+// manifestPaths returns the path itself if it is a file, or the YAML and JSON
+// files of the directory in lexical order, subdirectories are not included
+func manifestPaths(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
 func (t *Transformer) Transform() error {
 	first := true
 	for _, v := range t.Inputs {
@@ -92,12 +163,12 @@ func (t *Transformer) transformInput(input Input) error {
 			return err
 		}
 
-		obj, err := parseTypeMetaSkeleton(bytes)
+		injectedJSON, err := t.PatchGenerator.injectManifest(bytes)
 		if err != nil {
 			return err
 		}
 
-		if obj == nil {
+		if injectedJSON == nil {
 			if !first {
 				_, err = t.Output.Write([]byte("---\n"))
 				if err != nil {
@@ -115,36 +186,6 @@ func (t *Transformer) transformInput(input Input) error {
 			continue
 		}
 
-		err = yaml.Unmarshal(bytes, obj)
-		if err != nil {
-			return err
-		}
-
-		patchObj, err := t.PatchGenerator.Generate(obj, "")
-		if err != nil {
-			return fmt.Errorf("failed to generate patch for kind: %T, error: %w", obj, err)
-		}
-
-		patchJSON, err := json.Marshal(patchObj)
-		if err != nil {
-			return err
-		}
-
-		patch, err := jsonpatch.DecodePatch(patchJSON)
-		if err != nil {
-			return err
-		}
-
-		origJSON, err := yamlconvert.YAMLToJSON(bytes)
-		if err != nil {
-			return err
-		}
-
-		injectedJSON, err := patch.Apply(origJSON)
-		if err != nil {
-			return err
-		}
-
 		injectedYAML, err := yamlconvert.JSONToYAML(injectedJSON)
 		if err != nil {
 			return err
@@ -168,6 +209,42 @@ func (t *Transformer) transformInput(input Input) error {
 	return nil
 }
 
+// injectManifest returns the JSON of the injected YAML or JSON manifest, nil
+// is returned if the kind of the manifest cannot be injected
+func (g *PatchGenerator) injectManifest(data []byte) ([]byte, error) {
+	obj, err := parseTypeMetaSkeleton(data)
+	if err != nil || obj == nil {
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	patchObj, err := g.Generate(obj, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate patch for kind: %T, error: %w", obj, err)
+	}
+
+	patchJSON, err := json.Marshal(patchObj)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.DecodePatch(patchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	origJSON, err := yamlconvert.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return patch.Apply(origJSON)
+}
+
 func parseTypeMetaSkeleton(data []byte) (interface{}, error) {
 	var metainfo metav1.TypeMeta
 	err := yaml.Unmarshal(data, &metainfo)
@@ -182,6 +259,12 @@ func parseTypeMetaSkeleton(data []byte) (interface{}, error) {
 		return &appsv1.StatefulSet{}, nil
 	case "Deployment":
 		return &appsv1.Deployment{}, nil
+	case "DaemonSet":
+		return &appsv1.DaemonSet{}, nil
+	case "ReplicaSet":
+		return &appsv1.ReplicaSet{}, nil
+	case "Job":
+		return &batchv1.Job{}, nil
 	case "Pod":
 		return &corev1.Pod{}, nil
 	case "List":
@@ -202,6 +202,23 @@ func TestTransformer_Transform(t *testing.T) {
 			golden:  "testdata/simple-cronjob-dublin.yaml",
 			wantErr: false,
 		},
+		{
+			name: "cronjob job template injection",
+			fields: fields{
+				PatchGenerator: PatchGenerator{
+					Strategy:           InitContainerInjectionStrategy,
+					Timezone:           "Europe/Dublin",
+					InitContainerImage: "testimage:0.0.0",
+					HostPathPrefix:     "/usr/share/zoneinfo",
+					LocalTimePath:      "/etc/localtime",
+					CronJobTimeZone:    true,
+					CronJobMode:        TemplateCronJobMode,
+				},
+				Inputs: []string{"testdata/simple-cronjob.yaml"},
+			},
+			golden:  "testdata/simple-cronjob-template-dublin.yaml",
+			wantErr: false,
+		},
 		{
 			name: "list of uninjected deployments",
 			fields: fields{
@@ -247,6 +264,36 @@ func TestTransformer_Transform(t *testing.T) {
 			golden:  "testdata/test-pod-volumeMounts-initContainer-result.yaml",
 			wantErr: false,
 		},
+		{
+			name: "object annotations are applied",
+			fields: fields{
+				PatchGenerator: PatchGenerator{
+					Strategy:           InitContainerInjectionStrategy,
+					Timezone:           "UTC",
+					InitContainerImage: "testimage:0.0.0",
+					HostPathPrefix:     "/usr/share/zoneinfo",
+					LocalTimePath:      "/etc/localtime",
+					ObjectAnnotations:  true,
+				},
+				Inputs: []string{"testdata/annotated-pods.yaml"},
+			},
+			golden:  "testdata/annotated-pods-injected.yaml",
+			wantErr: false,
+		},
+		{
+			name: "directory of manifests",
+			fields: fields{
+				PatchGenerator: PatchGenerator{
+					Strategy:       HostPathInjectionStrategy,
+					Timezone:       "Europe/Dublin",
+					HostPathPrefix: "/usr/share/zoneinfo",
+					LocalTimePath:  "/etc/localtime",
+				},
+				Inputs: []string{"testdata/manifests"},
+			},
+			golden:  "testdata/manifests-injected.yaml",
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -320,6 +367,30 @@ func Test_parseTypeMetaSkeleton(t *testing.T) {
 			want:    &appsv1.StatefulSet{},
 			wantErr: false,
 		},
+		{
+			name: "test valid DaemonSet type",
+			args: args{
+				object: metav1.TypeMeta{Kind: "DaemonSet"},
+			},
+			want:    &appsv1.DaemonSet{},
+			wantErr: false,
+		},
+		{
+			name: "test valid ReplicaSet type",
+			args: args{
+				object: metav1.TypeMeta{Kind: "ReplicaSet"},
+			},
+			want:    &appsv1.ReplicaSet{},
+			wantErr: false,
+		},
+		{
+			name: "test valid Job type",
+			args: args{
+				object: metav1.TypeMeta{Kind: "Job"},
+			},
+			want:    &batchv1.Job{},
+			wantErr: false,
+		},
 		{
 			name: "test valid CronJob type",
 			args: args{
@@ -437,3 +508,73 @@ func compareGolden(hyp string, goldenFile string) error {
 
 	return nil
 }
+
+func TestKRMFunction_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		golden  string
+		wantErr bool
+	}{
+		{
+			name:   "config map function config",
+			input:  "testdata/resource-list.yaml",
+			golden: "testdata/resource-list-injected.yaml",
+		},
+		{
+			name:   "spec function config",
+			input:  "testdata/resource-list-spec.yaml",
+			golden: "testdata/resource-list-spec-injected.yaml",
+		},
+		{
+			name:    "not a resource list",
+			input:   "testdata/simple-pod.yaml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.Open(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer input.Close()
+
+			f := &KRMFunction{PatchGenerator: NewPatchGenerator()}
+			var out bytes.Buffer
+			if err := f.Run(input, &out); (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.golden != "" {
+				if err := compareGolden(out.String(), tt.golden); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPatchGenerator_withFunctionConfig(t *testing.T) {
+	g := NewPatchGenerator()
+	if _, err := g.withFunctionConfig([]byte(`{"kind":"ConfigMap","data":{"timezone":"UTC","unknown":"value"}}`)); err == nil {
+		t.Error("withFunctionConfig() should fail for unknown settings")
+	}
+
+	if _, err := g.withFunctionConfig([]byte(`{"kind":"ConfigMap","data":{"cronJobTimeZone":"maybe"}}`)); err == nil {
+		t.Error("withFunctionConfig() should fail for invalid booleans")
+	}
+
+	got, err := g.withFunctionConfig([]byte(`{"kind":"Injection","spec":{"timezone":"Asia/Tokyo","cronJobTimeZone":true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Timezone != "Asia/Tokyo" || !got.CronJobTimeZone {
+		t.Errorf("withFunctionConfig() = %+v, want timezone Asia/Tokyo with cronJobTimeZone", got)
+	}
+
+	if g.Timezone == "Asia/Tokyo" {
+		t.Error("withFunctionConfig() should not change the generator")
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// transitionStep is the resolution of the search for offset changes, the
+// offset of a timezone never changes twice within it
+const transitionStep = 24 * time.Hour
+
+// Transition is a change of the UTC offset of a timezone, e.g. the start or
+// the end of daylight saving time
+type Transition struct {
+	Timezone           string
+	At                 time.Time
+	OffsetBefore       int
+	OffsetAfter        int
+	AbbreviationBefore string
+	AbbreviationAfter  string
+}
+
+// String describes the transition, e.g. "Europe/Berlin changes from CEST
+// (+02:00) to CET (+01:00) at 2023-10-29T01:00:00Z"
+func (t *Transition) String() string {
+	return fmt.Sprintf("%s changes from %s (%s) to %s (%s) at %s", t.Timezone,
+		t.AbbreviationBefore, formatOffset(t.OffsetBefore), t.AbbreviationAfter, formatOffset(t.OffsetAfter), t.At.UTC().Format(time.RFC3339))
+}
+
+// formatOffset formats the offset in seconds east of UTC, e.g. "+05:30"
+func formatOffset(offset int) string {
+	return time.Unix(0, 0).In(time.FixedZone("", offset)).Format("-07:00")
+}
+
+// LoadLocation loads the timezone from the TZif file in the zoneinfo
+// directory
+func LoadLocation(zoneinfo string, timezone string) (*time.Location, error) {
+	if strings.Contains(timezone, "..") || filepath.IsAbs(timezone) {
+		return nil, fmt.Errorf("invalid timezone name: %q", timezone)
+	}
+
+	data, err := readTZif(zoneinfo, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TZif file of %s: %w", timezone, err)
+	}
+
+	location, err := time.LoadLocationFromTZData(timezone, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone %s: %w", timezone, err)
+	}
+
+	return location, nil
+}
+
+// NextTransition returns the first change of the UTC offset of the timezone
+// after the time and before the horizon, nil is returned for timezones
+// without daylight saving time (or other offset changes) in that period
+func NextTransition(zoneinfo string, timezone string, after time.Time, horizon time.Duration) (*Transition, error) {
+	location, err := LoadLocation(zoneinfo, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// transitions are on whole seconds
+	after, end := after.Truncate(time.Second), after.Add(horizon).Truncate(time.Second)
+	_, offset := after.In(location).Zone()
+	for from := after; from.Before(end); from = from.Add(transitionStep) {
+		to := from.Add(transitionStep)
+		if to.After(end) {
+			to = end
+		}
+
+		if _, o := to.In(location).Zone(); o == offset {
+			continue
+		}
+
+		// the offset changes within the step, the change is the first second
+		// with the new offset
+		for to.Sub(from) > time.Second {
+			middle := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+			if !middle.After(from) {
+				break
+			}
+
+			if _, o := middle.In(location).Zone(); o == offset {
+				from = middle
+			} else {
+				to = middle
+			}
+		}
+
+		abbreviationBefore, _ := from.In(location).Zone()
+		abbreviationAfter, offsetAfter := to.In(location).Zone()
+		return &Transition{
+			Timezone:           timezone,
+			At:                 to.UTC(),
+			OffsetBefore:       offset,
+			OffsetAfter:        offsetAfter,
+			AbbreviationBefore: abbreviationBefore,
+			AbbreviationAfter:  abbreviationAfter,
+		}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/k8tz/k8tz/pkg/tzdata"
+)
+
+// tzdataFile is installed by the tz database into the zoneinfo directory, its
+// first line is the version, e.g. "# version 2023c"
+const tzdataFile = "tzdata.zi"
+
+// EmbeddedZoneInfo is the source of the timezones when the zoneinfo directory
+// does not exist, e.g. in scratch or distroless images
+const EmbeddedZoneInfo = "embedded"
+
+// ZoneInfoSource returns the zoneinfo directory if it exists, EmbeddedZoneInfo
+// otherwise, the TZif files are read from the embedded tz database then
+func ZoneInfoSource(zoneinfo string) string {
+	if _, err := os.Stat(zoneinfo); errors.Is(err, fs.ErrNotExist) {
+		return EmbeddedZoneInfo
+	}
+
+	return zoneinfo
+}
+
+// readTZif reads the TZif file of the timezone from the zoneinfo directory, or
+// from the embedded tz database if the directory does not exist
+func readTZif(zoneinfo string, timezone string) ([]byte, error) {
+	if ZoneInfoSource(zoneinfo) == EmbeddedZoneInfo {
+		return tzdata.ReadFile(timezone)
+	}
+
+	return os.ReadFile(filepath.Join(zoneinfo, timezone))
+}
+
+// Zones returns the sorted names of the timezones of the zoneinfo directory,
+// i.e. its TZif files, or of the embedded tz database if the directory does
+// not exist. The posix and right trees of some distributions are skipped,
+// they duplicate the other timezones.
+func Zones(zoneinfo string) ([]string, error) {
+	if ZoneInfoSource(zoneinfo) == EmbeddedZoneInfo {
+		return tzdata.Zones()
+	}
+
+	var zones []string
+	err := filepath.WalkDir(zoneinfo, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(zoneinfo, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if name == "posix" || name == "right" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if name == "posixrules" || name == "localtime" || !isTZif(path) {
+			return nil
+		}
+
+		zones = append(zones, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list timezones of %s: %w", zoneinfo, err)
+	}
+
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// isTZif returns true if the file starts with the magic and a version of
+// TZif files (RFC 8536)
+func isTZif(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+
+	return bytes.HasPrefix(header, []byte("TZif")) && (header[4] == 0 || (header[4] >= '2' && header[4] <= '9'))
+}
+
+// TzdataVersion returns the version of the tz database of the zoneinfo
+// directory, e.g. "2023c", or of the embedded tz database if the directory
+// does not exist
+func TzdataVersion(zoneinfo string) (string, error) {
+	if ZoneInfoSource(zoneinfo) == EmbeddedZoneInfo {
+		return tzdata.Version(), nil
+	}
+
+	f, err := os.Open(filepath.Join(zoneinfo, tzdataFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read tz database version: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		line := scanner.Text()
+		if version := strings.TrimSpace(strings.TrimPrefix(line, "# version ")); version != line && version != "" {
+			return version, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read tz database version: %w", err)
+	}
+
+	return "", fmt.Errorf("no version in %s", filepath.Join(zoneinfo, tzdataFile))
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ValidateTzdir checks that the tz database of the tzdata strategy is
+// mounted on a clean absolute path other than the root directory
+func ValidateTzdir(dir string) error {
+	if !path.IsAbs(dir) || path.Clean(dir) != dir || dir == "/" {
+		return fmt.Errorf("invalid tzdir %q, expected a clean absolute path, e.g. %s", dir, DefaultTzdir)
+	}
+
+	return nil
+}
+
+// tzdir returns where the tzdata strategy mounts the tz database
+func (g *PatchGenerator) tzdir() string {
+	if g.Tzdir == "" {
+		return DefaultTzdir
+	}
+
+	return g.Tzdir
+}
+
+// isReplacedMount returns true if the volumeMount is on one of the paths that
+// the injected volumeMounts replace
+func (g *PatchGenerator) isReplacedMount(mount corev1.VolumeMount) bool {
+	if mount.MountPath == g.LocalTimePath || mount.MountPath == g.HostPathPrefix {
+		return true
+	}
+
+	return g.Strategy == TzdataInjectionStrategy && mount.MountPath == g.tzdir()
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RemoveInjection removes the injection of the generator from the pod spec:
+// the k8tz volume and its mounts, the bootstrap container, TZ, the TZDIR of
+// the tzdata strategy, the FAKETIME and LD_PRELOAD of the faketime strategy
+// and the extra environment variables of the generator, so the spec can be injected again
+// with other settings. The volume mounts and TZ variables that the injection
+// replaced are not restored.
+func (g *PatchGenerator) RemoveInjection(spec *corev1.PodSpec) {
+	volumes := spec.Volumes[:0]
+	for _, v := range spec.Volumes {
+		if v.Name != VolumeName {
+			volumes = append(volumes, v)
+		}
+	}
+	spec.Volumes = volumes
+
+	initContainers := spec.InitContainers[:0]
+	for _, c := range spec.InitContainers {
+		if c.Name != BootstrapContainerName {
+			initContainers = append(initContainers, c)
+		}
+	}
+	spec.InitContainers = initContainers
+
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+
+		mounts := c.VolumeMounts[:0]
+		for _, m := range c.VolumeMounts {
+			if m.Name != VolumeName {
+				mounts = append(mounts, m)
+			}
+		}
+		c.VolumeMounts = mounts
+
+		env := c.Env[:0]
+		for _, e := range c.Env {
+			if e.Name != "TZ" && !g.isExtraEnv(e) && !(e.Name == "TZDIR" && e.Value == g.tzdir()) && !g.isFaketimeEnv(e) {
+				env = append(env, e)
+			}
+		}
+		c.Env = env
+	}
+}
+
+// isExtraEnv returns true if the variable is one of the extra environment
+// variables of any strategy, with the same value
+func (g *PatchGenerator) isExtraEnv(env corev1.EnvVar) bool {
+	for _, vars := range g.ExtraEnv {
+		for _, v := range vars {
+			if v.Name == env.Name && v.Value == env.Value && env.ValueFrom == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ImageZoneInfoPath is the zoneinfo directory inside the bootstrap image,
+// relative to the root of the image volume
+var ImageZoneInfoPath = strings.TrimPrefix(DefaultHostPathPrefix, "/")
+
+// imageVolume is a volume with the image source, the source was added in
+// kubernetes 1.31 and it is missing from the API types that k8tz is compiled
+// with
+type imageVolume struct {
+	Name  string            `json:"name"`
+	Image imageVolumeSource `json:"image"`
+}
+
+type imageVolumeSource struct {
+	Reference  string            `json:"reference"`
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+}
+
+// csiStrategy mounts the zoneinfo directory of a CSI ephemeral inline volume,
+// the driver must provide the TZif files at CSIZoneInfoPath of the volume
+func csiStrategy(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	if g.CSIDriver == "" {
+		return nil, errors.New("the csi strategy requires a csi driver")
+	}
+
+	if err := validateSubPath(g.CSIZoneInfoPath); err != nil {
+		return nil, err
+	}
+
+	return g.createReadOnlyVolumePatches(spec, pathprefix, csiVolumeFragment(g.CSIDriver, g.CSIVolumeAttributes)), nil
+}
+
+// imageStrategy mounts the zoneinfo directory of the bootstrap image with an
+// image volume, so there is no container to wait for. Requires kubernetes
+// >=1.31.0 with the 'ImageVolume' feature gate.
+func imageStrategy(spec *corev1.PodSpec, g *PatchGenerator, pathprefix string) (k8tz.Patches, error) {
+	image := g.bootstrapImage(spec)
+	if image == "" {
+		return nil, errors.New("the image strategy requires a bootstrap image")
+	}
+
+	patches := g.createReadOnlyVolumePatches(spec, pathprefix, imageVolumeFragment(image, g.InitContainerImagePullPolicy))
+	if len(patches) == 0 {
+		return patches, nil
+	}
+
+	return append(patches, g.createImagePullSecretPatches(spec, pathprefix)...), nil
+}
+
+// zoneInfoSubPath returns the zoneinfo directory inside the k8tz volume of the
+// strategy, the volumes of the other strategies hold the TZif files at their
+// root
+func (g *PatchGenerator) zoneInfoSubPath(strategy InjectionStrategy) string {
+	switch strategy {
+	case CSIInjectionStrategy:
+		return g.CSIZoneInfoPath
+	case ImageVolumeInjectionStrategy:
+		return ImageZoneInfoPath
+	default:
+		return ""
+	}
+}
+
+// validateSubPath checks that a directory inside a volume is a clean relative
+// path that does not leave the volume, empty is the root of the volume
+func validateSubPath(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	if path.IsAbs(dir) || path.Clean(dir) != dir || dir == ".." || strings.HasPrefix(dir, "../") {
+		return fmt.Errorf("invalid zoneinfo path %q inside the volume, expected a clean relative path", dir)
+	}
+
+	return nil
+}
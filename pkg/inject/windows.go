@@ -0,0 +1,42 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inject
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// IsWindowsPod returns true if the pod runs on windows nodes, either from
+// spec.os.name or from the kubernetes.io/os nodeSelector. The bootstrap
+// container and the TZif files of the other strategies are linux only.
+func IsWindowsPod(spec *corev1.PodSpec) bool {
+	if spec.OS != nil {
+		return spec.OS.Name == corev1.Windows
+	}
+
+	return spec.NodeSelector[corev1.LabelOSStable] == string(corev1.Windows)
+}
+
+// podStrategy returns the strategy that the pod is injected with, windows
+// pods always get the windows strategy
+func (g *PatchGenerator) podStrategy(spec *corev1.PodSpec) InjectionStrategy {
+	if IsWindowsPod(spec) {
+		return WindowsInjectionStrategy
+	}
+
+	return g.Strategy
+}
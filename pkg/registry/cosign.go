@@ -0,0 +1,159 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cosignSignatureAnnotation holds the signature of the payload layer of a
+// cosign signature manifest
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// LoadPublicKey loads a PEM encoded ECDSA or RSA public key, like the
+// cosign.pub file of 'cosign generate-key-pair'
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key in %s", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key in %s: %w", path, err)
+	}
+
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key %T in %s, expected ECDSA or RSA", key, path)
+}
+
+// Verify checks that the image digest has a cosign signature of the key. The
+// signatures are read from the sha256-<digest>.sig tag of the repository, as
+// written by 'cosign sign --key', the transparency log is not checked.
+func (c *Client) Verify(ctx context.Context, ref Reference, digest string, key crypto.PublicKey) error {
+	tag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	data, err := c.fetch(ctx, ref, "manifests/"+tag, []string{mediaTypeOCIManifest, mediaTypeDockerManifest})
+	if err != nil {
+		return fmt.Errorf("no signatures of %s: %w", ref.WithDigest(digest), err)
+	}
+
+	manifest := struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}{}
+
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid signature manifest of %s: %w", ref.WithDigest(digest), err)
+	}
+
+	var failures []string
+	for _, layer := range manifest.Layers {
+		signature, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		if err = c.verifyLayer(ctx, ref, digest, layer.Digest, signature, key); err == nil {
+			return nil
+		}
+
+		failures = append(failures, err.Error())
+	}
+
+	if len(failures) == 0 {
+		return fmt.Errorf("no signatures of %s", ref.WithDigest(digest))
+	}
+
+	return fmt.Errorf("no valid signature of %s: %s", ref.WithDigest(digest), strings.Join(failures, "; "))
+}
+
+// verifyLayer verifies the signature of a simple signing payload and that the
+// payload is about the image digest
+func (c *Client) verifyLayer(ctx context.Context, ref Reference, digest string, layerDigest string, signature string, key crypto.PublicKey) error {
+	payload, err := c.fetch(ctx, ref, "blobs/"+layerDigest, nil)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(payload)
+	if fmt.Sprintf("sha256:%x", sum) != layerDigest {
+		return fmt.Errorf("payload %s does not match its digest", layerDigest)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature of payload %s: %w", layerDigest, err)
+	}
+
+	if err = verifySignature(key, sum[:], sig); err != nil {
+		return fmt.Errorf("signature of payload %s: %w", layerDigest, err)
+	}
+
+	simpleSigning := struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}{}
+
+	if err = json.Unmarshal(payload, &simpleSigning); err != nil {
+		return fmt.Errorf("invalid payload %s: %w", layerDigest, err)
+	}
+
+	if signed := simpleSigning.Critical.Image.DockerManifestDigest; signed != digest {
+		return fmt.Errorf("payload %s signs %s", layerDigest, signed)
+	}
+
+	return nil
+}
+
+func verifySignature(key crypto.PublicKey, hash []byte, sig []byte) error {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hash, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash, sig)
+	}
+
+	return fmt.Errorf("unsupported public key %T", key)
+}
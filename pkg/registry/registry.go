@@ -0,0 +1,378 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry is a minimal client of the OCI distribution API, it
+// resolves image tags to digests and verifies cosign signatures of images
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+
+	// maxManifestBytes bounds the manifests and signature payloads that are
+	// read from the registry
+	maxManifestBytes = 4 << 20
+)
+
+// manifestMediaTypes are accepted when resolving a tag, a multi-arch image
+// resolves to the digest of its index so it keeps working on every node
+var manifestMediaTypes = []string{
+	mediaTypeOCIIndex,
+	mediaTypeDockerManifestList,
+	mediaTypeOCIManifest,
+	mediaTypeDockerManifest,
+}
+
+// Reference is a parsed image reference, e.g. quay.io/k8tz/k8tz:0.13.1
+type Reference struct {
+	// Name is the image as written without its tag and digest
+	Name       string
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses the image reference, images without a registry are
+// Docker Hub images and images without a tag or digest are tagged latest
+func ParseReference(image string) (Reference, error) {
+	ref := Reference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, ref.Digest = name[:i], name[i+1:]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return ref, fmt.Errorf("invalid image %q: unsupported digest %s", image, ref.Digest)
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, ref.Tag = name[:i], name[i+1:]
+	}
+
+	if name == "" || ref.Tag == "" && strings.HasSuffix(image, ":") {
+		return ref, fmt.Errorf("invalid image %q", image)
+	}
+
+	ref.Name = name
+	ref.Registry, ref.Repository = dockerHubRegistry, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			ref.Registry, ref.Repository = host, name[i+1:]
+		}
+	}
+
+	if ref.Registry == dockerHubRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+
+	return ref, nil
+}
+
+// String returns the reference as written, with its tag and digest
+func (r Reference) String() string {
+	s := r.Name
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+
+	return s
+}
+
+// WithDigest returns the reference pinned to the digest, the tag is kept for
+// readability and is ignored by the container runtime
+func (r Reference) WithDigest(digest string) Reference {
+	r.Digest = digest
+	return r
+}
+
+// Credential is the username and password of a registry
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Client accesses registries anonymously, or with the credentials of the
+// registry when they are set
+type Client struct {
+	HTTPClient  *http.Client
+	Credentials map[string]Credential
+}
+
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:  &http.Client{Timeout: 30 * time.Second},
+		Credentials: map[string]Credential{},
+	}
+}
+
+// LoadDockerConfig loads the registry credentials of a docker config.json
+// file, like the .dockerconfigjson key of an image pull secret
+func (c *Client) LoadDockerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}{}
+
+	if err = json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid docker config %s: %w", path, err)
+	}
+
+	for server, auth := range config.Auths {
+		credential := Credential{Username: auth.Username, Password: auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return fmt.Errorf("invalid auth of registry %s in %s: %w", server, path, err)
+			}
+
+			credential.Username, credential.Password, _ = strings.Cut(string(decoded), ":")
+		}
+
+		c.Credentials[registryHost(server)] = credential
+	}
+
+	return nil
+}
+
+// registryHost returns the host of a docker config server key, which can be
+// a URL, and the Docker Hub registry of its legacy index address
+func registryHost(server string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	if host == "index.docker.io" || host == "docker.io" {
+		return dockerHubRegistry
+	}
+
+	return host
+}
+
+// Resolve returns the digest of the image, the digest of a pinned image is
+// returned as is
+func (c *Client) Resolve(ctx context.Context, ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	resp, err := c.do(ctx, ref, http.MethodHead, "manifests/"+ref.Tag, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// registries are not required to return the digest header
+	manifest, err := c.fetch(ctx, ref, "manifests/"+ref.Tag, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(manifest)), nil
+}
+
+// fetch returns the body of a registry object
+func (c *Client) fetch(ctx context.Context, ref Reference, path string, accept []string) ([]byte, error) {
+	resp, err := c.do(ctx, ref, http.MethodGet, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestBytes+1))
+	if err != nil {
+		return nil, err
+	} else if len(data) > maxManifestBytes {
+		return nil, fmt.Errorf("%s of %s exceeds %d bytes", path, ref.Name, maxManifestBytes)
+	}
+
+	return data, nil
+}
+
+// do sends the request and authenticates with the challenge of the registry
+// when it is rejected as unauthorized
+func (c *Client) do(ctx context.Context, ref Reference, method string, path string, accept []string) (*http.Response, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/%s/%s", ref.Registry, ref.Repository, path)
+	resp, err := c.send(ctx, method, endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, ref, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate to %s: %w", ref.Registry, err)
+		}
+
+		if resp, err = c.send(ctx, method, endpoint, accept, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: unexpected status %s", method, endpoint, resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) send(ctx context.Context, method string, endpoint string, accept []string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accept) > 0 {
+		req.Header.Set("Accept", strings.Join(accept, ", "))
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+// authorize returns the Authorization header that answers the challenge, a
+// bearer token is requested with the credentials of the registry, if any
+func (c *Client) authorize(ctx context.Context, ref Reference, challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	credential, hasCredential := c.Credentials[ref.Registry]
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCredential {
+			return "", fmt.Errorf("no credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credential.Username+":"+credential.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid realm of challenge %q", challenge)
+	}
+
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", ref.Repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if hasCredential {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request failed: %s", resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestBytes)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var pair string
+		rest = strings.TrimLeft(rest, " ,")
+		if i := strings.Index(rest, "="); i < 0 {
+			break
+		} else if strings.HasPrefix(rest[i+1:], `"`) {
+			end := strings.Index(rest[i+2:], `"`)
+			if end < 0 {
+				break
+			}
+			pair, rest = rest[:i+2+end+1], rest[i+2+end+1:]
+		} else {
+			pair, rest, _ = strings.Cut(rest, ",")
+		}
+
+		key, value, _ := strings.Cut(pair, "=")
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(value, `"`)
+	}
+
+	return scheme, params
+}
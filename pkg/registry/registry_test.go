@@ -0,0 +1,283 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		want    Reference
+		wantErr bool
+	}{
+		{
+			name:  "registry with tag",
+			image: "quay.io/k8tz/k8tz:0.13.1",
+			want:  Reference{Name: "quay.io/k8tz/k8tz", Registry: "quay.io", Repository: "k8tz/k8tz", Tag: "0.13.1"},
+		},
+		{
+			name:  "docker hub official image",
+			image: "busybox",
+			want:  Reference{Name: "busybox", Registry: dockerHubRegistry, Repository: "library/busybox", Tag: "latest"},
+		},
+		{
+			name:  "registry with port and digest",
+			image: "localhost:5000/k8tz@sha256:abc",
+			want:  Reference{Name: "localhost:5000/k8tz", Registry: "localhost:5000", Repository: "k8tz", Digest: "sha256:abc"},
+		},
+		{
+			name:  "docker hub with tag and digest",
+			image: "k8tz/k8tz:0.13.1@sha256:abc",
+			want:  Reference{Name: "k8tz/k8tz", Registry: dockerHubRegistry, Repository: "k8tz/k8tz", Tag: "0.13.1", Digest: "sha256:abc"},
+		},
+		{
+			name:    "unsupported digest",
+			image:   "k8tz/k8tz@md5:abc",
+			wantErr: true,
+		},
+		{
+			name:    "empty tag",
+			image:   "k8tz/k8tz:",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReference(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRegistry serves the manifests and blobs of a single repository behind
+// bearer token authentication
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	noDigest  bool
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if r.URL.Query().Get("scope") != "repository:k8tz/k8tz:pull" {
+			http.Error(w, "invalid scope", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"secret"}`))
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/token",service="fake"`, r.Host))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var data []byte
+	var ok bool
+	if name := strings.TrimPrefix(r.URL.Path, "/v2/k8tz/k8tz/manifests/"); name != r.URL.Path {
+		data, ok = f.manifests[name]
+	} else if name = strings.TrimPrefix(r.URL.Path, "/v2/k8tz/k8tz/blobs/"); name != r.URL.Path {
+		data, ok = f.blobs[name]
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !f.noDigest {
+		w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256(data)))
+	}
+
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+func TestClient_Resolve(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2}`)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+
+	tests := []struct {
+		name     string
+		image    string
+		noDigest bool
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:  "tag",
+			image: "k8tz/k8tz:0.13.1",
+			want:  digest,
+		},
+		{
+			name:     "tag without digest header",
+			image:    "k8tz/k8tz:0.13.1",
+			noDigest: true,
+			want:     digest,
+		},
+		{
+			name:  "pinned image",
+			image: "k8tz/k8tz:0.13.1@sha256:abc",
+			want:  "sha256:abc",
+		},
+		{
+			name:    "missing tag",
+			image:   "k8tz/k8tz:0.0.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(&fakeRegistry{
+				manifests: map[string][]byte{"0.13.1": manifest},
+				noDigest:  tt.noDigest,
+			})
+			defer server.Close()
+
+			c := NewClient()
+			c.HTTPClient = server.Client()
+
+			ref, err := ParseReference(strings.TrimPrefix(server.URL, "https://") + "/" + tt.image)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Resolve(context.Background(), ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Verify(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	signatures := func(signer *ecdsa.PrivateKey, signed string) map[string][]byte {
+		payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"k8tz/k8tz"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"}}`, signed))
+		sum := sha256.Sum256(payload)
+		sig, err := ecdsa.SignASN1(rand.Reader, signer, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		layerDigest := fmt.Sprintf("sha256:%x", sum)
+		manifest, _ := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []map[string]interface{}{{
+				"digest":      layerDigest,
+				"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+			}},
+		})
+
+		return map[string][]byte{
+			"manifests/sha256-" + strings.Repeat("a", 64) + ".sig": manifest,
+			"blobs/" + layerDigest:                                 payload,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects map[string][]byte
+		wantErr bool
+	}{
+		{
+			name:    "signed",
+			objects: signatures(key, digest),
+			wantErr: false,
+		},
+		{
+			name:    "signed by another key",
+			objects: signatures(other, digest),
+			wantErr: true,
+		},
+		{
+			name:    "signature of another digest",
+			objects: signatures(key, "sha256:"+strings.Repeat("b", 64)),
+			wantErr: true,
+		},
+		{
+			name:    "unsigned",
+			objects: map[string][]byte{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := &fakeRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+			for path, data := range tt.objects {
+				if name := strings.TrimPrefix(path, "manifests/"); name != path {
+					registry.manifests[name] = data
+				} else {
+					registry.blobs[strings.TrimPrefix(path, "blobs/")] = data
+				}
+			}
+
+			server := httptest.NewTLSServer(registry)
+			defer server.Close()
+
+			c := NewClient()
+			c.HTTPClient = server.Client()
+
+			ref, err := ParseReference(strings.TrimPrefix(server.URL, "https://") + "/k8tz/k8tz:0.13.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = c.Verify(context.Background(), ref, digest, &key.PublicKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	TableOutput = "table"
+	JSONOutput  = "json"
+	CSVOutput   = "csv"
+)
+
+// Formats are the output formats of the report
+var Formats = []string{TableOutput, JSONOutput, CSVOutput}
+
+// Pod is the timezone of a single pod in the cluster
+type Pod struct {
+	Namespace     string `json:"namespace"`
+	Name          string `json:"name"`
+	Injected      bool   `json:"injected"`
+	Timezone      string `json:"timezone,omitempty"`
+	TzdataVersion string `json:"tzdataVersion,omitempty"`
+	Stale         bool   `json:"stale"`
+}
+
+// Namespace summarizes the pods of a namespace
+type Namespace struct {
+	Name       string   `json:"name"`
+	Pods       int      `json:"pods"`
+	Injected   int      `json:"injected"`
+	Uninjected int      `json:"uninjected"`
+	Stale      int      `json:"stale"`
+	Timezones  []string `json:"timezones"`
+}
+
+// Report is the timezone inventory of the cluster
+type Report struct {
+	// TzdataVersion is the current tz database version, pods that were
+	// injected with an older version are stale
+	TzdataVersion string      `json:"tzdataVersion,omitempty"`
+	Namespaces    []Namespace `json:"namespaces"`
+	Pods          []Pod       `json:"pods"`
+}
+
+// Build lists the pods of the namespace (all the namespaces if empty) and
+// returns their report, stale pods are only found when the tzdataVersion is
+// known
+func Build(ctx context.Context, clientset kubernetes.Interface, namespace string, tzdataVersion string) (*Report, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	return New(list.Items, tzdataVersion), nil
+}
+
+// New returns the report of the pods, sorted by namespace and name
+func New(pods []corev1.Pod, tzdataVersion string) *Report {
+	report := &Report{
+		TzdataVersion: tzdataVersion,
+		Namespaces:    []Namespace{},
+		Pods:          make([]Pod, 0, len(pods)),
+	}
+
+	for i := range pods {
+		report.Pods = append(report.Pods, podReport(&pods[i], tzdataVersion))
+	}
+
+	sort.Slice(report.Pods, func(i, j int) bool {
+		if report.Pods[i].Namespace != report.Pods[j].Namespace {
+			return report.Pods[i].Namespace < report.Pods[j].Namespace
+		}
+		return report.Pods[i].Name < report.Pods[j].Name
+	})
+
+	for _, pod := range report.Pods {
+		last := len(report.Namespaces) - 1
+		if last < 0 || report.Namespaces[last].Name != pod.Namespace {
+			report.Namespaces = append(report.Namespaces, Namespace{Name: pod.Namespace, Timezones: []string{}})
+			last++
+		}
+
+		ns := &report.Namespaces[last]
+		ns.Pods++
+		if !pod.Injected {
+			ns.Uninjected++
+			continue
+		}
+
+		ns.Injected++
+		if pod.Stale {
+			ns.Stale++
+		}
+
+		if i := sort.SearchStrings(ns.Timezones, pod.Timezone); i == len(ns.Timezones) || ns.Timezones[i] != pod.Timezone {
+			ns.Timezones = append(ns.Timezones, "")
+			copy(ns.Timezones[i+1:], ns.Timezones[i:])
+			ns.Timezones[i] = pod.Timezone
+		}
+	}
+
+	return report
+}
+
+func podReport(pod *corev1.Pod, tzdataVersion string) Pod {
+	injected, _ := strconv.ParseBool(pod.Annotations[k8tz.InjectedAnnotation])
+	report := Pod{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Injected:  injected,
+	}
+
+	if injected {
+		report.Timezone = pod.Annotations[k8tz.TimezoneAnnotation]
+		report.TzdataVersion = pod.Annotations[k8tz.TzdataVersionAnnotation]
+		// like the tzdata upgrade check, pods without a recorded version
+		// (e.g. the hostPath strategy) are never stale
+		report.Stale = tzdataVersion != "" && report.TzdataVersion != "" && report.TzdataVersion < tzdataVersion
+	}
+
+	return report
+}
+
+// Write prints the report to the output in the format, the CSV lists only the
+// pods since it has a single header
+func (r *Report) Write(format string, out io.Writer) error {
+	switch format {
+	case JSONOutput:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case CSVOutput:
+		w := csv.NewWriter(out)
+		_ = w.Write([]string{"namespace", "name", "injected", "timezone", "tzdataVersion", "stale"})
+		for _, p := range r.Pods {
+			_ = w.Write([]string{p.Namespace, p.Name, strconv.FormatBool(p.Injected), p.Timezone, p.TzdataVersion, strconv.FormatBool(p.Stale)})
+		}
+		w.Flush()
+		return w.Error()
+	case TableOutput:
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tPODS\tINJECTED\tUNINJECTED\tSTALE\tTIMEZONES")
+		for _, ns := range r.Namespaces {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", ns.Name, ns.Pods, ns.Injected, ns.Uninjected, ns.Stale, strings.Join(ns.Timezones, ","))
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "NAMESPACE\tNAME\tINJECTED\tTIMEZONE\tTZDATA\tSTALE")
+		for _, p := range r.Pods {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%t\n", p.Namespace, p.Name, p.Injected, p.Timezone, p.TzdataVersion, p.Stale)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", format)
+}
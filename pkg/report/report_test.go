@@ -0,0 +1,201 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	k8tz "github.com/k8tz/k8tz/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func fakePod(namespace, name, timezone, tzdataVersion string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	if timezone != "" {
+		pod.Annotations = map[string]string{
+			k8tz.InjectedAnnotation: "true",
+			k8tz.TimezoneAnnotation: timezone,
+		}
+		if tzdataVersion != "" {
+			pod.Annotations[k8tz.TzdataVersionAnnotation] = tzdataVersion
+		}
+	}
+
+	return pod
+}
+
+func fakeObjects() []runtime.Object {
+	return []runtime.Object{
+		fakePod("prod", "web", "Europe/London", "2023c"),
+		fakePod("prod", "api", "Asia/Tokyo", "2024a"),
+		fakePod("prod", "db", "Europe/London", ""),
+		fakePod("dev", "web", "", ""),
+		fakePod("dev", "api", "UTC", "2024a"),
+	}
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespace      string
+		tzdataVersion  string
+		wantNamespaces []Namespace
+		wantPods       []Pod
+	}{
+		{
+			name:          "all namespaces",
+			tzdataVersion: "2024a",
+			wantNamespaces: []Namespace{
+				{Name: "dev", Pods: 2, Injected: 1, Uninjected: 1, Stale: 0, Timezones: []string{"UTC"}},
+				{Name: "prod", Pods: 3, Injected: 3, Uninjected: 0, Stale: 1, Timezones: []string{"Asia/Tokyo", "Europe/London"}},
+			},
+			wantPods: []Pod{
+				{Namespace: "dev", Name: "api", Injected: true, Timezone: "UTC", TzdataVersion: "2024a"},
+				{Namespace: "dev", Name: "web"},
+				{Namespace: "prod", Name: "api", Injected: true, Timezone: "Asia/Tokyo", TzdataVersion: "2024a"},
+				{Namespace: "prod", Name: "db", Injected: true, Timezone: "Europe/London"},
+				{Namespace: "prod", Name: "web", Injected: true, Timezone: "Europe/London", TzdataVersion: "2023c", Stale: true},
+			},
+		},
+		{
+			name:      "single namespace without tzdata version",
+			namespace: "prod",
+			wantNamespaces: []Namespace{
+				{Name: "prod", Pods: 3, Injected: 3, Timezones: []string{"Asia/Tokyo", "Europe/London"}},
+			},
+			wantPods: []Pod{
+				{Namespace: "prod", Name: "api", Injected: true, Timezone: "Asia/Tokyo", TzdataVersion: "2024a"},
+				{Namespace: "prod", Name: "db", Injected: true, Timezone: "Europe/London"},
+				{Namespace: "prod", Name: "web", Injected: true, Timezone: "Europe/London", TzdataVersion: "2023c"},
+			},
+		},
+		{
+			name:           "empty namespace",
+			namespace:      "staging",
+			tzdataVersion:  "2024a",
+			wantNamespaces: []Namespace{},
+			wantPods:       []Pod{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Build(context.Background(), fake.NewSimpleClientset(fakeObjects()...), tt.namespace, tt.tzdataVersion)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			if got.TzdataVersion != tt.tzdataVersion {
+				t.Errorf("Build() tzdata version = %s, want %s", got.TzdataVersion, tt.tzdataVersion)
+			}
+
+			if !reflect.DeepEqual(got.Namespaces, tt.wantNamespaces) {
+				t.Errorf("Build() namespaces = %+v, want %+v", got.Namespaces, tt.wantNamespaces)
+			}
+
+			if !reflect.DeepEqual(got.Pods, tt.wantPods) {
+				t.Errorf("Build() pods = %+v, want %+v", got.Pods, tt.wantPods)
+			}
+		})
+	}
+}
+
+func TestReport_Write(t *testing.T) {
+	pods := []corev1.Pod{
+		*fakePod("default", "a", "UTC", "2023c"),
+		*fakePod("default", "b", "", ""),
+	}
+	report := New(pods, "2024a")
+
+	tests := []struct {
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			format: TableOutput,
+			want: "NAMESPACE   PODS   INJECTED   UNINJECTED   STALE   TIMEZONES\n" +
+				"default     2      1          1            1       UTC\n" +
+				"\n" +
+				"NAMESPACE   NAME   INJECTED   TIMEZONE   TZDATA   STALE\n" +
+				"default     a      true       UTC        2023c    true\n" +
+				"default     b      false                          false\n",
+		},
+		{
+			format: CSVOutput,
+			want: "namespace,name,injected,timezone,tzdataVersion,stale\n" +
+				"default,a,true,UTC,2023c,true\n" +
+				"default,b,false,,,false\n",
+		},
+		{
+			format: JSONOutput,
+			want: `{
+  "tzdataVersion": "2024a",
+  "namespaces": [
+    {
+      "name": "default",
+      "pods": 2,
+      "injected": 1,
+      "uninjected": 1,
+      "stale": 1,
+      "timezones": [
+        "UTC"
+      ]
+    }
+  ],
+  "pods": [
+    {
+      "namespace": "default",
+      "name": "a",
+      "injected": true,
+      "timezone": "UTC",
+      "tzdataVersion": "2023c",
+      "stale": true
+    },
+    {
+      "namespace": "default",
+      "name": "b",
+      "injected": false,
+      "stale": false
+    }
+  ]
+}
+`,
+		},
+		{
+			format:  "xml",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := report.Write(tt.format, &out); (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && out.String() != tt.want {
+				t.Errorf("Write() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
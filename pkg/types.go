@@ -17,6 +17,10 @@ limitations under the License.
 package pkg
 
 const (
+	// AutoTimezone is the timezone annotation value that is resolved by the
+	// admission webhook from the region of the nodes, e.g. ap-southeast-1 is
+	// resolved to Asia/Singapore
+	AutoTimezone = "auto"
 	// DefaultTimezone represents the default timezone for k8tz applications
 	DefaultTimezone = UTCTimezone
 	// UTCTimezone is TZ database name for UTC timezone
@@ -31,6 +35,68 @@ const (
 	InjectionStrategyAnnotation = "k8tz.io/strategy"
 	// InjectAnnotation TODO
 	InjectAnnotation = "k8tz.io/inject"
+	// InjectionAnnotation enables ("enabled") or disables ("disabled") the
+	// injection of the object, it takes precedence over InjectAnnotation on
+	// the same object
+	InjectionAnnotation = "k8tz.io/injection"
+	// InjectionEnabled is the InjectionAnnotation value that opts in
+	InjectionEnabled = "enabled"
+	// InjectionDisabled is the InjectionAnnotation value that opts out
+	InjectionDisabled = "disabled"
+	// LocaleAnnotation is the locale that is injected with the LANG and
+	// LC_ALL environment variables, e.g. "en_US.UTF-8"
+	LocaleAnnotation = "k8tz.io/locale"
+	// TzdirAnnotation is where the tzdata strategy mounts the tz database
+	// and the TZDIR environment variable, e.g. "/usr/share/zoneinfo"
+	TzdirAnnotation = "k8tz.io/tzdir"
+	// HostPathAnnotation is the zoneinfo directory of the nodes that the
+	// hostPath strategy mounts, e.g. "/usr/share/zoneinfo"
+	HostPathAnnotation = "k8tz.io/hostpath"
+	// TimezoneFormatAnnotation is the format of the injected TZ environment
+	// variable, "name" (IANA name) or "posix" (POSIX TZ rule, for minimal libc)
+	TimezoneFormatAnnotation = "k8tz.io/timezone-format"
+	// OffsetAnnotation is the UTC offset of the timezone at injection time,
+	// e.g. "+09:00" (output only, not updated on DST changes)
+	OffsetAnnotation = "k8tz.io/offset"
+	// AbbreviationAnnotation is the abbreviation of the timezone at injection
+	// time, e.g. "JST" (output only, not updated on DST changes)
+	AbbreviationAnnotation = "k8tz.io/abbrev"
+	// FailOpenAnnotation overrides the global allow-on-error setting for the
+	// object, "true" admits it without injection when k8tz fails, "false"
+	// rejects it. It is ignored when the object cannot be decoded.
+	FailOpenAnnotation = "k8tz.io/failOpen"
+	// ContainerTimezonesAnnotation overrides the timezone of single containers
+	// of a pod, e.g. "app=Asia/Jakarta,sidecar=UTC"
+	ContainerTimezonesAnnotation = "k8tz.io/container-timezones"
+	// TzdataVersionAnnotation is the version of the tz database that the
+	// bootstrap container copies into the pod, e.g. "2023c" (output only)
+	TzdataVersionAnnotation = "k8tz.io/tzdata-version"
+	// TzdataRestartAnnotation is set on the pod templates of workloads that
+	// are restarted to get a new tz database, with its version (output only)
+	TzdataRestartAnnotation = "k8tz.io/tzdata-restart"
+	// ReinjectAnnotation opts a Deployment, StatefulSet or CronJob with an
+	// injected pod template into re-injection, "true" keeps the injection up
+	// to date with the desired timezone and injection strategy
+	ReinjectAnnotation = "k8tz.io/reinject"
+	// ScheduleAnnotation is the schedule of a CronJob in its timezone before
+	// it was rewritten to UTC, e.g. "0 2 * * *" (output only)
+	ScheduleAnnotation = "k8tz.io/schedule"
+	// DebugAnnotation logs the handling of the admission review of the object
+	// (decoded object, generator and patches) regardless of the verbosity of
+	// the webhook, "true" enables it
+	DebugAnnotation = "k8tz.io/debug"
+	// FaketimeAnnotation is the FAKETIME of libfaketime for the faketime
+	// strategy, e.g. "@2024-03-31 01:59:00" (experimental)
+	FaketimeAnnotation = "k8tz.io/faketime"
+	// BootstrapRepositoryAnnotation of a namespace replaces the repository of
+	// the bootstrap image of its pods, e.g. "registry.tenant.local/k8tz"
+	BootstrapRepositoryAnnotation = "k8tz.io/bootstrap-repository"
+	// BootstrapTagAnnotation of a namespace replaces the tag of the bootstrap
+	// image of its pods, e.g. "0.16.0"
+	BootstrapTagAnnotation = "k8tz.io/bootstrap-tag"
+	// BootstrapPullSecretsAnnotation of a namespace replaces the image pull
+	// secrets of the bootstrap image of its pods, e.g. "tenant-registry"
+	BootstrapPullSecretsAnnotation = "k8tz.io/bootstrap-pull-secrets"
 )
 
 type Patches []Patch
@@ -0,0 +1,107 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tzdata embeds the IANA tz database in the binary, so timezones can
+// be validated and listed without the zoneinfo of the operating system, e.g.
+// in scratch or distroless images. The database is the zoneinfo.zip of the Go
+// toolchain, it is updated with `make embedded-tzdata`.
+package tzdata
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed zoneinfo.zip
+var zoneinfoZip []byte
+
+//go:embed VERSION
+var version string
+
+var (
+	loadOnce sync.Once
+	files    map[string]*zip.File
+	loadErr  error
+)
+
+// Version returns the version of the embedded tz database, e.g. "2023c"
+func Version() string {
+	return strings.TrimSpace(version)
+}
+
+// load indexes the TZif files of the zip by timezone name
+func load() (map[string]*zip.File, error) {
+	loadOnce.Do(func() {
+		r, err := zip.NewReader(bytes.NewReader(zoneinfoZip), int64(len(zoneinfoZip)))
+		if err != nil {
+			loadErr = fmt.Errorf("failed to read embedded tz database: %w", err)
+			return
+		}
+
+		files = make(map[string]*zip.File, len(r.File))
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				files[f.Name] = f
+			}
+		}
+	})
+
+	return files, loadErr
+}
+
+// ReadFile returns the TZif file of the timezone
+func ReadFile(timezone string) ([]byte, error) {
+	files, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	f, ok := files[timezone]
+	if !ok {
+		return nil, fmt.Errorf("timezone %q is not in the embedded tz database", timezone)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded TZif file of %s: %w", timezone, err)
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+// Zones returns the sorted names of the timezones of the embedded tz database,
+// including the backward compatible aliases
+func Zones() ([]string, error) {
+	files, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make([]string, 0, len(files))
+	for name := range files {
+		zones = append(zones, name)
+	}
+
+	sort.Strings(zones)
+	return zones, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tzdata
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	if got := Version(); !regexp.MustCompile(`^\d{4}[a-z]$`).MatchString(got) {
+		t.Errorf("Version() = %q, want a tz database version (e.g. 2023c)", got)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		timezone string
+		wantErr  bool
+	}{
+		{name: "timezone", timezone: "Europe/Berlin"},
+		{name: "backward compatible alias", timezone: "US/Eastern"},
+		{name: "unknown timezone", timezone: "Mars/Olympus_Mons", wantErr: true},
+		{name: "directory", timezone: "Europe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ReadFile(tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if _, err := time.LoadLocationFromTZData(tt.timezone, data); err != nil {
+				t.Errorf("ReadFile() returned an invalid TZif file: %v", err)
+			}
+		})
+	}
+}
+
+func TestZones(t *testing.T) {
+	zones, err := Zones()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, zone := range zones {
+		found[zone] = true
+	}
+
+	for _, zone := range []string{"UTC", "Asia/Kolkata", "America/Argentina/Buenos_Aires"} {
+		if !found[zone] {
+			t.Errorf("Zones() is missing %s", zone)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package e2e tests the webhook end to end: objects are created through a
+// real kubernetes api server, which calls the webhook over TLS with the
+// AdmissionReview wire format, and the stored objects are checked.
+//
+// The tests are built with the e2e build tag and run against either
+//
+//   - envtest: an etcd and a kube-apiserver started from KUBEBUILDER_ASSETS
+//     (e.g. installed by setup-envtest), with the webhook running as a local
+//     process built from this tree (K8TZ_E2E_PROVIDER=envtest, the default)
+//   - cluster: the cluster of KUBECONFIG with k8tz installed by the Helm
+//     chart, e.g. a kind cluster created by `make e2e-kind`
+//     (K8TZ_E2E_PROVIDER=cluster)
+//
+// The tests are skipped when no environment is available:
+//
+//	go test -tags e2e -v ./test/e2e/
+package e2e
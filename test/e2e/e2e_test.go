@@ -0,0 +1,192 @@
+//go:build e2e
+
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/k8tz/k8tz/pkg"
+	"github.com/k8tz/k8tz/pkg/inject"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPod(t *testing.T) {
+	tests := []struct {
+		name          string
+		nsAnnotations map[string]string
+		annotations   map[string]string
+		wantTimezone  string
+		wantStrategy  inject.InjectionStrategy
+	}{
+		{
+			name:         "default timezone",
+			wantTimezone: defaultTimezone,
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:         "timezone annotation",
+			annotations:  map[string]string{pkg.TimezoneAnnotation: "Europe/Amsterdam"},
+			wantTimezone: "Europe/Amsterdam",
+			wantStrategy: inject.InitContainerInjectionStrategy,
+		},
+		{
+			name:          "namespace timezone annotation",
+			nsAnnotations: map[string]string{pkg.TimezoneAnnotation: "Asia/Tokyo"},
+			wantTimezone:  "Asia/Tokyo",
+			wantStrategy:  inject.InitContainerInjectionStrategy,
+		},
+		{
+			name: "hostPath strategy annotation",
+			annotations: map[string]string{
+				pkg.TimezoneAnnotation:          "America/New_York",
+				pkg.InjectionStrategyAnnotation: string(inject.HostPathInjectionStrategy),
+			},
+			wantTimezone: "America/New_York",
+			wantStrategy: inject.HostPathInjectionStrategy,
+		},
+		{
+			name:        "injection disabled",
+			annotations: map[string]string{pkg.InjectAnnotation: "false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns := namespace(t, tt.nsAnnotations)
+			pod, err := clientset.CoreV1().Pods(ns).Create(context.Background(), newPod(tt.annotations), metav1.CreateOptions{})
+			if err != nil {
+				t.Fatalf("failed to create pod: %v", err)
+			}
+
+			// the stored pod is read again, not the response of the create
+			pod, err = clientset.CoreV1().Pods(ns).Get(context.Background(), pod.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("failed to get pod: %v", err)
+			}
+
+			assertInjected(t, &pod.Spec, tt.wantTimezone, tt.wantStrategy)
+		})
+	}
+}
+
+func TestPod_unknownStrategy(t *testing.T) {
+	ns := namespace(t, nil)
+	pod := newPod(map[string]string{pkg.InjectionStrategyAnnotation: "unknown"})
+
+	_, err := clientset.CoreV1().Pods(ns).Create(context.Background(), pod, metav1.CreateOptions{})
+	if err == nil {
+		t.Fatal("pod with an unknown injection strategy was admitted")
+	}
+
+	if !strings.Contains(err.Error(), "unknown injection strategy") {
+		t.Errorf("pod was rejected with %q, want the error of the webhook", err)
+	}
+}
+
+func TestCronJob(t *testing.T) {
+	ns := namespace(t, nil)
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "test-",
+			Annotations:  map[string]string{pkg.TimezoneAnnotation: "Europe/Berlin"},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "0 2 * * *",
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers:    newPod(nil).Spec.Containers,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cronJob, err := clientset.BatchV1().CronJobs(ns).Create(context.Background(), cronJob, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create cronjob: %v", err)
+	}
+
+	cronJob, err = clientset.BatchV1().CronJobs(ns).Get(context.Background(), cronJob.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get cronjob: %v", err)
+	}
+
+	// kubernetes >=1.27 gets spec.timeZone, older versions an injected job
+	// template
+	if cronJob.Spec.TimeZone != nil {
+		if *cronJob.Spec.TimeZone != "Europe/Berlin" {
+			t.Errorf("spec.timeZone = %s, want Europe/Berlin", *cronJob.Spec.TimeZone)
+		}
+
+		return
+	}
+
+	assertInjected(t, &cronJob.Spec.JobTemplate.Spec.Template.Spec, "Europe/Berlin", inject.InitContainerInjectionStrategy)
+}
+
+// assertInjected checks the pod spec was injected with the timezone and the
+// strategy, or was not injected if the timezone is empty
+func assertInjected(t *testing.T, spec *corev1.PodSpec, timezone string, strategy inject.InjectionStrategy) {
+	t.Helper()
+
+	env := findEnv(spec.Containers[0].Env, "TZ")
+	volume := findVolume(spec)
+	bootstrap := findBootstrap(spec)
+	if timezone == "" {
+		if env != nil || volume != nil || bootstrap != nil {
+			t.Errorf("spec was injected: env=%v, volumes=%v, initContainers=%v", spec.Containers[0].Env, spec.Volumes, spec.InitContainers)
+		}
+
+		return
+	}
+
+	if env == nil || env.Value != timezone {
+		t.Errorf("TZ = %v, want %s", env, timezone)
+	}
+
+	if volume == nil {
+		t.Fatalf("volume %s is missing", inject.VolumeName)
+	}
+
+	switch strategy {
+	case inject.InitContainerInjectionStrategy:
+		if volume.EmptyDir == nil {
+			t.Errorf("volume %s = %+v, want an emptyDir", inject.VolumeName, volume.VolumeSource)
+		}
+
+		if bootstrap == nil {
+			t.Errorf("initContainer %s is missing", inject.BootstrapContainerName)
+		}
+	case inject.HostPathInjectionStrategy:
+		if volume.HostPath == nil {
+			t.Errorf("volume %s = %+v, want a hostPath", inject.VolumeName, volume.VolumeSource)
+		}
+
+		if bootstrap != nil {
+			t.Errorf("unexpected initContainer %s", inject.BootstrapContainerName)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+//go:build e2e
+
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/certgen"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// assetsEnv is the directory of the etcd and kube-apiserver binaries, as
+	// set by `setup-envtest use -p env`
+	assetsEnv = "KUBEBUILDER_ASSETS"
+	// binaryEnv is a k8tz binary to test instead of building this tree
+	binaryEnv = "K8TZ_E2E_BINARY"
+
+	installNamespace = "k8tz"
+	webhookName      = "k8tz-e2e"
+
+	startTimeout = time.Minute
+	stopTimeout  = 10 * time.Second
+)
+
+// process is a component of the envtest environment
+type process struct {
+	name string
+	cmd  *exec.Cmd
+}
+
+// startEnvtest starts etcd, a kube-apiserver and the webhook, and registers
+// the webhook for the pods and cronjobs of the test namespaces. The logs of
+// etcd and the api server are written to the temporary directory of the
+// environment, which is kept if the environment fails to start.
+func startEnvtest() (*environment, error) {
+	assets := os.Getenv(assetsEnv)
+	if assets == "" {
+		return nil, fmt.Errorf("%w: %s is not set", errNoEnvironment, assetsEnv)
+	}
+
+	for _, name := range []string{"etcd", "kube-apiserver"} {
+		if _, err := os.Stat(filepath.Join(assets, name)); err != nil {
+			return nil, fmt.Errorf("%w: %v", errNoEnvironment, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "k8tz-e2e-")
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []*process
+	stop := func() {
+		for i := len(processes) - 1; i >= 0; i-- {
+			processes[i].stop()
+		}
+	}
+
+	fail := func(err error) (*environment, error) {
+		stop()
+		return nil, fmt.Errorf("%w (logs in %s)", err, dir)
+	}
+
+	etcd, etcdURL, err := startEtcd(assets, dir)
+	if err != nil {
+		return fail(err)
+	}
+	processes = append(processes, etcd)
+
+	apiserver, kubeconfig, err := startAPIServer(assets, dir, etcdURL)
+	if err != nil {
+		return fail(err)
+	}
+	processes = append(processes, apiserver)
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return fail(err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return fail(err)
+	}
+
+	if err = waitForAPIServer(client); err != nil {
+		return fail(err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: installNamespace}}
+	if _, err = client.CoreV1().Namespaces().Create(context.Background(), ns, metav1.CreateOptions{}); err != nil {
+		return fail(fmt.Errorf("failed to create namespace %s: %w", installNamespace, err))
+	}
+
+	webhook, caBundle, address, err := startWebhook(dir, kubeconfig)
+	if err != nil {
+		return fail(err)
+	}
+	processes = append(processes, webhook)
+
+	if err = registerWebhook(client, address, caBundle); err != nil {
+		return fail(err)
+	}
+
+	return &environment{
+		clientset: client,
+		stop: func() {
+			stop()
+			os.RemoveAll(dir)
+		},
+	}, nil
+}
+
+func startEtcd(assets, dir string) (*process, string, error) {
+	clientPort, err := freePort()
+	if err != nil {
+		return nil, "", err
+	}
+
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, "", err
+	}
+
+	url := "http://127.0.0.1:" + strconv.Itoa(clientPort)
+	p, err := startProcess("etcd", filepath.Join(dir, "etcd.log"), filepath.Join(assets, "etcd"),
+		"--data-dir="+filepath.Join(dir, "etcd"),
+		"--listen-client-urls="+url,
+		"--advertise-client-urls="+url,
+		"--listen-peer-urls=http://127.0.0.1:"+strconv.Itoa(peerPort),
+		"--unsafe-no-fsync")
+
+	return p, url, err
+}
+
+// startAPIServer starts a kube-apiserver that authenticates an admin with a
+// static token and authorizes everything, and writes its kubeconfig. The
+// ServiceAccount admission plugin is disabled since no controller manager
+// creates the default service accounts.
+func startAPIServer(assets, dir, etcdURL string) (*process, string, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keyFile := filepath.Join(dir, "sa.key")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, "", err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	tokenFile := filepath.Join(dir, "tokens.csv")
+	if err = os.WriteFile(tokenFile, []byte(token+",admin,admin,system:masters\n"), 0600); err != nil {
+		return nil, "", err
+	}
+
+	p, err := startProcess("kube-apiserver", filepath.Join(dir, "kube-apiserver.log"), filepath.Join(assets, "kube-apiserver"),
+		"--etcd-servers="+etcdURL,
+		"--cert-dir="+filepath.Join(dir, "apiserver"),
+		"--bind-address=127.0.0.1",
+		"--advertise-address=127.0.0.1",
+		"--secure-port="+strconv.Itoa(port),
+		"--service-cluster-ip-range=10.0.0.0/24",
+		"--service-account-issuer=https://localhost",
+		"--service-account-key-file="+keyFile,
+		"--service-account-signing-key-file="+keyFile,
+		"--token-auth-file="+tokenFile,
+		"--authorization-mode=AlwaysAllow",
+		"--disable-admission-plugins=ServiceAccount",
+		"--allow-privileged=true")
+	if err != nil {
+		return nil, "", err
+	}
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	config := clientcmdapi.NewConfig()
+	config.Clusters["envtest"] = &clientcmdapi.Cluster{
+		Server:                "https://127.0.0.1:" + strconv.Itoa(port),
+		InsecureSkipTLSVerify: true,
+	}
+	config.AuthInfos["admin"] = &clientcmdapi.AuthInfo{Token: token}
+	config.Contexts["envtest"] = &clientcmdapi.Context{Cluster: "envtest", AuthInfo: "admin"}
+	config.CurrentContext = "envtest"
+	if err = clientcmd.WriteToFile(*config, kubeconfig); err != nil {
+		p.stop()
+		return nil, "", err
+	}
+
+	return p, kubeconfig, nil
+}
+
+func waitForAPIServer(client kubernetes.Interface) error {
+	err := wait.PollImmediate(time.Second, startTimeout, func() (bool, error) {
+		_, err := client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(context.Background())
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("kube-apiserver is not ready: %w", err)
+	}
+
+	return nil
+}
+
+// startWebhook builds k8tz and starts its webhook with a generated serving
+// certificate, it returns the CA of the certificate and the address of the
+// webhook
+func startWebhook(dir, kubeconfig string) (*process, []byte, string, error) {
+	binary := os.Getenv(binaryEnv)
+	if binary == "" {
+		binary = filepath.Join(dir, "k8tz")
+		build := exec.Command("go", "build", "-o", binary, "github.com/k8tz/k8tz")
+		build.Stdout, build.Stderr = os.Stderr, os.Stderr
+		if err := build.Run(); err != nil {
+			return nil, nil, "", fmt.Errorf("failed to build k8tz: %w", err)
+		}
+	}
+
+	caPEM, certPEM, keyPEM, err := certgen.GenerateCertificates([]string{"localhost"}, time.Now().Add(-time.Hour), 24*time.Hour)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err = os.WriteFile(certFile, certPEM, 0600); err != nil {
+		return nil, nil, "", err
+	}
+
+	if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, nil, "", err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	address := "localhost:" + strconv.Itoa(port)
+	p, err := startProcess("k8tz", "", binary, "webhook",
+		"--kube-config="+kubeconfig,
+		"--tls-crt="+certFile,
+		"--tls-key="+keyFile,
+		"--addr=127.0.0.1:"+strconv.Itoa(port),
+		"--install-namespace="+installNamespace,
+		"--timezone="+defaultTimezone,
+		"--cronJobTimeZone",
+		"--shutdown-delay=0",
+		"--verbose")
+
+	return p, caPEM, address, err
+}
+
+// registerWebhook registers the webhook by url, the api server does not
+// route to services without a cluster network
+func registerWebhook(client kubernetes.Interface, address string, caBundle []byte) error {
+	url := "https://" + address + "/"
+	failurePolicy := admissionregistrationv1.Fail
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	configuration := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: webhookName},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{{
+			Name: "admission-controller.k8tz.io",
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				URL:      &url,
+				CABundle: caBundle,
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{
+				{
+					Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{""},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"pods"},
+					},
+				},
+				{
+					Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{"batch"},
+						APIVersions: []string{"v1"},
+						Resources:   []string{"cronjobs"},
+					},
+				},
+			},
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{e2eLabel: "true"},
+			},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffects,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+
+	_, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(context.Background(), configuration, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to register the webhook: %w", err)
+	}
+
+	return nil
+}
+
+// startProcess starts the binary with its output written to the log file,
+// or to stderr if it is empty
+func startProcess(name, logFile, binary string, args ...string) (*process, error) {
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if logFile != "" {
+		f, err := os.Create(logFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		cmd.Stdout, cmd.Stderr = f, f
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	return &process{name: name, cmd: cmd}, nil
+}
+
+// stop terminates the process, it is killed if it does not exit in time
+func (p *process) stop() {
+	exited := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		close(exited)
+	}()
+
+	p.cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		fmt.Fprintf(os.Stderr, "killing %s, it did not exit in %s\n", p.name, stopTimeout)
+		p.cmd.Process.Kill()
+		<-exited
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,219 @@
+//go:build e2e
+
+/*
+Copyright © 2021 Yonatan Kahana
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/k8tz/k8tz/pkg/inject"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	providerEnv = "K8TZ_E2E_PROVIDER"
+
+	envtestProvider = "envtest"
+	clusterProvider = "cluster"
+
+	// defaultTimezone is the default timezone of the webhook under test, the
+	// default of the chart
+	defaultTimezone = "UTC"
+
+	// e2eLabel marks the namespaces of the tests, the envtest webhook
+	// configuration selects only them
+	e2eLabel = "k8tz.io/e2e"
+
+	webhookTimeout = 2 * time.Minute
+)
+
+// errNoEnvironment is returned when there is no api server to test against
+var errNoEnvironment = errors.New("no e2e environment")
+
+// clientset of the api server under test
+var clientset kubernetes.Interface
+
+// environment is an api server with the k8tz webhook
+type environment struct {
+	clientset kubernetes.Interface
+	stop      func()
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	env, err := setup()
+	if errors.Is(err, errNoEnvironment) {
+		fmt.Fprintf(os.Stderr, "skipping e2e tests: %v\n", err)
+		return 0
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up the e2e environment: %v\n", err)
+		return 1
+	}
+	defer env.stop()
+
+	clientset = env.clientset
+	if err := waitForWebhook(); err != nil {
+		fmt.Fprintf(os.Stderr, "the webhook is not serving: %v\n", err)
+		return 1
+	}
+
+	return m.Run()
+}
+
+func setup() (*environment, error) {
+	switch provider := os.Getenv(providerEnv); provider {
+	case "", envtestProvider:
+		return startEnvtest()
+	case clusterProvider:
+		return useCluster()
+	default:
+		return nil, fmt.Errorf("unknown %s %q, expected %s or %s", providerEnv, provider, envtestProvider, clusterProvider)
+	}
+}
+
+// useCluster tests the cluster of KUBECONFIG, where k8tz is already installed
+func useCluster() (*environment, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoEnvironment, err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &environment{clientset: client, stop: func() {}}, nil
+}
+
+// waitForWebhook waits until the api server calls the webhook, which takes a
+// while after the webhook configuration is created
+func waitForWebhook() error {
+	namespace, err := createNamespace(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer deleteNamespace(namespace)
+
+	return wait.PollImmediate(time.Second, webhookTimeout, func() (bool, error) {
+		pod, err := clientset.CoreV1().Pods(namespace).Create(context.Background(), newPod(nil), metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+		if err != nil {
+			return false, nil
+		}
+
+		return findEnv(pod.Spec.Containers[0].Env, "TZ") != nil, nil
+	})
+}
+
+// namespace creates a namespace for the test, it is deleted with its objects
+// when the test ends
+func namespace(t *testing.T, annotations map[string]string) string {
+	t.Helper()
+
+	name, err := createNamespace(context.Background(), annotations)
+	if err != nil {
+		t.Fatalf("failed to create namespace: %v", err)
+	}
+
+	t.Cleanup(func() { deleteNamespace(name) })
+	return name
+}
+
+func createNamespace(ctx context.Context, annotations map[string]string) (string, error) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "k8tz-e2e-",
+			Labels:       map[string]string{e2eLabel: "true"},
+			Annotations:  annotations,
+		},
+	}
+
+	namespace, err := clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return namespace.Name, nil
+}
+
+func deleteNamespace(name string) {
+	if err := clientset.CoreV1().Namespaces().Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to delete namespace %s: %v\n", name, err)
+	}
+}
+
+func newPod(annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "test-",
+			Annotations:  annotations,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name:    "test",
+				Image:   "busybox",
+				Command: []string{"sleep", "3600"},
+			}},
+		},
+	}
+}
+
+func findEnv(env []corev1.EnvVar, name string) *corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == name {
+			return &env[i]
+		}
+	}
+
+	return nil
+}
+
+func findVolume(spec *corev1.PodSpec) *corev1.Volume {
+	for i := range spec.Volumes {
+		if spec.Volumes[i].Name == inject.VolumeName {
+			return &spec.Volumes[i]
+		}
+	}
+
+	return nil
+}
+
+func findBootstrap(spec *corev1.PodSpec) *corev1.Container {
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == inject.BootstrapContainerName {
+			return &spec.InitContainers[i]
+		}
+	}
+
+	return nil
+}